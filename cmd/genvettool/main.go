@@ -0,0 +1,64 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The genvettool command generates the main package of a vet tool
+// that runs a list of analyzers under the unitchecker driver.
+//
+// Usage:
+//
+//   genvettool [-o file] analyzer...
+//
+// Each analyzer is the import path of a package that declares an
+// analyzer in a variable named Analyzer, optionally followed by a colon
+// and the name of another variable. For example, a vet tool can be kept
+// in its own directory with a go:generate directive:
+//
+//   //go:generate genvettool -o main.go github.com/jackie-feng/tools/go/analysis/passes/printf example.com/lint:NilErrAnalyzer
+//
+// and built with:
+//
+//   $ go generate && go build -o vettool
+//   $ go vet -vettool=$(pwd)/vettool my/project/...
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jackie-feng/tools/go/analysis/unitchecker"
+)
+
+var output = flag.String("o", "", "write the generated file to `file` instead of standard output")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: genvettool [-o file] analyzer...\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("genvettool: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+
+	var buf bytes.Buffer
+	if err := unitchecker.WriteMain(&buf, "genvettool", flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
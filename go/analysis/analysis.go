@@ -101,6 +101,21 @@ type Pass struct {
 	// analysis's ResultType.
 	ResultOf map[*Analyzer]interface{}
 
+	// Shared returns a value that is shared by all analyzers applied
+	// to the current package, such as an SSA program or a call graph
+	// that several analyzers need but that is not the result of any
+	// single Analyzer.
+	//
+	// The first call for a given key computes the value by calling
+	// build; later calls for the same key, from this or any other
+	// analyzer, return the same value and error without calling build.
+	// As with context keys, key should be a value of an unexported
+	// type defined by the package that provides the resource, to avoid
+	// collisions. The value should not be modified once built.
+	//
+	// Shared is safe for concurrent use.
+	Shared func(key interface{}, build func() (interface{}, error)) (interface{}, error)
+
 	// -- facts --
 
 	// ImportObjectFact retrieves a fact associated with obj.
@@ -211,9 +226,9 @@ func (pass *Pass) String() string {
 // see Analyzer.Requires, Analyzer.ResultType, and Pass.ResultOf.
 //
 // A Fact type must be a pointer.
-// Facts are encoded and decoded using encoding/gob.
-// A Fact may implement the GobEncoder/GobDecoder interfaces
-// to customize its encoding. Fact encoding should not fail.
+// Facts are encoded and decoded using encoding/gob, or optionally
+// encoding/json. A Fact may implement the GobEncoder/GobDecoder
+// interfaces to customize its encoding. Fact encoding should not fail.
 //
 // A Fact should not be modified once exported.
 type Fact interface {
@@ -2,7 +2,9 @@
 package analysistest
 
 import (
+	"bytes"
 	"fmt"
+	"go/format"
 	"go/token"
 	"go/types"
 	"io/ioutil"
@@ -19,6 +21,7 @@ import (
 	"github.com/jackie-feng/tools/go/analysis/internal/checker"
 	"github.com/jackie-feng/tools/go/packages"
 	"github.com/jackie-feng/tools/internal/testenv"
+	"github.com/jackie-feng/tools/txtar"
 )
 
 // WriteFiles is a helper function that creates a temporary directory
@@ -43,6 +46,27 @@ func WriteFiles(filemap map[string]string) (dir string, cleanup func(), err erro
 	return gopath, cleanup, nil
 }
 
+// WriteArchive is like WriteFiles, but populates the GOPATH-style project
+// with the files of a txtar archive, whose names are relative to its src
+// directory. It allows a test to supply its source tree in a single file
+// of the testdata, or inline:
+//
+//	dir, cleanup, err := analysistest.WriteArchive(txtar.Parse([]byte(`
+//	-- a/a.go --
+//	package a
+//	...
+//	`)))
+func WriteArchive(ar *txtar.Archive) (dir string, cleanup func(), err error) {
+	filemap := make(map[string]string)
+	for _, f := range ar.Files {
+		if _, ok := filemap[f.Name]; ok {
+			return "", nil, fmt.Errorf("duplicate file %s in archive", f.Name)
+		}
+		filemap[f.Name] = string(f.Data)
+	}
+	return WriteFiles(filemap)
+}
+
 // TestData returns the effective filename of
 // the program's "testdata" directory.
 // This function may be overridden by projects using
@@ -91,9 +115,30 @@ type Testing interface {
 //
 //	// want "diag" "diag2" x:"fact1" x:"fact2" y:"fact3"
 //
+// A diagnostic expectation may be followed by options that constrain
+// the column of the diagnostic, its Category, and the messages of its
+// related information, in order:
+//
+//	x := f(y) // want "unused result" col=7 category="unusedresult" related="declared here"
+//
+// The diagnostics of a line are matched in the order of their positions
+// against its expectations in the order they are declared.
+//
 // Unexpected diagnostics and facts, and unmatched expectations, are
 // reported as errors to the Testing.
 //
+// If a pattern names a directory of dir/src holding a go.mod file, such
+// as "example.com/a" for dir/src/example.com/a/go.mod, the packages of
+// that module are loaded in module mode from that directory instead, so
+// that analyzers whose behavior depends on module boundaries can be
+// tested. A pattern within such a module, such as "example.com/a/sub"
+// or "example.com/a/sub/...", loads only the packages it denotes. The module may depend on other modules of dir/src through
+// replace directives, such as
+//
+//	replace example.com/b => ../b
+//
+// as no module is downloaded.
+//
 // Run reports an error to the Testing if loading or analysis failed.
 // Run also returns a Result for each package for which analysis was
 // attempted, even if unsuccessful. It is safe for a test to ignore all
@@ -120,13 +165,207 @@ func Run(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Res
 	return results
 }
 
+// RunArchive behaves like Run, but loads the packages from a temporary
+// GOPATH-style project populated with the files of a txtar archive, as
+// by WriteArchive, which it deletes before returning. The archive may be
+// parsed from a file of the testdata, or from a string in the test:
+//
+//	ar, err := txtar.ParseFile(filepath.Join(analysistest.TestData(), "a.txtar"))
+//	...
+//	analysistest.RunArchive(t, ar, myanalyzer.Analyzer, "a")
+//
+// A file of the archive may be a go.mod file, as for Run.
+func RunArchive(t Testing, ar *txtar.Archive, a *analysis.Analyzer, patterns ...string) []*Result {
+	dir, cleanup, err := WriteArchive(ar)
+	if err != nil {
+		t.Errorf("writing archive: %v", err)
+		return nil
+	}
+	defer cleanup()
+	return Run(t, dir, a, patterns...)
+}
+
+// RunWithSuggestedFixes behaves like Run, but additionally verifies the
+// suggested fixes of the diagnostics against golden files: the fixes of
+// example.go are compared with example.go.golden, in the same directory.
+//
+// A golden file holds either the Go source of the file after all of its
+// fixes are applied, or, when a diagnostic has alternative fixes, a txtar
+// archive with a section for each fix message, such as
+//
+//	-- Replace with print --
+//	package a
+//	...
+//	-- Delete the call --
+//	package a
+//	...
+//
+// in which case the fixes of each message are applied to the original
+// file separately and compared with the content of their section.
+// Both the fixed file and the golden file are formatted before they are
+// compared. A file with fixes but no golden file is reported as an error.
+func RunWithSuggestedFixes(t Testing, dir string, a *analysis.Analyzer, patterns ...string) []*Result {
+	results := Run(t, dir, a, patterns...)
+
+	// Group the edits of each file by the message of their fix.
+	type file struct {
+		name  string
+		edits map[string][]analysis.TextEdit // keyed by fix message
+	}
+	var files []*file
+	byName := make(map[string]*file)
+	for _, result := range results {
+		fset := result.Pass.Fset
+		for _, diag := range result.Diagnostics {
+			for _, fix := range diag.SuggestedFixes {
+				for _, edit := range fix.TextEdits {
+					tf := fset.File(edit.Pos)
+					if tf == nil {
+						t.Errorf("%v: edit of fix %q is not within a file", fset.Position(diag.Pos), fix.Message)
+						continue
+					}
+					f := byName[tf.Name()]
+					if f == nil {
+						f = &file{tf.Name(), make(map[string][]analysis.TextEdit)}
+						byName[tf.Name()] = f
+						files = append(files, f)
+					}
+					// Convert the edit to byte offsets,
+					// which apply to the file as it is on disk.
+					e := analysis.TextEdit{
+						Pos:     token.Pos(tf.Offset(edit.Pos)),
+						End:     token.Pos(tf.Offset(edit.End)),
+						NewText: edit.NewText,
+					}
+					// The same fix is suggested in each variant of a package.
+					if !hasEdit(f.edits[fix.Message], e) {
+						f.edits[fix.Message] = append(f.edits[fix.Message], e)
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+
+	for _, f := range files {
+		name := sanitize(dir, f.name)
+		orig, err := ioutil.ReadFile(f.name)
+		if err != nil {
+			t.Errorf("%s: can't read file: %v", name, err)
+			continue
+		}
+		golden, err := ioutil.ReadFile(f.name + ".golden")
+		if err != nil {
+			t.Errorf("%s: can't read golden file of suggested fixes: %v", name, err)
+			continue
+		}
+
+		ar := txtar.Parse(golden)
+		if len(ar.Files) == 0 {
+			// A plain golden file: apply all the fixes.
+			var all []analysis.TextEdit
+			var messages []string
+			for message := range f.edits {
+				messages = append(messages, message)
+			}
+			sort.Strings(messages)
+			for _, message := range messages {
+				all = append(all, f.edits[message]...)
+			}
+			checkFixed(t, name, "", orig, all, golden)
+			continue
+		}
+
+		// A txtar golden file: apply the fixes of each message.
+		sections := make(map[string]bool)
+		for _, section := range ar.Files {
+			sections[section.Name] = true
+			edits, ok := f.edits[section.Name]
+			if !ok {
+				t.Errorf("%s: no suggested fix has message %q of the golden file", name, section.Name)
+				continue
+			}
+			checkFixed(t, name, section.Name, orig, edits, section.Data)
+		}
+		var missing []string
+		for message := range f.edits {
+			if !sections[message] {
+				missing = append(missing, message)
+			}
+		}
+		sort.Strings(missing)
+		for _, message := range missing {
+			t.Errorf("%s: golden file has no section for suggested fix %q", name, message)
+		}
+	}
+	return results
+}
+
+// checkFixed applies edits, in byte offsets, to the original content of
+// the named file and reports an error to the Testing if the formatted
+// result differs from golden. The message of the fixes, if any, qualifies
+// the errors.
+func checkFixed(t Testing, name, message string, orig []byte, edits []analysis.TextEdit, golden []byte) {
+	if message != "" {
+		name = fmt.Sprintf("%s (fix %q)", name, message)
+	}
+	got, err := applyEdits(orig, edits)
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return
+	}
+	formatted, err := format.Source(got)
+	if err != nil {
+		t.Errorf("%s: fixed file does not parse: %v\n%s", name, err, got)
+		return
+	}
+	if want, err := format.Source(golden); err == nil {
+		golden = want
+	}
+	if !bytes.Equal(formatted, golden) {
+		t.Errorf("%s: suggested fixes do not match golden file:\n--- got ---\n%s--- want ---\n%s", name, formatted, golden)
+	}
+}
+
+func hasEdit(edits []analysis.TextEdit, e analysis.TextEdit) bool {
+	for _, other := range edits {
+		if other.Pos == e.Pos && other.End == e.End && bytes.Equal(other.NewText, e.NewText) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEdits returns the result of applying edits, whose positions are
+// byte offsets, to src. The edits must not overlap.
+func applyEdits(src []byte, edits []analysis.TextEdit) ([]byte, error) {
+	edits = append([]analysis.TextEdit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Pos < edits[j].Pos })
+	var out bytes.Buffer
+	cur := 0 // current offset in src
+	for _, edit := range edits {
+		start, end := int(edit.Pos), int(edit.End)
+		if start > end || end > len(src) {
+			return nil, fmt.Errorf("malformed edit at offsets (%d, %d)", start, end)
+		}
+		if start < cur {
+			return nil, fmt.Errorf("overlapping edits at offset %d", start)
+		}
+		out.Write(src[cur:start])
+		out.Write(edit.NewText)
+		cur = end
+	}
+	out.Write(src[cur:])
+	return out.Bytes(), nil
+}
+
 // A Result holds the result of applying an analyzer to a package.
 type Result = checker.TestAnalyzerResult
 
 // loadPackages uses go/packages to load a specified packages (from source, with
 // dependencies) from dir, which is the root of a GOPATH-style project
-// tree. It returns an error if any package had an error, or the pattern
-// matched no packages.
+// tree, or from the modules of dir/src named by the patterns. It returns an
+// error if any package had an error, or the pattern matched no packages.
 func loadPackages(dir string, patterns ...string) ([]*packages.Package, error) {
 	// packages.Load loads the real standard library, not a minimal
 	// fake version, which would be more efficient, especially if we
@@ -135,15 +374,48 @@ func loadPackages(dir string, patterns ...string) ([]*packages.Package, error) {
 	// a list of packages we generate and then do the parsing and
 	// typechecking, though this feature seems to be a recurring need.
 
-	cfg := &packages.Config{
-		Mode:  packages.LoadAllSyntax,
-		Dir:   dir,
-		Tests: true,
-		Env:   append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOPROXY=off"),
+	var pkgs []*packages.Package
+	var gopathPatterns []string
+	var moddirs []string                     // in order of first use
+	modPatterns := make(map[string][]string) // patterns relative to each module directory
+	for _, pattern := range patterns {
+		moddir, rel := findModule(dir, pattern)
+		if moddir == "" {
+			gopathPatterns = append(gopathPatterns, pattern)
+			continue
+		}
+		if modPatterns[moddir] == nil {
+			moddirs = append(moddirs, moddir)
+		}
+		modPatterns[moddir] = append(modPatterns[moddir], rel)
 	}
-	pkgs, err := packages.Load(cfg, patterns...)
-	if err != nil {
-		return nil, err
+	for _, moddir := range moddirs {
+		// -mod=readonly keeps the go command from editing the
+		// go.mod files of the testdata.
+		cfg := &packages.Config{
+			Mode:  packages.LoadAllSyntax,
+			Dir:   moddir,
+			Tests: true,
+			Env:   append(os.Environ(), "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=-mod=readonly"),
+		}
+		modpkgs, err := packages.Load(cfg, modPatterns[moddir]...)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, modpkgs...)
+	}
+	if len(gopathPatterns) > 0 {
+		cfg := &packages.Config{
+			Mode:  packages.LoadAllSyntax,
+			Dir:   dir,
+			Tests: true,
+			Env:   append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOPROXY=off"),
+		}
+		gopathpkgs, err := packages.Load(cfg, gopathPatterns...)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, gopathpkgs...)
 	}
 
 	// Print errors but do not stop:
@@ -156,6 +428,32 @@ func loadPackages(dir string, patterns ...string) ([]*packages.Package, error) {
 	return pkgs, nil
 }
 
+// findModule returns the directory of the module of dir/src that
+// encloses the package or packages denoted by pattern, and the pattern
+// relative to that directory, such as "./sub/..." for the pattern
+// "example.com/a/sub/..." and the module directory dir/src/example.com/a.
+// It returns "" if pattern is not within a module of dir/src.
+func findModule(dir, pattern string) (moddir, rel string) {
+	src := filepath.Join(dir, "src")
+	path, suffix := pattern, ""
+	if strings.HasSuffix(path, "/...") {
+		path, suffix = strings.TrimSuffix(path, "/..."), "/..."
+	} else if path == "..." {
+		return "", ""
+	}
+	for d := filepath.Join(src, filepath.FromSlash(path)); d != src && strings.HasPrefix(d, src); d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			r, _ := filepath.Rel(d, filepath.Join(src, filepath.FromSlash(path)))
+			if r == "." {
+				// The module itself: load all of its packages.
+				return d, "./..."
+			}
+			return d, "./" + filepath.ToSlash(r) + suffix
+		}
+	}
+	return "", ""
+}
+
 // check inspects an analysis pass on which the analysis has already
 // been run, and verifies that all reported diagnostics and facts match
 // specified by the contents of "// want ..." comments in the package's
@@ -235,24 +533,36 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 		}
 	}
 
-	checkMessage := func(posn token.Position, kind, name, message string) {
+	// checkMessage checks a diagnostic or fact against the expectations
+	// of its line, in the order they were declared. The diagnostic, if
+	// any, is also checked against the column, category and related
+	// information of the expectations.
+	checkMessage := func(posn token.Position, kind, name, message string, diag *analysis.Diagnostic) {
 		posn.Filename = sanitize(gopath, posn.Filename)
 		k := key{posn.Filename, posn.Line}
 		expects := want[k]
-		var unmatched []string
+		var unmatched, mismatches []string
 		for i, exp := range expects {
 			if exp.kind == kind && exp.name == name {
 				if exp.rx.MatchString(message) {
-					// matched: remove the expectation.
-					expects[i] = expects[len(expects)-1]
-					expects = expects[:len(expects)-1]
-					want[k] = expects
+					if diag != nil {
+						if why := exp.mismatch(pass.Fset, gopath, posn, diag); why != "" {
+							mismatches = append(mismatches, why)
+							continue
+						}
+					}
+					// matched: remove the expectation,
+					// preserving the order of the others.
+					want[k] = append(expects[:i:i], expects[i+1:]...)
 					return
 				}
 				unmatched = append(unmatched, fmt.Sprintf("%q", exp.rx))
 			}
 		}
-		if unmatched == nil {
+		if mismatches != nil {
+			t.Errorf("%v: %s %q matches pattern but %s",
+				posn, kind, message, strings.Join(mismatches, ", or "))
+		} else if unmatched == nil {
 			t.Errorf("%v: unexpected %s: %v", posn, kind, message)
 		} else {
 			t.Errorf("%v: %s %q does not match pattern %s",
@@ -260,11 +570,14 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 		}
 	}
 
-	// Check the diagnostics match expectations.
-	for _, f := range diagnostics {
+	// Check the diagnostics match expectations,
+	// in the order of their positions.
+	diagnostics = append([]analysis.Diagnostic(nil), diagnostics...)
+	sort.SliceStable(diagnostics, func(i, j int) bool { return diagnostics[i].Pos < diagnostics[j].Pos })
+	for i, f := range diagnostics {
 		// TODO(matloob): Support ranges in analysistest.
 		posn := pass.Fset.Position(f.Pos)
-		checkMessage(posn, "diagnostic", "", f.Message)
+		checkMessage(posn, "diagnostic", "", f.Message, &diagnostics[i])
 	}
 
 	// Check the facts match expectations.
@@ -299,7 +612,7 @@ func check(t Testing, gopath string, pass *analysis.Pass, diagnostics []analysis
 		}
 
 		for _, fact := range facts[obj] {
-			checkMessage(posn, "fact", name, fmt.Sprint(fact))
+			checkMessage(posn, "fact", name, fmt.Sprint(fact), nil)
 		}
 	}
 
@@ -327,22 +640,61 @@ type expectation struct {
 	kind string // either "fact" or "diagnostic"
 	name string // name of object to which fact belongs, or "package" ("fact" only)
 	rx   *regexp.Regexp
+
+	// The following are set by the options of a diagnostic expectation.
+	col        int              // column of the diagnostic, if nonzero
+	category   *string          // category of the diagnostic, if non-nil
+	related    []*regexp.Regexp // messages of the related information, in order
+	hasRelated bool             // whether related was specified
 }
 
 func (ex expectation) String() string {
 	return fmt.Sprintf("%s %s:%q", ex.kind, ex.name, ex.rx) // for debugging
 }
 
+// mismatch returns a description of the way in which the diagnostic
+// at posn, relative to gopath, does not satisfy the options of the expectation, or "".
+func (ex expectation) mismatch(fset *token.FileSet, gopath string, posn token.Position, diag *analysis.Diagnostic) string {
+	if ex.col != 0 && posn.Column != ex.col {
+		return fmt.Sprintf("is at column %d, not %d", posn.Column, ex.col)
+	}
+	if ex.category != nil && diag.Category != *ex.category {
+		return fmt.Sprintf("has category %q, not %q", diag.Category, *ex.category)
+	}
+	if ex.hasRelated {
+		if len(diag.Related) != len(ex.related) {
+			return fmt.Sprintf("has %d related information, not %d", len(diag.Related), len(ex.related))
+		}
+		for i, rel := range diag.Related {
+			if !ex.related[i].MatchString(rel.Message) {
+				rposn := fset.Position(rel.Pos)
+				rposn.Filename = sanitize(gopath, rposn.Filename)
+				return fmt.Sprintf("related information %q at %v does not match pattern %q",
+					rel.Message, rposn, ex.related[i])
+			}
+		}
+	}
+	return ""
+}
+
 // parseExpectations parses the content of a "// want ..." comment
 // and returns the expectations, a mixture of diagnostics ("rx") and
 // facts (name:"rx").
+//
+// A diagnostic expectation may be followed by options of the form
+// name=value that further constrain the diagnostic:
+//
+//	col=N          the diagnostic is at column N (in bytes, from 1)
+//	category="c"   the Category of the diagnostic is c
+//	related="rx"   the diagnostic has related information whose message
+//	               matches rx; repeated, in the order of the information
 func parseExpectations(text string) ([]expectation, error) {
 	var scanErr string
 	sc := new(scanner.Scanner).Init(strings.NewReader(text))
 	sc.Error = func(s *scanner.Scanner, msg string) {
 		scanErr = msg // e.g. bad string escape
 	}
-	sc.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanRawStrings
+	sc.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanStrings | scanner.ScanRawStrings
 
 	scanRegexp := func(tok rune) (*regexp.Regexp, error) {
 		if tok != scanner.String && tok != scanner.RawString {
@@ -353,6 +705,39 @@ func parseExpectations(text string) ([]expectation, error) {
 		return regexp.Compile(pattern)
 	}
 
+	// scanOption parses the value of the option name
+	// of the diagnostic expectation exp.
+	scanOption := func(exp *expectation, name string) error {
+		tok := sc.Scan()
+		switch name {
+		case "col":
+			if tok != scanner.Int {
+				return fmt.Errorf("got %s after col=, want column", scanner.TokenString(tok))
+			}
+			col, err := strconv.Atoi(sc.TokenText())
+			if err != nil || col < 1 {
+				return fmt.Errorf("invalid column %s", sc.TokenText())
+			}
+			exp.col = col
+		case "category":
+			if tok != scanner.String && tok != scanner.RawString {
+				return fmt.Errorf("got %s after category=, want string", scanner.TokenString(tok))
+			}
+			category, _ := strconv.Unquote(sc.TokenText()) // can't fail
+			exp.category = &category
+		case "related":
+			rx, err := scanRegexp(tok)
+			if err != nil {
+				return err
+			}
+			exp.related = append(exp.related, rx)
+			exp.hasRelated = true
+		default:
+			return fmt.Errorf("unknown option %s", name)
+		}
+		return nil
+	}
+
 	var expects []expectation
 	for {
 		tok := sc.Scan()
@@ -362,11 +747,20 @@ func parseExpectations(text string) ([]expectation, error) {
 			if err != nil {
 				return nil, err
 			}
-			expects = append(expects, expectation{"diagnostic", "", rx})
+			expects = append(expects, expectation{kind: "diagnostic", rx: rx})
 
 		case scanner.Ident:
 			name := sc.TokenText()
 			tok = sc.Scan()
+			if tok == '=' {
+				if len(expects) == 0 || expects[len(expects)-1].kind != "diagnostic" {
+					return nil, fmt.Errorf("option %s does not follow a diagnostic", name)
+				}
+				if err := scanOption(&expects[len(expects)-1], name); err != nil {
+					return nil, err
+				}
+				continue
+			}
 			if tok != ':' {
 				return nil, fmt.Errorf("got %s after %s, want ':'",
 					scanner.TokenString(tok), name)
@@ -376,7 +770,7 @@ func parseExpectations(text string) ([]expectation, error) {
 			if err != nil {
 				return nil, err
 			}
-			expects = append(expects, expectation{"fact", name, rx})
+			expects = append(expects, expectation{kind: "fact", name: name, rx: rx})
 
 		case scanner.EOF:
 			if scanErr != "" {
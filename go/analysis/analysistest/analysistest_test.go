@@ -2,15 +2,19 @@ package analysistest_test
 
 import (
 	"fmt"
+	"go/ast"
 	"log"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
+	"github.com/jackie-feng/tools/go/analysis"
 	"github.com/jackie-feng/tools/go/analysis/analysistest"
 	"github.com/jackie-feng/tools/go/analysis/passes/findcall"
 	"github.com/jackie-feng/tools/internal/testenv"
+	"github.com/jackie-feng/tools/txtar"
 )
 
 func init() {
@@ -95,8 +99,335 @@ func println(...interface{}) { println() } // want println:"found" "call of prin
 	}
 }
 
+// TestFacts tests the reporting of unexpected, mismatched and missing
+// facts.
+func TestFacts(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	findcall.Analyzer.Flags.Set("name", "println")
+
+	filemap := map[string]string{"a/a.go": `package a // want package:"found"
+
+func println(...interface{}) {} // want println:"wrong"
+
+func print(...interface{}) {} // want print:"found"
+
+func f() { println() } // want "call of println"
+`}
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) }) // a fake *testing.T
+	analysistest.Run(t2, dir, findcall.Analyzer, "a")
+
+	want := []string{
+		`a/a.go:3:6: fact "found" does not match pattern "wrong"`,
+		`a/a.go:3: no fact was reported matching "wrong"`,
+		`a/a.go:5: no fact was reported matching "found"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"),
+			strings.Join(want, "\n"))
+	}
+}
+
 type errorfunc func(string)
 
 func (f errorfunc) Errorf(format string, args ...interface{}) {
 	f(fmt.Sprintf(format, args...))
 }
+
+// TestModule tests that the packages of a module of the testdata are loaded
+// in module mode.
+func TestModule(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	findcall.Analyzer.Flags.Set("name", "println")
+
+	filemap := map[string]string{
+		"example.com/a/go.mod": `module example.com/a
+
+require example.com/b v0.0.0
+
+replace example.com/b => ../b
+`,
+		"example.com/a/a.go": `package a
+
+import "example.com/b"
+
+func f() {
+	b.B()
+	println() // want "call of println"
+}
+`,
+		"example.com/a/sub/sub.go": `package sub
+
+func f() {
+	println() // want "call of println"
+}
+`,
+		"example.com/b/go.mod": "module example.com/b\n",
+		"example.com/b/b.go":   "package b\n\nfunc B() { println() }\n",
+	}
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) }) // a fake *testing.T
+	results := analysistest.Run(t2, dir, findcall.Analyzer, "example.com/a")
+	if len(got) > 0 {
+		t.Errorf("unexpected errors:\n%s", strings.Join(got, "\n"))
+	}
+	var paths []string
+	for _, result := range results {
+		paths = append(paths, result.Pass.Pkg.Path())
+	}
+	sort.Strings(paths)
+	if want := []string{"example.com/a", "example.com/a/sub"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("analyzed packages %v, want %v", paths, want)
+	}
+
+	// A pattern within the module loads only the packages it denotes.
+	paths = nil
+	for _, result := range analysistest.Run(t2, dir, findcall.Analyzer, "example.com/a/sub") {
+		paths = append(paths, result.Pass.Pkg.Path())
+	}
+	if len(got) > 0 {
+		t.Errorf("unexpected errors:\n%s", strings.Join(got, "\n"))
+	}
+	if want := []string{"example.com/a/sub"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("analyzed packages %v, want %v", paths, want)
+	}
+}
+
+// renamecall reports calls to println, with two alternative fixes.
+var renamecall = &analysis.Analyzer{
+	Name: "renamecall",
+	Doc:  "report calls to println, with fixes",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "println" {
+						pass.Report(analysis.Diagnostic{
+							Pos:     call.Pos(),
+							Message: "call of println",
+							SuggestedFixes: []analysis.SuggestedFix{
+								{Message: "Replace with print", TextEdits: []analysis.TextEdit{
+									{Pos: id.Pos(), End: id.End(), NewText: []byte("print")},
+								}},
+								{Message: "Drop the arguments", TextEdits: []analysis.TextEdit{
+									{Pos: call.Lparen + 1, End: call.Rparen},
+								}},
+							},
+						})
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+// TestSuggestedFixes tests that the alternative suggested fixes of the
+// diagnostics are compared with the sections of a txtar golden file.
+func TestSuggestedFixes(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	filemap := map[string]string{
+		"a/a.go": `package a
+
+func f() {
+	println("hello") // want "call of println"
+}
+`,
+		"a/a.go.golden": `-- Replace with print --
+package a
+
+func f() {
+	print("hello") // want "call of println"
+}
+-- Drop the arguments --
+package a
+
+func f() {
+	println() // want "call of println"
+}
+`,
+		"b/b.go": `package b
+
+func f() {
+	println("hello") // want "call of println"
+}
+`,
+		"b/b.go.golden": `-- Replace with print --
+package b
+
+func f() {
+	print("goodbye") // want "call of println"
+}
+`,
+	}
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) }) // a fake *testing.T
+	analysistest.RunWithSuggestedFixes(t2, dir, renamecall, "a")
+	if len(got) > 0 {
+		t.Errorf("unexpected errors:\n%s", strings.Join(got, "\n"))
+	}
+
+	got = nil
+	analysistest.RunWithSuggestedFixes(t2, dir, renamecall, "b")
+	want := []string{
+		`b/b.go (fix "Replace with print"): suggested fixes do not match golden file`,
+		`b/b.go: golden file has no section for suggested fix "Drop the arguments"`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for i := range got {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("got error %q, want prefix %q", got[i], want[i])
+		}
+	}
+}
+
+// categorycall reports calls to println, with a category and the
+// related information of the callee.
+var categorycall = &analysis.Analyzer{
+	Name: "categorycall",
+	Doc:  "report calls to println, with a category",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "println" {
+						pass.Report(analysis.Diagnostic{
+							Pos:      call.Lparen,
+							Category: "calls",
+							Message:  "call of println",
+							Related:  []analysis.RelatedInformation{{Pos: id.Pos(), Message: "callee println"}},
+						})
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+// TestOptions tests the options of diagnostic expectations.
+func TestOptions(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	filemap := map[string]string{"a/a.go": `package a
+
+func f() {
+	println() // want "call of println" col=9 category="calls" related="callee"
+
+	// OK (multiple diagnostics, in order)
+	println(); println() // want "println" col=9 "println" col=20
+
+	// The options don't match:
+	println() // want "call of println" col=2
+	println() // want "call of println" category="other"
+	println() // want "call of println" related="callee" related="callee"
+	println() // want "call of println" related="caller"
+
+	// The options are ill-formed:
+	println() // want col=9
+	println() // want "call of println" col="9"
+	println() // want "call of println" size=9
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) }) // a fake *testing.T
+	analysistest.Run(t2, dir, categorycall, "a")
+
+	want := []string{
+		`a/a.go:16: in 'want' comment: option col does not follow a diagnostic`,
+		`a/a.go:17: in 'want' comment: got String after col=, want column`,
+		`a/a.go:18: in 'want' comment: unknown option size`,
+		`a/a.go:10:9: diagnostic "call of println" matches pattern but is at column 9, not 2`,
+		`a/a.go:11:9: diagnostic "call of println" matches pattern but has category "calls", not "other"`,
+		`a/a.go:12:9: diagnostic "call of println" matches pattern but has 1 related information, not 2`,
+		`a/a.go:13:9: diagnostic "call of println" matches pattern but related information "callee println" at a/a.go:13:2 does not match pattern "caller"`,
+		`a/a.go:16:9: unexpected diagnostic: call of println`,
+		`a/a.go:17:9: unexpected diagnostic: call of println`,
+		`a/a.go:18:9: unexpected diagnostic: call of println`,
+		`a/a.go:10: no diagnostic was reported matching "call of println"`,
+		`a/a.go:11: no diagnostic was reported matching "call of println"`,
+		`a/a.go:12: no diagnostic was reported matching "call of println"`,
+		`a/a.go:13: no diagnostic was reported matching "call of println"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"),
+			strings.Join(want, "\n"))
+	}
+}
+
+// TestArchive tests that the packages of a txtar archive are analyzed.
+func TestArchive(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	findcall.Analyzer.Flags.Set("name", "println")
+
+	ar := txtar.Parse([]byte(`A module and a GOPATH package.
+-- example.com/a/go.mod --
+module example.com/a
+-- example.com/a/a.go --
+package a
+
+func f() {
+	println() // want "call of println"
+}
+-- b/b.go --
+package b
+
+func f() {
+	println() // want "call of println"
+}
+`))
+
+	var got []string
+	t2 := errorfunc(func(s string) { got = append(got, s) }) // a fake *testing.T
+	results := analysistest.RunArchive(t2, ar, findcall.Analyzer, "example.com/a", "b")
+	if len(got) > 0 {
+		t.Errorf("unexpected errors:\n%s", strings.Join(got, "\n"))
+	}
+	var paths []string
+	for _, result := range results {
+		paths = append(paths, result.Pass.Pkg.Path())
+	}
+	sort.Strings(paths)
+	if want := []string{"b", "example.com/a"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("analyzed packages %v, want %v", paths, want)
+	}
+
+	ar.Files = append(ar.Files, ar.Files[0])
+	if _, _, err := analysistest.WriteArchive(ar); err == nil || !strings.Contains(err.Error(), "duplicate file") {
+		t.Errorf("WriteArchive with duplicate file returned error %v, want duplicate file", err)
+	}
+}
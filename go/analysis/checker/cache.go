@@ -0,0 +1,526 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checker
+
+// This file defines the cache of the results of actions.
+//
+// The diagnostics and facts of an action are a function of the analyzer
+// and its flags, of the contents of the files of the package and of the
+// packages it imports, and of the facts of the actions it depends on.
+// So the key of an action in the cache is a hash of the version of the
+// analyzers, of the flags of the analyzer, of the contents of the files
+// of the package and of its imports, and of the keys of its dependencies.
+// Like the build cache of the go command, the cache is a directory of
+// files named by their keys, and the entries that are not used for a few
+// days are removed.
+//
+// An action whose results are in the cache is not executed, so it has no
+// Pass and no Result, which is fine unless another action of the same
+// package needs its Result: the actions that such an action depends on
+// are executed, even if their results are in the cache.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/packages"
+	"github.com/jackie-feng/tools/go/types/objectpath"
+)
+
+const (
+	// trimInterval is how often the cache is trimmed.
+	trimInterval = 24 * time.Hour
+
+	// trimLimit is how long an entry stays in the cache unused.
+	trimLimit = 5 * 24 * time.Hour
+
+	// mtimeInterval is how often the time of use of an entry,
+	// its modification time, is updated.
+	mtimeInterval = time.Hour
+)
+
+// A cache is the cache of the results of actions of Options.CacheDir.
+type cache struct {
+	dir     string
+	version string // the version of the analyzers
+
+	pkgHashes map[*packages.Package]string
+}
+
+// buildVersion returns the versions of the main module of the executable
+// and of the modules it depends on, as recorded in its build information,
+// or "" if they are not known, as for a build of a module with changes that
+// have no version.
+var buildVersion = func() string { return "" }
+
+// openCache opens the cache of opts, creating its directory if needed,
+// and trims it.
+func openCache(opts *Options) (*cache, error) {
+	version := opts.CacheVersion
+	if version == "" {
+		version = buildVersion()
+		if version == "" {
+			return nil, fmt.Errorf("no CacheVersion, and the modules of the executable have no versions")
+		}
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0777); err != nil {
+		return nil, err
+	}
+	c := &cache{
+		dir:       opts.CacheDir,
+		version:   version,
+		pkgHashes: make(map[*packages.Package]string),
+	}
+	c.trim()
+	return c, nil
+}
+
+// plan computes the keys of the actions and their dependencies, and reads
+// the results of those that are in the cache, and that are not needed by
+// an action that is not.
+func (c *cache) plan(opts *Options, roots []*Action) {
+	// Visit the actions in order, dependencies first.
+	var order []*Action
+	seen := make(map[*Action]bool)
+	var visit func(actions []*Action)
+	visit = func(actions []*Action) {
+		for _, act := range actions {
+			if !seen[act] {
+				seen[act] = true
+				visit(act.Deps)
+				order = append(order, act)
+			}
+		}
+	}
+	visit(roots)
+
+	for _, act := range order {
+		act.cache = c
+		act.cacheKey = c.actionKey(act)
+		for _, f := range act.Analyzer.FactTypes {
+			gob.Register(f)
+		}
+	}
+
+	// Visit the actions in reverse, dependent actions first, to find
+	// those whose Result is needed by an action that is executed.
+	needResult := make(map[*Action]bool)
+	hits := 0
+	for i := len(order) - 1; i >= 0; i-- {
+		act := order[i]
+		if !needResult[act] && act.cacheKey != "" {
+			act.cached = c.get(act)
+		}
+		if act.cached != nil {
+			hits++
+			continue
+		}
+		for _, dep := range act.Deps {
+			if dep.Package == act.Package {
+				needResult[dep] = true
+			}
+		}
+	}
+	if opts.Verbose {
+		log.Printf("%d of %d actions in the cache", hits, len(order))
+	}
+}
+
+// packageHash returns the hash of the files of pkg and of the packages it
+// imports, or "" if they cannot be read.
+func (c *cache) packageHash(pkg *packages.Package) string {
+	if hash, ok := c.pkgHashes[pkg]; ok {
+		return hash
+	}
+	c.pkgHashes[pkg] = ""
+
+	h := sha256.New()
+	fmt.Fprintf(h, "package %s %s\n", pkg.ID, pkg.PkgPath)
+	fmt.Fprintf(h, "sizes %v\n", pkg.TypesSizes)
+	filenames := append(packageFiles(pkg), pkg.OtherFiles...)
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return ""
+		}
+		fmt.Fprintf(h, "file %s %x\n", filename, sha256.Sum256(data))
+	}
+	paths := make([]string, 0, len(pkg.Imports))
+	for path := range pkg.Imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		hash := c.packageHash(pkg.Imports[path])
+		if hash == "" {
+			return ""
+		}
+		fmt.Fprintf(h, "import %s %s\n", path, hash)
+	}
+
+	hash := fmt.Sprintf("%x", h.Sum(nil))
+	c.pkgHashes[pkg] = hash
+	return hash
+}
+
+// packageFiles returns the names of the Go files of pkg: its compiled
+// Go files, or else those of its syntax trees.
+func packageFiles(pkg *packages.Package) []string {
+	if len(pkg.CompiledGoFiles) > 0 {
+		return append([]string(nil), pkg.CompiledGoFiles...)
+	}
+	var filenames []string
+	for _, f := range pkg.Syntax {
+		filenames = append(filenames, pkg.Fset.File(f.Pos()).Name())
+	}
+	return filenames
+}
+
+// actionKey returns the key of act in the cache, or "" if it cannot be
+// cached. The keys of its dependencies must be computed.
+func (c *cache) actionKey(act *Action) string {
+	pkgHash := c.packageHash(act.Package)
+	if pkgHash == "" {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "version %s\n", c.version)
+	fmt.Fprintf(h, "analyzer %s\n", act.Analyzer.Name)
+	act.Analyzer.Flags.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(h, "flag %s=%s\n", f.Name, f.Value)
+	})
+	fmt.Fprintf(h, "package %s\n", pkgHash)
+	for _, dep := range act.Deps {
+		if dep.cacheKey == "" {
+			return ""
+		}
+		fmt.Fprintf(h, "dep %s\n", dep.cacheKey)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// filename returns the name of the file of the entry of key.
+func (c *cache) filename(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// A cacheEntry is the encoding of the results of an action in the cache:
+// its diagnostics, and the facts that it exported. The positions are
+// offsets in the files of the package.
+type cacheEntry struct {
+	Diagnostics  []cachedDiagnostic
+	ObjectFacts  []cachedFact
+	PackageFacts []analysis.Fact
+}
+
+type cachedDiagnostic struct {
+	Pos, End       cachedPos
+	Category       string
+	Message        string
+	Severity       analysis.Severity
+	URL            string
+	SuggestedFixes []cachedFix
+	Related        []cachedRelated
+}
+
+type cachedFix struct {
+	Message string
+	Edits   []cachedEdit
+}
+
+type cachedEdit struct {
+	Pos, End cachedPos
+	NewText  []byte
+}
+
+type cachedRelated struct {
+	Pos, End cachedPos
+	Message  string
+}
+
+type cachedFact struct {
+	Object objectpath.Path
+	Fact   analysis.Fact
+}
+
+// A cachedPos is a position in a file of a package, or NoPos if File is "".
+type cachedPos struct {
+	File   string
+	Offset int
+}
+
+// cachedResults are the results of an action read from the cache.
+type cachedResults struct {
+	diagnostics  []analysis.Diagnostic
+	objectFacts  map[objectFactKey]analysis.Fact
+	packageFacts map[packageFactKey]analysis.Fact
+}
+
+// get returns the results of act in the cache, or nil if there are none
+// or they cannot be decoded.
+func (c *cache) get(act *Action) *cachedResults {
+	filename := c.filename(act.cacheKey)
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var entry cacheEntry
+	if err := gob.NewDecoder(f).Decode(&entry); err != nil {
+		return nil
+	}
+
+	files := newPackageFileSet(act.Package)
+	var res cachedResults
+	for _, cd := range entry.Diagnostics {
+		diag := analysis.Diagnostic{
+			Category: cd.Category,
+			Message:  cd.Message,
+			Severity: cd.Severity,
+			URL:      cd.URL,
+		}
+		var ok bool
+		if diag.Pos, diag.End, ok = files.decode(cd.Pos, cd.End); !ok {
+			return nil
+		}
+		for _, cf := range cd.SuggestedFixes {
+			fix := analysis.SuggestedFix{Message: cf.Message}
+			for _, ce := range cf.Edits {
+				edit := analysis.TextEdit{NewText: ce.NewText}
+				if edit.Pos, edit.End, ok = files.decode(ce.Pos, ce.End); !ok {
+					return nil
+				}
+				fix.TextEdits = append(fix.TextEdits, edit)
+			}
+			diag.SuggestedFixes = append(diag.SuggestedFixes, fix)
+		}
+		for _, cr := range cd.Related {
+			related := analysis.RelatedInformation{Message: cr.Message}
+			if related.Pos, related.End, ok = files.decode(cr.Pos, cr.End); !ok {
+				return nil
+			}
+			diag.Related = append(diag.Related, related)
+		}
+		res.diagnostics = append(res.diagnostics, diag)
+	}
+	res.objectFacts = make(map[objectFactKey]analysis.Fact)
+	for _, cf := range entry.ObjectFacts {
+		obj, err := objectpath.Object(act.Package.Types, cf.Object)
+		if err != nil {
+			return nil
+		}
+		res.objectFacts[objectFactKey{obj, factType(cf.Fact)}] = cf.Fact
+	}
+	res.packageFacts = make(map[packageFactKey]analysis.Fact)
+	for _, fact := range entry.PackageFacts {
+		res.packageFacts[packageFactKey{act.Package.Types, factType(fact)}] = fact
+	}
+
+	// Record the use of the entry, for trim.
+	if fi, err := f.Stat(); err == nil && time.Since(fi.ModTime()) > mtimeInterval {
+		now := time.Now()
+		os.Chtimes(filename, now, now)
+	}
+	return &res
+}
+
+// put writes the results of act to the cache, if they can be encoded.
+func (c *cache) put(act *Action) {
+	files := newPackageFileSet(act.Package)
+	var entry cacheEntry
+	for _, diag := range act.Diagnostics {
+		cd := cachedDiagnostic{
+			Category: diag.Category,
+			Message:  diag.Message,
+			Severity: diag.Severity,
+			URL:      diag.URL,
+		}
+		var ok bool
+		if cd.Pos, cd.End, ok = files.encode(diag.Pos, diag.End); !ok {
+			return
+		}
+		for _, fix := range diag.SuggestedFixes {
+			cf := cachedFix{Message: fix.Message}
+			for _, edit := range fix.TextEdits {
+				ce := cachedEdit{NewText: edit.NewText}
+				if ce.Pos, ce.End, ok = files.encode(edit.Pos, edit.End); !ok {
+					return
+				}
+				cf.Edits = append(cf.Edits, ce)
+			}
+			cd.SuggestedFixes = append(cd.SuggestedFixes, cf)
+		}
+		for _, related := range diag.Related {
+			cr := cachedRelated{Message: related.Message}
+			if cr.Pos, cr.End, ok = files.encode(related.Pos, related.End); !ok {
+				return
+			}
+			cd.Related = append(cd.Related, cr)
+		}
+		entry.Diagnostics = append(entry.Diagnostics, cd)
+	}
+	for key, fact := range act.objectFacts {
+		if key.obj.Pkg() != act.Package.Types {
+			continue
+		}
+		// The facts of objects that have no path, such as local
+		// variables, are not visible to other packages.
+		if path, err := objectpath.For(key.obj); err == nil {
+			entry.ObjectFacts = append(entry.ObjectFacts, cachedFact{path, fact})
+		}
+	}
+	for key, fact := range act.packageFacts {
+		if key.pkg == act.Package.Types {
+			entry.PackageFacts = append(entry.PackageFacts, fact)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&entry); err != nil {
+		if act.opts.Verbose {
+			log.Printf("%s: not cached: %v", act, err)
+		}
+		return
+	}
+	if err := writeFileAtomically(c.filename(act.cacheKey), buf.Bytes()); err != nil && act.opts.Verbose {
+		log.Printf("%s: not cached: %v", act, err)
+	}
+}
+
+// writeFileAtomically writes data to the file filename, creating its
+// directory if needed, such that concurrent readers never see a partial
+// file.
+func writeFileAtomically(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// trim removes the entries of the cache that were not used recently, at
+// most once per trimInterval.
+func (c *cache) trim() {
+	now := time.Now()
+	marker := filepath.Join(c.dir, "trim.txt")
+	if fi, err := os.Stat(marker); err == nil && now.Sub(fi.ModTime()) < trimInterval {
+		return
+	}
+	if err := ioutil.WriteFile(marker, nil, 0666); err != nil {
+		return
+	}
+	subdirs, _ := ioutil.ReadDir(c.dir)
+	for _, subdir := range subdirs {
+		if !subdir.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.dir, subdir.Name())
+		entries, _ := ioutil.ReadDir(dir)
+		for _, entry := range entries {
+			if now.Sub(entry.ModTime()) > trimLimit {
+				os.Remove(filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+}
+
+// packageFileSet maps between the positions of the files of a package and
+// their offsets.
+type packageFileSet struct {
+	pkg   *packages.Package
+	files map[string]*token.File // by name, nil for the other files not yet in the file set
+}
+
+func newPackageFileSet(pkg *packages.Package) *packageFileSet {
+	files := make(map[string]*token.File)
+	for _, filename := range pkg.OtherFiles {
+		files[filename] = nil
+	}
+	for _, f := range pkg.Syntax {
+		tf := pkg.Fset.File(f.Pos())
+		files[tf.Name()] = tf
+	}
+	return &packageFileSet{pkg, files}
+}
+
+// encode returns the offsets of pos and end, which must be in the files of
+// the package, or NoPos.
+func (s *packageFileSet) encode(pos, end token.Pos) (cpos, cend cachedPos, ok bool) {
+	encode := func(pos token.Pos) (cachedPos, bool) {
+		if !pos.IsValid() {
+			return cachedPos{}, true
+		}
+		tf := s.pkg.Fset.File(pos)
+		if tf == nil {
+			return cachedPos{}, false
+		}
+		if _, ok := s.files[tf.Name()]; !ok {
+			return cachedPos{}, false
+		}
+		return cachedPos{tf.Name(), tf.Offset(pos)}, true
+	}
+	cpos, ok = encode(pos)
+	if ok {
+		cend, ok = encode(end)
+	}
+	return cpos, cend, ok
+}
+
+// decode returns the positions of the offsets cpos and cend, adding the
+// other files of the package to its file set if needed.
+func (s *packageFileSet) decode(cpos, cend cachedPos) (pos, end token.Pos, ok bool) {
+	decode := func(cpos cachedPos) (token.Pos, bool) {
+		if cpos.File == "" {
+			return token.NoPos, true
+		}
+		tf, ok := s.files[cpos.File]
+		if !ok {
+			return token.NoPos, false
+		}
+		if tf == nil {
+			content, err := ioutil.ReadFile(cpos.File)
+			if err != nil {
+				return token.NoPos, false
+			}
+			tf = s.pkg.Fset.AddFile(cpos.File, -1, len(content))
+			tf.SetLinesForContent(content)
+			s.files[cpos.File] = tf
+		}
+		if cpos.Offset < 0 || cpos.Offset > tf.Size() {
+			return token.NoPos, false
+		}
+		return tf.Pos(cpos.Offset), true
+	}
+	pos, ok = decode(cpos)
+	if ok {
+		end, ok = decode(cend)
+	}
+	return pos, end, ok
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.12
+// +build go1.12
+
+package checker
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+func init() {
+	buildVersion = moduleVersions
+}
+
+func moduleVersions() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || !versioned(&info.Main) {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintln(&b, runtime.Version())
+	fmt.Fprintf(&b, "%s@%s %s\n", info.Main.Path, info.Main.Version, info.Main.Sum)
+	for _, m := range info.Deps {
+		if m.Replace != nil {
+			m = m.Replace
+		}
+		// A module replaced by a directory has no version, and its
+		// analyzers may change without it.
+		if !versioned(m) {
+			return ""
+		}
+		fmt.Fprintf(&b, "%s@%s %s\n", m.Path, m.Version, m.Sum)
+	}
+	return b.String()
+}
+
+func versioned(m *debug.Module) bool {
+	return m.Version != "" && m.Version != "(devel)"
+}
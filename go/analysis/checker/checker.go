@@ -0,0 +1,780 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package checker runs analyzers on packages loaded with go/packages, for
+// programs that analyze code without running a driver command such as
+// those of the singlechecker and multichecker packages.
+//
+// Load loads the packages, and Run applies the analyzers to them, and to
+// their dependencies for the analyzers that use facts, in parallel and in
+// the order of the dependencies:
+//
+//	pkgs, err := checker.Load(nil, analyzers, "./...")
+//	if err != nil {
+//		...
+//	}
+//	results := checker.Run(pkgs, analyzers, nil)
+//	for _, diag := range results.Diagnostics() {
+//		posn := diag.Package.Fset.Position(diag.Pos)
+//		fmt.Printf("%s: %s: %s\n", posn, diag.Analyzer.Name, diag.Message)
+//	}
+//
+// The packages of Load may have errors, which Run reports as the errors of
+// the actions that need their type information.
+//
+// If Options.CacheDir is set, Run records the diagnostics and facts of the
+// actions in a cache on disk, keyed by the contents of the packages, and
+// does not execute again the actions whose results are in the cache.
+package checker
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/internal/facts"
+	"github.com/jackie-feng/tools/go/packages"
+	"github.com/jackie-feng/tools/internal/analysisinternal"
+)
+
+// Options control the execution of the analyzers by Run.
+type Options struct {
+	Concurrency int  // maximum number of actions executed at once, or 0 for GOMAXPROCS
+	SanityCheck bool // do additional checks on fact types and serialization
+	LogFacts    bool // print the facts to stderr as they are created
+	Timing      bool // record the Duration of each action
+	Verbose     bool // log the progress of Run
+
+	// Progress, if non-nil, receives a line as each action starts, and
+	// as it finishes, with its duration, so that a slow analysis can be
+	// followed as it runs. Progress implies Timing.
+	Progress io.Writer
+
+	// CacheDir is the directory of the cache of the diagnostics and
+	// facts of the actions, or "" for none. The actions whose results
+	// are in the cache are not executed, so they have no Pass or Result.
+	CacheDir string
+
+	// CacheVersion identifies the version of the analyzers in the cache.
+	// If it is empty, Run uses the versions of the modules that the
+	// executable was built from, and does not use the cache if they are
+	// not known, as for a build of a working copy of the main module.
+	CacheVersion string
+}
+
+// Load loads the packages matching patterns and their dependencies with
+// go/packages, for analysis by analyzers: with the syntax and type
+// information of the packages, and of their dependencies too if an
+// analyzer uses facts. The Mode of cfg is set accordingly; cfg may be nil.
+//
+// Load reports an error if go/packages fails, or if the patterns match no
+// packages, but not the errors of the packages.
+func Load(cfg *packages.Config, analyzers []*analysis.Analyzer, patterns ...string) ([]*packages.Package, error) {
+	var conf packages.Config
+	if cfg != nil {
+		conf = *cfg
+	}
+	conf.Mode = packages.LoadSyntax
+	if needFacts(analyzers) {
+		conf.Mode = packages.LoadAllSyntax
+	}
+	pkgs, err := packages.Load(&conf, patterns...)
+	if err == nil && len(pkgs) == 0 {
+		err = fmt.Errorf("%s matched no packages", strings.Join(patterns, " "))
+	}
+	return pkgs, err
+}
+
+// Results are the results of Run.
+type Results struct {
+	// Roots are the actions of the analyzers on the packages passed to
+	// Run, for each analyzer in turn.
+	Roots []*Action
+}
+
+// A Diagnostic is a diagnostic reported by an analyzer on a package.
+type Diagnostic struct {
+	analysis.Diagnostic
+	Analyzer *analysis.Analyzer
+	Package  *packages.Package
+}
+
+// Diagnostics returns the diagnostics of the root actions, in order. Each
+// is returned once, although the files of a package foo also belong to
+// foo.test, which reports the same diagnostics.
+func (r *Results) Diagnostics() []Diagnostic {
+	type key struct {
+		pos, end token.Position
+		*analysis.Analyzer
+		message string
+	}
+	seen := make(map[key]bool)
+	var diags []Diagnostic
+	for _, act := range r.Roots {
+		for _, diag := range act.Diagnostics {
+			fset := act.Package.Fset
+			k := key{fset.Position(diag.Pos), fset.Position(diag.End), act.Analyzer, diag.Message}
+			if !seen[k] {
+				seen[k] = true
+				diags = append(diags, Diagnostic{diag, act.Analyzer, act.Package})
+			}
+		}
+	}
+	return diags
+}
+
+// ErrSkipped is the Err of an action of an analyzer that does not
+// RunDespiteErrors on a package with errors, and of the actions that
+// depend only on such actions among those that failed.
+var ErrSkipped = errors.New("analysis skipped due to errors in package")
+
+// Errors returns the errors of the actions that failed, including those
+// on dependencies, dependencies first.
+func (r *Results) Errors() []error {
+	var errs []error
+	seen := make(map[*Action]bool)
+	var visit func(actions []*Action)
+	visit = func(actions []*Action) {
+		for _, act := range actions {
+			if !seen[act] {
+				seen[act] = true
+				visit(act.Deps)
+				if act.Err != nil {
+					errs = append(errs, fmt.Errorf("%s: %v", act, act.Err))
+				}
+			}
+		}
+	}
+	visit(r.Roots)
+	return errs
+}
+
+// Facts returns the facts of the action about the objects of its package,
+// and its package facts, with a nil key.
+func (act *Action) Facts() map[types.Object][]analysis.Fact {
+	facts := make(map[types.Object][]analysis.Fact)
+	for key, fact := range act.objectFacts {
+		if key.obj.Pkg() == act.Package.Types {
+			facts[key.obj] = append(facts[key.obj], fact)
+		}
+	}
+	for key, fact := range act.packageFacts {
+		if key.pkg == act.Package.Types {
+			facts[nil] = append(facts[nil], fact)
+		}
+	}
+	return facts
+}
+
+// WriteFacts writes the facts of the actions and their dependencies about
+// their packages and the objects of their packages, in a form readable by
+// humans, to one JSON file per package in the directory dir, for
+// debugging. The -dumpfacts flag of the drivers writes the same files, so
+// that the facts of different drivers may be compared.
+func WriteFacts(dir string, roots []*Action) error {
+	dumps := make(map[*packages.Package]*facts.Dump)
+	var pkgs []*packages.Package
+	seen := make(map[*Action]bool)
+	var visit func(actions []*Action)
+	visit = func(actions []*Action) {
+		for _, act := range actions {
+			if seen[act] {
+				continue
+			}
+			seen[act] = true
+			visit(act.Deps)
+			if len(act.Analyzer.FactTypes) == 0 {
+				continue
+			}
+			dump, ok := dumps[act.Package]
+			if !ok {
+				dump = facts.NewDump(act.Package.ID, act.Package.Types)
+				dumps[act.Package] = dump
+				pkgs = append(pkgs, act.Package)
+			}
+			for obj, list := range act.Facts() {
+				for _, fact := range list {
+					dump.Add(act.Analyzer.Name, obj, fact)
+				}
+			}
+		}
+	}
+	visit(roots)
+	for _, pkg := range pkgs {
+		if err := dumps[pkg].Write(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run applies the analyzers to the packages, and to their dependencies
+// for the analyzers that use facts, and returns the results. Independent
+// actions are executed in parallel, by at most opts.Concurrency workers.
+// The packages must be loaded with their syntax and type information, and
+// those of their dependencies too if the analyzers use facts, as Load does.
+// The options may be nil.
+func Run(pkgs []*packages.Package, analyzers []*analysis.Analyzer, opts *Options) *Results {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	// Construct the action graph.
+	if opts.Verbose {
+		log.Printf("building graph of analysis passes")
+	}
+
+	// Each graph node (action) is one unit of analysis.
+	// Edges express package-to-package (vertical) dependencies,
+	// and analysis-to-analysis (horizontal) dependencies.
+	type key struct {
+		*analysis.Analyzer
+		*packages.Package
+	}
+	actions := make(map[key]*Action)
+
+	// All actions for the same package share a set of lazily built values.
+	sharedValues := make(map[*packages.Package]*analysisinternal.SharedValues)
+
+	var mkAction func(a *analysis.Analyzer, pkg *packages.Package) *Action
+	mkAction = func(a *analysis.Analyzer, pkg *packages.Package) *Action {
+		k := key{a, pkg}
+		act, ok := actions[k]
+		if !ok {
+			values, ok := sharedValues[pkg]
+			if !ok {
+				values = new(analysisinternal.SharedValues)
+				sharedValues[pkg] = values
+			}
+			act = &Action{Analyzer: a, Package: pkg, opts: opts, shared: values}
+
+			// Add a dependency on each required analyzers.
+			for _, req := range a.Requires {
+				act.Deps = append(act.Deps, mkAction(req, pkg))
+			}
+
+			// An analysis that consumes/produces facts
+			// must run on the package's dependencies too.
+			if len(a.FactTypes) > 0 {
+				paths := make([]string, 0, len(pkg.Imports))
+				for path := range pkg.Imports {
+					paths = append(paths, path)
+				}
+				sort.Strings(paths) // for determinism
+				for _, path := range paths {
+					dep := mkAction(a, pkg.Imports[path])
+					act.Deps = append(act.Deps, dep)
+				}
+			}
+
+			actions[k] = act
+		}
+		return act
+	}
+
+	// Build nodes for initial packages.
+	var roots []*Action
+	for _, a := range analyzers {
+		for _, pkg := range pkgs {
+			root := mkAction(a, pkg)
+			root.IsRoot = true
+			roots = append(roots, root)
+		}
+	}
+
+	// Read the results of the actions from the cache.
+	if opts.CacheDir != "" {
+		if c, err := openCache(opts); err != nil {
+			if opts.Verbose {
+				log.Printf("cannot open cache: %v", err)
+			}
+		} else {
+			c.plan(opts, roots)
+		}
+	}
+
+	// Execute the graph in parallel.
+	execAll(opts, roots)
+
+	return &Results{Roots: roots}
+}
+
+// needFacts reports whether any analysis required by the specified set
+// needs facts.  If so, we must load the entire program from source.
+func needFacts(analyzers []*analysis.Analyzer) bool {
+	seen := make(map[*analysis.Analyzer]bool)
+	var q []*analysis.Analyzer // for BFS
+	q = append(q, analyzers...)
+	for len(q) > 0 {
+		a := q[0]
+		q = q[1:]
+		if !seen[a] {
+			seen[a] = true
+			if len(a.FactTypes) > 0 {
+				return true
+			}
+			q = append(q, a.Requires...)
+		}
+	}
+	return false
+}
+
+// An Action represents one unit of analysis work: the application of
+// one analysis to one package. Actions form a DAG, both within a
+// package (as different analyzers are applied, either in sequence or
+// parallel), and across packages (as dependencies are analyzed).
+type Action struct {
+	Analyzer    *analysis.Analyzer
+	Package     *packages.Package
+	IsRoot      bool      // whether the action is for a package passed to Run
+	Deps        []*Action // the actions this one depends on
+	Pass        *analysis.Pass
+	Result      interface{} // the result of the analyzer, if it succeeded
+	Diagnostics []analysis.Diagnostic
+	Err         error
+	Duration    time.Duration // if Options.Timing or Options.Progress is set
+
+	opts         *Options
+	objectFacts  map[objectFactKey]analysis.Fact
+	packageFacts map[packageFactKey]analysis.Fact
+	inputs       map[*analysis.Analyzer]interface{}
+	shared       *analysisinternal.SharedValues
+
+	cache    *cache
+	cacheKey string         // key in the cache, or "" if the action cannot be cached
+	cached   *cachedResults // results read from the cache, if any
+}
+
+type objectFactKey struct {
+	obj types.Object
+	typ reflect.Type
+}
+
+type packageFactKey struct {
+	pkg *types.Package
+	typ reflect.Type
+}
+
+func (act *Action) String() string {
+	return fmt.Sprintf("%s@%s", act.Analyzer, act.Package)
+}
+
+// execAll executes the actions and their dependencies, each after its
+// dependencies, by a pool of at most opts.Concurrency workers.
+func execAll(opts *Options, actions []*Action) {
+	// Find the graph of actions, the number of unfinished dependencies of
+	// each, and the actions that depend on each. The actions are visited
+	// depth first, so that a single worker executes them in the order of
+	// the roots, dependencies first.
+	pending := make(map[*Action]int)
+	dependents := make(map[*Action][]*Action)
+	var ready []*Action
+	var visit func(act *Action)
+	visit = func(act *Action) {
+		if _, ok := pending[act]; ok {
+			return
+		}
+		deps := make(map[*Action]bool)
+		for _, dep := range act.Deps {
+			if !deps[dep] {
+				deps[dep] = true
+				visit(dep)
+				dependents[dep] = append(dependents[dep], act)
+			}
+		}
+		pending[act] = len(deps)
+		if len(deps) == 0 {
+			ready = append(ready, act)
+		}
+	}
+	for _, act := range actions {
+		visit(act)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+
+	// The queue of the actions whose dependencies are done is buffered
+	// so that it holds all of them, and workers never block sending.
+	queue := make(chan *Action, len(pending))
+	for _, act := range ready {
+		queue <- act
+	}
+	var mu sync.Mutex // guards pending, remaining, started and opts.Progress
+	remaining := len(pending)
+	started := 0
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for act := range queue {
+				if opts.Progress != nil {
+					mu.Lock()
+					started++
+					fmt.Fprintf(opts.Progress, "[%d/%d] start %s\n", started, len(pending), act)
+					mu.Unlock()
+				}
+
+				act.exec()
+
+				mu.Lock()
+				if opts.Progress != nil {
+					status := ""
+					if act.cached != nil {
+						status = " (cached)"
+					} else if act.Err != nil {
+						status = " (failed)"
+					}
+					fmt.Fprintf(opts.Progress, "[%d/%d] done  %s in %s%s\n",
+						len(pending)-remaining+1, len(pending), act, act.Duration, status)
+				}
+				for _, dependent := range dependents[act] {
+					pending[dependent]--
+					if pending[dependent] == 0 {
+						queue <- dependent
+					}
+				}
+				remaining--
+				if remaining == 0 {
+					close(queue)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// exec executes the action, once its dependencies are done.
+func (act *Action) exec() {
+	// TODO(adonovan): uncomment this during profiling.
+	// It won't build pre-go1.11 but conditional compilation
+	// using build tags isn't warranted.
+	//
+	// ctx, task := trace.NewTask(context.Background(), "exec")
+	// trace.Log(ctx, "pass", act.String())
+	// defer task.End()
+
+	// Record time spent in this node but not its dependencies.
+	// In parallel mode, due to GC/scheduler contention, the
+	// time is 5x higher than in sequential mode, so use
+	// Concurrency 1 for accurate times.
+	if act.opts.Timing || act.opts.Progress != nil {
+		t0 := time.Now()
+		defer func() { act.Duration = time.Since(t0) }()
+	}
+
+	// Report an error if any dependency failed,
+	// or skip the action if all of those were skipped.
+	var failed []string
+	skipped := true
+	for _, dep := range act.Deps {
+		if dep.Err != nil {
+			failed = append(failed, dep.String())
+			skipped = skipped && dep.Err == ErrSkipped
+		}
+	}
+	if failed != nil && skipped {
+		act.Err = ErrSkipped
+		return
+	}
+	if failed != nil {
+		sort.Strings(failed)
+		act.Err = fmt.Errorf("failed prerequisites: %s", strings.Join(failed, ", "))
+		return
+	}
+
+	// Plumb the output values of the dependencies
+	// into the inputs of this action.  Also facts.
+	inputs := make(map[*analysis.Analyzer]interface{})
+	act.objectFacts = make(map[objectFactKey]analysis.Fact)
+	act.packageFacts = make(map[packageFactKey]analysis.Fact)
+	for _, dep := range act.Deps {
+		if dep.Package == act.Package {
+			// Same package, different analysis (horizontal edge):
+			// in-memory outputs of prerequisite analyzers
+			// become inputs to this analysis pass.
+			inputs[dep.Analyzer] = dep.Result
+
+		} else if dep.Analyzer == act.Analyzer { // (always true)
+			// Same analysis, different package (vertical edge):
+			// serialized facts produced by prerequisite analysis
+			// become available to this analysis pass.
+			inheritFacts(act, dep)
+		}
+	}
+
+	// Use the results in the cache, if any.
+	if act.cached != nil {
+		act.Diagnostics = act.cached.diagnostics
+		for key, fact := range act.cached.objectFacts {
+			act.objectFacts[key] = fact
+		}
+		for key, fact := range act.cached.packageFacts {
+			act.packageFacts[key] = fact
+		}
+		return
+	}
+
+	// Run the analysis.
+	pass := &analysis.Pass{
+		Analyzer:          act.Analyzer,
+		Fset:              act.Package.Fset,
+		Files:             act.Package.Syntax,
+		OtherFiles:        act.Package.OtherFiles,
+		Pkg:               act.Package.Types,
+		TypesInfo:         act.Package.TypesInfo,
+		TypesSizes:        act.Package.TypesSizes,
+		ResultOf:          inputs,
+		Shared:            act.shared.Get,
+		Report:            func(d analysis.Diagnostic) { act.Diagnostics = append(act.Diagnostics, d) },
+		ImportObjectFact:  act.importObjectFact,
+		ExportObjectFact:  act.exportObjectFact,
+		ImportPackageFact: act.importPackageFact,
+		ExportPackageFact: act.exportPackageFact,
+		AllObjectFacts:    act.allObjectFacts,
+		AllPackageFacts:   act.allPackageFacts,
+	}
+	act.Pass = pass
+
+	var err error
+	if act.Package.IllTyped && !pass.Analyzer.RunDespiteErrors {
+		err = ErrSkipped
+	} else {
+		act.Result, err = pass.Analyzer.Run(pass)
+		if err == nil {
+			if got, want := reflect.TypeOf(act.Result), pass.Analyzer.ResultType; got != want {
+				err = fmt.Errorf(
+					"internal error: on package %s, analyzer %s returned a result of type %v, but declared ResultType %v",
+					pass.Pkg.Path(), pass.Analyzer, got, want)
+			}
+		}
+	}
+	act.Err = err
+
+	// disallow calls after Run
+	pass.ExportObjectFact = nil
+	pass.ExportPackageFact = nil
+
+	if err == nil && act.cacheKey != "" {
+		act.cache.put(act)
+	}
+}
+
+// inheritFacts populates act.facts with
+// those it obtains from its dependency, dep.
+func inheritFacts(act, dep *Action) {
+	serialize := act.opts.SanityCheck
+
+	for key, fact := range dep.objectFacts {
+		// Filter out facts related to objects
+		// that are irrelevant downstream
+		// (equivalently: not in the compiler export data).
+		if !exportedFrom(key.obj, dep.Package.Types) {
+			if false {
+				log.Printf("%v: discarding %T fact from %s for %s: %s", act, fact, dep, key.obj, fact)
+			}
+			continue
+		}
+
+		// Optionally serialize/deserialize fact
+		// to verify that it works across address spaces.
+		if serialize {
+			encodedFact, err := codeFact(fact)
+			if err != nil {
+				log.Panicf("internal error: encoding of %T fact failed in %v", fact, act)
+			}
+			fact = encodedFact
+		}
+
+		if false {
+			log.Printf("%v: inherited %T fact for %s: %s", act, fact, key.obj, fact)
+		}
+		act.objectFacts[key] = fact
+	}
+
+	for key, fact := range dep.packageFacts {
+		// TODO: filter out facts that belong to
+		// packages not mentioned in the export data
+		// to prevent side channels.
+
+		// Optionally serialize/deserialize fact
+		// to verify that it works across address spaces
+		// and is deterministic.
+		if serialize {
+			encodedFact, err := codeFact(fact)
+			if err != nil {
+				log.Panicf("internal error: encoding of %T fact failed in %v", fact, act)
+			}
+			fact = encodedFact
+		}
+
+		if false {
+			log.Printf("%v: inherited %T fact for %s: %s", act, fact, key.pkg.Path(), fact)
+		}
+		act.packageFacts[key] = fact
+	}
+}
+
+// codeFact encodes then decodes a fact,
+// just to exercise that logic.
+func codeFact(fact analysis.Fact) (analysis.Fact, error) {
+	// We encode facts one at a time.
+	// A real modular driver would emit all facts
+	// into one encoder to improve gob efficiency.
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(fact); err != nil {
+		return nil, err
+	}
+
+	// Encode it twice and assert that we get the same bits.
+	// This helps detect nondeterministic Gob encoding (e.g. of maps).
+	var buf2 bytes.Buffer
+	if err := gob.NewEncoder(&buf2).Encode(fact); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		return nil, fmt.Errorf("encoding of %T fact is nondeterministic", fact)
+	}
+
+	new := reflect.New(reflect.TypeOf(fact).Elem()).Interface().(analysis.Fact)
+	if err := gob.NewDecoder(&buf).Decode(new); err != nil {
+		return nil, err
+	}
+	return new, nil
+}
+
+// exportedFrom reports whether obj may be visible to a package that imports pkg.
+// This includes not just the exported members of pkg, but also unexported
+// constants, types, fields, and methods, perhaps belonging to oether packages,
+// that find there way into the API.
+// This is an overapproximation of the more accurate approach used by
+// gc export data, which walks the type graph, but it's much simpler.
+//
+// TODO(adonovan): do more accurate filtering by walking the type graph.
+func exportedFrom(obj types.Object, pkg *types.Package) bool {
+	switch obj := obj.(type) {
+	case *types.Func:
+		return obj.Exported() && obj.Pkg() == pkg ||
+			obj.Type().(*types.Signature).Recv() != nil
+	case *types.Var:
+		return obj.Exported() && obj.Pkg() == pkg ||
+			obj.IsField()
+	case *types.TypeName, *types.Const:
+		return true
+	}
+	return false // Nil, Builtin, Label, or PkgName
+}
+
+// importObjectFact implements Pass.ImportObjectFact.
+// Given a non-nil pointer ptr of type *T, where *T satisfies Fact,
+// importObjectFact copies the fact value to *ptr.
+func (act *Action) importObjectFact(obj types.Object, ptr analysis.Fact) bool {
+	if obj == nil {
+		panic("nil object")
+	}
+	key := objectFactKey{obj, factType(ptr)}
+	if v, ok := act.objectFacts[key]; ok {
+		reflect.ValueOf(ptr).Elem().Set(reflect.ValueOf(v).Elem())
+		return true
+	}
+	return false
+}
+
+// exportObjectFact implements Pass.ExportObjectFact.
+func (act *Action) exportObjectFact(obj types.Object, fact analysis.Fact) {
+	if act.Pass.ExportObjectFact == nil {
+		log.Panicf("%s: Pass.ExportObjectFact(%s, %T) called after Run", act, obj, fact)
+	}
+
+	if obj.Pkg() != act.Package.Types {
+		log.Panicf("internal error: in analysis %s of package %s: Fact.Set(%s, %T): can't set facts on objects belonging another package",
+			act.Analyzer, act.Package, obj, fact)
+	}
+
+	key := objectFactKey{obj, factType(fact)}
+	act.objectFacts[key] = fact // clobber any existing entry
+	if act.opts.LogFacts {
+		objstr := types.ObjectString(obj, (*types.Package).Name)
+		fmt.Fprintf(os.Stderr, "%s: object %s has fact %s\n",
+			act.Package.Fset.Position(obj.Pos()), objstr, fact)
+	}
+}
+
+// allObjectFacts implements Pass.AllObjectFacts.
+func (act *Action) allObjectFacts() []analysis.ObjectFact {
+	facts := make([]analysis.ObjectFact, 0, len(act.objectFacts))
+	for k := range act.objectFacts {
+		facts = append(facts, analysis.ObjectFact{Object: k.obj, Fact: act.objectFacts[k]})
+	}
+	return facts
+}
+
+// importPackageFact implements Pass.ImportPackageFact.
+// Given a non-nil pointer ptr of type *T, where *T satisfies Fact,
+// fact copies the fact value to *ptr.
+func (act *Action) importPackageFact(pkg *types.Package, ptr analysis.Fact) bool {
+	if pkg == nil {
+		panic("nil package")
+	}
+	key := packageFactKey{pkg, factType(ptr)}
+	if v, ok := act.packageFacts[key]; ok {
+		reflect.ValueOf(ptr).Elem().Set(reflect.ValueOf(v).Elem())
+		return true
+	}
+	return false
+}
+
+// exportPackageFact implements Pass.ExportPackageFact.
+func (act *Action) exportPackageFact(fact analysis.Fact) {
+	if act.Pass.ExportPackageFact == nil {
+		log.Panicf("%s: Pass.ExportPackageFact(%T) called after Run", act, fact)
+	}
+
+	key := packageFactKey{act.Pass.Pkg, factType(fact)}
+	act.packageFacts[key] = fact // clobber any existing entry
+	if act.opts.LogFacts {
+		fmt.Fprintf(os.Stderr, "%s: package %s has fact %s\n",
+			act.Package.Fset.Position(act.Pass.Files[0].Pos()), act.Pass.Pkg.Path(), fact)
+	}
+}
+
+func factType(fact analysis.Fact) reflect.Type {
+	t := reflect.TypeOf(fact)
+	if t.Kind() != reflect.Ptr {
+		log.Fatalf("invalid Fact type: got %T, want pointer", t)
+	}
+	return t
+}
+
+// allObjectFacts implements Pass.AllObjectFacts.
+func (act *Action) allPackageFacts() []analysis.PackageFact {
+	facts := make([]analysis.PackageFact, 0, len(act.packageFacts))
+	for k := range act.packageFacts {
+		facts = append(facts, analysis.PackageFact{Package: k.pkg, Fact: act.packageFacts[k]})
+	}
+	return facts
+}
@@ -0,0 +1,379 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checker_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/checker"
+	"github.com/jackie-feng/tools/go/packages"
+)
+
+// A deprecatedFact marks a function whose doc comment says it is deprecated.
+type deprecatedFact struct{}
+
+func (*deprecatedFact) AFact()         {}
+func (*deprecatedFact) String() string { return "deprecated" }
+
+// deprecated reports the calls to deprecated functions, of their package
+// or of the packages it imports.
+var deprecated = &analysis.Analyzer{
+	Name:      "deprecated",
+	Doc:       "report calls to deprecated functions",
+	FactTypes: []analysis.Fact{new(deprecatedFact)},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, decl := range f.Decls {
+				if decl, ok := decl.(*ast.FuncDecl); ok && strings.Contains(decl.Doc.Text(), "Deprecated") {
+					pass.ExportObjectFact(pass.TypesInfo.Defs[decl.Name], new(deprecatedFact))
+				}
+			}
+		}
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					if fn, ok := pass.TypesInfo.Uses[id].(*types.Func); ok && pass.ImportObjectFact(fn, new(deprecatedFact)) {
+						pass.Reportf(id.Pos(), "call of deprecated %s", fn.Name())
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+// loader returns a function that loads a package from source, with the
+// packages that it loaded before as its possible imports. If dir is not
+// empty, the source is written to a file in dir.
+func loader(t *testing.T, dir string) func(path, src string) *packages.Package {
+	fset := token.NewFileSet()
+	pkgs := make(map[string]*packages.Package)
+	return func(path, src string) *packages.Package {
+		filename := path + ".go"
+		if dir != "" {
+			filename = filepath.Join(dir, filename)
+			if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg := &packages.Package{
+			ID:         path,
+			PkgPath:    path,
+			Fset:       fset,
+			Syntax:     []*ast.File{f},
+			Imports:    make(map[string]*packages.Package),
+			TypesSizes: types.SizesFor("gc", "amd64"),
+			TypesInfo: &types.Info{
+				Defs: make(map[*ast.Ident]types.Object),
+				Uses: make(map[*ast.Ident]types.Object),
+			},
+		}
+		conf := types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+			if dep, ok := pkgs[path]; ok {
+				pkg.Imports[path] = dep
+				return dep.Types, nil
+			}
+			return importer.Default().Import(path)
+		})}
+		pkg.Types, err = conf.Check(path, fset, []*ast.File{f}, pkg.TypesInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkgs[path] = pkg
+		return pkg
+	}
+}
+
+func TestRun(t *testing.T) {
+	load := loader(t, "")
+	a := load("a", `package a
+
+// Deprecated: use New.
+func Old() {}
+
+func New() { Old() }
+`)
+	b := load("b", `package b
+
+import "a"
+
+func f() {
+	a.Old()
+	a.New()
+}
+`)
+
+	results := checker.Run([]*packages.Package{b}, []*analysis.Analyzer{deprecated}, nil)
+	if errs := results.Errors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var got []string
+	for _, diag := range results.Diagnostics() {
+		got = append(got, fmt.Sprintf("%s: %s: %s", diag.Package.Fset.Position(diag.Pos), diag.Analyzer.Name, diag.Message))
+	}
+	// The diagnostic of package a is not reported, as it is a dependency.
+	if want := []string{"b.go:6:4: deprecated: call of deprecated Old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagnostics %q, want %q", got, want)
+	}
+
+	root := results.Roots[0]
+	if len(root.Deps) != 1 || root.Deps[0].Package.PkgPath != "a" {
+		t.Fatalf("got dependencies %v, want the action on package a", root.Deps)
+	}
+	facts := root.Deps[0].Facts()
+	old := a.Types.Scope().Lookup("Old")
+	if len(facts) != 1 || len(facts[old]) != 1 {
+		t.Errorf("got facts %v of package a, want the one of Old", facts)
+	}
+}
+
+func TestWriteFacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "facts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	load := loader(t, "")
+	load("a", `package a
+
+// Deprecated: use New.
+func Old() {}
+
+func New() {}
+`)
+	b := load("b", `package b
+
+import "a"
+
+var _ = a.New
+`)
+	results := checker.Run([]*packages.Package{b}, []*analysis.Analyzer{deprecated}, nil)
+	if err := checker.WriteFacts(dir, results.Roots); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		file, want string
+	}{
+		{"a.json", `{
+	"package": "a",
+	"facts": [
+		{
+			"analyzer": "deprecated",
+			"object": "func Old()",
+			"type": "*checker_test.deprecatedFact",
+			"fact": "deprecated"
+		}
+	]
+}
+`},
+		{"b.json", `{
+	"package": "b",
+	"facts": []
+}
+`},
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("got %s:\n%s\nwant:\n%s", test.file, got, test.want)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	load := loader(t, "")
+	var pkgs []*packages.Package
+	for i := 0; i < 20; i++ {
+		pkgs = append(pkgs, load(fmt.Sprintf("p%d", i), "package p"))
+	}
+
+	for _, concurrency := range []int{1, 3} {
+		var mu sync.Mutex
+		running, max := 0, 0
+		a := &analysis.Analyzer{
+			Name: "a",
+			Doc:  "wait a little",
+			Run: func(pass *analysis.Pass) (interface{}, error) {
+				mu.Lock()
+				running++
+				if running > max {
+					max = running
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil, nil
+			},
+		}
+		results := checker.Run(pkgs, []*analysis.Analyzer{a}, &checker.Options{Concurrency: concurrency})
+		if errs := results.Errors(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if max > concurrency {
+			t.Errorf("with concurrency %d, got %d actions running at once", concurrency, max)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	load := loader(t, "")
+	pkgs := []*packages.Package{load("p", "package p"), load("q", "package q")}
+
+	a := &analysis.Analyzer{
+		Name: "a",
+		Doc:  "do nothing",
+		Run:  func(pass *analysis.Pass) (interface{}, error) { return nil, nil },
+	}
+	var buf bytes.Buffer
+	results := checker.Run(pkgs, []*analysis.Analyzer{a}, &checker.Options{Concurrency: 1, Progress: &buf})
+	if errs := results.Errors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	got := regexp.MustCompile(` in \S+\n`).ReplaceAllString(buf.String(), " in D\n")
+	want := `[1/2] start a@p
+[1/2] done  a@p in D
+[2/2] start a@q
+[2/2] done  a@q in D
+`
+	if got != want {
+		t.Errorf("got progress:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	load := loader(t, "")
+	pkg := load("p", "package p")
+	pkg.IllTyped = true
+
+	run := func(pass *analysis.Pass) (interface{}, error) { return nil, nil }
+	despite := &analysis.Analyzer{Name: "despite", Doc: "run despite errors", Run: run, RunDespiteErrors: true}
+	typed := &analysis.Analyzer{Name: "typed", Doc: "need types", Run: run}
+	dependent := &analysis.Analyzer{Name: "dependent", Doc: "need typed", Run: run, Requires: []*analysis.Analyzer{typed}}
+
+	results := checker.Run([]*packages.Package{pkg}, []*analysis.Analyzer{despite, typed, dependent}, nil)
+	for _, act := range results.Roots {
+		want := checker.ErrSkipped
+		if act.Analyzer == despite {
+			want = nil
+		}
+		if act.Err != want {
+			t.Errorf("%s: got error %v, want %v", act, act.Err, want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srcdir, cachedir := filepath.Join(dir, "src"), filepath.Join(dir, "cache")
+	if err := os.Mkdir(srcdir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := 0
+	a := *deprecated
+	a.Run = func(pass *analysis.Pass) (interface{}, error) {
+		runs++
+		return deprecated.Run(pass)
+	}
+	const srcA = `package a
+
+// Deprecated: use New.
+func Old() {}
+
+func New() {}
+`
+	opts := &checker.Options{Concurrency: 1, CacheDir: cachedir, CacheVersion: "test"}
+	for _, test := range []struct {
+		srcB string
+		runs int    // of the analyzer
+		posn string // of the diagnostic
+	}{
+		{"package b\n\nimport \"a\"\n\nvar _ = a.Old\n", 2, "b.go:5:11"},
+		{"package b\n\nimport \"a\"\n\nvar _ = a.Old\n", 0, "b.go:5:11"},
+		{"package b\n\nimport \"a\"\n\nvar (\n\t_ = a.New\n\t_ = a.Old\n)\n", 1, "b.go:7:8"},
+	} {
+		load := loader(t, srcdir)
+		pkgA := load("a", srcA)
+		pkgB := load("b", test.srcB)
+
+		runs = 0
+		results := checker.Run([]*packages.Package{pkgB}, []*analysis.Analyzer{&a}, opts)
+		if errs := results.Errors(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if runs != test.runs {
+			t.Errorf("got %d runs, want %d", runs, test.runs)
+		}
+		var got []string
+		for _, diag := range results.Diagnostics() {
+			posn := pkgB.Fset.Position(diag.Pos)
+			got = append(got, fmt.Sprintf("%s:%d:%d: %s", filepath.Base(posn.Filename), posn.Line, posn.Column, diag.Message))
+		}
+		if want := []string{test.posn + ": call of deprecated Old"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got diagnostics %q, want %q", got, want)
+		}
+		facts := results.Roots[0].Deps[0].Facts()
+		if old := pkgA.Types.Scope().Lookup("Old"); len(facts) != 1 || len(facts[old]) != 1 {
+			t.Errorf("got facts %v of package a, want the one of Old", facts)
+		}
+	}
+}
+
+func TestCacheNoVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srcdir, cachedir := filepath.Join(dir, "src"), filepath.Join(dir, "cache")
+	if err := os.Mkdir(srcdir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	pkg := loader(t, srcdir)("a", "package a\n")
+
+	// A test binary is built from a working copy of its module, which
+	// has no version, so its results must not be cached.
+	opts := &checker.Options{Concurrency: 1, CacheDir: cachedir}
+	if errs := checker.Run([]*packages.Package{pkg}, []*analysis.Analyzer{deprecated}, opts).Errors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if _, err := os.Stat(cachedir); !os.IsNotExist(err) {
+		t.Errorf("got cache directory %s (%v), want none without a CacheVersion", cachedir, err)
+	}
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
@@ -1,6 +1,9 @@
 package analysis
 
-import "go/token"
+import (
+	"fmt"
+	"go/token"
+)
 
 // A Diagnostic is a message associated with a source location or range.
 //
@@ -10,11 +13,16 @@ import "go/token"
 //
 // If End is provided, the diagnostic is specified to apply to the range between
 // Pos and End.
+//
+// The optional Severity tells drivers how to present the diagnostic, and the
+// optional URL is the location of the documentation of its Category.
 type Diagnostic struct {
 	Pos      token.Pos
 	End      token.Pos // optional
 	Category string    // optional
 	Message  string
+	Severity Severity // optional
+	URL      string   // optional
 
 	// SuggestedFixes contains suggested fixes for a diagnostic which can be used to perform
 	// edits to a file that address the diagnostic.
@@ -27,6 +35,32 @@ type Diagnostic struct {
 	Related []RelatedInformation // optional
 }
 
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityDefault is the severity of diagnostics that do not specify
+	// one. Drivers usually present them as warnings.
+	SeverityDefault Severity = iota
+	SeverityError
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityDefault:
+		return "default"
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
 // RelatedInformation contains information related to a diagnostic.
 // For example, a diagnostic that flags duplicated declarations of a
 // variable may include one RelatedInformation per existing
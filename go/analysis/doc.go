@@ -187,6 +187,18 @@ Each of these Analyzers extends the capabilities of later Analyzers
 without adding a dependency to the core API, so an analysis tool pays
 only for the extensions it needs.
 
+The Shared function provides values that are expensive to compute and
+needed by several analyzers, but are not naturally the result of any
+one of them, such as a call graph. The first analyzer to request a
+given key computes the value; the driver then makes the same value
+available to every other analyzer applied to the same package:
+
+	type callGraphKey struct{}
+
+	v, err := pass.Shared(callGraphKey{}, func() (interface{}, error) {
+		return buildCallGraph(pass)
+	})
+
 The Report function emits a diagnostic, a message associated with a
 source position. For most analyses, diagnostics are their primary
 result.
@@ -198,10 +210,15 @@ Diagnostic is defined as:
 		Pos      token.Pos
 		Category string // optional
 		Message  string
+		Severity Severity // optional
+		URL      string   // optional
 	}
 
 The optional Category field is a short identifier that classifies the
 kind of message when an analysis produces several kinds of diagnostic.
+The optional Severity field is SeverityError, SeverityWarning or
+SeverityInfo, and the optional URL field is the location of the
+documentation of the Category. Drivers include both in their output.
 
 Most Analyzers inspect typed Go syntax trees, but a few, such as asmdecl
 and buildtag, inspect the raw text of Go source files or even non-Go
@@ -330,5 +347,9 @@ entirety as:
 A tool that provides multiple analyzers can use multichecker in a
 similar way, giving it the list of Analyzers.
 
+Programs that analyze code without running such a command, such as
+continuous integration systems, can use the checker package, which
+loads packages and runs analyzers on them, and returns their results.
+
 */
 package analysis
@@ -0,0 +1,145 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ConfigFile is the name of the configuration file of the driver, if it has
+// one. Parse looks for it in the current directory and its parents.
+//
+// The configuration file is a JSON object such as:
+//
+//	{
+//		"enable": ["printf", "shadow"],
+//		"disable": ["unusedresult"],
+//		"flags": {"printf.funcs": "Logf,Errf", "c": "1"},
+//		"exclude": ["testdata/**", "/internal/gen/*.go"]
+//	}
+//
+// Enable and Disable list analyzers to enable and disable, as the -NAME
+// flags do, and Flags sets other flags. The command line takes precedence
+// over the configuration file. The diagnostics of the files that match a
+// pattern of the exclude list are not reported; the patterns are those of
+// the -exclude flag, described at Exclude.
+//
+// The configuration file is JSON only. There is no YAML form, such as a
+// .vet.yaml file, as this module does not depend on a YAML parser.
+var ConfigFile string
+
+// A config is the contents of a ConfigFile.
+type config struct {
+	Enable  []string          `json:"enable"`
+	Disable []string          `json:"disable"`
+	Flags   map[string]string `json:"flags"`
+	Exclude []string          `json:"exclude"`
+
+	dir     string      // directory of the configuration file
+	exclude patternList // parsed Exclude
+}
+
+// The configuration used by the driver, if any.
+var loadedConfig *config
+
+// findConfig returns the name of the nearest file named name in the current
+// directory and its parents, or "" if there is none.
+func findConfig(name string) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		filename := filepath.Join(dir, name)
+		if _, err := os.Stat(filename); err == nil {
+			return filename, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// loadConfig loads the nearest ConfigFile, if any, and sets the flags that
+// it sets. Analyzers are the names of the analyzers of the -NAME flags.
+func loadConfig(analyzers map[string]bool) error {
+	filename, err := findConfig(ConfigFile)
+	if err != nil || filename == "" {
+		return err
+	}
+	cfg, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+	if err := cfg.apply(analyzers); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	loadedConfig = cfg
+	return nil
+}
+
+// readConfig reads the configuration file filename.
+func readConfig(filename string) (*config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(config)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("cannot decode configuration file %s: %v", filename, err)
+	}
+	cfg.dir = filepath.Dir(filename)
+	for _, text := range cfg.Exclude {
+		if err := cfg.exclude.Set(text); err != nil {
+			return nil, fmt.Errorf("%s: exclude: %v", filename, err)
+		}
+	}
+	return cfg, nil
+}
+
+// apply sets the flags that cfg sets but that are not set on the command
+// line. The analyzer flags are those of the -NAME flags.
+func (cfg *config) apply(analyzers map[string]bool) error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	setFlag := func(name, value string) error {
+		if set[name] {
+			return nil
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("no flag -%s", name)
+		}
+		return flag.Set(name, value)
+	}
+	for _, list := range []struct {
+		names []string
+		value string
+	}{{cfg.Enable, "true"}, {cfg.Disable, "false"}} {
+		for _, name := range list.names {
+			if !analyzers[name] {
+				return fmt.Errorf("no analyzer %s", name)
+			}
+			if err := setFlag(name, list.value); err != nil {
+				return err
+			}
+		}
+	}
+	for name, value := range cfg.Flags {
+		if analyzers[name] {
+			return fmt.Errorf("analyzer %s must be enabled or disabled with enable or disable", name)
+		}
+		if err := setFlag(name, value); err != nil {
+			return fmt.Errorf("setting -%s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const content = `{
+	"enable": ["a"],
+	"flags": {"a.x": "config", "a.y": "config"},
+	"exclude": ["testdata/**", "/gen/*.go"]
+}`
+	filename := filepath.Join(dir, ".vet.json")
+	if err := ioutil.WriteFile(filename, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := readConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := new(triState)
+	flag.Var(a, "a", "")
+	x := flag.String("a.x", "default", "")
+	y := flag.String("a.y", "default", "")
+	flag.Set("a.y", "command line")
+	if err := cfg.apply(map[string]bool{"a": true}); err != nil {
+		t.Fatal(err)
+	}
+	if *a != setTrue || *x != "config" || *y != "command line" {
+		t.Errorf("got -a=%v -a.x=%s -a.y=%s, want -a=true -a.x=config -a.y=command line", a, *x, *y)
+	}
+
+	defer func() { loadedConfig = nil }()
+	loadedConfig = cfg
+	for _, test := range []struct {
+		file string
+		want bool
+	}{
+		{"a.go", false},
+		{"testdata/a.go", true},
+		{"p/testdata/a.go", true},
+		{"testdata/p/a.go", true},
+		{"gen/a.go", true},
+		{"gen/p/a.go", false},
+		{"p/gen/a.go", false},
+		{"../gen/a.go", false},
+	} {
+		if got := Excluded(filepath.Join(dir, filepath.FromSlash(test.file))); got != test.want {
+			t.Errorf("Excluded(%s) = %t, want %t", test.file, got, test.want)
+		}
+	}
+}
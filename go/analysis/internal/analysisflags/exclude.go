@@ -0,0 +1,153 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Exclude holds the patterns of the -exclude flag, which may be repeated.
+// The diagnostics of the files that match one of the patterns, or one of
+// the exclude patterns of the configuration file, are not reported,
+// whichever packages are analyzed.
+//
+// A pattern is a slash-separated list of elements, each of which is a
+// pattern of path.Match that matches one element of a file name, except
+// for "**", which matches any number of elements. A pattern that does not
+// begin with a slash matches the trailing elements of a file name, so that
+// "third_party/**" matches the files below any directory named
+// third_party, and "*.pb.go" matches the files of that name in any
+// directory. A pattern that begins with a slash matches the whole file
+// name below its base directory: the root for the -exclude flag, and the
+// directory of the configuration file for the patterns of that file, so
+// that "/gen/*.go" matches the files of the gen directory next to it. File
+// names are absolute, so patterns need not depend on the current
+// directory, which "go vet" sets to the directory of each package.
+var Exclude patternList
+
+// A pattern is a parsed pattern of file names, in the syntax documented
+// at Exclude.
+type pattern struct {
+	text     string
+	elems    []string
+	anchored bool // the pattern begins with a slash
+}
+
+// parsePattern parses the pattern text.
+func parsePattern(text string) (pattern, error) {
+	p := pattern{text: text}
+	rest := strings.TrimPrefix(text, "/")
+	p.anchored = rest != text
+	if rest == "" {
+		return p, fmt.Errorf("empty pattern %q", text)
+	}
+	p.elems = strings.Split(rest, "/")
+	for _, elem := range p.elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return p, fmt.Errorf("invalid pattern %q", text)
+		}
+	}
+	return p, nil
+}
+
+// match reports whether the file whose name below the base directory of
+// p has the elements elems matches p.
+func (p pattern) match(elems []string) bool {
+	if p.anchored {
+		return matchElems(p.elems, elems)
+	}
+	for i := range elems {
+		if matchElems(p.elems, elems[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchElems reports whether the elements of a path match those of a
+// pattern, in which "**" matches any number of elements.
+func matchElems(pattern, elems []string) bool {
+	if len(pattern) == 0 {
+		return len(elems) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchElems(pattern[1:], elems[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elems) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+		return false
+	}
+	return matchElems(pattern[1:], elems[1:])
+}
+
+// A patternList is a flag.Value that accumulates the patterns of a
+// repeated flag.
+type patternList []pattern
+
+func (l *patternList) String() string {
+	var texts []string
+	for _, p := range *l {
+		texts = append(texts, p.text)
+	}
+	return strings.Join(texts, ",")
+}
+
+func (l *patternList) Set(text string) error {
+	p, err := parsePattern(text)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, p)
+	return nil
+}
+
+// matchAny reports whether the file whose name below the base directory
+// of the patterns has the elements elems matches one of l.
+func (l patternList) matchAny(elems []string) bool {
+	for _, p := range l {
+		if p.match(elems) {
+			return true
+		}
+	}
+	return false
+}
+
+// Excluded reports whether the diagnostics of the file filename are
+// excluded by the -exclude flag or by the configuration file.
+func Excluded(filename string) bool {
+	if len(Exclude) == 0 && (loadedConfig == nil || len(loadedConfig.exclude) == 0) {
+		return false
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	if Exclude.matchAny(splitPath(abs)) {
+		return true
+	}
+	if loadedConfig == nil {
+		return false
+	}
+	rel, err := filepath.Rel(loadedConfig.dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return loadedConfig.exclude.matchAny(splitPath(rel))
+}
+
+// splitPath returns the elements of the file name filename.
+func splitPath(filename string) []string {
+	return strings.Split(strings.TrimPrefix(filepath.ToSlash(filename), "/"), "/")
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExclude(t *testing.T) {
+	defer func() { Exclude = nil }()
+	for _, pattern := range []string{"third_party/**", "*.pb.go", "/root/gen/*.go"} {
+		if err := Exclude.Set(pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		file string
+		want bool
+	}{
+		{"/src/p/a.go", false},
+		{"/src/third_party/a.go", true},
+		{"/src/p/third_party/q/r/a.go", true},
+		{"/src/third_party.go", false},
+		{"/src/p/a.pb.go", true},
+		{"/a.pb.go", true},
+		{"/root/gen/a.go", true},
+		{"/src/root/gen/a.go", false},
+		{"/root/gen/p/a.go", false},
+	} {
+		if got := Excluded(filepath.FromSlash(test.file)); got != test.want {
+			t.Errorf("Excluded(%s) = %t, want %t", test.file, got, test.want)
+		}
+	}
+
+	if err := Exclude.Set("a/[b"); err == nil {
+		t.Errorf("Set(%q) succeeded, want error", "a/[b")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -25,8 +26,12 @@ import (
 
 // flags common to all {single,multi,unit}checkers.
 var (
-	JSON    = false // -json
-	Context = -1    // -c=N: if N>0, display offending line plus N lines of context
+	JSON        = false // -json
+	JSONVersion = 1     // -json.version
+	SARIF       = false // -sarif
+	Context     = -1    // -c=N: if N>0, display offending line plus N lines of context
+	Unsorted    = false // -unsorted: print diagnostics in the order they were reported
+	Generated   = false // -generated: report diagnostics in generated files
 )
 
 // Parse creates a flag for each of the analyzer's flags,
@@ -43,6 +48,7 @@ var (
 // This is not a particularly elegant API, but this is an internal package.
 func Parse(analyzers []*analysis.Analyzer, multi bool) []*analysis.Analyzer {
 	// Connect each analysis flag to the command line as -analysis.flag.
+	registered := analyzers
 	enabled := make(map[*analysis.Analyzer]*triState)
 	for _, a := range analyzers {
 		var prefix string
@@ -70,11 +76,17 @@ func Parse(analyzers []*analysis.Analyzer, multi bool) []*analysis.Analyzer {
 
 	// standard flags: -flags, -V.
 	printflags := flag.Bool("flags", false, "print analyzer flags in JSON")
+	listflag := flag.Bool("list", false, "print the registered analyzers and exit; with -json, print their documentation, flags, fact types and dependencies in JSON")
 	addVersionFlag()
 
 	// flags common to all checkers
 	flag.BoolVar(&JSON, "json", JSON, "emit JSON output")
+	flag.IntVar(&JSONVersion, "json.version", JSONVersion, "version of the -json output: 1, or 2 to include the end positions, related information and suggested fixes of diagnostics")
+	flag.BoolVar(&SARIF, "sarif", SARIF, "emit SARIF 2.1.0 output, for code scanning services")
 	flag.IntVar(&Context, "c", Context, `display offending line with this many lines of context`)
+	flag.BoolVar(&Unsorted, "unsorted", Unsorted, "print diagnostics in the order they were reported, instead of sorted by position and analyzer")
+	flag.BoolVar(&Generated, "generated", Generated, `report diagnostics in generated files, marked by a "// Code generated ... DO NOT EDIT." comment`)
+	flag.Var(&Exclude, "exclude", "do not report diagnostics in files matching this pattern, such as third_party/** or *.pb.go (may be repeated)")
 
 	// Add shims for legacy vet flags to enable existing
 	// scripts that run vet to continue to work.
@@ -91,6 +103,25 @@ func Parse(analyzers []*analysis.Analyzer, multi bool) []*analysis.Analyzer {
 
 	flag.Parse() // (ExitOnError)
 
+	if ConfigFile != "" {
+		names := make(map[string]bool)
+		for a := range enabled {
+			names[a.Name] = true
+		}
+		if err := loadConfig(names); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if JSONVersion != 1 && JSONVersion != 2 {
+		log.Fatalf("unsupported -json.version %d", JSONVersion)
+	}
+
+	// -sarif takes precedence over -json.
+	if SARIF {
+		JSON = false
+	}
+
 	// -flags: print flags so that go vet knows which ones are legitimate.
 	if *printflags {
 		printFlags()
@@ -130,6 +161,14 @@ func Parse(analyzers []*analysis.Analyzer, multi bool) []*analysis.Analyzer {
 		}
 	}
 
+	// -list: describe the analyzers, for editors and configuration tools.
+	if *listflag {
+		if err := list(os.Stdout, registered, analyzers, multi); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	// Register fact types of skipped analyzers
 	// in case we encounter them in imported files.
 	kept := expand(analyzers)
@@ -168,10 +207,10 @@ func printFlags() {
 	var flags []jsonFlag = nil
 	flag.VisitAll(func(f *flag.Flag) {
 		// Don't report {single,multi}checker debugging
-		// flags or fix as these have no effect on unitchecker
+		// flags, diff, suppression or baseline as these have no effect on unitchecker
 		// (as invoked by 'go vet').
 		switch f.Name {
-		case "debug", "cpuprofile", "memprofile", "trace", "fix":
+		case "debug", "concurrency", "cpuprofile", "memprofile", "trace", "diff", "suppress.unused", "baseline", "baseline.write", "cache", "list", "progress":
 			return
 		}
 
@@ -319,7 +358,14 @@ var vetLegacyFlags = map[string]string{
 // with context specified by the -c flag.
 func PrintPlain(fset *token.FileSet, diag analysis.Diagnostic) {
 	posn := fset.Position(diag.Pos)
-	fmt.Fprintf(os.Stderr, "%s: %s\n", posn, diag.Message)
+	msg := diag.Message
+	if diag.Severity != analysis.SeverityDefault {
+		msg = diag.Severity.String() + ": " + msg
+	}
+	if diag.URL != "" {
+		msg += " (see " + diag.URL + ")"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", posn, msg)
 
 	// -c=N: show offending line plus N lines of context.
 	if Context >= 0 {
@@ -338,10 +384,88 @@ func PrintPlain(fset *token.FileSet, diag analysis.Diagnostic) {
 	}
 }
 
+// An AnalyzerDiagnostic is a diagnostic along with the analyzer that
+// reported it.
+type AnalyzerDiagnostic struct {
+	Analyzer *analysis.Analyzer
+	analysis.Diagnostic
+}
+
+// SortDiagnostics sorts diagnostics by file, line, and column, then by
+// analyzer name and message, so that the output of a driver does not
+// depend on the order in which analyses ran. It does nothing if the
+// -unsorted flag is set.
+func SortDiagnostics(fset *token.FileSet, diags []AnalyzerDiagnostic) {
+	if Unsorted {
+		return
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		x, y := diags[i], diags[j]
+		if c := comparePos(fset, x.Pos, y.Pos); c != 0 {
+			return c < 0
+		}
+		if x.Analyzer.Name != y.Analyzer.Name {
+			return x.Analyzer.Name < y.Analyzer.Name
+		}
+		return x.Message < y.Message
+	})
+}
+
+// comparePos orders positions by file name, then by offset.
+func comparePos(fset *token.FileSet, x, y token.Pos) int {
+	px, py := fset.Position(x), fset.Position(y)
+	switch {
+	case px.Filename != py.Filename:
+		if px.Filename < py.Filename {
+			return -1
+		}
+		return +1
+	case px.Offset != py.Offset:
+		return px.Offset - py.Offset
+	}
+	return 0
+}
+
 // A JSONTree is a mapping from package ID to analysis name to result.
 // Each result is either a jsonError or a list of jsonDiagnostic.
 type JSONTree map[string]map[string]interface{}
 
+// A jsonDiagnostic is a diagnostic in the -json output. End and the fields
+// after Message are only present in version 2 of the output.
+type jsonDiagnostic struct {
+	Category       string                   `json:"category,omitempty"`
+	Posn           string                   `json:"posn"`
+	End            string                   `json:"end,omitempty"`
+	Message        string                   `json:"message"`
+	Severity       string                   `json:"severity,omitempty"`
+	URL            string                   `json:"url,omitempty"`
+	SuggestedFixes []jsonSuggestedFix       `json:"suggested_fixes,omitempty"`
+	Related        []jsonRelatedInformation `json:"related,omitempty"`
+}
+
+// A jsonSuggestedFix is a suggested fix in version 2 of the -json output.
+type jsonSuggestedFix struct {
+	Message string         `json:"message"`
+	Edits   []jsonTextEdit `json:"edits"`
+}
+
+// A jsonTextEdit is an edit of a suggested fix, which replaces the bytes
+// from offset Start to End of the file with New.
+type jsonTextEdit struct {
+	Filename string `json:"filename"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	New      string `json:"new"`
+}
+
+// A jsonRelatedInformation is the related information of a diagnostic in
+// version 2 of the -json output.
+type jsonRelatedInformation struct {
+	Posn    string `json:"posn"`
+	End     string `json:"end,omitempty"`
+	Message string `json:"message"`
+}
+
 // Add adds the result of analysis 'name' on package 'id'.
 // The result is either a list of diagnostics or an error.
 func (tree JSONTree) Add(fset *token.FileSet, id, name string, diags []analysis.Diagnostic, err error) {
@@ -352,20 +476,54 @@ func (tree JSONTree) Add(fset *token.FileSet, id, name string, diags []analysis.
 		}
 		v = jsonError{err.Error()}
 	} else if len(diags) > 0 {
-		type jsonDiagnostic struct {
-			Category string `json:"category,omitempty"`
-			Posn     string `json:"posn"`
-			Message  string `json:"message"`
+		if !Unsorted {
+			diags = append([]analysis.Diagnostic(nil), diags...)
+			sort.SliceStable(diags, func(i, j int) bool {
+				if c := comparePos(fset, diags[i].Pos, diags[j].Pos); c != 0 {
+					return c < 0
+				}
+				return diags[i].Message < diags[j].Message
+			})
 		}
 		var diagnostics []jsonDiagnostic
-		// TODO(matloob): Should the JSON diagnostics contain ranges?
-		// If so, how should they be formatted?
 		for _, f := range diags {
-			diagnostics = append(diagnostics, jsonDiagnostic{
+			d := jsonDiagnostic{
 				Category: f.Category,
 				Posn:     fset.Position(f.Pos).String(),
 				Message:  f.Message,
-			})
+			}
+			if JSONVersion >= 2 {
+				d.End = jsonEnd(fset, f.End)
+				if f.Severity != analysis.SeverityDefault {
+					d.Severity = f.Severity.String()
+				}
+				d.URL = f.URL
+				for _, fix := range f.SuggestedFixes {
+					jfix := jsonSuggestedFix{Message: fix.Message, Edits: []jsonTextEdit{}}
+					for _, edit := range fix.TextEdits {
+						start := fset.Position(edit.Pos)
+						end := start
+						if edit.End.IsValid() {
+							end = fset.Position(edit.End)
+						}
+						jfix.Edits = append(jfix.Edits, jsonTextEdit{
+							Filename: start.Filename,
+							Start:    start.Offset,
+							End:      end.Offset,
+							New:      string(edit.NewText),
+						})
+					}
+					d.SuggestedFixes = append(d.SuggestedFixes, jfix)
+				}
+				for _, r := range f.Related {
+					d.Related = append(d.Related, jsonRelatedInformation{
+						Posn:    fset.Position(r.Pos).String(),
+						End:     jsonEnd(fset, r.End),
+						Message: r.Message,
+					})
+				}
+			}
+			diagnostics = append(diagnostics, d)
 		}
 		v = diagnostics
 	}
@@ -379,6 +537,15 @@ func (tree JSONTree) Add(fset *token.FileSet, id, name string, diags []analysis.
 	}
 }
 
+// jsonEnd returns the end position end, which is optional, in the -json
+// output.
+func jsonEnd(fset *token.FileSet, end token.Pos) string {
+	if !end.IsValid() {
+		return ""
+	}
+	return fset.Position(end).String()
+}
+
 func (tree JSONTree) Print() {
 	data, err := json.MarshalIndent(tree, "", "\t")
 	if err != nil {
@@ -6,6 +6,7 @@ package analysisflags_test
 
 import (
 	"fmt"
+	"go/token"
 	"os"
 	"os/exec"
 	"runtime"
@@ -65,3 +66,38 @@ func TestExec(t *testing.T) {
 		}
 	}
 }
+
+func TestSortDiagnostics(t *testing.T) {
+	fset := token.NewFileSet()
+	a := fset.AddFile("a.go", -1, 100)
+	b := fset.AddFile("b.go", -1, 100)
+	for _, f := range []*token.File{a, b} {
+		f.SetLines([]int{0, 50})
+	}
+	x := &analysis.Analyzer{Name: "x"}
+	y := &analysis.Analyzer{Name: "y"}
+	diag := func(an *analysis.Analyzer, f *token.File, offset int, msg string) analysisflags.AnalyzerDiagnostic {
+		return analysisflags.AnalyzerDiagnostic{
+			Analyzer:   an,
+			Diagnostic: analysis.Diagnostic{Pos: f.Pos(offset), Message: msg},
+		}
+	}
+	// Reported in the order of a parallel run.
+	diags := []analysisflags.AnalyzerDiagnostic{
+		diag(y, b, 10, "y1"),
+		diag(y, a, 60, "y2"),
+		diag(x, a, 60, "x2"),
+		diag(x, b, 5, "x3"),
+		diag(x, a, 1, "x1"),
+	}
+	analysisflags.SortDiagnostics(fset, diags)
+	var got []string
+	for _, d := range diags {
+		posn := fset.Position(d.Pos)
+		got = append(got, fmt.Sprintf("%s:%d %s", posn.Filename, posn.Line, d.Message))
+	}
+	want := "a.go:1 x1, a.go:2 x2, a.go:2 y2, b.go:1 x3, b.go:1 y1"
+	if s := strings.Join(got, ", "); s != want {
+		t.Errorf("got %s, want %s", s, want)
+	}
+}
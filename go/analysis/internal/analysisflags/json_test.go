@@ -0,0 +1,57 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"encoding/json"
+	"go/token"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/analysis"
+)
+
+func TestJSONVersion(t *testing.T) {
+	defer func(v int) { JSONVersion = v }(JSONVersion)
+
+	const content = "package p\n\nvar x = x\n"
+	fset := token.NewFileSet()
+	f := fset.AddFile("p.go", -1, len(content))
+	f.SetLinesForContent([]byte(content))
+	x := f.Pos(19) // the second x
+	diags := []analysis.Diagnostic{{
+		Pos:      x,
+		End:      x + 1,
+		Message:  "self-assignment",
+		Severity: analysis.SeverityError,
+		URL:      "https://example.com/self-assignment",
+		SuggestedFixes: []analysis.SuggestedFix{{
+			Message:   "use 0",
+			TextEdits: []analysis.TextEdit{{Pos: x, End: x + 1, NewText: []byte("0")}},
+		}},
+		Related: []analysis.RelatedInformation{{Pos: f.Pos(15), Message: "declared here"}},
+	}}
+
+	for _, test := range []struct {
+		version int
+		want    string
+	}{
+		{1, `{"p":{"a":[{"posn":"p.go:3:9","message":"self-assignment"}]}}`},
+		{2, `{"p":{"a":[{"posn":"p.go:3:9","end":"p.go:3:10","message":"self-assignment",` +
+			`"severity":"error","url":"https://example.com/self-assignment",` +
+			`"suggested_fixes":[{"message":"use 0","edits":[{"filename":"p.go","start":19,"end":20,"new":"0"}]}],` +
+			`"related":[{"posn":"p.go:3:5","message":"declared here"}]}]}}`},
+	} {
+		JSONVersion = test.version
+		tree := make(JSONTree)
+		tree.Add(fset, "p", "a", diags, nil)
+		data, err := json.Marshal(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != test.want {
+			t.Errorf("version %d: got\n%s\nwant\n%s", test.version, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+)
+
+// A listedAnalyzer is the description of an analyzer printed by -list -json.
+type listedAnalyzer struct {
+	Name      string
+	Doc       string
+	Enabled   bool         // whether the analyzer is run, according to the -NAME flags
+	Flags     []listedFlag // command-line flags of the analyzer
+	FactTypes []string     `json:",omitempty"`
+	Requires  []string     `json:",omitempty"` // names of the analyzers it requires
+}
+
+// A listedFlag is the description of a flag of an analyzer.
+type listedFlag struct {
+	Name    string // name on the command line, such as "printf.funcs"
+	Bool    bool
+	Usage   string
+	Default string
+}
+
+// list prints to w the description of each registered analyzer, in the
+// order of their names, as JSON if JSON is set. The enabled analyzers are
+// those selected by the -NAME flags; multi is as for Parse.
+func list(w io.Writer, analyzers, enabled []*analysis.Analyzer, multi bool) error {
+	isEnabled := make(map[*analysis.Analyzer]bool)
+	for _, a := range enabled {
+		isEnabled[a] = true
+	}
+	analyzers = append([]*analysis.Analyzer(nil), analyzers...)
+	sort.Slice(analyzers, func(i, j int) bool { return analyzers[i].Name < analyzers[j].Name })
+
+	var listed []listedAnalyzer
+	for _, a := range analyzers {
+		la := listedAnalyzer{
+			Name:    a.Name,
+			Doc:     a.Doc,
+			Enabled: isEnabled[a],
+			Flags:   []listedFlag{},
+		}
+		a.Flags.VisitAll(func(f *flag.Flag) {
+			name := f.Name
+			if multi {
+				name = a.Name + "." + name
+			}
+			b, ok := f.Value.(interface{ IsBoolFlag() bool })
+			la.Flags = append(la.Flags, listedFlag{name, ok && b.IsBoolFlag(), f.Usage, f.DefValue})
+		})
+		for _, f := range a.FactTypes {
+			la.FactTypes = append(la.FactTypes, reflect.TypeOf(f).String())
+		}
+		for _, req := range a.Requires {
+			la.Requires = append(la.Requires, req.Name)
+		}
+		listed = append(listed, la)
+	}
+
+	if JSON {
+		data, err := json.MarshalIndent(listed, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	for _, la := range listed {
+		title := strings.Split(la.Doc, "\n\n")[0]
+		state := ""
+		if !la.Enabled {
+			state = " (disabled)"
+		}
+		if _, err := fmt.Fprintf(w, "%-12s %s%s\n", la.Name, title, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
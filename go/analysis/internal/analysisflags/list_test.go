@@ -0,0 +1,71 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/analysis"
+)
+
+type listFact struct{}
+
+func (*listFact) AFact() {}
+
+func TestList(t *testing.T) {
+	base := &analysis.Analyzer{Name: "base", Doc: "base analysis", FactTypes: []analysis.Fact{new(listFact)}}
+	check := &analysis.Analyzer{Name: "check", Doc: "check things\n\nMore details.", Requires: []*analysis.Analyzer{base}}
+	check.Flags.Bool("strict", false, "be strict")
+
+	var buf bytes.Buffer
+	if err := list(&buf, []*analysis.Analyzer{check, base}, []*analysis.Analyzer{check}, true); err != nil {
+		t.Fatal(err)
+	}
+	want := `base         base analysis (disabled)
+check        check things
+`
+	if got := buf.String(); got != want {
+		t.Errorf("list printed:\n%s\nwant:\n%s", got, want)
+	}
+
+	defer func() { JSON = false }()
+	JSON = true
+	buf.Reset()
+	if err := list(&buf, []*analysis.Analyzer{check, base}, []*analysis.Analyzer{check}, true); err != nil {
+		t.Fatal(err)
+	}
+	want = `[
+	{
+		"Name": "base",
+		"Doc": "base analysis",
+		"Enabled": false,
+		"Flags": [],
+		"FactTypes": [
+			"*analysisflags.listFact"
+		]
+	},
+	{
+		"Name": "check",
+		"Doc": "check things\n\nMore details.",
+		"Enabled": true,
+		"Flags": [
+			{
+				"Name": "check.strict",
+				"Bool": true,
+				"Usage": "be strict",
+				"Default": "false"
+			}
+		],
+		"Requires": [
+			"base"
+		]
+	}
+]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("list -json printed:\n%s\nwant:\n%s", got, want)
+	}
+}
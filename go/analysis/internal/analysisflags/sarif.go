@@ -0,0 +1,395 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackie-feng/tools/go/analysis"
+)
+
+// A SARIFLog accumulates the diagnostics and errors of analyzers, to be
+// printed as a SARIF 2.1.0 log, which code scanning services such as GitHub
+// code scanning accept. The analyzers are the rules of the log.
+//
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+type SARIFLog struct {
+	rules   []sarifRule
+	index   map[string]int // rule index by analyzer name
+	results []sarifEntry
+	seen    map[sarifKey]bool
+	errors  []sarifNotification
+	files   map[string][]byte // contents of the files, for the columns
+	wd      string
+}
+
+// A sarifEntry is a result along with the position it is sorted by.
+type sarifEntry struct {
+	posn     token.Position
+	analyzer string
+	result   sarifResult
+}
+
+// A sarifKey identifies a diagnostic, to report those of source files that
+// belong to several packages, such as foo and foo.test, once.
+type sarifKey struct {
+	analyzer  string
+	posn, end token.Position
+	message   string
+}
+
+// NewSARIFLog returns an empty log whose rules are the analyzers.
+func NewSARIFLog(analyzers []*analysis.Analyzer) *SARIFLog {
+	l := &SARIFLog{
+		index: make(map[string]int),
+		seen:  make(map[sarifKey]bool),
+		files: make(map[string][]byte),
+	}
+	l.wd, _ = os.Getwd()
+	for _, a := range analyzers {
+		l.rule(a)
+	}
+	return l
+}
+
+// rule returns the index of the rule of analyzer a, adding it if needed.
+func (l *SARIFLog) rule(a *analysis.Analyzer) int {
+	if i, ok := l.index[a.Name]; ok {
+		return i
+	}
+	short := a.Doc
+	if i := strings.Index(short, "\n\n"); i >= 0 {
+		short = short[:i]
+	}
+	l.rules = append(l.rules, sarifRule{
+		ID:               a.Name,
+		Name:             a.Name,
+		ShortDescription: sarifMessage{Text: strings.Join(strings.Fields(short), " ")},
+		FullDescription:  sarifMessage{Text: a.Doc},
+	})
+	l.index[a.Name] = len(l.rules) - 1
+	return len(l.rules) - 1
+}
+
+// Add adds the result of analyzer a on package id: either its diagnostics,
+// or the error that it failed with.
+func (l *SARIFLog) Add(fset *token.FileSet, id string, a *analysis.Analyzer, diags []analysis.Diagnostic, err error) {
+	if err != nil {
+		l.errors = append(l.errors, sarifNotification{
+			Level:   "error",
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s: %v", id, a.Name, err)},
+		})
+		return
+	}
+	if len(diags) == 0 {
+		return
+	}
+	rule := l.rule(a)
+	for _, diag := range diags {
+		posn, end := fset.Position(diag.Pos), fset.Position(diag.End)
+		k := sarifKey{a.Name, posn, end, diag.Message}
+		if l.seen[k] {
+			continue // duplicate
+		}
+		l.seen[k] = true
+
+		result := sarifResult{
+			RuleID:    a.Name,
+			RuleIndex: rule,
+			Level:     sarifLevel(diag.Severity),
+			Message:   sarifMessage{Text: diag.Message},
+			Locations: []sarifLocation{{PhysicalLocation: l.location(fset, diag.Pos, diag.End)}},
+		}
+		if diag.URL != "" {
+			result.Properties = &sarifProperties{URL: diag.URL}
+		}
+		for i, rel := range diag.Related {
+			result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+				ID:               i + 1,
+				PhysicalLocation: l.location(fset, rel.Pos, rel.End),
+				Message:          &sarifMessage{Text: rel.Message},
+			})
+		}
+		for _, fix := range diag.SuggestedFixes {
+			result.Fixes = append(result.Fixes, l.fix(fset, fix))
+		}
+		l.results = append(l.results, sarifEntry{posn, a.Name, result})
+	}
+}
+
+// sarifLevel returns the SARIF level of results of severity s.
+func sarifLevel(s analysis.Severity) string {
+	switch s {
+	case analysis.SeverityError:
+		return "error"
+	case analysis.SeverityInfo:
+		return "note"
+	}
+	return "warning"
+}
+
+// fix returns the SARIF form of fix, with the edits of each file together.
+func (l *SARIFLog) fix(fset *token.FileSet, fix analysis.SuggestedFix) sarifFix {
+	f := sarifFix{Description: sarifMessage{Text: fix.Message}}
+	changes := make(map[string]int) // index of the change of each file
+	for _, edit := range fix.TextEdits {
+		end := edit.End
+		if !end.IsValid() {
+			end = edit.Pos
+		}
+		loc := l.location(fset, edit.Pos, end)
+		i, ok := changes[loc.ArtifactLocation.URI]
+		if !ok {
+			i = len(f.ArtifactChanges)
+			changes[loc.ArtifactLocation.URI] = i
+			f.ArtifactChanges = append(f.ArtifactChanges, sarifArtifactChange{ArtifactLocation: loc.ArtifactLocation})
+		}
+		f.ArtifactChanges[i].Replacements = append(f.ArtifactChanges[i].Replacements, sarifReplacement{
+			DeletedRegion:   loc.Region,
+			InsertedContent: sarifContent{Text: string(edit.NewText)},
+		})
+	}
+	return f
+}
+
+// location returns the location of the range from pos to end, which is
+// optional.
+func (l *SARIFLog) location(fset *token.FileSet, pos, end token.Pos) sarifPhysicalLocation {
+	posn := fset.Position(pos)
+	endPosn := posn
+	if end.IsValid() {
+		endPosn = fset.Position(end)
+	}
+	return sarifPhysicalLocation{
+		ArtifactLocation: l.artifact(posn.Filename),
+		Region: sarifRegion{
+			StartLine:   posn.Line,
+			StartColumn: l.column(posn),
+			EndLine:     endPosn.Line,
+			EndColumn:   l.column(endPosn),
+			ByteOffset:  posn.Offset,
+			ByteLength:  endPosn.Offset - posn.Offset,
+		},
+	}
+}
+
+// artifact returns the location of the file filename: relative to the
+// source root, the working directory, if it is below it, and otherwise
+// absolute.
+func (l *SARIFLog) artifact(filename string) sarifArtifactLocation {
+	if l.wd != "" {
+		if rel, err := filepath.Rel(l.wd, filename); err == nil && !strings.HasPrefix(rel, "..") {
+			return sarifArtifactLocation{URI: filepath.ToSlash(rel), URIBaseID: "%SRCROOT%"}
+		}
+	}
+	return sarifArtifactLocation{URI: fileURI(filename)}
+}
+
+// column returns the column of posn in UTF-16 code units, as SARIF expects by
+// default. It falls back to the byte column if the file cannot be read.
+func (l *SARIFLog) column(posn token.Position) int {
+	content, ok := l.files[posn.Filename]
+	if !ok {
+		content, _ = ioutil.ReadFile(posn.Filename)
+		l.files[posn.Filename] = content
+	}
+	start := posn.Offset - (posn.Column - 1)
+	if start < 0 || posn.Offset > len(content) {
+		return posn.Column
+	}
+	col := 1
+	for line := content[start:posn.Offset]; len(line) > 0; {
+		r, size := utf8.DecodeRune(line)
+		line = line[size:]
+		if r > 0xFFFF {
+			col += 2 // a surrogate pair
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+func fileURI(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		abs = filename
+	}
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		abs = "/" + abs // a Windows path such as C:/foo
+	}
+	return (&url.URL{Scheme: "file", Path: abs}).String()
+}
+
+// Print prints the log as JSON to stdout. The results are sorted by
+// position and analyzer, unless the -unsorted flag is set.
+func (l *SARIFLog) Print() {
+	data, err := json.MarshalIndent(l.file(), "", "\t")
+	if err != nil {
+		log.Panicf("internal error: SARIF marshalling failed: %v", err)
+	}
+	fmt.Printf("%s\n", data)
+}
+
+// file returns the log in the form in which it is printed.
+func (l *SARIFLog) file() *sarifFile {
+	if !Unsorted {
+		sort.SliceStable(l.results, func(i, j int) bool {
+			x, y := l.results[i], l.results[j]
+			if x.posn.Filename != y.posn.Filename {
+				return x.posn.Filename < y.posn.Filename
+			}
+			if x.posn.Offset != y.posn.Offset {
+				return x.posn.Offset < y.posn.Offset
+			}
+			if x.analyzer != y.analyzer {
+				return x.analyzer < y.analyzer
+			}
+			return x.result.Message.Text < y.result.Message.Text
+		})
+	}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:  filepath.Base(os.Args[0]),
+			Rules: l.rules,
+		}},
+		Results: []sarifResult{},
+		Invocations: []sarifInvocation{{
+			ExecutionSuccessful:        len(l.errors) == 0,
+			ToolExecutionNotifications: l.errors,
+		}},
+	}
+	if l.wd != "" {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{
+			"%SRCROOT%": {URI: fileURI(l.wd) + "/"},
+		}
+	}
+	for _, r := range l.results {
+		run.Results = append(run.Results, r.result)
+	}
+	return &sarifFile{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
+
+// The types below are the parts of the SARIF 2.1.0 object model that the
+// drivers produce.
+
+type sarifFile struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	Invocations        []sarifInvocation                `json:"invocations"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string           `json:"ruleId"`
+	RuleIndex        int              `json:"ruleIndex"`
+	Level            string           `json:"level"`
+	Message          sarifMessage     `json:"message"`
+	Locations        []sarifLocation  `json:"locations"`
+	RelatedLocations []sarifLocation  `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix       `json:"fixes,omitempty"`
+	Properties       *sarifProperties `json:"properties,omitempty"`
+}
+
+// sarifProperties is the property bag of a result, holding the URL of the
+// documentation of the category of its diagnostic.
+type sarifProperties struct {
+	URL string `json:"url,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+	ByteOffset  int `json:"byteOffset"`
+	ByteLength  int `json:"byteLength"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifContent `json:"insertedContent"`
+}
+
+type sarifContent struct {
+	Text string `json:"text"`
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisflags
+
+import (
+	"errors"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/analysis"
+)
+
+func TestSARIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sarif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The second line has a 2-byte and a 4-byte rune before x,
+	// which take 1 and 2 UTF-16 code units.
+	const content = "package p\nvar s = \"é𝄞\"; var x = 1\n"
+	filename := filepath.Join(dir, "p.go")
+	if err := ioutil.WriteFile(filename, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f := fset.AddFile(filename, -1, len(content))
+	f.SetLinesForContent([]byte(content))
+	offset := func(s string) token.Pos {
+		for i := 0; i+len(s) <= len(content); i++ {
+			if content[i:i+len(s)] == s {
+				return f.Pos(i)
+			}
+		}
+		t.Fatalf("%q not found", s)
+		return token.NoPos
+	}
+	x := offset("x = 1")
+
+	a := &analysis.Analyzer{Name: "a", Doc: "check for things\n\nThe details."}
+	b := &analysis.Analyzer{Name: "b", Doc: "check for other things"}
+	diag := analysis.Diagnostic{
+		Pos:     x,
+		End:     x + 1,
+		Message: "bad x",
+		SuggestedFixes: []analysis.SuggestedFix{{
+			Message: "rename x",
+			TextEdits: []analysis.TextEdit{
+				{Pos: x, End: x + 1, NewText: []byte("y")},
+				{Pos: offset("package"), NewText: []byte("// p\n")},
+			},
+		}},
+	}
+	l := NewSARIFLog([]*analysis.Analyzer{a})
+	l.wd = dir
+	l.Add(fset, "p", a, []analysis.Diagnostic{diag}, nil)
+	l.Add(fset, "p.test", a, []analysis.Diagnostic{diag}, nil) // duplicate
+	l.Add(fset, "p", b, []analysis.Diagnostic{{Pos: offset("package"), Message: "bad package"}}, nil)
+	l.Add(fset, "q", b, nil, errors.New("failed"))
+
+	run := l.file().Runs[0]
+	var rules []string
+	for _, r := range run.Tool.Driver.Rules {
+		rules = append(rules, r.ID+": "+r.ShortDescription.Text)
+	}
+	if want := []string{"a: check for things", "b: check for other things"}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("got rules %q, want %q", rules, want)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("got %d results, want 2 (the duplicate removed)", len(run.Results))
+	}
+	if r := run.Results[0]; r.RuleID != "b" || r.RuleIndex != 1 {
+		t.Errorf("got first result of rule %s (%d), want the one of b, sorted first", r.RuleID, r.RuleIndex)
+	}
+	r := run.Results[1]
+	loc := r.Locations[0].PhysicalLocation
+	if want := (sarifArtifactLocation{URI: "p.go", URIBaseID: "%SRCROOT%"}); loc.ArtifactLocation != want {
+		t.Errorf("got artifact %+v, want %+v", loc.ArtifactLocation, want)
+	}
+	if want := (sarifRegion{StartLine: 2, StartColumn: 20, EndLine: 2, EndColumn: 21, ByteOffset: int(x) - f.Base(), ByteLength: 1}); loc.Region != want {
+		t.Errorf("got region %+v, want %+v", loc.Region, want)
+	}
+	if len(r.Fixes) != 1 || len(r.Fixes[0].ArtifactChanges) != 1 {
+		t.Fatalf("got fixes %+v, want one with the changes of one file", r.Fixes)
+	}
+	if got := r.Fixes[0].ArtifactChanges[0].Replacements; len(got) != 2 || got[1].DeletedRegion.ByteLength != 0 || got[1].InsertedContent.Text != "// p\n" {
+		t.Errorf("got replacements %+v, want the edit and the insertion", got)
+	}
+	if inv := run.Invocations[0]; inv.ExecutionSuccessful || len(inv.ToolExecutionNotifications) != 1 {
+		t.Errorf("got invocation %+v, want one that failed with one notification", inv)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jackie-feng/tools/go/analysis"
+)
+
+// A baselineEntry records the number of findings of an analyzer with the
+// same message in a file, on lines with the same text. The text of the line
+// is recorded as a hash, its fingerprint, rather than the line number, so
+// that the findings still match after unrelated edits to the file move them.
+type baselineEntry struct {
+	File        string `json:"file"`
+	Analyzer    string `json:"analyzer"`
+	Message     string `json:"message"`
+	Fingerprint string `json:"fingerprint"`
+	Count       int    `json:"count"`
+}
+
+type baselineKey struct {
+	file, analyzer, message, fingerprint string
+}
+
+// applyBaseline writes the diagnostics of the root actions to the Baseline
+// file, if it does not exist or BaselineWrite is set, or else removes the
+// diagnostics recorded in it. In both cases, only the diagnostics that are
+// not in the baseline remain to be printed.
+func applyBaseline(roots []*action) error {
+	var counts map[baselineKey]int
+	write := BaselineWrite
+	if !write {
+		var err error
+		counts, err = readBaseline()
+		write = os.IsNotExist(err)
+		if err != nil && !write {
+			return err
+		}
+	}
+
+	// Visit the diagnostics in order, so that the earliest findings of a
+	// file match the baseline, and each of them once, as the files of a
+	// package foo also belong to foo.test.
+	type diagnostic struct {
+		act  *action
+		diag analysis.Diagnostic
+		posn token.Position
+	}
+	var diags []diagnostic
+	for _, act := range roots {
+		if act.Err != nil {
+			continue
+		}
+		for _, diag := range act.Diagnostics {
+			diags = append(diags, diagnostic{act, diag, act.Package.Fset.Position(diag.Pos)})
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		x, y := diags[i].posn, diags[j].posn
+		if x.Filename != y.Filename {
+			return x.Filename < y.Filename
+		}
+		return x.Offset < y.Offset
+	})
+	type posKey struct {
+		posn token.Position
+		*analysis.Analyzer
+		message string
+	}
+	seen := make(map[posKey]bool) // whether the finding is new
+	lines := make(lineReader)
+
+	if write {
+		counts := make(map[baselineKey]int)
+		for _, d := range diags {
+			k := posKey{d.posn, d.act.Analyzer, d.diag.Message}
+			if _, ok := seen[k]; !ok {
+				seen[k] = false
+				counts[newBaselineKey(lines, d.posn, d.act.Analyzer, d.diag.Message)]++
+			}
+		}
+		for _, act := range roots {
+			act.Diagnostics = nil
+		}
+		return writeBaseline(counts)
+	}
+
+	for _, d := range diags {
+		k := posKey{d.posn, d.act.Analyzer, d.diag.Message}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		bk := newBaselineKey(lines, d.posn, d.act.Analyzer, d.diag.Message)
+		if counts[bk] > 0 {
+			counts[bk]--
+			seen[k] = false
+		} else {
+			seen[k] = true
+		}
+	}
+	for _, act := range roots {
+		var diags []analysis.Diagnostic
+		for _, diag := range act.Diagnostics {
+			if seen[posKey{act.Package.Fset.Position(diag.Pos), act.Analyzer, diag.Message}] {
+				diags = append(diags, diag)
+			}
+		}
+		act.Diagnostics = diags
+	}
+	return nil
+}
+
+// newBaselineKey returns the key of the finding of analyzer a with message
+// at posn in the baseline.
+func newBaselineKey(lines lineReader, posn token.Position, a *analysis.Analyzer, message string) baselineKey {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", a.Name, message)
+	h.Write(bytes.TrimSpace(lines.line(posn)))
+	return baselineKey{baselineFile(posn.Filename), a.Name, message, hex.EncodeToString(h.Sum(nil))[:16]}
+}
+
+// A lineReader reads the lines of files, caching their contents by name.
+type lineReader map[string][]byte
+
+// line returns the text of the line of posn, or nil if it cannot be read.
+func (r lineReader) line(posn token.Position) []byte {
+	content, ok := r[posn.Filename]
+	if !ok {
+		content, _ = ioutil.ReadFile(posn.Filename)
+		r[posn.Filename] = content
+	}
+	if posn.Offset < 0 || posn.Offset > len(content) {
+		return nil
+	}
+	start := bytes.LastIndexByte(content[:posn.Offset], '\n') + 1
+	end := len(content)
+	if i := bytes.IndexByte(content[posn.Offset:], '\n'); i >= 0 {
+		end = posn.Offset + i
+	}
+	return content[start:end]
+}
+
+// baselineFile returns the name of file in the baseline: its path relative
+// to the current directory, so that the baseline may be checked in.
+func baselineFile(file string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, file); err == nil {
+			file = rel
+		}
+	}
+	return filepath.ToSlash(file)
+}
+
+func readBaseline() (map[baselineKey]int, error) {
+	data, err := ioutil.ReadFile(Baseline)
+	if err != nil {
+		return nil, err
+	}
+	var entries []baselineEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("reading baseline %s: %v", Baseline, err)
+	}
+	counts := make(map[baselineKey]int)
+	for _, e := range entries {
+		counts[baselineKey{e.File, e.Analyzer, e.Message, e.Fingerprint}] += e.Count
+	}
+	return counts, nil
+}
+
+// writeBaseline writes the Baseline file, and logs that it was written,
+// as its diagnostics are not printed.
+func writeBaseline(counts map[baselineKey]int) error {
+	entries := []baselineEntry{}
+	total := 0
+	for k, n := range counts {
+		entries = append(entries, baselineEntry{k.file, k.analyzer, k.message, k.fingerprint, n})
+		total += n
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		x, y := entries[i], entries[j]
+		if x.File != y.File {
+			return x.File < y.File
+		}
+		if x.Analyzer != y.Analyzer {
+			return x.Analyzer < y.Analyzer
+		}
+		if x.Message != y.Message {
+			return x.Message < y.Message
+		}
+		return x.Fingerprint < y.Fingerprint
+	})
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(Baseline, append(data, '\n'), 0666); err != nil {
+		return err
+	}
+	log.Printf("recorded %d diagnostics in baseline %s", total, Baseline)
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/packages"
+)
+
+func TestBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(file string) { Baseline = file }(Baseline)
+	Baseline = filepath.Join(dir, "baseline.json")
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	filename := filepath.Join(dir, "a.go")
+
+	a := &analysis.Analyzer{Name: "a"}
+	// roots writes the file with the given lines, and returns the actions
+	// of a package and its test variant, which share the diagnostics of
+	// their common files: one with each message on the line of the same
+	// index.
+	roots := func(lines []string, messages ...string) []*action {
+		content := strings.Join(lines, "\n") + "\n"
+		if err := ioutil.WriteFile(filename, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		f := fset.AddFile(filename, -1, len(content))
+		f.SetLinesForContent([]byte(content))
+		var diags []analysis.Diagnostic
+		for i, msg := range messages {
+			if msg != "" {
+				diags = append(diags, analysis.Diagnostic{Pos: f.LineStart(i + 1), Message: msg})
+			}
+		}
+		pkg := &packages.Package{Fset: fset}
+		return []*action{
+			{Analyzer: a, Package: pkg, IsRoot: true, Diagnostics: diags},
+			{Analyzer: a, Package: pkg, IsRoot: true, Diagnostics: diags},
+		}
+	}
+
+	// The baseline does not exist: it is written.
+	acts := roots([]string{"package a", "x := 1", "y = y"}, "", "x", "y")
+	if err := applyBaseline(acts); err != nil {
+		t.Fatal(err)
+	}
+	if acts[0].Diagnostics != nil {
+		t.Errorf("got diagnostics %v when writing the baseline, want none", acts[0].Diagnostics)
+	}
+	if _, err := os.Stat(Baseline); err != nil {
+		t.Fatal(err)
+	}
+	if want := "recorded 2 diagnostics in baseline " + Baseline; !strings.Contains(logged.String(), want) {
+		t.Errorf("got log %q, want it to contain %q", logged.String(), want)
+	}
+
+	// The findings moved to other lines, and new ones were added: on a new
+	// line, and on a line with other text.
+	acts = roots([]string{"// a", "package a", "  x := 1", "y = y", "z = z", "y = 2"}, "z", "", "x", "y", "z", "y")
+	if err := applyBaseline(acts); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, diag := range acts[0].Diagnostics {
+		got = append(got, fmt.Sprintf("%d: %s", acts[0].Package.Fset.Position(diag.Pos).Line, diag.Message))
+	}
+	if want := []string{"1: z", "5: z", "6: y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagnostics %q, want %q", got, want)
+	}
+
+	// The baseline is written again with BaselineWrite, and then matches
+	// all the findings.
+	BaselineWrite = true
+	defer func() { BaselineWrite = false }()
+	acts = roots([]string{"// a", "package a", "  x := 1", "y = y", "z = z", "y = 2"}, "z", "", "x", "y", "z", "y")
+	if err := applyBaseline(acts); err != nil {
+		t.Fatal(err)
+	}
+	if acts[0].Diagnostics != nil {
+		t.Errorf("got diagnostics %v when writing the baseline, want none", acts[0].Diagnostics)
+	}
+	if want := "recorded 5 diagnostics in baseline " + Baseline; !strings.Contains(logged.String(), want) {
+		t.Errorf("got log %q, want it to contain %q", logged.String(), want)
+	}
+	BaselineWrite = false
+	acts = roots([]string{"// a", "package a", "  x := 1", "y = y", "z = z", "y = 2"}, "z", "", "x", "y", "z", "y")
+	if err := applyBaseline(acts); err != nil {
+		t.Fatal(err)
+	}
+	if len(acts[0].Diagnostics) != 0 {
+		t.Errorf("got diagnostics %v after writing the baseline again, want none", acts[0].Diagnostics)
+	}
+}
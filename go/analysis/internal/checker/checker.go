@@ -10,7 +10,6 @@ package checker
 
 import (
 	"bytes"
-	"encoding/gob"
 	"flag"
 	"fmt"
 	"go/format"
@@ -20,36 +19,85 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"reflect"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/checker"
 	"github.com/jackie-feng/tools/go/analysis/internal/analysisflags"
+	"github.com/jackie-feng/tools/go/ast/astutil"
 	"github.com/jackie-feng/tools/go/packages"
+	"github.com/jackie-feng/tools/internal/diff"
+	"github.com/jackie-feng/tools/internal/diff/myers"
+	"github.com/jackie-feng/tools/internal/span"
 )
 
 var (
 	// Debug is a set of single-letter flags:
 	//
 	//	f	show [f]acts as they are created
-	// 	p	disable [p]arallel execution of analyzers
+	// 	p	disable [p]arallel execution of analyzers, as -concurrency=1
 	//	s	do additional [s]anity checks on fact types and serialization
-	//	t	show [t]iming info (NB: use 'p' flag to avoid GC/scheduler noise)
+	//	t	show [t]iming info of each action (NB: use 'p' flag to avoid GC/scheduler noise)
 	//	v	show [v]erbose logging
 	//
 	Debug = ""
 
+	// Concurrency is the maximum number of actions executed at once,
+	// or 0 for GOMAXPROCS.
+	Concurrency int
+
 	// Log files for optional performance tracing.
 	CPUProfile, MemProfile, Trace string
 
 	// Fix determines whether to apply all suggested fixes.
 	Fix bool
+
+	// Diff determines whether to print a unified diff of all suggested
+	// fixes rather than apply them.
+	Diff bool
+
+	// SuppressUnused determines whether to report the suppression comments
+	// that suppress no diagnostic.
+	SuppressUnused bool
+
+	// Baseline is the name of the baseline file. If it does not exist, the
+	// diagnostics are recorded in it rather than printed; otherwise only
+	// the diagnostics that are not recorded in it are printed.
+	Baseline string
+
+	// BaselineWrite determines whether to record the diagnostics in the
+	// Baseline file even if it exists, replacing its contents.
+	BaselineWrite bool
+
+	// DumpFacts is the name of a directory to which the facts of each
+	// package are written, for debugging.
+	DumpFacts string
+
+	// FactCodec is the name of the codec of the facts passed between the
+	// units of go vet, "gob" or "json". It has no effect on the packages
+	// loaded from source, whose facts are not encoded.
+	FactCodec = "gob"
+
+	// BestEffort determines whether to analyze the packages with errors:
+	// the analyzers that RunDespiteErrors are run on them, with partial
+	// type information, and the others are skipped with a note, rather
+	// than the load errors ending the run.
+	BestEffort bool
+
+	// Progress determines whether to print each action as it starts and
+	// finishes, with its duration, and a summary of the slowest actions.
+	Progress bool
+
+	// Cache determines whether to cache the diagnostics and facts of the
+	// analyzers in the user cache directory, so that the unchanged
+	// packages are not analyzed again.
+	Cache bool
 )
 
 // RegisterFlags registers command-line flags used by the analysis driver.
@@ -59,11 +107,29 @@ func RegisterFlags() {
 
 	flag.StringVar(&Debug, "debug", Debug, `debug flags, any subset of "fpstv"`)
 
+	flag.IntVar(&Concurrency, "concurrency", 0, "maximum number of analyses of packages to run at once (0 means GOMAXPROCS)")
+
 	flag.StringVar(&CPUProfile, "cpuprofile", "", "write CPU profile to this file")
 	flag.StringVar(&MemProfile, "memprofile", "", "write memory profile to this file")
 	flag.StringVar(&Trace, "trace", "", "write trace log to this file")
 
 	flag.BoolVar(&Fix, "fix", false, "apply all suggested fixes")
+	flag.BoolVar(&Diff, "diff", false, "print a unified diff of all suggested fixes rather than apply them")
+
+	flag.BoolVar(&SuppressUnused, "suppress.unused", false, "report the //lint:ignore and //nolint comments that suppress no diagnostic")
+
+	flag.StringVar(&Baseline, "baseline", "", "record the current diagnostics in this file if it does not exist, or else report only the diagnostics that are not recorded in it")
+	flag.BoolVar(&BaselineWrite, "baseline.write", false, "record the current diagnostics in the -baseline file even if it exists")
+
+	flag.StringVar(&DumpFacts, "dumpfacts", "", "write the facts of each package to a JSON file in this directory")
+
+	flag.StringVar(&FactCodec, "factcodec", FactCodec, "encode the facts of each package with this codec (gob or json) when run by go vet")
+
+	flag.BoolVar(&Cache, "cache", false, "cache the results of the analyzers in the user cache directory")
+
+	flag.BoolVar(&BestEffort, "besteffort", false, "analyze packages with errors, skipping the analyzers that need complete type information")
+
+	flag.BoolVar(&Progress, "progress", false, "print each analysis of a package as it runs, with its duration, and the slowest ones at the end")
 }
 
 // Run loads the packages specified by args using go/packages,
@@ -122,43 +188,100 @@ func Run(args []string, analyzers []*analysis.Analyzer) (exitcode int) {
 		log.Printf("load %s", args)
 	}
 
-	// Optimization: if the selected analyzers don't produce/consume
-	// facts, we need source only for the initial packages.
-	allSyntax := needFacts(analyzers)
-	initial, err := load(args, allSyntax)
+	initial, err := load(args, analyzers)
 	if err != nil {
 		log.Print(err)
-		return 1 // load errors
+		// In best-effort mode, analyze the packages that were loaded,
+		// whatever their errors, but still fail.
+		if !BestEffort || len(initial) == 0 {
+			return 1 // load errors
+		}
+	}
+	loadErrors := err != nil
+
+	var cacheDir string
+	if Cache {
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "go-analysis")
+		}
 	}
 
 	// Print the results.
-	roots := analyze(initial, analyzers)
+	t0 := time.Now()
+	roots := analyze(initial, analyzers, cacheDir)
+	wall := time.Since(t0)
 
-	if Fix {
-		applyFixes(roots)
+	if DumpFacts != "" {
+		if err := checker.WriteFacts(DumpFacts, roots); err != nil {
+			log.Print(err)
+			return 1
+		}
 	}
 
-	return printDiagnostics(roots)
-}
+	applyExclusions(roots)
+	applySuppressions(roots)
+
+	// Apply the baseline first, so that the findings are fingerprinted
+	// with the source as it was analyzed, and only new findings are fixed.
+	if Baseline != "" {
+		if err := applyBaseline(roots); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
 
-// load loads the initial packages.
-func load(patterns []string, allSyntax bool) ([]*packages.Package, error) {
-	mode := packages.LoadSyntax
-	if allSyntax {
-		mode = packages.LoadAllSyntax
+	fixed := true
+	if Fix || Diff {
+		fixed = applyFixes(roots)
+	}
+
+	exitcode = printDiagnostics(roots)
+	if dbg('t') {
+		printTiming(roots, wall, 0)
+	} else if Progress {
+		printTiming(roots, wall, slowest)
 	}
-	conf := packages.Config{
-		Mode:  mode,
-		Tests: true,
+	if !fixed && exitcode == 0 {
+		exitcode = 1 // some fixes could not be applied
+	}
+	if loadErrors {
+		exitcode = 1 // load errors, as without -besteffort
+	}
+	return exitcode
+}
+
+// applyExclusions removes the diagnostics of the root actions in the files
+// excluded by the -exclude flag or the configuration file of the driver,
+// and, unless the -generated flag is set, in generated files.
+func applyExclusions(roots []*action) {
+	for _, act := range roots {
+		fset := act.Package.Fset
+		generated := make(map[*token.File]bool)
+		if !analysisflags.Generated {
+			for _, f := range act.Package.Syntax {
+				if astutil.IsGenerated(f) {
+					generated[fset.File(f.Pos())] = true
+				}
+			}
+		}
+		var diags []analysis.Diagnostic
+		for _, diag := range act.Diagnostics {
+			if !generated[fset.File(diag.Pos)] && !analysisflags.Excluded(fset.Position(diag.Pos).Filename) {
+				diags = append(diags, diag)
+			}
+		}
+		act.Diagnostics = diags
 	}
-	initial, err := packages.Load(&conf, patterns...)
+}
+
+// load loads the initial packages, and prints their errors.
+func load(patterns []string, analyzers []*analysis.Analyzer) ([]*packages.Package, error) {
+	initial, err := checker.Load(&packages.Config{Tests: true}, analyzers, patterns...)
 	if err == nil {
 		if n := packages.PrintErrors(initial); n > 1 {
 			err = fmt.Errorf("%d errors during loading", n)
 		} else if n == 1 {
 			err = fmt.Errorf("error during loading")
-		} else if len(initial) == 0 {
-			err = fmt.Errorf("%s matched no packages", strings.Join(patterns, " "))
 		}
 	}
 
@@ -174,231 +297,250 @@ func load(patterns []string, allSyntax bool) ([]*packages.Package, error) {
 // This entry point is used only by analysistest.
 func TestAnalyzer(a *analysis.Analyzer, pkgs []*packages.Package) []*TestAnalyzerResult {
 	var results []*TestAnalyzerResult
-	for _, act := range analyze(pkgs, []*analysis.Analyzer{a}) {
-		facts := make(map[types.Object][]analysis.Fact)
-		for key, fact := range act.objectFacts {
-			if key.obj.Pkg() == act.pass.Pkg {
-				facts[key.obj] = append(facts[key.obj], fact)
-			}
-		}
-		for key, fact := range act.packageFacts {
-			if key.pkg == act.pass.Pkg {
-				facts[nil] = append(facts[nil], fact)
-			}
-		}
-
-		results = append(results, &TestAnalyzerResult{act.pass, act.diagnostics, facts, act.result, act.err})
+	for _, act := range analyze(pkgs, []*analysis.Analyzer{a}, "") {
+		facts := act.Facts()
+		results = append(results, &TestAnalyzerResult{act.Pass, act.Diagnostics, facts, act.Result, act.Err})
 	}
 	return results
 }
 
-type TestAnalyzerResult struct {
-	Pass        *analysis.Pass
-	Diagnostics []analysis.Diagnostic
-	Facts       map[types.Object][]analysis.Fact
-	Result      interface{}
-	Err         error
-}
+// An action is the application of an analyzer to a package.
+type action = checker.Action
 
-func analyze(pkgs []*packages.Package, analyzers []*analysis.Analyzer) []*action {
-	// Construct the action graph.
-	if dbg('v') {
-		log.Printf("building graph of analysis passes")
+// analyze applies the analyzers to the packages, with the options of Debug
+// and the cache directory cacheDir, if any, and returns the root actions.
+func analyze(pkgs []*packages.Package, analyzers []*analysis.Analyzer, cacheDir string) []*action {
+	opts := &checker.Options{
+		Concurrency: Concurrency,
+		SanityCheck: dbg('s'),
+		LogFacts:    dbg('f'),
+		Timing:      dbg('t'),
+		Verbose:     dbg('v'),
+		CacheDir:    cacheDir,
 	}
-
-	// Each graph node (action) is one unit of analysis.
-	// Edges express package-to-package (vertical) dependencies,
-	// and analysis-to-analysis (horizontal) dependencies.
-	type key struct {
-		*analysis.Analyzer
-		*packages.Package
+	if Progress {
+		opts.Progress = os.Stderr
 	}
-	actions := make(map[key]*action)
-
-	var mkAction func(a *analysis.Analyzer, pkg *packages.Package) *action
-	mkAction = func(a *analysis.Analyzer, pkg *packages.Package) *action {
-		k := key{a, pkg}
-		act, ok := actions[k]
-		if !ok {
-			act = &action{a: a, pkg: pkg}
-
-			// Add a dependency on each required analyzers.
-			for _, req := range a.Requires {
-				act.deps = append(act.deps, mkAction(req, pkg))
-			}
+	if dbg('p') {
+		opts.Concurrency = 1
+	}
+	return checker.Run(pkgs, analyzers, opts).Roots
+}
 
-			// An analysis that consumes/produces facts
-			// must run on the package's dependencies too.
-			if len(a.FactTypes) > 0 {
-				paths := make([]string, 0, len(pkg.Imports))
-				for path := range pkg.Imports {
-					paths = append(paths, path)
-				}
-				sort.Strings(paths) // for determinism
-				for _, path := range paths {
-					dep := mkAction(a, pkg.Imports[path])
-					act.deps = append(act.deps, dep)
-				}
-			}
+// slowest is the number of actions in the summary of -progress.
+const slowest = 10
 
-			actions[k] = act
+// printTiming prints the time spent in each action, the longest first,
+// or in the max longest if max is nonzero, and the total time of all
+// actions, from the wall time of the analysis.
+func printTiming(roots []*action, wall time.Duration, max int) {
+	if !dbg('p') && Concurrency != 1 {
+		log.Println("Warning: times are mostly GC/scheduler noise; use -concurrency=1 to disable parallelism")
+	}
+	var all []*action
+	seen := make(map[*action]bool)
+	var visitAll func(actions []*action)
+	visitAll = func(actions []*action) {
+		for _, act := range actions {
+			if !seen[act] {
+				seen[act] = true
+				all = append(all, act)
+				visitAll(act.Deps)
+			}
 		}
-		return act
 	}
+	visitAll(roots)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Duration > all[j].Duration
+	})
 
-	// Build nodes for initial packages.
-	var roots []*action
-	for _, a := range analyzers {
-		for _, pkg := range pkgs {
-			root := mkAction(a, pkg)
-			root.isroot = true
-			roots = append(roots, root)
+	if max > 0 {
+		fmt.Fprintf(os.Stderr, "slowest actions:\n")
+	}
+	var total time.Duration
+	for i, act := range all {
+		if max == 0 || i < max {
+			fmt.Fprintf(os.Stderr, "%s\t%s\n", act.Duration, act)
 		}
+		total += act.Duration
 	}
-
-	// Execute the graph in parallel.
-	execAll(roots)
-
-	return roots
+	fmt.Fprintf(os.Stderr, "%s\t%d actions, in %s\n", total, len(all), wall)
 }
 
-func applyFixes(roots []*action) {
-	visited := make(map[*action]bool)
-	var apply func(*action) error
-	var visitAll func(actions []*action) error
-	visitAll = func(actions []*action) error {
-		for _, act := range actions {
-			if !visited[act] {
-				visited[act] = true
-				visitAll(act.deps)
-				if err := apply(act); err != nil {
-					return err
-				}
-			}
-		}
-		return nil
-	}
+type TestAnalyzerResult struct {
+	Pass        *analysis.Pass
+	Diagnostics []analysis.Diagnostic
+	Facts       map[types.Object][]analysis.Fact
+	Result      interface{}
+	Err         error
+}
 
-	// TODO(matloob): Is this tree business too complicated? (After all this is Go!)
-	// Just create a set (map) of edits, sort by pos and call it a day?
+// applyFixes applies the suggested fixes of the diagnostics of the root
+// actions to their files, and reports whether all of them were applied.
+//
+// The edits of a fix are applied together, or not at all: a fix is skipped
+// if one of its edits is malformed, is not in a file of the package, or
+// overlaps an edit of another fix. The fixes of a file are not applied if
+// the fixed file does not parse. A fixed file is formatted if the original
+// file was.
+//
+// If Diff is set, the files are left as they are and the changes are printed
+// to stdout as a unified diff, in the order of the file names, which can be
+// applied with "patch -p0".
+func applyFixes(roots []*action) bool {
 	type offsetedit struct {
 		start, end int
 		newText    []byte
 	} // TextEdit using byteOffsets instead of pos
-	type node struct {
-		edit        offsetedit
-		left, right *node
+	overlap := func(x, y offsetedit) bool {
+		// Two insertions at the same offset overlap too, as their order
+		// is undefined.
+		return x.start < y.end && y.start < x.end || x.start == y.start && (x.start == x.end || y.start == y.end)
 	}
 
-	var insert func(tree **node, edit offsetedit) error
-	insert = func(treeptr **node, edit offsetedit) error {
-		if *treeptr == nil {
-			*treeptr = &node{edit, nil, nil}
-			return nil
+	ok := true
+	editsForFile := make(map[*token.File][]offsetedit)
+	for _, act := range roots {
+		files := make(map[string]bool)
+		for _, name := range act.Package.CompiledGoFiles {
+			files[name] = true
 		}
-		tree := *treeptr
-		if edit.end <= tree.edit.start {
-			return insert(&tree.left, edit)
-		} else if edit.start >= tree.edit.end {
-			return insert(&tree.right, edit)
-		}
-
-		// Overlapping text edit.
-		return fmt.Errorf("analyses applying overlapping text edits affecting pos range (%v, %v) and (%v, %v)",
-			edit.start, edit.end, tree.edit.start, tree.edit.end)
-
-	}
-
-	editsForFile := make(map[*token.File]*node)
-
-	apply = func(act *action) error {
-		for _, diag := range act.diagnostics {
+	fixes:
+		for _, diag := range act.Diagnostics {
 			for _, sf := range diag.SuggestedFixes {
+				skip := func(format string, args ...interface{}) {
+					log.Printf("%s: not applying fix %q of analysis %s: %s",
+						act.Package.Fset.Position(diag.Pos), sf.Message, act.Analyzer.Name, fmt.Sprintf(format, args...))
+					ok = false
+				}
+				type fileedit struct {
+					file *token.File
+					offsetedit
+				}
+				var edits []fileedit
+			edits:
 				for _, edit := range sf.TextEdits {
 					// Validate the edit.
 					if edit.Pos > edit.End {
-						return fmt.Errorf(
-							"diagnostic for analysis %v contains Suggested Fix with malformed edit: pos (%v) > end (%v)",
-							act.a.Name, edit.Pos, edit.End)
+						skip("malformed edit: pos (%v) > end (%v)", edit.Pos, edit.End)
+						continue fixes
 					}
-					file, endfile := act.pkg.Fset.File(edit.Pos), act.pkg.Fset.File(edit.End)
-					if file == nil || endfile == nil || file != endfile {
-						return (fmt.Errorf(
-							"diagnostic for analysis %v contains Suggested Fix with malformed spanning files %v and %v",
-							act.a.Name, file.Name(), endfile.Name()))
+					file := act.Package.Fset.File(edit.Pos)
+					if file == nil || edit.End > token.Pos(file.Base()+file.Size()) {
+						skip("edit is not within the bounds of a file")
+						continue fixes
 					}
-					start, end := file.Offset(edit.Pos), file.Offset(edit.End)
-
-					// TODO(matloob): Validate that edits do not affect other packages.
-					root := editsForFile[file]
-					if err := insert(&root, offsetedit{start, end, edit.NewText}); err != nil {
-						return err
+					if !files[file.Name()] {
+						skip("edit of %s, which is not a file of package %s", file.Name(), act.Package.ID)
+						continue fixes
+					}
+					e := offsetedit{file.Offset(edit.Pos), file.Offset(edit.End), edit.NewText}
+					for _, other := range editsForFile[file] {
+						if other.start == e.start && other.end == e.end && bytes.Equal(other.newText, e.newText) {
+							// The same fix is suggested in each variant of a package.
+							continue edits
+						}
+						if overlap(e, other) {
+							skip("overlapping edits of %s at offsets (%v, %v) and (%v, %v)", file.Name(), e.start, e.end, other.start, other.end)
+							continue fixes
+						}
 					}
-					editsForFile[file] = root // In case the root changed
+					for _, other := range edits {
+						if other.file == file && overlap(e, other.offsetedit) {
+							skip("overlapping edits of %s at offsets (%v, %v) and (%v, %v)", file.Name(), e.start, e.end, other.start, other.end)
+							continue fixes
+						}
+					}
+					edits = append(edits, fileedit{file, e})
+				}
+				for _, e := range edits {
+					editsForFile[e.file] = append(editsForFile[e.file], e.offsetedit)
 				}
 			}
 		}
-		return nil
 	}
 
-	visitAll(roots)
+	var files []*token.File
+	for f := range editsForFile {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
 
 	fset := token.NewFileSet() // Shared by parse calls below
 	// Now we've got a set of valid edits for each file. Get the new file contents.
-	for f, tree := range editsForFile {
+	for _, f := range files {
+		edits := editsForFile[f]
 		contents, err := ioutil.ReadFile(f.Name())
 		if err != nil {
-			log.Fatal(err)
+			log.Print(err)
+			ok = false
+			continue
+		}
+		if len(contents) != f.Size() {
+			log.Printf("%s: not applying fixes: the file has changed", f.Name())
+			ok = false
+			continue
 		}
 
-		cur := 0 // current position in the file
-
+		sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
 		var out bytes.Buffer
-
-		var recurse func(*node)
-		recurse = func(node *node) {
-			if node.left != nil {
-				recurse(node.left)
-			}
-
-			edit := node.edit
-			if edit.start > cur {
-				out.Write(contents[cur:edit.start])
-				out.Write(edit.newText)
-			}
+		cur := 0 // current position in the file
+		for _, edit := range edits {
+			out.Write(contents[cur:edit.start])
+			out.Write(edit.newText)
 			cur = edit.end
-
-			if node.right != nil {
-				recurse(node.right)
-			}
 		}
-		recurse(tree)
 		// Write out the rest of the file.
-		if cur < len(contents) {
-			out.Write(contents[cur:])
-		}
+		out.Write(contents[cur:])
 
-		// Try to format the file.
 		ff, err := parser.ParseFile(fset, f.Name(), out.Bytes(), parser.ParseComments)
-		if err == nil {
+		if err != nil {
+			log.Printf("%s: not applying fixes, as the fixed file would not parse: %v", f.Name(), err)
+			ok = false
+			continue
+		}
+		// Format the file, unless it was not formatted before.
+		if formatted, err := format.Source(contents); err == nil && bytes.Equal(formatted, contents) {
 			var buf bytes.Buffer
-			if err = format.Node(&buf, fset, ff); err == nil {
+			if err := format.Node(&buf, fset, ff); err == nil {
 				out = buf
 			}
 		}
 
-		ioutil.WriteFile(f.Name(), out.Bytes(), 0644)
+		if Diff {
+			printDiff(f.Name(), string(contents), out.String())
+			continue
+		}
+		if err := ioutil.WriteFile(f.Name(), out.Bytes(), 0644); err != nil {
+			log.Print(err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// printDiff prints to stdout the unified diff of the changes of the file
+// filename from before to after. The file is named relative to the current
+// directory, if it is below it.
+func printDiff(filename, before, after string) {
+	name := filename
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, filename); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
 	}
+	edits := myers.ComputeEdits(span.FileURI(filename), before, after)
+	fmt.Print(diff.ToUnified(name, name, before, edits))
 }
 
 // printDiagnostics prints the diagnostics for the root packages in either
-// plain text or JSON format. JSON format also includes errors for any
-// dependencies.
+// plain text, JSON or SARIF format. JSON and SARIF formats also include
+// errors for any dependencies.
 //
 // It returns the exitcode: in plain mode, 0 for success, 1 for analysis
 // errors, and 3 for diagnostics. We avoid 2 since the flag package uses
-// it. JSON mode always succeeds at printing errors and diagnostics in a
-// structured form to stdout.
+// it. JSON and SARIF modes always succeed at printing errors and diagnostics
+// in a structured form to stdout.
 func printDiagnostics(roots []*action) (exitcode int) {
 	// Print the output.
 	//
@@ -411,7 +553,7 @@ func printDiagnostics(roots []*action) (exitcode int) {
 		for _, act := range actions {
 			if !printed[act] {
 				printed[act] = true
-				visitAll(act.deps)
+				visitAll(act.Deps)
 				print(act)
 			}
 		}
@@ -422,13 +564,29 @@ func printDiagnostics(roots []*action) (exitcode int) {
 		tree := make(analysisflags.JSONTree)
 		print = func(act *action) {
 			var diags []analysis.Diagnostic
-			if act.isroot {
-				diags = act.diagnostics
+			if act.IsRoot {
+				diags = act.Diagnostics
 			}
-			tree.Add(act.pkg.Fset, act.pkg.ID, act.a.Name, diags, act.err)
+			tree.Add(act.Package.Fset, act.Package.ID, act.Analyzer.Name, diags, act.Err)
 		}
 		visitAll(roots)
 		tree.Print()
+	} else if analysisflags.SARIF {
+		// SARIF output
+		var analyzers []*analysis.Analyzer
+		for _, act := range roots {
+			analyzers = append(analyzers, act.Analyzer)
+		}
+		sarif := analysisflags.NewSARIFLog(analyzers)
+		print = func(act *action) {
+			var diags []analysis.Diagnostic
+			if act.IsRoot {
+				diags = act.Diagnostics
+			}
+			sarif.Add(act.Package.Fset, act.Package.ID, act.Analyzer, diags, act.Err)
+		}
+		visitAll(roots)
+		sarif.Print()
 	} else {
 		// plain text output
 
@@ -443,427 +601,57 @@ func printDiagnostics(roots []*action) (exitcode int) {
 		}
 		seen := make(map[key]bool)
 
+		// Diagnostics are printed once all actions have been visited,
+		// sorted by position, unless -unsorted is set.
+		var diags []analysisflags.AnalyzerDiagnostic
+		var fset *token.FileSet
+
 		print = func(act *action) {
-			if act.err != nil {
-				fmt.Fprintf(os.Stderr, "%s: %v\n", act.a.Name, act.err)
+			if act.Err == checker.ErrSkipped && BestEffort {
+				if act.IsRoot {
+					fmt.Fprintf(os.Stderr, "note: %s: %s skipped due to errors in package\n", act.Package.ID, act.Analyzer.Name)
+				}
+				return
+			}
+			if act.Err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", act.Analyzer.Name, act.Err)
 				exitcode = 1 // analysis failed, at least partially
 				return
 			}
-			if act.isroot {
-				for _, diag := range act.diagnostics {
+			if act.IsRoot {
+				for _, diag := range act.Diagnostics {
 					// We don't display a.Name/f.Category
 					// as most users don't care.
 
-					posn := act.pkg.Fset.Position(diag.Pos)
-					end := act.pkg.Fset.Position(diag.End)
-					k := key{posn, end, act.a, diag.Message}
+					posn := act.Package.Fset.Position(diag.Pos)
+					end := act.Package.Fset.Position(diag.End)
+					k := key{posn, end, act.Analyzer, diag.Message}
 					if seen[k] {
 						continue // duplicate
 					}
 					seen[k] = true
 
-					analysisflags.PrintPlain(act.pkg.Fset, diag)
+					if analysisflags.Unsorted {
+						analysisflags.PrintPlain(act.Package.Fset, diag)
+						continue
+					}
+					fset = act.Package.Fset
+					diags = append(diags, analysisflags.AnalyzerDiagnostic{Analyzer: act.Analyzer, Diagnostic: diag})
 				}
 			}
 		}
 		visitAll(roots)
+		analysisflags.SortDiagnostics(fset, diags)
+		for _, diag := range diags {
+			analysisflags.PrintPlain(fset, diag.Diagnostic)
+		}
 
 		if exitcode == 0 && len(seen) > 0 {
 			exitcode = 3 // successfully produced diagnostics
 		}
 	}
 
-	// Print timing info.
-	if dbg('t') {
-		if !dbg('p') {
-			log.Println("Warning: times are mostly GC/scheduler noise; use -debug=tp to disable parallelism")
-		}
-		var all []*action
-		var total time.Duration
-		for act := range printed {
-			all = append(all, act)
-			total += act.duration
-		}
-		sort.Slice(all, func(i, j int) bool {
-			return all[i].duration > all[j].duration
-		})
-
-		// Print actions accounting for 90% of the total.
-		var sum time.Duration
-		for _, act := range all {
-			fmt.Fprintf(os.Stderr, "%s\t%s\n", act.duration, act)
-			sum += act.duration
-			if sum >= total*9/10 {
-				break
-			}
-		}
-	}
-
 	return exitcode
 }
 
-// needFacts reports whether any analysis required by the specified set
-// needs facts.  If so, we must load the entire program from source.
-func needFacts(analyzers []*analysis.Analyzer) bool {
-	seen := make(map[*analysis.Analyzer]bool)
-	var q []*analysis.Analyzer // for BFS
-	q = append(q, analyzers...)
-	for len(q) > 0 {
-		a := q[0]
-		q = q[1:]
-		if !seen[a] {
-			seen[a] = true
-			if len(a.FactTypes) > 0 {
-				return true
-			}
-			q = append(q, a.Requires...)
-		}
-	}
-	return false
-}
-
-// An action represents one unit of analysis work: the application of
-// one analysis to one package. Actions form a DAG, both within a
-// package (as different analyzers are applied, either in sequence or
-// parallel), and across packages (as dependencies are analyzed).
-type action struct {
-	once         sync.Once
-	a            *analysis.Analyzer
-	pkg          *packages.Package
-	pass         *analysis.Pass
-	isroot       bool
-	deps         []*action
-	objectFacts  map[objectFactKey]analysis.Fact
-	packageFacts map[packageFactKey]analysis.Fact
-	inputs       map[*analysis.Analyzer]interface{}
-	result       interface{}
-	diagnostics  []analysis.Diagnostic
-	err          error
-	duration     time.Duration
-}
-
-type objectFactKey struct {
-	obj types.Object
-	typ reflect.Type
-}
-
-type packageFactKey struct {
-	pkg *types.Package
-	typ reflect.Type
-}
-
-func (act *action) String() string {
-	return fmt.Sprintf("%s@%s", act.a, act.pkg)
-}
-
-func execAll(actions []*action) {
-	sequential := dbg('p')
-	var wg sync.WaitGroup
-	for _, act := range actions {
-		wg.Add(1)
-		work := func(act *action) {
-			act.exec()
-			wg.Done()
-		}
-		if sequential {
-			work(act)
-		} else {
-			go work(act)
-		}
-	}
-	wg.Wait()
-}
-
-func (act *action) exec() { act.once.Do(act.execOnce) }
-
-func (act *action) execOnce() {
-	// Analyze dependencies.
-	execAll(act.deps)
-
-	// TODO(adonovan): uncomment this during profiling.
-	// It won't build pre-go1.11 but conditional compilation
-	// using build tags isn't warranted.
-	//
-	// ctx, task := trace.NewTask(context.Background(), "exec")
-	// trace.Log(ctx, "pass", act.String())
-	// defer task.End()
-
-	// Record time spent in this node but not its dependencies.
-	// In parallel mode, due to GC/scheduler contention, the
-	// time is 5x higher than in sequential mode, even with a
-	// semaphore limiting the number of threads here.
-	// So use -debug=tp.
-	if dbg('t') {
-		t0 := time.Now()
-		defer func() { act.duration = time.Since(t0) }()
-	}
-
-	// Report an error if any dependency failed.
-	var failed []string
-	for _, dep := range act.deps {
-		if dep.err != nil {
-			failed = append(failed, dep.String())
-		}
-	}
-	if failed != nil {
-		sort.Strings(failed)
-		act.err = fmt.Errorf("failed prerequisites: %s", strings.Join(failed, ", "))
-		return
-	}
-
-	// Plumb the output values of the dependencies
-	// into the inputs of this action.  Also facts.
-	inputs := make(map[*analysis.Analyzer]interface{})
-	act.objectFacts = make(map[objectFactKey]analysis.Fact)
-	act.packageFacts = make(map[packageFactKey]analysis.Fact)
-	for _, dep := range act.deps {
-		if dep.pkg == act.pkg {
-			// Same package, different analysis (horizontal edge):
-			// in-memory outputs of prerequisite analyzers
-			// become inputs to this analysis pass.
-			inputs[dep.a] = dep.result
-
-		} else if dep.a == act.a { // (always true)
-			// Same analysis, different package (vertical edge):
-			// serialized facts produced by prerequisite analysis
-			// become available to this analysis pass.
-			inheritFacts(act, dep)
-		}
-	}
-
-	// Run the analysis.
-	pass := &analysis.Pass{
-		Analyzer:          act.a,
-		Fset:              act.pkg.Fset,
-		Files:             act.pkg.Syntax,
-		OtherFiles:        act.pkg.OtherFiles,
-		Pkg:               act.pkg.Types,
-		TypesInfo:         act.pkg.TypesInfo,
-		TypesSizes:        act.pkg.TypesSizes,
-		ResultOf:          inputs,
-		Report:            func(d analysis.Diagnostic) { act.diagnostics = append(act.diagnostics, d) },
-		ImportObjectFact:  act.importObjectFact,
-		ExportObjectFact:  act.exportObjectFact,
-		ImportPackageFact: act.importPackageFact,
-		ExportPackageFact: act.exportPackageFact,
-		AllObjectFacts:    act.allObjectFacts,
-		AllPackageFacts:   act.allPackageFacts,
-	}
-	act.pass = pass
-
-	var err error
-	if act.pkg.IllTyped && !pass.Analyzer.RunDespiteErrors {
-		err = fmt.Errorf("analysis skipped due to errors in package")
-	} else {
-		act.result, err = pass.Analyzer.Run(pass)
-		if err == nil {
-			if got, want := reflect.TypeOf(act.result), pass.Analyzer.ResultType; got != want {
-				err = fmt.Errorf(
-					"internal error: on package %s, analyzer %s returned a result of type %v, but declared ResultType %v",
-					pass.Pkg.Path(), pass.Analyzer, got, want)
-			}
-		}
-	}
-	act.err = err
-
-	// disallow calls after Run
-	pass.ExportObjectFact = nil
-	pass.ExportPackageFact = nil
-}
-
-// inheritFacts populates act.facts with
-// those it obtains from its dependency, dep.
-func inheritFacts(act, dep *action) {
-	serialize := dbg('s')
-
-	for key, fact := range dep.objectFacts {
-		// Filter out facts related to objects
-		// that are irrelevant downstream
-		// (equivalently: not in the compiler export data).
-		if !exportedFrom(key.obj, dep.pkg.Types) {
-			if false {
-				log.Printf("%v: discarding %T fact from %s for %s: %s", act, fact, dep, key.obj, fact)
-			}
-			continue
-		}
-
-		// Optionally serialize/deserialize fact
-		// to verify that it works across address spaces.
-		if serialize {
-			encodedFact, err := codeFact(fact)
-			if err != nil {
-				log.Panicf("internal error: encoding of %T fact failed in %v", fact, act)
-			}
-			fact = encodedFact
-		}
-
-		if false {
-			log.Printf("%v: inherited %T fact for %s: %s", act, fact, key.obj, fact)
-		}
-		act.objectFacts[key] = fact
-	}
-
-	for key, fact := range dep.packageFacts {
-		// TODO: filter out facts that belong to
-		// packages not mentioned in the export data
-		// to prevent side channels.
-
-		// Optionally serialize/deserialize fact
-		// to verify that it works across address spaces
-		// and is deterministic.
-		if serialize {
-			encodedFact, err := codeFact(fact)
-			if err != nil {
-				log.Panicf("internal error: encoding of %T fact failed in %v", fact, act)
-			}
-			fact = encodedFact
-		}
-
-		if false {
-			log.Printf("%v: inherited %T fact for %s: %s", act, fact, key.pkg.Path(), fact)
-		}
-		act.packageFacts[key] = fact
-	}
-}
-
-// codeFact encodes then decodes a fact,
-// just to exercise that logic.
-func codeFact(fact analysis.Fact) (analysis.Fact, error) {
-	// We encode facts one at a time.
-	// A real modular driver would emit all facts
-	// into one encoder to improve gob efficiency.
-	var buf bytes.Buffer
-	if err := gob.NewEncoder(&buf).Encode(fact); err != nil {
-		return nil, err
-	}
-
-	// Encode it twice and assert that we get the same bits.
-	// This helps detect nondeterministic Gob encoding (e.g. of maps).
-	var buf2 bytes.Buffer
-	if err := gob.NewEncoder(&buf2).Encode(fact); err != nil {
-		return nil, err
-	}
-	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
-		return nil, fmt.Errorf("encoding of %T fact is nondeterministic", fact)
-	}
-
-	new := reflect.New(reflect.TypeOf(fact).Elem()).Interface().(analysis.Fact)
-	if err := gob.NewDecoder(&buf).Decode(new); err != nil {
-		return nil, err
-	}
-	return new, nil
-}
-
-// exportedFrom reports whether obj may be visible to a package that imports pkg.
-// This includes not just the exported members of pkg, but also unexported
-// constants, types, fields, and methods, perhaps belonging to oether packages,
-// that find there way into the API.
-// This is an overapproximation of the more accurate approach used by
-// gc export data, which walks the type graph, but it's much simpler.
-//
-// TODO(adonovan): do more accurate filtering by walking the type graph.
-func exportedFrom(obj types.Object, pkg *types.Package) bool {
-	switch obj := obj.(type) {
-	case *types.Func:
-		return obj.Exported() && obj.Pkg() == pkg ||
-			obj.Type().(*types.Signature).Recv() != nil
-	case *types.Var:
-		return obj.Exported() && obj.Pkg() == pkg ||
-			obj.IsField()
-	case *types.TypeName, *types.Const:
-		return true
-	}
-	return false // Nil, Builtin, Label, or PkgName
-}
-
-// importObjectFact implements Pass.ImportObjectFact.
-// Given a non-nil pointer ptr of type *T, where *T satisfies Fact,
-// importObjectFact copies the fact value to *ptr.
-func (act *action) importObjectFact(obj types.Object, ptr analysis.Fact) bool {
-	if obj == nil {
-		panic("nil object")
-	}
-	key := objectFactKey{obj, factType(ptr)}
-	if v, ok := act.objectFacts[key]; ok {
-		reflect.ValueOf(ptr).Elem().Set(reflect.ValueOf(v).Elem())
-		return true
-	}
-	return false
-}
-
-// exportObjectFact implements Pass.ExportObjectFact.
-func (act *action) exportObjectFact(obj types.Object, fact analysis.Fact) {
-	if act.pass.ExportObjectFact == nil {
-		log.Panicf("%s: Pass.ExportObjectFact(%s, %T) called after Run", act, obj, fact)
-	}
-
-	if obj.Pkg() != act.pkg.Types {
-		log.Panicf("internal error: in analysis %s of package %s: Fact.Set(%s, %T): can't set facts on objects belonging another package",
-			act.a, act.pkg, obj, fact)
-	}
-
-	key := objectFactKey{obj, factType(fact)}
-	act.objectFacts[key] = fact // clobber any existing entry
-	if dbg('f') {
-		objstr := types.ObjectString(obj, (*types.Package).Name)
-		fmt.Fprintf(os.Stderr, "%s: object %s has fact %s\n",
-			act.pkg.Fset.Position(obj.Pos()), objstr, fact)
-	}
-}
-
-// allObjectFacts implements Pass.AllObjectFacts.
-func (act *action) allObjectFacts() []analysis.ObjectFact {
-	facts := make([]analysis.ObjectFact, 0, len(act.objectFacts))
-	for k := range act.objectFacts {
-		facts = append(facts, analysis.ObjectFact{k.obj, act.objectFacts[k]})
-	}
-	return facts
-}
-
-// importPackageFact implements Pass.ImportPackageFact.
-// Given a non-nil pointer ptr of type *T, where *T satisfies Fact,
-// fact copies the fact value to *ptr.
-func (act *action) importPackageFact(pkg *types.Package, ptr analysis.Fact) bool {
-	if pkg == nil {
-		panic("nil package")
-	}
-	key := packageFactKey{pkg, factType(ptr)}
-	if v, ok := act.packageFacts[key]; ok {
-		reflect.ValueOf(ptr).Elem().Set(reflect.ValueOf(v).Elem())
-		return true
-	}
-	return false
-}
-
-// exportPackageFact implements Pass.ExportPackageFact.
-func (act *action) exportPackageFact(fact analysis.Fact) {
-	if act.pass.ExportPackageFact == nil {
-		log.Panicf("%s: Pass.ExportPackageFact(%T) called after Run", act, fact)
-	}
-
-	key := packageFactKey{act.pass.Pkg, factType(fact)}
-	act.packageFacts[key] = fact // clobber any existing entry
-	if dbg('f') {
-		fmt.Fprintf(os.Stderr, "%s: package %s has fact %s\n",
-			act.pkg.Fset.Position(act.pass.Files[0].Pos()), act.pass.Pkg.Path(), fact)
-	}
-}
-
-func factType(fact analysis.Fact) reflect.Type {
-	t := reflect.TypeOf(fact)
-	if t.Kind() != reflect.Ptr {
-		log.Fatalf("invalid Fact type: got %T, want pointer", t)
-	}
-	return t
-}
-
-// allObjectFacts implements Pass.AllObjectFacts.
-func (act *action) allPackageFacts() []analysis.PackageFact {
-	facts := make([]analysis.PackageFact, 0, len(act.packageFacts))
-	for k := range act.packageFacts {
-		facts = append(facts, analysis.PackageFact{k.pkg, act.packageFacts[k]})
-	}
-	return facts
-}
-
 func dbg(b byte) bool { return strings.IndexByte(Debug, b) >= 0 }
@@ -64,6 +64,46 @@ func Foo() {
 	defer cleanup()
 }
 
+func TestBestEffortExitCode(t *testing.T) {
+	testenv.NeedsGoPackages(t)
+
+	files := map[string]string{
+		"besteffort/a.go": `package besteffort
+
+var x int = "not an int"
+
+func bar() {}
+`}
+	testdata, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	defer func(fix, bestEffort bool) { checker.Fix, checker.BestEffort = fix, bestEffort }(checker.Fix, checker.BestEffort)
+	checker.Fix, checker.BestEffort = false, true
+
+	ran := false
+	a := &analysis.Analyzer{
+		Name:             "ran",
+		Doc:              "reports each package",
+		RunDespiteErrors: true,
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			ran = true
+			pass.Reportf(pass.Files[0].Package, "package %s", pass.Pkg.Name())
+			return nil, nil
+		},
+	}
+	path := filepath.Join(testdata, "src/besteffort/a.go")
+	// The type error is reported with exit code 1, rather than the 3 of
+	// the diagnostic, even though the analysis goes on.
+	if exitcode := checker.Run([]string{"file=" + path}, []*analysis.Analyzer{a}); exitcode != 1 {
+		t.Errorf("got exit code %d, want 1", exitcode)
+	}
+	if !ran {
+		t.Errorf("the analyzer did not run despite -besteffort")
+	}
+}
+
 var analyzer = &analysis.Analyzer{
 	Name:     "rename",
 	Requires: []*analysis.Analyzer{inspect.Analyzer},
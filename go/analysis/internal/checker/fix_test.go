@@ -0,0 +1,160 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checker
+
+import (
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/packages"
+)
+
+func TestApplyFixesValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.go": "package a\n\nvar x = 1\n",
+		"b.go": "package a\n\nvar y = 2\n",
+		"c.go": "package a\n\nvar   z = 3\n", // not formatted
+	}
+	fset := token.NewFileSet()
+	tfiles := make(map[string]*token.File)
+	var names []string
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tfiles[name] = fset.AddFile(filename, -1, len(content))
+		names = append(names, filename)
+	}
+	other := fset.AddFile(filepath.Join(dir, "other.go"), -1, 10)
+
+	edit := func(name string, start, end int, text string) analysis.TextEdit {
+		f := tfiles[name]
+		return analysis.TextEdit{Pos: f.Pos(start), End: f.Pos(end), NewText: []byte(text)}
+	}
+	fix := func(edits ...analysis.TextEdit) analysis.Diagnostic {
+		return analysis.Diagnostic{
+			Pos:            edits[0].Pos,
+			SuggestedFixes: []analysis.SuggestedFix{{Message: "fix", TextEdits: edits}},
+		}
+	}
+	valueA := strings.Index(files["a.go"], "1")
+	valueC := strings.Index(files["c.go"], "3")
+	diags := []analysis.Diagnostic{
+		// Inserts a declaration at the start of the file, reformatted.
+		fix(edit("a.go", 0, 0, "// Package a is a.\n"), edit("a.go", valueA, valueA+1, "10")),
+		// Overlaps the previous fix: skipped entirely.
+		fix(edit("a.go", len(files["a.go"]), len(files["a.go"]), "var w = 0\n"), edit("a.go", valueA, valueA+1, "11")),
+		// Out of the bounds of the file.
+		{Pos: tfiles["a.go"].Pos(0), SuggestedFixes: []analysis.SuggestedFix{{TextEdits: []analysis.TextEdit{
+			{Pos: tfiles["a.go"].Pos(0), End: tfiles["a.go"].Pos(0) + token.Pos(len(files["a.go"])+1)},
+		}}}},
+		// Not in a file of the package.
+		{Pos: other.Pos(0), SuggestedFixes: []analysis.SuggestedFix{{TextEdits: []analysis.TextEdit{
+			{Pos: other.Pos(0), End: other.Pos(1)},
+		}}}},
+		// The fixed file does not parse.
+		fix(edit("b.go", 0, len("package"), "pkg")),
+		// Not reformatted, as the file was not formatted.
+		fix(edit("c.go", valueC, valueC+1, "30")),
+	}
+	pkg := &packages.Package{ID: "a", Fset: fset, CompiledGoFiles: names}
+	a := &analysis.Analyzer{Name: "a"}
+	roots := []*action{
+		// A package and its test variant, which suggest the same fixes.
+		{Analyzer: a, Package: pkg, IsRoot: true, Diagnostics: diags},
+		{Analyzer: a, Package: pkg, IsRoot: true, Diagnostics: diags},
+	}
+
+	if applyFixes(roots) {
+		t.Errorf("applyFixes reported that all fixes were applied")
+	}
+	want := map[string]string{
+		"a.go": "// Package a is a.\npackage a\n\nvar x = 10\n",
+		"b.go": files["b.go"],
+		"c.go": "package a\n\nvar   z = 30\n",
+	}
+	for name, want := range want {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyFixesDiff(t *testing.T) {
+	defer func(diff bool) { Diff = diff }(Diff)
+	Diff = true
+
+	dir, err := ioutil.TempDir("", "fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const content = "package a\n\nvar x = 1\n"
+	filename := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f := fset.AddFile(filename, -1, len(content))
+	value := f.Pos(strings.Index(content, "1"))
+	diags := []analysis.Diagnostic{{
+		Pos: value,
+		SuggestedFixes: []analysis.SuggestedFix{{Message: "fix", TextEdits: []analysis.TextEdit{
+			{Pos: value, End: value + 1, NewText: []byte("10")},
+		}}},
+	}}
+	pkg := &packages.Package{ID: "a", Fset: fset, CompiledGoFiles: []string{filename}}
+	roots := []*action{{Analyzer: &analysis.Analyzer{Name: "a"}, Package: pkg, IsRoot: true, Diagnostics: diags}}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+	os.Stdout = w
+	ok := applyFixes(roots)
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("applyFixes reported that some fixes were not applied")
+	}
+
+	want := "--- a.go\n+++ a.go\n@@ -1,3 +1,3 @@\n package a\n \n-var x = 1\n+var x = 10\n"
+	if string(out) != want {
+		t.Errorf("got diff\n%s\nwant\n%s", out, want)
+	}
+	if got, err := ioutil.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if string(got) != content {
+		t.Errorf("got %q, want the file unchanged", got)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checker
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/packages"
+)
+
+// A suppression is a comment that suppresses the diagnostics of some
+// analyzers, or of all of them, on a line:
+//
+//	//lint:ignore analyzer[,analyzer...] reason
+//	//nolint[:analyzer[,analyzer...]]
+//
+// A suppression at the end of a line covers that line, and one on a line of
+// its own covers the next line.
+type suppression struct {
+	pos       token.Pos
+	line      int      // the line covered
+	analyzers []string // nil for all of them
+	used      bool
+}
+
+// covers reports whether s suppresses the diagnostics of analyzer a.
+func (s *suppression) covers(a *analysis.Analyzer) bool {
+	if s.analyzers == nil {
+		return true
+	}
+	for _, name := range s.analyzers {
+		if name == a.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSuppression parses the text of a comment, and reports whether it is
+// a suppression and of which analyzers, or nil for all of them.
+func parseSuppression(text string) (analyzers []string, ok bool) {
+	if strings.HasPrefix(text, "//lint:ignore ") {
+		// The reason is required.
+		fields := strings.Fields(strings.TrimPrefix(text, "//lint:ignore "))
+		if len(fields) < 2 {
+			return nil, false
+		}
+		return strings.Split(fields[0], ","), true
+	}
+	if strings.HasPrefix(text, "//nolint") {
+		rest := strings.TrimPrefix(text, "//nolint")
+		switch {
+		case rest == "" || rest[0] == ' ' || rest[0] == '\t':
+			return nil, true
+		case rest[0] == ':':
+			names := strings.Fields(rest[1:])
+			if len(names) == 0 {
+				return nil, false
+			}
+			return strings.Split(names[0], ","), true
+		}
+	}
+	return nil, false
+}
+
+// applySuppressions removes the diagnostics of the root actions that are
+// covered by suppression comments. If SuppressUnused is set, it reports the
+// suppressions of the analyzers that were run that suppress no diagnostic,
+// as diagnostics of these analyzers.
+func applySuppressions(roots []*action) {
+	// The suppressions of each file, which may be in several packages,
+	// such as foo and foo.test.
+	suppressions := make(map[string][]*suppression)
+	lines := make(lineReader)
+	for _, act := range roots {
+		for _, f := range act.Package.Syntax {
+			filename := act.Package.Fset.File(f.Pos()).Name()
+			if _, ok := suppressions[filename]; ok {
+				continue
+			}
+			suppressions[filename] = fileSuppressions(act.Package.Fset, f, lines)
+		}
+	}
+
+	for _, act := range roots {
+		var diags []analysis.Diagnostic
+	diags:
+		for _, diag := range act.Diagnostics {
+			posn := act.Package.Fset.Position(diag.Pos)
+			for _, s := range suppressions[posn.Filename] {
+				if s.line == posn.Line && s.covers(act.Analyzer) {
+					s.used = true
+					continue diags
+				}
+			}
+			diags = append(diags, diag)
+		}
+		act.Diagnostics = diags
+	}
+
+	if !SuppressUnused {
+		return
+	}
+	var filenames []string
+	for filename := range suppressions {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+	suppressions:
+		for _, s := range suppressions[filename] {
+			if s.used {
+				continue
+			}
+			// Report it with the first analyzer that it covers among
+			// those run on a package of the file.
+			for _, act := range roots {
+				if act.Err == nil && s.covers(act.Analyzer) && hasFile(act.Package, filename) {
+					act.Diagnostics = append(act.Diagnostics, analysis.Diagnostic{
+						Pos:     s.pos,
+						Message: "suppression comment suppresses no diagnostic",
+					})
+					continue suppressions
+				}
+			}
+		}
+	}
+}
+
+// fileSuppressions returns the suppressions in the comments of file f.
+func fileSuppressions(fset *token.FileSet, f *ast.File, lines lineReader) []*suppression {
+	var suppressions []*suppression
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			analyzers, ok := parseSuppression(c.Text)
+			if !ok {
+				continue
+			}
+			posn := fset.Position(c.Slash)
+			line := posn.Line
+			if text := lines.line(posn); posn.Column-1 <= len(text) && strings.TrimSpace(string(text[:posn.Column-1])) == "" {
+				line++ // on a line of its own
+			}
+			suppressions = append(suppressions, &suppression{pos: c.Slash, line: line, analyzers: analyzers})
+		}
+	}
+	return suppressions
+}
+
+// hasFile reports whether filename is a file of pkg.
+func hasFile(pkg *packages.Package, filename string) bool {
+	for _, name := range pkg.CompiledGoFiles {
+		if name == filename {
+			return true
+		}
+	}
+	return false
+}
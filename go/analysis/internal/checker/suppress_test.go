@@ -0,0 +1,91 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checker
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/packages"
+)
+
+func TestSuppressions(t *testing.T) {
+	defer func(unused bool) { SuppressUnused = unused }(SuppressUnused)
+	SuppressUnused = true
+
+	dir, err := ioutil.TempDir("", "suppress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const content = `package p
+
+var a = 1 //nolint:a
+
+//lint:ignore a,b it is fine
+var b = 2
+
+var c = 3 //lint:ignore a
+
+var d = 4 //nolint
+
+var e = 5 //nolint:c
+
+//nolint:b
+var f = 6
+`
+	filename := filepath.Join(dir, "p.go")
+	if err := ioutil.WriteFile(filename, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, content, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &packages.Package{Fset: fset, Syntax: []*ast.File{file}, CompiledGoFiles: []string{filename}}
+
+	// Analyzer a reports each variable, and b reports the ones of lines 3
+	// and 6.
+	a := &analysis.Analyzer{Name: "a"}
+	b := &analysis.Analyzer{Name: "b"}
+	var adiags, bdiags []analysis.Diagnostic
+	for _, name := range "abcdef" {
+		diag := analysis.Diagnostic{Pos: file.Scope.Lookup(string(name)).Pos(), Message: string(name)}
+		adiags = append(adiags, diag)
+		if name == 'a' || name == 'b' {
+			bdiags = append(bdiags, diag)
+		}
+	}
+	roots := []*action{
+		{Analyzer: a, Package: pkg, IsRoot: true, Diagnostics: adiags},
+		{Analyzer: b, Package: pkg, IsRoot: true, Diagnostics: bdiags},
+	}
+	applySuppressions(roots)
+
+	for i, want := range [][]string{
+		// The //lint:ignore of line 8 has no reason, and the suppression
+		// of c is of an analyzer that was not run.
+		{"8: c", "12: e", "15: f"},
+		{"3: a", "14: suppression comment suppresses no diagnostic"},
+	} {
+		var got []string
+		for _, diag := range roots[i].Diagnostics {
+			got = append(got, fmt.Sprintf("%d: %s", fset.Position(diag.Pos).Line, diag.Message))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got diagnostics %q, want %q", roots[i].Analyzer.Name, strings.Join(got, "; "), strings.Join(want, "; "))
+		}
+	}
+}
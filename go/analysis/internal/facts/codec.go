@@ -0,0 +1,183 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package facts
+
+// This file defines the serial format of facts.
+//
+// The encoding of a set of facts is a header line, which identifies the
+// version of the format and the codec of the rest of the data, followed
+// by the list of the facts encoded by the codec. Each fact records the
+// name of its type, and a hash of the definition of its type, its schema,
+// so that the facts written by an analyzer whose fact types differ from
+// those of the reader are reported as an error rather than silently
+// decoded into the wrong fields.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackie-feng/tools/go/types/objectpath"
+)
+
+// formatVersion is the version of the serial format of facts.
+// It must be incremented by each incompatible change of the format.
+const formatVersion = 2
+
+// magic is the start of the header of encoded facts.
+const magic = "go/analysis facts"
+
+// A Codec encodes and decodes the values of facts, and the lists of
+// encoded facts.
+type Codec struct {
+	Name      string
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+var (
+	// GobCodec encodes facts with encoding/gob. It is the default.
+	GobCodec = &Codec{"gob", gobMarshal, gobUnmarshal}
+
+	// JSONCodec encodes facts with encoding/json, which is readable, and
+	// portable to tools not written in Go, but is limited to the facts
+	// whose types are fully described by their exported fields.
+	JSONCodec = &Codec{"json", json.Marshal, json.Unmarshal}
+)
+
+var codecs = map[string]*Codec{
+	GobCodec.Name:  GobCodec,
+	JSONCodec.Name: JSONCodec,
+}
+
+// CodecByName returns the codec of the specified name, or nil.
+func CodecByName(name string) *Codec { return codecs[name] }
+
+func gobMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gobUnmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// header returns the header line of facts encoded by codec.
+func header(codec *Codec) string {
+	return fmt.Sprintf("%s v%d %s\n", magic, formatVersion, codec.Name)
+}
+
+// parseHeader splits data into its header and the encoded facts, and
+// returns the codec of the facts.
+func parseHeader(data []byte) (*Codec, []byte, error) {
+	i := bytes.IndexByte(data, '\n')
+	if !bytes.HasPrefix(data, []byte(magic+" ")) || i < 0 {
+		return nil, nil, fmt.Errorf("not in a known format; were they written by an older version of the analysis tool?")
+	}
+	var version int
+	var name string
+	if _, err := fmt.Sscanf(string(data[len(magic):i]), " v%d %s", &version, &name); err != nil {
+		return nil, nil, fmt.Errorf("invalid header %q", data[:i])
+	}
+	if version != formatVersion {
+		return nil, nil, fmt.Errorf("written in format v%d by a different version of the analysis tool, want v%d", version, formatVersion)
+	}
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("written with unknown codec %q", name)
+	}
+	return codec, data[i+1:], nil
+}
+
+// An encodedFact is the serial form of a fact.
+type encodedFact struct {
+	PkgPath string          // path of package
+	Object  objectpath.Path // optional path of object relative to package itself
+	Type    string          // name of the type of the fact
+	Schema  string          // hash of the definition of the type of the fact
+	Value   rawValue        // value of the fact, encoded by the codec
+}
+
+// A rawValue is a value encoded by a codec. It is not encoded again by
+// the JSON codec, so that the JSON of the facts remains readable.
+type rawValue []byte
+
+func (v rawValue) MarshalJSON() ([]byte, error) { return v, nil }
+
+func (v *rawValue) UnmarshalJSON(data []byte) error {
+	*v = append((*v)[:0], data...)
+	return nil
+}
+
+// typeName returns the name of the fact type t, a pointer to a named type,
+// qualified by the path of its package.
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + typeName(t.Elem())
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+var schemas sync.Map // map[reflect.Type]string
+
+// schema returns a hash of the definition of the fact type t: its
+// structure, and the names of its fields and of the types they refer to.
+func schema(t reflect.Type) string {
+	if s, ok := schemas.Load(t); ok {
+		return s.(string)
+	}
+	var buf strings.Builder
+	seen := make(map[reflect.Type]bool)
+	var describe func(t reflect.Type)
+	describe = func(t reflect.Type) {
+		if t.Name() != "" {
+			fmt.Fprintf(&buf, "%s.%s", t.PkgPath(), t.Name())
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+			buf.WriteString("=")
+		}
+		switch t.Kind() {
+		case reflect.Ptr:
+			buf.WriteString("*")
+			describe(t.Elem())
+		case reflect.Slice:
+			buf.WriteString("[]")
+			describe(t.Elem())
+		case reflect.Array:
+			fmt.Fprintf(&buf, "[%d]", t.Len())
+			describe(t.Elem())
+		case reflect.Map:
+			buf.WriteString("map[")
+			describe(t.Key())
+			buf.WriteString("]")
+			describe(t.Elem())
+		case reflect.Struct:
+			buf.WriteString("struct{")
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				fmt.Fprintf(&buf, "%s ", f.Name)
+				describe(f.Type)
+				buf.WriteString(";")
+			}
+			buf.WriteString("}")
+		default:
+			buf.WriteString(t.Kind().String())
+		}
+	}
+	describe(t)
+	s := fmt.Sprintf("%x", sha256.Sum256([]byte(buf.String())))[:16]
+	schemas.Store(t, s)
+	return s
+}
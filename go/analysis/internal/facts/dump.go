@@ -0,0 +1,102 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package facts
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/jackie-feng/tools/go/analysis"
+)
+
+// A Dump is the facts about a package and its objects, in a form
+// readable by humans, for debugging analyzers and drivers. All drivers
+// write the same Dump for the same facts, so that the files of Write may
+// be compared.
+type Dump struct {
+	Package string       `json:"package"` // the ID of the package
+	Facts   []DumpedFact `json:"facts"`
+
+	pkg *types.Package
+}
+
+// A DumpedFact is a fact of a Dump.
+type DumpedFact struct {
+	Analyzer string `json:"analyzer,omitempty"`
+	Object   string `json:"object,omitempty"` // the object, or "" for a package fact
+	Type     string `json:"type"`
+	Fact     string `json:"fact"`
+}
+
+// NewDump returns an empty Dump of the package pkg, whose ID is id.
+func NewDump(id string, pkg *types.Package) *Dump {
+	return &Dump{Package: id, Facts: []DumpedFact{}, pkg: pkg}
+}
+
+// Add adds the fact of analyzer about obj, or about the package if obj
+// is nil, to the dump.
+func (d *Dump) Add(analyzer string, obj types.Object, fact analysis.Fact) {
+	f := DumpedFact{
+		Analyzer: analyzer,
+		Type:     fmt.Sprintf("%T", fact),
+		Fact:     fmt.Sprint(fact),
+	}
+	if obj != nil {
+		f.Object = types.ObjectString(obj, types.RelativeTo(d.pkg))
+	}
+	d.Facts = append(d.Facts, f)
+}
+
+// Write writes the dump, as indented JSON with the facts in order, to a
+// file of the directory dir named after the package, creating dir if
+// needed.
+func (d *Dump) Write(dir string) error {
+	sort.Slice(d.Facts, func(i, j int) bool {
+		x, y := d.Facts[i], d.Facts[j]
+		if x.Object != y.Object {
+			return x.Object < y.Object
+		}
+		if x.Analyzer != y.Analyzer {
+			return x.Analyzer < y.Analyzer
+		}
+		return x.Type < y.Type
+	})
+	data, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(DumpFile(dir, d.Package), append(data, '\n'), 0666)
+}
+
+// DumpFile returns the name of the file of the Dump of package id in dir.
+func DumpFile(dir, id string) string {
+	return filepath.Join(dir, url.PathEscape(id)+".json")
+}
+
+// Dump returns the dump of the facts of the set about its package and
+// its objects. Analyzers maps the types of the facts to the names of
+// their analyzers.
+func (s *Set) Dump(id string, analyzers map[reflect.Type]string) *Dump {
+	d := NewDump(id, s.pkg)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, fact := range s.m {
+		if k.pkg != s.pkg {
+			continue
+		}
+		d.Add(analyzers[k.t], k.obj, fact)
+	}
+	return d
+}
@@ -8,8 +8,10 @@
 // analysis.Pass interface for use in analysis drivers such as "go vet"
 // and other build systems.
 //
-// The serial format is unspecified and may change, so the same version
-// of this package must be used for reading and writing serialized facts.
+// The serial format is unspecified and may change, but it is versioned:
+// Decode reports an error, rather than misinterpret them, for the facts
+// written in another version of the format, or by analyzers whose fact
+// types have different definitions.
 //
 // The handling of facts in the analysis system parallels the handling
 // of type information in the compiler: during compilation of package P,
@@ -38,10 +40,8 @@ package facts
 
 import (
 	"bytes"
-	"encoding/gob"
 	"fmt"
 	"go/types"
-	"io/ioutil"
 	"log"
 	"reflect"
 	"sort"
@@ -146,25 +146,26 @@ func (s *Set) AllPackageFacts(filter map[reflect.Type]bool) []analysis.PackageFa
 	return facts
 }
 
-// gobFact is the Gob declaration of a serialized fact.
-type gobFact struct {
-	PkgPath string          // path of package
-	Object  objectpath.Path // optional path of object relative to package itself
-	Fact    analysis.Fact   // type and value of user-defined Fact
-}
-
 // Decode decodes all the facts relevant to the analysis of package pkg.
 // The read function reads serialized fact data from an external source
 // for one of of pkg's direct imports. The empty file is a valid
 // encoding of an empty fact set.
 //
-// It is the caller's responsibility to call gob.Register on all
-// necessary fact types.
-func Decode(pkg *types.Package, read func(packagePath string) ([]byte, error)) (*Set, error) {
+// FactTypes are the types of the facts of the analyzers; the facts of
+// other types are discarded. Decode reports an error if the facts of an
+// import were written in another version of the format, or by analyzers
+// whose definition of one of the fact types differs.
+func Decode(pkg *types.Package, factTypes []analysis.Fact, read func(packagePath string) ([]byte, error)) (*Set, error) {
 	// Compute the import map for this package.
 	// See the package doc comment.
 	packages := importMap(pkg.Imports())
 
+	byName := make(map[string]reflect.Type)
+	for _, f := range factTypes {
+		t := reflect.TypeOf(f)
+		byName[typeName(t)] = t
+	}
+
 	// Read facts from imported packages.
 	// Facts may describe indirectly imported packages, or their objects.
 	m := make(map[key]analysis.Fact) // one big bucket
@@ -177,7 +178,7 @@ func Decode(pkg *types.Package, read func(packagePath string) ([]byte, error)) (
 			}
 		}
 
-		// Read the gob-encoded facts.
+		// Read the encoded facts.
 		data, err := read(imp.Path())
 		if err != nil {
 			return nil, fmt.Errorf("in %s, can't import facts for package %q: %v",
@@ -186,57 +187,81 @@ func Decode(pkg *types.Package, read func(packagePath string) ([]byte, error)) (
 		if len(data) == 0 {
 			continue // no facts
 		}
-		var gobFacts []gobFact
-		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&gobFacts); err != nil {
+		codec, data, err := parseHeader(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding facts for %q: %v", imp.Path(), err)
+		}
+		var encodedFacts []encodedFact
+		if err := codec.Unmarshal(data, &encodedFacts); err != nil {
 			return nil, fmt.Errorf("decoding facts for %q: %v", imp.Path(), err)
 		}
 		if debug {
-			logf("decoded %d facts: %v", len(gobFacts), gobFacts)
+			logf("decoded %d facts", len(encodedFacts))
 		}
 
 		// Parse each one into a key and a Fact.
-		for _, f := range gobFacts {
+		for _, f := range encodedFacts {
+			t, ok := byName[f.Type]
+			if !ok {
+				// Fact of an analyzer that is not run. Skip.
+				logf("no fact type %s; discarding fact", f.Type)
+				continue
+			}
+			if f.Schema != schema(t) {
+				return nil, fmt.Errorf("decoding facts for %q: the definition of fact type %s differs from that of the analyzer that wrote them; were they written by a different version of the analysis tool?",
+					imp.Path(), f.Type)
+			}
 			factPkg := packages[f.PkgPath]
 			if factPkg == nil {
 				// Fact relates to a dependency that was
 				// unused in this translation unit. Skip.
-				logf("no package %q; discarding %v", f.PkgPath, f.Fact)
+				logf("no package %q; discarding %s fact", f.PkgPath, f.Type)
 				continue
 			}
-			key := key{pkg: factPkg, t: reflect.TypeOf(f.Fact)}
+			fact := reflect.New(t.Elem()).Interface().(analysis.Fact)
+			if err := codec.Unmarshal(f.Value, fact); err != nil {
+				return nil, fmt.Errorf("decoding %s fact for %q: %v", f.Type, imp.Path(), err)
+			}
+			key := key{pkg: factPkg, t: t}
 			if f.Object != "" {
 				// object fact
 				obj, err := objectpath.Object(factPkg, f.Object)
 				if err != nil {
 					// (most likely due to unexported object)
 					// TODO(adonovan): audit for other possibilities.
-					logf("no object for path: %v; discarding %s", err, f.Fact)
+					logf("no object for path: %v; discarding %s", err, fact)
 					continue
 				}
 				key.obj = obj
-				logf("read %T fact %s for %v", f.Fact, f.Fact, key.obj)
+				logf("read %T fact %s for %v", fact, fact, key.obj)
 			} else {
 				// package fact
-				logf("read %T fact %s for %v", f.Fact, f.Fact, factPkg)
+				logf("read %T fact %s for %v", fact, fact, factPkg)
 			}
-			m[key] = f.Fact
+			m[key] = fact
 		}
 	}
 
 	return &Set{pkg: pkg, m: m}, nil
 }
 
-// Encode encodes a set of facts to a memory buffer.
+// Encode encodes a set of facts to a memory buffer, with GobCodec.
 //
-// It may fail if one of the Facts could not be gob-encoded, but this is
+// It may fail if one of the Facts could not be encoded, but this is
 // a sign of a bug in an Analyzer.
 func (s *Set) Encode() []byte {
+	return s.EncodeWith(GobCodec)
+}
+
+// EncodeWith encodes a set of facts to a memory buffer, with codec.
+// Decode accepts the facts encoded by any codec.
+func (s *Set) EncodeWith(codec *Codec) []byte {
 
 	// TODO(adonovan): opt: use a more efficient encoding
 	// that avoids repeating PkgPath for each fact.
 
 	// Gather all facts, including those from imported packages.
-	var gobFacts []gobFact
+	var encodedFacts []encodedFact
 
 	s.mu.Lock()
 	for k, fact := range s.m {
@@ -254,49 +279,48 @@ func (s *Set) Encode() []byte {
 			}
 			object = path
 		}
-		gobFacts = append(gobFacts, gobFact{
+		value, err := codec.Marshal(fact)
+		if err != nil {
+			// Fact encoding should never fail. Identify the culprit.
+			pkgpath := reflect.TypeOf(fact).Elem().PkgPath()
+			log.Panicf("internal error: %s encoding of analysis fact %s failed: %v; please report a bug against fact %T in package %q",
+				codec.Name, fact, err, fact, pkgpath)
+		}
+		encodedFacts = append(encodedFacts, encodedFact{
 			PkgPath: k.pkg.Path(),
 			Object:  object,
-			Fact:    fact,
+			Type:    typeName(k.t),
+			Schema:  schema(k.t),
+			Value:   value,
 		})
 	}
 	s.mu.Unlock()
 
 	// Sort facts by (package, object, type) for determinism.
-	sort.Slice(gobFacts, func(i, j int) bool {
-		x, y := gobFacts[i], gobFacts[j]
+	sort.Slice(encodedFacts, func(i, j int) bool {
+		x, y := encodedFacts[i], encodedFacts[j]
 		if x.PkgPath != y.PkgPath {
 			return x.PkgPath < y.PkgPath
 		}
 		if x.Object != y.Object {
 			return x.Object < y.Object
 		}
-		tx := reflect.TypeOf(x.Fact)
-		ty := reflect.TypeOf(y.Fact)
-		if tx != ty {
-			return tx.String() < ty.String()
-		}
-		return false // equal
+		return x.Type < y.Type
 	})
 
 	var buf bytes.Buffer
-	if len(gobFacts) > 0 {
-		if err := gob.NewEncoder(&buf).Encode(gobFacts); err != nil {
-			// Fact encoding should never fail. Identify the culprit.
-			for _, gf := range gobFacts {
-				if err := gob.NewEncoder(ioutil.Discard).Encode(gf); err != nil {
-					fact := gf.Fact
-					pkgpath := reflect.TypeOf(fact).Elem().PkgPath()
-					log.Panicf("internal error: gob encoding of analysis fact %s failed: %v; please report a bug against fact %T in package %q",
-						fact, err, fact, pkgpath)
-				}
-			}
+	if len(encodedFacts) > 0 {
+		data, err := codec.Marshal(encodedFacts)
+		if err != nil {
+			log.Panicf("internal error: %s encoding of analysis facts failed: %v", codec.Name, err)
 		}
+		buf.WriteString(header(codec))
+		buf.Write(data)
 	}
 
 	if debug {
 		log.Printf("package %q: encode %d facts, %d bytes\n",
-			s.pkg.Path(), len(gobFacts), buf.Len())
+			s.pkg.Path(), len(encodedFacts), buf.Len())
 	}
 
 	return buf.Bytes()
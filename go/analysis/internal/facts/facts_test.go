@@ -5,14 +5,17 @@
 package facts_test
 
 import (
-	"encoding/gob"
+	"bytes"
 	"fmt"
 	"go/token"
 	"go/types"
 	"os"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/jackie-feng/tools/go/analysis"
 	"github.com/jackie-feng/tools/go/analysis/analysistest"
 	"github.com/jackie-feng/tools/go/analysis/internal/facts"
 	"github.com/jackie-feng/tools/go/packages"
@@ -26,9 +29,15 @@ type myFact struct {
 func (f *myFact) String() string { return fmt.Sprintf("myFact(%s)", f.S) }
 func (f *myFact) AFact()         {}
 
+var factTypes = []analysis.Fact{new(myFact)}
+
 func TestEncodeDecode(t *testing.T) {
-	gob.Register(new(myFact))
+	for _, codec := range []*facts.Codec{facts.GobCodec, facts.JSONCodec} {
+		t.Run(codec.Name, func(t *testing.T) { testEncodeDecode(t, codec) })
+	}
+}
 
+func testEncodeDecode(t *testing.T, codec *facts.Codec) {
 	// c -> b -> a, a2
 	// c does not directly depend on a, but it indirectly uses a.T.
 	//
@@ -95,7 +104,7 @@ func TestEncodeDecode(t *testing.T) {
 		}
 
 		// decode
-		facts, err := facts.Decode(pkg, read)
+		facts, err := facts.Decode(pkg, factTypes, read)
 		if err != nil {
 			t.Fatalf("Decode failed: %v", err)
 		}
@@ -131,7 +140,7 @@ func TestEncodeDecode(t *testing.T) {
 		}
 
 		// encode
-		factmap[pkg.Path()] = facts.Encode()
+		factmap[pkg.Path()] = facts.EncodeWith(codec)
 	}
 }
 
@@ -199,7 +208,7 @@ func TestFactFilter(t *testing.T) {
 	}
 
 	obj := pkg.Scope().Lookup("A")
-	s, err := facts.Decode(pkg, func(string) ([]byte, error) { return nil, nil })
+	s, err := facts.Decode(pkg, factTypes, func(string) ([]byte, error) { return nil, nil })
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -224,3 +233,57 @@ func TestFactFilter(t *testing.T) {
 		t.Errorf("AllObjectFacts: got %v, want %v", got, wantObjFacts)
 	}
 }
+
+func TestDecodeMismatch(t *testing.T) {
+	files := map[string]string{
+		"a/a.go": `package a; type A int`,
+	}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	a, err := load(t, dir, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := types.NewPackage("b", "b")
+	b.SetImports([]*types.Package{a})
+
+	s, err := facts.Decode(a, factTypes, func(string) ([]byte, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ExportObjectFact(a.Scope().Lookup("A"), &myFact{"a.A"})
+	data := s.EncodeWith(facts.JSONCodec)
+
+	got, err := facts.Decode(b, factTypes, func(string) ([]byte, error) { return data, nil })
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if fact := new(myFact); !got.ImportObjectFact(a.Scope().Lookup("A"), fact) || fact.S != "a.A" {
+		t.Errorf("ImportObjectFact(a.A) = %v, want myFact(a.A)", fact)
+	}
+
+	// Facts of a type not run by the reader are discarded.
+	if _, err := facts.Decode(b, nil, func(string) ([]byte, error) { return data, nil }); err != nil {
+		t.Errorf("Decode with no fact types failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"gob", []byte("\x0f\xff\x81"), "not in a known format"},
+		{"version", bytes.Replace(data, []byte(" v2 "), []byte(" v1 "), 1), "written in format v1"},
+		{"codec", bytes.Replace(data, []byte(" json\n"), []byte(" xml\n"), 1), `unknown codec "xml"`},
+		{"schema", regexp.MustCompile(`"Schema":"\w+"`).ReplaceAll(data, []byte(`"Schema":"0"`)), "definition of fact type"},
+	} {
+		_, err := facts.Decode(b, factTypes, func(string) ([]byte, error) { return test.data, nil })
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: Decode returned error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
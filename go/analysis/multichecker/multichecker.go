@@ -5,6 +5,12 @@
 // Package multichecker defines the main function for an analysis driver
 // with several analyzers. This package makes it easy for anyone to build
 // an analysis tool containing just the analyzers they need.
+//
+// The driver reads the analyzers to enable or disable, flags, and files
+// whose diagnostics are not reported, from the nearest .vet.json file in
+// the current directory or its parents, if any. The command line takes
+// precedence over it. The configuration file is JSON; YAML configuration
+// files are not supported.
 package multichecker
 
 import (
@@ -32,6 +38,7 @@ func Main(analyzers ...*analysis.Analyzer) {
 
 	checker.RegisterFlags()
 
+	analysisflags.ConfigFile = ".vet.json"
 	analyzers = analysisflags.Parse(analyzers, true)
 
 	args := flag.Args()
@@ -52,6 +59,10 @@ Run '%[1]s help' for more detail,
 	}
 
 	if len(args) == 1 && strings.HasSuffix(args[0], ".cfg") {
+		unitchecker.Fix = checker.Fix
+		unitchecker.DumpFacts = checker.DumpFacts
+		unitchecker.BestEffort = checker.BestEffort
+		unitchecker.FactCodec = checker.FactCodec
 		unitchecker.Run(args[0], analyzers)
 		panic("unreachable")
 	}
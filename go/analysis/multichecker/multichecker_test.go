@@ -3,9 +3,13 @@
 package multichecker_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"testing"
 
@@ -83,3 +87,121 @@ func TestExitCode(t *testing.T) {
 		}
 	}
 }
+
+// TestFactCodec ensures that the -factcodec flag applies to the units
+// of go vet. This test fork/execs the main function above.
+func TestFactCodec(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping fork/exec test on this platform")
+	}
+
+	if os.Getenv("MULTICHECKER_CHILD") == "1" {
+		// child process
+
+		// replace [progname -test.run=TestFactCodec -- ...]
+		//      by [progname ...]
+		os.Args = os.Args[2:]
+		os.Args[0] = "vet"
+		main()
+		panic("unreachable")
+	}
+
+	dir, err := ioutil.TempDir("", "factcodec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg, vetx := writeUnit(t, dir, "package a\n\nfunc F() {}\n", false)
+
+	for _, codec := range []string{"gob", "json"} {
+		// findcall exports a fact about F.
+		cmd := exec.Command(os.Args[0], "-test.run=TestFactCodec", "--", "-findcall.name=F", "-factcodec="+codec, cfg)
+		cmd.Env = append(os.Environ(), "MULTICHECKER_CHILD=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("-factcodec=%s: %v\n%s", codec, err, out)
+		}
+		data, err := ioutil.ReadFile(vetx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The header line of the facts names their codec.
+		if i := bytes.IndexByte(data, '\n'); i < 0 || !bytes.HasSuffix(data[:i], []byte(" "+codec)) {
+			t.Errorf("-factcodec=%s: got facts %q, want them encoded with %s", codec, data, codec)
+		}
+	}
+}
+
+// TestBestEffortUnit ensures that a unit of go vet with type errors fails
+// in best-effort mode, unless the compiler is left to report its errors.
+// This test fork/execs the main function above.
+func TestBestEffortUnit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping fork/exec test on this platform")
+	}
+
+	if os.Getenv("MULTICHECKER_CHILD") == "1" {
+		// child process
+
+		// replace [progname -test.run=TestBestEffortUnit -- ...]
+		//      by [progname ...]
+		os.Args = os.Args[2:]
+		os.Args[0] = "vet"
+		main()
+		panic("unreachable")
+	}
+
+	const src = "package a\n\nvar x int = \"not an int\"\n"
+	for _, succeed := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "besteffort")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		cfg, _ := writeUnit(t, dir, src, succeed)
+
+		cmd := exec.Command(os.Args[0], "-test.run=TestBestEffortUnit", "--", "-besteffort", cfg)
+		cmd.Env = append(os.Environ(), "MULTICHECKER_CHILD=1")
+		out, err := cmd.CombinedOutput()
+		var exitcode int
+		if err, ok := err.(*exec.ExitError); ok {
+			exitcode = err.ExitCode() // requires go1.12
+		}
+		want, wantOut := 1, true
+		if succeed {
+			want, wantOut = 0, false
+		}
+		if exitcode != want {
+			t.Errorf("SucceedOnTypecheckFailure=%t: exited %d, want %d\n%s", succeed, exitcode, want, out)
+		}
+		if got := bytes.Contains(out, []byte("cannot use")); got != wantOut {
+			t.Errorf("SucceedOnTypecheckFailure=%t: got output <<%s>>, want the type error printed: %t", succeed, out, wantOut)
+		}
+	}
+}
+
+// writeUnit writes a go vet unit of package a, with the single file src,
+// to dir, and returns the names of its config file and of its facts.
+func writeUnit(t *testing.T, dir, src string, succeedOnTypecheckFailure bool) (cfg, vetx string) {
+	gofile := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(gofile, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	vetx = filepath.Join(dir, "a.vetx")
+	data, err := json.Marshal(map[string]interface{}{
+		"ID":                        "a",
+		"Compiler":                  "gc",
+		"Dir":                       dir,
+		"ImportPath":                "a",
+		"GoFiles":                   []string{gofile},
+		"VetxOutput":                vetx,
+		"SucceedOnTypecheckFailure": succeedOnTypecheckFailure,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = filepath.Join(dir, "a.cfg")
+	if err := ioutil.WriteFile(cfg, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, vetx
+}
@@ -7,10 +7,20 @@
 // panic if their argument variables are not 64-bit aligned. It is therefore
 // the caller's responsibility to arrange for 64-bit alignment of such variables.
 // See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+//
+// The alignment of a field is computed relative to the variable or
+// allocation containing it, following nested and embedded structs and
+// array elements. When a struct declared in the package being analyzed
+// causes the misalignment, the analyzer suggests moving the offending
+// field to the start of that struct.
 package atomicalign
 
 import (
+	"bytes"
+	"fmt"
 	"go/ast"
+	"go/constant"
+	"go/format"
 	"go/token"
 	"go/types"
 
@@ -80,39 +90,299 @@ func check64BitAlignment(pass *analysis.Pass, funcName string, arg ast.Expr) {
 		return
 	}
 
-	// Retrieve the types.Struct in order to get the offset of the
-	// atomically accessed field.
-	sel, ok := unary.X.(*ast.SelectorExpr)
+	// Retrieve the offset of the atomically accessed field relative to
+	// the variable or allocation that contains it.
+	sel, ok := unparen(unary.X).(*ast.SelectorExpr)
 	if !ok {
 		return
 	}
-	tvar, ok := pass.TypesInfo.Selections[sel].Obj().(*types.Var)
-	if !ok || !tvar.IsField() {
+	offset, steps, ok := offsetOf(pass, sel)
+	if !ok || len(steps) == 0 {
 		return
 	}
+	if offset&7 == 0 {
+		return // 64-bit aligned
+	}
 
-	stype, ok := pass.TypesInfo.Types[sel.X].Type.Underlying().(*types.Struct)
-	if !ok {
+	tvar := steps[len(steps)-1].field
+	msg := fmt.Sprintf("address of non 64-bit aligned field .%s passed to atomic.%s", tvar.Name(), funcName)
+
+	// If the field is reached through embedded or nested structs,
+	// report the first enclosing struct whose layout misaligns it.
+	var culprit *layoutStep
+	for i := range steps {
+		if steps[i].offset&7 != 0 {
+			culprit = &steps[i]
+			break
+		}
+	}
+	if culprit == nil {
+		pass.ReportRangef(arg, "%s", msg)
 		return
 	}
+	if len(steps) > 1 {
+		msg += fmt.Sprintf(" (field .%s is at offset %d in %s)", culprit.field.Name(), culprit.offset, structName(pass, culprit.strct))
+	}
+	pass.Report(analysis.Diagnostic{
+		Pos:            arg.Pos(),
+		End:            arg.End(),
+		Message:        msg,
+		SuggestedFixes: reorderFix(pass, offset, culprit),
+	})
+}
+
+// A layoutStep is a struct field on the path from an aligned variable or
+// allocation to the atomically accessed field.
+type layoutStep struct {
+	strct  types.Type // the struct type containing field
+	field  *types.Var
+	offset int64 // offset of field within strct
+}
 
-	var offset int64
-	var fields []*types.Var
-	for i := 0; i < stype.NumFields(); i++ {
-		f := stype.Field(i)
-		fields = append(fields, f)
-		if f == tvar {
-			// We're done, this is the field we were looking for,
-			// no need to fill the fields slice further.
-			offset = pass.TypesSizes.Offsetsof(fields)[i]
+// offsetOf returns the offset of the value denoted by expr relative to the
+// variable or allocation that contains it, and the struct fields traversed
+// to reach it, including those of embedded structs.
+//
+// The first word of a variable, and of an allocated struct, array or slice,
+// is 64-bit aligned, so values reached through a pointer are assumed to be
+// at offset 0 of their allocation. The boolean result is false if the
+// offset cannot be determined, as for an element of an array of
+// non-64-bit-aligned elements indexed by a non-constant.
+func offsetOf(pass *analysis.Pass, expr ast.Expr) (int64, []layoutStep, bool) {
+	switch expr := unparen(expr).(type) {
+	case *ast.Ident, *ast.StarExpr, *ast.CompositeLit, *ast.CallExpr:
+		return 0, nil, true
+
+	case *ast.SelectorExpr:
+		selection, ok := pass.TypesInfo.Selections[expr]
+		if !ok {
+			return 0, nil, true // qualified identifier
+		}
+		if selection.Kind() != types.FieldVal {
+			return 0, nil, false
+		}
+		var (
+			offset int64
+			steps  []layoutStep
+		)
+		t := selection.Recv()
+		if ptr, ok := t.Underlying().(*types.Pointer); ok {
+			t = ptr.Elem()
+		} else if offset, steps, ok = offsetOf(pass, expr.X); !ok {
+			return 0, nil, false
+		}
+		for _, index := range selection.Index() {
+			// An embedded pointer starts a new allocation.
+			if ptr, ok := t.Underlying().(*types.Pointer); ok {
+				offset, steps, t = 0, nil, ptr.Elem()
+			}
+			stype, ok := t.Underlying().(*types.Struct)
+			if !ok {
+				return 0, nil, false
+			}
+			fields := make([]*types.Var, index+1)
+			for i := range fields {
+				fields[i] = stype.Field(i)
+			}
+			fieldOffset := pass.TypesSizes.Offsetsof(fields)[index]
+			steps = append(steps, layoutStep{strct: t, field: fields[index], offset: fieldOffset})
+			offset += fieldOffset
+			t = fields[index].Type()
+		}
+		return offset, steps, true
+
+	case *ast.IndexExpr:
+		var (
+			offset int64
+			steps  []layoutStep
+			elem   types.Type
+		)
+		switch t := pass.TypesInfo.TypeOf(expr.X).Underlying().(type) {
+		case *types.Array:
+			var ok bool
+			if offset, steps, ok = offsetOf(pass, expr.X); !ok {
+				return 0, nil, false
+			}
+			elem = t.Elem()
+		case *types.Slice:
+			elem = t.Elem()
+		case *types.Pointer:
+			array, ok := t.Elem().Underlying().(*types.Array)
+			if !ok {
+				return 0, nil, false
+			}
+			elem = array.Elem()
+		default:
+			return 0, nil, false
+		}
+		size := pass.TypesSizes.Sizeof(elem)
+		if tv := pass.TypesInfo.Types[expr.Index]; tv.Value != nil {
+			i, ok := constant.Int64Val(tv.Value)
+			if !ok {
+				return 0, nil, false
+			}
+			offset += i * size
+		} else if size&7 != 0 {
+			return 0, nil, false
+		}
+		return offset, steps, true
+	}
+	return 0, nil, false
+}
+
+// reorderFix returns a fix that moves the field of the culprit step to the
+// start of its struct, if the struct is declared in this package and the
+// move makes the atomically accessed field, at offset, 64-bit aligned.
+func reorderFix(pass *analysis.Pass, offset int64, culprit *layoutStep) []analysis.SuggestedFix {
+	stype := culprit.strct.Underlying().(*types.Struct)
+	var node *ast.StructType
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if st, ok := n.(*ast.StructType); ok && pass.TypesInfo.TypeOf(st) == stype {
+				node = st
+			}
+			return node == nil
+		})
+		if node != nil {
 			break
 		}
 	}
-	if offset&7 == 0 {
-		return // 64-bit aligned
+	if node == nil || len(node.Fields.List) < 2 {
+		return nil
+	}
+
+	// Find the declaration of the field and its position within it.
+	var (
+		index int
+		group []*types.Var
+		pos   int
+	)
+	for i, field := range node.Fields.List {
+		group = group[:0]
+		pos = -1
+		for _, ident := range fieldIdents(field) {
+			if v, ok := pass.TypesInfo.Defs[ident].(*types.Var); ok {
+				if v == culprit.field {
+					pos = len(group)
+				}
+				group = append(group, v)
+			}
+		}
+		if pos >= 0 {
+			index = i
+			break
+		}
+	}
+	if pos < 0 || index == 0 {
+		return nil
+	}
+	newOffset := pass.TypesSizes.Offsetsof(group)[pos]
+	if (offset-culprit.offset+newOffset)&7 != 0 {
+		return nil
 	}
 
-	pass.ReportRangef(arg, "address of non 64-bit aligned field .%s passed to atomic.%s", tvar.Name(), funcName)
+	// Only rewrite structs with one field per line.
+	list := node.Fields.List
+	for i := 1; i < len(list); i++ {
+		if pass.Fset.Position(list[i-1].End()).Line == pass.Fset.Position(fieldStart(list[i])).Line {
+			return nil
+		}
+	}
+	field := list[index]
+	var buf bytes.Buffer
+	if field.Doc != nil {
+		for _, c := range field.Doc.List {
+			fmt.Fprintf(&buf, "%s\n\t", c.Text)
+		}
+	}
+	for i, name := range field.Names {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(name.Name)
+	}
+	if len(field.Names) > 0 {
+		buf.WriteString(" ")
+	}
+	format.Node(&buf, pass.Fset, field.Type)
+	if field.Tag != nil {
+		fmt.Fprintf(&buf, " %s", field.Tag.Value)
+	}
+	if field.Comment != nil {
+		for _, c := range field.Comment.List {
+			fmt.Fprintf(&buf, " %s", c.Text)
+		}
+	}
+	buf.WriteString("\n\t")
+
+	// Remove the field along with the line break that precedes it
+	// if it is the last field, or that follows it otherwise.
+	var remove analysis.TextEdit
+	if index == len(list)-1 {
+		remove = analysis.TextEdit{Pos: fieldEnd(list[index-1]), End: fieldEnd(field)}
+	} else {
+		remove = analysis.TextEdit{Pos: fieldStart(field), End: fieldStart(list[index+1])}
+	}
+	return []analysis.SuggestedFix{{
+		Message: fmt.Sprintf("Move field .%s to the start of %s", culprit.field.Name(), structName(pass, culprit.strct)),
+		TextEdits: []analysis.TextEdit{
+			{Pos: fieldStart(list[0]), End: fieldStart(list[0]), NewText: buf.Bytes()},
+			remove,
+		},
+	}}
+}
+
+// fieldIdents returns the identifiers that declare the fields of field:
+// its names, or the type name of an embedded field.
+func fieldIdents(field *ast.Field) []*ast.Ident {
+	if len(field.Names) > 0 {
+		return field.Names
+	}
+	t := field.Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	switch t := t.(type) {
+	case *ast.Ident:
+		return []*ast.Ident{t}
+	case *ast.SelectorExpr:
+		return []*ast.Ident{t.Sel}
+	}
+	return nil
+}
+
+// fieldStart returns the start of a field declaration, including its doc comment.
+func fieldStart(field *ast.Field) token.Pos {
+	if field.Doc != nil {
+		return field.Doc.Pos()
+	}
+	return field.Pos()
+}
+
+// fieldEnd returns the end of a field declaration, including its line comment.
+func fieldEnd(field *ast.Field) token.Pos {
+	if field.Comment != nil {
+		return field.Comment.End()
+	}
+	return field.End()
+}
+
+// structName returns the name of a struct type for use in messages.
+func structName(pass *analysis.Pass, t types.Type) string {
+	if _, ok := t.(*types.Named); ok {
+		return types.TypeString(t, types.RelativeTo(pass.Pkg))
+	}
+	return "struct"
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
 }
 
 // imports reports whether pkg has path among its direct imports.
@@ -15,3 +15,8 @@ func Test(t *testing.T) {
 	testdata := analysistest.TestData()
 	analysistest.Run(t, testdata, atomicalign.Analyzer, "a", "b")
 }
+
+func TestSuggestedFixes(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, atomicalign.Analyzer, "c")
+}
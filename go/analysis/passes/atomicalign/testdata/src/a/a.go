@@ -228,3 +228,51 @@ func embeddedStructFields() {
 	atomic.AddUint64(&s1.b, 9) // want "address of non 64-bit aligned field .b passed to atomic.AddUint64"
 	atomic.AddInt64(&s1.c, 9)
 }
+
+type inner struct {
+	a int32
+	b int64
+}
+
+type outer struct {
+	x  int32
+	in inner
+}
+
+func nestedStructAlignment() {
+	var o outer
+	atomic.AddInt64(&o.in.b, 1) // aligned by the layout of outer
+
+	var i inner
+	atomic.AddInt64(&i.b, 1) // want "address of non 64-bit aligned field .b passed to atomic.AddInt64"
+}
+
+type counters struct {
+	hits int64
+}
+
+type embedded struct {
+	flag bool
+	counters
+}
+
+func embeddedStructAlignment() {
+	var e embedded
+	atomic.AddInt64(&e.hits, 1)          // want `address of non 64-bit aligned field .hits passed to atomic.AddInt64 \(field .counters is at offset 4 in embedded\)`
+	atomic.AddInt64(&e.counters.hits, 1) // want `address of non 64-bit aligned field .hits passed to atomic.AddInt64 \(field .counters is at offset 4 in embedded\)`
+}
+
+func arrayOfStructsAlignment() {
+	var a [2]struct {
+		x int64
+		y int32
+	}
+	atomic.AddInt64(&a[0].x, 1)
+	atomic.AddInt64(&a[1].x, 1) // want "address of non 64-bit aligned field .x passed to atomic.AddInt64"
+}
+
+func heapAlignment() {
+	p := new(ts)
+	atomic.SwapInt64(&p.e, 9)
+	atomic.SwapUint64(&p.f, 9) // want "address of non 64-bit aligned field .f passed to atomic.SwapUint64"
+}
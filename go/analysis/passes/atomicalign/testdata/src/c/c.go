@@ -0,0 +1,48 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the suggested fixes of the atomic
+// alignment checker.
+
+// +build arm 386
+
+package testdata
+
+import "sync/atomic"
+
+type counters struct {
+	hits int64
+}
+
+type embedded struct {
+	flag bool
+	counters
+}
+
+func embeddedField() {
+	var e embedded
+	atomic.AddInt64(&e.hits, 1) // want `address of non 64-bit aligned field .hits passed to atomic.AddInt64 \(field .counters is at offset 4 in embedded\)`
+}
+
+type multiName struct {
+	x    int32
+	a, b int64
+	y    int32
+}
+
+func multiNameField() {
+	var m multiName
+	atomic.AddInt64(&m.b, 1) // want "address of non 64-bit aligned field .b passed to atomic.AddInt64"
+}
+
+type commented struct {
+	flag bool // flag is set first.
+	// n counts the events.
+	n int64 `json:"n"` // updated atomically
+}
+
+func commentedField() {
+	var c commented
+	atomic.AddInt64(&c.n, 1) // want "address of non 64-bit aligned field .n passed to atomic.AddInt64"
+}
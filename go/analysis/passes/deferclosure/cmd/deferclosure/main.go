@@ -0,0 +1,9 @@
+// The deferclosure command runs the deferclosure analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/deferclosure"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(deferclosure.Analyzer) }
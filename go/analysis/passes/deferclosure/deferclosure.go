@@ -0,0 +1,310 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package deferclosure defines an Analyzer that checks for deferred
+// function literals that use variables whose value changes before
+// the deferred call runs.
+package deferclosure
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+)
+
+const Doc = `check deferred function literals that see the final value of a variable
+
+A deferred call runs when the function returns, so a deferred function
+literal that refers to a loop variable sees the value of the variable
+after the last iteration, however many times it was deferred:
+
+	for _, f := range files {
+		if f.Temp {
+			defer func() {
+				os.Remove(f.Name) // removes the last file only
+			}()
+		}
+	}
+
+The loopclosure analyzer reports the defer statements that are the last
+statement of a loop body; this analyzer reports the others. From Go 1.22
+on, each iteration has its own copy of the variables declared by the
+loop, so they are reported only in the files of modules that declare an
+older Go version in their go.mod file, unless the //go:build constraint
+of the file requires Go 1.22 or later.
+
+Likewise, a deferred function literal that refers to a method's receiver
+sees the receiver's value at the time of the return, so assigning to the
+receiver after the defer statement is reported:
+
+	func (n *node) walk() {
+		defer func() { n.visited = true }()
+		for n.next != nil {
+			n = n.next // the deferred call marks the last node
+		}
+	}
+
+Pass the variable as an argument of the deferred call, or copy it to
+another variable, to use its current value.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "deferclosure",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	// perIteration records the files whose loops declare variables
+	// per iteration.
+	perIteration := make(map[*token.File]bool)
+	modVersions := make(map[string]int)
+	for _, f := range pass.Files {
+		tf := pass.Fset.File(f.Pos())
+		if tf == nil {
+			continue
+		}
+		version := buildVersion(f)
+		if version == 0 {
+			version = modVersion(filepath.Dir(tf.Name()), modVersions)
+		}
+		perIteration[tf] = version >= 22
+	}
+
+	nodeFilter := []ast.Node{
+		(*ast.FuncDecl)(nil),
+		(*ast.RangeStmt)(nil),
+		(*ast.ForStmt)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			checkReceiver(pass, n)
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE && perIteration[pass.Fset.File(n.Pos())] {
+				return
+			}
+			checkLoop(pass, n.Body, n.Key, n.Value)
+		case *ast.ForStmt:
+			var vars []ast.Expr
+			switch post := n.Post.(type) {
+			case *ast.AssignStmt:
+				// e.g. for p = head; p != nil; p = p.next
+				vars = post.Lhs
+			case *ast.IncDecStmt:
+				// e.g. for i := 0; i < n; i++
+				vars = []ast.Expr{post.X}
+			}
+			if init, ok := n.Init.(*ast.AssignStmt); ok && init.Tok == token.DEFINE && perIteration[pass.Fset.File(n.Pos())] {
+				vars = withoutDefs(pass, vars, init)
+			}
+			checkLoop(pass, n.Body, vars...)
+		}
+	})
+	return nil, nil
+}
+
+// checkLoop reports the references to the loop variables vars in the
+// deferred function literals of body.
+func checkLoop(pass *analysis.Pass, body *ast.BlockStmt, vars ...ast.Expr) {
+	objs := make(map[types.Object]bool)
+	for _, v := range vars {
+		if obj := varOf(pass, v); obj != nil {
+			objs[obj] = true
+		}
+	}
+	if len(objs) == 0 || len(body.List) == 0 {
+		return
+	}
+	// Leave the defer statement that ends the body to loopclosure.
+	var last ast.Stmt = body.List[len(body.List)-1]
+	for _, lit := range deferredLits(body) {
+		if lit.stmt == last {
+			continue
+		}
+		reported := make(map[types.Object]bool)
+		ast.Inspect(lit.fn.Body, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := pass.TypesInfo.Uses[id]
+			if objs[obj] && !reported[obj] {
+				reported[obj] = true
+				pass.ReportRangef(id, "loop variable %s captured by deferred func literal; every deferred call sees its final value", id.Name)
+			}
+			return true
+		})
+	}
+}
+
+// checkReceiver reports the assignments to the receiver of fn that follow
+// a deferred function literal that refers to it.
+func checkReceiver(pass *analysis.Pass, fn *ast.FuncDecl) {
+	if fn.Recv == nil || fn.Body == nil || len(fn.Recv.List) == 0 || len(fn.Recv.List[0].Names) == 0 {
+		return
+	}
+	recv := pass.TypesInfo.Defs[fn.Recv.List[0].Names[0]]
+	if recv == nil {
+		return
+	}
+	var first *ast.FuncLit // the first deferred literal using the receiver
+	for _, lit := range deferredLits(fn.Body) {
+		if uses(pass, lit.fn.Body, recv) {
+			first = lit.fn
+			break
+		}
+	}
+	if first == nil {
+		return
+	}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if n == first {
+			return false
+		}
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || assign.Pos() < first.End() {
+			return true
+		}
+		for _, lhs := range assign.Lhs {
+			if id, ok := lhs.(*ast.Ident); ok && pass.TypesInfo.Uses[id] == recv {
+				pass.ReportRangef(id, "receiver %s is reassigned after a deferred func literal that uses it; the deferred call sees the new value", id.Name)
+			}
+		}
+		return true
+	})
+}
+
+type deferredLit struct {
+	stmt *ast.DeferStmt
+	fn   *ast.FuncLit
+}
+
+// deferredLits returns the defer statements of body that call a function
+// literal, leaving out those of nested function literals, which run when
+// the nested function returns.
+func deferredLits(body *ast.BlockStmt) []deferredLit {
+	var lits []deferredLit
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			if fn, ok := n.Call.Fun.(*ast.FuncLit); ok {
+				lits = append(lits, deferredLit{n, fn})
+			}
+			// The defer statements of the literal run when it returns.
+			return false
+		}
+		return true
+	})
+	return lits
+}
+
+// withoutDefs returns the variables of vars that are not declared by def.
+func withoutDefs(pass *analysis.Pass, vars []ast.Expr, def *ast.AssignStmt) []ast.Expr {
+	defs := make(map[types.Object]bool)
+	for _, lhs := range def.Lhs {
+		if id, ok := lhs.(*ast.Ident); ok {
+			defs[pass.TypesInfo.Defs[id]] = true
+		}
+	}
+	var result []ast.Expr
+	for _, v := range vars {
+		if obj := varOf(pass, v); obj == nil || !defs[obj] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+var (
+	buildGoVersionRx = regexp.MustCompile(`^go1\.(\d+)$`)
+	modGoVersionRx   = regexp.MustCompile(`(?m)^go\s+1\.(\d+)\b`)
+)
+
+// buildVersion returns the minor Go version N that the //go:build
+// constraint of file requires with a go1.N term, or 0 if it requires none.
+// Only the conjunctions of terms are understood.
+func buildVersion(file *ast.File) int {
+	version := 0
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, "//go:build ") {
+				continue
+			}
+			expr := strings.TrimPrefix(c.Text, "//go:build ")
+			if strings.ContainsAny(expr, "|!") {
+				continue
+			}
+			for _, term := range strings.Split(expr, "&&") {
+				term = strings.Trim(strings.TrimSpace(term), "()")
+				if m := buildGoVersionRx.FindStringSubmatch(term); m != nil {
+					if n, _ := strconv.Atoi(m[1]); n > version {
+						version = n
+					}
+				}
+			}
+		}
+	}
+	return version
+}
+
+// modVersion returns the minor Go version N of the go 1.N directive of the
+// go.mod file of the module of dir, or 0 if there is none, recording the
+// versions of the directories it visits in versions.
+func modVersion(dir string, versions map[string]int) int {
+	if version, ok := versions[dir]; ok {
+		return version
+	}
+	version := 0
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		if m := modGoVersionRx.FindSubmatch(data); m != nil {
+			version, _ = strconv.Atoi(string(m[1]))
+		}
+	} else if parent := filepath.Dir(dir); parent != dir {
+		version = modVersion(parent, versions)
+	}
+	versions[dir] = version
+	return version
+}
+
+// varOf returns the variable denoted by the identifier expr, or nil.
+func varOf(pass *analysis.Pass, expr ast.Expr) types.Object {
+	id, ok := expr.(*ast.Ident)
+	if !ok || id.Name == "_" {
+		return nil
+	}
+	obj := pass.TypesInfo.ObjectOf(id)
+	if _, ok := obj.(*types.Var); !ok {
+		return nil
+	}
+	return obj
+}
+
+// uses reports whether n refers to obj.
+func uses(pass *analysis.Pass, n ast.Node, obj types.Object) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && pass.TypesInfo.Uses[id] == obj {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
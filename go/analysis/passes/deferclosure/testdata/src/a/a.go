@@ -0,0 +1,84 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the deferclosure checker.
+
+package a
+
+func use(interface{}) {}
+
+func rangeLoop(s []string) {
+	for i, v := range s {
+		if v != "" {
+			defer func() {
+				use(v) // want "loop variable v captured by deferred func literal"
+				use(i) // want "loop variable i captured by deferred func literal"
+				use(v)
+			}()
+		}
+		use(i)
+	}
+}
+
+func forLoop(n int) {
+	for i := 0; i < n; i++ {
+		{
+			defer func() { use(i) }() // want "loop variable i captured by deferred func literal"
+		}
+	}
+}
+
+func outerLoop(s [][]string) {
+	for _, inner := range s {
+		for _, v := range inner {
+			defer func() {
+				use(inner) // want "loop variable inner captured by deferred func literal"
+				use(v)     // the last statement of its loop: reported by loopclosure
+			}()
+		}
+	}
+}
+
+func fine(s []string) {
+	for _, v := range s {
+		v := v
+		defer func() { use(v) }()
+	}
+	for _, v := range s {
+		defer func(v string) { use(v) }(v)
+		use(v)
+	}
+	for _, v := range s {
+		func() {
+			// Runs when the enclosing literal returns.
+			defer func() { use(v) }()
+			use(v)
+		}()
+		use(v)
+	}
+}
+
+type node struct {
+	next    *node
+	visited bool
+}
+
+func (n *node) walk() {
+	defer func() { n.visited = true }()
+	for n.next != nil {
+		n = n.next // want "receiver n is reassigned after a deferred func literal that uses it"
+	}
+}
+
+func (n *node) fine() {
+	n = n.next
+	defer func(n *node) { n.visited = true }(n)
+	n = n.next
+	defer func() { use(n.next) }()
+}
+
+func (n *node) unused() {
+	defer func() { use(0) }()
+	n = n.next
+}
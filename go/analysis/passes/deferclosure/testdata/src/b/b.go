@@ -0,0 +1,20 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.22
+// +build go1.22
+
+// This file contains tests for the deferclosure checker in a file that
+// requires Go 1.22, whose loops declare variables per iteration.
+
+package b
+
+func use(interface{}) {}
+
+func rangeLoop(s []string) {
+	for _, v := range s {
+		defer func() { use(v) }()
+		use(v)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the deferclosure checker in a module
+// whose loops declare variables per iteration.
+
+package loopvar
+
+func use(interface{}) {}
+
+func rangeLoop(s []string) {
+	for i, v := range s {
+		if v != "" {
+			defer func() {
+				use(v)
+				use(i)
+			}()
+		}
+		use(i)
+	}
+}
+
+func forLoop(n int) {
+	for i := 0; i < n; i++ {
+		{
+			defer func() { use(i) }()
+		}
+	}
+}
+
+type node struct{ next *node }
+
+func sharedVars(s []string, head *node) {
+	// The variables declared outside of the loops are shared.
+	var v string
+	for _, v = range s {
+		defer func() { use(v) }() // want "loop variable v captured by deferred func literal"
+		use(v)
+	}
+	var p *node
+	for p = head; p != nil; p = p.next {
+		defer func() { use(p) }() // want "loop variable p captured by deferred func literal"
+		use(p)
+	}
+}
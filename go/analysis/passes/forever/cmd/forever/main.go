@@ -0,0 +1,9 @@
+// The forever command runs the forever analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/forever"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(forever.Analyzer) }
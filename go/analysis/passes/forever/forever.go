@@ -0,0 +1,216 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package forever defines an Analyzer that reports statements that block
+// or spin forever by accident.
+package forever
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/ast/astutil"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+)
+
+const Doc = `check for statements that block or spin forever
+
+An empty select statement blocks its goroutine forever. This is the idiom
+that keeps a program running when the work is done by other goroutines,
+as the last statement of main.main, but elsewhere the goroutine is
+usually leaked by mistake:
+
+	go func() {
+		process(ch)
+		select {}
+	}()
+
+An infinite for loop whose body has no calls, no channel operations and
+no way out spins forever, using a whole CPU:
+
+	for {
+		n++
+	}
+
+as does a loop with an empty body that waits on a condition without
+calls, which also races with the goroutine expected to change it:
+
+	for !done {
+	}
+
+This checker reports such statements. A comment //forever:ok on the line
+of the statement, or on the line before it, suppresses the report for the
+rare intentional uses.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "forever",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	suppressed := suppressedLines(pass)
+	isSuppressed := func(pos token.Pos) bool {
+		p := pass.Fset.Position(pos)
+		lines := suppressed[p.Filename]
+		return lines[p.Line] || lines[p.Line-1]
+	}
+
+	// The select {} that ends main.main keeps the program running.
+	var mainEnd ast.Stmt
+	if pass.Pkg.Name() == "main" {
+		if main, ok := pass.Pkg.Scope().Lookup("main").(*types.Func); ok {
+			for _, f := range pass.Files {
+				for _, decl := range f.Decls {
+					if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil && pass.TypesInfo.Defs[fn.Name] == main {
+						if list := fn.Body.List; len(list) > 0 {
+							mainEnd = list[len(list)-1]
+						}
+					}
+				}
+			}
+		}
+	}
+
+	nodeFilter := []ast.Node{
+		(*ast.SelectStmt)(nil),
+		(*ast.ForStmt)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		if isSuppressed(n.Pos()) {
+			return
+		}
+		switch n := n.(type) {
+		case *ast.SelectStmt:
+			if len(n.Body.List) == 0 && n != mainEnd {
+				pass.ReportRangef(n, "empty select statement blocks forever")
+			}
+		case *ast.ForStmt:
+			switch {
+			case n.Cond == nil && !mayStop(pass, n.Body):
+				pass.Reportf(n.For, "infinite loop without calls, channel operations or exits spins forever")
+			case n.Cond != nil && n.Init == nil && n.Post == nil && len(n.Body.List) == 0 && !mayStop(pass, n.Cond):
+				pass.Reportf(n.For, "empty loop busy-waits for its condition; use a channel or a sync primitive")
+			}
+		}
+	})
+	return nil, nil
+}
+
+// suppressedLines returns the lines of the //forever:ok comments of the
+// files of the package, by file name.
+func suppressedLines(pass *analysis.Pass) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool)
+	for _, f := range pass.Files {
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				if strings.TrimSpace(c.Text) != "//forever:ok" {
+					continue
+				}
+				p := pass.Fset.Position(c.Pos())
+				if lines[p.Filename] == nil {
+					lines[p.Filename] = make(map[int]bool)
+				}
+				lines[p.Filename][p.Line] = true
+			}
+		}
+	}
+	return lines
+}
+
+// mayStop reports whether the execution of n, the body or the condition
+// of a loop, may block, have an effect outside of the goroutine, or leave
+// the loop: whether it calls a function other than the builtins that
+// cannot block, has a channel operation, or has a return, goto, or break
+// out of the loop. Function literals are not executed by n.
+func mayStop(pass *analysis.Pass, n ast.Node) bool {
+	// labels holds the labels of the statements of n, which a break
+	// does not leave the loop to reach.
+	labels := make(map[string]bool)
+	ast.Inspect(n, func(n ast.Node) bool {
+		if n, ok := n.(*ast.LabeledStmt); ok {
+			labels[n.Label.Name] = true
+		}
+		return true
+	})
+
+	found := false
+	var visit func(n ast.Node, breakable bool) // breakable: an unlabeled break leaves the loop
+	visit = func(n ast.Node, breakable bool) {
+		ast.Inspect(n, func(m ast.Node) bool {
+			if found {
+				return false
+			}
+			switch m := m.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.CallExpr:
+				if !cannotBlock(pass, m) {
+					found = true
+				}
+			case *ast.UnaryExpr:
+				if m.Op == token.ARROW {
+					found = true
+				}
+			case *ast.SendStmt, *ast.SelectStmt, *ast.ReturnStmt, *ast.GoStmt, *ast.DeferStmt:
+				found = true
+			case *ast.RangeStmt:
+				if t, ok := pass.TypesInfo.TypeOf(m.X).Underlying().(*types.Chan); ok && t != nil {
+					found = true
+					return false
+				}
+				if m != n {
+					visit(m.Body, false)
+					return false
+				}
+			case *ast.ForStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt:
+				if m != n {
+					// An unlabeled break of a nested statement leaves it, not the loop.
+					visit(m, false)
+					return false
+				}
+			case *ast.BranchStmt:
+				switch m.Tok {
+				case token.GOTO:
+					found = true
+				case token.BREAK:
+					if m.Label == nil && breakable || m.Label != nil && !labels[m.Label.Name] {
+						found = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	visit(n, true)
+	return found
+}
+
+// cannotBlock reports whether call is a conversion, or a call to a builtin
+// function that has no effect outside of the goroutine and cannot block.
+func cannotBlock(pass *analysis.Pass, call *ast.CallExpr) bool {
+	if tv, ok := pass.TypesInfo.Types[call.Fun]; ok && tv.IsType() {
+		return true
+	}
+	id, ok := astutil.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	b, ok := pass.TypesInfo.Uses[id].(*types.Builtin)
+	if !ok {
+		return false
+	}
+	switch b.Name() {
+	case "append", "cap", "complex", "copy", "imag", "len", "make", "new", "real", "delete":
+		return true
+	}
+	return false
+}
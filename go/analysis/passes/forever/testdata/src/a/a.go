@@ -0,0 +1,114 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package a
+
+func work(ch chan int) {}
+
+func selects(ch chan int) {
+	go func() {
+		work(ch)
+		select {} // want "empty select statement blocks forever"
+	}()
+
+	select { // ok: not empty
+	case <-ch:
+	}
+
+	//forever:ok
+	select {}
+
+	select {} //forever:ok
+}
+
+var done bool
+
+func loops(ch chan int, m map[int]int) {
+	n := 0
+	for { // want "infinite loop without calls, channel operations or exits spins forever"
+		n++
+	}
+
+	for { // want "infinite loop without calls, channel operations or exits spins forever"
+		m[n] = len(m)
+		f := func() { work(ch) } // not executed by the loop
+		_ = f
+	}
+
+	for { // want "infinite loop without calls, channel operations or exits spins forever"
+		for i := 0; i < 10; i++ {
+			if i == n {
+				break // leaves the inner loop only
+			}
+		}
+		switch n {
+		case 1:
+			break
+		}
+	}
+
+	for !done { // want "empty loop busy-waits for its condition; use a channel or a sync primitive"
+	}
+
+	for n < 10 { // ok: the body changes n
+		n++
+	}
+
+	for !isDone() { // ok: calls a function
+	}
+
+	for i := 0; i < 1000; i++ { // ok: a delay loop ends
+	}
+
+	for { // ok: calls a function
+		work(ch)
+	}
+
+	for { // ok: receives
+		n += <-ch
+	}
+
+	for { // ok: sends
+		ch <- n
+	}
+
+	for range ch { // ok: not a for statement
+	}
+
+	for { // ok: ranges over a channel
+		for range ch {
+		}
+	}
+
+	for { // ok: breaks
+		if n > 10 {
+			break
+		}
+		n++
+	}
+
+outer:
+	for {
+		for { // ok: breaks out of the outer loop
+			if n > 10 {
+				break outer
+			}
+			n++
+		}
+	}
+
+	for { // ok: returns
+		if n > 10 {
+			return
+		}
+		n++
+	}
+
+	//forever:ok
+	for {
+		n++
+	}
+}
+
+func isDone() bool { return done }
@@ -0,0 +1,14 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+func serve() {
+	select {} // want "empty select statement blocks forever"
+}
+
+func main() {
+	go serve()
+	select {} // ok: keeps the program running
+}
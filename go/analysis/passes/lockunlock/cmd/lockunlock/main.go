@@ -0,0 +1,9 @@
+// The lockunlock command runs the lockunlock analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/lockunlock"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(lockunlock.Analyzer) }
@@ -0,0 +1,181 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lockunlock defines an Analyzer that checks for mutexes
+// that are unlocked immediately after, or deferred before, being locked.
+package lockunlock
+
+import (
+	"go/ast"
+	"go/types"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/analysis/passes/internal/analysisutil"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+	"github.com/jackie-feng/tools/go/types/typeutil"
+)
+
+const Doc = `check for empty critical sections and misplaced deferred unlocks
+
+A call to Lock immediately followed by a call to Unlock of the same
+mutex protects nothing, and is often left behind by a bad merge:
+
+	mu.Lock()
+	mu.Unlock()
+
+A deferred call to Unlock that precedes the corresponding call to Lock
+in the same block unlocks the mutex when the function returns, but
+leaves it unprotected in between, and panics if the Lock is not reached:
+
+	defer mu.Unlock()
+	mu.Lock()
+
+The same checks apply to RLock and RUnlock.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "lockunlock",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// unlocks maps the locking methods to their unlocking counterparts.
+var unlocks = map[string]string{
+	"(*sync.Mutex).Lock":    "Unlock",
+	"(*sync.RWMutex).Lock":  "Unlock",
+	"(*sync.RWMutex).RLock": "RUnlock",
+	"(sync.Locker).Lock":    "Unlock",
+}
+
+// isUnlock reports whether name is the full name of an unlocking method.
+func isUnlock(name string) bool {
+	switch name {
+	case "(*sync.Mutex).Unlock", "(*sync.RWMutex).Unlock", "(*sync.RWMutex).RUnlock", "(sync.Locker).Unlock":
+		return true
+	}
+	return false
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{
+		(*ast.BlockStmt)(nil),
+		(*ast.CaseClause)(nil),
+		(*ast.CommClause)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			checkStmts(pass, n.List)
+		case *ast.CaseClause:
+			checkStmts(pass, n.Body)
+		case *ast.CommClause:
+			checkStmts(pass, n.Body)
+		}
+	})
+	return nil, nil
+}
+
+// A mutexCall is a call of a locking or unlocking method.
+type mutexCall struct {
+	call   *ast.CallExpr
+	mutex  string // the formatted receiver expression
+	method string // the method name, such as "RLock"
+	unlock string // for a locking method, the name of its counterpart
+}
+
+// checkStmts checks a list of statements of the same block.
+func checkStmts(pass *analysis.Pass, stmts []ast.Stmt) {
+	for i, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.ExprStmt:
+			lock := mutexMethodCall(pass, stmt.X)
+			if lock == nil || lock.unlock == "" || i+1 == len(stmts) {
+				continue
+			}
+			next, ok := stmts[i+1].(*ast.ExprStmt)
+			if !ok {
+				continue
+			}
+			if unlock := mutexMethodCall(pass, next.X); unlock != nil && unlock.mutex == lock.mutex && unlock.method == lock.unlock {
+				pass.Reportf(lock.call.Pos(), "empty critical section: %s.%s is immediately followed by %s.%s", lock.mutex, lock.method, unlock.mutex, unlock.method)
+			}
+
+		case *ast.DeferStmt:
+			unlock := mutexMethodCall(pass, stmt.Call)
+			if unlock == nil || unlock.unlock != "" {
+				continue
+			}
+			if lock := laterLock(pass, stmts[:i], stmts[i+1:], unlock); lock != nil {
+				pass.Reportf(stmt.Pos(), "%s.%s is deferred before the call to %s.%s", unlock.mutex, unlock.method, lock.mutex, lock.method)
+			}
+		}
+	}
+}
+
+// laterLock returns the call in after that locks the mutex unlocked by
+// unlock, unless one of the statements in before already locks it, or one
+// of the statements in after unlocks it first: the mutex is then held by
+// the caller, and released and locked again before the deferred unlock.
+func laterLock(pass *analysis.Pass, before, after []ast.Stmt, unlock *mutexCall) *mutexCall {
+	sameMutex := func(stmt ast.Stmt) *mutexCall {
+		if stmt, ok := stmt.(*ast.ExprStmt); ok {
+			if call := mutexMethodCall(pass, stmt.X); call != nil && call.mutex == unlock.mutex {
+				return call
+			}
+		}
+		return nil
+	}
+	for _, stmt := range before {
+		if call := sameMutex(stmt); call != nil && call.unlock == unlock.method {
+			return nil
+		}
+	}
+	for _, stmt := range after {
+		call := sameMutex(stmt)
+		switch {
+		case call == nil:
+		case call.unlock == unlock.method:
+			return call
+		case call.method == unlock.method:
+			return nil
+		}
+	}
+	return nil
+}
+
+// mutexMethodCall returns the call of a locking or unlocking method in e,
+// or nil if e is not one.
+func mutexMethodCall(pass *analysis.Pass, e ast.Expr) *mutexCall {
+	call, ok := analysisutil.Unparen(e).(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+	sel, ok := analysisutil.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	fn, _ := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if fn == nil {
+		return nil
+	}
+	name := fn.FullName()
+	unlock, isLock := unlocks[name]
+	if !isLock && !isUnlock(name) {
+		return nil
+	}
+	// Calls with side effects in the receiver, such as m().Lock(),
+	// may lock different mutexes.
+	if analysisutil.HasSideEffects(pass.TypesInfo, sel.X) {
+		return nil
+	}
+	return &mutexCall{
+		call:   call,
+		mutex:  analysisutil.Format(pass.Fset, sel.X),
+		method: fn.Name(),
+		unlock: unlock,
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the lockunlock checker.
+
+package a
+
+import "sync"
+
+var mu sync.Mutex
+
+type T struct {
+	sync.RWMutex
+	mu    sync.Mutex
+	count int
+}
+
+func EmptyCriticalSection(t *T, l sync.Locker) {
+	mu.Lock() // want `empty critical section: mu.Lock is immediately followed by mu.Unlock`
+	mu.Unlock()
+
+	t.mu.Lock() // want `empty critical section: t.mu.Lock is immediately followed by t.mu.Unlock`
+	t.mu.Unlock()
+
+	t.RLock() // want `empty critical section: t.RLock is immediately followed by t.RUnlock`
+	t.RUnlock()
+
+	l.Lock() // want `empty critical section: l.Lock is immediately followed by l.Unlock`
+	l.Unlock()
+
+	if t.count > 0 {
+		t.Lock() // want `empty critical section: t.Lock is immediately followed by t.Unlock`
+		t.Unlock()
+	}
+}
+
+func NonEmptyCriticalSection(t *T, other *T) {
+	mu.Lock()
+	t.count++
+	mu.Unlock()
+
+	// Different mutexes.
+	t.mu.Lock()
+	other.mu.Unlock()
+
+	// Mismatched methods.
+	t.RLock()
+	t.Unlock()
+
+	// Lock after unlock is not an empty critical section.
+	mu.Unlock()
+	mu.Lock()
+}
+
+func get() *T { return nil }
+
+func SideEffects() {
+	// The receivers may be different mutexes.
+	get().mu.Lock()
+	get().mu.Unlock()
+}
+
+func DeferBeforeLock(t *T) {
+	defer mu.Unlock() // want `mu.Unlock is deferred before the call to mu.Lock`
+	t.count++
+	mu.Lock()
+
+	defer t.RUnlock() // want `t.RUnlock is deferred before the call to t.RLock`
+	t.RLock()
+}
+
+func DeferAfterLock(t *T) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	t.RLock()
+	t.count++
+	defer t.RUnlock()
+
+	// The mutex is locked by the caller.
+	defer t.mu.Unlock()
+	t.count++
+}
+
+func DeferRelock(t *T) {
+	// The mutex is locked by the caller, and released while waiting.
+	defer t.mu.Unlock()
+	t.mu.Unlock()
+	t.count++
+	t.mu.Lock()
+
+	defer t.RUnlock()
+	t.RUnlock()
+	t.RLock()
+}
+
+func DeferInOtherBlock(t *T) {
+	defer t.mu.Unlock()
+	if t.count > 0 {
+		t.mu.Lock()
+	}
+}
@@ -0,0 +1,9 @@
+// The logguard command runs the logguard analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/logguard"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(logguard.Analyzer) }
@@ -0,0 +1,191 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package logguard defines an Analyzer that reports expensive arguments
+// of debug-level log calls that are not guarded by a level check.
+package logguard
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+	"github.com/jackie-feng/tools/go/types/typeutil"
+)
+
+const Doc = `check for expensive arguments of unguarded debug-level log calls
+
+The arguments of a call are evaluated even if the logger discards the
+message because its level is disabled, so a debug-level log call in a hot
+path that formats or dumps a value does the work every time:
+
+	log.Debugf("request: %s", spew.Sdump(req))
+
+This checker reports the calls to expensive functions, such as
+fmt.Sprintf or json.Marshal, in the arguments of calls to debug-level log
+functions that are not in the body of an if statement whose condition
+checks the level:
+
+	if log.IsLevelEnabled(logrus.DebugLevel) {
+		log.Debugf("request: %s", spew.Sdump(req))
+	}
+
+The log functions, level checks and expensive functions are set by flags,
+as comma-separated lists of the full names of functions and methods, such
+as fmt.Sprintf and (*github.com/sirupsen/logrus.Logger).Debugf. The
+defaults cover logrus and zap. The checker does not know which paths are
+hot, so it is not run by go vet.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "logguard",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// flags
+var funcs, guards, expensive stringSetFlag
+
+func init() {
+	funcs.Set(strings.Join([]string{
+		"github.com/sirupsen/logrus.Debug",
+		"github.com/sirupsen/logrus.Debugf",
+		"github.com/sirupsen/logrus.Debugln",
+		"github.com/sirupsen/logrus.Trace",
+		"github.com/sirupsen/logrus.Tracef",
+		"github.com/sirupsen/logrus.Traceln",
+		"(*github.com/sirupsen/logrus.Logger).Debug",
+		"(*github.com/sirupsen/logrus.Logger).Debugf",
+		"(*github.com/sirupsen/logrus.Logger).Debugln",
+		"(*github.com/sirupsen/logrus.Logger).Trace",
+		"(*github.com/sirupsen/logrus.Logger).Tracef",
+		"(*github.com/sirupsen/logrus.Logger).Traceln",
+		"(*github.com/sirupsen/logrus.Entry).Debug",
+		"(*github.com/sirupsen/logrus.Entry).Debugf",
+		"(*github.com/sirupsen/logrus.Entry).Debugln",
+		"(*github.com/sirupsen/logrus.Entry).Trace",
+		"(*github.com/sirupsen/logrus.Entry).Tracef",
+		"(*github.com/sirupsen/logrus.Entry).Traceln",
+		"(*go.uber.org/zap.Logger).Debug",
+		"(*go.uber.org/zap.SugaredLogger).Debug",
+		"(*go.uber.org/zap.SugaredLogger).Debugf",
+		"(*go.uber.org/zap.SugaredLogger).Debugw",
+	}, ","))
+	Analyzer.Flags.Var(&funcs, "funcs",
+		"comma-separated list of debug-level log functions")
+
+	guards.Set(strings.Join([]string{
+		"github.com/sirupsen/logrus.IsLevelEnabled",
+		"(*github.com/sirupsen/logrus.Logger).IsLevelEnabled",
+		"(*github.com/sirupsen/logrus.Logger).GetLevel",
+		"github.com/sirupsen/logrus.GetLevel",
+		"(*go.uber.org/zap.Logger).Core",
+		"(go.uber.org/zap/zapcore.Level).Enabled",
+		"(go.uber.org/zap/zapcore.LevelEnabler).Enabled",
+	}, ","))
+	Analyzer.Flags.Var(&guards, "guards",
+		"comma-separated list of functions that check whether a log level is enabled")
+
+	expensive.Set(strings.Join([]string{
+		"fmt.Sprint",
+		"fmt.Sprintf",
+		"fmt.Sprintln",
+		"encoding/json.Marshal",
+		"encoding/json.MarshalIndent",
+		"github.com/davecgh/go-spew/spew.Sdump",
+		"github.com/davecgh/go-spew/spew.Sprintf",
+	}, ","))
+	Analyzer.Flags.Var(&expensive, "expensive",
+		"comma-separated list of functions too expensive to call for a disabled log level")
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{
+		(*ast.CallExpr)(nil),
+	}
+	inspect.WithStack(nodeFilter, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		call := n.(*ast.CallExpr)
+		log := callee(pass, call)
+		if log == nil || !funcs[log.FullName()] || guarded(pass, stack) {
+			return true
+		}
+		for _, arg := range call.Args {
+			ast.Inspect(arg, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncLit:
+					return false // not called by the argument itself
+				case *ast.CallExpr:
+					if fn := callee(pass, n); fn != nil && expensive[fn.FullName()] {
+						pass.ReportRangef(n, "%s is called even if the level of %s is disabled; check the level first",
+							fn.FullName(), log.FullName())
+					}
+				}
+				return true
+			})
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// callee returns the function or method called by call, or nil.
+func callee(pass *analysis.Pass, call *ast.CallExpr) *types.Func {
+	fn, _ := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	return fn
+}
+
+// guarded reports whether the last node of stack is in the body of an if
+// statement whose condition calls one of the level checks.
+func guarded(pass *analysis.Pass, stack []ast.Node) bool {
+	for i := len(stack) - 2; i >= 0; i-- {
+		n, ok := stack[i].(*ast.IfStmt)
+		if !ok || stack[i+1] != n.Body {
+			continue
+		}
+		found := false
+		ast.Inspect(n.Cond, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				if fn := callee(pass, call); fn != nil && guards[fn.FullName()] {
+					found = true
+				}
+			}
+			return !found
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+type stringSetFlag map[string]bool
+
+func (ss *stringSetFlag) String() string {
+	var items []string
+	for item := range *ss {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (ss *stringSetFlag) Set(s string) error {
+	m := make(map[string]bool) // clobber previous value
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			m[name] = true
+		}
+	}
+	*ss = m
+	return nil
+}
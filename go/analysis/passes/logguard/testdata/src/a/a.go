@@ -0,0 +1,37 @@
+package a
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+type request struct{ Path string }
+
+func handle(log *logrus.Logger, req *request) {
+	logrus.Debug(fmt.Sprintf("request %v", req)) // want `fmt.Sprintf is called even if the level of github.com/sirupsen/logrus.Debug is disabled; check the level first`
+	log.Debugf("request %s", fmt.Sprint(req))    // want `fmt.Sprint is called even if the level of \(\*github.com/sirupsen/logrus.Logger\).Debugf is disabled`
+
+	data, _ := json.Marshal(req)
+	log.Debugf("request %s", data)                  // ok: not evaluated in the argument
+	log.Debugf("request %s", req.Path)              // ok: cheap
+	log.Infof("request %s", fmt.Sprintf("%v", req)) // ok: not a debug-level call
+
+	if log.IsLevelEnabled(logrus.DebugLevel) {
+		log.Debugf("request %s", fmt.Sprint(req)) // ok: guarded
+	}
+	if req != nil && logrus.IsLevelEnabled(logrus.DebugLevel) {
+		j, _ := json.Marshal(req)
+		logrus.Debugf("request %s", j)
+		logrus.Debug(json.Marshal(req)) // ok: guarded
+	}
+	if log.IsLevelEnabled(logrus.DebugLevel) {
+	} else {
+		logrus.Debug(fmt.Sprint(req)) // want `fmt.Sprint is called`
+	}
+	if req != nil {
+		logrus.Debugf("%s", fmt.Sprintf("%v", req)) // want `fmt.Sprintf is called`
+	}
+	logrus.Debug(func() string { return fmt.Sprint(req) }) // ok: not called
+}
@@ -0,0 +1,19 @@
+package logrus
+
+type Level uint32
+
+const (
+	InfoLevel Level = iota
+	DebugLevel
+)
+
+type Logger struct{ Level Level }
+
+func (l *Logger) IsLevelEnabled(level Level) bool           { return l.Level >= level }
+func (l *Logger) Debugf(format string, args ...interface{}) {}
+func (l *Logger) Infof(format string, args ...interface{})  {}
+
+func IsLevelEnabled(level Level) bool           { return false }
+func Debug(args ...interface{})                 {}
+func Debugf(format string, args ...interface{}) {}
+func Infof(format string, args ...interface{})  {}
@@ -0,0 +1,9 @@
+// The narrowconv command runs the narrowconv analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/narrowconv"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(narrowconv.Analyzer) }
@@ -0,0 +1,426 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package narrowconv defines an Analyzer that reports narrowing integer
+// conversions of lengths, byte counts, and parsed or decoded input
+// that are not preceded by a bounds check.
+package narrowconv
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+	"github.com/jackie-feng/tools/go/types/typeutil"
+)
+
+const Doc = `check for narrowing integer conversions of unchecked input
+
+A conversion to a smaller integer type silently drops the high bits of
+its operand. When the operand is a length, the count returned by a Read
+method, or a number parsed or decoded from input, a large value wraps
+around, which is a common source of overflow bugs:
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	...
+	buf := make([]byte, int32(n)) // may truncate n
+
+This checker reports such conversions, unless the operand is compared
+with another value before the conversion, as in a bounds check:
+
+	if n > math.MaxInt32 {
+		return errTooLarge
+	}
+	buf := make([]byte, int32(n))
+
+The comparison must be in an earlier statement of a block enclosing the
+conversion, or in the condition of a statement enclosing it, and not in
+a branch that may be skipped. Likewise, a variable no longer holds input
+once it is assigned another value in such a position.
+
+The int, uint, and uintptr types are assumed to be 32 bits wide when
+converting to them, and 64 bits wide when converting from them, so the
+reports do not depend on the target platform.
+
+This analyzer is not run by go vet, as it reports conversions that may
+be safe for reasons it cannot see.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "narrowconv",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// inputFuncs are the functions and methods whose integer results are
+// derived from input.
+var inputFuncs = map[string]bool{
+	"strconv.Atoi":                          true,
+	"strconv.ParseInt":                      true,
+	"strconv.ParseUint":                     true,
+	"io.ReadFull":                           true,
+	"io.ReadAtLeast":                        true,
+	"io.Copy":                               true,
+	"io.CopyN":                              true,
+	"encoding/binary.ReadUvarint":           true,
+	"encoding/binary.ReadVarint":            true,
+	"encoding/binary.Uvarint":               true,
+	"encoding/binary.Varint":                true,
+	"(encoding/binary.bigEndian).Uint16":    true,
+	"(encoding/binary.bigEndian).Uint32":    true,
+	"(encoding/binary.bigEndian).Uint64":    true,
+	"(encoding/binary.littleEndian).Uint16": true,
+	"(encoding/binary.littleEndian).Uint32": true,
+	"(encoding/binary.littleEndian).Uint64": true,
+	"(encoding/binary.ByteOrder).Uint16":    true,
+	"(encoding/binary.ByteOrder).Uint32":    true,
+	"(encoding/binary.ByteOrder).Uint64":    true,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{
+		(*ast.FuncDecl)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		if body := n.(*ast.FuncDecl).Body; body != nil {
+			checkFunc(pass, body)
+		}
+	})
+	return nil, nil
+}
+
+// A function is the state of the check of a function body.
+type function struct {
+	pass *analysis.Pass
+
+	// assigns maps each variable to its assignments, in source order.
+	assigns map[types.Object][]event
+
+	// comparedVars and comparedExprs map the variables and expressions
+	// that are compared with other values to their comparisons.
+	comparedVars  map[types.Object][]event
+	comparedExprs map[string][]event
+}
+
+// An event is an assignment or a comparison in the function body.
+type event struct {
+	pos  token.Pos
+	path []ast.Node // from the function body to the node of the event
+
+	// source describes the input that an assignment stores in its
+	// variable, or is "" if it stores no input.
+	source string
+}
+
+func checkFunc(pass *analysis.Pass, body *ast.BlockStmt) {
+	f := &function{
+		pass:          pass,
+		assigns:       make(map[types.Object][]event),
+		comparedVars:  make(map[types.Object][]event),
+		comparedExprs: make(map[string][]event),
+	}
+	// Visit the assignments, bounds checks and conversions in source
+	// order, so that each conversion sees the events before it.
+	var stack []ast.Node
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			f.assign(n.Tok, n.Lhs, n.Rhs, copyPath(stack))
+		case *ast.ValueSpec:
+			lhs := make([]ast.Expr, len(n.Names))
+			for i, name := range n.Names {
+				lhs[i] = name
+			}
+			f.assign(token.DEFINE, lhs, n.Values, copyPath(stack))
+		case *ast.BinaryExpr:
+			switch n.Op {
+			case token.LSS, token.LEQ, token.GTR, token.GEQ, token.EQL, token.NEQ:
+				path := copyPath(stack)
+				f.compare(n.X, path)
+				f.compare(n.Y, path)
+			}
+		case *ast.CallExpr:
+			f.checkConversion(n, stack)
+		}
+		return true
+	})
+}
+
+func copyPath(stack []ast.Node) []ast.Node {
+	return append([]ast.Node(nil), stack...)
+}
+
+// assign records the assignment of rhs to lhs with the token tok by the
+// node at the end of path, and the input that each variable on the
+// left-hand side holds after it.
+func (f *function) assign(tok token.Token, lhs, rhs []ast.Expr, path []ast.Node) {
+	node := path[len(path)-1]
+	for i, e := range lhs {
+		id, ok := e.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		obj := f.pass.TypesInfo.ObjectOf(id)
+		if obj == nil {
+			continue
+		}
+		source := ""
+		switch {
+		case len(lhs) == len(rhs):
+			source = f.source(rhs[i], node.Pos(), path)
+			switch tok {
+			case token.ADD_ASSIGN, token.SUB_ASSIGN, token.MUL_ASSIGN, token.SHL_ASSIGN, token.OR_ASSIGN:
+				if source == "" {
+					source = f.source(e, node.Pos(), path)
+				}
+			}
+		case len(rhs) == 1 && i == 0:
+			// The first result of a call such as n, err := r.Read(buf).
+			if call, ok := unparen(rhs[0]).(*ast.CallExpr); ok {
+				source = f.callSource(call)
+			}
+		}
+		f.assigns[obj] = append(f.assigns[obj], event{node.End(), path, source})
+	}
+}
+
+// compare records a comparison of e by the node at the end of path.
+func (f *function) compare(e ast.Expr, path []ast.Node) {
+	e = unparen(e)
+	c := event{pos: path[len(path)-1].Pos(), path: path}
+	if id, ok := e.(*ast.Ident); ok {
+		if obj := f.pass.TypesInfo.ObjectOf(id); obj != nil {
+			f.comparedVars[obj] = append(f.comparedVars[obj], c)
+		}
+		return
+	}
+	key := types.ExprString(e)
+	f.comparedExprs[key] = append(f.comparedExprs[key], c)
+}
+
+// source returns a description of the input that e, evaluated at pos
+// by the node at the end of path, is derived from, or "" if it is not
+// derived from input.
+func (f *function) source(e ast.Expr, pos token.Pos, path []ast.Node) string {
+	switch e := unparen(e).(type) {
+	case *ast.Ident:
+		if obj := f.pass.TypesInfo.ObjectOf(e); obj != nil {
+			return f.varSource(obj, pos, path)
+		}
+	case *ast.CallExpr:
+		if tv, ok := f.pass.TypesInfo.Types[e.Fun]; ok && tv.IsType() && len(e.Args) == 1 {
+			return f.source(e.Args[0], pos, path)
+		}
+		return f.callSource(e)
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.ADD, token.SUB, token.MUL, token.SHL, token.OR:
+			if s := f.source(e.X, pos, path); s != "" {
+				return s
+			}
+			return f.source(e.Y, pos, path)
+		}
+	}
+	return ""
+}
+
+// varSource returns a description of the input that the variable obj
+// may hold at pos, or "" if it holds no input there. An assignment that
+// dominates the node at the end of path replaces the values stored by
+// the assignments before it; any other assignment of input adds to them.
+func (f *function) varSource(obj types.Object, pos token.Pos, path []ast.Node) string {
+	source := ""
+	for _, a := range f.assigns[obj] {
+		if a.pos < pos && (a.source != "" || dominates(a.path, path)) {
+			source = a.source
+		}
+	}
+	return source
+}
+
+// callSource returns a description of the input that the first result of
+// call is derived from, or "" if it is not derived from input.
+func (f *function) callSource(call *ast.CallExpr) string {
+	switch fn := typeutil.Callee(f.pass.TypesInfo, call).(type) {
+	case *types.Builtin:
+		if fn.Name() == "len" || fn.Name() == "cap" {
+			return fn.Name()
+		}
+	case *types.Func:
+		sig := fn.Type().(*types.Signature)
+		if sig.Recv() != nil && (fn.Name() == "Read" || fn.Name() == "ReadAt") {
+			return fn.Name()
+		}
+		if inputFuncs[fn.FullName()] {
+			if fn.Pkg() != nil && sig.Recv() == nil {
+				return fn.Pkg().Name() + "." + fn.Name()
+			}
+			return fn.Name()
+		}
+	}
+	return ""
+}
+
+// checkConversion reports call, at the end of path, if it is a narrowing
+// integer conversion of input that has not been compared with anything
+// before.
+func (f *function) checkConversion(call *ast.CallExpr, path []ast.Node) {
+	info := f.pass.TypesInfo
+	tv, ok := info.Types[call.Fun]
+	if !ok || !tv.IsType() || len(call.Args) != 1 {
+		return
+	}
+	arg := call.Args[0]
+	if info.Types[arg].Value != nil {
+		return // constants are checked by the compiler
+	}
+	to, ok := tv.Type.Underlying().(*types.Basic)
+	if !ok || to.Info()&types.IsInteger == 0 {
+		return
+	}
+	from, ok := info.TypeOf(arg).Underlying().(*types.Basic)
+	if !ok || from.Info()&types.IsInteger == 0 {
+		return
+	}
+	if f.maxSize(from) <= f.minSize(to) {
+		return
+	}
+	source := f.source(arg, call.Pos(), path)
+	if source == "" || f.checked(arg, call.Pos(), path) {
+		return
+	}
+	f.pass.Reportf(call.Pos(), "conversion of %s from %s to %s may truncate input from %s without a bounds check",
+		types.ExprString(arg), from, tv.Type, source)
+}
+
+// checked reports whether e, or a variable in e, is compared with another
+// value by a comparison that dominates the node at pos at the end of
+// path. The comparison of a variable must follow the last assignment of
+// input to it.
+func (f *function) checked(e ast.Expr, pos token.Pos, path []ast.Node) bool {
+	for _, c := range f.comparedExprs[types.ExprString(unparen(e))] {
+		if c.pos < pos && dominates(c.path, path) {
+			return true
+		}
+	}
+	found := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return !found
+		}
+		obj := f.pass.TypesInfo.ObjectOf(id)
+		if obj == nil {
+			return false
+		}
+		assigned := token.NoPos
+		for _, a := range f.assigns[obj] {
+			if a.pos < pos && a.source != "" {
+				assigned = a.pos
+			}
+		}
+		for _, c := range f.comparedVars[obj] {
+			if assigned < c.pos && c.pos < pos && dominates(c.path, path) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// dominates reports whether the node at the end of the path x is always
+// evaluated before the node at the end of the path p, judging by the
+// syntax alone: x must be in an earlier statement of a block enclosing p,
+// or in the condition of a statement enclosing p, and not in a branch
+// that is only taken conditionally. Jumps are not considered.
+func dominates(x, p []ast.Node) bool {
+	i := 0
+	for i < len(x) && i < len(p) && x[i] == p[i] {
+		i++
+	}
+	if i == 0 || i == len(x) || i == len(p) {
+		return false // one node encloses the other
+	}
+	for j := i + 1; j < len(x); j++ {
+		if !evaluated(x[j-1], x[j]) {
+			return false
+		}
+	}
+	cx, cp := x[i], p[i]
+	switch parent := x[i-1].(type) {
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+		return cx.Pos() < cp.Pos()
+	case *ast.BinaryExpr:
+		return (parent.Op == token.LAND || parent.Op == token.LOR) && cx == parent.X
+	}
+	return evaluated(x[i-1], cx) && cx.Pos() < cp.Pos()
+}
+
+// evaluated reports whether the child of parent is evaluated whenever
+// parent is.
+func evaluated(parent, child ast.Node) bool {
+	switch parent := parent.(type) {
+	case *ast.IfStmt:
+		return child == parent.Init || child == parent.Cond
+	case *ast.ForStmt:
+		return child == parent.Init || child == parent.Cond
+	case *ast.RangeStmt:
+		return child == parent.X
+	case *ast.SwitchStmt:
+		return child == parent.Init || child == parent.Tag
+	case *ast.TypeSwitchStmt:
+		return child == parent.Init || child == parent.Assign
+	case *ast.CaseClause:
+		// The expressions of a case are evaluated before the later
+		// cases, but its body is not.
+		for _, e := range parent.List {
+			if child == e {
+				return true
+			}
+		}
+		return false
+	case *ast.SelectStmt, *ast.CommClause, *ast.FuncLit:
+		return false
+	}
+	return true
+}
+
+// minSize and maxSize return the smallest and largest sizes of t
+// across platforms.
+func (f *function) minSize(t *types.Basic) int64 {
+	switch t.Kind() {
+	case types.Int, types.Uint, types.Uintptr:
+		return 4
+	}
+	return f.pass.TypesSizes.Sizeof(t)
+}
+
+func (f *function) maxSize(t *types.Basic) int64 {
+	switch t.Kind() {
+	case types.Int, types.Uint, types.Uintptr:
+		return 8
+	}
+	return f.pass.TypesSizes.Sizeof(t)
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the narrowconv checker.
+
+package a
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+)
+
+func parsed(s string) int32 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return int32(n) // want "conversion of n from int64 to int32 may truncate input from strconv.ParseInt without a bounds check"
+}
+
+func parsedChecked(s string) int32 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n > math.MaxInt32 || n < math.MinInt32 {
+		return 0
+	}
+	return int32(n)
+}
+
+func length(b []byte) uint16 {
+	return uint16(len(b)) // want "conversion of len\\(b\\) from int to uint16 may truncate input from len without a bounds check"
+}
+
+func lengthChecked(b []byte) uint16 {
+	if len(b) > math.MaxUint16 {
+		panic("too long")
+	}
+	return uint16(len(b))
+}
+
+func read(r io.Reader, buf []byte) byte {
+	n, _ := r.Read(buf)
+	total := n + 1
+	return byte(total) // want "conversion of total from int to byte may truncate input from Read without a bounds check"
+}
+
+func decoded(b []byte) int {
+	size := binary.BigEndian.Uint64(b)
+	return int(size) // want "conversion of size from uint64 to int may truncate input from Uint64 without a bounds check"
+}
+
+func widening(b []byte, s string) {
+	n, _ := strconv.Atoi(s)
+	_ = int64(n)
+	_ = int64(len(b))
+	_ = uint32(binary.LittleEndian.Uint16(b))
+}
+
+func notInput(x int64) int32 {
+	return int32(x)
+}
+
+func constant() int8 {
+	const big = 1000
+	return int8(big % 100)
+}
+
+func reassigned(s string) int8 {
+	n, _ := strconv.Atoi(s)
+	n = 0
+	return int8(n)
+}
+
+func reassignedInBranch(s string, reset bool) int8 {
+	n, _ := strconv.Atoi(s)
+	if reset {
+		n = 0
+	}
+	return int8(n) // want "conversion of n from int to int8 may truncate input from strconv.Atoi without a bounds check"
+}
+
+func assignedInBranch(s string, parse bool) int8 {
+	n := 0
+	if parse {
+		n, _ = strconv.Atoi(s)
+	}
+	return int8(n) // want "conversion of n from int to int8 may truncate input from strconv.Atoi without a bounds check"
+}
+
+func added(s string) int8 {
+	n, _ := strconv.Atoi(s)
+	n += 1
+	return int8(n) // want "conversion of n from int to int8 may truncate input from strconv.Atoi without a bounds check"
+}
+
+func masked(s string) int8 {
+	n, _ := strconv.Atoi(s)
+	n &= math.MaxInt8
+	return int8(n)
+}
+
+func reparsed(s, t string) int8 {
+	n, _ := strconv.Atoi(s)
+	if n > math.MaxInt8 {
+		return 0
+	}
+	n, _ = strconv.Atoi(t)
+	return int8(n) // want "conversion of n from int to int8 may truncate input from strconv.Atoi without a bounds check"
+}
+
+func checkedInCondition(s string) int8 {
+	n, _ := strconv.Atoi(s)
+	if n >= math.MinInt8 && n <= math.MaxInt8 {
+		return int8(n)
+	}
+	return 0
+}
+
+func checkedInCase(b []byte) uint8 {
+	switch {
+	case len(b) > math.MaxUint8:
+		return 0
+	default:
+		return uint8(len(b))
+	}
+}
+
+func checkedInBranch(s string, strict bool) int8 {
+	n, _ := strconv.Atoi(s)
+	if strict {
+		if n > math.MaxInt8 {
+			return 0
+		}
+	}
+	return int8(n) // want "conversion of n from int to int8 may truncate input from strconv.Atoi without a bounds check"
+}
+
+func checkedAfter(s string) int8 {
+	n, _ := strconv.Atoi(s)
+	m := int8(n) // want "conversion of n from int to int8 may truncate input from strconv.Atoi without a bounds check"
+	if n > math.MaxInt8 {
+		return 0
+	}
+	return m
+}
+
+func checkedInClosure(s string) int8 {
+	n, _ := strconv.Atoi(s)
+	tooLarge := func() bool { return n > math.MaxInt8 }
+	_ = tooLarge
+	return int8(n) // want "conversion of n from int to int8 may truncate input from strconv.Atoi without a bounds check"
+}
@@ -0,0 +1,9 @@
+// The narrowscope command runs the narrowscope analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/narrowscope"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(narrowscope.Analyzer) }
@@ -0,0 +1,421 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package narrowscope defines an Analyzer that reports local variables
+// declared in a wider scope than the block in which they are used.
+package narrowscope
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+)
+
+const Doc = `check for variables that may be declared in a narrower scope
+
+A variable that is declared at the start of a function, but used in a
+single branch of an if or switch statement, stays in scope after the
+branch, where it can be read or reused by mistake:
+
+	var err error
+	if update {
+		err = save(x)
+		if err != nil {
+			return err
+		}
+	}
+	... // err is still in scope, and may be nil or stale
+
+Declaring the variable in the branch makes it clear that its value does
+not outlive the branch:
+
+	if update {
+		var err error
+		...
+	}
+
+This checker reports such declarations, with a fix that moves them into
+the innermost block in which the variable is used. Only declarations
+whose value can be computed later without changing the meaning of the
+program are reported: declarations without an initial value, or with a
+constant or composite literal one. Declarations are not moved into loop
+bodies or function literals.
+
+With the -restrict flag, only variables of type error, and of types with
+a Close method, which hold a resource, are reported.
+
+This analyzer is not run by go vet, as it reports a matter of style.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "narrowscope",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+var restrict = false
+
+func init() {
+	Analyzer.Flags.BoolVar(&restrict, "restrict", restrict, "only report variables of type error, and of types with a Close method")
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{
+		(*ast.FuncDecl)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		body := n.(*ast.FuncDecl).Body
+		// A goto statement may not jump over a declaration into its block.
+		if body == nil || hasGoto(body) {
+			return
+		}
+		ast.Inspect(body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BlockStmt:
+				checkList(pass, n.List)
+			case *ast.CaseClause:
+				checkList(pass, n.Body)
+			case *ast.CommClause:
+				checkList(pass, n.Body)
+			}
+			return true
+		})
+	})
+	return nil, nil
+}
+
+// checkList reports the declarations of the statement list that may be
+// moved into a block nested in the statements that follow them.
+func checkList(pass *analysis.Pass, list []ast.Stmt) {
+	for i, stmt := range list {
+		id, value := declaration(stmt)
+		if id == nil {
+			continue
+		}
+		obj, ok := pass.TypesInfo.Defs[id].(*types.Var)
+		if !ok {
+			continue
+		}
+		if restrict && !errorOrResource(obj.Type()) {
+			continue
+		}
+		if value != nil && !pure(pass.TypesInfo, value) {
+			continue
+		}
+		var uses []*ast.Ident
+		for _, s := range list[i+1:] {
+			ast.Inspect(s, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && pass.TypesInfo.Uses[id] == obj {
+					uses = append(uses, id)
+				}
+				return true
+			})
+		}
+		if len(uses) == 0 {
+			continue
+		}
+		block, before := narrowest(list[i+1:], uses)
+		if block == nil {
+			continue
+		}
+		pass.Report(analysis.Diagnostic{
+			Pos:            id.Pos(),
+			End:            id.End(),
+			Message:        fmt.Sprintf("%s is only used in the block at line %d; declare it there", id.Name, pass.Fset.Position(block.Pos()).Line),
+			SuggestedFixes: moveFix(pass, list, i, block, before),
+		})
+	}
+}
+
+// declaration returns the variable declared by stmt, and its initial value,
+// if stmt declares a single variable.
+func declaration(stmt ast.Stmt) (*ast.Ident, ast.Expr) {
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		if stmt.Tok != token.DEFINE || len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+			return nil, nil
+		}
+		if id, ok := stmt.Lhs[0].(*ast.Ident); ok && id.Name != "_" {
+			return id, stmt.Rhs[0]
+		}
+	case *ast.DeclStmt:
+		decl, ok := stmt.Decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.VAR || len(decl.Specs) != 1 {
+			return nil, nil
+		}
+		spec := decl.Specs[0].(*ast.ValueSpec)
+		if len(spec.Names) != 1 || spec.Names[0].Name == "_" {
+			return nil, nil
+		}
+		switch len(spec.Values) {
+		case 0:
+			return spec.Names[0], nil
+		case 1:
+			return spec.Names[0], spec.Values[0]
+		}
+	}
+	return nil, nil
+}
+
+// narrowest returns the innermost block, nested in the statements of list
+// through branches of if, switch and select statements, that contains all
+// of uses, along with the statement of the block that contains the first
+// use. It returns a nil block if the uses are in more than one statement
+// of list, or in a statement that has no such branch.
+func narrowest(list []ast.Stmt, uses []*ast.Ident) (ast.Node, ast.Stmt) {
+	var block ast.Node
+	for {
+		var first ast.Stmt
+		for _, s := range list {
+			if contains(s, uses[0]) {
+				first = s
+				break
+			}
+		}
+		if first == nil || !contains(first, uses...) {
+			return block, first
+		}
+		inner, innerList := branch(first, uses)
+		if inner == nil {
+			return block, first
+		}
+		block, list = inner, innerList
+	}
+}
+
+// branch returns the block of a branch of stmt that contains all of uses,
+// and its statements, or nil.
+func branch(stmt ast.Stmt, uses []*ast.Ident) (ast.Node, []ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		return stmt, stmt.List
+	case *ast.LabeledStmt:
+		return branch(stmt.Stmt, uses)
+	case *ast.IfStmt:
+		if contains(stmt.Body, uses...) {
+			return stmt.Body, stmt.Body.List
+		}
+		if stmt.Else != nil && contains(stmt.Else, uses...) {
+			return branch(stmt.Else, uses)
+		}
+	case *ast.SwitchStmt:
+		return clause(stmt.Body, uses)
+	case *ast.TypeSwitchStmt:
+		return clause(stmt.Body, uses)
+	case *ast.SelectStmt:
+		return clause(stmt.Body, uses)
+	}
+	return nil, nil
+}
+
+// clause returns the case clause of the body of a switch or select
+// statement whose statements contain all of uses, and its statements, or nil.
+func clause(body *ast.BlockStmt, uses []*ast.Ident) (ast.Node, []ast.Stmt) {
+	for _, c := range body.List {
+		var list []ast.Stmt
+		switch c := c.(type) {
+		case *ast.CaseClause:
+			list = c.Body
+		case *ast.CommClause:
+			list = c.Body
+		}
+		if len(list) == 0 {
+			continue
+		}
+		start, end := list[0].Pos(), list[len(list)-1].End()
+		inside := true
+		for _, id := range uses {
+			if id.Pos() < start || id.End() > end {
+				inside = false
+				break
+			}
+		}
+		if inside {
+			return c, list
+		}
+	}
+	return nil, nil
+}
+
+// contains reports whether all of ids are inside n.
+func contains(n ast.Node, ids ...*ast.Ident) bool {
+	for _, id := range ids {
+		if id.Pos() < n.Pos() || id.End() > n.End() {
+			return false
+		}
+	}
+	return true
+}
+
+// moveFix returns the fix that moves the declaration list[i] to the line
+// before the statement before of block, or nil if the declaration cannot
+// be moved safely, or its statement list has several statements on a line.
+func moveFix(pass *analysis.Pass, list []ast.Stmt, i int, block ast.Node, before ast.Stmt) []analysis.SuggestedFix {
+	decl, next := list[i], list[i+1]
+	line := func(pos token.Pos) int { return pass.Fset.Position(pos).Line }
+	if line(decl.End()) == line(next.Pos()) || line(block.Pos()) == line(before.Pos()) {
+		return nil
+	}
+	// Keep the comments that follow the declaration.
+	for _, f := range pass.Files {
+		if f.Pos() > decl.Pos() || decl.Pos() > f.End() {
+			continue
+		}
+		for _, cg := range f.Comments {
+			if cg.Pos() >= decl.End() && cg.Pos() < next.Pos() {
+				return nil
+			}
+		}
+	}
+	// The variable must not be declared in the block already, after the
+	// uses, and the names in its declaration must refer to the same
+	// objects in the block.
+	id, _ := declaration(decl)
+	if scope := pass.TypesInfo.Scopes[block]; scope == nil || scope.Lookup(id.Name) != nil {
+		return nil
+	}
+	scope := pass.Pkg.Scope().Innermost(before.Pos())
+	if scope == nil {
+		return nil
+	}
+	same := true
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					same = same && sameObject(pass, scope, id, before.Pos())
+				}
+				return true
+			})
+			return false
+		case *ast.KeyValueExpr:
+			// The key of a struct literal is a field name.
+			if _, ok := pass.TypesInfo.Types[n.Key]; !ok {
+				ast.Inspect(n.Value, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok {
+						same = same && sameObject(pass, scope, id, before.Pos())
+					}
+					return true
+				})
+				return false
+			}
+		case *ast.Ident:
+			same = same && sameObject(pass, scope, n, before.Pos())
+		}
+		return true
+	})
+	if !same {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, pass.Fset, decl); err != nil {
+		return nil
+	}
+	indent := strings.Repeat("\t", pass.Fset.Position(before.Pos()).Column-1)
+	buf.WriteString("\n" + indent)
+	return []analysis.SuggestedFix{{
+		Message: fmt.Sprintf("Move the declaration of %s into the block", id.Name),
+		TextEdits: []analysis.TextEdit{
+			{Pos: decl.Pos(), End: next.Pos()},
+			{Pos: before.Pos(), End: before.Pos(), NewText: buf.Bytes()},
+		},
+	}}
+}
+
+// sameObject reports whether id, in the declaration that is moved, refers
+// to the same object at pos in scope. The declared variable itself, and
+// identifiers that refer to no object, such as blank ones, are the same
+// anywhere.
+func sameObject(pass *analysis.Pass, scope *types.Scope, id *ast.Ident, pos token.Pos) bool {
+	obj := pass.TypesInfo.Uses[id]
+	if obj == nil {
+		return true
+	}
+	_, found := scope.LookupParent(id.Name, pos)
+	return found == obj
+}
+
+// pure reports whether evaluating e has no effect and always yields an
+// equal value, so that it may be evaluated later instead.
+func pure(info *types.Info, e ast.Expr) bool {
+	if tv, ok := info.Types[e]; ok && (tv.Value != nil || tv.IsNil()) {
+		return true
+	}
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		return pure(info, e.X)
+	case *ast.CompositeLit:
+		for _, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				// Struct literal keys are field names, which have no type.
+				if _, ok := info.Types[kv.Key]; ok && !pure(info, kv.Key) {
+					return false
+				}
+				elt = kv.Value
+			}
+			if !pure(info, elt) {
+				return false
+			}
+		}
+		return true
+	case *ast.UnaryExpr:
+		_, lit := e.X.(*ast.CompositeLit)
+		return e.Op == token.AND && lit && pure(info, e.X)
+	case *ast.CallExpr:
+		if info.Types[e.Fun].IsType() {
+			return len(e.Args) == 1 && pure(info, e.Args[0])
+		}
+		id, ok := e.Fun.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		if b, ok := info.Uses[id].(*types.Builtin); !ok || b.Name() != "make" && b.Name() != "new" {
+			return false
+		}
+		for _, arg := range e.Args[1:] {
+			if !pure(info, arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// errorOrResource reports whether t is the error type, or has a Close
+// method that releases the resource it holds.
+func errorOrResource(t types.Type) bool {
+	if types.Identical(t, errorType) {
+		return true
+	}
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "Close")
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// hasGoto reports whether body contains a goto statement.
+func hasGoto(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if b, ok := n.(*ast.BranchStmt); ok && b.Tok == token.GOTO {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
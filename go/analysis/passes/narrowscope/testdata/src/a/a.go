@@ -0,0 +1,110 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the narrowscope checker.
+
+package a
+
+func save(int) error { return nil }
+
+func use(interface{}) {}
+
+func newError() error { return nil }
+
+func ifBranch(update bool) error {
+	var err error // want "err is only used in the block at line 17; declare it there"
+	if update {
+		use(1)
+		err = save(1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func elseBranch(update bool) {
+	n := 0 // want "n is only used in the block at line 30; declare it there"
+	if update {
+	} else {
+		n++
+		use(n)
+	}
+}
+
+func nested(a, b bool) {
+	s := []string{"x"} // want "s is only used in the block at line 39; declare it there"
+	if a {
+		if b {
+			use(s)
+		}
+	}
+}
+
+func switchCase(k int) {
+	p := &struct{ x int }{x: 1} // want "p is only used in the block at line 48; declare it there"
+	switch k {
+	case 1:
+		use(p)
+	case 2:
+	}
+}
+
+func usedAfter(update bool) error {
+	var err error
+	if update {
+		err = save(1)
+	}
+	return err
+}
+
+func severalBranches(a bool) {
+	var n int
+	if a {
+		use(n)
+	} else {
+		use(n)
+	}
+}
+
+func condition(a bool) {
+	var n int
+	if n == 0 {
+		use(n)
+	}
+}
+
+func loop(s []int) {
+	var total int // declarations are not moved into loop bodies
+	for _, x := range s {
+		total += x
+		use(total)
+	}
+}
+
+func closure(a bool) {
+	var n int
+	f := func() {
+		n++
+	}
+	if a {
+		f()
+	}
+}
+
+func notPure(a bool) {
+	err := newError()
+	if a {
+		use(err)
+	}
+}
+
+func withGoto(a bool) {
+	var n int
+	if a {
+	L:
+		use(n)
+		goto L
+	}
+}
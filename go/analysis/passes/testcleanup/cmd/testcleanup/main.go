@@ -0,0 +1,9 @@
+// The testcleanup command runs the testcleanup analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/testcleanup"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(testcleanup.Analyzer) }
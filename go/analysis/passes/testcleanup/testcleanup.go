@@ -0,0 +1,508 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package testcleanup defines an Analyzer that reports tests that set an
+// environment variable or create a temporary directory, and undo it with
+// a deferred call, where the testing package can do it for them.
+package testcleanup
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+	"github.com/jackie-feng/tools/go/types/typeutil"
+)
+
+const Doc = `check for tests that may use t.Setenv or t.TempDir
+
+Tests that set an environment variable, or create a temporary directory,
+often undo it with a deferred call:
+
+	old := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", old)
+
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+The Setenv and TempDir methods of testing.T and testing.B do the same,
+and undo it when the test and its subtests complete:
+
+	t.Setenv("HOME", home)
+
+	dir := t.TempDir()
+
+This checker reports the statements of tests and benchmarks that may be
+replaced by these methods, when the version of the testing package has
+them, with a fix that rewrites them. Tests that call t.Parallel are not
+reported for environment variables, as t.Setenv panics in parallel tests.
+
+This analyzer is not run by go vet, as it reports a matter of style.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "testcleanup",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{
+		(*ast.FuncDecl)(nil),
+		(*ast.FuncLit)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		if !strings.HasSuffix(pass.Fset.Position(n.Pos()).Filename, "_test.go") {
+			return
+		}
+		var typ *ast.FuncType
+		var body *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			typ, body = n.Type, n.Body
+		case *ast.FuncLit:
+			typ, body = n.Type, n.Body
+		}
+		t := testingParam(pass, typ)
+		if t == nil || body == nil {
+			return
+		}
+		c := &checker{pass: pass, t: t}
+		c.setenv = hasMethod(pass, t, "Setenv") && !callsParallel(pass, body, t)
+		c.tempDir = hasMethod(pass, t, "TempDir")
+		if !c.setenv && !c.tempDir {
+			return
+		}
+		// Function literals in the body are visited on their own, if
+		// they have a testing parameter.
+		ast.Inspect(body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.BlockStmt:
+				c.checkList(n.List)
+			case *ast.CaseClause:
+				c.checkList(n.Body)
+			case *ast.CommClause:
+				c.checkList(n.Body)
+			}
+			return true
+		})
+	})
+	return nil, nil
+}
+
+// testingParam returns the parameter of a function that is a *testing.T,
+// a *testing.B or a testing.TB, or nil if it has none.
+func testingParam(pass *analysis.Pass, typ *ast.FuncType) *types.Var {
+	for _, field := range typ.Params.List {
+		for _, name := range field.Names {
+			v, ok := pass.TypesInfo.Defs[name].(*types.Var)
+			if !ok || name.Name == "_" {
+				continue
+			}
+			switch t := v.Type().(type) {
+			case *types.Pointer:
+				if isTesting(t.Elem(), "T") || isTesting(t.Elem(), "B") {
+					return v
+				}
+			default:
+				if isTesting(t, "TB") {
+					return v
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isTesting reports whether t is the named type of the testing package.
+func isTesting(t types.Type, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "testing" && obj.Name() == name
+}
+
+// hasMethod reports whether the type of the testing parameter t has the
+// named method, which depends on the version of the testing package.
+func hasMethod(pass *analysis.Pass, t *types.Var, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t.Type(), true, pass.Pkg, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// callsParallel reports whether body calls the Parallel method of t.
+func callsParallel(pass *analysis.Pass, body *ast.BlockStmt, t *types.Var) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Parallel" && isVar(pass, sel.X, t) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+type checker struct {
+	pass            *analysis.Pass
+	t               *types.Var
+	setenv, tempDir bool
+}
+
+// checkList reports the statements of list that set an environment
+// variable or create a temporary directory, and that are undone by a
+// deferred call of the same list.
+func (c *checker) checkList(list []ast.Stmt) {
+	for i, stmt := range list {
+		if c.setenv {
+			c.checkSetenv(list, i, stmt)
+		}
+		if c.tempDir {
+			c.checkTempDir(list, i, stmt)
+		}
+	}
+}
+
+// checkSetenv reports list[i] if it is one of
+//
+//	os.Setenv(key, value)
+//	if err := os.Setenv(key, value); err != nil { ... }
+//
+// and the list has a deferred call that restores the variable, either
+//
+//	defer os.Setenv(key, old)
+//
+// where old := os.Getenv(key) is a statement of the list, or
+//
+//	defer os.Unsetenv(key)
+func (c *checker) checkSetenv(list []ast.Stmt, i int, stmt ast.Stmt) {
+	var call *ast.CallExpr
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		call, _ = stmt.X.(*ast.CallExpr)
+	case *ast.IfStmt:
+		if stmt.Else == nil {
+			if init, ok := stmt.Init.(*ast.AssignStmt); ok && len(init.Lhs) == 1 && len(init.Rhs) == 1 && isErrCheck(c.pass, stmt.Cond, init.Lhs[0]) {
+				call, _ = init.Rhs[0].(*ast.CallExpr)
+			}
+		}
+	}
+	if !c.isFunc(call, "os", "Setenv") {
+		return
+	}
+	key := call.Args[0]
+
+	restore, getenv := -1, -1
+	for j, s := range list {
+		d := deferredCall(s)
+		switch {
+		case c.isFunc(d, "os", "Unsetenv") && c.sameValue(d.Args[0], key):
+			restore, getenv = j, -1
+		case c.isFunc(d, "os", "Setenv") && c.sameValue(d.Args[0], key):
+			old, ok := d.Args[1].(*ast.Ident)
+			if !ok {
+				continue
+			}
+			for k, s := range list[:j] {
+				if v := c.getenvVar(s, key); v != nil && v == c.pass.TypesInfo.Uses[old] {
+					restore, getenv = j, k
+				}
+			}
+		}
+		if restore >= 0 {
+			break
+		}
+	}
+	// The variable must be read before it is set.
+	if restore < 0 || getenv > i {
+		return
+	}
+
+	deleted := []int{restore}
+	if getenv >= 0 && c.usedOnlyIn(c.getenvVar(list[getenv], key), list[restore]) {
+		deleted = append(deleted, getenv)
+	}
+	var fixes []analysis.SuggestedFix
+	// The comments in an error check would be lost.
+	_, check := stmt.(*ast.IfStmt)
+	if edits := c.deleteEdits(list, deleted); edits != nil && !(check && c.hasComment(stmt.Pos(), stmt.End())) {
+		var key, value bytes.Buffer
+		if format.Node(&key, c.pass.Fset, call.Args[0]) == nil && format.Node(&value, c.pass.Fset, call.Args[1]) == nil {
+			edits = append(edits, analysis.TextEdit{
+				Pos:     stmt.Pos(),
+				End:     stmt.End(),
+				NewText: []byte(fmt.Sprintf("%s.Setenv(%s, %s)", c.t.Name(), &key, &value)),
+			})
+			fixes = []analysis.SuggestedFix{{
+				Message:   fmt.Sprintf("Use %s.Setenv", c.t.Name()),
+				TextEdits: edits,
+			}}
+		}
+	}
+	c.pass.Report(analysis.Diagnostic{
+		Pos:            call.Pos(),
+		End:            call.End(),
+		Message:        fmt.Sprintf("the environment variable is restored by a deferred call; use %s.Setenv", c.t.Name()),
+		SuggestedFixes: fixes,
+	})
+}
+
+// getenvVar returns the variable declared by stmt, if it is
+//
+//	v := os.Getenv(key)
+func (c *checker) getenvVar(stmt ast.Stmt, key ast.Expr) *types.Var {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return nil
+	}
+	id, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	if call, ok := assign.Rhs[0].(*ast.CallExpr); !ok || !c.isFunc(call, "os", "Getenv") || !c.sameValue(call.Args[0], key) {
+		return nil
+	}
+	v, _ := c.pass.TypesInfo.Defs[id].(*types.Var)
+	return v
+}
+
+// checkTempDir reports list[i] if it is
+//
+//	dir, err := ioutil.TempDir("", pattern)
+//
+// or the same call of os.MkdirTemp, possibly with os.TempDir() as the
+// first argument, followed by a check of err, and the list has
+//
+//	defer os.RemoveAll(dir)
+func (c *checker) checkTempDir(list []ast.Stmt, i int, stmt ast.Stmt) {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 2 || len(assign.Rhs) != 1 {
+		return
+	}
+	call, _ := assign.Rhs[0].(*ast.CallExpr)
+	if !c.isFunc(call, "io/ioutil", "TempDir") && !c.isFunc(call, "os", "MkdirTemp") {
+		return
+	}
+	// The directory must be created in the default directory for
+	// temporary files, as t.TempDir does.
+	if tv := c.pass.TypesInfo.Types[call.Args[0]]; tv.Value == nil || constant.StringVal(tv.Value) != "" {
+		parent, ok := call.Args[0].(*ast.CallExpr)
+		if !ok || !c.isFunc(parent, "os", "TempDir") {
+			return
+		}
+	}
+	dir, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok || dir.Name == "_" {
+		return
+	}
+	dirVar := c.pass.TypesInfo.ObjectOf(dir)
+	errID, ok := assign.Lhs[1].(*ast.Ident)
+	if !ok {
+		return
+	}
+	var deleted []int
+	if errID.Name != "_" {
+		if i+1 >= len(list) {
+			return
+		}
+		check, ok := list[i+1].(*ast.IfStmt)
+		if !ok || check.Init != nil || check.Else != nil || !isErrCheck(c.pass, check.Cond, errID) {
+			return
+		}
+		deleted = append(deleted, i+1)
+	}
+
+	remove := -1
+	for j := i + 1; j < len(list); j++ {
+		if d := deferredCall(list[j]); c.isFunc(d, "os", "RemoveAll") && isVar(c.pass, d.Args[0], dirVar) {
+			remove = j
+			break
+		}
+	}
+	if remove < 0 {
+		return
+	}
+	deleted = append(deleted, remove)
+
+	var fixes []analysis.SuggestedFix
+	// A new err variable must not be used after the check.
+	if v, ok := c.pass.TypesInfo.Defs[errID].(*types.Var); !ok || errID.Name == "_" || c.usedOnlyIn(v, list[i+1]) {
+		if edits := c.deleteEdits(list, deleted); edits != nil {
+			tok := "="
+			if c.pass.TypesInfo.Defs[dir] != nil {
+				tok = ":="
+			}
+			edits = append(edits, analysis.TextEdit{
+				Pos:     stmt.Pos(),
+				End:     stmt.End(),
+				NewText: []byte(fmt.Sprintf("%s %s %s.TempDir()", dir.Name, tok, c.t.Name())),
+			})
+			fixes = []analysis.SuggestedFix{{
+				Message:   fmt.Sprintf("Use %s.TempDir", c.t.Name()),
+				TextEdits: edits,
+			}}
+		}
+	}
+	c.pass.Report(analysis.Diagnostic{
+		Pos:            call.Pos(),
+		End:            call.End(),
+		Message:        fmt.Sprintf("the temporary directory is removed by a deferred call; use %s.TempDir", c.t.Name()),
+		SuggestedFixes: fixes,
+	})
+}
+
+// deferredCall returns the call of a defer statement, either
+//
+//	defer f(args)
+//	defer func() { f(args) }()
+//
+// or nil if stmt is not a defer statement of this form.
+func deferredCall(stmt ast.Stmt) *ast.CallExpr {
+	d, ok := stmt.(*ast.DeferStmt)
+	if !ok {
+		return nil
+	}
+	if lit, ok := d.Call.Fun.(*ast.FuncLit); ok {
+		if len(d.Call.Args) != 0 || len(lit.Body.List) != 1 {
+			return nil
+		}
+		expr, ok := lit.Body.List[0].(*ast.ExprStmt)
+		if !ok {
+			return nil
+		}
+		call, _ := expr.X.(*ast.CallExpr)
+		return call
+	}
+	return d.Call
+}
+
+// isFunc reports whether call is a call of the named function of the
+// package with the given path.
+func (c *checker) isFunc(call *ast.CallExpr, path, name string) bool {
+	if call == nil {
+		return false
+	}
+	fn, ok := typeutil.Callee(c.pass.TypesInfo, call).(*types.Func)
+	return ok && fn.Pkg() != nil && fn.Pkg().Path() == path && fn.Name() == name
+}
+
+// sameValue reports whether x and y are the same constant, or the same
+// variable.
+func (c *checker) sameValue(x, y ast.Expr) bool {
+	if vx, vy := c.pass.TypesInfo.Types[x].Value, c.pass.TypesInfo.Types[y].Value; vx != nil && vy != nil {
+		return constant.Compare(vx, token.EQL, vy)
+	}
+	id, ok := x.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	v, ok := c.pass.TypesInfo.Uses[id].(*types.Var)
+	return ok && isVar(c.pass, y, v)
+}
+
+// isVar reports whether e is an identifier that refers to v.
+func isVar(pass *analysis.Pass, e ast.Expr, v types.Object) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && v != nil && pass.TypesInfo.Uses[id] == v
+}
+
+// isErrCheck reports whether cond is err != nil.
+func isErrCheck(pass *analysis.Pass, cond, err ast.Expr) bool {
+	bin, ok := cond.(*ast.BinaryExpr)
+	if !ok || bin.Op != token.NEQ {
+		return false
+	}
+	id, ok := err.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	return isVar(pass, bin.X, pass.TypesInfo.ObjectOf(id)) && pass.TypesInfo.Types[bin.Y].IsNil()
+}
+
+// usedOnlyIn reports whether all uses of v are in n.
+func (c *checker) usedOnlyIn(v *types.Var, n ast.Node) bool {
+	if v == nil {
+		return false
+	}
+	for id, obj := range c.pass.TypesInfo.Uses {
+		if obj == v && (id.Pos() < n.Pos() || id.Pos() >= n.End()) {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteEdits returns the edits that delete the statements of list at the
+// given indexes, with the lines they are on, or nil if the statements
+// share their lines with other statements or comments, which would be
+// deleted too.
+func (c *checker) deleteEdits(list []ast.Stmt, indexes []int) []analysis.TextEdit {
+	line := func(pos token.Pos) int { return c.pass.Fset.Position(pos).Line }
+	sort.Ints(indexes)
+	var edits []analysis.TextEdit
+	for k := 0; k < len(indexes); {
+		// Delete the run of consecutive statements from a to b.
+		a, b := indexes[k], indexes[k]
+		for k++; k < len(indexes) && indexes[k] == b+1; k++ {
+			b++
+		}
+		var edit analysis.TextEdit
+		switch {
+		case b+1 < len(list):
+			if line(list[b].End()) == line(list[b+1].Pos()) {
+				return nil
+			}
+			edit = analysis.TextEdit{Pos: list[a].Pos(), End: list[b+1].Pos()}
+		case a > 0:
+			// Delete from the end of the previous line.
+			l := line(list[a].Pos())
+			if line(list[a-1].End()) == l {
+				return nil
+			}
+			edit = analysis.TextEdit{Pos: c.pass.Fset.File(list[a].Pos()).LineStart(l) - 1, End: list[b].End()}
+		default:
+			edit = analysis.TextEdit{Pos: list[a].Pos(), End: list[b].End()}
+		}
+		if c.hasComment(edit.Pos, edit.End) {
+			return nil
+		}
+		edits = append(edits, edit)
+	}
+	return edits
+}
+
+// hasComment reports whether there is a comment between pos and end.
+func (c *checker) hasComment(pos, end token.Pos) bool {
+	for _, f := range c.pass.Files {
+		if f.Pos() > pos || pos > f.End() {
+			continue
+		}
+		for _, cg := range f.Comments {
+			if cg.Pos() < end && cg.End() > pos {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the testcleanup checker.
+
+package a
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSetenv(t *testing.T) {
+	old := os.Getenv("HOME")
+	os.Setenv("HOME", "/tmp") // want "the environment variable is restored by a deferred call; use t.Setenv"
+	defer os.Setenv("HOME", old)
+	Run("x")
+}
+
+func TestSetenvCheck(t *testing.T) {
+	const key = "GOPATH"
+	defer os.Unsetenv(key)
+	if err := os.Setenv(key, "/tmp"); err != nil { // want "the environment variable is restored by a deferred call; use t.Setenv"
+		t.Fatal(err)
+	}
+	Run("x")
+}
+
+func TestSetenvClosure(t *testing.T) {
+	old := os.Getenv("HOME")
+	defer func() {
+		os.Setenv("HOME", old)
+	}()
+	os.Setenv("HOME", "/tmp") // want "the environment variable is restored by a deferred call; use t.Setenv"
+	Run(old)
+}
+
+func TestSetenvParallel(t *testing.T) {
+	t.Parallel()
+	os.Setenv("HOME", "/tmp")
+	defer os.Unsetenv("HOME")
+	Run("x")
+}
+
+func TestSetenvNotRestored(t *testing.T) {
+	os.Setenv("HOME", "/tmp")
+	defer os.Unsetenv("GOPATH")
+	Run("x")
+}
+
+func TestTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test") // want "the temporary directory is removed by a deferred call; use t.TempDir"
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Run(dir)
+}
+
+func BenchmarkTempDir(b *testing.B) {
+	var dir string
+	var err error
+	dir, err = ioutil.TempDir(os.TempDir(), "test") // want "the temporary directory is removed by a deferred call; use b.TempDir"
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Run(dir)
+	_ = err
+}
+
+func TestTempDirErrUsed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test") // want "the temporary directory is removed by a deferred call; use t.TempDir"
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(dir+"/x", nil, 0666)
+	Run(err.Error())
+}
+
+func TestTempDirParent(t *testing.T) {
+	dir, err := ioutil.TempDir(".", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Run(dir)
+}
+
+func TestSubtest(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "test") // want "the temporary directory is removed by a deferred call; use t.TempDir"
+	defer os.RemoveAll(dir)
+	func(tb testing.TB) {
+		old := os.Getenv("HOME")
+		os.Setenv("HOME", dir) // want "the environment variable is restored by a deferred call; use tb.Setenv"
+		defer os.Setenv("HOME", old)
+	}(t)
+}
+
+func helper(dir string) {
+	old := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	defer os.Setenv("HOME", old)
+}
@@ -0,0 +1,9 @@
+// The uncheckedassert command runs the uncheckedassert analyzer.
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/passes/uncheckedassert"
+	"github.com/jackie-feng/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(uncheckedassert.Analyzer) }
@@ -0,0 +1,83 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package a
+
+import (
+	"fmt"
+	"io"
+)
+
+type T struct{ name string }
+
+func (t T) Value() string    { return t.name }
+func (t *T) Pointer() string { return "" }
+
+func ignoredOK(x interface{}) {
+	p, _ := x.(*T)
+	fmt.Println(p.name) // want `p is nil if the type assertion on line 18 fails, as its ok result is ignored`
+
+	q, _ := x.(*T)
+	q.Pointer()            // ok: the method may handle nil receivers
+	fmt.Println(q.Value()) // want `q is nil if the type assertion on line 21 fails`
+
+	var s, _ = x.(fmt.Stringer)
+	fmt.Println(s.String()) // want `s is nil if the type assertion on line 25 fails`
+
+	r, _ := (x).(*T)
+	go func() {
+		fmt.Println(*r) // want `r is nil if the type assertion on line 28 fails`
+	}()
+
+	v, _ := x.(T) // ok: not a pointer
+	fmt.Println(v.name)
+}
+
+func checked(x interface{}) string {
+	p, _ := x.(*T)
+	if p == nil {
+		return ""
+	}
+	return p.name
+}
+
+func checkedInline(x interface{}) string {
+	if p, _ := x.(*T); p != nil {
+		return p.name
+	}
+	return ""
+}
+
+func reassigned(x interface{}) string {
+	p, _ := x.(*T)
+	p = &T{}
+	return p.name
+}
+
+func condition(x, y interface{}, r io.Reader) {
+	if x.(*T).name == "" { // want `type assertion x.\(\*T\) panics if it fails; use the two-value form`
+	}
+	if t := y.(T); t.name == "" { // want `type assertion y.\(T\) panics if it fails`
+	}
+	if t, ok := y.(T); ok && t.name == "" {
+	}
+	if _, ok := x.(*T); ok && x.(*T).name == "" {
+	}
+	if _, ok := x.(*T); ok {
+		if x.(*T).name == "" {
+		}
+	}
+	switch x.(type) {
+	case *T:
+		if x.(*T).name == "" {
+		}
+	case T, int:
+		if x.(T).name == "" { // want `type assertion x.\(T\) panics if it fails`
+		}
+	}
+	if r.(io.Reader) != nil { // ok: cannot fail for a non-nil r
+	}
+	if func() bool { return x.(*T).name == "" }() {
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package a
+
+func inTest(x interface{}) {
+	if x.(*T).name == "" { // ok: a test panics instead of failing
+	}
+	p, _ := x.(*T)
+	_ = p.name // want `p is nil if the type assertion on line 10 fails`
+}
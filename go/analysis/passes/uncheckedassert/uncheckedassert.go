@@ -0,0 +1,280 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package uncheckedassert defines an Analyzer that reports type assertions
+// whose failure goes unnoticed until the program panics.
+package uncheckedassert
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/inspect"
+	"github.com/jackie-feng/tools/go/ast/astutil"
+	"github.com/jackie-feng/tools/go/ast/inspector"
+)
+
+const Doc = `check for type assertions whose failure is not handled
+
+The two-value form of a type assertion yields the zero value of the type
+if the assertion fails. If the ok result is ignored, and the type is a
+pointer or interface type, a later use of the value dereferences nil:
+
+	p, _ := x.(*T)
+	return p.name // panics if x is not a *T
+
+This checker reports the first use of such a value that panics if it is
+nil, unless the value was compared with nil before.
+
+The single-value form panics if the assertion fails. The checker also
+reports the single-value type assertions in the conditions and init
+statements of if statements outside of tests, where the failure of the
+assertion is likely to have been meant to make the condition false:
+
+	if x.(*T).ready { // panics if x is not a *T
+		...
+	}
+
+Assertions checked by an enclosing if statement or type switch are not
+reported, but some assertions are guaranteed to succeed by invariants
+that the checker cannot see, such as the type of a *types.Func being a
+*types.Signature, so this analyzer is not run by go vet.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "uncheckedassert",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{
+		(*ast.FuncDecl)(nil),
+		(*ast.FuncLit)(nil),
+		(*ast.IfStmt)(nil),
+	}
+	inspect.WithStack(nodeFilter, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				checkIgnoredOK(pass, n.Body)
+			}
+		case *ast.FuncLit:
+			checkIgnoredOK(pass, n.Body)
+		case *ast.IfStmt:
+			if !strings.HasSuffix(pass.Fset.Position(n.Pos()).Filename, "_test.go") {
+				checkIf(pass, n, stack)
+			}
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// checkIgnoredOK reports the uses of the results of the type assertions of
+// body that ignore their ok result, where the results may be nil.
+// The type assertions of nested function literals are left to their own
+// checks, but the uses within them are considered.
+func checkIgnoredOK(pass *analysis.Pass, body *ast.BlockStmt) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		var lhs []*ast.Ident
+		var rhs []ast.Expr
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.AssignStmt:
+			for _, e := range n.Lhs {
+				id, _ := e.(*ast.Ident)
+				lhs = append(lhs, id)
+			}
+			rhs = n.Rhs
+		case *ast.ValueSpec:
+			lhs, rhs = n.Names, n.Values
+		default:
+			return true
+		}
+		if len(lhs) != 2 || len(rhs) != 1 || lhs[0] == nil || lhs[1] == nil || lhs[1].Name != "_" {
+			return true
+		}
+		assert, ok := astutil.Unparen(rhs[0]).(*ast.TypeAssertExpr)
+		if !ok {
+			return true
+		}
+		v, ok := pass.TypesInfo.ObjectOf(lhs[0]).(*types.Var)
+		if !ok {
+			return true
+		}
+		switch v.Type().Underlying().(type) {
+		case *types.Pointer, *types.Interface:
+			if use := nilUse(pass, body, v, n.End()); use != nil {
+				pass.ReportRangef(use, "%s is nil if the type assertion on line %d fails, as its ok result is ignored",
+					v.Name(), pass.Fset.Position(assert.Pos()).Line)
+			}
+		}
+		return true
+	})
+}
+
+// nilUse returns the first use of v in body after pos that panics if v is
+// nil, or nil if v is compared with nil, assigned or has its address taken
+// before such a use.
+func nilUse(pass *analysis.Pass, body *ast.BlockStmt, v *types.Var, pos token.Pos) ast.Node {
+	is := func(e ast.Expr) bool {
+		id, ok := astutil.Unparen(e).(*ast.Ident)
+		return ok && pass.TypesInfo.ObjectOf(id) == v
+	}
+	var use ast.Node
+	done := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if done || n == nil {
+			return false
+		}
+		if n.End() <= pos {
+			return false
+		}
+		if n.Pos() < pos {
+			return true // an ancestor of the assignment
+		}
+		switch n := n.(type) {
+		case *ast.BinaryExpr:
+			if n.Op == token.EQL || n.Op == token.NEQ {
+				if is(n.X) && isNil(pass, n.Y) || is(n.Y) && isNil(pass, n.X) {
+					done = true
+				}
+			}
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				if is(lhs) {
+					done = true
+				}
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND && is(n.X) {
+				done = true
+			}
+		case *ast.StarExpr:
+			if is(n.X) {
+				use, done = n, true
+			}
+		case *ast.SelectorExpr:
+			if !is(n.X) {
+				break
+			}
+			if sel := pass.TypesInfo.Selections[n]; sel != nil && derefs(v, sel) {
+				use, done = n, true
+			}
+		}
+		return !done
+	})
+	return use
+}
+
+// derefs reports whether the selection sel of v panics if v is nil: a
+// method of an interface, or a field or method with a value receiver of
+// the type that v points to. A method with a pointer receiver may handle nil.
+func derefs(v *types.Var, sel *types.Selection) bool {
+	if types.IsInterface(v.Type()) || sel.Kind() != types.MethodVal || len(sel.Index()) > 1 {
+		return true
+	}
+	recv := sel.Obj().Type().(*types.Signature).Recv()
+	_, ptr := recv.Type().(*types.Pointer)
+	return !ptr
+}
+
+func isNil(pass *analysis.Pass, e ast.Expr) bool {
+	return pass.TypesInfo.Types[e].IsNil()
+}
+
+// checkIf reports the single-value type assertions of the init statement
+// and condition of n that may fail, unless an enclosing statement of stack
+// checks them.
+func checkIf(pass *analysis.Pass, n *ast.IfStmt, stack []ast.Node) {
+	var exprs []ast.Node
+	// The two-value form of an assignment is fine.
+	if n.Init != nil && commaOK(n.Init) == nil {
+		exprs = append(exprs, n.Init)
+	}
+	exprs = append(exprs, n.Cond)
+	for _, e := range exprs {
+		ast.Inspect(e, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.TypeAssertExpr:
+				if n.Type != nil && mayFail(pass, n) && !checked(pass, n, stack) {
+					pass.ReportRangef(n, "type assertion %s panics if it fails; use the two-value form", types.ExprString(n))
+				}
+			}
+			return true
+		})
+	}
+}
+
+// mayFail reports whether the assertion may fail for a non-nil operand: it
+// does not if it asserts an interface type that the type of the operand
+// implements.
+func mayFail(pass *analysis.Pass, assert *ast.TypeAssertExpr) bool {
+	t := pass.TypesInfo.TypeOf(assert.Type)
+	x := pass.TypesInfo.TypeOf(assert.X)
+	if t == nil || x == nil {
+		return false
+	}
+	return !types.IsInterface(t) || !types.AssignableTo(x, t)
+}
+
+// checked reports whether one of the statements of stack, which enclose the
+// type assertion, checks that it does not fail: an if statement that uses
+// the two-value form of the same assertion, or a case of a type switch on the
+// same operand that lists the asserted type alone.
+func checked(pass *analysis.Pass, assert *ast.TypeAssertExpr, stack []ast.Node) bool {
+	x := types.ExprString(assert.X)
+	t := pass.TypesInfo.TypeOf(assert.Type)
+	same := func(other *ast.TypeAssertExpr) bool {
+		return other.Type != nil && types.ExprString(other.X) == x && types.Identical(pass.TypesInfo.TypeOf(other.Type), t)
+	}
+	for i, n := range stack {
+		switch n := n.(type) {
+		case *ast.IfStmt:
+			if other := commaOK(n.Init); other != nil && same(other) {
+				return true
+			}
+		case *ast.TypeSwitchStmt:
+			var operand ast.Expr
+			switch s := n.Assign.(type) {
+			case *ast.ExprStmt:
+				operand = s.X
+			case *ast.AssignStmt:
+				operand = s.Rhs[0]
+			}
+			ts, ok := astutil.Unparen(operand).(*ast.TypeAssertExpr)
+			if !ok || types.ExprString(ts.X) != x || i+2 >= len(stack) {
+				continue
+			}
+			// stack[i+1] is the body of the switch, and stack[i+2] the case.
+			if clause, ok := stack[i+2].(*ast.CaseClause); ok && len(clause.List) == 1 && types.Identical(pass.TypesInfo.TypeOf(clause.List[0]), t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commaOK returns the type assertion of stmt if it is an assignment of the
+// two-value form of a type assertion, or nil.
+func commaOK(stmt ast.Stmt) *ast.TypeAssertExpr {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 2 || len(assign.Rhs) != 1 {
+		return nil
+	}
+	assert, _ := astutil.Unparen(assign.Rhs[0]).(*ast.TypeAssertExpr)
+	return assert
+}
@@ -69,6 +69,10 @@ func Main(a *analysis.Analyzer) {
 	}
 
 	if len(args) == 1 && strings.HasSuffix(args[0], ".cfg") {
+		unitchecker.Fix = checker.Fix
+		unitchecker.DumpFacts = checker.DumpFacts
+		unitchecker.BestEffort = checker.BestEffort
+		unitchecker.FactCodec = checker.FactCodec
 		unitchecker.Run(args[0], analyzers)
 		panic("unreachable")
 	}
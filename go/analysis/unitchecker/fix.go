@@ -0,0 +1,223 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unitchecker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Fix determines whether to apply the suggested fixes of the diagnostics,
+// as set by the -fix flag.
+var Fix bool
+
+// An offsetEdit is a TextEdit using byte offsets instead of positions.
+type offsetEdit struct {
+	start, end int
+	newText    []byte
+}
+
+// overlap reports whether the edits x and y overlap. Two insertions at the
+// same offset overlap too, as their order is undefined.
+func (x offsetEdit) overlap(y offsetEdit) bool {
+	return x.start < y.end && y.start < x.end || x.start == y.start && (x.start == x.end || y.start == y.end)
+}
+
+// applyFixes applies the suggested fixes of the diagnostics of results to
+// the files of the unit, whose contents when they were analyzed are sources,
+// and reports whether all of them were applied.
+//
+// The edits of a fix are applied together, or not at all: a fix is skipped
+// if one of its edits is malformed, is not in a file of the unit, or
+// overlaps an edit of another fix. A fixed file is formatted if the original
+// file was.
+//
+// The go command runs the tool for each variant of a package, such as the
+// package and the package compiled with its tests, possibly in parallel, and
+// so the fixes of a file are reported for each of them. Each file is fixed
+// while holding a lock, and is left as it is if another variant has already
+// fixed it in the same way. The files are replaced atomically, so that the
+// other runs of the tool and the compiler never see a file half written.
+func applyFixes(fset *token.FileSet, sources map[string][]byte, results []result) bool {
+	ok := true
+	editsForFile := make(map[*token.File][]offsetEdit)
+	for _, res := range results {
+	fixes:
+		for _, diag := range res.diagnostics {
+			for _, sf := range diag.SuggestedFixes {
+				skip := func(format string, args ...interface{}) {
+					log.Printf("%s: not applying fix %q of analysis %s: %s",
+						fset.Position(diag.Pos), sf.Message, res.a.Name, fmt.Sprintf(format, args...))
+					ok = false
+				}
+				type fileEdit struct {
+					file *token.File
+					offsetEdit
+				}
+				var edits []fileEdit
+			edits:
+				for _, edit := range sf.TextEdits {
+					end := edit.End
+					if !end.IsValid() {
+						end = edit.Pos
+					}
+					if edit.Pos > end {
+						skip("malformed edit: pos (%v) > end (%v)", edit.Pos, end)
+						continue fixes
+					}
+					file := fset.File(edit.Pos)
+					if file == nil || end > token.Pos(file.Base()+file.Size()) {
+						skip("edit is not within the bounds of a file")
+						continue fixes
+					}
+					if _, ok := sources[file.Name()]; !ok {
+						skip("edit of %s, which is not a file of the package", file.Name())
+						continue fixes
+					}
+					e := offsetEdit{file.Offset(edit.Pos), file.Offset(end), edit.NewText}
+					for _, other := range editsForFile[file] {
+						if other.start == e.start && other.end == e.end && bytes.Equal(other.newText, e.newText) {
+							// The same fix is suggested by several diagnostics.
+							continue edits
+						}
+						if e.overlap(other) {
+							skip("overlapping edits of %s at offsets (%v, %v) and (%v, %v)", file.Name(), e.start, e.end, other.start, other.end)
+							continue fixes
+						}
+					}
+					for _, other := range edits {
+						if other.file == file && e.overlap(other.offsetEdit) {
+							skip("overlapping edits of %s at offsets (%v, %v) and (%v, %v)", file.Name(), e.start, e.end, other.start, other.end)
+							continue fixes
+						}
+					}
+					edits = append(edits, fileEdit{file, e})
+				}
+				for _, e := range edits {
+					editsForFile[e.file] = append(editsForFile[e.file], e.offsetEdit)
+				}
+			}
+		}
+	}
+
+	for f, edits := range editsForFile {
+		if err := fixFile(f.Name(), sources[f.Name()], edits); err != nil {
+			log.Printf("%s: not applying fixes: %v", f.Name(), err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// fixFile applies edits to the file filename, whose contents were original.
+func fixFile(filename string, original []byte, edits []offsetEdit) error {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var out bytes.Buffer
+	cur := 0 // current position in the file
+	for _, edit := range edits {
+		out.Write(original[cur:edit.start])
+		out.Write(edit.newText)
+		cur = edit.end
+	}
+	out.Write(original[cur:])
+	fixed := out.Bytes()
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, fixed, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("the fixed file would not parse: %v", err)
+	}
+	// Format the file, unless it was not formatted before.
+	if formatted, err := format.Source(original); err == nil && bytes.Equal(formatted, original) {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, f); err == nil {
+			fixed = buf.Bytes()
+		}
+	}
+
+	unlock, err := lockFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	switch {
+	case bytes.Equal(current, fixed):
+		return nil // fixed by another variant of the package
+	case !bytes.Equal(current, original):
+		return fmt.Errorf("the file has changed since it was analyzed")
+	}
+	return writeFileAtomically(filename, fixed)
+}
+
+// writeFileAtomically replaces the contents of the file filename with data,
+// by renaming a temporary file over it.
+func writeFileAtomically(filename string, data []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // in case of failure
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Locks older than staleLock are assumed to be left by a run of the tool
+// that crashed, and are broken.
+const staleLock = time.Minute
+
+// lockFile acquires the lock of the file filename, held by the runs of the
+// tool that fix it, and returns the function that releases it.
+// The lock is a file in the temporary directory, whose creation fails if it
+// exists.
+func lockFile(filename string) (unlock func(), err error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	lock := filepath.Join(os.TempDir(), fmt.Sprintf("vetfix-%x.lock", sha256.Sum256([]byte(abs))))
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLock {
+			log.Printf("%s: breaking stale lock %s", filename, lock)
+			os.Remove(lock)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
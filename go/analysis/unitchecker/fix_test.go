@@ -0,0 +1,59 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unitchecker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "a.go")
+
+	const (
+		original = "package a\n\nvar x = 1\n"
+		fixed    = "package a\n\nvar y = 1\n"
+	)
+	edits := func() []offsetEdit { return []offsetEdit{{15, 16, []byte("y")}} }
+	for _, test := range []struct {
+		name, current, want string
+		wantErr             bool
+	}{
+		{"unchanged", original, fixed, false},
+		{"fixed by another variant", fixed, fixed, false},
+		{"changed", "package a\n", "package a\n", true},
+	} {
+		if err := ioutil.WriteFile(filename, []byte(test.current), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := fixFile(filename, []byte(original), edits())
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", test.name, err, test.wantErr)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, data, test.want)
+		}
+	}
+
+	if info, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want the mode of the original file", info.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("got %d files, want no temporary file left", len(files))
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unitchecker
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// majorVersion matches the major version suffix of a module path.
+	majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+	// ident and exportedIdent match Go identifiers.
+	ident         = regexp.MustCompile(`^[\pL_][\pL\pN_]*$`)
+	exportedIdent = regexp.MustCompile(`^\p{Lu}[\pL\pN_]*$`)
+)
+
+// WriteMain writes to w the source of a main package for a vet tool that
+// runs the given analyzers under the unitchecker driver, as in the example
+// main.go in this package. The generated file can be kept up to date with
+// go:generate, so that the list of analyzers is maintained declaratively.
+//
+// Each element of analyzers is the import path of a package that declares
+// its analyzer in a variable named Analyzer, as the passes in this
+// repository do. The name of another variable may follow the path after
+// a colon, as in "example.com/lint:NilErrAnalyzer".
+//
+// The generated file is marked as generated by generator, usually the
+// name of the command that produced it.
+func WriteMain(w io.Writer, generator string, analyzers []string) error {
+	if len(analyzers) == 0 {
+		return fmt.Errorf("no analyzers")
+	}
+	type analyzer struct {
+		path, name, variable string
+	}
+	var (
+		list  []analyzer
+		names = map[string]string{"unitchecker": unitcheckerPath}
+	)
+	for _, a := range analyzers {
+		pkgPath, variable := a, "Analyzer"
+		if i := strings.LastIndex(a, ":"); i >= 0 {
+			pkgPath, variable = a[:i], a[i+1:]
+		}
+		if pkgPath == "" || !exportedIdent.MatchString(variable) {
+			return fmt.Errorf("invalid analyzer %q", a)
+		}
+		name := importName(pkgPath)
+		for i := 2; names[name] != "" && names[name] != pkgPath; i++ {
+			name = fmt.Sprintf("%s%d", importName(pkgPath), i)
+		}
+		names[name] = pkgPath
+		list = append(list, analyzer{pkgPath, name, variable})
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by %s. DO NOT EDIT.\n\n", generator)
+	fmt.Fprintf(&buf, "package main\n\n")
+	fmt.Fprintf(&buf, "import (\n\t%q\n\n", unitcheckerPath)
+	seen := make(map[string]bool)
+	for _, a := range list {
+		if seen[a.path] {
+			continue
+		}
+		seen[a.path] = true
+		if a.name == path.Base(a.path) {
+			fmt.Fprintf(&buf, "\t%q\n", a.path)
+		} else {
+			fmt.Fprintf(&buf, "\t%s %q\n", a.name, a.path)
+		}
+	}
+	fmt.Fprintf(&buf, ")\n\nfunc main() {\n\tunitchecker.Main(\n")
+	for _, a := range list {
+		fmt.Fprintf(&buf, "\t\t%s.%s,\n", a.name, a.variable)
+	}
+	fmt.Fprintf(&buf, "\t)\n}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// unitcheckerPath is the import path of this package.
+const unitcheckerPath = "github.com/jackie-feng/tools/go/analysis/unitchecker"
+
+// importName returns the name under which the package with the given
+// import path is imported. Package names are assumed to follow the last
+// element of their import path, skipping any major version suffix.
+func importName(pkgPath string) string {
+	base := path.Base(pkgPath)
+	if majorVersion.MatchString(base) && path.Dir(pkgPath) != "." {
+		base = path.Base(path.Dir(pkgPath))
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, base)
+	if !ident.MatchString(name) {
+		name = "analyzer"
+	}
+	return name
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unitchecker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteMain(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMain(&buf, "genvettool", []string{
+		"github.com/jackie-feng/tools/go/analysis/passes/printf",
+		"example.com/lint/v2:NilErrAnalyzer",
+		"example.com/other/printf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `// Code generated by genvettool. DO NOT EDIT.
+
+package main
+
+import (
+	"github.com/jackie-feng/tools/go/analysis/unitchecker"
+
+	lint "example.com/lint/v2"
+	printf2 "example.com/other/printf"
+	"github.com/jackie-feng/tools/go/analysis/passes/printf"
+)
+
+func main() {
+	unitchecker.Main(
+		printf.Analyzer,
+		lint.NilErrAnalyzer,
+		printf2.Analyzer,
+	)
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteMain produced:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, analyzers := range [][]string{nil, {"example.com/lint:nilErr"}, {":Analyzer"}} {
+		if err := WriteMain(&buf, "genvettool", analyzers); err == nil {
+			t.Errorf("WriteMain(%q) succeeded, want error", analyzers)
+		}
+	}
+}
@@ -14,6 +14,14 @@
 //      -flags          describe flags                    (to the build tool)
 //      foo.cfg         description of compilation unit (from the build tool)
 //
+// With the -fix flag, as in "go vet -vettool=$(which vet) -fix",
+// the suggested fixes of the diagnostics are applied to the files
+// of the unit. With the -dumpfacts=dir flag, the facts of each unit
+// are written to a JSON file in dir, for debugging; as go vet runs
+// the tool in the directory of each package, dir should be absolute.
+// With the -factcodec=json flag, the facts passed between units are
+// encoded as JSON rather than gob; the facts of either codec are read.
+//
 // This package does not depend on go/packages.
 // If you need a standalone tool, use multichecker,
 // which supports this mode but can also load packages
@@ -27,8 +35,8 @@ package unitchecker
 //   printf checker.
 
 import (
-	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
@@ -51,6 +59,8 @@ import (
 	"github.com/jackie-feng/tools/go/analysis"
 	"github.com/jackie-feng/tools/go/analysis/internal/analysisflags"
 	"github.com/jackie-feng/tools/go/analysis/internal/facts"
+	"github.com/jackie-feng/tools/go/ast/astutil"
+	"github.com/jackie-feng/tools/internal/analysisinternal"
 )
 
 // A Config describes a compilation unit to be analyzed.
@@ -72,6 +82,20 @@ type Config struct {
 	SucceedOnTypecheckFailure bool
 }
 
+// DumpFacts is the name of a directory to which the facts of the unit
+// are written, for debugging, as set by the -dumpfacts flag.
+var DumpFacts string
+
+// FactCodec is the name of the codec with which the facts of the unit
+// are encoded, "gob" or "json", as set by the -factcodec flag.
+var FactCodec = "gob"
+
+// BestEffort determines whether to analyze a unit with type errors, as
+// set by the -besteffort flag: the analyzers that RunDespiteErrors are
+// run with partial type information, and the others are skipped with a
+// note.
+var BestEffort bool
+
 // Main is the main function of a vet-like analysis tool that must be
 // invoked by a build system to analyze a single package.
 //
@@ -102,6 +126,10 @@ Usage of %[1]s:
 		os.Exit(1)
 	}
 
+	flag.BoolVar(&Fix, "fix", false, "apply all suggested fixes")
+	flag.StringVar(&DumpFacts, "dumpfacts", "", "write the facts of each package to a JSON file in this directory")
+	flag.BoolVar(&BestEffort, "besteffort", false, "analyze units with type errors, skipping the analyzers that need complete type information")
+	flag.StringVar(&FactCodec, "factcodec", FactCodec, "encode the facts of each package with this codec (gob or json)")
 	analyzers = analysisflags.Parse(analyzers, true)
 
 	args := flag.Args()
@@ -128,13 +156,40 @@ func Run(configFile string, analyzers []*analysis.Analyzer) {
 	}
 
 	fset := token.NewFileSet()
-	results, err := run(fset, cfg, analyzers)
+	results, sources, illTyped, err := run(fset, cfg, analyzers)
 	if err != nil {
 		log.Fatal(err)
 	}
+	// In BestEffort mode, a unit with type errors is analyzed, but it
+	// fails all the same, as it does otherwise.
+	failed := illTyped && !cfg.SucceedOnTypecheckFailure
 
 	// In VetxOnly mode, the analysis is run only for facts.
 	if !cfg.VetxOnly {
+		generated := make(map[string]bool)
+		if !analysisflags.Generated {
+			for name, src := range sources {
+				// Parse the header only, in a separate file set.
+				f, err := parser.ParseFile(token.NewFileSet(), name, src, parser.PackageClauseOnly|parser.ParseComments)
+				if err == nil && astutil.IsGenerated(f) {
+					generated[name] = true
+				}
+			}
+		}
+		for i := range results {
+			var diags []analysis.Diagnostic
+			for _, diag := range results[i].diagnostics {
+				if !generated[fset.File(diag.Pos).Name()] && !analysisflags.Excluded(fset.Position(diag.Pos).Filename) {
+					diags = append(diags, diag)
+				}
+			}
+			results[i].diagnostics = diags
+		}
+
+		fixed := true
+		if Fix {
+			fixed = applyFixes(fset, sources, results)
+		}
 		if analysisflags.JSON {
 			// JSON output
 			tree := make(analysisflags.JSONTree)
@@ -142,25 +197,51 @@ func Run(configFile string, analyzers []*analysis.Analyzer) {
 				tree.Add(fset, cfg.ID, res.a.Name, res.diagnostics, res.err)
 			}
 			tree.Print()
+			if !fixed || failed {
+				os.Exit(1)
+			}
+		} else if analysisflags.SARIF {
+			// SARIF output
+			sarif := analysisflags.NewSARIFLog(analyzers)
+			for _, res := range results {
+				sarif.Add(fset, cfg.ID, res.a, res.diagnostics, res.err)
+			}
+			sarif.Print()
+			if !fixed || failed {
+				os.Exit(1)
+			}
 		} else {
 			// plain text
 			exit := 0
+			if !fixed || failed {
+				exit = 1
+			}
 			for _, res := range results {
-				if res.err != nil {
+				if res.err == errSkipped {
+					log.Printf("note: %s: %s skipped due to errors in package", cfg.ID, res.a.Name)
+				} else if res.err != nil {
 					log.Println(res.err)
 					exit = 1
 				}
 			}
+			var diags []analysisflags.AnalyzerDiagnostic
 			for _, res := range results {
 				for _, diag := range res.diagnostics {
-					analysisflags.PrintPlain(fset, diag)
-					exit = 1
+					diags = append(diags, analysisflags.AnalyzerDiagnostic{Analyzer: res.a, Diagnostic: diag})
 				}
 			}
+			analysisflags.SortDiagnostics(fset, diags)
+			for _, diag := range diags {
+				analysisflags.PrintPlain(fset, diag.Diagnostic)
+				exit = 1
+			}
 			os.Exit(exit)
 		}
 	}
 
+	if failed {
+		os.Exit(1)
+	}
 	os.Exit(0)
 }
 
@@ -187,18 +268,28 @@ var importerForCompiler = func(_ *token.FileSet, compiler string, lookup importe
 	return importer.For(compiler, lookup)
 }
 
-func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]result, error) {
+// run analyzes the unit described by cfg, and returns the results of the
+// analyzers, the contents of the Go files of the unit, by file name, and
+// whether the unit has type errors, which is possible only in BestEffort
+// mode.
+func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) (_ []result, _ map[string][]byte, illTyped bool, _ error) {
 	// Load, parse, typecheck.
 	var files []*ast.File
+	sources := make(map[string][]byte)
 	for _, name := range cfg.GoFiles {
-		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		sources[name] = src
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
 		if err != nil {
 			if cfg.SucceedOnTypecheckFailure {
 				// Silently succeed; let the compiler
 				// report parse errors.
 				err = nil
 			}
-			return nil, err
+			return nil, nil, false, err
 		}
 		files = append(files, f)
 	}
@@ -232,17 +323,27 @@ func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]re
 		Scopes:     make(map[ast.Node]*types.Scope),
 		Selections: make(map[*ast.SelectorExpr]*types.Selection),
 	}
+	if BestEffort {
+		// Report the type errors, unless the compiler is left to report
+		// them, but keep the partial type information.
+		tc.Error = func(err error) {
+			if !cfg.SucceedOnTypecheckFailure {
+				log.Print(err)
+			}
+			illTyped = true
+		}
+	}
 	pkg, err := tc.Check(cfg.ImportPath, fset, files, info)
-	if err != nil {
+	if err != nil && !BestEffort {
 		if cfg.SucceedOnTypecheckFailure {
 			// Silently succeed; let the compiler
 			// report type errors.
 			err = nil
 		}
-		return nil, err
+		return nil, nil, false, err
 	}
 
-	// Register fact types with gob.
+	// Collect the fact types of the analyzers.
 	// In VetxOnly mode, analyzers are only for their facts,
 	// so we can skip any analysis that neither produces facts
 	// nor depends on any analysis that produces facts.
@@ -255,6 +356,8 @@ func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]re
 		diagnostics []analysis.Diagnostic
 	}
 	actions := make(map[*analysis.Analyzer]*action)
+	var factTypes []analysis.Fact
+	factAnalyzers := make(map[reflect.Type]string) // names of the analyzers of the fact types
 	var registerFacts func(a *analysis.Analyzer) bool
 	registerFacts = func(a *analysis.Analyzer) bool {
 		act, ok := actions[a]
@@ -263,7 +366,8 @@ func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]re
 			var usesFacts bool
 			for _, f := range a.FactTypes {
 				usesFacts = true
-				gob.Register(f)
+				factTypes = append(factTypes, f)
+				factAnalyzers[reflect.TypeOf(f)] = a.Name
 			}
 			for _, req := range a.Requires {
 				if registerFacts(req) {
@@ -290,11 +394,18 @@ func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]re
 		}
 		return nil, nil // no .vetx file, no facts
 	}
-	facts, err := facts.Decode(pkg, read)
+	codec := facts.CodecByName(FactCodec)
+	if codec == nil {
+		return nil, nil, false, fmt.Errorf("unknown fact codec %q", FactCodec)
+	}
+	facts, err := facts.Decode(pkg, factTypes, read)
 	if err != nil {
-		return nil, err
+		return nil, nil, false, err
 	}
 
+	// All analyzers share a set of lazily built values for the package.
+	var sharedValues analysisinternal.SharedValues
+
 	// In parallel, execute the DAG of analyzers.
 	var exec func(a *analysis.Analyzer) *action
 	var execAll func(analyzers []*analysis.Analyzer)
@@ -307,19 +418,29 @@ func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]re
 			// results of its prerequisites.
 			inputs := make(map[*analysis.Analyzer]interface{})
 			var failed []string
+			skipped := true
 			for _, req := range a.Requires {
 				reqact := exec(req)
 				if reqact.err != nil {
 					failed = append(failed, req.String())
+					skipped = skipped && reqact.err == errSkipped
 					continue
 				}
 				inputs[req] = reqact.result
 			}
 
-			// Report an error if any dependency failed.
+			// Report an error if any dependency failed,
+			// or skip the analysis if they were skipped.
 			if failed != nil {
 				sort.Strings(failed)
 				act.err = fmt.Errorf("failed prerequisites: %s", strings.Join(failed, ", "))
+				if skipped {
+					act.err = errSkipped
+				}
+				return
+			}
+			if illTyped && !a.RunDespiteErrors {
+				act.err = errSkipped
 				return
 			}
 
@@ -337,6 +458,7 @@ func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]re
 				TypesInfo:         info,
 				TypesSizes:        tc.Sizes,
 				ResultOf:          inputs,
+				Shared:            sharedValues.Get,
 				Report:            func(d analysis.Diagnostic) { act.diagnostics = append(act.diagnostics, d) },
 				ImportObjectFact:  facts.ImportObjectFact,
 				ExportObjectFact:  facts.ExportObjectFact,
@@ -377,14 +499,24 @@ func run(fset *token.FileSet, cfg *Config, analyzers []*analysis.Analyzer) ([]re
 		results[i].diagnostics = act.diagnostics
 	}
 
-	data := facts.Encode()
+	data := facts.EncodeWith(codec)
 	if err := ioutil.WriteFile(cfg.VetxOutput, data, 0666); err != nil {
-		return nil, fmt.Errorf("failed to write analysis facts: %v", err)
+		return nil, nil, false, fmt.Errorf("failed to write analysis facts: %v", err)
+	}
+	if DumpFacts != "" && len(factAnalyzers) > 0 {
+		if err := facts.Dump(cfg.ID, factAnalyzers).Write(DumpFacts); err != nil {
+			return nil, nil, false, fmt.Errorf("failed to dump analysis facts: %v", err)
+		}
 	}
 
-	return results, nil
+	return results, sources, illTyped, nil
 }
 
+// errSkipped is the error of an analyzer skipped in BestEffort mode, as
+// the unit has type errors, and of those that require only such analyzers
+// among the ones that failed.
+var errSkipped = errors.New("analysis skipped due to errors in package")
+
 type result struct {
 	a           *analysis.Analyzer
 	diagnostics []analysis.Diagnostic
@@ -1,6 +1,9 @@
 package astutil
 
-import "go/ast"
+import (
+	"go/ast"
+	"strings"
+)
 
 // Unparen returns e with any enclosing parentheses stripped.
 func Unparen(e ast.Expr) ast.Expr {
@@ -12,3 +15,23 @@ func Unparen(e ast.Expr) ast.Expr {
 		e = p.X
 	}
 }
+
+// IsGenerated reports whether the file f was generated by a program, as
+// indicated by a line comment of the standard form
+//
+//	// Code generated ... DO NOT EDIT.
+//
+// before the package clause. The file must have been parsed with comments.
+func IsGenerated(f *ast.File) bool {
+	for _, group := range f.Comments {
+		if group.Pos() >= f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "// Code generated ") && strings.HasSuffix(c.Text, " DO NOT EDIT.") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astutil_test
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/ast/astutil"
+)
+
+func TestIsGenerated(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		want bool
+	}{
+		{"package p", false},
+		{"// Code generated by stringer. DO NOT EDIT.\n\npackage p", true},
+		{"// Copyright 2019.\n\n// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: a.proto\n\npackage p", true},
+		{"/* Code generated by stringer. DO NOT EDIT. */\npackage p", false},
+		{"// Code generated by stringer. Do not edit.\npackage p", false},
+		{"package p\n\n// Code generated by stringer. DO NOT EDIT.", false},
+	} {
+		f, err := parser.ParseFile(token.NewFileSet(), "a.go", test.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := astutil.IsGenerated(f); got != test.want {
+			t.Errorf("IsGenerated(%q) = %t, want %t", test.src, got, test.want)
+		}
+	}
+}
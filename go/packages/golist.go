@@ -633,6 +633,8 @@ type jsonPackage struct {
 	SwigFiles       []string
 	SwigCXXFiles    []string
 	SysoFiles       []string
+	EmbedPatterns   []string
+	EmbedFiles      []string
 	Imports         []string
 	ImportMap       map[string]string
 	Deps            []string
@@ -642,16 +644,43 @@ type jsonPackage struct {
 	XTestImports    []string
 	ForTest         string // q in a "p [q.test]" package, else ""
 	DepOnly         bool
+	Standard        bool
+	Module          *jsonModule
 
 	Error *jsonPackageError
 }
 
+type jsonModule struct {
+	Path string
+	Main bool
+	Dir  string // empty for a module of the vendor directory
+}
+
 type jsonPackageError struct {
 	ImportStack []string
 	Pos         string
 	Err         string
 }
 
+// classify returns the classification of p, from the module that go list
+// reports it belongs to.
+func classify(p *jsonPackage) Classification {
+	switch {
+	case p.Standard:
+		return Std
+	case p.Dir == "":
+		return UnknownClassification // not found
+	case strings.HasPrefix(p.ImportPath, "vendor/") || strings.Contains(p.ImportPath, "/vendor/"):
+		return Vendored // GOPATH vendoring
+	case p.Module == nil || p.Module.Main:
+		return Workspace
+	case p.Module.Dir == "":
+		return Vendored
+	default:
+		return Dependency
+	}
+}
+
 func otherFiles(p *jsonPackage) [][]string {
 	return [][]string{p.CFiles, p.CXXFiles, p.MFiles, p.HFiles, p.FFiles, p.SFiles, p.SwigFiles, p.SwigCXXFiles, p.SysoFiles}
 }
@@ -729,6 +758,9 @@ func golistDriver(cfg *Config, rootsDirs func() *goInfo, words ...string) (*driv
 			GoFiles:         absJoin(p.Dir, p.GoFiles, p.CgoFiles),
 			CompiledGoFiles: absJoin(p.Dir, p.CompiledGoFiles),
 			OtherFiles:      absJoin(p.Dir, otherFiles(p)...),
+			EmbedFiles:      absJoin(p.Dir, p.EmbedFiles),
+			EmbedPatterns:   p.EmbedPatterns,
+			Classification:  classify(p),
 		}
 
 		// Work around https://golang.org/issue/28749:
@@ -811,9 +843,10 @@ func golistDriver(cfg *Config, rootsDirs func() *goInfo, words ...string) (*driv
 				msg += fmt.Sprintf(": import stack: %v", p.Error.ImportStack)
 			}
 			pkg.Errors = append(pkg.Errors, Error{
-				Pos:  p.Error.Pos,
-				Msg:  msg,
-				Kind: ListError,
+				Pos:   p.Error.Pos,
+				Msg:   msg,
+				Kind:  ListError,
+				Cause: classifyGoError(msg),
 			})
 		}
 
@@ -1034,7 +1067,12 @@ func invokeGo(cfg *Config, args ...string) (*bytes.Buffer, error) {
 		// TODO(matloob): Remove these once we can depend on go list to exit with a zero status with -e even when
 		// packages don't exist or a build fails.
 		if !usesExportData(cfg) && !containsGoFile(args) {
-			return nil, fmt.Errorf("go %v: %s: %s", args, exitErr, stderr)
+			return nil, &GoCommandError{
+				Args:   args,
+				Err:    exitErr,
+				Stderr: stderr.String(),
+				Cause:  classifyGoError(stderr.String()),
+			}
 		}
 	}
 
@@ -1050,6 +1088,53 @@ func invokeGo(cfg *Config, args ...string) (*bytes.Buffer, error) {
 	return stdout, nil
 }
 
+// classifyGoError reports the likely cause of a go command failure,
+// given the text of its error output.
+func classifyGoError(stderr string) ErrorCause {
+	// Authentication failures are checked first: the go command reports
+	// them from the same fetches that produce proxy and network errors.
+	for _, s := range []string{
+		"terminal prompts disabled",
+		"could not read Username",
+		"could not read Password",
+		"Permission denied (publickey)",
+		"401 Unauthorized",
+		"403 Forbidden",
+		"410 Gone",
+		"verifying module",
+		"SECURITY ERROR",
+	} {
+		if strings.Contains(stderr, s) {
+			return AuthCause
+		}
+	}
+	for _, s := range []string{
+		"dial tcp",
+		"i/o timeout",
+		"no such host",
+		"connection refused",
+		"connection reset by peer",
+		"network is unreachable",
+		"TLS handshake timeout",
+	} {
+		if strings.Contains(stderr, s) {
+			return NetworkCause
+		}
+	}
+	for _, s := range []string{
+		"module lookup disabled by GOPROXY",
+		"GOPROXY list is not the empty string",
+		"proxy.golang.org",
+		"unexpected status (",
+		"bad upstream",
+	} {
+		if strings.Contains(stderr, s) {
+			return ProxyCause
+		}
+	}
+	return UnknownCause
+}
+
 func containsGoFile(s []string) bool {
 	for _, f := range s {
 		if strings.HasSuffix(f, ".go") {
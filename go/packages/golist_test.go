@@ -0,0 +1,43 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packages
+
+import "testing"
+
+func TestClassifyGoError(t *testing.T) {
+	for _, test := range []struct {
+		stderr string
+		want   ErrorCause
+	}{
+		{
+			"go: example.com/private/mod@v1.0.0: reading https://proxy.golang.org/example.com/private/mod/@v/v1.0.0.mod: 410 Gone",
+			AuthCause,
+		},
+		{
+			"go: example.com/private/mod@v1.0.0: git fetch -f origin: exit status 128:\n\tfatal: could not read Username for 'https://example.com': terminal prompts disabled",
+			AuthCause,
+		},
+		{
+			"go: golang.org/x/text@v0.3.2: Get https://proxy.golang.org/golang.org/x/text/@v/v0.3.2.mod: dial tcp: lookup proxy.golang.org: no such host",
+			NetworkCause,
+		},
+		{
+			"go: golang.org/x/text@v0.3.2: module lookup disabled by GOPROXY=off",
+			ProxyCause,
+		},
+		{
+			"go: example.com/mod@v1.0.0: reading https://goproxy.example.com/example.com/mod/@v/v1.0.0.mod: unexpected status (https://goproxy.example.com/example.com/mod/@v/v1.0.0.mod): 502 Bad Gateway",
+			ProxyCause,
+		},
+		{
+			"can't load package: package example.com/mod: unknown import path",
+			UnknownCause,
+		},
+	} {
+		if got := classifyGoError(test.stderr); got != test.want {
+			t.Errorf("classifyGoError(%q) = %v, want %v", test.stderr, got, test.want)
+		}
+	}
+}
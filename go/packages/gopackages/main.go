@@ -55,10 +55,7 @@ func (app *application) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
 Packages are specified using the notation of "go list",
 or other underlying build system.
-
-Flags:
 `)
-	f.PrintDefaults()
 }
 
 // Run takes the args after flag processing and performs the specified query.
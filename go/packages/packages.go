@@ -65,6 +65,15 @@ const (
 
 	// NeedTypesSizes adds TypesSizes.
 	NeedTypesSizes
+
+	// NeedEmbedFiles adds EmbedFiles.
+	NeedEmbedFiles
+
+	// NeedEmbedPatterns adds EmbedPatterns.
+	NeedEmbedPatterns
+
+	// NeedClassification adds Classification.
+	NeedClassification
 )
 
 const (
@@ -257,10 +266,22 @@ type Package struct {
 	// including assembly, C, C++, Fortran, Objective-C, SWIG, and so on.
 	OtherFiles []string
 
+	// EmbedFiles lists the absolute file paths of the package's files
+	// embedded with go:embed.
+	EmbedFiles []string
+
+	// EmbedPatterns lists the patterns of the package's go:embed directives,
+	// as they appear in the source.
+	EmbedPatterns []string
+
 	// ExportFile is the absolute path to a file containing type
 	// information for the package as provided by the build system.
 	ExportFile string
 
+	// Classification tells whether the package belongs to the workspace,
+	// to a dependency, to the standard library, or to a vendor directory.
+	Classification Classification
+
 	// Imports maps import paths appearing in the package's Go source files
 	// to corresponding loaded Packages.
 	Imports map[string]*Package
@@ -294,11 +315,24 @@ type Package struct {
 	TypesSizes types.Sizes
 }
 
+// Classification describes where a package comes from, so that tools can
+// restrict their work to the packages the user is working on.
+type Classification int
+
+const (
+	UnknownClassification Classification = iota
+	Workspace                            // a package of the main module, or of GOPATH
+	Dependency                           // a package of a module that the main module requires
+	Std                                  // a package of the standard library
+	Vendored                             // a package of a vendor directory
+)
+
 // An Error describes a problem with a package's metadata, syntax, or types.
 type Error struct {
-	Pos  string // "file:line:col" or "file:line" or "" or "-"
-	Msg  string
-	Kind ErrorKind
+	Pos   string // "file:line:col" or "file:line" or "" or "-"
+	Msg   string
+	Kind  ErrorKind
+	Cause ErrorCause // set for ListErrors that the go command could not resolve
 }
 
 // ErrorKind describes the source of the error, allowing the user to
@@ -313,6 +347,56 @@ const (
 	TypeError
 )
 
+// ErrorCause classifies a failure of the go command, so that tools can
+// suggest a remedy instead of reporting a generic load error.
+type ErrorCause int
+
+const (
+	UnknownCause ErrorCause = iota
+	NetworkCause            // the go command could not reach a module source
+	AuthCause               // a module source refused access; often a private module missing from GOPRIVATE
+	ProxyCause              // the module proxy reported an error
+)
+
+func (c ErrorCause) String() string {
+	switch c {
+	case NetworkCause:
+		return "network error"
+	case AuthCause:
+		return "authentication error"
+	case ProxyCause:
+		return "module proxy error"
+	}
+	return "unknown error"
+}
+
+// Hint returns a suggestion for the user to resolve an error
+// with the given cause, or the empty string if there is none.
+func (c ErrorCause) Hint() string {
+	switch c {
+	case NetworkCause:
+		return "check your network connection, or set GOFLAGS=-mod=vendor or GOPROXY=off to work offline"
+	case AuthCause:
+		return "if this is a private module, add its path to GOPRIVATE"
+	case ProxyCause:
+		return "check the GOPROXY setting, or add private modules to GOPRIVATE so that they are fetched directly"
+	}
+	return ""
+}
+
+// A GoCommandError is returned by Load when the go command fails
+// without reporting any packages.
+type GoCommandError struct {
+	Args   []string   // arguments to the go command
+	Err    error      // the error from running the command
+	Stderr string     // the standard error of the command
+	Cause  ErrorCause // the classification of Stderr
+}
+
+func (e *GoCommandError) Error() string {
+	return fmt.Sprintf("go %v: %s: %s", e.Args, e.Err, e.Stderr)
+}
+
 func (err Error) Error() string {
 	pos := err.Pos
 	if pos == "" {
@@ -334,7 +418,10 @@ type flatPackage struct {
 	GoFiles         []string          `json:",omitempty"`
 	CompiledGoFiles []string          `json:",omitempty"`
 	OtherFiles      []string          `json:",omitempty"`
+	EmbedFiles      []string          `json:",omitempty"`
+	EmbedPatterns   []string          `json:",omitempty"`
 	ExportFile      string            `json:",omitempty"`
+	Classification  Classification    `json:",omitempty"`
 	Imports         map[string]string `json:",omitempty"`
 }
 
@@ -356,7 +443,10 @@ func (p *Package) MarshalJSON() ([]byte, error) {
 		GoFiles:         p.GoFiles,
 		CompiledGoFiles: p.CompiledGoFiles,
 		OtherFiles:      p.OtherFiles,
+		EmbedFiles:      p.EmbedFiles,
+		EmbedPatterns:   p.EmbedPatterns,
 		ExportFile:      p.ExportFile,
+		Classification:  p.Classification,
 	}
 	if len(p.Imports) > 0 {
 		flat.Imports = make(map[string]string, len(p.Imports))
@@ -382,7 +472,10 @@ func (p *Package) UnmarshalJSON(b []byte) error {
 		GoFiles:         flat.GoFiles,
 		CompiledGoFiles: flat.CompiledGoFiles,
 		OtherFiles:      flat.OtherFiles,
+		EmbedFiles:      flat.EmbedFiles,
+		EmbedPatterns:   flat.EmbedPatterns,
 		ExportFile:      flat.ExportFile,
+		Classification:  flat.Classification,
 	}
 	if len(flat.Imports) > 0 {
 		p.Imports = make(map[string]*Package, len(flat.Imports))
@@ -660,6 +753,15 @@ func (ld *loader) refine(roots []string, list ...*Package) ([]*Package, error) {
 		if ld.requestedMode&NeedTypesSizes == 0 {
 			ld.pkgs[i].TypesSizes = nil
 		}
+		if ld.requestedMode&NeedEmbedFiles == 0 {
+			ld.pkgs[i].EmbedFiles = nil
+		}
+		if ld.requestedMode&NeedEmbedPatterns == 0 {
+			ld.pkgs[i].EmbedPatterns = nil
+		}
+		if ld.requestedMode&NeedClassification == 0 {
+			ld.pkgs[i].Classification = UnknownClassification
+		}
 	}
 
 	return result, nil
@@ -773,7 +875,11 @@ func (ld *loader) loadPackage(lpkg *loaderPackage) {
 	if ld.Config.Mode&NeedTypes != 0 && len(lpkg.CompiledGoFiles) == 0 && lpkg.ExportFile != "" {
 		// The config requested loading sources and types, but sources are missing.
 		// Add an error to the package and fall back to loading from export data.
-		appendError(Error{"-", fmt.Sprintf("sources missing for package %s", lpkg.ID), ParseError})
+		appendError(Error{
+			Pos:  "-",
+			Msg:  fmt.Sprintf("sources missing for package %s", lpkg.ID),
+			Kind: ParseError,
+		})
 		ld.loadFromExportData(lpkg)
 		return // can't get syntax trees for this package
 	}
@@ -0,0 +1,62 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package packages_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/packages"
+	"github.com/jackie-feng/tools/go/packages/packagestest"
+)
+
+func TestEmbed(t *testing.T) { packagestest.TestAll(t, testEmbed) }
+func testEmbed(t *testing.T, exporter packagestest.Exporter) {
+	exported := packagestest.Export(t, exporter, []packagestest.Module{{
+		Name: "golang.org/fake",
+		Files: map[string]interface{}{
+			"a/a.go": `package a
+
+import _ "embed"
+
+//go:embed *.txt
+var s string
+`,
+			"a/a.txt":    `hello`,
+			"a/data.bin": `not embedded`,
+		}}})
+	defer exported.Cleanup()
+
+	exported.Config.Mode = packages.NeedEmbedFiles | packages.NeedEmbedPatterns
+	pkgs, err := packages.Load(exported.Config, "golang.org/fake/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("got %d packages, want 1", len(pkgs))
+	}
+	pkg := pkgs[0]
+	if want := []string{"*.txt"}; !reflect.DeepEqual(pkg.EmbedPatterns, want) {
+		t.Errorf("EmbedPatterns: got %v, want %v", pkg.EmbedPatterns, want)
+	}
+	want := []string{filepath.Join(filepath.Dir(exported.File("golang.org/fake", "a/a.go")), "a.txt")}
+	if !reflect.DeepEqual(pkg.EmbedFiles, want) {
+		t.Errorf("EmbedFiles: got %v, want %v", pkg.EmbedFiles, want)
+	}
+
+	// The fields are cleared unless requested.
+	exported.Config.Mode = packages.NeedName
+	pkgs, err = packages.Load(exported.Config, "golang.org/fake/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkgs[0].EmbedFiles != nil || pkgs[0].EmbedPatterns != nil {
+		t.Errorf("got EmbedFiles %v and EmbedPatterns %v without requesting them", pkgs[0].EmbedFiles, pkgs[0].EmbedPatterns)
+	}
+}
@@ -2723,3 +2723,43 @@ func copyAll(srcPath, dstPath string) error {
 		return nil
 	})
 }
+
+func TestClassification(t *testing.T) { packagestest.TestAll(t, testClassification) }
+func testClassification(t *testing.T, exporter packagestest.Exporter) {
+	exported := packagestest.Export(t, exporter, []packagestest.Module{{
+		Name: "golang.org/fake",
+		Files: map[string]interface{}{
+			"a/a.go": `package a; import (_ "fmt"; _ "golang.org/fake/b"; _ "golang.org/other/c")`,
+			"b/b.go": `package b`,
+		}}, {
+		Name: "golang.org/other",
+		Files: map[string]interface{}{
+			"c/c.go": `package c`,
+		}}})
+	defer exported.Cleanup()
+
+	exported.Config.Mode = packages.NeedName | packages.NeedImports | packages.NeedClassification
+	initial, err := packages.Load(exported.Config, "golang.org/fake/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]packages.Classification)
+	packages.Visit(initial, nil, func(p *packages.Package) {
+		got[p.PkgPath] = p.Classification
+	})
+	other := packages.Dependency
+	if exporter == packagestest.GOPATH {
+		other = packages.Workspace
+	}
+	want := map[string]packages.Classification{
+		"golang.org/fake/a":  packages.Workspace,
+		"golang.org/fake/b":  packages.Workspace,
+		"golang.org/other/c": other,
+		"fmt":                packages.Std,
+	}
+	for path, class := range want {
+		if got[path] != class {
+			t.Errorf("%s: got classification %v, want %v", path, got[path], class)
+		}
+	}
+}
@@ -6,7 +6,7 @@ package hooks
 
 import (
 	"github.com/sergi/go-diff/diffmatchpatch"
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/span"
 )
 
@@ -8,7 +8,7 @@ import (
 	"testing"
 
 	"github.com/jackie-feng/tools/gopls/internal/hooks"
-	"github.com/jackie-feng/tools/internal/lsp/diff/difftest"
+	"github.com/jackie-feng/tools/internal/diff/difftest"
 )
 
 func TestDiff(t *testing.T) {
@@ -4,7 +4,8 @@
 
 // Package hooks adds all the standard gopls implementations.
 // This can be used in tests without needing to use the gopls main, and is
-// also the place to edit for custom builds of gopls.
+// also the place to edit for custom builds of gopls. Such builds may set
+// source.Options.SnapshotHook to reuse the packages type-checked by gopls.
 package hooks // import "github.com/jackie-feng/tools/gopls/internal/hooks"
 
 import (
@@ -0,0 +1,42 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package analysisinternal provides the parts of the analysis drivers
+// that are shared by go/analysis and gopls.
+package analysisinternal
+
+import "sync"
+
+// SharedValues is a set of lazily computed values shared by all the
+// analyzers applied to a single package, as returned by Pass.Shared.
+// The zero value is ready to use. A SharedValues is safe for concurrent use.
+type SharedValues struct {
+	mu     sync.Mutex
+	values map[interface{}]*value
+}
+
+type value struct {
+	once sync.Once
+	v    interface{}
+	err  error
+}
+
+// Get returns the value associated with key, calling build to compute
+// it if this is the first call for key. Concurrent callers for the same
+// key wait for the first call of build to complete.
+func (s *SharedValues) Get(key interface{}, build func() (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+	if s.values == nil {
+		s.values = make(map[interface{}]*value)
+	}
+	v, ok := s.values[key]
+	if !ok {
+		v = new(value)
+		s.values[key] = v
+	}
+	s.mu.Unlock()
+
+	v.once.Do(func() { v.v, v.err = build() })
+	return v.v, v.err
+}
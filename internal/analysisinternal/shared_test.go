@@ -0,0 +1,46 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysisinternal_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/analysisinternal"
+)
+
+type key struct{ name string }
+
+func TestGet(t *testing.T) {
+	var (
+		values analysisinternal.SharedValues
+		mu     sync.Mutex
+		builds = make(map[key]int)
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		for _, k := range []key{{"a"}, {"b"}} {
+			wg.Add(1)
+			go func(k key) {
+				defer wg.Done()
+				v, err := values.Get(k, func() (interface{}, error) {
+					mu.Lock()
+					builds[k]++
+					mu.Unlock()
+					return k.name, nil
+				})
+				if err != nil || v != k.name {
+					t.Errorf("Get(%v) = %v, %v, want %v, nil", k, v, err, k.name)
+				}
+			}(k)
+		}
+	}
+	wg.Wait()
+	for k, n := range builds {
+		if n != 1 {
+			t.Errorf("value for %v was built %d times, want 1", k, n)
+		}
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"testing"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
-	"github.com/jackie-feng/tools/internal/lsp/diff/difftest"
+	"github.com/jackie-feng/tools/internal/diff"
+	"github.com/jackie-feng/tools/internal/diff/difftest"
 	"github.com/jackie-feng/tools/internal/span"
 )
 
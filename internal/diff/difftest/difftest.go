@@ -4,14 +4,14 @@
 
 // Package difftest supplies a set of tests that will operate on any
 // implementation of a diff algorithm as exposed by
-// "github.com/jackie-feng/tools/internal/lsp/diff"
+// "github.com/jackie-feng/tools/internal/diff"
 package difftest
 
 import (
 	"fmt"
 	"testing"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/span"
 )
 
@@ -4,7 +4,7 @@
 
 // Package difftest supplies a set of tests that will operate on any
 // implementation of a diff algorithm as exposed by
-// "github.com/jackie-feng/tools/internal/lsp/diff"
+// "github.com/jackie-feng/tools/internal/diff"
 package difftest_test
 
 import (
@@ -15,7 +15,7 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff/difftest"
+	"github.com/jackie-feng/tools/internal/diff/difftest"
 	"github.com/jackie-feng/tools/internal/testenv"
 )
 
@@ -8,7 +8,7 @@ package myers
 import (
 	"strings"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/span"
 )
 
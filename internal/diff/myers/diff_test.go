@@ -7,8 +7,8 @@ package myers_test
 import (
 	"testing"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff/difftest"
-	"github.com/jackie-feng/tools/internal/lsp/diff/myers"
+	"github.com/jackie-feng/tools/internal/diff/difftest"
+	"github.com/jackie-feng/tools/internal/diff/myers"
 )
 
 func TestDiff(t *testing.T) {
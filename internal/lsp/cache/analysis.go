@@ -254,6 +254,7 @@ func runAnalysis(ctx context.Context, fset *token.FileSet, analyzer *analysis.An
 		TypesInfo:  pkg.GetTypesInfo(),
 		TypesSizes: pkg.GetTypesSizes(),
 		ResultOf:   inputs,
+		Shared:     pkg.analysisValues.Get,
 		Report: func(d analysis.Diagnostic) {
 			// Prefix the diagnostic category with the analyzer's name.
 			if d.Category == "" {
@@ -2,15 +2,25 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:generate go run mkbuiltin.go
+
 package cache
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"go/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/jackie-feng/tools/go/packages"
 	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
 	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
+	errors "golang.org/x/xerrors"
 )
 
 type builtinPkg struct {
@@ -34,17 +44,31 @@ func (b *builtinPkg) CompiledGoFiles() []source.ParseGoHandle {
 // i.e. it has not been added to the session's list of views.
 func (v *view) buildBuiltinPackage(ctx context.Context) error {
 	cfg := v.Config(ctx)
-	pkgs, err := packages.Load(cfg, "builtin")
-	if err != nil {
-		return err
+	var handles []source.FileHandle
+	if pkgs, err := packages.Load(cfg, "builtin"); err == nil && len(pkgs) == 1 {
+		for _, filename := range pkgs[0].GoFiles {
+			fh := v.session.GetFile(span.FileURI(filename), source.Go)
+			if _, _, err := fh.Read(ctx); err != nil {
+				handles = nil
+				break
+			}
+			handles = append(handles, fh)
+		}
 	}
-	if len(pkgs) != 1 {
-		return err
+	// The GOROOT sources may not be available, for example in sandboxed
+	// environments. Fall back to the copy of builtin.go bundled in the binary.
+	if len(handles) == 0 {
+		filename, err := writeBundledBuiltin()
+		if err != nil {
+			return errors.Errorf("writing bundled builtin package: %w", err)
+		}
+		fh := v.session.GetFile(span.FileURI(filename), source.Go)
+		log.Print(ctx, "using bundled builtin package", telemetry.File.Of(fh.Identity().URI))
+		handles = append(handles, fh)
 	}
-	pkg := pkgs[0]
 	files := make(map[string]*ast.File)
-	for _, filename := range pkg.GoFiles {
-		fh := v.session.GetFile(span.FileURI(filename), source.Go)
+	for _, fh := range handles {
+		filename := fh.Identity().URI.Filename()
 		ph := v.session.cache.ParseGoHandle(fh, source.ParseFull)
 		v.builtin.files = append(v.builtin.files, ph)
 		file, _, _, err := ph.Parse(ctx)
@@ -57,6 +81,52 @@ func (v *view) buildBuiltinPackage(ctx context.Context) error {
 		v.ignoredURIs[span.NewURI(filename)] = struct{}{}
 		v.ignoredURIsMu.Unlock()
 	}
+	var err error
 	v.builtin.pkg, err = ast.NewPackage(cfg.Fset, files, nil, nil)
 	return err
 }
+
+// bundledBuiltinPath returns the file to which the copy of builtin.go
+// bundled in the binary is written, so that it may be read and served like
+// any other file. The file is named after the hash of its contents, so that
+// different versions of gopls do not overwrite each other's copy.
+func bundledBuiltinPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	hash := sha256.Sum256([]byte(builtinSource))
+	return filepath.Join(dir, "gopls", "builtin", fmt.Sprintf("%x", hash[:8]), "builtin.go")
+}
+
+// writeBundledBuiltin writes the bundled builtin.go to bundledBuiltinPath,
+// unless a previous session already did, and returns its file name.
+func writeBundledBuiltin() (string, error) {
+	filename := bundledBuiltinPath()
+	if data, err := ioutil.ReadFile(filename); err == nil && string(data) == builtinSource {
+		return filename, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", err
+	}
+	// Write to a temporary file first, so that a concurrent session
+	// never reads a partially written file.
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "builtin-*.go")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.WriteString(builtinSource); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return filename, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestBundledBuiltin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopls-builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Point os.UserCacheDir at the temporary directory on every platform.
+	for _, env := range []string{"XDG_CACHE_HOME", "HOME", "LocalAppData"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, dir)
+	}
+	goroot, folder := dir+"/goroot", dir+"/src"
+	for _, d := range []string{goroot, folder} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	options := source.DefaultOptions
+	options.Env = append(os.Environ(), "GOROOT="+goroot, "GOPATH="+dir+"/gopath", "GO111MODULE=off")
+	s := New(nil).NewSession(ctx).(*session)
+	v := &view{
+		session:     s,
+		options:     options,
+		folder:      span.FileURI(folder),
+		ignoredURIs: make(map[span.URI]struct{}),
+		builtin:     &builtinPkg{},
+	}
+	// Like createView, ignore the error that ast.NewPackage reports for
+	// the names that builtin.go uses without importing, such as cmp.
+	v.buildBuiltinPackage(ctx)
+	if v.builtin.Lookup("append") == nil {
+		t.Errorf("bundled builtin package does not declare append")
+	}
+	files := v.builtin.CompiledGoFiles()
+	if len(files) != 1 {
+		t.Fatalf("got %d builtin files, want 1", len(files))
+	}
+	// The file must be served like any other file of the session.
+	fh := files[0].File()
+	if fh.FileSystem() == nil {
+		t.Errorf("bundled builtin file has no file system")
+	}
+	uri := fh.Identity().URI
+	data, err := ioutil.ReadFile(uri.Filename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != builtinSource {
+		t.Errorf("%s does not hold the bundled builtin.go", uri.Filename())
+	}
+	if !v.Ignore(uri) {
+		t.Errorf("%s is not ignored", uri)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"go/token"
 	"strconv"
+	"sync"
 	"sync/atomic"
 
 	"github.com/jackie-feng/tools/internal/lsp/debug"
@@ -37,6 +38,14 @@ type cache struct {
 	options func(*source.Options)
 
 	store memoize.Store
+
+	// views are the loaded views of all of the cache's sessions.
+	viewsMu sync.Mutex
+	views   []*view
+
+	// sessions are the sessions of the cache that are not shut down.
+	sessionsMu sync.Mutex
+	sessions   []*session
 }
 
 type fileKey struct {
@@ -81,6 +90,7 @@ func (c *cache) NewSession(ctx context.Context) source.Session {
 		options:  source.DefaultOptions,
 		overlays: make(map[span.URI]*overlay),
 	}
+	c.addSession(s)
 	debug.AddSession(debugSession{s})
 	return s
 }
@@ -11,9 +11,12 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"os"
+	"runtime"
 	"sort"
 	"sync"
 
+	"github.com/jackie-feng/tools/go/gcexportdata"
 	"github.com/jackie-feng/tools/go/packages"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/lsp/telemetry"
@@ -24,6 +27,9 @@ import (
 	errors "golang.org/x/xerrors"
 )
 
+// Limits the number of parallel type checker calls per process.
+var checkLimit = make(chan struct{}, runtime.GOMAXPROCS(0))
+
 // packageHandle implements source.CheckPackageHandle.
 type packageHandle struct {
 	handle *memoize.Handle
@@ -86,13 +92,27 @@ func (s *snapshot) packageHandle(ctx context.Context, id packageID, mode source.
 	fset := s.view.session.cache.fset
 
 	h := s.view.session.cache.store.Bind(string(key), func(ctx context.Context) interface{} {
-		// Begin loading the direct dependencies, in parallel.
+		// Type-check the direct dependencies first, in parallel, so that
+		// this package does not hold a checkLimit slot while waiting for them.
+		var wg sync.WaitGroup
 		for _, dep := range deps {
+			wg.Add(1)
 			go func(dep *packageHandle) {
 				dep.check(ctx)
+				wg.Done()
 			}(dep)
 		}
+		wg.Wait()
+
 		data := &packageData{}
+		select {
+		case checkLimit <- struct{}{}:
+		case <-ctx.Done():
+			data.err = ctx.Err()
+			return data
+		}
+		defer func() { <-checkLimit }()
+
 		data.pkg, data.err = typeCheck(ctx, fset, m, mode, goFiles, compiledGoFiles, deps)
 		return data
 	})
@@ -110,6 +130,12 @@ func (s *snapshot) buildKey(ctx context.Context, id packageID, mode source.Parse
 	if m == nil {
 		return nil, nil, errors.Errorf("no metadata for %s", id)
 	}
+	if m.lazyDeps {
+		var err error
+		if m, err = s.loadDependencies(ctx, m); err != nil {
+			return nil, nil, err
+		}
+	}
 	goFiles, err := s.parseGoHandles(ctx, m.goFiles, mode)
 	if err != nil {
 		return nil, nil, err
@@ -137,7 +163,7 @@ func (s *snapshot) buildKey(ctx context.Context, id packageID, mode source.Parse
 	var depKeys [][]byte
 	for _, depID := range depList {
 		mode := source.ParseExported
-		if s.workspacePackages[depID] {
+		if s.isWorkspacePackage(depID) {
 			mode = source.ParseFull
 		}
 		depHandle, err := s.packageHandle(ctx, depID, mode)
@@ -235,6 +261,20 @@ func typeCheck(ctx context.Context, fset *token.FileSet, m *metadata, mode sourc
 	ctx, done := trace.StartSpan(ctx, "cache.importer.typeCheck", telemetry.Package.Of(m.id))
 	defer done()
 
+	// Dependencies outside of the workspace only need their exported API,
+	// so read it from the compiler's export data if we have it.
+	// Fall back to the source if the export data cannot be read.
+	if mode == source.ParseExported && m.exportFile != "" {
+		pkg, err := typeCheckExportData(ctx, fset, m, goFiles, compiledGoFiles, deps)
+		if err == nil {
+			return pkg, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Error(ctx, "unable to read export data", err, telemetry.Package.Of(m.id), telemetry.File.Of(m.exportFile))
+	}
+
 	var rawErrors []error
 	for _, err := range m.errors {
 		rawErrors = append(rawErrors, err)
@@ -332,7 +372,7 @@ func typeCheck(ctx context.Context, fset *token.FileSet, m *metadata, mode sourc
 
 	// We don't care about a package's errors unless we have parsed it in full.
 	if mode == source.ParseFull {
-		for _, e := range rawErrors {
+		for _, e := range groupTypeErrors(rawErrors) {
 			srcErr, err := sourceError(ctx, fset, pkg, e)
 			if err != nil {
 				log.Error(ctx, "unable to compute error positions", err, telemetry.Package.Of(pkg.ID()))
@@ -344,6 +384,73 @@ func typeCheck(ctx context.Context, fset *token.FileSet, m *metadata, mode sourc
 	return pkg, nil
 }
 
+// typeCheckExportData builds the type information for a package from the
+// export data in m.exportFile. The package's files are not parsed, so the
+// resulting package has no syntax and its types.Info is empty.
+func typeCheckExportData(ctx context.Context, fset *token.FileSet, m *metadata, goFiles []source.ParseGoHandle, compiledGoFiles []source.ParseGoHandle, deps map[packagePath]*packageHandle) (*pkg, error) {
+	ctx, done := trace.StartSpan(ctx, "cache.importer.typeCheckExportData", telemetry.Package.Of(m.id))
+	defer done()
+
+	pkg := &pkg{
+		id:              m.id,
+		pkgPath:         m.pkgPath,
+		mode:            source.ParseExported,
+		goFiles:         goFiles,
+		compiledGoFiles: compiledGoFiles,
+		imports:         make(map[packagePath]*pkg),
+		typesSizes:      m.typesSizes,
+		typesInfo: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Scopes:     make(map[ast.Node]*types.Scope),
+		},
+	}
+
+	// Seed the importer with the already type-checked dependencies, so that
+	// the objects in the export data refer to the same types.Packages
+	// as the rest of the snapshot.
+	imports := make(map[string]*types.Package)
+	for _, dep := range deps {
+		depPkg, err := dep.check(ctx)
+		if err != nil {
+			return nil, err
+		}
+		pkg.imports[depPkg.pkgPath] = depPkg
+		addImportedTypes(imports, depPkg)
+	}
+
+	f, err := os.Open(m.exportFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := gcexportdata.NewReader(f)
+	if err != nil {
+		return nil, errors.Errorf("reading export data for %s: %w", m.pkgPath, err)
+	}
+	pkg.types, err = gcexportdata.Read(r, fset, imports, string(m.pkgPath))
+	if err != nil {
+		return nil, errors.Errorf("reading export data for %s: %w", m.pkgPath, err)
+	}
+	return pkg, nil
+}
+
+// addImportedTypes adds the types.Package of pkg and all of its transitive
+// dependencies to imports.
+func addImportedTypes(imports map[string]*types.Package, pkg *pkg) {
+	if _, ok := imports[string(pkg.pkgPath)]; ok {
+		return
+	}
+	imports[string(pkg.pkgPath)] = pkg.types
+	for _, dep := range pkg.imports {
+		addImportedTypes(imports, dep)
+	}
+}
+
 // An importFunc is an implementation of the single-method
 // types.Importer interface based on a function value.
 type importerFunc func(path string) (*types.Package, error)
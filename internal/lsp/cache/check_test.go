@@ -0,0 +1,143 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackie-feng/tools/go/gcexportdata"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestTypeCheckExportData(t *testing.T) {
+	const src = `package dep
+
+const C = 1 << 10
+
+var V, v = []string{"a"}, 0
+
+type I interface {
+	M(x int) (string, error)
+	error
+}
+
+type S struct {
+	F   int
+	g   *S
+	Map map[string]I
+}
+
+func (s *S) M(x int) (string, error) { return "", nil }
+
+func (S) n() {}
+
+type N int
+
+func F(s ...S) func() N {
+	return func() N { return N(len(s)) }
+}
+`
+	dir, err := ioutil.TempDir("", "exportdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Write the export data of the package, checked from source by
+	// go/types, in the format of a compiler's object file.
+	exportFset := token.NewFileSet()
+	f, err := parser.ParseFile(exportFset, "dep.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked, err := new(types.Config).Check("example.com/dep", exportFset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("go object test\n\n$$B\n")
+	if err := gcexportdata.Write(&buf, exportFset, checked); err != nil {
+		t.Fatal(err)
+	}
+	exportFile := filepath.Join(dir, "dep.a")
+	if err := ioutil.WriteFile(exportFile, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := New(nil).(*cache)
+	fh := memFileHandle{span.FileURI(filepath.Join(dir, "dep.go")), src}
+	files := []source.ParseGoHandle{c.ParseGoHandle(fh, source.ParseExported)}
+	m := &metadata{
+		id:      "example.com/dep",
+		pkgPath: "example.com/dep",
+		name:    "dep",
+	}
+	fromSource, err := typeCheck(ctx, c.fset, m, source.ParseExported, files, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.exportFile = exportFile
+	fromExport, err := typeCheck(ctx, c.fset, m, source.ParseExported, files, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The package read from export data has no type information for
+	// the syntax of its files.
+	if n := len(fromExport.GetTypesInfo().Defs); n != 0 {
+		t.Errorf("package read from export data has %d definitions, want none", n)
+	}
+
+	// The exported API must be the same.
+	want, got := fromSource.GetTypes(), fromExport.GetTypes()
+	if got.Path() != want.Path() || got.Name() != want.Name() {
+		t.Errorf("got package %s %s from export data, want %s %s", got.Name(), got.Path(), want.Name(), want.Path())
+	}
+	for _, name := range want.Scope().Names() {
+		wantObj := want.Scope().Lookup(name)
+		if !wantObj.Exported() {
+			continue
+		}
+		gotObj := got.Scope().Lookup(name)
+		if gotObj == nil {
+			t.Errorf("%s is missing from the export data", name)
+			continue
+		}
+		if gotStr, wantStr := types.ObjectString(gotObj, nil), types.ObjectString(wantObj, nil); gotStr != wantStr {
+			t.Errorf("got %s from the export data, want %s", gotStr, wantStr)
+		}
+		named, ok := wantObj.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		gotNamed := gotObj.Type().(*types.Named)
+		if gotNamed.NumMethods() != named.NumMethods() {
+			t.Errorf("got %d methods of %s from the export data, want %d", gotNamed.NumMethods(), name, named.NumMethods())
+		}
+		for i := 0; i < named.NumMethods() && i < gotNamed.NumMethods(); i++ {
+			if gotStr, wantStr := types.ObjectString(gotNamed.Method(i), nil), types.ObjectString(named.Method(i), nil); gotStr != wantStr {
+				t.Errorf("got method %s from the export data, want %s", gotStr, wantStr)
+			}
+		}
+		if types.TypeString(gotNamed.Underlying(), nil) != types.TypeString(named.Underlying(), nil) {
+			t.Errorf("got underlying type %s of %s from the export data, want %s", gotNamed.Underlying(), name, named.Underlying())
+		}
+	}
+	for _, name := range got.Scope().Names() {
+		if obj := got.Scope().Lookup(name); obj.Exported() && want.Scope().Lookup(name) == nil {
+			t.Errorf("export data has %s, which the source does not declare", name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/tag"
+)
+
+// collectInterval is how often collectPackages reads the heap size.
+const collectInterval = 10 * time.Second
+
+// collectPackages drops the type-checked packages of the view that are not
+// reachable from the open files whenever the heap is larger than the
+// MemoryGCThreshold option, until the view is shut down. The metadata of the
+// dropped packages is kept, and they are checked again when they are next
+// needed, so that the memory held by packages no longer worked on is given
+// back rather than growing with every package ever checked.
+func (v *view) collectPackages(ctx context.Context) {
+	ticker := time.NewTicker(collectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+		max := v.Options().MemoryGCThreshold
+		if max == 0 {
+			continue
+		}
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		if m.HeapAlloc <= max {
+			continue
+		}
+		var open []span.URI
+		for _, fh := range v.session.OpenFiles() {
+			open = append(open, fh.Identity().URI)
+		}
+		if n := v.currentSnapshot().dropUnreachablePackages(open); n > 0 {
+			log.Print(ctx, "dropped type-checked packages", tag.Of("Packages", n), tag.Of("HeapAlloc", m.HeapAlloc), telemetry.Directory.Of(v.folder))
+		}
+	}
+}
+
+// dropUnreachablePackages forgets the package and analysis handles of the
+// packages that are neither the packages of the given files nor their
+// dependencies, and returns the number of packages it forgot. Their metadata
+// is kept, so that they may be checked again.
+func (s *snapshot) dropUnreachablePackages(uris []span.URI) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reachable := make(map[packageID]bool)
+	var visit func(id packageID)
+	visit = func(id packageID) {
+		if reachable[id] {
+			return
+		}
+		reachable[id] = true
+		if m := s.metadata[id]; m != nil {
+			for _, dep := range m.deps {
+				visit(dep)
+			}
+		}
+	}
+	for _, uri := range uris {
+		for _, id := range s.ids[uri] {
+			visit(id)
+		}
+	}
+
+	dropped := make(map[packageID]bool)
+	for key := range s.packages {
+		if !reachable[key.id] {
+			delete(s.packages, key)
+			dropped[key.id] = true
+		}
+	}
+	for key := range s.actions {
+		if !reachable[key.pkg.id] {
+			delete(s.actions, key)
+		}
+	}
+	return len(dropped)
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestDropUnreachablePackages(t *testing.T) {
+	// a imports b, which imports c. d imports c, and e is alone.
+	s := &snapshot{
+		ids: map[span.URI][]packageID{
+			span.FileURI("/w/a/a.go"): {"a"},
+		},
+		metadata: map[packageID]*metadata{
+			"a": {id: "a", deps: []packageID{"b"}},
+			"b": {id: "b", deps: []packageID{"c"}},
+			"c": {id: "c"},
+			"d": {id: "d", deps: []packageID{"c"}},
+			"e": {id: "e"},
+		},
+		packages: make(map[packageKey]*packageHandle),
+		actions:  make(map[actionKey]*actionHandle),
+	}
+	for id := range s.metadata {
+		for _, mode := range []source.ParseMode{source.ParseExported, source.ParseFull} {
+			key := packageKey{id: id, mode: mode}
+			s.packages[key] = &packageHandle{}
+			s.actions[actionKey{pkg: key}] = &actionHandle{}
+		}
+	}
+
+	if got := s.dropUnreachablePackages([]span.URI{span.FileURI("/w/a/a.go")}); got != 2 {
+		t.Errorf("dropped %d packages, want 2", got)
+	}
+	for id := range s.metadata {
+		want := 2
+		if id == "d" || id == "e" {
+			want = 0
+		}
+		packages, actions := 0, 0
+		for key := range s.packages {
+			if key.id == id {
+				packages++
+			}
+		}
+		for key := range s.actions {
+			if key.pkg.id == id {
+				actions++
+			}
+		}
+		if packages != want || actions != want {
+			t.Errorf("%s: got %d package and %d action handles, want %d", id, packages, actions, want)
+		}
+	}
+	if len(s.metadata) != 5 {
+		t.Errorf("got %d metadata, want 5", len(s.metadata))
+	}
+}
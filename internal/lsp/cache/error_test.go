@@ -5,8 +5,15 @@
 package cache
 
 import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"strings"
 	"testing"
+
+	"github.com/jackie-feng/tools/go/ast/astutil"
 )
 
 func TestParseErrorMessage(t *testing.T) {
@@ -50,3 +57,64 @@ func TestParseErrorMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestGroupTypeErrors(t *testing.T) {
+	errs := []error{
+		errors.New("import error"),
+		types.Error{Msg: "x redeclared in this block"},
+		types.Error{Msg: "\tother declaration of x"},
+		types.Error{Msg: "undeclared name: y"},
+	}
+	got := groupTypeErrors(errs)
+	if len(got) != 3 {
+		t.Fatalf("got %d errors, want 3: %v", len(got), got)
+	}
+	group, ok := got[1].(*typeErrorGroup)
+	if !ok || group.primary.Msg != "x redeclared in this block" || len(group.continuations) != 1 {
+		t.Errorf("got %#v, want the redeclaration with its other declaration", got[1])
+	}
+	if group, ok := got[2].(*typeErrorGroup); !ok || len(group.continuations) != 0 {
+		t.Errorf("got %#v, want an error without continuations", got[2])
+	}
+}
+
+func TestTopLevelDeclRange(t *testing.T) {
+	const src = `package a
+
+// F is old.
+func F() {}
+
+var a, b int
+
+func G() {
+	var c int
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "a.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		context string // the text that ends with the identifier
+		want    string // the deleted text, or "" for none
+	}{
+		{"func F", "// F is old.\nfunc F() {}\n"},
+		{"var a, b", ""},
+		{"var c", ""},
+	} {
+		pos := file.Pos() + token.Pos(strings.Index(src, test.context)+len(test.context)-1)
+		path, _ := astutil.PathEnclosingInterval(file, pos, pos)
+		if _, ok := path[0].(*ast.Ident); !ok {
+			t.Fatalf("no identifier at the end of %q", test.context)
+		}
+		start, end, ok := topLevelDeclRange(fset, path)
+		var got string
+		if ok {
+			got = src[fset.Position(start).Offset:fset.Position(end).Offset]
+		}
+		if got != test.want {
+			t.Errorf("topLevelDeclRange(%q) deletes %q, want %q", test.context, got, test.want)
+		}
+	}
+}
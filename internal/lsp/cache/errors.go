@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"go/ast"
 	"go/scanner"
 	"go/token"
 	"go/types"
@@ -16,6 +17,7 @@ import (
 	"strings"
 
 	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/ast/astutil"
 	"github.com/jackie-feng/tools/go/packages"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
@@ -31,6 +33,7 @@ func sourceError(ctx context.Context, fset *token.FileSet, pkg *pkg, e interface
 		err           error
 		msg, category string
 		kind          source.ErrorKind
+		severity      protocol.DiagnosticSeverity
 		fixes         []source.SuggestedFix
 		related       []source.RelatedInformation
 	)
@@ -84,6 +87,32 @@ func sourceError(ctx context.Context, fset *token.FileSet, pkg *pkg, e interface
 			return nil, err
 		}
 
+	case *typeErrorGroup:
+		msg = e.primary.Msg
+		kind = source.TypeError
+		spn, err = typeErrorRange(ctx, fset, pkg, e.primary.Pos)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range e.continuations {
+			cspn, err := typeErrorRange(ctx, fset, pkg, c.Pos)
+			if err != nil {
+				return nil, err
+			}
+			rng, err := spanToRange(ctx, pkg, cspn)
+			if err != nil {
+				return nil, err
+			}
+			related = append(related, source.RelatedInformation{
+				URI:     cspn.URI(),
+				Range:   rng,
+				Message: strings.TrimSpace(c.Msg),
+			})
+		}
+		if strings.HasSuffix(msg, " redeclared in this block") && len(e.continuations) > 0 {
+			fixes = redeclarationFixes(ctx, fset, pkg, e.primary.Pos, e.continuations[0].Pos)
+		}
+
 	case *analysis.Diagnostic:
 		spn, err = span.NewRange(fset, e.Pos, e.End).Span()
 		if err != nil {
@@ -92,6 +121,14 @@ func sourceError(ctx context.Context, fset *token.FileSet, pkg *pkg, e interface
 		msg = e.Message
 		kind = source.Analysis
 		category = e.Category
+		switch e.Severity {
+		case analysis.SeverityError:
+			severity = protocol.SeverityError
+		case analysis.SeverityWarning:
+			severity = protocol.SeverityWarning
+		case analysis.SeverityInfo:
+			severity = protocol.SeverityInformation
+		}
 		fixes, err = suggestedFixes(ctx, fset, pkg, e)
 		if err != nil {
 			return nil, err
@@ -115,6 +152,7 @@ func sourceError(ctx context.Context, fset *token.FileSet, pkg *pkg, e interface
 		Message:        msg,
 		Kind:           kind,
 		Category:       category,
+		Severity:       severity,
 		SuggestedFixes: fixes,
 		Related:        related,
 	}, nil
@@ -166,6 +204,177 @@ func relatedInformation(ctx context.Context, fset *token.FileSet, pkg *pkg, diag
 	return out, nil
 }
 
+// typeErrorGroup is a type error together with the continuation errors
+// that the type checker reported right after it, such as the position of
+// the other declaration of a redeclared object.
+type typeErrorGroup struct {
+	primary       types.Error
+	continuations []types.Error
+}
+
+func (e *typeErrorGroup) Error() string {
+	return e.primary.Error()
+}
+
+// groupTypeErrors attaches each continuation error, whose message the type
+// checker indents with a tab, to the error that precedes it, so that they
+// are reported as a single diagnostic.
+func groupTypeErrors(errs []error) []error {
+	var result []error
+	for _, err := range errs {
+		terr, ok := err.(types.Error)
+		if !ok {
+			result = append(result, err)
+			continue
+		}
+		if strings.HasPrefix(terr.Msg, "\t") && len(result) > 0 {
+			if group, ok := result[len(result)-1].(*typeErrorGroup); ok {
+				group.continuations = append(group.continuations, terr)
+				continue
+			}
+		}
+		result = append(result, &typeErrorGroup{primary: terr})
+	}
+	return result
+}
+
+// redeclarationFixes returns the fixes for an object declared at pos that
+// was already declared at otherPos: renaming the new declaration, or
+// deleting either one of them if they are both package-level declarations.
+func redeclarationFixes(ctx context.Context, fset *token.FileSet, pkg *pkg, pos, otherPos token.Pos) []source.SuggestedFix {
+	ident, path := identAt(fset, pkg, pos)
+	if ident == nil {
+		return nil
+	}
+	var fixes []source.SuggestedFix
+	scope := pkg.types.Scope().Innermost(pos)
+	if scope == nil {
+		scope = pkg.types.Scope()
+	}
+	var newName string
+	for i := 2; ; i++ {
+		newName = fmt.Sprintf("%s%d", ident.Name, i)
+		if _, obj := scope.LookupParent(newName, token.NoPos); obj == nil {
+			break
+		}
+	}
+	if fix, err := editFix(ctx, fset, pkg, fmt.Sprintf("Rename to %s", newName), ident.Pos(), ident.End(), newName); err == nil {
+		fixes = append(fixes, fix)
+	}
+	for _, d := range []struct {
+		title string
+		path  []ast.Node
+	}{
+		{"Delete this declaration of " + ident.Name, path},
+		{"Delete the other declaration of " + ident.Name, nil},
+	} {
+		p := d.path
+		if p == nil {
+			if _, p = identAt(fset, pkg, otherPos); p == nil {
+				continue
+			}
+		}
+		start, end, ok := topLevelDeclRange(fset, p)
+		if !ok {
+			continue
+		}
+		if fix, err := editFix(ctx, fset, pkg, d.title, start, end, ""); err == nil {
+			fixes = append(fixes, fix)
+		}
+	}
+	return fixes
+}
+
+// identAt returns the identifier at pos in one of the package's files,
+// along with the path of nodes enclosing it.
+func identAt(fset *token.FileSet, pkg *pkg, pos token.Pos) (*ast.Ident, []ast.Node) {
+	for _, file := range pkg.GetSyntax() {
+		if file.Pos() > pos || pos > file.End() {
+			continue
+		}
+		path, _ := astutil.PathEnclosingInterval(file, pos, pos)
+		if len(path) == 0 {
+			return nil, nil
+		}
+		ident, ok := path[0].(*ast.Ident)
+		if !ok {
+			return nil, nil
+		}
+		return ident, path
+	}
+	return nil, nil
+}
+
+// topLevelDeclRange returns the range of text to delete in order to remove
+// the package-level declaration of the identifier that path encloses,
+// including its doc comment and the rest of its last line. It reports
+// false if the identifier is not declared by itself.
+func topLevelDeclRange(fset *token.FileSet, path []ast.Node) (token.Pos, token.Pos, bool) {
+	if len(path) < 3 {
+		return token.NoPos, token.NoPos, false
+	}
+	var (
+		node ast.Node
+		name *ast.Ident
+	)
+	switch decl := path[len(path)-2].(type) {
+	case *ast.FuncDecl:
+		if decl.Recv == nil {
+			node, name = decl, decl.Name
+		}
+	case *ast.GenDecl:
+		if len(decl.Specs) != 1 {
+			break
+		}
+		switch spec := decl.Specs[0].(type) {
+		case *ast.TypeSpec:
+			node, name = decl, spec.Name
+		case *ast.ValueSpec:
+			if len(spec.Names) == 1 {
+				node, name = decl, spec.Names[0]
+			}
+		}
+	}
+	if node == nil || name != path[0] {
+		return token.NoPos, token.NoPos, false
+	}
+	start, end := node.Pos(), node.End()
+	switch decl := node.(type) {
+	case *ast.FuncDecl:
+		if decl.Doc != nil {
+			start = decl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if decl.Doc != nil {
+			start = decl.Doc.Pos()
+		}
+	}
+	if tok := fset.File(end); tok != nil {
+		if line := tok.Line(end); line < tok.LineCount() {
+			end = tok.LineStart(line + 1)
+		}
+	}
+	return start, end, true
+}
+
+// editFix returns a fix that replaces the text between start and end.
+func editFix(ctx context.Context, fset *token.FileSet, pkg *pkg, title string, start, end token.Pos, newText string) (source.SuggestedFix, error) {
+	spn, err := span.NewRange(fset, start, end).Span()
+	if err != nil {
+		return source.SuggestedFix{}, err
+	}
+	rng, err := spanToRange(ctx, pkg, spn)
+	if err != nil {
+		return source.SuggestedFix{}, err
+	}
+	return source.SuggestedFix{
+		Title: title,
+		Edits: map[span.URI][]protocol.TextEdit{
+			spn.URI(): {{Range: rng, NewText: newText}},
+		},
+	}, nil
+}
+
 func toSourceErrorKind(kind packages.ErrorKind) source.ErrorKind {
 	switch kind {
 	case packages.ListError:
@@ -0,0 +1,57 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+// fileResultKey identifies a cached per-file result.
+type fileResultKey struct {
+	uri  span.URI
+	kind source.FileResultKind
+}
+
+// fileResult is the result of a per-file request, computed for a single
+// version of the file.
+type fileResult struct {
+	identity source.FileIdentity
+
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+func (s *snapshot) FileResult(ctx context.Context, fh source.FileHandle, kind source.FileResultKind, compute func(context.Context) (interface{}, error)) (interface{}, error) {
+	key := fileResultKey{
+		uri:  fh.Identity().URI,
+		kind: kind,
+	}
+	s.mu.Lock()
+	r, ok := s.fileResults[key]
+	if !ok || r.identity != fh.Identity() {
+		r = &fileResult{identity: fh.Identity()}
+		s.fileResults[key] = r
+	}
+	s.mu.Unlock()
+
+	r.once.Do(func() {
+		r.value, r.err = compute(ctx)
+	})
+	if r.err != nil {
+		// Don't cache errors, as they may be caused by cancellation.
+		s.mu.Lock()
+		if s.fileResults[key] == r {
+			delete(s.fileResults, key)
+		}
+		s.mu.Unlock()
+		return nil, r.err
+	}
+	return r.value, nil
+}
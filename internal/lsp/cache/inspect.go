@@ -0,0 +1,170 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"go/ast"
+	"sort"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+)
+
+// syntaxNodeBytes and typesInfoEntryBytes are rough averages of the memory
+// used by a node of a syntax tree, and by an entry of the maps of a
+// types.Info along with the object or type it refers to, on 64-bit
+// platforms. They are only meant to rank the packages by memory use.
+const (
+	syntaxNodeBytes     = 64
+	typesInfoEntryBytes = 64
+)
+
+// addSession records a new session of the cache.
+func (c *cache) addSession(s *session) {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+	c.sessions = append(c.sessions, s)
+}
+
+// dropSession removes a session that is shut down.
+func (c *cache) dropSession(s *session) {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+	for i, existing := range c.sessions {
+		if existing == s {
+			copy(c.sessions[i:], c.sessions[i+1:])
+			c.sessions[len(c.sessions)-1] = nil
+			c.sessions = c.sessions[:len(c.sessions)-1]
+			return
+		}
+	}
+}
+
+func (s *session) Inspect() *source.CacheInspection {
+	s.cache.sessionsMu.Lock()
+	sessions := append([]*session(nil), s.cache.sessions...)
+	s.cache.sessionsMu.Unlock()
+
+	result := &source.CacheInspection{}
+	for _, session := range sessions {
+		si := session.inspect()
+		si.Current = session == s
+		result.Sessions = append(result.Sessions, si)
+	}
+	return result
+}
+
+func (s *session) inspect() source.SessionInspection {
+	result := source.SessionInspection{ID: s.id}
+
+	s.overlayMu.Lock()
+	for uri, o := range s.overlays {
+		result.Overlays = append(result.Overlays, source.OverlayInspection{
+			URI:     string(uri),
+			Version: o.version,
+			Bytes:   len(o.text),
+			Saved:   o.sameContentOnDisk,
+		})
+	}
+	s.overlayMu.Unlock()
+	sort.Slice(result.Overlays, func(i, j int) bool {
+		return result.Overlays[i].URI < result.Overlays[j].URI
+	})
+
+	s.viewMu.Lock()
+	views := append([]*view(nil), s.views...)
+	s.viewMu.Unlock()
+	for _, v := range views {
+		result.Views = append(result.Views, v.inspect())
+	}
+	return result
+}
+
+// inspect describes the view's current snapshot, without applying any
+// pending changes to it.
+func (v *view) inspect() source.ViewInspection {
+	result := source.ViewInspection{
+		ID:       v.id,
+		Name:     v.name,
+		Folder:   v.folder.Filename(),
+		Degraded: v.degraded,
+	}
+
+	// Collect the packages under the lock of the snapshot, and measure
+	// them after releasing it, as walking their syntax takes a while.
+	s := v.currentSnapshot()
+	s.mu.Lock()
+	packages := make(map[packageID]*source.PackageInspection)
+	var ids []packageID
+	for id, m := range s.metadata {
+		packages[id] = &source.PackageInspection{
+			ID:        string(id),
+			PkgPath:   string(m.pkgPath),
+			Workspace: s.workspacePackages[id],
+			Files:     len(m.compiledGoFiles),
+		}
+		ids = append(ids, id)
+	}
+	var handles []*packageHandle
+	for _, ph := range s.packages {
+		handles = append(handles, ph)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(handles, func(i, j int) bool { return handles[i].mode > handles[j].mode })
+	for _, ph := range handles {
+		pi := packages[ph.m.id]
+		if pi == nil {
+			continue
+		}
+		p, _ := ph.cached()
+		if p == nil {
+			continue
+		}
+		pi.Modes = append(pi.Modes, parseModeName(ph.mode))
+		for _, pgh := range p.compiledGoFiles {
+			file, m, _, _ := pgh.Cached()
+			if m != nil {
+				pi.SourceBytes += len(m.Content)
+			}
+			if file != nil {
+				ast.Inspect(file, func(n ast.Node) bool {
+					if n != nil {
+						pi.SyntaxNodes++
+					}
+					return true
+				})
+			}
+		}
+		if info := p.typesInfo; info != nil {
+			pi.TypesInfoEntries += len(info.Types) + len(info.Defs) + len(info.Uses) +
+				len(info.Implicits) + len(info.Selections) + len(info.Scopes)
+		}
+		pi.EstimatedBytes = pi.SourceBytes + pi.SyntaxNodes*syntaxNodeBytes + pi.TypesInfoEntries*typesInfoEntryBytes
+	}
+
+	for _, id := range ids {
+		result.Packages = append(result.Packages, *packages[id])
+	}
+	sort.Slice(result.Packages, func(i, j int) bool {
+		pi, pj := result.Packages[i], result.Packages[j]
+		if pi.EstimatedBytes != pj.EstimatedBytes {
+			return pi.EstimatedBytes > pj.EstimatedBytes
+		}
+		return pi.ID < pj.ID
+	})
+	return result
+}
+
+func parseModeName(mode source.ParseMode) string {
+	switch mode {
+	case source.ParseHeader:
+		return "header"
+	case source.ParseExported:
+		return "exported"
+	case source.ParseFull:
+		return "full"
+	}
+	return "unknown"
+}
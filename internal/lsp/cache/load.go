@@ -5,9 +5,16 @@
 package cache
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/scanner"
+	"go/token"
 	"go/types"
+	"strings"
 
 	"github.com/jackie-feng/tools/go/packages"
 	"github.com/jackie-feng/tools/internal/lsp/source"
@@ -30,11 +37,23 @@ type metadata struct {
 	deps            []packageID
 	missingDeps     map[packagePath]struct{}
 
+	// exportFile is the file containing the compiler's export data for the
+	// package, if it was requested.
+	exportFile string
+
+	// lazyDeps is set if the package was loaded without its imports.
+	// They are loaded on demand, before the package is type-checked.
+	lazyDeps bool
+
 	// config is the *packages.Config associated with the loaded package.
 	config *packages.Config
 }
 
 func (s *snapshot) load(ctx context.Context, scope source.Scope) ([]*metadata, error) {
+	return s.loadWithConfig(ctx, s.view.Config(ctx), scope)
+}
+
+func (s *snapshot) loadWithConfig(ctx context.Context, cfg *packages.Config, scope source.Scope) ([]*metadata, error) {
 	uri := scope.URI()
 	var query string
 	switch scope.(type) {
@@ -54,7 +73,6 @@ func (s *snapshot) load(ctx context.Context, scope source.Scope) ([]*metadata, e
 	ctx, done := trace.StartSpan(ctx, "cache.view.load", telemetry.URI.Of(uri))
 	defer done()
 
-	cfg := s.view.Config(ctx)
 	pkgs, err := packages.Load(cfg, query)
 
 	// If the context was canceled, return early.
@@ -117,6 +135,141 @@ func (c *cache) shouldLoad(ctx context.Context, s *snapshot, originalFH, current
 	return false
 }
 
+// shouldInvalidateImporters reparses a file's exported declarations to
+// determine if a change may affect the packages that import the file's package.
+// Changes confined to function bodies and comments do not.
+func (c *cache) shouldInvalidateImporters(ctx context.Context, originalFH, currentFH source.FileHandle) bool {
+	if originalFH == nil || currentFH.Identity().Kind != source.Go {
+		return true
+	}
+	original, _, originalParseErr, originalErr := c.ParseGoHandle(originalFH, source.ParseExported).Parse(ctx)
+	current, _, currentParseErr, currentErr := c.ParseGoHandle(currentFH, source.ParseExported).Parse(ctx)
+	if originalErr != nil || currentErr != nil || originalParseErr != nil || currentParseErr != nil {
+		return true
+	}
+	// The ASTs are trimmed, so function bodies are not compared.
+	originalHash, ok := c.exportedHash(original)
+	if !ok {
+		return true
+	}
+	currentHash, ok := c.exportedHash(current)
+	if !ok {
+		return true
+	}
+	return originalHash != currentHash
+}
+
+// exportedHash returns a hash of the declarations of a file parsed in
+// ParseExported mode. The declarations are printed, and the tokens of the
+// printed source other than comments are hashed, so that the hash does not
+// depend on positions, layout or comments.
+func (c *cache) exportedHash(file *ast.File) (string, bool) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n", file.Name.Name)
+	for _, decl := range file.Decls {
+		if err := printer.Fprint(&buf, c.fset, decl); err != nil {
+			return "", false
+		}
+		buf.WriteByte('\n')
+	}
+	tokens, ok := scanTokens(buf.Bytes())
+	if !ok {
+		return "", false
+	}
+	h := sha256.New()
+	for i, tok := range tokens {
+		// A semicolon before a closing ")" or "}" is optional, and is
+		// inserted only if the declaration spans several lines.
+		if tok.tok == token.SEMICOLON && i+1 < len(tokens) && (tokens[i+1].tok == token.RPAREN || tokens[i+1].tok == token.RBRACE) {
+			continue
+		}
+		fmt.Fprintf(h, "%d %q\n", tok.tok, tok.lit)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), true
+}
+
+// onlyCommentsChanged reports whether a change to a Go file only touched
+// comments and whitespace, leaving its tokens intact. Comments that affect
+// the build, such as build constraints, directives, and cgo preambles,
+// count as code.
+func (c *cache) onlyCommentsChanged(ctx context.Context, originalFH, currentFH source.FileHandle) bool {
+	if originalFH == nil || originalFH.Identity().Kind != source.Go || currentFH.Identity().Kind != source.Go {
+		return false
+	}
+	original, _, err := originalFH.Read(ctx)
+	if err != nil {
+		return false
+	}
+	current, _, err := currentFH.Read(ctx)
+	if err != nil {
+		return false
+	}
+	originalTokens, ok := scanTokens(original)
+	if !ok {
+		return false
+	}
+	currentTokens, ok := scanTokens(current)
+	if !ok || len(originalTokens) != len(currentTokens) {
+		return false
+	}
+	for i, tok := range originalTokens {
+		if tok != currentTokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceToken is a token of a Go file, without its position.
+type sourceToken struct {
+	tok token.Token
+	lit string
+}
+
+// scanTokens returns the tokens of src, dropping comments other than
+// directives. It reports false if src does not scan cleanly or uses cgo,
+// whose preamble is code written in a comment.
+func scanTokens(src []byte) ([]sourceToken, bool) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var (
+		s      scanner.Scanner
+		failed bool
+	)
+	s.Init(file, src, func(token.Position, string) { failed = true }, scanner.ScanComments)
+	var tokens []sourceToken
+	for {
+		_, tok, lit := s.Scan()
+		switch tok {
+		case token.EOF:
+			return tokens, !failed
+		case token.COMMENT:
+			if !isDirective(lit) {
+				continue
+			}
+		case token.SEMICOLON:
+			// An inserted semicolon is the same as an explicit one.
+			lit = ";"
+		case token.STRING:
+			if lit == `"C"` {
+				return nil, false
+			}
+		}
+		tokens = append(tokens, sourceToken{tok, lit})
+	}
+}
+
+// isDirective reports whether comment is a build constraint or
+// a directive to the go command or the compiler.
+func isDirective(comment string) bool {
+	for _, prefix := range []string{"//go:", "//line ", "/*line ", "//export ", "// +build", "//+build"} {
+		if strings.HasPrefix(comment, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *snapshot) updateMetadata(ctx context.Context, uri source.Scope, pkgs []*packages.Package, cfg *packages.Config) ([]*metadata, error) {
 	var results []*metadata
 	for _, pkg := range pkgs {
@@ -155,6 +308,8 @@ func (s *snapshot) updateImports(ctx context.Context, pkgPath packagePath, pkg *
 		name:       pkg.Name,
 		typesSizes: pkg.TypesSizes,
 		errors:     pkg.Errors,
+		exportFile: pkg.ExportFile,
+		lazyDeps:   cfg.Mode&packages.NeedImports == 0,
 		config:     cfg,
 	}
 
@@ -189,7 +344,7 @@ func (s *snapshot) updateImports(ctx context.Context, pkgPath packagePath, pkg *
 			continue
 		}
 		dep := s.getMetadata(importID)
-		if dep == nil {
+		if dep == nil || dep.lazyDeps {
 			if err := s.updateImports(ctx, importPkgPath, importPkg, cfg, copied); err != nil {
 				log.Error(ctx, "error in dependency", err)
 			}
@@ -201,3 +356,28 @@ func (s *snapshot) updateImports(ctx context.Context, pkgPath packagePath, pkg *
 
 	return nil
 }
+
+// loadDependencies loads the imports of a package that was loaded without
+// them, and returns its updated metadata.
+func (s *snapshot) loadDependencies(ctx context.Context, m *metadata) (*metadata, error) {
+	// The view loads the dependencies of the whole workspace in the
+	// background, which most likely includes this package's.
+	select {
+	case <-s.view.depsLoaded:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if m := s.getMetadata(m.id); m != nil && !m.lazyDeps {
+		return m, nil
+	}
+	if len(m.compiledGoFiles) == 0 {
+		return nil, errors.Errorf("no files for %s", m.id)
+	}
+	if _, err := s.load(ctx, source.FileURI(m.compiledGoFiles[0])); err != nil {
+		return nil, err
+	}
+	if m := s.getMetadata(m.id); m != nil && !m.lazyDeps {
+		return m, nil
+	}
+	return nil, errors.Errorf("no dependencies loaded for %s", m.id)
+}
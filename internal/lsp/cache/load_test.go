@@ -0,0 +1,224 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+type memFileHandle struct {
+	uri  span.URI
+	text string
+}
+
+func (h memFileHandle) FileSystem() source.FileSystem { return nil }
+
+func (h memFileHandle) Identity() source.FileIdentity {
+	return source.FileIdentity{
+		URI:        h.uri,
+		Identifier: hashContents([]byte(h.text)),
+		Kind:       source.Go,
+	}
+}
+
+func (h memFileHandle) Read(context.Context) ([]byte, string, error) {
+	return []byte(h.text), hashContents([]byte(h.text)), nil
+}
+
+func TestShouldInvalidateImporters(t *testing.T) {
+	const original = `package a
+
+// F does something.
+func F(x int) int {
+	return x
+}
+
+type T struct{ f int }
+`
+	tests := []struct {
+		name    string
+		current string
+		want    bool
+	}{
+		{
+			name: "function body",
+			current: `package a
+
+// F does something.
+func F(x int) int {
+	y := x + 1
+
+	return y
+}
+
+type T struct{ f int }
+`,
+			want: false,
+		},
+		{
+			name: "comment",
+			current: `package a
+
+// F does something else.
+func F(x int) int {
+	return x
+}
+
+type T struct{ f int }
+`,
+			want: false,
+		},
+		{
+			name: "field comment",
+			current: `package a
+
+// F does something.
+func F(x int) int {
+	return x
+}
+
+type T struct {
+	f int // f is unexported.
+}
+`,
+			want: false,
+		},
+		{
+			name: "signature",
+			current: `package a
+
+// F does something.
+func F(x int) string {
+	return ""
+}
+
+type T struct{ f int }
+`,
+			want: true,
+		},
+		{
+			name: "unexported field",
+			current: `package a
+
+// F does something.
+func F(x int) int {
+	return x
+}
+
+type T struct{ f, g int }
+`,
+			want: true,
+		},
+		{
+			name: "parse error",
+			current: `package a
+
+func F(x int) int {
+	return x
+`,
+			want: true,
+		},
+	}
+	c := New(nil).(*cache)
+	uri := span.FileURI("/a/a.go")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.shouldInvalidateImporters(context.Background(), memFileHandle{uri, original}, memFileHandle{uri, tt.current})
+			if got != tt.want {
+				t.Errorf("shouldInvalidateImporters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyCommentsChanged(t *testing.T) {
+	const original = `package a
+
+// F does something.
+func F(x int) int {
+	return x
+}
+`
+	tests := []struct {
+		name    string
+		current string
+		want    bool
+	}{
+		{
+			name: "comment",
+			current: `package a
+
+// F does something else,
+// on two lines.
+func F(x int) int {
+	return x /* the argument */
+}
+`,
+			want: true,
+		},
+		{
+			name: "whitespace",
+			current: `package a
+
+// F does something.
+func F(x int) int {
+
+	return   x
+}
+`,
+			want: true,
+		},
+		{
+			name: "function body",
+			current: `package a
+
+// F does something.
+func F(x int) int {
+	return x + 1
+}
+`,
+			want: false,
+		},
+		{
+			name: "build constraint",
+			current: `// +build linux
+
+package a
+
+// F does something.
+func F(x int) int {
+	return x
+}
+`,
+			want: false,
+		},
+		{
+			name: "directive",
+			current: `package a
+
+// F does something.
+//go:noinline
+func F(x int) int {
+	return x
+}
+`,
+			want: false,
+		},
+	}
+	c := New(nil).(*cache)
+	uri := span.FileURI("/a/a.go")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.onlyCommentsChanged(context.Background(), memFileHandle{uri, original}, memFileHandle{uri, tt.current})
+			if got != tt.want {
+				t.Errorf("onlyCommentsChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build ignore
+
+// mkbuiltin generates the zbuiltin.go file, containing the source of the
+// builtin package. It's baked into the binary so that hover and completion
+// of predeclared identifiers work even if $GOROOT/src is not available.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"runtime"
+)
+
+func main() {
+	src, err := ioutil.ReadFile(filepath.Join(runtime.GOROOT(), "src", "builtin", "builtin.go"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if bytes.ContainsRune(src, '`') {
+		log.Fatal("builtin.go contains a backquote and cannot be embedded as a raw string")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by mkbuiltin.go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package cache\n\n")
+	fmt.Fprintf(&buf, "// builtinSource is the content of $GOROOT/src/builtin/builtin.go.\n")
+	fmt.Fprintf(&buf, "const builtinSource = `%s`\n", src)
+	fmtbuf, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("zbuiltin.go", fmtbuf, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -68,5 +68,18 @@ func getModfiles(ctx context.Context, folder string, options source.Options) (*m
 	if err := f.Close(); err != nil {
 		return nil, err
 	}
+	// The go command uses the go.sum file next to the -modfile, so copy
+	// the current go.sum file too, if there is one.
+	if sum, err := ioutil.ReadFile(strings.TrimSuffix(modfile, ".mod") + ".sum"); err == nil {
+		if err := ioutil.WriteFile(tempSumFile(f.Name()), sum, 0666); err != nil {
+			return nil, err
+		}
+	}
 	return &modfiles{real: modfile, temp: f.Name()}, nil
 }
+
+// tempSumFile returns the name of the go.sum file of the temporary go.mod
+// file temp.
+func tempSumFile(temp string) string {
+	return strings.TrimSuffix(temp, ".mod") + ".sum"
+}
@@ -9,6 +9,7 @@ import (
 	"go/ast"
 	"go/types"
 
+	"github.com/jackie-feng/tools/internal/analysisinternal"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/span"
@@ -29,6 +30,9 @@ type pkg struct {
 	types           *types.Package
 	typesInfo       *types.Info
 	typesSizes      types.Sizes
+
+	// analysisValues are shared by the analyzers applied to the package.
+	analysisValues analysisinternal.SharedValues
 }
 
 // Declare explicit types for package paths and IDs to ensure that we never use
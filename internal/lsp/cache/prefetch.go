@@ -0,0 +1,118 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+)
+
+const (
+	// maxPrefetchPackages is the number of packages type-checked by prefetch.
+	maxPrefetchPackages = 50
+
+	// prefetchIdle is how long the view must go without changes before
+	// prefetch type-checks the next package.
+	prefetchIdle = 500 * time.Millisecond
+)
+
+// prefetch type-checks, one at a time and only while the user is not
+// editing, the packages that are likely to be opened next: the packages of
+// the open and recently opened files, and the workspace packages that import
+// them, closest first. The first requests in a newly opened file can then use
+// the cached results rather than wait for the package to be checked.
+func (v *view) prefetch(ctx context.Context) {
+	if !v.Options().Prefetch {
+		return
+	}
+	ctx, done := trace.StartSpan(ctx, "cache.view.prefetch")
+	defer done()
+
+	var seeds []span.URI
+	for uri := range v.session.overlayURIs() {
+		seeds = append(seeds, uri)
+	}
+	v.recentMu.Lock()
+	seeds = append(seeds, v.recentFiles...)
+	v.recentMu.Unlock()
+
+	ids := v.currentSnapshot().prefetchCandidates(seeds, maxPrefetchPackages)
+	for _, id := range ids {
+		if err := v.waitIdle(ctx); err != nil {
+			return
+		}
+		// Check the package in the latest snapshot, so that the results
+		// are those the next request will look for.
+		s := v.currentSnapshot()
+		if s.getMetadata(id) == nil {
+			continue
+		}
+		ph, err := s.packageHandle(ctx, id, source.ParseFull)
+		if err != nil {
+			log.Error(ctx, "prefetch: no package handle", err, telemetry.Package.Of(id))
+			continue
+		}
+		if _, err := ph.Check(ctx); err != nil && ctx.Err() == nil {
+			log.Error(ctx, "prefetch: failed to check", err, telemetry.Package.Of(id))
+		}
+	}
+}
+
+// prefetchCandidates returns up to limit workspace packages, starting with
+// the packages of the given files, followed by the packages that import
+// them, in breadth-first order.
+func (s *snapshot) prefetchCandidates(uris []span.URI, limit int) []packageID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result, queue []packageID
+	seen := make(map[packageID]bool)
+	for _, uri := range uris {
+		for _, id := range s.ids[uri] {
+			if !seen[id] {
+				seen[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+	for len(queue) > 0 && len(result) < limit {
+		id := queue[0]
+		queue = queue[1:]
+		if s.workspacePackages[id] {
+			result = append(result, id)
+		}
+		for _, parent := range s.getImportedByLocked(id) {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return result
+}
+
+// waitIdle returns once the view has had no changes for prefetchIdle, or
+// when ctx is canceled.
+func (v *view) waitIdle(ctx context.Context) error {
+	for {
+		v.snapshotMu.Lock()
+		idle := time.Since(v.lastChange)
+		v.snapshotMu.Unlock()
+		if idle >= prefetchIdle {
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(prefetchIdle - idle):
+		}
+	}
+}
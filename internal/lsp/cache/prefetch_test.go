@@ -0,0 +1,46 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestPrefetchCandidates(t *testing.T) {
+	// a is imported by b, which is imported by c and d.
+	// e is not a workspace package, but it imports c.
+	s := &snapshot{
+		ids: map[span.URI][]packageID{
+			span.FileURI("/w/a/a.go"): {"a"},
+		},
+		metadata: map[packageID]*metadata{
+			"a": {id: "a"},
+			"b": {id: "b", deps: []packageID{"a"}},
+			"c": {id: "c", deps: []packageID{"b"}},
+			"d": {id: "d", deps: []packageID{"b"}},
+			"e": {id: "e", deps: []packageID{"c"}},
+			"f": {id: "f", deps: []packageID{"e"}},
+		},
+		importedBy: make(map[packageID][]packageID),
+		workspacePackages: map[packageID]bool{
+			"a": true, "b": true, "c": true, "d": true, "f": true,
+		},
+	}
+	seeds := []span.URI{span.FileURI("/w/a/a.go"), span.FileURI("/w/unknown.go")}
+
+	got := s.prefetchCandidates(seeds, 10)
+	if len(got) != 5 {
+		t.Fatalf("got %v, want 5 packages", got)
+	}
+	if !reflect.DeepEqual(got[:2], []packageID{"a", "b"}) || got[4] != "f" {
+		t.Errorf("got %v, want a and b first and f last", got)
+	}
+	if got := s.prefetchCandidates(seeds, 2); !reflect.DeepEqual(got, []packageID{"a", "b"}) {
+		t.Errorf("with limit 2, got %v, want [a b]", got)
+	}
+}
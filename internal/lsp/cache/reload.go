@@ -0,0 +1,85 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+	"golang.org/x/mod/modfile"
+)
+
+// readModFiles returns the contents of the go.mod and go.sum files of the
+// view of folder, or nil for the files that do not exist.
+func readModFiles(folder span.URI, modfiles *modfiles) ([]byte, []byte) {
+	gomod := filepath.Join(folder.Filename(), "go.mod")
+	if modfiles != nil {
+		gomod = modfiles.real
+	}
+	mod, _ := ioutil.ReadFile(gomod)
+	sum, _ := ioutil.ReadFile(strings.TrimSuffix(gomod, ".mod") + ".sum")
+	return mod, sum
+}
+
+func (v *view) Reload(ctx context.Context) (source.View, []string, error) {
+	newView, _, err := v.session.updateView(ctx, v, v.Options())
+	if err != nil {
+		return nil, nil, err
+	}
+	return newView, requirementChanges(v.goMod, newView.goMod), nil
+}
+
+// requirementChanges describes the modules that the go.mod file with the
+// contents after requires but the one with the contents before does not,
+// and conversely, and those whose required version differs, in the order
+// of their paths.
+func requirementChanges(before, after []byte) []string {
+	old, new := requirements(before), requirements(after)
+	var paths []string
+	for path := range old {
+		paths = append(paths, path)
+	}
+	for path := range new {
+		if _, ok := old[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	var changes []string
+	for _, path := range paths {
+		oldVersion, wasRequired := old[path]
+		newVersion, isRequired := new[path]
+		switch {
+		case !wasRequired:
+			changes = append(changes, fmt.Sprintf("added %s %s", path, newVersion))
+		case !isRequired:
+			changes = append(changes, fmt.Sprintf("removed %s %s", path, oldVersion))
+		case oldVersion != newVersion:
+			changes = append(changes, fmt.Sprintf("changed %s %s => %s", path, oldVersion, newVersion))
+		}
+	}
+	return changes
+}
+
+// requirements maps the paths of the modules required by the go.mod file
+// with the given contents to their versions. It is empty if the file does
+// not parse.
+func requirements(contents []byte) map[string]string {
+	versions := make(map[string]string)
+	f, err := modfile.Parse("go.mod", contents, nil)
+	if err != nil {
+		return versions
+	}
+	for _, req := range f.Require {
+		versions[req.Mod.Path] = req.Mod.Version
+	}
+	return versions
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRequirementChanges(t *testing.T) {
+	before := []byte(`module example.com/m
+
+require (
+	example.com/a v1.0.0
+	example.com/b v1.2.0
+	example.com/c v0.1.0
+)
+`)
+	after := []byte(`module example.com/m
+
+require (
+	example.com/a v1.0.0
+	example.com/b v1.3.0
+	example.com/d v0.0.0-20191105000000-abcdefabcdef
+)
+`)
+	want := []string{
+		"changed example.com/b v1.2.0 => v1.3.0",
+		"removed example.com/c v0.1.0",
+		"added example.com/d v0.0.0-20191105000000-abcdefabcdef",
+	}
+	if got := requirementChanges(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("requirementChanges() = %q, want %q", got, want)
+	}
+	if got := requirementChanges(nil, nil); got != nil {
+		t.Errorf("requirementChanges(nil, nil) = %q, want none", got)
+	}
+}
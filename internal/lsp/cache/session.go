@@ -6,6 +6,7 @@ package cache
 
 import (
 	"context"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +17,7 @@ import (
 	"github.com/jackie-feng/tools/internal/lsp/telemetry"
 	"github.com/jackie-feng/tools/internal/span"
 	"github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/tag"
 	"github.com/jackie-feng/tools/internal/telemetry/trace"
 	"github.com/jackie-feng/tools/internal/xcontext"
 	errors "golang.org/x/xerrors"
@@ -51,6 +53,7 @@ func (s *session) Shutdown(ctx context.Context) {
 	}
 	s.views = nil
 	s.viewMap = nil
+	s.cache.dropSession(s)
 	debug.DropSession(debugSession{s})
 }
 
@@ -82,6 +85,7 @@ func (s *session) createView(ctx context.Context, name string, folder span.URI,
 	if err != nil {
 		log.Error(ctx, "error getting modfiles", err, telemetry.Directory.Of(folder))
 	}
+	goMod, goSum := readModFiles(folder, modfiles)
 	v := &view{
 		session:       s,
 		id:            strconv.FormatInt(index, 10),
@@ -91,6 +95,8 @@ func (s *session) createView(ctx context.Context, name string, folder span.URI,
 		cancel:        cancel,
 		name:          name,
 		modfiles:      modfiles,
+		goMod:         goMod,
+		goSum:         goSum,
 		folder:        folder,
 		filesByURI:    make(map[span.URI]*fileBase),
 		filesByBase:   make(map[string][]*fileBase),
@@ -101,10 +107,14 @@ func (s *session) createView(ctx context.Context, name string, folder span.URI,
 			files:             make(map[span.URI]source.FileHandle),
 			importedBy:        make(map[packageID][]packageID),
 			actions:           make(map[actionKey]*actionHandle),
+			symbols:           make(map[span.URI]*symbolHandle),
+			fileResults:       make(map[fileResultKey]*fileResult),
 			workspacePackages: make(map[packageID]bool),
 		},
 		ignoredURIs: make(map[span.URI]struct{}),
 		builtin:     &builtinPkg{},
+		depsLoaded:  make(chan struct{}),
+		shutdownCh:  make(chan struct{}),
 	}
 	v.snapshot.view = v
 
@@ -116,26 +126,67 @@ func (s *session) createView(ctx context.Context, name string, folder span.URI,
 	// so we immediately add builtin.go to the list of ignored files.
 	v.buildBuiltinPackage(ctx)
 
-	// Preemptively load everything in this directory.
+	// Bound the memory held by type-checked packages.
+	go v.collectPackages(v.baseCtx)
+
+	// If another client has already loaded this folder, start from its
+	// metadata. Packages that the other client has edited are loaded again
+	// when they are needed, so that its unsaved changes are not shared.
+	if peer := s.cache.peerView(v); peer != nil {
+		v.snapshotMu.Lock()
+		defer v.snapshotMu.Unlock()
+		v.snapshot.shareMetadata(peer.currentSnapshot(), peer.session.overlayURIs())
+		close(v.depsLoaded)
+		go v.snapshot.buildSymbolIndex(v.baseCtx)
+		s.cache.addView(v)
+		debug.AddView(debugView{v})
+		return v, v.snapshot, nil
+	}
+
+	// Start type-checking the packages the user was recently working on
+	// while the rest of the workspace loads.
+	warm := v.warmStart(v.backgroundCtx)
+
+	// Preemptively load the packages in this directory. Their dependencies
+	// are loaded in the background, so that creating the view takes time
+	// proportional to the size of the workspace.
 	// TODO(matloob): Determine if this can be done in parallel with something else.
 	// Perhaps different calls to NewView can be run in parallel?
 	v.snapshotMu.Lock()
 	defer v.snapshotMu.Unlock() // The code after the snapshot is used isn't expensive.
-	m, err := v.snapshot.load(ctx, source.DirectoryURI(folder))
+	m, err := v.snapshot.loadWithConfig(ctx, v.workspaceConfig(ctx), source.DirectoryURI(folder))
 	if err != nil {
 		// Suppress all errors.
 		log.Error(ctx, "failed to load snapshot", err, telemetry.Directory.Of(folder))
+		close(v.depsLoaded)
 		return v, v.snapshot, nil
 	}
-	// Prepare CheckPackageHandles for every package that's been loaded.
-	// (*snapshot).CheckPackageHandle makes the assumption that every package that's
-	// been loaded has an existing checkPackageHandle.
-	if _, err := v.snapshot.checkWorkspacePackages(ctx, m); err != nil {
-		// Suppress all errors.
-		log.Error(ctx, "failed to check snapshot", err, telemetry.Directory.Of(folder))
-		return v, v.snapshot, nil
+	if reason, ok := v.exceedsLimits(len(m)); ok {
+		log.Print(ctx, "view is running in degraded mode", tag.Of("Reason", reason), telemetry.Directory.Of(folder))
+		v.degraded = true
 	}
+	// The warm start guessed which packages belong to the workspace. Now that
+	// the workspace is known, rebuild their handles; any type-checking that
+	// was already done is shared through the cache.
+	preloaded := <-warm
+	v.snapshot.mu.Lock()
+	v.snapshot.packages = make(map[packageKey]*packageHandle)
+	v.snapshot.workspacePackages = make(map[packageID]bool)
+	v.snapshot.mu.Unlock()
+	v.snapshot.addWorkspacePackages(m)
+
+	go func(s *snapshot) {
+		v.loadWorkspaceDependencies(v.baseCtx, s)
+		runtime.KeepAlive(preloaded)
+		if !v.degraded {
+			v.prefetch(v.baseCtx)
+		}
+	}(v.snapshot)
+	// Index the workspace symbols in the background. Later snapshots
+	// only recompute the symbols of the files that changed.
+	go v.snapshot.buildSymbolIndex(v.baseCtx)
 
+	s.cache.addView(v)
 	debug.AddView(debugView{v})
 	return v, v.snapshot, nil
 }
@@ -289,7 +340,12 @@ func (s *session) DidModifyFile(ctx context.Context, c source.FileModification)
 		if err != nil {
 			return nil, err
 		}
-		snapshots = append(snapshots, view.invalidateContent(ctx, c.URI, f.kind, c.Action))
+		if c.Action == source.Open {
+			view.rememberOpenFile(ctx, c.URI)
+		}
+		if snapshot := view.invalidateContent(ctx, c.URI, f.kind, c.Action); snapshot != nil {
+			snapshots = append(snapshots, snapshot)
+		}
 	}
 	return snapshots, nil
 }
@@ -302,6 +358,17 @@ func (s *session) IsOpen(uri span.URI) bool {
 	return open
 }
 
+func (s *session) OpenFiles() []source.FileHandle {
+	s.overlayMu.Lock()
+	defer s.overlayMu.Unlock()
+
+	var files []source.FileHandle
+	for _, o := range s.overlays {
+		files = append(files, o)
+	}
+	return files
+}
+
 func (s *session) GetFile(uri span.URI, kind source.FileKind) source.FileHandle {
 	if overlay := s.readOverlay(uri); overlay != nil {
 		return overlay
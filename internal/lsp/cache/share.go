@@ -0,0 +1,129 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+// Several clients, such as an editor and a code review tool, may connect
+// to the same gopls process. Each client has its own session, so that its
+// unsaved edits are never seen by the others, but the sessions share their
+// cache. When a client opens a folder that another client has already
+// loaded, its view starts from the other view's metadata instead of
+// loading the folder again, and type-checking results are shared through
+// the cache for as long as the files' contents are the same.
+
+// addView makes a loaded view available to the other sessions of the cache.
+func (c *cache) addView(v *view) {
+	c.viewsMu.Lock()
+	defer c.viewsMu.Unlock()
+	c.views = append(c.views, v)
+}
+
+// dropView removes a view that is shut down.
+func (c *cache) dropView(v *view) {
+	c.viewsMu.Lock()
+	defer c.viewsMu.Unlock()
+	for i, existing := range c.views {
+		if existing == v {
+			copy(c.views[i:], c.views[i+1:])
+			c.views[len(c.views)-1] = nil
+			c.views = c.views[:len(c.views)-1]
+			return
+		}
+	}
+}
+
+// peerView returns a view of another session of the cache whose metadata
+// v can share: it must have the same folder, build configuration and go.mod
+// and go.sum files, and have finished loading its workspace and dependencies.
+func (c *cache) peerView(v *view) *view {
+	c.viewsMu.Lock()
+	views := append([]*view(nil), c.views...)
+	c.viewsMu.Unlock()
+
+	options := v.Options()
+	for _, peer := range views {
+		if peer.session == v.session || peer.folder != v.folder || peer.degraded {
+			continue
+		}
+		peerOptions := peer.Options()
+		if !reflect.DeepEqual(peerOptions.Env, options.Env) || !reflect.DeepEqual(peerOptions.BuildFlags, options.BuildFlags) {
+			continue
+		}
+		// The peer may have been loaded before its go.mod or go.sum
+		// file changed, and not been reloaded yet.
+		if !bytes.Equal(peer.goMod, v.goMod) || !bytes.Equal(peer.goSum, v.goSum) {
+			continue
+		}
+		select {
+		case <-peer.depsLoaded:
+		default:
+			continue
+		}
+		return peer
+	}
+	return nil
+}
+
+// currentSnapshot returns the view's snapshot without applying its
+// pending changes.
+func (v *view) currentSnapshot() *snapshot {
+	v.snapshotMu.Lock()
+	defer v.snapshotMu.Unlock()
+	return v.snapshot
+}
+
+// overlayURIs returns the files that have unsaved changes in the session.
+func (s *session) overlayURIs() map[span.URI]bool {
+	s.overlayMu.Lock()
+	defer s.overlayMu.Unlock()
+
+	result := make(map[span.URI]bool)
+	for uri, o := range s.overlays {
+		if !o.sameContentOnDisk {
+			result[uri] = true
+		}
+	}
+	return result
+}
+
+// shareMetadata copies into s the metadata and workspace packages of a
+// snapshot of another session. The metadata of the packages with files in
+// exclude, which the other session has edited, is left out; those packages
+// are loaded again when they are needed.
+func (s *snapshot) shareMetadata(from *snapshot, exclude map[span.URI]bool) {
+	from.mu.Lock()
+	defer from.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	excluded := make(map[packageID]bool)
+	for uri := range exclude {
+		for _, id := range from.ids[uri] {
+			excluded[id] = true
+		}
+	}
+	for id, m := range from.metadata {
+		if excluded[id] {
+			continue
+		}
+		s.metadata[id] = m
+		for _, uris := range [][]span.URI{m.compiledGoFiles, m.goFiles} {
+			for _, uri := range uris {
+				s.addIDLocked(uri, id)
+			}
+		}
+	}
+	for id := range from.workspacePackages {
+		s.workspacePackages[id] = true
+	}
+	s.importedBy = make(map[packageID][]packageID)
+	s.rebuildImportGraph()
+}
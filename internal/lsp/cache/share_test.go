@@ -0,0 +1,44 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestShareMetadata(t *testing.T) {
+	newSnapshot := func() *snapshot {
+		return &snapshot{
+			ids:               make(map[span.URI][]packageID),
+			metadata:          make(map[packageID]*metadata),
+			importedBy:        make(map[packageID][]packageID),
+			workspacePackages: make(map[packageID]bool),
+		}
+	}
+	a, b := span.FileURI("/w/a/a.go"), span.FileURI("/w/b/b.go")
+	from := newSnapshot()
+	for _, m := range []*metadata{
+		{id: "a", compiledGoFiles: []span.URI{a}},
+		{id: "b", compiledGoFiles: []span.URI{b}, deps: []packageID{"a"}},
+	} {
+		from.metadata[m.id] = m
+		from.ids[m.compiledGoFiles[0]] = []packageID{m.id}
+		from.workspacePackages[m.id] = true
+	}
+
+	s := newSnapshot()
+	s.shareMetadata(from, map[span.URI]bool{b: true})
+	if s.metadata["a"] == nil || s.metadata["b"] != nil {
+		t.Errorf("got metadata for %v, want only a", s.metadata)
+	}
+	if len(s.ids[a]) != 1 || len(s.ids[b]) != 0 {
+		t.Errorf("got ids %v, want only the ids of a.go", s.ids)
+	}
+	if !s.workspacePackages["a"] || !s.workspacePackages["b"] {
+		t.Errorf("got workspace packages %v, want a and b", s.workspacePackages)
+	}
+}
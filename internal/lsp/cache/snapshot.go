@@ -7,6 +7,7 @@ package cache
 import (
 	"context"
 	"os"
+	"runtime"
 	"sync"
 
 	"github.com/jackie-feng/tools/go/analysis"
@@ -46,6 +47,15 @@ type snapshot struct {
 	// actions maps an actionkey to its actionHandle.
 	actions map[actionKey]*actionHandle
 
+	// symbols maps file URIs to the handles for their top-level symbols.
+	// It may be invalidated when a file's content changes.
+	symbols map[span.URI]*symbolHandle
+
+	// fileResults caches the results of per-file requests, such as document
+	// symbols and folding ranges.
+	// It may be invalidated when a file's content or packages change.
+	fileResults map[fileResultKey]*fileResult
+
 	// workspacePackages contains the workspace's packages, which are loaded
 	// when the view is created.
 	workspacePackages map[packageID]bool
@@ -250,18 +260,113 @@ func (s *snapshot) addPackage(ph *packageHandle) {
 // (*snapshot).CheckPackageHandle makes the assumption that every package that's
 // been loaded has an existing checkPackageHandle.
 func (s *snapshot) checkWorkspacePackages(ctx context.Context, m []*metadata) ([]source.PackageHandle, error) {
+	// Mark the workspace packages up front, so that the packages that
+	// import them build them in ParseFull mode too.
+	s.addWorkspacePackages(m)
+
+	// Collect the transitive dependencies of the workspace packages.
+	deps := make(map[packageID][]packageID)
+	var collect func(id packageID)
+	collect = func(id packageID) {
+		if _, ok := deps[id]; ok {
+			return
+		}
+		deps[id] = nil
+		if m := s.getMetadata(id); m != nil {
+			deps[id] = m.deps
+			for _, depID := range m.deps {
+				collect(depID)
+			}
+		}
+	}
+	for _, m := range m {
+		collect(m.id)
+	}
+
+	// Build the CheckPackageHandles in parallel, starting each package
+	// once all of its dependencies are done, so that shared dependencies
+	// are only built once.
+	remaining := make(map[packageID]int)
+	importedBy := make(map[packageID][]packageID)
+	for id, depIDs := range deps {
+		for _, depID := range depIDs {
+			remaining[id]++
+			importedBy[depID] = append(importedBy[depID], id)
+		}
+	}
+	type result struct {
+		id  packageID
+		err error
+	}
+	ready := make(chan packageID, len(deps))
+	results := make(chan result)
+	var inFlight int
+	for id := range deps {
+		if remaining[id] == 0 {
+			ready <- id
+			inFlight++
+		}
+	}
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		go func() {
+			for id := range ready {
+				mode := source.ParseExported
+				if s.isWorkspacePackage(id) {
+					mode = source.ParseFull
+				}
+				_, err := s.packageHandle(ctx, id, mode)
+				results <- result{id, err}
+			}
+		}()
+	}
+	var firstErr error
+	for inFlight > 0 {
+		r := <-results
+		inFlight--
+		// Errors in dependencies are reported when their importers are built.
+		if r.err != nil && s.isWorkspacePackage(r.id) && firstErr == nil {
+			firstErr = r.err
+		}
+		for _, id := range importedBy[r.id] {
+			remaining[id]--
+			if remaining[id] == 0 {
+				ready <- id
+				inFlight++
+			}
+		}
+	}
+	close(ready)
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
 	var phs []source.PackageHandle
 	for _, m := range m {
 		ph, err := s.packageHandle(ctx, m.id, source.ParseFull)
 		if err != nil {
 			return nil, err
 		}
-		s.workspacePackages[m.id] = true
 		phs = append(phs, ph)
 	}
 	return phs, nil
 }
 
+func (s *snapshot) addWorkspacePackages(m []*metadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range m {
+		s.workspacePackages[m.id] = true
+	}
+}
+
+func (s *snapshot) isWorkspacePackage(id packageID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspacePackages[id]
+}
+
 func (s *snapshot) WorkspacePackageIDs(ctx context.Context) (ids []string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -272,6 +377,14 @@ func (s *snapshot) WorkspacePackageIDs(ctx context.Context) (ids []string) {
 	return ids
 }
 
+func (s *snapshot) CompiledGoFiles(ctx context.Context, id string) []span.URI {
+	m := s.getMetadata(packageID(id))
+	if m == nil {
+		return nil
+	}
+	return m.compiledGoFiles
+}
+
 func (s *snapshot) KnownPackages(ctx context.Context) []source.Package {
 	// TODO(matloob): This function exists because KnownImportPaths can't
 	// determine the import paths of all packages. Remove this function
@@ -401,7 +514,8 @@ func (s *snapshot) setMetadata(m *metadata) {
 	// TODO: We should make sure not to set duplicate metadata,
 	// and instead panic here. This can be done by making sure not to
 	// reset metadata information for packages we've already seen.
-	if _, ok := s.metadata[m.id]; ok {
+	// Metadata loaded without dependencies is replaced once they are loaded.
+	if existing, ok := s.metadata[m.id]; ok && (!existing.lazyDeps || m.lazyDeps) {
 		return
 	}
 	s.metadata[m.id] = m
@@ -418,6 +532,10 @@ func (s *snapshot) addID(uri span.URI, id packageID) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.addIDLocked(uri, id)
+}
+
+func (s *snapshot) addIDLocked(uri span.URI, id packageID) {
 	for _, existingID := range s.ids[uri] {
 		if existingID == id {
 			// TODO: We should make sure not to set duplicate IDs,
@@ -557,6 +675,8 @@ func (s *snapshot) clone(ctx context.Context, withoutURI span.URI, withoutFileKi
 		metadata:          make(map[packageID]*metadata),
 		packages:          make(map[packageKey]*packageHandle),
 		actions:           make(map[actionKey]*actionHandle),
+		symbols:           make(map[span.URI]*symbolHandle),
+		fileResults:       make(map[fileResultKey]*fileResult),
 		files:             make(map[span.URI]source.FileHandle),
 		workspacePackages: make(map[packageID]bool),
 	}
@@ -577,6 +697,25 @@ func (s *snapshot) clone(ctx context.Context, withoutURI span.URI, withoutFileKi
 	for k, ids := range s.ids {
 		result.ids[k] = ids
 	}
+	// The packages that import the file's packages are always type-checked
+	// and analyzed again, even if only comments changed, so that every
+	// package of the snapshot refers to the same types.Objects, at the same
+	// positions: references, rename and implementation compare objects
+	// across packages, and analysis facts are keyed by objects. Their files
+	// are not parsed again, as the parsed ASTs are cached by file.
+	//
+	// A change that does not affect the API of the file's packages, such as
+	// an edit of a function body, does not affect the importers' per-file
+	// results. A change to comments or whitespace affects no per-file
+	// result of another file, and does not require loading the metadata
+	// of the file's packages again.
+	commentsOnly := s.view.session.cache.onlyCommentsChanged(ctx, originalFH, currentFH)
+	invalidatedResultIDs := transitiveIDs
+	if commentsOnly {
+		invalidatedResultIDs = nil
+	} else if !s.view.session.cache.shouldInvalidateImporters(ctx, originalFH, currentFH) {
+		invalidatedResultIDs = directIDs
+	}
 	// Copy the package type information.
 	for k, v := range s.packages {
 		if _, ok := transitiveIDs[k.id]; ok {
@@ -591,6 +730,24 @@ func (s *snapshot) clone(ctx context.Context, withoutURI span.URI, withoutFileKi
 		}
 		result.actions[k] = v
 	}
+	// Copy the symbols of every file other than the invalidated one.
+	for k, v := range s.symbols {
+		if k == withoutURI {
+			continue
+		}
+		result.symbols[k] = v
+	}
+	// Copy the per-file results of the other files. Results that depend on
+	// type information are dropped if the change may affect them.
+	for k, v := range s.fileResults {
+		if k.uri == withoutURI {
+			continue
+		}
+		if k.kind.DependsOnTypes() && containsAny(s.ids[k.uri], invalidatedResultIDs) {
+			continue
+		}
+		result.fileResults[k] = v
+	}
 	// Copy the set of initally loaded packages.
 	for k, v := range s.workspacePackages {
 		result.workspacePackages[k] = v
@@ -598,7 +755,7 @@ func (s *snapshot) clone(ctx context.Context, withoutURI span.URI, withoutFileKi
 
 	// Check if the file's package name or imports have changed,
 	// and if so, invalidate this file's packages' metadata.
-	invalidateMetadata := s.view.session.cache.shouldLoad(ctx, s, originalFH, currentFH)
+	invalidateMetadata := !commentsOnly && s.view.session.cache.shouldLoad(ctx, s, originalFH, currentFH)
 
 	// Copy the package metadata. We only need to invalidate packages directly
 	// containing the affected file, and only if it changed in a relevant way.
@@ -613,10 +770,52 @@ func (s *snapshot) clone(ctx context.Context, withoutURI span.URI, withoutFileKi
 	return result
 }
 
+// containsAny reports whether any of ids is in set.
+func containsAny(ids []packageID, set map[packageID]struct{}) bool {
+	for _, id := range ids {
+		if _, ok := set[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *snapshot) ID() uint64 {
 	return s.id
 }
 
+// adoptMetadata copies into s the metadata that was loaded into an earlier
+// snapshot, for the packages whose metadata s has not invalidated since.
+func (s *snapshot) adoptMetadata(from *snapshot) {
+	from.mu.Lock()
+	defer from.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, m := range from.metadata {
+		if m.lazyDeps {
+			continue
+		}
+		existing, ok := s.metadata[id]
+		if ok && !existing.lazyDeps {
+			continue
+		}
+		// A workspace package without metadata has been invalidated,
+		// and will be loaded again when it is needed.
+		if !ok && s.workspacePackages[id] {
+			continue
+		}
+		s.metadata[id] = m
+		for _, uris := range [][]span.URI{m.compiledGoFiles, m.goFiles} {
+			for _, uri := range uris {
+				s.addIDLocked(uri, id)
+			}
+		}
+	}
+	s.importedBy = make(map[packageID][]packageID)
+	s.rebuildImportGraph()
+}
+
 func (s *snapshot) clearAndRebuildImportGraph() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,265 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/testenv"
+)
+
+func TestCloneReuse(t *testing.T) {
+	const original = `package a
+
+// F does something.
+func F(x int) int {
+	return x
+}
+`
+	// Package a has the files a1.go and a2.go, and is imported by b.
+	// Package c is unrelated.
+	a1, a2 := span.FileURI("/w/a/a1.go"), span.FileURI("/w/a/a2.go")
+	b, c := span.FileURI("/w/b/b.go"), span.FileURI("/w/c/c.go")
+	analyzer := &analysis.Analyzer{Name: "test"}
+
+	tests := []struct {
+		name        string
+		current     string
+		wantIDs     []packageID // of the kept packages and actions
+		wantMeta    []packageID
+		wantResults []span.URI
+	}{
+		{
+			name: "comments",
+			current: `package a
+
+// F does something else.
+func F(x int) int {
+
+	return x // x
+}
+`,
+			wantIDs:     []packageID{"c"},
+			wantMeta:    []packageID{"a", "b", "c"},
+			wantResults: []span.URI{a2, b, c},
+		},
+		{
+			name: "function body",
+			current: `package a
+
+// F does something.
+func F(x int) int {
+	return x + 1
+}
+`,
+			wantIDs:     []packageID{"c"},
+			wantMeta:    []packageID{"a", "b", "c"},
+			wantResults: []span.URI{b, c},
+		},
+		{
+			name: "API",
+			current: `package a
+
+// F does something.
+func F(x, y int) int {
+	return x
+}
+`,
+			wantIDs:     []packageID{"c"},
+			wantMeta:    []packageID{"a", "b", "c"},
+			wantResults: []span.URI{c},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := &session{
+				cache:    New(nil).(*cache),
+				overlays: make(map[span.URI]*overlay),
+			}
+			s := &snapshot{
+				view:              &view{session: sess},
+				ids:               make(map[span.URI][]packageID),
+				importedBy:        make(map[packageID][]packageID),
+				metadata:          make(map[packageID]*metadata),
+				packages:          make(map[packageKey]*packageHandle),
+				actions:           make(map[actionKey]*actionHandle),
+				symbols:           make(map[span.URI]*symbolHandle),
+				fileResults:       make(map[fileResultKey]*fileResult),
+				files:             map[span.URI]source.FileHandle{a1: memFileHandle{a1, original}},
+				workspacePackages: make(map[packageID]bool),
+			}
+			for _, m := range []*metadata{
+				{id: "a", compiledGoFiles: []span.URI{a1, a2}},
+				{id: "b", compiledGoFiles: []span.URI{b}, deps: []packageID{"a"}},
+				{id: "c", compiledGoFiles: []span.URI{c}},
+			} {
+				s.metadata[m.id] = m
+				for _, uri := range m.compiledGoFiles {
+					s.ids[uri] = []packageID{m.id}
+					s.fileResults[fileResultKey{uri, source.DocumentSymbolsResult}] = &fileResult{}
+				}
+				key := packageKey{mode: source.ParseFull, id: m.id}
+				s.packages[key] = &packageHandle{}
+				s.actions[actionKey{pkg: key, analyzer: analyzer}] = &actionHandle{}
+			}
+			sess.overlays[a1] = &overlay{
+				session: sess,
+				uri:     a1,
+				text:    []byte(tt.current),
+				hash:    hashContents([]byte(tt.current)),
+				kind:    source.Go,
+			}
+
+			result := s.clone(context.Background(), a1, source.Go)
+
+			var ids, actionIDs, meta []packageID
+			for k := range result.packages {
+				ids = append(ids, k.id)
+			}
+			for k := range result.actions {
+				actionIDs = append(actionIDs, k.pkg.id)
+			}
+			for id := range result.metadata {
+				meta = append(meta, id)
+			}
+			var results []span.URI
+			for k := range result.fileResults {
+				results = append(results, k.uri)
+			}
+			sortIDs(ids)
+			sortIDs(actionIDs)
+			sortIDs(meta)
+			sort.Slice(results, func(i, j int) bool { return results[i] < results[j] })
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("kept packages %v, want %v", ids, tt.wantIDs)
+			}
+			if !reflect.DeepEqual(actionIDs, tt.wantIDs) {
+				t.Errorf("kept the actions of %v, want %v", actionIDs, tt.wantIDs)
+			}
+			if !reflect.DeepEqual(meta, tt.wantMeta) {
+				t.Errorf("kept metadata %v, want %v", meta, tt.wantMeta)
+			}
+			if !reflect.DeepEqual(results, tt.wantResults) {
+				t.Errorf("kept the results of %v, want %v", results, tt.wantResults)
+			}
+		})
+	}
+}
+
+func sortIDs(ids []packageID) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
+
+func TestCheckWorkspacePackagesDiamond(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, err := ioutil.TempDir("", "gopls-diamond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Package a imports b and c, which both import d.
+	for name, content := range map[string]string{
+		"go.mod": "module fake\n",
+		"a/a.go": "package a\n\nimport (\n\t\"fake/b\"\n\t\"fake/c\"\n)\n\nvar A = b.B + c.C\n",
+		"b/b.go": "package b\n\nimport \"fake/d\"\n\nvar B = d.D\n",
+		"c/c.go": "package c\n\nimport \"fake/d\"\n\nvar C = d.D\n",
+		"d/d.go": "package d\n\nvar D = 1\n",
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// With a single type-checking slot, a package must not hold it while
+	// its dependencies wait for it.
+	defer func(limit chan struct{}) { checkLimit = limit }(checkLimit)
+	checkLimit = make(chan struct{}, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	options := source.DefaultOptions
+	options.Env = append(os.Environ(), "GOPROXY=off")
+	options.WarmStart = false
+	options.Prefetch = false
+	sess := New(nil).NewSession(ctx)
+	defer sess.Shutdown(ctx)
+	sv, _, err := sess.NewView(ctx, "diamond", span.FileURI(dir), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := sv.(*view)
+	<-v.depsLoaded
+
+	s := v.currentSnapshot()
+	var m []*metadata
+	for _, id := range []packageID{"fake/a", "fake/b", "fake/c", "fake/d"} {
+		md := s.getMetadata(id)
+		if md == nil {
+			t.Fatalf("no metadata for %s", id)
+		}
+		m = append(m, md)
+	}
+	type result struct {
+		pkgs []source.Package
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		phs, err := s.checkWorkspacePackages(ctx, m)
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+		var pkgs []source.Package
+		for _, ph := range phs {
+			pkg, err := ph.Check(ctx)
+			if err != nil {
+				done <- result{nil, err}
+				return
+			}
+			pkgs = append(pkgs, pkg)
+		}
+		done <- result{pkgs, nil}
+	}()
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		t.Fatal("type-checking the diamond did not finish")
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	byPath := make(map[string]source.Package)
+	for _, pkg := range r.pkgs {
+		if errs := pkg.GetErrors(); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors %v", pkg.PkgPath(), errs)
+		}
+		byPath[pkg.PkgPath()] = pkg
+	}
+	// Both sides of the diamond refer to the same package d.
+	b, c := byPath["fake/b"], byPath["fake/c"]
+	if b == nil || c == nil {
+		t.Fatalf("missing packages b or c in %v", byPath)
+	}
+	if db, dc := b.GetTypes().Imports()[0], c.GetTypes().Imports()[0]; db != dc {
+		t.Errorf("b and c import different packages d: %p and %p", db, dc)
+	}
+}
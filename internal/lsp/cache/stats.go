@@ -0,0 +1,54 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"github.com/jackie-feng/tools/internal/lsp/source"
+)
+
+func (s *session) Stats() *source.SessionStats {
+	stats := &source.SessionStats{
+		CacheEntries: make(map[string]int),
+	}
+	for t, n := range s.cache.store.Stats() {
+		stats.CacheEntries[t.String()] += n
+	}
+
+	s.overlayMu.Lock()
+	for _, o := range s.overlays {
+		stats.OverlayFiles++
+		stats.OverlayBytes += len(o.text)
+	}
+	s.overlayMu.Unlock()
+
+	s.viewMu.Lock()
+	views := append([]*view(nil), s.views...)
+	s.viewMu.Unlock()
+	for _, v := range views {
+		stats.Views = append(stats.Views, v.stats())
+	}
+	return stats
+}
+
+// stats describes the view's current snapshot, without applying any
+// pending changes to it.
+func (v *view) stats() source.ViewStats {
+	v.snapshotMu.Lock()
+	s := v.snapshot
+	v.snapshotMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return source.ViewStats{
+		Name:              v.name,
+		Folder:            v.folder.Filename(),
+		Files:             len(s.files),
+		Metadata:          len(s.metadata),
+		WorkspacePackages: len(s.workspacePackages),
+		Packages:          len(s.packages),
+		Actions:           len(s.actions),
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/memoize"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+)
+
+// symbolKey uniquely identifies the symbols declared in a Go file.
+type symbolKey struct {
+	file source.FileIdentity
+}
+
+// symbolHandle computes the top-level symbols declared in a single file.
+// Since it only depends on the file's contents, the snapshot can keep it
+// across changes to other files.
+type symbolHandle struct {
+	handle *memoize.Handle
+	file   source.FileHandle
+}
+
+type symbolData struct {
+	memoize.NoCopy
+
+	symbols []source.Symbol
+	err     error
+}
+
+func (c *cache) symbolHandle(fh source.FileHandle) *symbolHandle {
+	key := symbolKey{
+		file: fh.Identity(),
+	}
+	// Share the parsed file with the type checker, which parses
+	// workspace files in full.
+	pgh := c.ParseGoHandle(fh, source.ParseFull)
+	fset := c.fset
+	h := c.store.Bind(key, func(ctx context.Context) interface{} {
+		data := &symbolData{}
+		data.symbols, data.err = fileSymbols(ctx, fset, pgh)
+		return data
+	})
+	return &symbolHandle{
+		handle: h,
+		file:   fh,
+	}
+}
+
+func (sh *symbolHandle) symbols(ctx context.Context) ([]source.Symbol, error) {
+	v := sh.handle.Get(ctx)
+	if v == nil {
+		return nil, ctx.Err()
+	}
+	data := v.(*symbolData)
+	return data.symbols, data.err
+}
+
+// Symbols returns the top-level symbols declared in the files of the
+// workspace packages, keyed by file. Files that have not changed since
+// the previous snapshot reuse their symbols.
+func (s *snapshot) Symbols(ctx context.Context) (map[span.URI][]source.Symbol, error) {
+	ctx, done := trace.StartSpan(ctx, "cache.snapshot.Symbols")
+	defer done()
+
+	result := make(map[span.URI][]source.Symbol)
+	for _, uri := range s.workspaceFiles() {
+		sh := s.getSymbolHandle(uri)
+		if sh == nil {
+			fh, err := s.GetFile(ctx, uri)
+			if err != nil {
+				return nil, err
+			}
+			sh = s.addSymbolHandle(uri, s.view.session.cache.symbolHandle(fh))
+		}
+		symbols, err := sh.symbols(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Error(ctx, "no symbols", err, telemetry.File.Of(uri))
+			continue
+		}
+		result[uri] = symbols
+	}
+	return result, nil
+}
+
+// buildSymbolIndex computes the symbols of every workspace file, so that
+// the first workspace/symbol query does not have to.
+func (s *snapshot) buildSymbolIndex(ctx context.Context) {
+	if _, err := s.Symbols(ctx); err != nil {
+		log.Error(ctx, "failed to build symbol index", err)
+	}
+}
+
+// workspaceFiles returns the Go files in the view's folder that belong to
+// a workspace package.
+func (s *snapshot) workspaceFiles() []span.URI {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	folder := s.view.folder.Filename()
+	var uris []span.URI
+	for uri, ids := range s.ids {
+		// Skip files generated outside of the workspace, such as cgo output.
+		if !inFolder(uri.Filename(), folder) {
+			continue
+		}
+		for _, id := range ids {
+			if s.workspacePackages[id] {
+				uris = append(uris, uri)
+				break
+			}
+		}
+	}
+	return uris
+}
+
+// inFolder reports whether filename is in the directory folder or one of
+// its subdirectories.
+func inFolder(filename, folder string) bool {
+	return strings.HasPrefix(filename, folder+string(filepath.Separator))
+}
+
+func (s *snapshot) getSymbolHandle(uri span.URI) *symbolHandle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.symbols[uri]
+}
+
+func (s *snapshot) addSymbolHandle(uri span.URI, sh *symbolHandle) *symbolHandle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// If another request already added a handle for this file, use it.
+	if existing, ok := s.symbols[uri]; ok {
+		return existing
+	}
+	s.symbols[uri] = sh
+	return sh
+}
+
+// fileSymbols returns the top-level declarations of a file.
+// Methods are named after their receiver type, as in "T.Method".
+func fileSymbols(ctx context.Context, fset *token.FileSet, pgh source.ParseGoHandle) ([]source.Symbol, error) {
+	file, m, _, err := pgh.Parse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []source.Symbol
+	add := func(ident *ast.Ident, name string, kind protocol.SymbolKind) {
+		if ident == nil || ident.Name == "_" {
+			return
+		}
+		spn, err := span.NewRange(fset, ident.Pos(), ident.End()).Span()
+		if err != nil {
+			return
+		}
+		rng, err := m.Range(spn)
+		if err != nil {
+			return
+		}
+		symbols = append(symbols, source.Symbol{
+			Name:  name,
+			Kind:  kind,
+			Range: rng,
+		})
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				add(decl.Name, decl.Name.Name, protocol.Function)
+				continue
+			}
+			name := decl.Name.Name
+			if recv := receiverName(decl.Recv.List[0].Type); recv != "" {
+				name = recv + "." + name
+			}
+			add(decl.Name, name, protocol.Method)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					switch spec.Type.(type) {
+					case *ast.InterfaceType:
+						add(spec.Name, spec.Name.Name, protocol.Interface)
+					case *ast.StructType:
+						add(spec.Name, spec.Name.Name, protocol.Struct)
+					default:
+						add(spec.Name, spec.Name.Name, protocol.Class)
+					}
+				case *ast.ValueSpec:
+					kind := protocol.Variable
+					if decl.Tok == token.CONST {
+						kind = protocol.Constant
+					}
+					for _, name := range spec.Names {
+						add(name, name.Name, kind)
+					}
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// receiverName returns the name of the type of a method receiver.
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.ParenExpr:
+		return receiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestSymbolHandle(t *testing.T) {
+	const src = `package a
+
+const C = 1
+
+var v, _ = 2, 3
+
+type I interface{}
+
+type S struct{}
+
+type N int
+
+func F() {}
+
+func (s *S) M() {}
+`
+	c := New(nil).(*cache)
+	fh := memFileHandle{span.FileURI("/a/a.go"), src}
+	symbols, err := c.symbolHandle(fh).symbols(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name string
+		kind protocol.SymbolKind
+		line float64
+	}{
+		{"C", protocol.Constant, 2},
+		{"v", protocol.Variable, 4},
+		{"I", protocol.Interface, 6},
+		{"S", protocol.Struct, 8},
+		{"N", protocol.Class, 10},
+		{"F", protocol.Function, 12},
+		{"S.M", protocol.Method, 14},
+	}
+	if len(symbols) != len(want) {
+		t.Fatalf("got %d symbols, want %d: %v", len(symbols), len(want), symbols)
+	}
+	for i, w := range want {
+		got := symbols[i]
+		if got.Name != w.name || got.Kind != w.kind || got.Range.Start.Line != w.line {
+			t.Errorf("symbol %d: got %s (kind %v, line %v), want %s (kind %v, line %v)", i, got.Name, got.Kind, got.Range.Start.Line, w.name, w.kind, w.line)
+		}
+	}
+}
+
+func TestWorkspaceFiles(t *testing.T) {
+	// The folder /a/bc shares a prefix with the folder /a/b of the view,
+	// but its files are not in the view.
+	s := &snapshot{
+		view: &view{folder: span.FileURI("/a/b")},
+		ids: map[span.URI][]packageID{
+			span.FileURI("/a/b/b.go"):     {"b"},
+			span.FileURI("/a/b/c/c.go"):   {"c"},
+			span.FileURI("/a/bc/bc.go"):   {"bc"},
+			span.FileURI("/a/b/dep.go"):   {"dep"},
+			span.FileURI("/cache/cgo.go"): {"b"},
+		},
+		workspacePackages: map[packageID]bool{"b": true, "c": true, "bc": true},
+	}
+	got := make(map[span.URI]bool)
+	for _, uri := range s.workspaceFiles() {
+		got[uri] = true
+	}
+	want := map[span.URI]bool{
+		span.FileURI("/a/b/b.go"):   true,
+		span.FileURI("/a/b/c/c.go"): true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got workspace files %v, want %v", got, want)
+	}
+}
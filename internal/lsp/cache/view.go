@@ -14,6 +14,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -23,9 +24,11 @@ import (
 	"github.com/jackie-feng/tools/internal/lsp/debug"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
 	"github.com/jackie-feng/tools/internal/span"
 	"github.com/jackie-feng/tools/internal/telemetry/log"
 	"github.com/jackie-feng/tools/internal/telemetry/tag"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
 	"github.com/jackie-feng/tools/internal/xcontext"
 	errors "golang.org/x/xerrors"
 )
@@ -34,7 +37,10 @@ type view struct {
 	session *session
 	id      string
 
-	options source.Options
+	// optionsMu guards options, which may be replaced while the view
+	// is loading in the background.
+	optionsMu sync.Mutex
+	options   source.Options
 
 	// mu protects all mutable state of the view.
 	mu sync.Mutex
@@ -57,6 +63,10 @@ type view struct {
 	// modfiles are the go.mod files attributed to this view.
 	modfiles *modfiles
 
+	// goMod and goSum are the contents of the go.mod and go.sum files of
+	// the view when it was created, or nil.
+	goMod, goSum []byte
+
 	// Folder is the root of this view.
 	folder span.URI
 
@@ -74,6 +84,12 @@ type view struct {
 	// TODO(suzmue): These versions may not actually be on disk.
 	modFileVersions map[string]string
 
+	// recentFiles are the files most recently opened in this view,
+	// most recent first. They are persisted for the next warm start.
+	recentMu    sync.Mutex
+	recentFiles []span.URI
+	recentDirty bool // recentFiles has changed since it was saved
+
 	// keep track of files by uri and by basename, a single file may be mapped
 	// to multiple uris, and the same basename may map to multiple files
 	filesByURI  map[span.URI]*fileBase
@@ -82,12 +98,32 @@ type view struct {
 	snapshotMu sync.Mutex
 	snapshot   *snapshot
 
+	// pendingChanges are the open files whose changes have not yet been
+	// applied to snapshot. They are applied when the snapshot is next
+	// requested, so that a burst of edits causes a single invalidation.
+	pendingChanges map[span.URI]source.FileKind
+
+	// lastChange is the time of the last change to the view's files.
+	// It is guarded by snapshotMu.
+	lastChange time.Time
+
+	// depsLoaded is closed once the dependencies of the workspace packages,
+	// which the view does not wait for when it is created, have been loaded.
+	depsLoaded chan struct{}
+
 	// builtin is used to resolve builtin types.
 	builtin *builtinPkg
 
 	// ignoredURIs is the set of URIs of files that we ignore.
 	ignoredURIsMu sync.Mutex
 	ignoredURIs   map[span.URI]struct{}
+
+	// degraded is set when the view is created if the workspace exceeds the
+	// package or memory limits in the view's options.
+	degraded bool
+	// shutdownCh is closed when the view is shut down, to stop the
+	// background tasks that last for the lifetime of the view.
+	shutdownCh chan struct{}
 }
 
 // modfiles holds the real and temporary go.mod files that are attributed to a view.
@@ -110,9 +146,33 @@ func (v *view) Folder() span.URI {
 }
 
 func (v *view) Options() source.Options {
+	v.optionsMu.Lock()
+	defer v.optionsMu.Unlock()
+
 	return v.options
 }
 
+func (v *view) Degraded() bool {
+	return v.degraded
+}
+
+// exceedsLimits reports whether a workspace of the given number of packages
+// should be handled in degraded mode, and if so, why.
+func (v *view) exceedsLimits(npkgs int) (string, bool) {
+	options := v.Options()
+	if max := options.MaxWorkspacePackages; max > 0 && npkgs > max {
+		return fmt.Sprintf("workspace has %d packages, more than the limit of %d", npkgs, max), true
+	}
+	if max := options.MaxMemoryBytes; max > 0 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		if m.HeapAlloc > max {
+			return fmt.Sprintf("heap size is %d bytes, more than the limit of %d", m.HeapAlloc, max), true
+		}
+	}
+	return "", false
+}
+
 func minorOptionsChange(a, b source.Options) bool {
 	// Check if any of the settings that modify our understanding of files have been changed
 	if !reflect.DeepEqual(a.Env, b.Env) {
@@ -127,10 +187,13 @@ func minorOptionsChange(a, b source.Options) bool {
 
 func (v *view) SetOptions(ctx context.Context, options source.Options) (source.View, error) {
 	// no need to rebuild the view if the options were not materially changed
+	v.optionsMu.Lock()
 	if minorOptionsChange(v.options, options) {
 		v.options = options
+		v.optionsMu.Unlock()
 		return v, nil
 	}
+	v.optionsMu.Unlock()
 	newView, _, err := v.session.updateView(ctx, v, options)
 	return newView, err
 }
@@ -142,28 +205,33 @@ func (v *view) Config(ctx context.Context) *packages.Config {
 
 	// We want to run the go commands with the -modfile flag if the version of go
 	// that we are using supports it.
-	buildFlags := v.options.BuildFlags
+	options := v.Options()
+	buildFlags := options.BuildFlags
 	if v.modfiles != nil {
 		buildFlags = append(buildFlags, fmt.Sprintf("-modfile=%s", v.modfiles.temp))
 	}
+	mode := packages.NeedName |
+		packages.NeedFiles |
+		packages.NeedCompiledGoFiles |
+		packages.NeedImports |
+		packages.NeedDeps |
+		packages.NeedTypesSizes
+	if options.ExperimentalExportData {
+		mode |= packages.NeedExportsFile
+	}
 	return &packages.Config{
 		Dir:        v.folder.Filename(),
 		Context:    ctx,
-		Env:        v.options.Env,
+		Env:        options.Env,
 		BuildFlags: buildFlags,
-		Mode: packages.NeedName |
-			packages.NeedFiles |
-			packages.NeedCompiledGoFiles |
-			packages.NeedImports |
-			packages.NeedDeps |
-			packages.NeedTypesSizes,
-		Fset:    v.session.cache.fset,
-		Overlay: v.session.buildOverlay(),
+		Mode:       mode,
+		Fset:       v.session.cache.fset,
+		Overlay:    v.session.buildOverlay(),
 		ParseFile: func(*token.FileSet, string, []byte) (*ast.File, error) {
 			panic("go/packages must not be used to parse files")
 		},
 		Logf: func(format string, args ...interface{}) {
-			if v.options.VerboseOutput {
+			if options.VerboseOutput {
 				log.Print(ctx, fmt.Sprintf(format, args...))
 			}
 		},
@@ -171,6 +239,49 @@ func (v *view) Config(ctx context.Context) *packages.Config {
 	}
 }
 
+// workspaceConfig returns the configuration used to load the workspace
+// packages when the view is created. It does not request their imports,
+// so that go list does not report the transitive dependencies.
+func (v *view) workspaceConfig(ctx context.Context) *packages.Config {
+	cfg := v.Config(ctx)
+	cfg.Mode &^= packages.NeedImports | packages.NeedDeps | packages.NeedExportsFile
+	return cfg
+}
+
+// loadWorkspaceDependencies loads the dependencies of the workspace packages
+// into s, and into the view's current snapshot if it has moved on from s.
+func (v *view) loadWorkspaceDependencies(ctx context.Context, s *snapshot) {
+	defer close(v.depsLoaded)
+
+	ctx, done := trace.StartSpan(ctx, "cache.view.loadWorkspaceDependencies")
+	defer done()
+
+	m, err := s.load(ctx, source.DirectoryURI(v.folder))
+	if err != nil {
+		log.Error(ctx, "failed to load dependencies", err, telemetry.Directory.Of(v.folder))
+		return
+	}
+	v.snapshotMu.Lock()
+	current := v.snapshot
+	if current != s {
+		current.adoptMetadata(s)
+	}
+	v.snapshotMu.Unlock()
+
+	// A degraded view only builds the handles of the packages that are
+	// needed, such as those of the open files.
+	if v.degraded {
+		current.addWorkspacePackages(m)
+		return
+	}
+	// Prepare CheckPackageHandles for every package that's been loaded.
+	// (*snapshot).CheckPackageHandle makes the assumption that every package that's
+	// been loaded has an existing checkPackageHandle.
+	if _, err := current.checkWorkspacePackages(ctx, m); err != nil {
+		log.Error(ctx, "failed to check snapshot", err, telemetry.Directory.Of(v.folder))
+	}
+}
+
 func (v *view) RunProcessEnvFunc(ctx context.Context, fn func(*imports.Options) error, opts *imports.Options) error {
 	v.mu.Lock()
 	defer v.mu.Unlock()
@@ -216,14 +327,15 @@ func (v *view) RunProcessEnvFunc(ctx context.Context, fn func(*imports.Options)
 }
 
 func (v *view) buildProcessEnv(ctx context.Context) (*imports.ProcessEnv, error) {
+	options := v.Options()
 	cfg := v.Config(ctx)
 	env := &imports.ProcessEnv{
 		WorkingDir: cfg.Dir,
 		Logf: func(format string, args ...interface{}) {
 			log.Print(ctx, fmt.Sprintf(format, args...))
 		},
-		LocalPrefix: v.options.LocalPrefix,
-		Debug:       v.options.VerboseOutput,
+		LocalPrefix: options.LocalPrefix,
+		Debug:       options.VerboseOutput,
 	}
 	for _, kv := range cfg.Env {
 		split := strings.Split(kv, "=")
@@ -297,16 +409,21 @@ func (v *view) Shutdown(ctx context.Context) {
 	v.session.removeView(ctx, v)
 }
 
-func (v *view) shutdown(context.Context) {
+func (v *view) shutdown(ctx context.Context) {
+	v.saveRecentFiles(ctx)
+
 	v.mu.Lock()
 	defer v.mu.Unlock()
 	if v.cancel != nil {
 		v.cancel()
 		v.cancel = nil
 	}
+	close(v.shutdownCh)
 	if v.modfiles != nil {
 		os.Remove(v.modfiles.temp)
+		os.Remove(tempSumFile(v.modfiles.temp))
 	}
+	v.session.cache.dropView(v)
 	debug.DropView(debugView{v})
 }
 
@@ -346,12 +463,23 @@ func (v *view) getSnapshot() *snapshot {
 	v.snapshotMu.Lock()
 	defer v.snapshotMu.Unlock()
 
+	v.applyPendingChangesLocked(v.baseCtx)
 	return v.snapshot
 }
 
+// applyPendingChangesLocked invalidates the snapshot for the changes that
+// have been coalesced since it was created. v.snapshotMu must be held.
+func (v *view) applyPendingChangesLocked(ctx context.Context) {
+	for uri, kind := range v.pendingChanges {
+		v.snapshot = v.snapshot.clone(ctx, uri, kind)
+	}
+	v.pendingChanges = nil
+}
+
 // invalidateContent invalidates the content of a Go file,
 // including any position and type information that depends on it.
-// It returns true if we were already tracking the given file, false otherwise.
+// It returns the new snapshot, or nil if the invalidation of a change to an
+// open file is deferred until the snapshot is next requested.
 func (v *view) invalidateContent(ctx context.Context, uri span.URI, kind source.FileKind, action source.FileAction) source.Snapshot {
 	// Detach the context so that content invalidation cannot be canceled.
 	ctx = xcontext.Detach(ctx)
@@ -367,6 +495,20 @@ func (v *view) invalidateContent(ctx context.Context, uri span.URI, kind source.
 	v.snapshotMu.Lock()
 	defer v.snapshotMu.Unlock()
 
+	v.lastChange = time.Now()
+
+	// The user sends a change for every keystroke. Rather than invalidating
+	// the snapshot each time, remember the file and invalidate it once,
+	// when the snapshot is needed. The overlay is already up to date, so
+	// the invalidation picks up the latest contents.
+	if action == source.Change && v.session.IsOpen(uri) {
+		if v.pendingChanges == nil {
+			v.pendingChanges = make(map[span.URI]source.FileKind)
+		}
+		v.pendingChanges[uri] = kind
+		return nil
+	}
+	v.applyPendingChangesLocked(ctx)
 	v.snapshot = v.snapshot.clone(ctx, uri, kind)
 	return v.snapshot
 }
@@ -514,7 +656,11 @@ func (v *view) FindMapperInPackage(searchpkg source.Package, uri span.URI) (*pro
 	}
 	_, m, _, err := ph.Cached()
 	if err != nil {
-		return nil, err
+		// Packages loaded from export data do not parse their files,
+		// so parse the file on demand to map its positions.
+		if _, m, _, err = ph.Parse(v.BackgroundContext()); err != nil {
+			return nil, err
+		}
 	}
 	return m, nil
 }
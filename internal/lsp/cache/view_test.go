@@ -0,0 +1,74 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/testenv"
+)
+
+func TestDegradedView(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, err := ioutil.TempDir("", "gopls-degraded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"go.mod":  "module fake\n",
+		"p/p.go":  "package p\n",
+		"q/q.go":  "package q\n\nimport _ \"fake/p\"\n",
+		"r/r.go":  "package r\n",
+		"r/r2.go": "package r\n\nvar x = 1\n",
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	options := source.DefaultOptions
+	options.Env = append(os.Environ(), "GOPROXY=off")
+	options.MaxWorkspacePackages = 2
+	options.WarmStart = false
+	options.Prefetch = false
+	s := New(nil).NewSession(ctx)
+	defer s.Shutdown(ctx)
+	sv, _, err := s.NewView(ctx, "degraded", span.FileURI(dir), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := sv.(*view)
+	<-v.depsLoaded
+
+	if !v.Degraded() {
+		t.Fatal("view with 3 packages and a limit of 2 is not degraded")
+	}
+	snapshot := v.currentSnapshot()
+	if ids := snapshot.WorkspacePackageIDs(ctx); len(ids) != 3 {
+		t.Errorf("got workspace packages %v, want 3", ids)
+	}
+	snapshot.mu.Lock()
+	npackages := len(snapshot.packages)
+	snapshot.mu.Unlock()
+	if npackages != 0 {
+		t.Errorf("degraded view built %d package handles, want none", npackages)
+	}
+	if files := snapshot.CompiledGoFiles(ctx, "fake/r"); len(files) != 2 {
+		t.Errorf("got compiled Go files %v for fake/r, want 2", files)
+	}
+}
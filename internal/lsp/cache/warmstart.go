@@ -0,0 +1,199 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+	errors "golang.org/x/xerrors"
+)
+
+// maxRecentFiles is the number of recently opened files remembered per folder.
+const maxRecentFiles = 10
+
+// recentFilesPath returns the file in which the recently opened files
+// of the given folder are persisted between sessions.
+func recentFilesPath(folder span.URI) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(folder.Filename()))
+	return filepath.Join(dir, "gopls", "recent", fmt.Sprintf("%x.json", hash[:8])), nil
+}
+
+// readRecentFiles returns the files most recently opened in folder,
+// most recent first.
+func readRecentFiles(folder span.URI) ([]span.URI, error) {
+	path, err := recentFilesPath(folder)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	if err := json.Unmarshal(data, &filenames); err != nil {
+		return nil, errors.Errorf("reading %s: %v", path, err)
+	}
+	var uris []span.URI
+	for _, filename := range filenames {
+		// Ignore files that have since moved out of the folder.
+		if !inFolder(filename, folder.Filename()) {
+			continue
+		}
+		uris = append(uris, span.FileURI(filename))
+	}
+	return uris, nil
+}
+
+// writeRecentFiles persists the files most recently opened in folder.
+func writeRecentFiles(folder span.URI, uris []span.URI) error {
+	path, err := recentFilesPath(folder)
+	if err != nil {
+		return err
+	}
+	filenames := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		filenames = append(filenames, uri.Filename())
+	}
+	data, err := json.Marshal(filenames)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// addRecentFile moves uri to the front of the list of recent files,
+// dropping the oldest entries beyond maxRecentFiles.
+func addRecentFile(recent []span.URI, uri span.URI) []span.URI {
+	result := []span.URI{uri}
+	for _, r := range recent {
+		if len(result) == maxRecentFiles {
+			break
+		}
+		if r != uri {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// rememberOpenFile records that the user opened uri, so that its package
+// is preloaded or prefetched the next time the view is created.
+// The files are saved when the view shuts down.
+func (v *view) rememberOpenFile(ctx context.Context, uri span.URI) {
+	if o := v.Options(); !(o.WarmStart || o.Prefetch) || uri.Filename() == "" {
+		return
+	}
+	v.recentMu.Lock()
+	defer v.recentMu.Unlock()
+
+	if len(v.recentFiles) > 0 && v.recentFiles[0] == uri {
+		return
+	}
+	v.recentFiles = addRecentFile(v.recentFiles, uri)
+	v.recentDirty = true
+}
+
+// saveRecentFiles persists the files recently opened in the view, if they
+// changed since they were read.
+func (v *view) saveRecentFiles(ctx context.Context) {
+	v.recentMu.Lock()
+	defer v.recentMu.Unlock()
+
+	if !v.recentDirty {
+		return
+	}
+	if err := writeRecentFiles(v.folder, v.recentFiles); err != nil {
+		log.Error(ctx, "failed to save recent files", err, telemetry.Directory.Of(v.folder))
+		return
+	}
+	v.recentDirty = false
+}
+
+// warmStart loads and type-checks the packages of the files that were most
+// recently opened in the view's folder, so that the first requests after a
+// restart do not wait for the whole workspace to be checked.
+// It returns the package handles it built once they are all built; their
+// type-checking continues in the background.
+func (v *view) warmStart(ctx context.Context) <-chan []*packageHandle {
+	result := make(chan []*packageHandle, 1)
+	options := v.Options()
+	if !options.WarmStart && !options.Prefetch {
+		result <- nil
+		return result
+	}
+	recent, err := readRecentFiles(v.folder)
+	if err != nil {
+		log.Error(ctx, "failed to read recent files", err, telemetry.Directory.Of(v.folder))
+	}
+	v.recentMu.Lock()
+	v.recentFiles = recent
+	v.recentMu.Unlock()
+	// The recent files are also read for prefetch, which starts once the
+	// workspace is loaded.
+	if !options.WarmStart {
+		result <- nil
+		return result
+	}
+
+	go func() {
+		ctx, done := trace.StartSpan(ctx, "cache.view.warmStart")
+		defer done()
+
+		var phs []*packageHandle
+		defer func() { result <- phs }()
+
+		// Files in the same directory usually belong to the same packages,
+		// so only load one of them.
+		seen := make(map[string]bool)
+		for _, uri := range recent {
+			dir := filepath.Dir(uri.Filename())
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			m, err := v.snapshot.load(ctx, source.FileURI(uri))
+			if err != nil {
+				log.Error(ctx, "warm start: failed to load", err, telemetry.File.Of(uri))
+				continue
+			}
+			v.snapshot.mu.Lock()
+			for _, m := range m {
+				v.snapshot.workspacePackages[m.id] = true
+			}
+			v.snapshot.mu.Unlock()
+			for _, m := range m {
+				ph, err := v.snapshot.packageHandle(ctx, m.id, source.ParseFull)
+				if err != nil {
+					log.Error(ctx, "warm start: no package handle", err, telemetry.File.Of(uri))
+					continue
+				}
+				phs = append(phs, ph)
+				go ph.Check(ctx)
+			}
+		}
+	}()
+	return result
+}
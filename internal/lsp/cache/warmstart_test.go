@@ -0,0 +1,68 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestAddRecentFile(t *testing.T) {
+	var recent []span.URI
+	for i := 0; i < maxRecentFiles+2; i++ {
+		recent = addRecentFile(recent, span.FileURI(fmt.Sprintf("/a/%d.go", i)))
+	}
+	if len(recent) != maxRecentFiles {
+		t.Fatalf("got %d recent files, want %d", len(recent), maxRecentFiles)
+	}
+	// Reopening a file moves it to the front without duplicating it.
+	again := span.FileURI("/a/5.go")
+	recent = addRecentFile(recent, again)
+	if len(recent) != maxRecentFiles {
+		t.Fatalf("got %d recent files after reopening, want %d", len(recent), maxRecentFiles)
+	}
+	if recent[0] != again {
+		t.Errorf("got %s first, want %s", recent[0], again)
+	}
+	for _, uri := range recent[1:] {
+		if uri == again {
+			t.Errorf("%s appears twice in %v", again, recent)
+		}
+	}
+}
+
+func TestRecentFilesRoundTrip(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "gopls-recent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	// Point os.UserCacheDir at the temporary directory on every platform.
+	for _, env := range []string{"XDG_CACHE_HOME", "HOME", "LocalAppData"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, cacheDir)
+	}
+
+	folder := span.FileURI("/src/project")
+	want := []span.URI{
+		span.FileURI("/src/project/b.go"),
+		span.FileURI("/src/project/sub/a.go"),
+	}
+	if err := writeRecentFiles(folder, append(want, span.FileURI("/elsewhere/c.go"))); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRecentFiles(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
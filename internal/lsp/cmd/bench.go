@@ -0,0 +1,418 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry"
+	"github.com/jackie-feng/tools/internal/telemetry/export"
+	"github.com/jackie-feng/tools/internal/tool"
+	errors "golang.org/x/xerrors"
+)
+
+// bench implements the bench verb for gopls.
+type bench struct {
+	Packages int  `flag:"packages" help:"number of packages of the generated workspace"`
+	Files    int  `flag:"files" help:"number of files of each package"`
+	Funcs    int  `flag:"funcs" help:"number of functions of each file"`
+	Runs     int  `flag:"runs" help:"number of completions and of changes to measure"`
+	Keep     bool `flag:"keep" help:"keep the generated workspace, and print its directory"`
+	JSON     bool `flag:"json" help:"print the results as JSON"`
+
+	app *Application
+}
+
+func (b *bench) Name() string  { return "bench" }
+func (b *bench) Usage() string { return "" }
+func (b *bench) ShortHelp() string {
+	return "measure the performance of gopls on a generated workspace"
+}
+func (b *bench) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Generates a module of Go packages that import each other, as large as the
+flags ask, and measures how long gopls takes to:
+
+  - load the workspace, from the initialize request until the diagnostics of
+    a file of the last package, which imports the most packages, arrive;
+  - complete a selector in that file, -runs times;
+  - publish the diagnostics of that file after a change to it, -runs times.
+
+The first completion includes type-checking the package of the file. The
+durations of the main telemetry spans of the server, such as the load of
+the workspace and the computation of completions and diagnostics, are
+reported too, when the server runs in the process.
+
+Example: compare the performance of two versions of gopls:
+
+  $ gopls bench -packages=200 -runs=20 > old.txt
+  $ ./gopls bench -packages=200 -runs=20 > new.txt
+`)
+}
+
+// benchSpans are the telemetry spans of the server whose durations are
+// reported.
+var benchSpans = []string{
+	"cache.view.load",
+	"cache.view.loadWorkspaceDependencies",
+	"cache.importer.typeCheck",
+	"source.Completion",
+	"source.diagnostics",
+}
+
+// benchTimeout is how long the benchmark waits for a result.
+const benchTimeout = time.Minute
+
+// benchResult summarizes the durations of a measurement.
+type benchResult struct {
+	Name     string  `json:"name"`
+	Runs     int     `json:"runs"`
+	MeanMs   float64 `json:"meanMs"`
+	MedianMs float64 `json:"medianMs"`
+	MaxMs    float64 `json:"maxMs"`
+}
+
+// benchReport is the output of the bench command.
+type benchReport struct {
+	Dir      string        `json:"dir,omitempty"`
+	Packages int           `json:"packages"`
+	Files    int           `json:"files"`
+	Results  []benchResult `json:"results"`
+	Spans    []benchResult `json:"spans"`
+}
+
+func (b *bench) Run(ctx context.Context, args ...string) error {
+	if len(args) != 0 {
+		return tool.CommandLineErrorf("bench expects no arguments")
+	}
+	if b.Packages < 1 || b.Files < 1 || b.Funcs < 1 || b.Runs < 1 {
+		return tool.CommandLineErrorf("bench expects -packages, -files, -funcs and -runs to be positive")
+	}
+	dir, err := ioutil.TempDir("", "gopls-bench")
+	if err != nil {
+		return err
+	}
+	if !b.Keep {
+		defer os.RemoveAll(dir)
+	}
+	target, err := generateWorkspace(dir, b.Packages, b.Files, b.Funcs)
+	if err != nil {
+		return err
+	}
+	recorder := &spanRecorder{Exporter: export.Null(), durations: make(map[string][]time.Duration)}
+	export.AddExporters(recorder)
+
+	report, err := b.measure(ctx, dir, target)
+	if err != nil {
+		return err
+	}
+	for _, name := range benchSpans {
+		if durations := recorder.get(name); len(durations) > 0 {
+			report.Spans = append(report.Spans, summarize(name, durations))
+		}
+	}
+	if b.Keep {
+		report.Dir = dir
+	}
+	if b.JSON {
+		data, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+	printBenchReport(os.Stdout, report)
+	return nil
+}
+
+// measure runs the measurements against the workspace in dir, in which
+// target is the file that is completed and changed.
+func (b *bench) measure(ctx context.Context, dir, target string) (*benchReport, error) {
+	report := &benchReport{
+		Packages: b.Packages,
+		Files:    b.Packages * b.Files,
+	}
+
+	// The connection is made with dir as the working directory, which is
+	// the folder of the workspace.
+	wd := b.app.wd
+	b.app.wd = dir
+	defer func() { b.app.wd = wd }()
+
+	// published is the latest version of target whose diagnostics were
+	// published, and the server signals each publication on diagnostics.
+	uri := span.FileURI(target)
+	var (
+		publishedMu sync.Mutex
+		published   float64
+	)
+	diagnostics := make(chan struct{}, 1)
+	start := time.Now()
+	conn, err := b.app.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.terminate(ctx)
+	conn.Client.filesMu.Lock()
+	conn.Client.onDiagnostics = func(p *protocol.PublishDiagnosticsParams) {
+		if span.NewURI(p.URI) != uri {
+			return
+		}
+		publishedMu.Lock()
+		published = p.Version
+		publishedMu.Unlock()
+		select {
+		case diagnostics <- struct{}{}:
+		default:
+		}
+	}
+	conn.Client.filesMu.Unlock()
+
+	file := conn.AddFile(ctx, uri)
+	if file.err != nil {
+		return nil, file.err
+	}
+	select {
+	case <-file.hasDiagnostics:
+	case <-time.After(benchTimeout):
+		return nil, errors.Errorf("timed out waiting for the diagnostics of %v", uri)
+	}
+	report.Results = append(report.Results, summarize("initial load", []time.Duration{time.Since(start)}))
+
+	content := string(file.mapper.Content)
+	pos, err := completionPosition(content)
+	if err != nil {
+		return nil, err
+	}
+	var completions []time.Duration
+	for i := 0; i < b.Runs; i++ {
+		start := time.Now()
+		list, err := conn.Completion(ctx, &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: protocol.NewURI(uri)},
+				Position:     pos,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		completions = append(completions, time.Since(start))
+		if list == nil || len(list.Items) == 0 {
+			return nil, errors.Errorf("no completions in %v at %v", uri, pos)
+		}
+	}
+	report.Results = append(report.Results, summarize("completion", completions))
+
+	var changes []time.Duration
+	for i := 0; i < b.Runs; i++ {
+		// Each change adds a different type error, so that the diagnostics
+		// of the file change, and are published again.
+		version := float64(i + 2)
+		text := content + fmt.Sprintf("\nvar _ int = \"change %d\"\n", i)
+		start := time.Now()
+		if err := conn.DidChange(ctx, &protocol.DidChangeTextDocumentParams{
+			TextDocument: protocol.VersionedTextDocumentIdentifier{
+				Version:                version,
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: protocol.NewURI(uri)},
+			},
+			ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: text}},
+		}); err != nil {
+			return nil, err
+		}
+		timeout := time.After(benchTimeout)
+		for {
+			publishedMu.Lock()
+			v := published
+			publishedMu.Unlock()
+			if v >= version {
+				break
+			}
+			select {
+			case <-diagnostics:
+			case <-timeout:
+				return nil, errors.Errorf("timed out waiting for the diagnostics of version %v of %v", version, uri)
+			}
+		}
+		changes = append(changes, time.Since(start))
+	}
+	report.Results = append(report.Results, summarize("change to diagnostics", changes))
+	return report, nil
+}
+
+// completionPosition returns the position of the selector of the body of
+// the Complete function of content.
+func completionPosition(content string) (protocol.Position, error) {
+	for i, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "\treturn t.") {
+			return protocol.Position{Line: float64(i), Character: float64(len("\treturn t."))}, nil
+		}
+	}
+	return protocol.Position{}, errors.Errorf("no completion position")
+}
+
+// summarize returns the summary of the durations of a measurement.
+func summarize(name string, durations []time.Duration) benchResult {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return benchResult{
+		Name:     name,
+		Runs:     len(sorted),
+		MeanMs:   ms(total / time.Duration(len(sorted))),
+		MedianMs: ms(sorted[len(sorted)/2]),
+		MaxMs:    ms(sorted[len(sorted)-1]),
+	}
+}
+
+func printBenchReport(w io.Writer, report *benchReport) {
+	fmt.Fprintf(w, "workspace of %d packages, %d files", report.Packages, report.Files)
+	if report.Dir != "" {
+		fmt.Fprintf(w, " in %s", report.Dir)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "\truns\tmean\tmedian\tmax\n")
+	print := func(results []benchResult) {
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%d\t%.1fms\t%.1fms\t%.1fms\n", r.Name, r.Runs, r.MeanMs, r.MedianMs, r.MaxMs)
+		}
+	}
+	print(report.Results)
+	if len(report.Spans) > 0 {
+		fmt.Fprintf(tw, "server spans:\t\t\t\t\n")
+		print(report.Spans)
+	}
+	tw.Flush()
+}
+
+// spanRecorder is a telemetry exporter that records the durations of the
+// finished spans.
+type spanRecorder struct {
+	export.Exporter
+
+	mu        sync.Mutex
+	durations map[string][]time.Duration
+}
+
+func (r *spanRecorder) FinishSpan(ctx context.Context, span *telemetry.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.durations[span.Name] = append(r.durations[span.Name], span.Finish.Sub(span.Start))
+}
+
+func (r *spanRecorder) get(name string) []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.durations[name]
+}
+
+// benchModule is the module path of the generated workspace.
+const benchModule = "example.com/bench"
+
+// generateWorkspace writes to dir a module of n packages, each of the given
+// number of files and functions per file, and returns the name of the file
+// to complete and change, in the last package. Package i imports the
+// packages i-1, i/2 and i/3, so that the last package depends, directly or
+// not, on all of the others.
+func generateWorkspace(dir string, packages, files, funcs int) (string, error) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+benchModule+"\n\ngo 1.13\n"), 0644); err != nil {
+		return "", err
+	}
+	for i := 0; i < packages; i++ {
+		pkgDir := filepath.Join(dir, benchPackage(i))
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			return "", err
+		}
+		imports := benchImports(i)
+		for j := 0; j < files; j++ {
+			var buf bytes.Buffer
+			fmt.Fprintf(&buf, "// Code generated by gopls bench. DO NOT EDIT.\n\npackage %s\n\n", benchPackage(i))
+			fmt.Fprintf(&buf, "import (\n\t\"fmt\"\n")
+			for _, imp := range imports {
+				fmt.Fprintf(&buf, "\t%q\n", benchModule+"/"+benchPackage(imp))
+			}
+			fmt.Fprintf(&buf, ")\n\n")
+			fmt.Fprintf(&buf, "// T%d is a type of the benchmark.\ntype T%d struct {\n", j, j)
+			for k := 0; k < funcs; k++ {
+				fmt.Fprintf(&buf, "\tF%d int\n", k)
+			}
+			fmt.Fprintf(&buf, "}\n")
+			for k := 0; k < funcs; k++ {
+				fmt.Fprintf(&buf, "\n// M%d is a method of the benchmark.\n", k)
+				fmt.Fprintf(&buf, "func (t *T%d) M%d(x int) string {\n\treturn fmt.Sprint(t.F%d + F%d_%d(x))\n}\n", j, k, k, j, k)
+				fmt.Fprintf(&buf, "\n// F%d_%d is a function of the benchmark.\n", j, k)
+				fmt.Fprintf(&buf, "func F%d_%d(x int) int {\n", j, k)
+				switch {
+				case k > 0:
+					fmt.Fprintf(&buf, "\treturn x*%d + F%d_%d(x-1)\n", k, j, k-1)
+				case len(imports) > 0:
+					fmt.Fprintf(&buf, "\treturn x")
+					for _, imp := range imports {
+						fmt.Fprintf(&buf, " + %s.F%d_0(x)", benchPackage(imp), j)
+					}
+					fmt.Fprintf(&buf, "\n")
+				default:
+					fmt.Fprintf(&buf, "\treturn x\n")
+				}
+				fmt.Fprintf(&buf, "}\n")
+			}
+			filename := filepath.Join(pkgDir, fmt.Sprintf("file%d.go", j))
+			if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+				return "", err
+			}
+		}
+	}
+	target := filepath.Join(dir, benchPackage(packages-1), "complete.go")
+	content := fmt.Sprintf(`package %s
+
+// Complete is where the benchmark asks for completions.
+func Complete(t *T0) int {
+	return t.F0
+}
+`, benchPackage(packages-1))
+	if err := ioutil.WriteFile(target, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// benchPackage returns the name of the package i of the generated workspace.
+func benchPackage(i int) string {
+	return fmt.Sprintf("p%03d", i)
+}
+
+// benchImports returns the packages that the package i of the generated
+// workspace imports.
+func benchImports(i int) []int {
+	var imports []int
+	seen := make(map[int]bool)
+	for _, imp := range []int{i - 1, i / 2, i / 3} {
+		if imp >= 0 && imp < i && !seen[imp] {
+			seen[imp] = true
+			imports = append(imports, imp)
+		}
+	}
+	return imports
+}
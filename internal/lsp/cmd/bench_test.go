@@ -0,0 +1,45 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/testenv"
+)
+
+func TestGenerateWorkspace(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, err := ioutil.TempDir("", "gopls-bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target, err := generateWorkspace(dir, 7, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "vet", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=-mod=mod")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("the generated workspace does not build: %v\n%s", err, out)
+	}
+	content, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, err := completionPosition(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.Line != 4 || pos.Character != 10 {
+		t.Errorf("completion position = %v, want 4:10", pos)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/lsp/debug"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/tool"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// defaultBundle is the archive written if none is given.
+	defaultBundle = "gopls-bundle.zip"
+
+	// maxBundleLog is the size of the end of the log file that is included
+	// in a bundle.
+	maxBundleLog = 1 << 20
+)
+
+// debugPages are the pages of the debug server included in a bundle.
+var debugPages = map[string]string{
+	"index.html":    "/",
+	"info.html":     "/info",
+	"memory.html":   "/memory",
+	"rpc.html":      "/rpc/",
+	"trace.html":    "/trace/",
+	"metrics.txt":   "/metrics/",
+	"profiles.html": "/profiles",
+}
+
+// bundle implements the bundle verb for gopls.
+type bundle struct {
+	Debug    string `flag:"debug" help:"address of the debug server of a running gopls, whose pages are included"`
+	Log      string `flag:"log" help:"log file of a running gopls, whose last megabyte is included"`
+	Settings string `flag:"settings" help:"JSON file holding the gopls settings of the editor"`
+
+	app *Application
+}
+
+func (b *bundle) Name() string  { return "bundle" }
+func (b *bundle) Usage() string { return "[archive]" }
+func (b *bundle) ShortHelp() string {
+	return "gather diagnostic information into an archive to attach to an issue"
+}
+func (b *bundle) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprintf(f.Output(), `
+Writes a zip archive, %s by default, holding the gopls version, the output
+of go env, the editor settings given by -settings, the end of the log given
+by -log, and the pages of the debug server given by -debug. If -remote is
+set, the cache and memory statistics of the remote server are included too.
+
+The values of the environment variables in the settings are replaced with
+their names, and the home directory with ~, but the logs and debug pages
+may still hold file names and contents; please review the archive before
+sharing it.
+
+Example:
+  $ gopls serve -debug=localhost:6060 -logfile=/tmp/gopls.log
+  $ gopls bundle -debug=localhost:6060 -log=/tmp/gopls.log -settings=settings.json
+`, defaultBundle)
+}
+
+func (b *bundle) Run(ctx context.Context, args ...string) error {
+	if len(args) > 1 {
+		return tool.CommandLineErrorf("bundle expects at most 1 argument")
+	}
+	name := defaultBundle
+	if len(args) == 1 {
+		name = args[0]
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(f)
+	b.write(ctx, w)
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s; please review it before attaching it to an issue\n", name)
+	return nil
+}
+
+// write adds the contents of the bundle to w. Information that cannot be
+// gathered is replaced with the error, so that the rest is still reported.
+func (b *bundle) write(ctx context.Context, w *zip.Writer) {
+	buf := &bytes.Buffer{}
+	debug.PrintVersionInfo(buf, true, debug.PlainText)
+	addBundleFile(w, "version.txt", buf.Bytes(), nil)
+
+	home := os.Getenv("HOME")
+	goenv, err := exec.Command("go", "env").CombinedOutput()
+	if home != "" {
+		goenv = bytes.Replace(goenv, []byte(home), []byte("~"), -1)
+	}
+	addBundleFile(w, "goenv.txt", goenv, err)
+
+	if b.Settings != "" {
+		data, err := ioutil.ReadFile(b.Settings)
+		if err == nil {
+			data, err = sanitizeSettings(data, home)
+		}
+		addBundleFile(w, "settings.json", data, err)
+	}
+	if b.Log != "" {
+		data, err := readTail(b.Log, maxBundleLog)
+		addBundleFile(w, "gopls.log", data, err)
+	}
+	if b.app.Remote != "" {
+		data, err := b.remoteStats(ctx)
+		addBundleFile(w, "stats.json", data, err)
+	}
+	if b.Debug != "" {
+		addr := b.Debug
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+		client := &http.Client{Timeout: 10 * time.Second}
+		for file, page := range debugPages {
+			data, err := fetchPage(client, addr+page)
+			addBundleFile(w, "debug/"+file, data, err)
+		}
+	}
+}
+
+func (b *bundle) remoteStats(ctx context.Context) ([]byte, error) {
+	conn, err := b.app.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.terminate(ctx)
+	result, err := conn.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command: "stats",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(result, "", "\t")
+}
+
+func addBundleFile(w *zip.Writer, name string, data []byte, err error) {
+	if err != nil {
+		name += ".error"
+		data = []byte(err.Error() + "\n")
+	}
+	f, err := w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	f.Write(data)
+}
+
+func fetchPage(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// readTail returns at most the last max bytes of the named file.
+func readTail(name string, max int64) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > max {
+		if _, err := f.Seek(info.Size()-max, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.ReadAll(f)
+}
+
+// sanitizeSettings removes the values of the environment variables from
+// the JSON encoded editor settings, which may hold credentials, and replaces
+// the home directory with ~ in all strings.
+func sanitizeSettings(data []byte, home string) ([]byte, error) {
+	var settings interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, errors.Errorf("invalid settings: %v", err)
+	}
+	return json.MarshalIndent(sanitizeValue(settings, home, false), "", "\t")
+}
+
+func sanitizeValue(v interface{}, home string, env bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if env {
+				v[key] = "$" + key
+				continue
+			}
+			v[key] = sanitizeValue(value, home, key == "env")
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = sanitizeValue(value, home, false)
+		}
+	case string:
+		if home != "" {
+			return strings.Replace(v, home, "~", -1)
+		}
+	}
+	return v
+}
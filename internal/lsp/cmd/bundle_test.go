@@ -0,0 +1,39 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeSettings(t *testing.T) {
+	settings := `{
+	"gopls": {
+		"env": {"GOFLAGS": "-mod=vendor", "GITHUB_TOKEN": "secret"},
+		"buildFlags": ["-tags=/home/user/tags"],
+		"staticcheck": true
+	}
+}`
+	data, err := sanitizeSettings([]byte(settings), "/home/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"gopls": map[string]interface{}{
+			"env":         map[string]interface{}{"GOFLAGS": "$GOFLAGS", "GITHUB_TOKEN": "$GITHUB_TOKEN"},
+			"buildFlags":  []interface{}{"-tags=~/tags"},
+			"staticcheck": true,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s", data)
+	}
+}
@@ -6,31 +6,56 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/jackie-feng/tools/go/packages"
 	"github.com/jackie-feng/tools/internal/span"
 	errors "golang.org/x/xerrors"
 )
 
 // check implements the check verb for gopls.
 type check struct {
+	JSON bool `flag:"json" help:"print the diagnostics as JSON"`
+
 	app *Application
 }
 
-func (c *check) Name() string      { return "check" }
-func (c *check) Usage() string     { return "<filename>" }
-func (c *check) ShortHelp() string { return "show diagnostic results for the specified file" }
+func (c *check) Name() string  { return "check" }
+func (c *check) Usage() string { return "<filename or package pattern>..." }
+func (c *check) ShortHelp() string {
+	return "show diagnostic results for the specified files or packages"
+}
 func (c *check) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
 Example: show the diagnostic results of this file:
 
   $ gopls check internal/lsp/cmd/check.go
 
-	gopls check flags are:
+Example: show the diagnostic results of all of the packages of a module, as
+an editor would show them, and fail if there are any, as in a CI job:
+
+  $ gopls check ./...
+
+The diagnostics are the errors of the go command, the parse and type errors,
+and the findings of the analyzers that are enabled for the editors. check
+exits with a non-zero status if it reports any.
 `)
-	f.PrintDefaults()
+}
+
+// checkDiagnostic is a diagnostic printed by check.
+type checkDiagnostic struct {
+	Posn     string `json:"posn"`
+	Message  string `json:"message"`
+	Source   string `json:"source,omitempty"`
+	Severity string `json:"severity,omitempty"`
+
+	spn span.Span
 }
 
 // Run performs the check on the files specified by args and prints the
@@ -40,6 +65,10 @@ func (c *check) Run(ctx context.Context, args ...string) error {
 		// no files, so no results
 		return nil
 	}
+	files, err := c.app.packageFiles(args)
+	if err != nil {
+		return err
+	}
 	checking := map[span.URI]*cmdFile{}
 	// now we ready to kick things off
 	conn, err := c.app.connect(ctx)
@@ -47,8 +76,8 @@ func (c *check) Run(ctx context.Context, args ...string) error {
 		return err
 	}
 	defer conn.terminate(ctx)
-	for _, arg := range args {
-		uri := span.FileURI(arg)
+	for _, filename := range files {
+		uri := span.FileURI(filename)
 		file := conn.AddFile(ctx, uri)
 		if file.err != nil {
 			return file.err
@@ -57,6 +86,7 @@ func (c *check) Run(ctx context.Context, args ...string) error {
 	}
 	// now wait for results
 	// TODO: maybe conn.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{Command: "gopls-wait-idle"})
+	var diagnostics []checkDiagnostic
 	for _, file := range checking {
 		select {
 		case <-file.hasDiagnostics:
@@ -70,8 +100,83 @@ func (c *check) Run(ctx context.Context, args ...string) error {
 			if err != nil {
 				return errors.Errorf("Could not convert position %v for %q", d.Range, d.Message)
 			}
-			fmt.Printf("%v: %v\n", spn, d.Message)
+			spn = span.New(spn.URI(), spn.Start(), spn.Start())
+			diagnostics = append(diagnostics, checkDiagnostic{
+				Posn:     fmt.Sprint(spn),
+				Message:  strings.TrimSpace(d.Message),
+				Source:   d.Source,
+				Severity: fmt.Sprint(d.Severity),
+				spn:      spn,
+			})
+		}
+	}
+	sort.Slice(diagnostics, func(i, j int) bool {
+		if r := span.Compare(diagnostics[i].spn, diagnostics[j].spn); r != 0 {
+			return r < 0
+		}
+		return diagnostics[i].Message < diagnostics[j].Message
+	})
+	if c.JSON {
+		if diagnostics == nil {
+			diagnostics = []checkDiagnostic{}
+		}
+		data, err := json.MarshalIndent(diagnostics, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+	} else {
+		for _, d := range diagnostics {
+			fmt.Printf("%s: %s\n", d.Posn, d.Message)
 		}
 	}
+	if len(diagnostics) > 0 {
+		return errors.Errorf("found %d diagnostics", len(diagnostics))
+	}
 	return nil
 }
+
+// packageFiles returns the files for args, which are Go files, or package
+// patterns, such as ./..., which stand for the Go files of the packages they
+// match, including their tests.
+func (app *Application) packageFiles(args []string) ([]string, error) {
+	var files, patterns []string
+	for _, arg := range args {
+		if strings.HasSuffix(arg, ".go") {
+			files = append(files, arg)
+		} else if fi, err := os.Stat(arg); err == nil && !fi.IsDir() {
+			files = append(files, arg)
+		} else {
+			patterns = append(patterns, arg)
+		}
+	}
+	if len(patterns) == 0 {
+		return files, nil
+	}
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles,
+		Dir:   app.wd,
+		Env:   append(os.Environ(), app.env...),
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		seen[f] = true
+	}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.GoFiles {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no Go files match %s", strings.Join(patterns, " "))
+	}
+	return files, nil
+}
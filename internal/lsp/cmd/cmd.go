@@ -14,7 +14,6 @@ import (
 	"go/token"
 	"io/ioutil"
 	"log"
-	"net"
 	"os"
 	"strings"
 	"sync"
@@ -27,6 +26,7 @@ import (
 	"github.com/jackie-feng/tools/internal/span"
 	"github.com/jackie-feng/tools/internal/telemetry/export"
 	"github.com/jackie-feng/tools/internal/telemetry/export/ocagent"
+	"github.com/jackie-feng/tools/internal/telemetry/export/otlp"
 	"github.com/jackie-feng/tools/internal/tool"
 	"github.com/jackie-feng/tools/internal/xcontext"
 	errors "golang.org/x/xerrors"
@@ -58,7 +58,7 @@ type Application struct {
 	env []string
 
 	// Support for remote lsp server
-	Remote string `flag:"remote" help:"*EXPERIMENTAL* - forward all commands to a remote lsp"`
+	Remote string `flag:"remote" help:"*EXPERIMENTAL* - forward all commands to a remote lsp at tcp:host:port or unix:path, or to the daemon shared by your editors if auto"`
 
 	// Enable verbose logging
 	Verbose bool `flag:"v" help:"verbose output"`
@@ -66,6 +66,9 @@ type Application struct {
 	// Control ocagent export of telemetry
 	OCAgent string `flag:"ocagent" help:"the address of the ocagent, or off"`
 
+	// Control OpenTelemetry export of traces
+	OTLP string `flag:"otlp" help:"the address of an OpenTelemetry collector to send traces to, such as http://localhost:4318, or off; defaults to $OTEL_EXPORTER_OTLP_ENDPOINT"`
+
 	// PrepareOptions is called to update the options when a new view is built.
 	// It is primarily to allow the behavior of gopls to be modified by hooks.
 	PrepareOptions func(*source.Options)
@@ -83,6 +86,7 @@ func New(name, wd string, env []string, options func(*source.Options)) *Applicat
 		env:     env,
 		OCAgent: "off", //TODO: Remove this line to default the exporter to on
 	}
+	app.Serve.WatchdogStuck = defaultWatchdogStuck
 	return app
 }
 
@@ -98,31 +102,17 @@ func (app *Application) ShortHelp() string {
 }
 
 // DetailedHelp implements tool.Application returning the main binary help.
-// This includes the short help for all the sub commands.
 func (app *Application) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
 gopls is a Go language server. It is typically used with an editor to provide
 language features. When no command is specified, gopls will default to the 'serve'
 command. The language features can also be accessed via the gopls command-line interface.
-
-Available commands are:
-`, app.Name(), app.Name(), app.Serve.Name())
-	fmt.Fprint(f.Output(), `
-main:
-`)
-	for _, c := range app.mainCommands() {
-		fmt.Fprintf(f.Output(), "  %s : %v\n", c.Name(), c.ShortHelp())
-	}
-	fmt.Fprint(f.Output(), `
-features:
-`)
-	for _, c := range app.featureCommands() {
-		fmt.Fprintf(f.Output(), "  %s : %v\n", c.Name(), c.ShortHelp())
-	}
-	fmt.Fprint(f.Output(), `
-gopls flags are:
 `)
-	f.PrintDefaults()
+}
+
+// SubCommands implements tool.SubCommander returning the commands of gopls.
+func (app *Application) SubCommands() []tool.Application {
+	return app.commands()
 }
 
 // Run takes the args after top level flag processing, and invokes the correct
@@ -134,17 +124,17 @@ func (app *Application) Run(ctx context.Context, args ...string) error {
 	//TODO: we should not need to adjust the discovered configuration
 	ocConfig.Address = app.OCAgent
 	export.AddExporters(ocagent.Connect(ocConfig))
+	otlpConfig := otlp.Discover()
+	if app.OTLP != "" {
+		otlpConfig.Address = app.OTLP
+		otlpConfig.URL = ""
+	}
+	export.AddExporters(otlp.Connect(otlpConfig))
 	app.Serve.app = app
 	if len(args) == 0 {
 		return tool.Run(ctx, &app.Serve, args)
 	}
-	command, args := args[0], args[1:]
-	for _, c := range app.commands() {
-		if c.Name() == command {
-			return tool.Run(ctx, c, args)
-		}
-	}
-	return tool.CommandLineErrorf("Unknown command %v", command)
+	return tool.RunSubCommand(ctx, app, args)
 }
 
 // commands returns the set of commands supported by the gopls tool on the
@@ -162,12 +152,21 @@ func (app *Application) mainCommands() []tool.Application {
 		&app.Serve,
 		&version{app: app},
 		&bug{},
+		&bundle{app: app},
+		&stats{app: app},
+		&inspect{app: app, Packages: 10},
+		&replay{app: app},
+		&bench{app: app, Packages: 50, Files: 5, Funcs: 10, Runs: 10},
+		&completion{app: app},
+		&help{app: app},
 	}
 }
 
 func (app *Application) featureCommands() []tool.Application {
 	return []tool.Application{
 		&check{app: app},
+		&codelens{app: app},
+		&describe{app: app},
 		&foldingRanges{app: app},
 		&format{app: app},
 		&highlight{app: app},
@@ -177,9 +176,11 @@ func (app *Application) featureCommands() []tool.Application {
 		&query{app: app},
 		&references{app: app},
 		&rename{app: app},
+		&semtok{app: app},
 		&signature{app: app},
 		&suggestedfix{app: app},
 		&symbols{app: app},
+		&workspaceSymbol{app: app},
 	}
 }
 
@@ -218,7 +219,12 @@ func (app *Application) connect(ctx context.Context) (*connection, error) {
 		return connection, nil
 	default:
 		connection := newConnection(app)
-		conn, err := net.Dial("tcp", app.Remote)
+		conn, err := app.dialRemote(ctx)
+		if _, ok := err.(*incompatibleDaemonError); ok {
+			log.Printf("%v, running gopls in this process", err)
+			ctx, connection.Server = lsp.NewClientServer(ctx, cache.New(app.options), connection.Client)
+			return connection, connection.initialize(ctx, app.options)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -265,6 +271,10 @@ type cmdClient struct {
 
 	filesMu sync.Mutex
 	files   map[span.URI]*cmdFile
+
+	// onDiagnostics, if set, is called with the diagnostics that the
+	// server publishes, while filesMu is held.
+	onDiagnostics func(*protocol.PublishDiagnosticsParams)
 }
 
 type cmdFile struct {
@@ -375,6 +385,9 @@ func (c *cmdClient) PublishDiagnostics(ctx context.Context, p *protocol.PublishD
 	if !hadDiagnostics {
 		close(file.hasDiagnostics)
 	}
+	if c.onDiagnostics != nil {
+		c.onDiagnostics(p)
+	}
 	return nil
 }
 
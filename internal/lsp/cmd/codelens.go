@@ -0,0 +1,116 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/tool"
+	errors "golang.org/x/xerrors"
+)
+
+// codelens implements the codelens verb for gopls.
+type codelens struct {
+	app *Application
+}
+
+func (c *codelens) Name() string      { return "codelens" }
+func (c *codelens) Usage() string     { return "<file> [index]" }
+func (c *codelens) ShortHelp() string { return "list or run the code lenses of a file" }
+func (c *codelens) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Lists the code lenses of the file, one per line, as its 1-based index,
+the line:startColumn-endColumn of its range, its title, and the command
+that it runs along with the arguments of the command other than the file.
+
+Given the index of a lens, runs its command as the editor would, through
+workspace/executeCommand, and prints the result, such as the output of
+go test for the lens of a test function.
+
+Example:
+
+  $ gopls codelens helper/helper_test.go
+  $ gopls codelens helper/helper_test.go 1
+`)
+}
+
+func (c *codelens) Run(ctx context.Context, args ...string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return tool.CommandLineErrorf("codelens expects 1 or 2 arguments (file, [index])")
+	}
+	index := 0
+	if len(args) == 2 {
+		var err error
+		index, err = strconv.Atoi(args[1])
+		if err != nil || index < 1 {
+			return tool.CommandLineErrorf("invalid code lens index %q", args[1])
+		}
+	}
+	conn, err := c.app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.terminate(ctx)
+
+	from := span.Parse(args[0])
+	file := conn.AddFile(ctx, from.URI())
+	if file.err != nil {
+		return file.err
+	}
+	lenses, err := conn.CodeLens(ctx, &protocol.CodeLensParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: protocol.NewURI(from.URI())},
+	})
+	if err != nil {
+		return errors.Errorf("%v: %v", from, err)
+	}
+	if index == 0 {
+		for i, lens := range lenses {
+			spn, err := file.mapper.RangeSpan(lens.Range)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%d %d:%d-%d %s (%s", i+1, spn.Start().Line(), spn.Start().Column(), spn.End().Column(), lens.Command.Title, lens.Command.Command)
+			// The first argument of the commands of the lenses is the file.
+			args := lens.Command.Arguments
+			if len(args) > 0 {
+				args = args[1:]
+			}
+			for _, arg := range args {
+				fmt.Printf(" %v", arg)
+			}
+			fmt.Println(")")
+		}
+		return nil
+	}
+	if index > len(lenses) {
+		return errors.Errorf("%v: no code lens %d, the file has %d", from, index, len(lenses))
+	}
+	lens := lenses[index-1]
+	result, err := conn.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   lens.Command.Command,
+		Arguments: lens.Command.Arguments,
+	})
+	if err != nil {
+		return errors.Errorf("%v: %v", from, err)
+	}
+	switch result := result.(type) {
+	case nil:
+	case string:
+		fmt.Print(result)
+	default:
+		data, err := json.MarshalIndent(result, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+	}
+	return nil
+}
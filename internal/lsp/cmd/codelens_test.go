@@ -0,0 +1,109 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/testenv"
+	"github.com/jackie-feng/tools/internal/tool"
+)
+
+const codeLensTestFile = `package fake
+
+import "testing"
+
+func TestPass(t *testing.T) {}
+
+func TestFail(t *testing.T) { t.Error("failed") }
+
+type fake struct{}
+
+func (fake) TestMethod(t *testing.T) {}
+
+func testHelper(t *testing.T) {}
+
+func BenchmarkLoop(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+	}
+}
+`
+
+func TestCodeLens(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	tmpDir, err := ioutil.TempDir("", "codelens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module fake\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testFile := filepath.Join(tmpDir, "fake_test.go")
+	if err := ioutil.WriteFile(testFile, []byte(codeLensTestFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := runCodeLens(t, tmpDir, testFile)
+	want := `1 5:6-14 run test (test TestPass)
+2 7:6-14 run test (test TestFail)
+3 15:6-19 run benchmark (test BenchmarkLoop)
+`
+	if got != want {
+		t.Errorf("codelens %s: got\n%s\nwant\n%s", testFile, got, want)
+	}
+	got = runCodeLens(t, tmpDir, filepath.Join(tmpDir, "go.mod"))
+	if want := "1 1:1-1 run go mod tidy (tidy)\n"; got != want {
+		t.Errorf("codelens go.mod: got %q, want %q", got, want)
+	}
+
+	for _, test := range []struct {
+		index string
+		want  []string
+	}{
+		{"1", []string{"ok"}},
+		{"2", []string{"--- FAIL: TestFail", "failed"}},
+		{"3", []string{"BenchmarkLoop", "ok"}},
+	} {
+		got := runCodeLens(t, tmpDir, testFile, test.index)
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("codelens %s %s: got output\n%s\nwant it to contain %q", testFile, test.index, got, want)
+			}
+		}
+	}
+}
+
+// runCodeLens runs the codelens command with args in dir, and returns what
+// it prints.
+func runCodeLens(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+	out := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		out <- data
+	}()
+	app := New("gopls-test", dir, os.Environ(), nil)
+	err = tool.Run(context.Background(), app, append([]string{"codelens"}, args...))
+	w.Close()
+	data := <-out
+	if err != nil {
+		t.Fatalf("codelens %v: %v", args, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,357 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/tool"
+)
+
+// completion implements the completion verb for gopls.
+type completion struct {
+	app *Application
+}
+
+func (c *completion) Name() string      { return "completion" }
+func (c *completion) Usage() string     { return "bash|zsh|fish" }
+func (c *completion) ShortHelp() string { return "generate a shell completion script" }
+func (c *completion) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+The script completes the commands of gopls, the modes of the query command,
+and the flags of each of them. The arguments of the commands are completed as
+file names.
+
+Example: enable the completion in the current shell:
+
+  $ source <(gopls completion bash)
+  $ source <(gopls completion zsh)
+  $ gopls completion fish | source
+
+To enable it in every shell, add the command to the startup file of the
+shell, or write the script to a directory the shell loads completions from,
+such as the bash-completion completions directory, a directory of the zsh
+fpath as _gopls, or ~/.config/fish/completions/gopls.fish.
+`)
+}
+
+// Run writes the completion script for the shell specified by args to stdout.
+func (c *completion) Run(ctx context.Context, args ...string) error {
+	if len(args) != 1 {
+		return tool.CommandLineErrorf("completion expects 1 argument")
+	}
+	root := newCompletionNode("", c.app)
+	var buf bytes.Buffer
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(&buf, root)
+	case "zsh":
+		writeZshCompletion(&buf, root)
+	case "fish":
+		writeFishCompletion(&buf, root)
+	default:
+		return tool.CommandLineErrorf("unsupported shell %q, expected bash, zsh or fish", args[0])
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// A completionNode describes what can follow a command on the command line:
+// its flags, and the commands that it dispatches to.
+type completionNode struct {
+	path     string // the commands that lead to the node, separated by spaces
+	name     string
+	help     string
+	flags    []completionFlag
+	commands []*completionNode
+}
+
+// A completionFlag is a flag of a command.
+type completionFlag struct {
+	name  string
+	help  string
+	value bool // whether the flag is followed by a value, unlike a boolean flag
+}
+
+// newCompletionNode returns the node for the command app, found at path,
+// along with the nodes of the commands it dispatches to.
+func newCompletionNode(path string, app tool.Application) *completionNode {
+	n := &completionNode{
+		path: path,
+		name: app.Name(),
+		help: firstLine(app.ShortHelp()),
+	}
+	tool.FlagSet(app).VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		n.flags = append(n.flags, completionFlag{
+			name:  f.Name,
+			help:  firstLine(f.Usage),
+			value: !ok || !b.IsBoolFlag(),
+		})
+	})
+	if sc, ok := app.(tool.SubCommander); ok {
+		for _, c := range sc.SubCommands() {
+			n.commands = append(n.commands, newCompletionNode(strings.TrimSpace(path+" "+c.Name()), c))
+		}
+	}
+	return n
+}
+
+// walk calls f for n and each node below it, in order.
+func (n *completionNode) walk(f func(*completionNode)) {
+	f(n)
+	for _, c := range n.commands {
+		c.walk(f)
+	}
+}
+
+// commandNames returns the names of the commands of n.
+func (n *completionNode) commandNames() []string {
+	var names []string
+	for _, c := range n.commands {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// valueFlags returns the names of the flags of n that are followed by a
+// value.
+func (n *completionNode) valueFlags() []string {
+	var names []string
+	for _, f := range n.flags {
+		if f.value {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// shellQuote quotes s for bash and zsh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote quotes s for fish.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "'", `\'`, -1)
+	return "'" + s + "'"
+}
+
+// The scripts of all the shells find the commands on the command line the
+// same way: they skip the flags, and the values of the flags that take one,
+// and stop at the first word that is not a command.
+
+func writeBashCompletion(w io.Writer, root *completionNode) {
+	fn := "_" + root.name
+	fmt.Fprintf(w, "# bash completion for %s, generated by %q.\n", root.name, root.name+" completion bash")
+	// The lists are of words, which names never contain spaces in.
+	writeList := func(name string, list func(*completionNode) []string) {
+		fmt.Fprintf(w, "\n%s_%s() {\n\tcase \"$1\" in\n", fn, name)
+		root.walk(func(n *completionNode) {
+			if words := list(n); len(words) > 0 {
+				fmt.Fprintf(w, "\t%q) echo %s ;;\n", n.path, shellQuote(strings.Join(words, " ")))
+			}
+		})
+		fmt.Fprint(w, "\tesac\n}\n")
+	}
+	writeList("commands", (*completionNode).commandNames)
+	writeList("flags", func(n *completionNode) []string {
+		var names []string
+		for _, f := range n.flags {
+			names = append(names, "-"+f.name)
+		}
+		return names
+	})
+	writeList("values", (*completionNode).valueFlags)
+	fmt.Fprintf(w, `
+%[1]s() {
+	local cur=${COMP_WORDS[COMP_CWORD]} cmdpath="" word i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		word=${COMP_WORDS[i]}
+		case $word in
+		-*=*) ;;
+		-*)
+			word=${word#-}
+			word=${word#-}
+			if [[ " $(%[1]s_values "$cmdpath") " == *" $word "* ]]; then
+				((i++))
+			fi
+			;;
+		*)
+			if [[ " $(%[1]s_commands "$cmdpath") " == *" $word "* ]]; then
+				cmdpath=${cmdpath:+$cmdpath }$word
+			else
+				return
+			fi
+			;;
+		esac
+	done
+	if ((i > COMP_CWORD)); then
+		return
+	fi
+	case $cur in
+	-*) COMPREPLY=($(compgen -W "$(%[1]s_flags "$cmdpath")" -- "$cur")) ;;
+	*) COMPREPLY=($(compgen -W "$(%[1]s_commands "$cmdpath")" -- "$cur")) ;;
+	esac
+}
+
+complete -o default -F %[1]s %[2]s
+`, fn, root.name)
+}
+
+func writeZshCompletion(w io.Writer, root *completionNode) {
+	fn := "_" + root.name
+	fmt.Fprintf(w, "#compdef %s\n# zsh completion for %s, generated by %q.\n", root.name, root.name, root.name+" completion zsh")
+	fmt.Fprintf(w, "\n%s_spec() {\n\tnames=() commands=() flags=() values=()\n\tcase \"$1\" in\n", fn)
+	root.walk(func(n *completionNode) {
+		fmt.Fprintf(w, "\t%q)\n", n.path)
+		if len(n.commands) > 0 {
+			fmt.Fprintf(w, "\t\tnames=(%s)\n", strings.Join(n.commandNames(), " "))
+			fmt.Fprint(w, "\t\tcommands=(\n")
+			for _, c := range n.commands {
+				fmt.Fprintf(w, "\t\t\t%s\n", shellQuote(c.name+":"+c.help))
+			}
+			fmt.Fprint(w, "\t\t)\n")
+		}
+		if len(n.flags) > 0 {
+			fmt.Fprint(w, "\t\tflags=(\n")
+			for _, f := range n.flags {
+				fmt.Fprintf(w, "\t\t\t%s\n", shellQuote("-"+f.name+":"+f.help))
+			}
+			fmt.Fprint(w, "\t\t)\n")
+		}
+		if values := n.valueFlags(); len(values) > 0 {
+			fmt.Fprintf(w, "\t\tvalues=(%s)\n", strings.Join(values, " "))
+		}
+		fmt.Fprint(w, "\t\t;;\n")
+	})
+	fmt.Fprint(w, "\tesac\n}\n")
+	fmt.Fprintf(w, `
+%[1]s() {
+	local cmdpath="" word i
+	local -a names commands flags values
+	%[1]s_spec ""
+	for ((i = 2; i < CURRENT; i++)); do
+		word=${words[i]}
+		case $word in
+		-*=*) ;;
+		-*)
+			word=${word#-}
+			word=${word#-}
+			if ((${values[(Ie)$word]})); then
+				((i++))
+			fi
+			;;
+		*)
+			if ((${names[(Ie)$word]})); then
+				cmdpath=${cmdpath:+$cmdpath }$word
+				%[1]s_spec "$cmdpath"
+			else
+				_files
+				return
+			fi
+			;;
+		esac
+	done
+	if ((i > CURRENT)); then
+		_files
+	elif [[ $PREFIX == -* ]]; then
+		_describe -t flags flag flags
+	elif ((${#commands})); then
+		_describe -t commands command commands
+	else
+		_files
+	fi
+}
+
+if [[ $funcstack[1] == %[1]s ]]; then
+	%[1]s "$@"
+else
+	compdef %[1]s %[2]s
+fi
+`, fn, root.name)
+}
+
+func writeFishCompletion(w io.Writer, root *completionNode) {
+	fn := "__" + root.name
+	fmt.Fprintf(w, "# fish completion for %s, generated by %q.\n", root.name, root.name+" completion fish")
+	writeList := func(name string, list func(*completionNode) []string) {
+		fmt.Fprintf(w, "\nfunction %s_%s\n\tswitch \"$argv[1]\"\n", fn, name)
+		root.walk(func(n *completionNode) {
+			if words := list(n); len(words) > 0 {
+				fmt.Fprintf(w, "\tcase %s\n\t\tprintf '%%s\\n' %s\n", fishQuote(n.path), strings.Join(words, " "))
+			}
+		})
+		fmt.Fprint(w, "\tend\nend\n")
+	}
+	writeList("commands", (*completionNode).commandNames)
+	writeList("values", (*completionNode).valueFlags)
+	fmt.Fprintf(w, `
+# %[1]s_path prints the commands before the token being completed, and fails
+# if the token is an argument of the commands or the value of a flag.
+function %[1]s_path
+	set -l tokens (commandline -opc)
+	set -e tokens[1]
+	set -l cmdpath
+	set -l value 0
+	for token in $tokens
+		if test $value = 1
+			set value 0
+			continue
+		end
+		switch $token
+		case '-*=*'
+		case '-*'
+			if contains -- (string replace -r -- '^--?' '' $token) (%[1]s_values "$cmdpath")
+				set value 1
+			end
+		case '*'
+			if contains -- $token (%[1]s_commands "$cmdpath")
+				set -a cmdpath $token
+			else
+				return 1
+			end
+		end
+	end
+	if test $value = 1
+		return 1
+	end
+	echo "$cmdpath"
+end
+
+function %[1]s_at
+	set -l cmdpath (%[1]s_path); or return
+	test "$cmdpath" = "$argv[1]"
+end
+`, fn)
+	fmt.Fprintln(w)
+	root.walk(func(n *completionNode) {
+		at := fishQuote(fmt.Sprintf("%s_at %q", fn, n.path))
+		for _, c := range n.commands {
+			fmt.Fprintf(w, "complete -c %s -n %s -f -a %s -d %s\n", root.name, at, c.name, fishQuote(c.help))
+		}
+		for _, f := range n.flags {
+			r := ""
+			if f.value {
+				r = " -r"
+			}
+			fmt.Fprintf(w, "complete -c %s -n %s -o %s%s -d %s\n", root.name, at, f.name, r, fishQuote(f.help))
+		}
+	})
+}
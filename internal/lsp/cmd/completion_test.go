@@ -0,0 +1,50 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/testenv"
+)
+
+func TestBashCompletion(t *testing.T) {
+	testenv.NeedsTool(t, "bash")
+
+	var script bytes.Buffer
+	writeBashCompletion(&script, newCompletionNode("", New("gopls", "", nil, nil)))
+	for _, test := range []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"gopls", "qu"}, "query"},
+		{[]string{"gopls", "-remote", "auto", "query", ""}, "definition"},
+		{[]string{"gopls", "query", "-j"}, "-json"},
+		{[]string{"gopls", "fix", "-a", "unusedparams", "-"}, "-a -d -w"},
+		{[]string{"gopls", "check", ""}, ""},
+		{[]string{"gopls", "-remote", ""}, ""},
+	} {
+		var words []string
+		for _, w := range test.words {
+			words = append(words, "'"+w+"'")
+		}
+		cmd := exec.Command("bash", "-c", script.String()+`
+COMP_WORDS=(`+strings.Join(words, " ")+`)
+COMP_CWORD=$((${#COMP_WORDS[@]} - 1))
+_gopls
+echo "${COMPREPLY[*]}"
+`)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", test.words, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != test.want {
+			t.Errorf("%v: got completions %q, want %q", test.words, got, test.want)
+		}
+	}
+}
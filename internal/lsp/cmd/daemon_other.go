@@ -0,0 +1,19 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package cmd
+
+import "os/exec"
+
+// daemonAddress returns the address of the daemon of the current user.
+// Unix domain sockets are not available everywhere, so the daemon listens
+// on a fixed local port.
+func daemonAddress() (network, address string) {
+	return "tcp", "localhost:37374"
+}
+
+func detach(cmd *exec.Cmd) {}
@@ -0,0 +1,27 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// daemonAddress returns the address of the daemon of the current user.
+func daemonAddress() (network, address string) {
+	return "unix", filepath.Join(os.TempDir(), fmt.Sprintf("gopls-daemon-%d.sock", os.Getuid()))
+}
+
+// detach makes cmd run in its own session, so that it is not stopped along
+// with the editor that started it.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
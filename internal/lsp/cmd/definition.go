@@ -22,8 +22,10 @@ import (
 
 // A Definition is the result of a 'definition' query.
 type Definition struct {
-	Span        span.Span `json:"span"`        // span of the definition
-	Description string    `json:"description"` // description of the denoted object
+	Span          span.Span `json:"span"`                    // span of the definition
+	Description   string    `json:"description"`             // description of the denoted object
+	Documentation string    `json:"documentation,omitempty"` // documentation of the object, as markdown
+	ImportPath    string    `json:"importPath,omitempty"`    // import path of the package of the object
 }
 
 // These constant is printed in the help, and then used in a test to verify the
@@ -47,12 +49,9 @@ func (d *definition) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprintf(f.Output(), `
 Example: show the definition of the identifier at syntax at offset %[1]v in this file (flag.FlagSet):
 
-$ gopls definition internal/lsp/cmd/definition.go:%[1]v:%[2]v
-$ gopls definition internal/lsp/cmd/definition.go:#%[3]v
-
-	gopls query definition flags are:
+  $ gopls definition internal/lsp/cmd/definition.go:%[1]v:%[2]v
+  $ gopls definition internal/lsp/cmd/definition.go:#%[3]v
 `, exampleLine, exampleColumn, exampleOffset)
-	f.PrintDefaults()
 }
 
 // Run performs the definition query as specified by args and prints the
@@ -62,13 +61,20 @@ func (d *definition) Run(ctx context.Context, args ...string) error {
 		return tool.CommandLineErrorf("definition expects 1 argument")
 	}
 	// Plaintext makes more sense for the command line.
+	// The hover is requested in its structured form, from which the
+	// description is formatted as the server would with these options.
+	hoverOptions := source.DefaultOptions
 	opts := d.query.app.options
 	d.query.app.options = func(o *source.Options) {
-		opts(o)
+		if opts != nil {
+			opts(o)
+		}
 		o.PreferredContentFormat = protocol.PlainText
 		if d.query.MarkdownSupported {
 			o.PreferredContentFormat = protocol.Markdown
 		}
+		hoverOptions = *o
+		o.HoverKind = source.Structured
 	}
 	conn, err := d.query.app.connect(ctx)
 	if err != nil {
@@ -117,14 +123,30 @@ func (d *definition) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return errors.Errorf("%v: %v", from, err)
 	}
+	// A remote server ignores the options of the command, and may not
+	// return a structured hover.
 	description := strings.TrimSpace(hover.Contents.Value)
+	var info source.HoverInformation
+	structured := json.Unmarshal([]byte(hover.Contents.Value), &info) == nil
+	if structured {
+		formatted, err := source.FormatHover(&info, hoverOptions)
+		if err != nil {
+			return errors.Errorf("%v: %v", from, err)
+		}
+		description = strings.TrimSpace(formatted)
+	}
 	var result interface{}
 	switch d.query.Emulate {
 	case "":
-		result = &Definition{
+		def := &Definition{
 			Span:        definition,
 			Description: description,
 		}
+		if structured {
+			def.Documentation = strings.TrimSpace(source.CommentToMarkdown(info.FullDocumentation))
+			def.ImportPath = info.ImportPath
+		}
+		result = def
 	case emulateGuru:
 		pos := span.New(definition.URI(), definition.Start(), definition.Start())
 		result = &guru.Definition{
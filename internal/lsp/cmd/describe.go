@@ -0,0 +1,79 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/tool"
+	errors "golang.org/x/xerrors"
+)
+
+// describe implements the describe verb for gopls.
+type describe struct {
+	app *Application
+}
+
+func (d *describe) Name() string  { return "describe" }
+func (d *describe) Usage() string { return "<position>" }
+func (d *describe) ShortHelp() string {
+	return "print the syntax and type information at a position as JSON"
+}
+func (d *describe) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Prints the kinds of the syntax nodes enclosing the position, the object
+denoted by the identifier there, its type and method set, and the package
+the file was checked in. The output is meant for tools, and for attaching
+to bug reports.
+
+Example:
+
+  $ gopls describe internal/lsp/cmd/describe.go:21:6
+  $ gopls describe internal/lsp/cmd/describe.go:#469
+`)
+}
+
+func (d *describe) Run(ctx context.Context, args ...string) error {
+	if len(args) != 1 {
+		return tool.CommandLineErrorf("describe expects 1 argument")
+	}
+	conn, err := d.app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.terminate(ctx)
+
+	from := span.Parse(args[0])
+	file := conn.AddFile(ctx, from.URI())
+	if file.err != nil {
+		return file.err
+	}
+	loc, err := file.mapper.Location(from)
+	if err != nil {
+		return err
+	}
+	result, err := conn.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command: "describe",
+		Arguments: []interface{}{protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+			Position:     loc.Range.Start,
+		}},
+	})
+	if err != nil {
+		return errors.Errorf("%v: %v", from, err)
+	}
+	data, err := json.MarshalIndent(result, "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", data)
+	return nil
+}
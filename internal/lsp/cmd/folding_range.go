@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 
@@ -16,6 +17,8 @@ import (
 
 // foldingRanges implements the folding_ranges verb for gopls
 type foldingRanges struct {
+	JSON bool `flag:"json" help:"print the folding ranges as JSON, with their kinds"`
+
 	app *Application
 }
 
@@ -24,11 +27,14 @@ func (r *foldingRanges) Usage() string     { return "<file>" }
 func (r *foldingRanges) ShortHelp() string { return "display selected file's folding ranges" }
 func (r *foldingRanges) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
+Prints the ranges of the file that the editor may fold, one per line, as
+startLine:startColumn-endLine:endColumn, or as JSON, with their kinds too.
+
 Example:
 
   $ gopls folding_ranges helper/helper.go
+  $ gopls folding_ranges -json helper/helper.go
 `)
-	f.PrintDefaults()
 }
 
 func (r *foldingRanges) Run(ctx context.Context, args ...string) error {
@@ -59,6 +65,24 @@ func (r *foldingRanges) Run(ctx context.Context, args ...string) error {
 		return err
 	}
 
+	if r.JSON {
+		out := []jsonFoldingRange{}
+		for _, r := range ranges {
+			out = append(out, jsonFoldingRange{
+				StartLine:   int(r.StartLine) + 1,
+				StartColumn: int(r.StartCharacter) + 1,
+				EndLine:     int(r.EndLine) + 1,
+				EndColumn:   int(r.EndCharacter),
+				Kind:        r.Kind,
+			})
+		}
+		data, err := json.MarshalIndent(out, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
 	for _, r := range ranges {
 		fmt.Printf("%v:%v-%v:%v\n",
 			r.StartLine+1,
@@ -70,3 +94,13 @@ func (r *foldingRanges) Run(ctx context.Context, args ...string) error {
 
 	return nil
 }
+
+// jsonFoldingRange is a folding range printed by folding_ranges -json, with
+// the same 1-indexed lines and columns as the text output.
+type jsonFoldingRange struct {
+	StartLine   int    `json:"startLine"`
+	StartColumn int    `json:"startColumn"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+	Kind        string `json:"kind,omitempty"`
+}
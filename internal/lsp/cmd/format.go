@@ -9,8 +9,11 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/span"
@@ -27,19 +30,22 @@ type format struct {
 }
 
 func (c *format) Name() string      { return "format" }
-func (c *format) Usage() string     { return "<filerange>" }
+func (c *format) Usage() string     { return "<filerange or directory>..." }
 func (c *format) ShortHelp() string { return "format the code according to the go standard" }
 func (c *format) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
-The arguments supplied may be simple file names, or ranges within files.
+The arguments supplied may be simple file names, ranges within files, or
+directories, whose Go files are formatted recursively, as by gofmt.
+The code is formatted as in the editor, by the server.
 
 Example: reformat this file:
 
   $ gopls format -w internal/lsp/cmd/check.go
 
-	gopls format flags are:
+Example: list the files of a directory that need formatting:
+
+  $ gopls format -l internal/lsp
 `)
-	f.PrintDefaults()
 }
 
 // Run performs the check on the files specified by args and prints the
@@ -49,59 +55,118 @@ func (c *format) Run(ctx context.Context, args ...string) error {
 		// no files, so no results
 		return nil
 	}
+	args, err := goFiles(args)
+	if err != nil {
+		return err
+	}
 	// now we ready to kick things off
 	conn, err := c.app.connect(ctx)
 	if err != nil {
 		return err
 	}
 	defer conn.terminate(ctx)
+	failed := 0
 	for _, arg := range args {
-		spn := span.Parse(arg)
-		file := conn.AddFile(ctx, spn.URI())
-		if file.err != nil {
-			return file.err
-		}
-		filename := spn.URI().Filename()
-		loc, err := file.mapper.Location(spn)
-		if err != nil {
-			return err
-		}
-		if loc.Range.Start != loc.Range.End {
-			return errors.Errorf("only full file formatting supported")
-		}
-		p := protocol.DocumentFormattingParams{
-			TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
-		}
-		edits, err := conn.Formatting(ctx, &p)
-		if err != nil {
-			return errors.Errorf("%v: %v", spn, err)
+		// Report the files that cannot be formatted, and carry on with the
+		// others, as gofmt does.
+		if err := c.formatFile(ctx, conn, arg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
 		}
-		sedits, err := source.FromProtocolEdits(file.mapper, edits)
-		if err != nil {
-			return errors.Errorf("%v: %v", spn, err)
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to format %d files", failed)
+	}
+	return nil
+}
+
+func (c *format) formatFile(ctx context.Context, conn *connection, arg string) error {
+	spn := span.Parse(arg)
+	file := conn.AddFile(ctx, spn.URI())
+	if file.err != nil {
+		return file.err
+	}
+	filename := spn.URI().Filename()
+	loc, err := file.mapper.Location(spn)
+	if err != nil {
+		return err
+	}
+	if loc.Range.Start != loc.Range.End {
+		return errors.Errorf("only full file formatting supported")
+	}
+	p := protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+	}
+	edits, err := conn.Formatting(ctx, &p)
+	if err != nil {
+		return errors.Errorf("%v: %v", spn, err)
+	}
+	sedits, err := source.FromProtocolEdits(file.mapper, edits)
+	if err != nil {
+		return errors.Errorf("%v: %v", spn, err)
+	}
+	formatted := diff.ApplyEdits(string(file.mapper.Content), sedits)
+	changed := formatted != string(file.mapper.Content)
+	printIt := true
+	if c.List {
+		printIt = false
+		if changed {
+			fmt.Println(filename)
 		}
-		formatted := diff.ApplyEdits(string(file.mapper.Content), sedits)
-		printIt := true
-		if c.List {
-			printIt = false
-			if len(edits) > 0 {
-				fmt.Println(filename)
+	}
+	if c.Write {
+		printIt = false
+		if changed {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return err
 			}
-		}
-		if c.Write {
-			printIt = false
-			if len(edits) > 0 {
-				ioutil.WriteFile(filename, []byte(formatted), 0644)
+			if err := ioutil.WriteFile(filename, []byte(formatted), info.Mode().Perm()); err != nil {
+				return err
 			}
 		}
-		if c.Diff {
-			printIt = false
-			u := diff.ToUnified(filename+".orig", filename, string(file.mapper.Content), sedits)
-			fmt.Print(u)
+	}
+	if c.Diff {
+		printIt = false
+		u := diff.ToUnified(filename+".orig", filename, string(file.mapper.Content), sedits)
+		fmt.Print(u)
+	}
+	if printIt {
+		fmt.Print(formatted)
+	}
+	return nil
+}
+
+// goFiles replaces the directories in args by the Go files they contain,
+// recursively, skipping the files and directories whose names start with a
+// dot, as gofmt does.
+func goFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil || !info.IsDir() {
+			// A file, or a range within a file.
+			files = append(files, arg)
+			continue
 		}
-		if printIt {
-			fmt.Print(formatted)
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != arg && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() && strings.HasSuffix(path, ".go") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	return files, nil
 }
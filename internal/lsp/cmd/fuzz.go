@@ -0,0 +1,113 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// A fuzzer mutates the parameters of requests, to look for the requests
+// that crash or hang the server. The mutations only depend on the seed of
+// the fuzzer and on the parameters, so that they can be reproduced.
+type fuzzer struct {
+	rand *rand.Rand
+}
+
+func newFuzzer(seed int64) *fuzzer {
+	return &fuzzer{rand: rand.New(rand.NewSource(seed))}
+}
+
+// mutate returns a copy of params in which one value has been replaced by
+// one that a client is unlikely to send: a negative or huge number, an
+// empty or huge string, null, or an object missing a field.
+func (f *fuzzer) mutate(params json.RawMessage) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(params, &v); err != nil {
+		return params
+	}
+	// Collect the setters of all the values, the root included, in a
+	// deterministic order.
+	var setters []func(interface{})
+	var values []interface{}
+	var walk func(v interface{}, set func(interface{}))
+	walk = func(v interface{}, set func(interface{})) {
+		setters = append(setters, set)
+		values = append(values, v)
+		switch v := v.(type) {
+		case map[string]interface{}:
+			var keys []string
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				k := k
+				walk(v[k], func(x interface{}) {
+					if x == deleted {
+						delete(v, k)
+					} else {
+						v[k] = x
+					}
+				})
+			}
+		case []interface{}:
+			for i := range v {
+				i := i
+				walk(v[i], func(x interface{}) {
+					if x == deleted {
+						x = nil
+					}
+					v[i] = x
+				})
+			}
+		}
+	}
+	walk(v, func(x interface{}) {
+		if x == deleted {
+			x = nil
+		}
+		v = x
+	})
+
+	i := f.rand.Intn(len(values))
+	setters[i](f.replacement(values[i]))
+	data, err := json.Marshal(v)
+	if err != nil {
+		return params
+	}
+	return data
+}
+
+// deleted is the replacement that deletes a field of an object.
+var deleted = new(int)
+
+// replacement returns a value to replace v with.
+func (f *fuzzer) replacement(v interface{}) interface{} {
+	if f.rand.Intn(8) == 0 {
+		return nil
+	}
+	var choices []interface{}
+	switch v := v.(type) {
+	case float64:
+		choices = []interface{}{-1.0, 0.0, v + 1, float64(1 << 31), 1e18}
+	case string:
+		choices = []interface{}{"", v[:len(v)/2], strings.Repeat("x", 1<<16), "file:///nonexistent.go"}
+	case bool:
+		choices = []interface{}{!v}
+	case []interface{}:
+		choices = []interface{}{[]interface{}{}, append(v, v...)}
+	case map[string]interface{}:
+		choices = []interface{}{map[string]interface{}{}}
+	case nil:
+		choices = []interface{}{0.0, "", map[string]interface{}{}}
+	}
+	// Only the fields of objects can be deleted; the elements of arrays are
+	// set to null instead.
+	choices = append(choices, deleted)
+	return choices[f.rand.Intn(len(choices))]
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestFuzzerMutate(t *testing.T) {
+	params := json.RawMessage(`{"textDocument":{"uri":"file:///a/a.go"},"position":{"line":3,"character":7},"context":null,"items":[1,2]}`)
+	a, b := newFuzzer(1), newFuzzer(1)
+	changed := 0
+	for i := 0; i < 100; i++ {
+		got, again := a.mutate(params), b.mutate(params)
+		if !bytes.Equal(got, again) {
+			t.Fatalf("mutations with the same seed differ: %s and %s", got, again)
+		}
+		var v interface{}
+		if err := json.Unmarshal(got, &v); err != nil {
+			t.Fatalf("mutation %s is not valid JSON: %v", got, err)
+		}
+		if !bytes.Equal(got, params) {
+			changed++
+		}
+	}
+	if changed < 50 {
+		t.Errorf("only %d of 100 mutations changed the parameters", changed)
+	}
+}
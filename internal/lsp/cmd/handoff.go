@@ -0,0 +1,329 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/lsp"
+	"github.com/jackie-feng/tools/internal/lsp/debug"
+	tellog "github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/tag"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// upgradeMethod is the method of the request that asks a daemon to
+	// hand its sessions over to the gopls executable now installed at its
+	// path, after an update of gopls.
+	upgradeMethod = "gopls/upgrade"
+
+	// handoffEnv is set in the environment of the daemon that takes the
+	// sessions over. It reads the handoffState from file descriptor 3,
+	// and inherits the listener as file descriptor 4, and the connection
+	// of the i-th session as file descriptor 5+i.
+	handoffEnv = "GOPLS_HANDOFF"
+
+	// handoffTimeout is how long a daemon waits for the requests in
+	// progress to complete before handing the sessions over.
+	handoffTimeout = 10 * time.Second
+)
+
+// errHandedOff is the error of a handoffStream once it has been stopped.
+var errHandedOff = errors.New("the connection was handed over to another process")
+
+// handoffState is what a daemon tells the one that takes its sessions over.
+type handoffState struct {
+	Sessions []handoffSession `json:"sessions"`
+}
+
+type handoffSession struct {
+	// Pending are the bytes read from the connection that are not part of
+	// a message delivered to the server.
+	Pending []byte `json:"pending,omitempty"`
+
+	// State is the state of the session, or nil if the editor has not
+	// initialized it yet.
+	State *lsp.SessionState `json:"state,omitempty"`
+}
+
+// handoffStream is a jsonrpc2.Stream that does not read its connection
+// ahead of the messages it returns, and can be stopped, so that the
+// connection can be handed over to another process at a message boundary.
+type handoffStream struct {
+	conn net.Conn
+
+	// pending are the bytes to read before those of conn.
+	// They are only used by Read, and by stop once Read has returned.
+	pending []byte
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newHandoffStream(conn net.Conn, pending []byte) *handoffStream {
+	return &handoffStream{conn: conn, pending: pending}
+}
+
+func (s *handoffStream) Read(ctx context.Context) ([]byte, int64, error) {
+	var read []byte // the bytes of the message read so far
+	r := &recordingReader{s: s, read: &read}
+	data, err := readMessage(r)
+	if err != nil {
+		if s.isStopped() {
+			// Keep what was read of the message for the next process.
+			s.pending = append(read, s.pending...)
+			return nil, 0, errHandedOff
+		}
+		return nil, 0, err
+	}
+	return data, int64(len(read)), nil
+}
+
+func (s *handoffStream) Write(ctx context.Context, data []byte) (int64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return 0, errHandedOff
+	}
+	msg := append([]byte(fmt.Sprintf("Content-Length: %v\r\n\r\n", len(data))), data...)
+	n, err := s.conn.Write(msg)
+	return int64(n), err
+}
+
+// stop makes the stream stop reading and writing. A Read in progress
+// returns errHandedOff, after which the bytes it read are in s.pending.
+func (s *handoffStream) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.conn.SetReadDeadline(time.Now())
+}
+
+func (s *handoffStream) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// recordingReader reads the pending bytes of a stream, then its
+// connection, and records the bytes it reads.
+type recordingReader struct {
+	s    *handoffStream
+	read *[]byte
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	var n int
+	var err error
+	if len(r.s.pending) > 0 {
+		n = copy(p, r.s.pending)
+		r.s.pending = r.s.pending[n:]
+	} else {
+		n, err = r.s.conn.Read(p)
+	}
+	*r.read = append(*r.read, p[:n]...)
+	return n, err
+}
+
+// upgrade hands the listener and the sessions of l over to a new daemon
+// running the gopls executable now at the path of this one, and makes
+// l.serve return once it is done. If it fails once it has stopped the
+// sessions, it closes their connections.
+func (l *listener) upgrade(ctx context.Context) (err error) {
+	l.mu.Lock()
+	if l.handoff != nil {
+		l.mu.Unlock()
+		return errors.Errorf("already upgrading")
+	}
+	l.handoff = make(chan struct{})
+	conns := make([]*remoteConn, 0, len(l.conns))
+	for c := range l.conns {
+		conns = append(conns, c)
+	}
+	l.mu.Unlock()
+
+	lnFile, err := fileOf(l.ln)
+	if err != nil {
+		l.mu.Lock()
+		l.handoff = nil
+		l.mu.Unlock()
+		return errors.Errorf("cannot hand the listener over: %v", err)
+	}
+	defer lnFile.Close()
+	defer func() {
+		if err != nil {
+			for _, c := range conns {
+				c.conn.Close()
+			}
+		}
+		close(l.handoff)
+	}()
+	if ln, ok := l.ln.(*net.UnixListener); ok {
+		// The new daemon listens on the same socket.
+		ln.SetUnlinkOnClose(false)
+	}
+	l.ln.Close()
+
+	var state handoffState
+	files := []*os.File{nil, lnFile}
+	for _, c := range conns {
+		session, file, err := c.handoff(ctx)
+		if err != nil {
+			tellog.Error(ctx, "cannot hand a session over", err)
+			c.conn.Close()
+			continue
+		}
+		defer file.Close()
+		state.Sessions = append(state.Sessions, *session)
+		files = append(files, file)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	files[0] = r
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), handoffEnv+"=1")
+	cmd.ExtraFiles = files
+	detach(cmd)
+	err = cmd.Start()
+	r.Close()
+	if err != nil {
+		return errors.Errorf("starting the new daemon: %v", err)
+	}
+	if err := json.NewEncoder(w).Encode(&state); err != nil {
+		return errors.Errorf("sending the sessions to the new daemon: %v", err)
+	}
+	tellog.Print(ctx, "handed the sessions over", tag.Of("PID", cmd.Process.Pid), tag.Of("Sessions", len(state.Sessions)))
+
+	// Close the views of the old sessions, now that nothing they do can
+	// reach the editors.
+	for _, c := range conns {
+		c.srv.Shutdown(ctx)
+	}
+	return nil
+}
+
+// handoff stops the session of c, once its requests in progress complete,
+// and returns its state and a copy of its connection.
+func (c *remoteConn) handoff(ctx context.Context) (*handoffSession, *os.File, error) {
+	c.stream.stop()
+	select {
+	case <-c.done:
+	case <-time.After(handoffTimeout):
+		return nil, nil, errors.Errorf("the session did not stop")
+	}
+	inflight := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(inflight)
+	}()
+	select {
+	case <-inflight:
+	case <-time.After(handoffTimeout):
+		tellog.Print(ctx, "handing a session over with requests in progress")
+	}
+	state, err := c.srv.SessionState(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := fileOf(c.conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &handoffSession{Pending: c.stream.pending, State: state}, file, nil
+}
+
+// fileOf returns a copy of the file descriptor of a listener or a
+// connection.
+func fileOf(x interface{}) (*os.File, error) {
+	f, ok := x.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.Errorf("%T has no file", x)
+	}
+	return f.File()
+}
+
+// takeOver sets up l to serve the listener and the sessions that a daemon
+// handed over to this process.
+func takeOver(ctx context.Context, l *listener) error {
+	os.Unsetenv(handoffEnv)
+	var state handoffState
+	stateFile := os.NewFile(3, "handoff")
+	err := json.NewDecoder(stateFile).Decode(&state)
+	stateFile.Close()
+	if err != nil {
+		return errors.Errorf("reading the handed over sessions: %v", err)
+	}
+	lnFile := os.NewFile(4, "listener")
+	l.ln, err = net.FileListener(lnFile)
+	lnFile.Close()
+	if err != nil {
+		return err
+	}
+	for i := range state.Sessions {
+		session := &state.Sessions[i]
+		f := os.NewFile(uintptr(5+i), "conn"+strconv.Itoa(i))
+		conn, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			tellog.Error(ctx, "cannot take a session over", err)
+			continue
+		}
+		l.mu.Lock()
+		l.clients++
+		l.mu.Unlock()
+		go l.run(ctx, conn, session)
+	}
+	tellog.Print(ctx, "took the sessions over", tag.Of("Sessions", len(state.Sessions)))
+	return nil
+}
+
+// upgradeDaemon asks the daemon on conn to hand its sessions over to the
+// gopls executable at its path, and connects to the new daemon.
+func upgradeDaemon(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	if err := call(ctx, conn, upgradeMethod, nil, nil); err != nil {
+		return nil, err
+	}
+	conn.Close()
+	network, address := daemonAddress()
+	deadline := time.Now().Add(daemonStartTimeout)
+	for {
+		conn, err := net.Dial(network, address)
+		if err == nil {
+			conn.SetDeadline(deadline)
+			resp, err := handshake(ctx, conn)
+			conn.SetDeadline(time.Time{})
+			if err == nil && resp.Version == debug.Version {
+				return conn, nil
+			}
+			conn.Close()
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("the upgraded gopls daemon did not answer")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
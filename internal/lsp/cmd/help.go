@@ -0,0 +1,51 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jackie-feng/tools/internal/tool"
+)
+
+// help implements the help verb for gopls.
+type help struct {
+	Markdown bool `flag:"markdown" help:"print the help of the command and of its subcommands as markdown"`
+	Man      bool `flag:"man" help:"print the help of the command and of its subcommands as a manual page"`
+
+	app *Application
+}
+
+func (h *help) Name() string      { return "help" }
+func (h *help) Usage() string     { return "[command...]" }
+func (h *help) ShortHelp() string { return "print the help of a command" }
+func (h *help) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+The command is named by the commands leading to it, such as "query definition",
+and defaults to gopls itself.
+
+Example: print the help of the definition query, and the manual page of gopls:
+
+  $ gopls help query definition
+  $ gopls help -man > gopls.1
+`)
+}
+
+// Run prints the help of the command named by args.
+func (h *help) Run(ctx context.Context, args ...string) error {
+	switch {
+	case h.Markdown && h.Man:
+		return tool.CommandLineErrorf("-markdown and -man cannot be used together")
+	case h.Markdown:
+		return tool.Markdown(os.Stdout, h.app, args...)
+	case h.Man:
+		return tool.Man(os.Stdout, h.app, args...)
+	default:
+		return tool.Help(os.Stdout, h.app, args...)
+	}
+}
@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"sort"
@@ -17,6 +18,8 @@ import (
 
 // highlight implements the highlight verb for gopls
 type highlight struct {
+	JSON bool `flag:"json" help:"print the highlights as JSON"`
+
 	app *Application
 }
 
@@ -25,15 +28,16 @@ func (r *highlight) Usage() string     { return "<position>" }
 func (r *highlight) ShortHelp() string { return "display selected identifier's highlights" }
 func (r *highlight) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
+Prints the spans of the identifiers that the editor highlights along with the
+identifier at the position, one per line, or as JSON, with their kinds too.
+
 Example:
 
   $ # 1-indexed location (:line:column or :#offset) of the target identifier
   $ gopls highlight helper/helper.go:8:6
   $ gopls highlight helper/helper.go:#53
-
-  gopls highlight flags are:
+  $ gopls highlight -json helper/helper.go:8:6
 `)
-	f.PrintDefaults()
 }
 
 func (r *highlight) Run(ctx context.Context, args ...string) error {
@@ -70,6 +74,7 @@ func (r *highlight) Run(ctx context.Context, args ...string) error {
 	}
 
 	var results []span.Span
+	kinds := make(map[span.Span]protocol.DocumentHighlightKind)
 	for _, h := range highlights {
 		l := protocol.Location{Range: h.Range}
 		s, err := file.mapper.Span(l)
@@ -77,14 +82,36 @@ func (r *highlight) Run(ctx context.Context, args ...string) error {
 			return err
 		}
 		results = append(results, s)
+		kinds[s] = h.Kind
 	}
 	// Sort results to make tests deterministic since DocumentHighlight uses a map.
 	sort.SliceStable(results, func(i, j int) bool {
 		return span.Compare(results[i], results[j]) == -1
 	})
 
+	if r.JSON {
+		out := []jsonHighlight{}
+		for _, s := range results {
+			out = append(out, jsonHighlight{
+				Span: fmt.Sprint(s),
+				Kind: fmt.Sprint(kinds[s]),
+			})
+		}
+		data, err := json.MarshalIndent(out, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
 	for _, s := range results {
 		fmt.Println(s)
 	}
 	return nil
 }
+
+// jsonHighlight is a document highlight printed by highlight -json.
+type jsonHighlight struct {
+	Span string `json:"span"`
+	Kind string `json:"kind"`
+}
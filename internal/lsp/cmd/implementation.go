@@ -25,15 +25,17 @@ func (i *implementation) Usage() string     { return "<position>" }
 func (i *implementation) ShortHelp() string { return "display selected identifier's implementation" }
 func (i *implementation) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
+Prints the locations of the concrete types that implement the selected
+interface, or of their methods that implement the selected interface
+method. For a concrete type or method, prints the locations of the
+interfaces, or interface methods, that it implements.
+
 Example:
 
   $ # 1-indexed location (:line:column or :#offset) of the target identifier
   $ gopls implementation helper/helper.go:8:6
   $ gopls implementation helper/helper.go:#53
-
-  gopls implementation flags are:
 `)
-	f.PrintDefaults()
 }
 
 func (i *implementation) Run(ctx context.Context, args ...string) error {
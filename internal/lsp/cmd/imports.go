@@ -10,7 +10,7 @@ import (
 	"fmt"
 	"io/ioutil"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/span"
@@ -34,10 +34,7 @@ func (t *imports) DetailedHelp(f *flag.FlagSet) {
 Example: update imports statements in a file:
 
   $ gopls imports -w internal/lsp/cmd/check.go
-
-gopls imports flags are:
 `)
-	f.PrintDefaults()
 }
 
 // Run performs diagnostic checks on the file specified and either;
@@ -30,7 +30,6 @@ func (v *version) Usage() string     { return "" }
 func (v *version) ShortHelp() string { return "print the gopls version information" }
 func (v *version) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), ``)
-	f.PrintDefaults()
 }
 
 // Run collects some basic information and then prepares an issue ready to
@@ -45,7 +44,6 @@ func (b *bug) Usage() string     { return "" }
 func (b *bug) ShortHelp() string { return "report a bug in gopls" }
 func (b *bug) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), ``)
-	f.PrintDefaults()
 }
 
 const goplsBugPrefix = "x/tools/gopls: "
@@ -0,0 +1,156 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/tool"
+)
+
+// inspect implements the inspect verb for gopls.
+type inspect struct {
+	JSON     bool `flag:"json" help:"print the inspection as JSON"`
+	Packages int  `flag:"packages" help:"number of packages to list for each view, the largest first; zero lists all of them"`
+
+	app *Application
+}
+
+func (i *inspect) Name() string  { return "inspect" }
+func (i *inspect) Usage() string { return "" }
+func (i *inspect) ShortHelp() string {
+	return "list the sessions, views, packages and open files of gopls"
+}
+func (i *inspect) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Loads the workspace in the current directory, or asks the server given by
+-remote, and lists the sessions that share its cache: the views of each
+session, with their packages and an estimate of the memory used by the
+type-checked ones, and the files open in the editor. It helps find out
+what a gopls that is stuck or uses too much memory is holding on to.
+
+The session of the inspect command itself is marked as such.
+
+Example: list the 5 largest packages of each view of the gopls daemon:
+
+  $ gopls -remote=auto inspect -packages=5
+`)
+}
+
+// inspectResult is the result of the inspect command of the server.
+type inspectResult struct {
+	source.CacheInspection
+	Memory struct {
+		HeapAlloc uint64 `json:"heapAlloc"`
+		Sys       uint64 `json:"sys"`
+	} `json:"memory"`
+}
+
+func (i *inspect) Run(ctx context.Context, args ...string) error {
+	if len(args) != 0 {
+		return tool.CommandLineErrorf("inspect expects no arguments")
+	}
+	conn, err := i.app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.terminate(ctx)
+
+	result, err := conn.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command: "inspect",
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result, "", "\t")
+	if err != nil {
+		return err
+	}
+	if i.JSON {
+		fmt.Fprintf(os.Stdout, "%s\n", data)
+		return nil
+	}
+	var r inspectResult
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	i.print(os.Stdout, &r)
+	return nil
+}
+
+// print prints the inspection r as an indented outline.
+func (i *inspect) print(w io.Writer, r *inspectResult) {
+	fmt.Fprintf(w, "heap %s, sys %s\n", formatBytes(int(r.Memory.HeapAlloc)), formatBytes(int(r.Memory.Sys)))
+	for _, s := range r.Sessions {
+		fmt.Fprintf(w, "session %s", s.ID)
+		if s.Current {
+			fmt.Fprint(w, " (this command)")
+		}
+		fmt.Fprintln(w)
+		for _, v := range s.Views {
+			fmt.Fprintf(w, "\tview %s %q in %s", v.ID, v.Name, v.Folder)
+			if v.Degraded {
+				fmt.Fprint(w, " (degraded)")
+			}
+			fmt.Fprintln(w)
+			checked, estimated := 0, 0
+			for _, p := range v.Packages {
+				if len(p.Modes) > 0 {
+					checked++
+				}
+				estimated += p.EstimatedBytes
+			}
+			fmt.Fprintf(w, "\t\t%d packages, %d type-checked, about %s\n", len(v.Packages), checked, formatBytes(estimated))
+			for j, p := range v.Packages {
+				if i.Packages > 0 && j == i.Packages {
+					fmt.Fprintf(w, "\t\t...\n")
+					break
+				}
+				var flags []string
+				if p.Workspace {
+					flags = append(flags, "workspace")
+				}
+				flags = append(flags, p.Modes...)
+				fmt.Fprintf(w, "\t\t%s\t%d files", p.PkgPath, p.Files)
+				if p.EstimatedBytes > 0 {
+					fmt.Fprintf(w, ", about %s", formatBytes(p.EstimatedBytes))
+				}
+				if len(flags) > 0 {
+					fmt.Fprintf(w, " (%s)", strings.Join(flags, ", "))
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		for _, o := range s.Overlays {
+			fmt.Fprintf(w, "\toverlay %s version %v, %s", o.URI, o.Version, formatBytes(o.Bytes))
+			if !o.Saved {
+				fmt.Fprint(w, " (unsaved)")
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
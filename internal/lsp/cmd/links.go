@@ -19,7 +19,8 @@ import (
 
 // links implements the links verb for gopls.
 type links struct {
-	JSON bool `flag:"json" help:"emit document links in JSON format"`
+	JSON  bool `flag:"json" help:"emit document links in JSON format"`
+	Spans bool `flag:"spans" help:"print every link, with the span of the text it links from"`
 
 	app *Application
 }
@@ -29,17 +30,20 @@ func (l *links) Usage() string     { return "<filename>" }
 func (l *links) ShortHelp() string { return "list links in a file" }
 func (l *links) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprintf(f.Output(), `
+Lists the targets of the links of a file, such as the documentation of the
+imported packages and the URLs in comments, once each, or every link with
+the span of the text it links from, with -spans.
+
 Example: list links contained within a file:
 
   $ gopls links internal/lsp/cmd/check.go
-
-gopls links flags are:
+  $ gopls links -spans internal/lsp/cmd/check.go
 `)
-	f.PrintDefaults()
 }
 
 // Run finds all the links within a document
 // - if -json is specified, outputs location range and uri
+// - if -spans is specified, prints the span and target of each link
 // - otherwise, prints the a list of unique links
 func (l *links) Run(ctx context.Context, args ...string) error {
 	if len(args) != 1 {
@@ -70,8 +74,22 @@ func (l *links) Run(ctx context.Context, args ...string) error {
 		enc.SetIndent("", "\t")
 		return enc.Encode(results)
 	}
+	if l.Spans {
+		for _, v := range results {
+			spn, err := file.mapper.Span(protocol.Location{URI: protocol.NewURI(uri), Range: v.Range})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%v %s\n", spn, v.Target)
+		}
+		return nil
+	}
+	seen := make(map[string]bool)
 	for _, v := range results {
-		fmt.Println(v.Target)
+		if !seen[v.Target] {
+			seen[v.Target] = true
+			fmt.Println(v.Target)
+		}
 	}
 	return nil
 }
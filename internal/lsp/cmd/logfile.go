@@ -0,0 +1,123 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultLogBackups is the number of rotated log files that are kept if
+// the -logfile.backups flag is not set.
+const defaultLogBackups = 3
+
+// rotatingFile is a log file that is renamed, and replaced with an empty
+// one, when it grows larger than maxSize bytes or older than maxAge.
+// The rotated files are named name.1, name.2, and so on, the most recent
+// first, and only the given number of backups are kept.
+// A file is never rotated in the middle of a write.
+type rotatingFile struct {
+	name    string
+	maxSize int64
+	maxAge  time.Duration
+	backups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func createRotatingFile(name string, maxSize int64, maxAge time.Duration, backups int) (*rotatingFile, error) {
+	if backups <= 0 {
+		backups = defaultLogBackups
+	}
+	r := &rotatingFile{
+		name:    name,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		backups: backups,
+	}
+	if err := r.create(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) create() error {
+	f, err := os.Create(r.name)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.size = 0
+	r.opened = time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.needsRotation(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) needsRotation(next int64) bool {
+	if r.maxSize > 0 && r.size+next > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && time.Since(r.opened) > r.maxAge
+}
+
+// rotate shifts the existing backups, dropping the oldest, renames the
+// current file to name.1, and starts a new one.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	os.Remove(r.backup(r.backups))
+	for i := r.backups - 1; i >= 1; i-- {
+		os.Rename(r.backup(i), r.backup(i+1))
+	}
+	if err := os.Rename(r.name, r.backup(1)); err != nil {
+		// Keep appending to the current file rather than losing its
+		// contents.
+		f, openErr := os.OpenFile(r.name, os.O_WRONLY|os.O_APPEND, 0666)
+		if openErr != nil {
+			r.f = nil
+			return openErr
+		}
+		r.f = f
+		r.opened = time.Now()
+		return nil
+	}
+	return r.create()
+}
+
+func (r *rotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.name, i)
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
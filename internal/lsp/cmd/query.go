@@ -37,15 +37,13 @@ func (q *query) ShortHelp() string {
 }
 func (q *query) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
-The mode argument determines the query to perform:
+The mode argument determines the query to perform.
 `)
-	for _, m := range q.modes() {
-		fmt.Fprintf(f.Output(), "  %s : %v\n", m.Name(), m.ShortHelp())
-	}
-	fmt.Fprint(f.Output(), `
-query flags are:
-`)
-	f.PrintDefaults()
+}
+
+// SubCommands implements tool.SubCommander returning the query modes.
+func (q *query) SubCommands() []tool.Application {
+	return q.modes()
 }
 
 // Run takes the args after command flag processing, and invokes the correct
@@ -54,13 +52,7 @@ func (q *query) Run(ctx context.Context, args ...string) error {
 	if len(args) == 0 {
 		return tool.CommandLineErrorf("query must be supplied a mode")
 	}
-	mode, args := args[0], args[1:]
-	for _, m := range q.modes() {
-		if m.Name() == mode {
-			return tool.Run(ctx, m, args) // pass errors up the chain
-		}
-	}
-	return tool.CommandLineErrorf("unknown command %v", mode)
+	return tool.RunSubCommand(ctx, q, args) // pass errors up the chain
 }
 
 // modes returns the set of modes supported by the query command.
@@ -32,10 +32,7 @@ Example:
   $ # 1-indexed location (:line:column or :#offset) of the target identifier
   $ gopls references helper/helper.go:8:6
   $ gopls references helper/helper.go:#53
-
-  gopls references flags are:
 `)
-	f.PrintDefaults()
 }
 
 func (r *references) Run(ctx context.Context, args ...string) error {
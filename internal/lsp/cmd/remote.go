@@ -0,0 +1,510 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/jsonrpc2"
+	"github.com/jackie-feng/tools/internal/lsp"
+	"github.com/jackie-feng/tools/internal/lsp/debug"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	tellog "github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/tag"
+	"github.com/jackie-feng/tools/internal/xcontext"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// autoRemote is the value of -remote, and of -listen, that selects the
+	// daemon shared by all the editors of the user.
+	autoRemote = "auto"
+
+	// daemonIdleTimeout is how long a daemon started by -remote=auto keeps
+	// running without clients.
+	daemonIdleTimeout = time.Minute
+
+	// daemonStartTimeout is how long a forwarder waits for the daemon it
+	// started to accept connections.
+	daemonStartTimeout = 5 * time.Second
+
+	// handshakeMethod is the method of the request that a client sends to
+	// a remote gopls before the messages of its session.
+	handshakeMethod = "gopls/handshake"
+)
+
+// handshakeRequest are the parameters of a handshake request.
+type handshakeRequest struct {
+	Version   string `json:"version"`
+	GoplsPath string `json:"goplsPath"`
+	// DebugAddr is the address of the debug server of the client, if any.
+	DebugAddr string `json:"debugAddr,omitempty"`
+}
+
+// handshakeResponse is the result of a handshake request.
+type handshakeResponse struct {
+	Version   string `json:"version"`
+	GoplsPath string `json:"goplsPath"`
+	PID       int    `json:"pid"`
+	// DebugAddr is the address of the debug server of the remote gopls,
+	// if any.
+	DebugAddr string `json:"debugAddr,omitempty"`
+	// Clients is the number of connections to the remote gopls, including
+	// the one of the handshake.
+	Clients int `json:"clients"`
+}
+
+// incompatibleDaemonError is the error of dialRemote when the daemon of
+// -remote=auto runs a different version of gopls.
+type incompatibleDaemonError struct {
+	resp *handshakeResponse
+}
+
+func (e *incompatibleDaemonError) Error() string {
+	return fmt.Sprintf("the gopls daemon (%s, pid %d) has version %s, not %s", e.resp.GoplsPath, e.resp.PID, e.resp.Version, debug.Version)
+}
+
+// parseAddress returns the network and address of a -listen or -remote
+// flag, which is either tcp:host:port, unix:path, autoRemote for the daemon,
+// or a TCP address.
+func parseAddress(addr string) (network, address string) {
+	if addr == autoRemote {
+		return daemonAddress()
+	}
+	for _, network := range []string{"tcp", "unix"} {
+		if strings.HasPrefix(addr, network+":") {
+			return network, addr[len(network)+1:]
+		}
+	}
+	return "tcp", addr
+}
+
+// listen listens on the given -listen address.
+func listen(addr string) (net.Listener, error) {
+	network, address := parseAddress(addr)
+	if network == "unix" {
+		// A socket left behind by a server that did not shut down cleanly
+		// would prevent the new one from listening.
+		if conn, err := net.Dial(network, address); err == nil {
+			conn.Close()
+			return nil, errors.Errorf("a gopls server is already listening on %s", address)
+		}
+		os.Remove(address)
+	}
+	return net.Listen(network, address)
+}
+
+// dialRemote connects to the remote gopls given by -remote and introduces
+// itself. If -remote is autoRemote and no daemon is running, it starts one;
+// if the daemon has another version, dialRemote returns an
+// *incompatibleDaemonError, and the caller should serve in process instead.
+func (app *Application) dialRemote(ctx context.Context) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if app.Remote == autoRemote {
+		conn, err = dialDaemon()
+	} else {
+		network, address := parseAddress(app.Remote)
+		conn, err = net.Dial(network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handshake(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Errorf("handshake with %s: %v", app.Remote, err)
+	}
+	if resp.Version != debug.Version {
+		if app.Remote == autoRemote {
+			exe, _ := os.Executable()
+			if resp.GoplsPath != exe {
+				conn.Close()
+				return nil, &incompatibleDaemonError{resp: resp}
+			}
+			// gopls was updated since the daemon started: have the daemon
+			// hand its sessions over to the new version.
+			tellog.Print(ctx, "upgrading the gopls daemon", tag.Of("Version", resp.Version), tag.Of("PID", resp.PID))
+			upgraded, err := upgradeDaemon(ctx, conn)
+			if err != nil {
+				conn.Close()
+				log.Printf("upgrading the gopls daemon: %v", err)
+				return nil, &incompatibleDaemonError{resp: resp}
+			}
+			return upgraded, nil
+		}
+		log.Printf("the remote gopls (%s, pid %d) has version %s, not %s", resp.GoplsPath, resp.PID, resp.Version, debug.Version)
+	}
+	tellog.Print(ctx, "connected to the remote gopls", tag.Of("PID", resp.PID), tag.Of("DebugAddr", resp.DebugAddr))
+	return conn, nil
+}
+
+// dialDaemon connects to the daemon, starting it if it is not running.
+func dialDaemon() (net.Conn, error) {
+	network, address := daemonAddress()
+	if conn, err := net.Dial(network, address); err == nil {
+		return conn, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	// The daemon runs this executable, so that it has the same version.
+	cmd := exec.Command(exe, "serve", "-listen="+autoRemote, fmt.Sprintf("-listen.timeout=%v", daemonIdleTimeout), "-logfile=auto", "-debug=localhost:0")
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Errorf("starting the gopls daemon: %v", err)
+	}
+	// Reap the daemon if it exits before this process, for instance
+	// because another forwarder started one at the same time.
+	go cmd.Wait()
+
+	deadline := time.Now().Add(daemonStartTimeout)
+	for {
+		conn, err := net.Dial(network, address)
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("connecting to the gopls daemon at %s: %v", address, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// handshake sends a handshake request on conn and reads the response.
+// It does not read past the response, so that conn can then be used for the
+// messages of the session.
+func handshake(ctx context.Context, conn net.Conn) (*handshakeResponse, error) {
+	exe, _ := os.Executable()
+	resp := &handshakeResponse{}
+	if err := call(ctx, conn, handshakeMethod, &handshakeRequest{Version: debug.Version, GoplsPath: exe, DebugAddr: debug.Address()}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// call sends a request on conn, reads the response, and decodes its result
+// into result, if it is not nil. It does not read past the response.
+func call(ctx context.Context, conn net.Conn, method string, params, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	raw := json.RawMessage(data)
+	id := jsonrpc2.ID{Name: method}
+	data, err = json.Marshal(&jsonrpc2.WireRequest{Method: method, Params: &raw, ID: &id})
+	if err != nil {
+		return err
+	}
+	if _, err := jsonrpc2.NewHeaderStream(conn, conn).Write(ctx, data); err != nil {
+		return err
+	}
+	data, err = readMessage(conn)
+	if err != nil {
+		return err
+	}
+	var msg jsonrpc2.WireResponse
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if msg.Result == nil {
+		return errors.Errorf("no result")
+	}
+	return json.Unmarshal(*msg.Result, result)
+}
+
+// readMessage reads a message with a Content-Length header from r, one byte
+// at a time.
+func readMessage(r io.Reader) ([]byte, error) {
+	var length int64
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		if b[0] != '\n' {
+			line = append(line, b[0])
+			continue
+		}
+		header := strings.TrimSpace(string(line))
+		line = line[:0]
+		if header == "" {
+			break
+		}
+		if strings.HasPrefix(header, "Content-Length:") {
+			n, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")), 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid header %q: %v", header, err)
+			}
+			length = n
+		}
+	}
+	if length <= 0 {
+		return nil, errors.Errorf("missing Content-Length header")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// listener runs a server for every connection accepted on a listener, sharing
+// a cache between them. If idle is positive, it stops listening once it has
+// had no connections for that long.
+type listener struct {
+	ln      net.Listener
+	cache   source.Cache
+	idle    time.Duration
+	prepare func(context.Context, *lsp.Server) *lsp.Server
+
+	mu      sync.Mutex
+	clients int
+	conns   map[*remoteConn]bool
+	timer   *time.Timer
+	expired bool
+	// handoff is closed once the sessions have been handed over to
+	// another daemon. It is nil unless l is upgrading.
+	handoff chan struct{}
+}
+
+// remoteConn is a connection to a listener, and the server of its session.
+type remoteConn struct {
+	conn   net.Conn
+	stream *handoffStream
+	srv    *lsp.Server
+
+	// done is closed once the server stops reading the connection.
+	done chan struct{}
+
+	// inflight counts the requests of the client that the server has not
+	// handled yet.
+	inflight sync.WaitGroup
+}
+
+func (l *listener) serve(ctx context.Context) error {
+	l.mu.Lock()
+	if l.clients == 0 {
+		l.startIdleTimer()
+	}
+	l.mu.Unlock()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			l.shutdown(ctx)
+		}
+	}()
+
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			l.mu.Lock()
+			expired, handoff := l.expired, l.handoff
+			l.mu.Unlock()
+			if handoff != nil {
+				<-handoff
+				return nil
+			}
+			if expired {
+				tellog.Print(ctx, "shutting down", tag.Of("Timeout", l.idle))
+				return nil
+			}
+			return err
+		}
+		l.mu.Lock()
+		l.clients++
+		if l.timer != nil {
+			l.timer.Stop()
+			l.timer = nil
+		}
+		l.mu.Unlock()
+		go l.run(ctx, conn, nil)
+	}
+}
+
+// shutdown stops listening and closes the views of all the sessions,
+// saving their state for the next start.
+func (l *listener) shutdown(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.handoff != nil {
+		return
+	}
+	for c := range l.conns {
+		c.stream.stop()
+		c.srv.Shutdown(ctx)
+	}
+	l.expired = true
+	l.ln.Close()
+}
+
+// run serves the session of conn. If the session was handed over by
+// another daemon, handoff is its state.
+func (l *listener) run(ctx context.Context, conn net.Conn, handoff *handoffSession) {
+	c := &remoteConn{conn: conn, done: make(chan struct{})}
+	var pending []byte
+	if handoff != nil {
+		pending = handoff.Pending
+	}
+	c.stream = newHandoffStream(conn, pending)
+	ctx, c.srv = lsp.NewServer(ctx, l.cache, c.stream)
+	c.srv = l.prepare(ctx, c.srv)
+	h := &remoteHandler{listener: l, conn: c}
+	if handoff != nil && handoff.State != nil {
+		h.restored = make(chan struct{})
+		go func() {
+			defer close(h.restored)
+			if err := c.srv.RestoreSession(ctx, handoff.State); err != nil {
+				tellog.Error(ctx, "failed to restore a session", err)
+			}
+		}()
+	}
+	c.srv.Conn.AddHandler(h)
+
+	l.mu.Lock()
+	if l.conns == nil {
+		l.conns = make(map[*remoteConn]bool)
+	}
+	l.conns[c] = true
+	l.mu.Unlock()
+
+	err := c.srv.Run(ctx)
+	close(c.done)
+	if err == errHandedOff {
+		// The connection belongs to the new daemon now.
+		return
+	}
+	conn.Close()
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.clients--
+	if l.clients == 0 {
+		l.startIdleTimer()
+	}
+	l.mu.Unlock()
+}
+
+// startIdleTimer stops the listener once it has been idle for l.idle.
+// l.mu must be held.
+func (l *listener) startIdleTimer() {
+	if l.idle <= 0 || l.handoff != nil {
+		return
+	}
+	l.timer = time.AfterFunc(l.idle, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.clients == 0 && l.handoff == nil {
+			l.expired = true
+			l.ln.Close()
+		}
+	})
+}
+
+// remoteHandler answers the handshake of a client, and ends its session,
+// rather than the process, when its editor exits.
+type remoteHandler struct {
+	jsonrpc2.EmptyHandler
+	listener *listener
+	conn     *remoteConn
+
+	// restored, if not nil, is closed once the session handed over by
+	// another daemon is restored. Messages are delivered after that.
+	restored chan struct{}
+}
+
+type inflightKeyType int
+
+const inflightKey = inflightKeyType(0)
+
+func (h *remoteHandler) Request(ctx context.Context, conn *jsonrpc2.Conn, direction jsonrpc2.Direction, r *jsonrpc2.WireRequest) context.Context {
+	if direction != jsonrpc2.Receive {
+		// The calls made while handling a request inherit its context.
+		return context.WithValue(ctx, inflightKey, nil)
+	}
+	h.conn.inflight.Add(1)
+	return context.WithValue(ctx, inflightKey, true)
+}
+
+func (h *remoteHandler) Done(ctx context.Context, err error) {
+	if ctx.Value(inflightKey) != nil {
+		h.conn.inflight.Done()
+	}
+}
+
+func (h *remoteHandler) Deliver(ctx context.Context, r *jsonrpc2.Request, delivered bool) bool {
+	if h.restored != nil {
+		<-h.restored
+	}
+	if delivered {
+		return false
+	}
+	switch r.Method {
+	case handshakeMethod:
+		var req handshakeRequest
+		if r.Params != nil {
+			if err := json.Unmarshal(*r.Params, &req); err != nil {
+				r.Reply(ctx, nil, jsonrpc2.NewErrorf(jsonrpc2.CodeParseError, "%v", err))
+				return true
+			}
+		}
+		if req.Version != debug.Version {
+			tellog.Print(ctx, "client of a different version", tag.Of("Version", req.Version), tag.Of("GoplsPath", req.GoplsPath))
+		}
+		tellog.Print(ctx, "client connected", tag.Of("GoplsPath", req.GoplsPath), tag.Of("DebugAddr", req.DebugAddr))
+		exe, _ := os.Executable()
+		h.listener.mu.Lock()
+		clients := h.listener.clients
+		h.listener.mu.Unlock()
+		r.Reply(ctx, &handshakeResponse{
+			Version:   debug.Version,
+			GoplsPath: exe,
+			PID:       os.Getpid(),
+			DebugAddr: debug.Address(),
+			Clients:   clients,
+		}, nil)
+		return true
+	case upgradeMethod:
+		r.Reply(ctx, nil, nil)
+		// The client closes the connection once it has the reply, so it
+		// has nothing to hand over.
+		h.conn.conn.Close()
+		go func() {
+			if err := h.listener.upgrade(xcontext.Detach(ctx)); err != nil {
+				tellog.Error(ctx, "failed to upgrade", err)
+			}
+		}()
+		return true
+	case "exit":
+		// The server would exit the process, and with it the sessions of
+		// the other clients.
+		h.conn.conn.Close()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/lsp"
+	"github.com/jackie-feng/tools/internal/lsp/cache"
+	"github.com/jackie-feng/tools/internal/lsp/debug"
+)
+
+func TestParseAddress(t *testing.T) {
+	for _, test := range []struct {
+		addr, network, address string
+	}{
+		{"localhost:4389", "tcp", "localhost:4389"},
+		{"tcp:localhost:4389", "tcp", "localhost:4389"},
+		{":4389", "tcp", ":4389"},
+		{"unix:/tmp/gopls.sock", "unix", "/tmp/gopls.sock"},
+	} {
+		network, address := parseAddress(test.addr)
+		if network != test.network || address != test.address {
+			t.Errorf("parseAddress(%q) = %s, %s; want %s, %s", test.addr, network, address, test.network, test.address)
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ln, err := listen("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &listener{
+		ln:      ln,
+		cache:   cache.New(nil),
+		idle:    100 * time.Millisecond,
+		prepare: func(ctx context.Context, srv *lsp.Server) *lsp.Server { return srv },
+	}
+	done := make(chan error)
+	go func() { done <- l.serve(ctx) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := handshake(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.PID != os.Getpid() || resp.Version != debug.Version || resp.Clients != 1 {
+		t.Errorf("got %+v, want pid %d, version %s and 1 client", resp, os.Getpid(), debug.Version)
+	}
+
+	// The listener shuts down once the last client is gone.
+	conn.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-ctx.Done():
+		t.Error("the listener did not shut down when idle")
+	}
+}
+
+func TestHandoffStream(t *testing.T) {
+	ctx := context.Background()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	s := newHandoffStream(server, nil)
+	go client.Write([]byte("Content-Length: 2\r\n\r\n{}Content-Length: 4\r\n\r\n{"))
+	data, _, err := s.Read(ctx)
+	if err != nil || string(data) != "{}" {
+		t.Fatalf("Read = %q, %v; want {}", data, err)
+	}
+
+	// Stopping the stream in the middle of a message keeps what was read of
+	// it for the next process.
+	partial := make(chan error)
+	go func() {
+		_, _, err := s.Read(ctx)
+		partial <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.stop()
+	if err := <-partial; err != errHandedOff {
+		t.Fatalf("Read after stop: got %v, want %v", err, errHandedOff)
+	}
+	if _, err := s.Write(ctx, []byte("{}")); err != errHandedOff {
+		t.Errorf("Write after stop: got %v, want %v", err, errHandedOff)
+	}
+
+	server.SetReadDeadline(time.Time{})
+	next := newHandoffStream(server, s.pending)
+	go client.Write([]byte("}}}"))
+	data, _, err = next.Read(ctx)
+	if err != nil || string(data) != "{}}}" {
+		t.Errorf("Read of the next stream = %q, %v; want {}}}", data, err)
+	}
+}
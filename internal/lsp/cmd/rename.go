@@ -13,7 +13,7 @@ import (
 	"path/filepath"
 	"sort"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/span"
@@ -40,10 +40,7 @@ Example:
   $ # 1-based location (:line:column or :#position) of the thing to change
   $ gopls rename helper/helper.go:8:6
   $ gopls rename helper/helper.go:#53
-
-	gopls rename flags are:
 `)
-	f.PrintDefaults()
 }
 
 // Run renames the specified identifier and either;
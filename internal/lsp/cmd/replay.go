@@ -0,0 +1,298 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/jsonrpc2"
+	"github.com/jackie-feng/tools/internal/lsp"
+	"github.com/jackie-feng/tools/internal/lsp/cache"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/tool"
+	errors "golang.org/x/xerrors"
+)
+
+// replay implements the replay verb for gopls.
+type replay struct {
+	Timing  bool   `flag:"timing" help:"wait between messages as long as the captured session did"`
+	Rewrite string `flag:"rewrite" help:"replace a prefix of the paths and URIs in the capture, as old=new"`
+	Fuzz    int    `flag:"fuzz" help:"after each request, send this many copies of it with mutated parameters, one at a time"`
+	Seed    int64  `flag:"seed" help:"seed of the mutations of -fuzz"`
+
+	app *Application
+}
+
+func (r *replay) Name() string      { return "replay" }
+func (r *replay) Usage() string     { return "<capture file>" }
+func (r *replay) ShortHelp() string { return "replay a session captured with serve -rpc.capture" }
+func (r *replay) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Sends the messages that the client sent in a captured session to a new
+server, in the same order, and prints how long each request took and
+whether it failed. The requests that the server sends to the client are
+answered with the responses of the captured session.
+
+The files of the workspace must be on disk; use -rewrite if they are not at
+the same place as when the session was captured. The final exit
+notification is not replayed.
+
+With -fuzz, each request is followed by copies of it in which one value of
+the parameters has been replaced, such as a position by a negative one,
+which are expected to fail but not to crash or hang the server. The copies
+are sent one at a time, and those that get no response within a minute are
+reported. The mutations only depend on -seed and on the capture, so with
+-v, which prints each copy before sending it, the request that crashed the
+server is the last one printed.
+
+Example:
+  $ gopls serve -rpc.capture=/tmp/gopls.capture
+  $ gopls replay -rewrite=/home/user/project=$PWD /tmp/gopls.capture
+  $ gopls -v replay -fuzz=10 -seed=1 /tmp/gopls.capture
+`)
+}
+
+func (r *replay) Run(ctx context.Context, args ...string) error {
+	if len(args) != 1 {
+		return tool.CommandLineErrorf("replay expects 1 argument")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	msgs, err := protocol.ReadCapture(f)
+	f.Close()
+	if err != nil {
+		return errors.Errorf("reading %s: %v", args[0], err)
+	}
+	if r.Rewrite != "" {
+		i := strings.Index(r.Rewrite, "=")
+		if i < 0 {
+			return tool.CommandLineErrorf("-rewrite expects old=new, got %q", r.Rewrite)
+		}
+		old, new := []byte(r.Rewrite[:i]), []byte(r.Rewrite[i+1:])
+		for _, msg := range msgs {
+			msg.Message = bytes.Replace(msg.Message, old, new, -1)
+		}
+	}
+
+	// Collect the responses of the client to the requests of the server,
+	// in order, by method.
+	serverMethods := make(map[string]string)
+	clientReplies := make(map[string][]*protocol.Combined)
+	for _, msg := range msgs {
+		c := &protocol.Combined{}
+		if err := json.Unmarshal(msg.Message, c); err != nil || c.ID == nil {
+			continue
+		}
+		switch {
+		case msg.Direction == protocol.ToClient && c.Method != "":
+			serverMethods[c.ID.String()] = c.Method
+		case msg.Direction == protocol.FromClient && c.Method == "":
+			method := serverMethods[c.ID.String()]
+			clientReplies[method] = append(clientReplies[method], c)
+		}
+	}
+
+	// Run a server in this process, connected through pipes.
+	cr, sw, _ := os.Pipe()
+	sr, cw, _ := os.Pipe()
+	go func() {
+		ctx, srv := lsp.NewServer(ctx, cache.New(r.app.options), jsonrpc2.NewHeaderStream(sr, sw))
+		srv.Run(ctx)
+	}()
+	client := jsonrpc2.NewHeaderStream(cr, cw)
+
+	var (
+		mu       sync.Mutex
+		pending  = make(map[string]*replayCall)
+		wg       sync.WaitGroup
+		requests int
+		failed   int
+		fuzzed   int
+		fuzzFail int
+	)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			data, _, err := client.Read(ctx)
+			if err != nil {
+				return
+			}
+			c := &protocol.Combined{}
+			if err := json.Unmarshal(data, c); err != nil {
+				continue
+			}
+			switch {
+			case c.ID != nil && c.Method != "":
+				// A request of the server: reply as the client did.
+				mu.Lock()
+				reply := &jsonrpc2.WireResponse{ID: c.ID}
+				if replies := clientReplies[c.Method]; len(replies) > 0 {
+					reply.Result, reply.Error = replies[0].Result, replies[0].Error
+					clientReplies[c.Method] = replies[1:]
+				} else {
+					null := json.RawMessage("null")
+					reply.Result = &null
+				}
+				mu.Unlock()
+				data, err := json.Marshal(reply)
+				if err == nil {
+					client.Write(ctx, data)
+				}
+			case c.ID != nil:
+				mu.Lock()
+				call := pending[c.ID.String()]
+				delete(pending, c.ID.String())
+				if call != nil && c.Error != nil {
+					if call.fuzzed {
+						fuzzFail++
+					} else {
+						failed++
+					}
+				}
+				mu.Unlock()
+				if call == nil {
+					continue
+				}
+				if call.fuzzed {
+					if r.app.Verbose && c.Error != nil {
+						fmt.Printf("%s %v: %v (error: %v)\n", call.method, c.ID, time.Since(call.start), c.Error)
+					}
+					close(call.done)
+					continue
+				}
+				if c.Error != nil {
+					fmt.Printf("%s %v: %v (error: %v)\n", call.method, c.ID, time.Since(call.start), c.Error)
+				} else {
+					fmt.Printf("%s %v: %v\n", call.method, c.ID, time.Since(call.start))
+				}
+				wg.Done()
+			case r.app.Verbose:
+				fmt.Printf("%s\n", c.Method)
+			}
+		}
+	}()
+
+	// fuzzRequest sends the mutated copies of the request c, and waits for
+	// their responses. It reports whether the server is still running.
+	fuzz := newFuzzer(r.Seed)
+	fuzzRequest := func(c *protocol.Combined) (bool, error) {
+		if c.Params == nil || c.Method == "initialize" || c.Method == "shutdown" {
+			return true, nil
+		}
+		for i := 0; i < r.Fuzz; i++ {
+			params := json.RawMessage(fuzz.mutate(*c.Params))
+			mu.Lock()
+			fuzzed++
+			id := &jsonrpc2.ID{Name: fmt.Sprintf("fuzz-%d", fuzzed)}
+			call := &replayCall{method: c.Method, start: time.Now(), fuzzed: true, done: make(chan struct{})}
+			pending[id.String()] = call
+			mu.Unlock()
+			data, err := json.Marshal(&jsonrpc2.WireRequest{Method: c.Method, Params: &params, ID: id})
+			if err != nil {
+				return false, err
+			}
+			if r.app.Verbose {
+				fmt.Printf("%s %v: sending %s\n", c.Method, id, params)
+			}
+			if _, err := client.Write(ctx, data); err != nil {
+				return false, err
+			}
+			select {
+			case <-call.done:
+			case <-closed:
+				return false, nil
+			case <-time.After(fuzzTimeout):
+				fmt.Printf("%s %v: no response after %v to %s\n", c.Method, id, fuzzTimeout, params)
+			}
+		}
+		return true, nil
+	}
+
+	var last time.Time
+	for _, msg := range msgs {
+		if msg.Direction != protocol.FromClient {
+			continue
+		}
+		c := &protocol.Combined{}
+		if err := json.Unmarshal(msg.Message, c); err != nil || c.Method == "" {
+			continue // a reply to the server, sent when it asks
+		}
+		if c.Method == "exit" {
+			// The server would exit this process.
+			break
+		}
+		if r.Timing && !last.IsZero() {
+			time.Sleep(msg.Time.Sub(last))
+		}
+		last = msg.Time
+		if c.ID != nil {
+			wg.Add(1)
+			mu.Lock()
+			pending[c.ID.String()] = &replayCall{method: c.Method, start: time.Now()}
+			requests++
+			mu.Unlock()
+		}
+		if _, err := client.Write(ctx, msg.Message); err != nil {
+			return err
+		}
+		if c.ID != nil && r.Fuzz > 0 {
+			running, err := fuzzRequest(c)
+			if err != nil {
+				return err
+			}
+			if !running {
+				break
+			}
+		}
+	}
+
+	// Wait for the responses to all the requests.
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-closed:
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	unanswered, fuzzUnanswered := 0, 0
+	for _, call := range pending {
+		if call.fuzzed {
+			fuzzUnanswered++
+		} else {
+			unanswered++
+		}
+	}
+	fmt.Printf("replayed %d requests: %d failed, %d unanswered\n", requests, failed, unanswered)
+	if r.Fuzz > 0 {
+		fmt.Printf("fuzzed %d requests: %d failed, %d unanswered\n", fuzzed, fuzzFail, fuzzUnanswered)
+	}
+	return nil
+}
+
+// fuzzTimeout is how long replay -fuzz waits for the response to a mutated
+// request before it reports it and sends the next one.
+const fuzzTimeout = time.Minute
+
+type replayCall struct {
+	method string
+	start  time.Time
+	fuzzed bool          // a mutated copy of a request, sent by -fuzz
+	done   chan struct{} // closed when a fuzzed request is answered
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/tool"
+	errors "golang.org/x/xerrors"
+)
+
+// semtok implements the semtok verb for gopls.
+type semtok struct {
+	app *Application
+}
+
+func (s *semtok) Name() string      { return "semtok" }
+func (s *semtok) Usage() string     { return "<file>" }
+func (s *semtok) ShortHelp() string { return "print the semantic tokens of a file" }
+func (s *semtok) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Decodes the semantic tokens of the file that the server reports for
+highlighting, and prints them one per line, as line:startColumn-endColumn,
+followed by the type of the token and its comma-separated modifiers.
+
+Example:
+
+  $ gopls semtok helper/helper.go
+`)
+}
+
+func (s *semtok) Run(ctx context.Context, args ...string) error {
+	if len(args) != 1 {
+		return tool.CommandLineErrorf("semtok expects 1 argument (file)")
+	}
+	conn, err := s.app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.terminate(ctx)
+
+	from := span.Parse(args[0])
+	file := conn.AddFile(ctx, from.URI())
+	if file.err != nil {
+		return file.err
+	}
+	result, err := conn.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   "semtok",
+		Arguments: []interface{}{protocol.NewURI(from.URI())},
+	})
+	if err != nil {
+		return errors.Errorf("%v: %v", from, err)
+	}
+	// The result arrives as a generic JSON value.
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	var encoded source.SemanticTokens
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return errors.Errorf("invalid semantic tokens: %v", err)
+	}
+	tokens, err := encoded.Decode()
+	if err != nil {
+		return err
+	}
+	for _, tok := range tokens {
+		spn, err := file.mapper.RangeSpan(tok.Range)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d:%d-%d %s", spn.Start().Line(), spn.Start().Column(), spn.End().Column(), tok.Type)
+		if len(tok.Modifiers) > 0 {
+			fmt.Printf(" %s", strings.Join(tok.Modifiers, ","))
+		}
+		fmt.Println()
+	}
+	return nil
+}
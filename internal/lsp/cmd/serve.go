@@ -14,6 +14,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/jackie-feng/tools/internal/jsonrpc2"
@@ -22,20 +23,42 @@ import (
 	"github.com/jackie-feng/tools/internal/lsp/debug"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/telemetry/export"
+	tellog "github.com/jackie-feng/tools/internal/telemetry/log"
 	"github.com/jackie-feng/tools/internal/telemetry/trace"
 	"github.com/jackie-feng/tools/internal/tool"
 	errors "golang.org/x/xerrors"
 )
 
+// defaultWatchdogStuck is how long a request may be in progress before the
+// watchdog dumps the goroutines and heap. It is long enough that only a
+// stuck request trips it.
+const defaultWatchdogStuck = 10 * time.Minute
+
 // Serve is a struct that exposes the configurable parts of the LSP server as
 // flags, in the right form for tool.Main to consume.
 type Serve struct {
 	Logfile string `flag:"logfile" help:"filename to log to. if value is \"auto\", then logging to a default output file is enabled"`
 	Mode    string `flag:"mode" help:"no effect"`
 	Port    int    `flag:"port" help:"port on which to run gopls for debugging purposes"`
-	Address string `flag:"listen" help:"address on which to listen for remote connections"`
+	Address string `flag:"listen" help:"address on which to listen for remote connections: tcp:host:port, unix:path, or auto for the address of the shared daemon"`
 	Trace   bool   `flag:"rpc.trace" help:"print the full rpc trace in lsp inspector format"`
 	Debug   string `flag:"debug" help:"serve debug information on the supplied address"`
+	Capture string `flag:"rpc.capture" help:"record every message of the session to this file, for gopls replay"`
+
+	Idle time.Duration `flag:"listen.timeout" help:"when listening, shut down after having no connections for this long"`
+
+	LogFormat  string        `flag:"logfile.format" help:"format of the log file: text, or json for one JSON object per event or request"`
+	LogMaxSize int           `flag:"logfile.maxsize" help:"rotate the log file when it grows larger than this many megabytes"`
+	LogMaxAge  time.Duration `flag:"logfile.maxage" help:"rotate the log file when it is older than this"`
+	LogBackups int           `flag:"logfile.backups" help:"number of rotated log files to keep (default 3)"`
+
+	SlowRequests time.Duration `flag:"profile.slow" help:"capture a CPU profile and goroutine dump of requests that take longer than this"`
+	ProfileDir   string        `flag:"profile.dir" help:"directory in which to store the profiles of slow requests, and the watchdog dumps"`
+
+	WatchdogStuck time.Duration `flag:"watchdog.stuck" help:"dump the goroutines and heap when a request is in progress for longer than this, or 0 to disable"`
+	WatchdogHeap  int           `flag:"watchdog.heap" help:"dump the goroutines and heap when the heap grows larger than this many megabytes"`
+	WatchdogExit  bool          `flag:"watchdog.exit" help:"exit after a watchdog dump, so that the editor restarts gopls rather than hang"`
 
 	app *Application
 }
@@ -50,9 +73,12 @@ func (s *Serve) DetailedHelp(f *flag.FlagSet) {
 The server communicates using JSONRPC2 on stdin and stdout, and is intended to be run directly as
 a child of an editor process.
 
-gopls server flags are:
+With -listen, the server instead accepts connections on a TCP address, such as
+-listen=tcp:localhost:4389, or on a unix domain socket, such as
+-listen=unix:/tmp/gopls.sock. Each connection gets its own session, with its
+own workspace folders and unsaved files, but the sessions share the cache of
+parsed and type-checked files. Editors connect with gopls -remote=<address>.
 `)
-	f.PrintDefaults()
 }
 
 // Run configures a server based on the flags, and then runs it.
@@ -61,35 +87,76 @@ func (s *Serve) Run(ctx context.Context, args ...string) error {
 	if len(args) > 0 {
 		return tool.CommandLineErrorf("server does not take arguments, got %v", args)
 	}
-	out := os.Stderr
+	var out io.Writer = os.Stderr
 	if s.Logfile != "" {
 		filename := s.Logfile
 		if filename == "auto" {
 			filename = filepath.Join(os.TempDir(), fmt.Sprintf("gopls-%d.log", os.Getpid()))
 		}
-		f, err := os.Create(filename)
+		f, err := createRotatingFile(filename, int64(s.LogMaxSize)<<20, s.LogMaxAge, s.LogBackups)
 		if err != nil {
 			return errors.Errorf("Unable to create log file: %v", err)
 		}
 		defer f.Close()
-		log.SetOutput(io.MultiWriter(os.Stderr, f))
-		out = f
+		switch s.LogFormat {
+		case "", "text":
+			log.SetOutput(io.MultiWriter(os.Stderr, f))
+			out = f
+		case "json":
+			export.AddExporters(export.JSONLogWriter(f, telemetry.Method, telemetry.RPCID, telemetry.URI, telemetry.File))
+			// The records have their own timestamps.
+			log.SetFlags(0)
+			log.SetOutput(io.MultiWriter(os.Stderr, jsonLogLines{}))
+		default:
+			return tool.CommandLineErrorf("unknown log format %q", s.LogFormat)
+		}
 	}
 
 	debug.Serve(ctx, s.Debug)
+	profileDir := s.ProfileDir
+	if profileDir == "" {
+		profileDir = filepath.Join(os.TempDir(), fmt.Sprintf("gopls-%d-profiles", os.Getpid()))
+	}
+	if s.SlowRequests > 0 {
+		if err := debug.ProfileSlowRequests(s.SlowRequests, profileDir); err != nil {
+			return errors.Errorf("Unable to create profile directory: %v", err)
+		}
+	}
+	debug.StartWatchdog(profileDir, s.WatchdogStuck, uint64(s.WatchdogHeap)<<20, s.WatchdogExit)
 
 	if s.app.Remote != "" {
-		return s.forward()
+		err := s.forward(ctx)
+		if _, ok := err.(*incompatibleDaemonError); !ok {
+			return err
+		}
+		log.Printf("%v, serving in this process", err)
 	}
 
 	prepare := func(ctx context.Context, srv *lsp.Server) *lsp.Server {
 		srv.Conn.AddHandler(&handler{})
 		return srv
 	}
-	run := func(ctx context.Context, srv *lsp.Server) { go prepare(ctx, srv).Run(ctx) }
 	if s.Address != "" {
-		return lsp.RunServerOnAddress(ctx, cache.New(s.app.options), s.Address, run)
+		l := &listener{
+			cache:   cache.New(s.app.options),
+			idle:    s.Idle,
+			prepare: prepare,
+		}
+		if os.Getenv(handoffEnv) != "" {
+			// This daemon takes the sessions of an older one over.
+			if err := takeOver(ctx, l); err != nil {
+				return err
+			}
+		} else {
+			ln, err := listen(s.Address)
+			if err != nil {
+				return err
+			}
+			l.ln = ln
+		}
+		return l.serve(ctx)
 	}
+	run := func(ctx context.Context, srv *lsp.Server) { go prepare(ctx, srv).Run(ctx) }
 	if s.Port != 0 {
 		return lsp.RunServerOnPort(ctx, cache.New(s.app.options), s.Port, run)
 	}
@@ -97,12 +164,31 @@ func (s *Serve) Run(ctx context.Context, args ...string) error {
 	if s.Trace {
 		stream = protocol.LoggingStream(stream, out)
 	}
+	if s.Capture != "" {
+		f, err := os.Create(s.Capture)
+		if err != nil {
+			return errors.Errorf("Unable to create capture file: %v", err)
+		}
+		defer f.Close()
+		stream = protocol.CaptureStream(stream, f)
+	}
 	ctx, srv := lsp.NewServer(ctx, cache.New(s.app.options), stream)
 	return prepare(ctx, srv).Run(ctx)
 }
 
-func (s *Serve) forward() error {
-	conn, err := net.Dial("tcp", s.app.Remote)
+// jsonLogLines sends the output of the standard logger to the JSON log,
+// one event per line.
+type jsonLogLines struct{}
+
+func (jsonLogLines) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		tellog.Print(context.Background(), line)
+	}
+	return len(p), nil
+}
+
+func (s *Serve) forward(ctx context.Context) error {
+	conn, err := s.app.dialRemote(ctx)
 	if err != nil {
 		return err
 	}
@@ -131,6 +217,7 @@ type rpcStats struct {
 	start      time.Time
 	delivering func()
 	close      func()
+	profiled   func()
 }
 
 type statsKeyType int
@@ -171,6 +258,10 @@ func (h *handler) Request(ctx context.Context, conn *jsonrpc2.Conn, direction js
 	)
 	telemetry.Started.Record(ctx, 1)
 	_, stats.delivering = trace.StartSpan(ctx, "queued")
+	stats.profiled = func() {}
+	if direction == jsonrpc2.Receive && r.ID != nil {
+		stats.profiled = debug.StartRequest(r.Method, fmt.Sprint(r.ID))
+	}
 	return ctx
 }
 
@@ -182,12 +273,14 @@ func (h *handler) Done(ctx context.Context, err error) {
 	stats := h.getStats(ctx)
 	if err != nil {
 		ctx = telemetry.StatusCode.With(ctx, "ERROR")
+		ctx = telemetry.StatusMessage.With(ctx, err.Error())
 	} else {
 		ctx = telemetry.StatusCode.With(ctx, "OK")
 	}
 	elapsedTime := time.Since(stats.start)
 	latencyMillis := float64(elapsedTime) / float64(time.Millisecond)
 	telemetry.Latency.Record(ctx, latencyMillis)
+	stats.profiled()
 	stats.close()
 }
 
@@ -214,8 +307,9 @@ func (h *handler) getStats(ctx context.Context) *rpcStats {
 			method = "???"
 		}
 		stats = &rpcStats{
-			method: method,
-			close:  func() {},
+			method:   method,
+			close:    func() {},
+			profiled: func() {},
 		}
 	}
 	return stats
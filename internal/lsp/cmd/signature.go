@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 
@@ -16,6 +17,8 @@ import (
 
 // signature implements the signature verb for gopls
 type signature struct {
+	JSON bool `flag:"json" help:"print the signature, its parameters and the active parameter as JSON"`
+
 	app *Application
 }
 
@@ -24,15 +27,17 @@ func (r *signature) Usage() string     { return "<position>" }
 func (r *signature) ShortHelp() string { return "display selected identifier's signature" }
 func (r *signature) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
+Prints the signature of the function called by the call enclosing the
+position, followed by its documentation, or as JSON, with its parameters
+and the index of the parameter at the position too.
+
 Example:
 
   $ # 1-indexed location (:line:column or :#offset) of the target identifier
   $ gopls signature helper/helper.go:8:6
   $ gopls signature helper/helper.go:#53
-
-  gopls signature flags are:
+  $ gopls signature -json helper/helper.go:8:6
 `)
-	f.PrintDefaults()
 }
 
 func (r *signature) Run(ctx context.Context, args ...string) error {
@@ -79,6 +84,26 @@ func (r *signature) Run(ctx context.Context, args ...string) error {
 	// there is only ever one possible signature,
 	// see toProtocolSignatureHelp in lsp/signature_help.go
 	signature := s.Signatures[0]
+	if r.JSON {
+		out := jsonSignature{
+			Label:           signature.Label,
+			Documentation:   signature.Documentation,
+			Parameters:      []jsonParameter{},
+			ActiveParameter: int(s.ActiveParameter),
+		}
+		for _, p := range signature.Parameters {
+			out.Parameters = append(out.Parameters, jsonParameter{
+				Label:         p.Label,
+				Documentation: p.Documentation,
+			})
+		}
+		data, err := json.MarshalIndent(out, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
 	fmt.Printf("%s\n", signature.Label)
 	if signature.Documentation != "" {
 		fmt.Printf("\n%s\n", signature.Documentation)
@@ -86,3 +111,17 @@ func (r *signature) Run(ctx context.Context, args ...string) error {
 
 	return nil
 }
+
+// jsonSignature is a signature printed by signature -json.
+type jsonSignature struct {
+	Label           string          `json:"label"`
+	Documentation   string          `json:"documentation,omitempty"`
+	Parameters      []jsonParameter `json:"parameters"`
+	ActiveParameter int             `json:"activeParameter"`
+}
+
+// jsonParameter is a parameter of a jsonSignature.
+type jsonParameter struct {
+	Label         string `json:"label"`
+	Documentation string `json:"documentation,omitempty"`
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/tool"
+)
+
+// stats implements the stats verb for gopls.
+type stats struct {
+	app *Application
+}
+
+func (s *stats) Name() string      { return "stats" }
+func (s *stats) Usage() string     { return "" }
+func (s *stats) ShortHelp() string { return "print the cache and memory usage of gopls as JSON" }
+func (s *stats) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Loads the workspace in the current directory, or asks the server given by
+-remote, and prints the number of loaded packages, files, and cache entries
+of each view, along with the memory used by the process.
+
+Example:
+  $ gopls -remote=localhost:4389 stats
+`)
+}
+
+func (s *stats) Run(ctx context.Context, args ...string) error {
+	if len(args) != 0 {
+		return tool.CommandLineErrorf("stats expects no arguments")
+	}
+	conn, err := s.app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.terminate(ctx)
+
+	result, err := conn.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command: "stats",
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result, "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", data)
+	return nil
+}
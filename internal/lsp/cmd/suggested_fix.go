@@ -9,9 +9,12 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/span"
@@ -21,34 +24,49 @@ import (
 
 // suggestedfix implements the fix verb for gopls.
 type suggestedfix struct {
-	Diff  bool `flag:"d" help:"display diffs instead of rewriting files"`
-	Write bool `flag:"w" help:"write result to (source) file instead of stdout"`
-	All   bool `flag:"a" help:"apply all fixes, not just preferred fixes"`
+	Diff      bool   `flag:"d" help:"display diffs instead of rewriting files"`
+	Write     bool   `flag:"w" help:"write result to (source) file instead of stdout"`
+	Analyzers string `flag:"a" help:"comma-separated list of the analyzers whose fixes to apply (default all)"`
 
 	app *Application
 }
 
 func (s *suggestedfix) Name() string      { return "fix" }
-func (s *suggestedfix) Usage() string     { return "<filename>" }
+func (s *suggestedfix) Usage() string     { return "<filename or package pattern>..." }
 func (s *suggestedfix) ShortHelp() string { return "apply suggested fixes" }
 func (s *suggestedfix) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprintf(f.Output(), `
 Example: apply suggested fixes for this file:
 
-  $ gopls fix -w internal/lsp/cmd/check.go
+  $ gopls fix -w internal/lsp/cmd/check.go
 
-gopls fix flags are:
+Example: show the fixes of the unusedparams analyzer for all of the packages
+of a module as diffs:
+
+  $ gopls fix -a unusedparams -d ./...
+
+The fixes are those that the editor offers as quick fixes for the diagnostics
+of the files, which are reported by the analyzers enabled for the editors and
+by the type checker. For each diagnostic, the preferred fix is applied, or the
+first one if none is preferred. A fix that overlaps a fix applied before it is
+skipped, and reported; running fix again applies it.
+
+Without -d or -w, the fixed contents of the files that change are printed.
 `)
-	f.PrintDefaults()
 }
 
-// Run performs diagnostic checks on the file specified and either;
-// - if -w is specified, updates the file in place;
+// Run applies the suggested fixes of the diagnostics of the files specified
+// by args and either;
+// - if -w is specified, updates the files in place;
 // - if -d is specified, prints out unified diffs of the changes; or
 // - otherwise, prints the new versions to stdout.
 func (s *suggestedfix) Run(ctx context.Context, args ...string) error {
-	if len(args) != 1 {
-		return tool.CommandLineErrorf("fix expects 1 argument")
+	if len(args) == 0 {
+		return tool.CommandLineErrorf("fix expects at least 1 argument")
+	}
+	filenames, err := s.app.packageFiles(args)
+	if err != nil {
+		return err
 	}
 	conn, err := s.app.connect(ctx)
 	if err != nil {
@@ -56,65 +74,154 @@ func (s *suggestedfix) Run(ctx context.Context, args ...string) error {
 	}
 	defer conn.terminate(ctx)
 
-	from := span.Parse(args[0])
-	uri := from.URI()
-	file := conn.AddFile(ctx, uri)
-	if file.err != nil {
-		return file.err
+	var files []*cmdFile
+	for _, filename := range filenames {
+		file := conn.AddFile(ctx, span.FileURI(filename))
+		if file.err != nil {
+			return file.err
+		}
+		files = append(files, file)
 	}
 
-	// Wait for diagnostics results
-	select {
-	case <-file.hasDiagnostics:
-	case <-time.After(30 * time.Second):
-		return errors.Errorf("timed out waiting for results from %v", file.uri)
+	edits := make(map[span.URI][]protocol.TextEdit)
+	for _, file := range files {
+		// Wait for diagnostics results
+		select {
+		case <-file.hasDiagnostics:
+		case <-time.After(30 * time.Second):
+			return errors.Errorf("timed out waiting for results from %v", file.uri)
+		}
+		if err := s.fixes(ctx, conn, file, edits); err != nil {
+			return err
+		}
 	}
 
+	var uris []span.URI
+	for uri := range edits {
+		uris = append(uris, uri)
+	}
+	sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+	for _, uri := range uris {
+		file := conn.AddFile(ctx, uri)
+		if file.err != nil {
+			return file.err
+		}
+		sedits, err := source.FromProtocolEdits(file.mapper, edits[uri])
+		if err != nil {
+			return errors.Errorf("%v: %v", uri, err)
+		}
+		newContent := diff.ApplyEdits(string(file.mapper.Content), sedits)
+
+		filename := uri.Filename()
+		switch {
+		case s.Write:
+			info, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filename, []byte(newContent), info.Mode().Perm()); err != nil {
+				return err
+			}
+		case s.Diff:
+			diffs := diff.ToUnified(filename+".orig", filename, string(file.mapper.Content), sedits)
+			fmt.Print(diffs)
+		default:
+			fmt.Print(string(newContent))
+		}
+	}
+	return nil
+}
+
+// fixes adds the edits of the suggested fixes of the diagnostics of file to
+// edits, by the files that they change. It asks the server for the quick fixes
+// of the diagnostics, as the editor does.
+func (s *suggestedfix) fixes(ctx context.Context, conn *connection, file *cmdFile, edits map[span.URI][]protocol.TextEdit) error {
+	var analyzers map[string]bool
+	if s.Analyzers != "" {
+		analyzers = make(map[string]bool)
+		for _, name := range strings.Split(s.Analyzers, ",") {
+			analyzers[strings.TrimSpace(name)] = true
+		}
+	}
 	file.diagnosticsMu.Lock()
-	defer file.diagnosticsMu.Unlock()
+	var diagnostics []protocol.Diagnostic
+	for _, d := range file.diagnostics {
+		if analyzers == nil || analyzers[d.Source] {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	file.diagnosticsMu.Unlock()
+	if len(diagnostics) == 0 {
+		return nil
+	}
 
 	p := protocol.CodeActionParams{
 		TextDocument: protocol.TextDocumentIdentifier{
-			URI: protocol.NewURI(uri),
+			URI: protocol.NewURI(file.uri),
 		},
 		Context: protocol.CodeActionContext{
 			Only:        []protocol.CodeActionKind{protocol.QuickFix},
-			Diagnostics: file.diagnostics,
+			Diagnostics: diagnostics,
 		},
 	}
 	actions, err := conn.CodeAction(ctx, &p)
 	if err != nil {
-		return errors.Errorf("%v: %v", from, err)
+		return errors.Errorf("%v: %v", file.uri, err)
+	}
+
+	// Choose one fix for each diagnostic: the preferred one, or the first.
+	type key struct {
+		rng             protocol.Range
+		source, message string
 	}
-	var edits []protocol.TextEdit
-	for _, a := range actions {
-		if !a.IsPreferred && !s.All {
+	chosen := make(map[key]int)
+	var keys []key
+	for i, a := range actions {
+		if len(a.Diagnostics) == 0 {
 			continue
 		}
-		for _, c := range a.Edit.DocumentChanges {
-			if c.TextDocument.URI == string(uri) {
-				edits = append(edits, c.Edits...)
-			}
+		d := a.Diagnostics[0]
+		k := key{d.Range, d.Source, d.Message}
+		j, ok := chosen[k]
+		if !ok {
+			keys = append(keys, k)
+		}
+		if !ok || a.IsPreferred && !actions[j].IsPreferred {
+			chosen[k] = i
 		}
 	}
-
-	sedits, err := source.FromProtocolEdits(file.mapper, edits)
-	if err != nil {
-		return errors.Errorf("%v: %v", edits, err)
+	for _, k := range keys {
+		a := actions[chosen[k]]
+		if overlaps(edits, a.Edit.DocumentChanges) {
+			spn, err := file.mapper.RangeSpan(k.rng)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%v: skipping fix %q, which overlaps another fix\n", spn, a.Title)
+			continue
+		}
+		for _, c := range a.Edit.DocumentChanges {
+			uri := span.NewURI(c.TextDocument.URI)
+			edits[uri] = append(edits[uri], c.Edits...)
+		}
 	}
-	newContent := diff.ApplyEdits(string(file.mapper.Content), sedits)
+	return nil
+}
 
-	filename := file.uri.Filename()
-	switch {
-	case s.Write:
-		if len(edits) > 0 {
-			ioutil.WriteFile(filename, []byte(newContent), 0644)
+// overlaps reports whether any of the changes overlaps one of edits.
+func overlaps(edits map[span.URI][]protocol.TextEdit, changes []protocol.TextDocumentEdit) bool {
+	for _, c := range changes {
+		for _, e := range edits[span.NewURI(c.TextDocument.URI)] {
+			for _, ce := range c.Edits {
+				if protocol.ComparePosition(ce.Range.Start, e.Range.End) < 0 && protocol.ComparePosition(e.Range.Start, ce.Range.End) < 0 {
+					return true
+				}
+				// Two insertions at the same position conflict too.
+				if protocol.CompareRange(ce.Range, e.Range) == 0 {
+					return true
+				}
+			}
 		}
-	case s.Diff:
-		diffs := diff.ToUnified(filename+".orig", filename, string(file.mapper.Content), sedits)
-		fmt.Print(diffs)
-	default:
-		fmt.Print(string(newContent))
 	}
-	return nil
+	return false
 }
@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"sort"
@@ -15,8 +16,10 @@ import (
 	"github.com/jackie-feng/tools/internal/tool"
 )
 
-// references implements the references verb for gopls
+// symbols implements the symbols verb for gopls
 type symbols struct {
+	JSON bool `flag:"json" help:"print the symbols as JSON"`
+
 	app *Application
 }
 
@@ -25,10 +28,14 @@ func (r *symbols) Usage() string     { return "<file>" }
 func (r *symbols) ShortHelp() string { return "display selected file's symbols" }
 func (r *symbols) DetailedHelp(f *flag.FlagSet) {
 	fmt.Fprint(f.Output(), `
+Prints the symbols of the file as a tree, with the name, kind and range of
+the name of each symbol, one per line, indented by their depth in the tree,
+or as JSON, with the range of their declarations too.
+
 Example:
   $ gopls symbols helper/helper.go
+  $ gopls symbols -json helper/helper.go
 `)
-	f.PrintDefaults()
 }
 func (r *symbols) Run(ctx context.Context, args ...string) error {
 	if len(args) != 1 {
@@ -52,28 +59,79 @@ func (r *symbols) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	for _, s := range symbols {
-		fmt.Println(symbolToString(s))
-		// Sort children for consistency
-		sort.Slice(s.Children, func(i, j int) bool {
-			return s.Children[i].Name < s.Children[j].Name
-		})
-		for _, c := range s.Children {
-			fmt.Println("\t" + symbolToString(c))
+	// Sort children for consistency
+	for i := range symbols {
+		sortChildren(&symbols[i])
+	}
+	if r.JSON {
+		out := []jsonSymbol{}
+		for _, s := range symbols {
+			out = append(out, toJSONSymbol(s))
+		}
+		data, err := json.MarshalIndent(out, "", "\t")
+		if err != nil {
+			return err
 		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+	for _, s := range symbols {
+		printSymbol(s, "")
 	}
 
 	return nil
 }
 
+func sortChildren(symbol *protocol.DocumentSymbol) {
+	sort.Slice(symbol.Children, func(i, j int) bool {
+		return symbol.Children[i].Name < symbol.Children[j].Name
+	})
+	for i := range symbol.Children {
+		sortChildren(&symbol.Children[i])
+	}
+}
+
+func printSymbol(symbol protocol.DocumentSymbol, indent string) {
+	fmt.Println(indent + symbolToString(symbol))
+	for _, c := range symbol.Children {
+		printSymbol(c, indent+"\t")
+	}
+}
+
 func symbolToString(symbol protocol.DocumentSymbol) string {
-	r := symbol.SelectionRange
-	// convert ranges to user friendly 1-based positions
-	position := fmt.Sprintf("%v:%v-%v:%v",
+	return fmt.Sprintf("%s %s %s", symbol.Name, symbol.Kind, rangeToString(symbol.SelectionRange))
+}
+
+// rangeToString converts r to user friendly 1-based positions.
+func rangeToString(r protocol.Range) string {
+	return fmt.Sprintf("%v:%v-%v:%v",
 		r.Start.Line+1,
 		r.Start.Character+1,
 		r.End.Line+1,
 		r.End.Character+1,
 	)
-	return fmt.Sprintf("%s %s %s", symbol.Name, symbol.Kind, position)
+}
+
+// jsonSymbol is a document symbol printed by symbols -json.
+type jsonSymbol struct {
+	Name           string       `json:"name"`
+	Detail         string       `json:"detail,omitempty"`
+	Kind           string       `json:"kind"`
+	Range          string       `json:"range"`
+	SelectionRange string       `json:"selectionRange"`
+	Children       []jsonSymbol `json:"children,omitempty"`
+}
+
+func toJSONSymbol(symbol protocol.DocumentSymbol) jsonSymbol {
+	s := jsonSymbol{
+		Name:           symbol.Name,
+		Detail:         symbol.Detail,
+		Kind:           fmt.Sprint(symbol.Kind),
+		Range:          rangeToString(symbol.Range),
+		SelectionRange: rangeToString(symbol.SelectionRange),
+	}
+	for _, c := range symbol.Children {
+		s.Children = append(s.Children, toJSONSymbol(c))
+	}
+	return s
 }
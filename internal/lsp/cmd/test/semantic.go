@@ -0,0 +1,22 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmdtest
+
+import (
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func (r *runner) SemanticTokens(t *testing.T, spn span.Span) {
+	filename := spn.URI().Filename()
+	got, _ := r.NormalizeGoplsCmd(t, "semtok", filename)
+	expect := string(r.data.Golden("semtok", filename, func() ([]byte, error) {
+		return []byte(got), nil
+	}))
+	if expect != got {
+		t.Errorf("semtok failed for %s expected:\n%s\ngot:\n%s", filename, expect, got)
+	}
+}
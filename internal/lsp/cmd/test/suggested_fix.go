@@ -13,7 +13,7 @@ import (
 func (r *runner) SuggestedFix(t *testing.T, spn span.Span) {
 	uri := spn.URI()
 	filename := uri.Filename()
-	got, _ := r.NormalizeGoplsCmd(t, "fix", "-a", filename)
+	got, _ := r.NormalizeGoplsCmd(t, "fix", filename)
 	want := string(r.data.Golden("suggestedfix", filename, func() ([]byte, error) {
 		return []byte(got), nil
 	}))
@@ -0,0 +1,87 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/tool"
+)
+
+// workspaceSymbol implements the workspace_symbol verb for gopls.
+type workspaceSymbol struct {
+	Matcher string `flag:"matcher" help:"how the query matches symbol names: fuzzy, caseInsensitive or caseSensitive"`
+
+	app *Application
+}
+
+func (r *workspaceSymbol) Name() string      { return "workspace_symbol" }
+func (r *workspaceSymbol) Usage() string     { return "<query>" }
+func (r *workspaceSymbol) ShortHelp() string { return "search the symbols of the workspace" }
+func (r *workspaceSymbol) DetailedHelp(f *flag.FlagSet) {
+	fmt.Fprint(f.Output(), `
+Prints the top-level symbols of the workspace whose names match the query,
+best matches first, with the span of the name and the kind of each symbol.
+
+Example:
+  $ gopls workspace_symbol Println
+  $ gopls workspace_symbol -matcher=caseSensitive Print
+`)
+}
+
+func (r *workspaceSymbol) Run(ctx context.Context, args ...string) error {
+	if len(args) != 1 {
+		return tool.CommandLineErrorf("workspace_symbol expects 1 argument (query)")
+	}
+	var matcher source.SymbolMatcher
+	switch r.Matcher {
+	case "", "fuzzy":
+		matcher = source.SymbolFuzzy
+	case "caseInsensitive":
+		matcher = source.SymbolCaseInsensitive
+	case "caseSensitive":
+		matcher = source.SymbolCaseSensitive
+	default:
+		return tool.CommandLineErrorf("unknown matcher %q", r.Matcher)
+	}
+	options := r.app.options
+	r.app.options = func(o *source.Options) {
+		if options != nil {
+			options(o)
+		}
+		o.SymbolMatcher = matcher
+	}
+
+	conn, err := r.app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.terminate(ctx)
+
+	p := protocol.WorkspaceSymbolParams{Query: args[0]}
+	symbols, err := conn.Symbol(ctx, &p)
+	if err != nil {
+		return err
+	}
+	for _, s := range symbols {
+		f := conn.AddFile(ctx, span.NewURI(s.Location.URI))
+		if f.err != nil {
+			return f.err
+		}
+		// convert location to span for user-friendly 1-indexed line
+		// and column numbers
+		span, err := f.mapper.Span(s.Location)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%v %s %s\n", span, s.Name, s.Kind)
+	}
+	return nil
+}
@@ -55,18 +55,35 @@ func (s *Server) codeAction(ctx context.Context, params *protocol.CodeActionPara
 	var codeActions []protocol.CodeAction
 	switch fh.Identity().Kind {
 	case source.Mod:
-		if !wanted[protocol.SourceOrganizeImports] {
-			return nil, nil
+		if wanted[protocol.QuickFix] {
+			for _, diag := range params.Context.Diagnostics {
+				pattern, ok := source.PrivateModulePattern(diag)
+				if !ok {
+					continue
+				}
+				codeActions = append(codeActions, protocol.CodeAction{
+					Title:       fmt.Sprintf("Set GOPRIVATE=%s", pattern),
+					Kind:        protocol.QuickFix,
+					Diagnostics: []protocol.Diagnostic{diag},
+					Command: &protocol.Command{
+						Title:     "Set GOPRIVATE",
+						Command:   "goprivate",
+						Arguments: []interface{}{fh.Identity().URI, pattern},
+					},
+				})
+			}
+		}
+		if wanted[protocol.SourceOrganizeImports] {
+			codeActions = append(codeActions, protocol.CodeAction{
+				Title: "Tidy",
+				Kind:  protocol.SourceOrganizeImports,
+				Command: &protocol.Command{
+					Title:     "Tidy",
+					Command:   "tidy",
+					Arguments: []interface{}{fh.Identity().URI},
+				},
+			})
 		}
-		codeActions = append(codeActions, protocol.CodeAction{
-			Title: "Tidy",
-			Kind:  protocol.SourceOrganizeImports,
-			Command: &protocol.Command{
-				Title:     "Tidy",
-				Command:   "tidy",
-				Arguments: []interface{}{fh.Identity().URI},
-			},
-		})
 	case source.Go:
 		edits, editsPerFix, err := source.AllImportsFixes(ctx, snapshot, fh)
 		if err != nil {
@@ -108,6 +125,50 @@ func (s *Server) codeAction(ctx context.Context, params *protocol.CodeActionPara
 				},
 			})
 		}
+		// Organizing the imports of a whole package runs goimports on each
+		// of its files, so only do it when the client asks for it.
+		if wanted[protocol.SourceOrganizeImportsInPackage] && len(params.Context.Only) > 0 {
+			changes, err := organizeImportsInPackage(ctx, snapshot, fh)
+			if err != nil {
+				log.Error(ctx, "organizing imports in package failed", err, telemetry.File.Of(uri))
+			} else if len(changes) > 0 {
+				codeActions = append(codeActions, protocol.CodeAction{
+					Title: "Organize Imports in Package",
+					Kind:  protocol.SourceOrganizeImportsInPackage,
+					Edit: protocol.WorkspaceEdit{
+						DocumentChanges: changes,
+					},
+				})
+			}
+		}
+		if wanted[protocol.SourceFixAll] {
+			fixes, err := source.FixAll(ctx, snapshot, fh)
+			if err != nil {
+				log.Error(ctx, "fix all failed", err, telemetry.File.Of(uri))
+			} else if len(fixes) > 0 {
+				codeActions = append(codeActions, protocol.CodeAction{
+					Title: "Fix All",
+					Kind:  protocol.SourceFixAll,
+					Edit: protocol.WorkspaceEdit{
+						DocumentChanges: documentChanges(fh, fixes),
+					},
+				})
+			}
+		}
+		if wanted[protocol.RefactorRewrite] {
+			edits, err := source.RemoveDotImports(ctx, snapshot, fh)
+			if err != nil {
+				log.Error(ctx, "removing dot-imports failed", err, telemetry.File.Of(uri))
+			} else if len(edits) > 0 {
+				codeActions = append(codeActions, protocol.CodeAction{
+					Title: "Remove dot-imports",
+					Kind:  protocol.RefactorRewrite,
+					Edit: protocol.WorkspaceEdit{
+						DocumentChanges: documentChanges(fh, edits),
+					},
+				})
+			}
+		}
 	default:
 		// Unsupported file kind for a code action.
 		return nil, nil
@@ -214,10 +275,18 @@ func quickFixes(ctx context.Context, snapshot source.Snapshot, fh source.FileHan
 		return nil, err
 	}
 	for _, diag := range diagnostics {
-		// This code assumes that the analyzer name is the Source of the diagnostic.
-		// If this ever changes, this will need to be addressed.
-		srcErr, err := snapshot.FindAnalysisError(ctx, ph.ID(), diag.Source, diag.Message, diag.Range)
-		if err != nil {
+		var srcErr *source.Error
+		if diag.Source == "compiler" {
+			srcErr = findTypeError(ctx, ph, diag)
+		} else {
+			// This code assumes that the analyzer name is the Source of the diagnostic.
+			// If this ever changes, this will need to be addressed.
+			srcErr, err = snapshot.FindAnalysisError(ctx, ph.ID(), diag.Source, diag.Message, diag.Range)
+			if err != nil {
+				continue
+			}
+		}
+		if srcErr == nil {
 			continue
 		}
 		for _, fix := range srcErr.SuggestedFixes {
@@ -241,6 +310,59 @@ func quickFixes(ctx context.Context, snapshot source.Snapshot, fh source.FileHan
 	return codeActions, nil
 }
 
+// findTypeError returns the type error of the package reported as diag,
+// or nil if there is none.
+func findTypeError(ctx context.Context, ph source.PackageHandle, diag protocol.Diagnostic) *source.Error {
+	pkg, err := ph.Check(ctx)
+	if err != nil {
+		return nil
+	}
+	for _, e := range pkg.GetErrors() {
+		if e.Kind == source.TypeError && e.Message == diag.Message && protocol.CompareRange(e.Range, diag.Range) == 0 {
+			return e
+		}
+	}
+	return nil
+}
+
+// organizeImportsInPackage returns the changes that organize the imports of
+// every file of the package of fh. It returns nil if only fh needs them, as
+// the Organize Imports action of fh covers that.
+func organizeImportsInPackage(ctx context.Context, snapshot source.Snapshot, fh source.FileHandle) ([]protocol.TextDocumentEdit, error) {
+	phs, err := snapshot.PackageHandles(ctx, fh)
+	if err != nil {
+		return nil, err
+	}
+	ph, err := source.WidestCheckPackageHandle(phs)
+	if err != nil {
+		return nil, err
+	}
+	var changes []protocol.TextDocumentEdit
+	others := false
+	for _, pgh := range ph.CompiledGoFiles() {
+		uri := pgh.File().Identity().URI
+		file, err := snapshot.GetFile(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		edits, _, err := source.AllImportsFixes(ctx, snapshot, file)
+		if err != nil {
+			return nil, err
+		}
+		if len(edits) == 0 {
+			continue
+		}
+		if uri != fh.Identity().URI {
+			others = true
+		}
+		changes = append(changes, documentChanges(file, edits)...)
+	}
+	if !others {
+		return nil, nil
+	}
+	return changes, nil
+}
+
 func documentChanges(fh source.FileHandle, edits []protocol.TextEdit) []protocol.TextDocumentEdit {
 	return []protocol.TextDocumentEdit{
 		{
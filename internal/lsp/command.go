@@ -2,6 +2,10 @@ package lsp
 
 import (
 	"context"
+	"encoding/json"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
@@ -32,6 +36,181 @@ func (s *Server) executeCommand(ctx context.Context, params *protocol.ExecuteCom
 		if err := source.ModTidy(ctx, view); err != nil {
 			return nil, err
 		}
+	case "goprivate":
+		if len(params.Arguments) != 2 {
+			return nil, errors.Errorf("expected a go.mod file URI and a module path pattern for call to goprivate, got %v", params.Arguments)
+		}
+		uri, _ := params.Arguments[0].(string)
+		pattern, _ := params.Arguments[1].(string)
+		if uri == "" || pattern == "" {
+			return nil, errors.Errorf("invalid arguments for goprivate: %v", params.Arguments)
+		}
+		view, err := s.session.ViewOf(span.NewURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		fh, err := view.Snapshot().GetFile(ctx, span.NewURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		if fh.Identity().Kind != source.Mod {
+			return nil, errors.Errorf("%s is not a mod file", uri)
+		}
+		return nil, s.setGOPRIVATE(ctx, view, fh, pattern)
+	case "stats":
+		return s.stats(), nil
+	case "inspect":
+		return &inspection{
+			CacheInspection: s.session.Inspect(),
+			Memory:          readMemoryStats(),
+		}, nil
+	case "describe":
+		if len(params.Arguments) != 1 {
+			return nil, errors.Errorf("expected one text document position for call to describe, got %v", params.Arguments)
+		}
+		// The argument arrives as a generic JSON value.
+		data, err := json.Marshal(params.Arguments[0])
+		if err != nil {
+			return nil, err
+		}
+		var pos protocol.TextDocumentPositionParams
+		if err := json.Unmarshal(data, &pos); err != nil {
+			return nil, errors.Errorf("invalid argument for describe: %v", err)
+		}
+		return s.describe(ctx, &pos)
+	case "semtok":
+		if len(params.Arguments) != 1 {
+			return nil, errors.Errorf("expected one file URI for call to semtok, got %v", params.Arguments)
+		}
+		uri, _ := params.Arguments[0].(string)
+		if uri == "" {
+			return nil, errors.Errorf("invalid argument for semtok: %v", params.Arguments[0])
+		}
+		return s.semanticTokens(ctx, span.NewURI(uri))
+	case "test":
+		if len(params.Arguments) != 2 {
+			return nil, errors.Errorf("expected a test file URI and a function name for call to test, got %v", params.Arguments)
+		}
+		uri, _ := params.Arguments[0].(string)
+		name, _ := params.Arguments[1].(string)
+		if uri == "" || name == "" {
+			return nil, errors.Errorf("invalid arguments for test: %v", params.Arguments)
+		}
+		return s.runTest(ctx, span.NewURI(uri), name)
 	}
 	return nil, nil
 }
+
+// setGOPRIVATE adds pattern to the GOPRIVATE setting of the go command for
+// the view, so that it fetches the private modules that pattern matches
+// directly from their host. The setting lasts until the configuration of the
+// view changes.
+func (s *Server) setGOPRIVATE(ctx context.Context, view source.View, fh source.FileHandle, pattern string) error {
+	options := view.Options()
+	goprivate, err := source.InvokeGo(ctx, view.Folder().Filename(), options.Env, "env", "GOPRIVATE")
+	if err != nil {
+		return err
+	}
+	options.Env = source.AddGOPRIVATE(options.Env, strings.TrimSpace(goprivate.String()), pattern)
+	view, err = view.SetOptions(ctx, options)
+	if err != nil {
+		return err
+	}
+	// Clear the diagnostic on go.mod. It is reported again if the
+	// modules still cannot be fetched.
+	s.publishReports(ctx, map[source.FileIdentity][]source.Diagnostic{fh.Identity(): {}}, true)
+	go s.diagnoseSnapshot(view.Snapshot())
+	return nil
+}
+
+// stats is the result of the stats command.
+type stats struct {
+	*source.SessionStats
+	Memory memoryStats `json:"memory"`
+}
+
+// memoryStats is a summary of runtime.MemStats.
+type memoryStats struct {
+	HeapAlloc   uint64 `json:"heapAlloc"`
+	HeapInuse   uint64 `json:"heapInuse"`
+	HeapObjects uint64 `json:"heapObjects"`
+	Sys         uint64 `json:"sys"`
+	TotalAlloc  uint64 `json:"totalAlloc"`
+	NumGC       uint32 `json:"numGC"`
+}
+
+// inspection is the result of the inspect command.
+type inspection struct {
+	*source.CacheInspection
+	Memory memoryStats `json:"memory"`
+}
+
+// stats reports the state held by the session, along with the memory
+// used by the process, to help diagnose excessive memory use.
+func (s *Server) stats() *stats {
+	return &stats{
+		SessionStats: s.session.Stats(),
+		Memory:       readMemoryStats(),
+	}
+}
+
+func readMemoryStats() memoryStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return memoryStats{
+		HeapAlloc:   m.HeapAlloc,
+		HeapInuse:   m.HeapInuse,
+		HeapObjects: m.HeapObjects,
+		Sys:         m.Sys,
+		TotalAlloc:  m.TotalAlloc,
+		NumGC:       m.NumGC,
+	}
+}
+
+// describe returns the syntax and type information at a position.
+func (s *Server) describe(ctx context.Context, params *protocol.TextDocumentPositionParams) (*source.Description, error) {
+	uri := span.NewURI(params.TextDocument.URI)
+	view, err := s.session.ViewOf(uri)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := view.Snapshot()
+	fh, err := snapshot.GetFile(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if fh.Identity().Kind != source.Go {
+		return nil, errors.Errorf("%s is not a Go file", uri)
+	}
+	return source.Describe(ctx, snapshot, fh, params.Position)
+}
+
+// semanticTokens returns the semantic tokens of a Go file.
+func (s *Server) semanticTokens(ctx context.Context, uri span.URI) (*source.SemanticTokens, error) {
+	view, err := s.session.ViewOf(uri)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := view.Snapshot()
+	fh, err := snapshot.GetFile(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if fh.Identity().Kind != source.Go {
+		return nil, errors.Errorf("%s is not a Go file", uri)
+	}
+	return source.Semantic(ctx, snapshot, fh)
+}
+
+// runTest runs the test or benchmark function name of the package of a
+// _test.go file, and returns the output of go test.
+func (s *Server) runTest(ctx context.Context, uri span.URI, name string) (string, error) {
+	view, err := s.session.ViewOf(uri)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(uri.Filename(), "_test.go") {
+		return "", errors.Errorf("%s is not a test file", uri)
+	}
+	return source.RunTest(ctx, view, filepath.Dir(uri.Filename()), name)
+}
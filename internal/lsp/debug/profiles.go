@@ -0,0 +1,230 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// maxRequestProfiles is the number of slow request profiles that are kept.
+// The files of older profiles are removed.
+const maxRequestProfiles = 20
+
+// RequestProfile holds the profiles captured for a slow request.
+type RequestProfile struct {
+	Method  string
+	ID      string
+	Start   time.Time
+	Elapsed time.Duration // zero while the request is in progress
+
+	// CPU and Goroutines are the names of the profile files in the
+	// profile directory. CPU is empty if another CPU profile was already
+	// being captured when the request became slow.
+	CPU        string
+	Goroutines string
+}
+
+var slowRequests = struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	dir       string
+	cpuBusy   bool
+	seq       int
+	profiles  []*RequestProfile
+}{}
+
+// ProfileSlowRequests enables the capture of a goroutine dump and a CPU
+// profile of every request that takes longer than threshold. The profiles
+// are written to dir, and listed on the profiles page of the debug server.
+func ProfileSlowRequests(threshold time.Duration, dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	slowRequests.mu.Lock()
+	defer slowRequests.mu.Unlock()
+	slowRequests.threshold = threshold
+	slowRequests.dir = dir
+	return nil
+}
+
+// StartRequest is called when the server starts handling a request.
+// It returns a function to call when the request has been handled.
+// If the request is still in progress after the threshold, its goroutines
+// are dumped, and its CPU usage is profiled until it completes.
+// The request is also watched by the watchdog, if it is started.
+func StartRequest(method, id string) (done func()) {
+	untrack := trackRequest(method, id)
+	slowRequests.mu.Lock()
+	threshold := slowRequests.threshold
+	slowRequests.mu.Unlock()
+	if threshold <= 0 {
+		return untrack
+	}
+
+	var (
+		mu       sync.Mutex
+		start    = time.Now()
+		finished bool
+		profile  *RequestProfile
+		cpu      *os.File
+	)
+	timer := time.AfterFunc(threshold, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !finished {
+			profile, cpu = captureProfile(method, id, start)
+		}
+	})
+	return func() {
+		untrack()
+		timer.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		finished = true
+		if profile == nil {
+			return
+		}
+		slowRequests.mu.Lock()
+		defer slowRequests.mu.Unlock()
+		profile.Elapsed = time.Since(start)
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+			slowRequests.cpuBusy = false
+		}
+	}
+}
+
+// captureProfile dumps the goroutines of a request that became slow, and
+// starts profiling the CPU unless it is already being profiled.
+func captureProfile(method, id string, start time.Time) (*RequestProfile, *os.File) {
+	slowRequests.mu.Lock()
+	defer slowRequests.mu.Unlock()
+
+	slowRequests.seq++
+	prefix := fmt.Sprintf("%s-%d", start.Format("20060102-150405"), slowRequests.seq)
+	profile := &RequestProfile{
+		Method:     method,
+		ID:         id,
+		Start:      start,
+		Goroutines: prefix + ".goroutines.txt",
+	}
+	if f, err := os.Create(filepath.Join(slowRequests.dir, profile.Goroutines)); err == nil {
+		pprof.Lookup("goroutine").WriteTo(f, 2)
+		f.Close()
+	} else {
+		profile.Goroutines = ""
+	}
+	var cpu *os.File
+	if !slowRequests.cpuBusy {
+		profile.CPU = prefix + ".cpu.pprof"
+		f, err := os.Create(filepath.Join(slowRequests.dir, profile.CPU))
+		if err == nil {
+			// This fails if a profile is being captured by other means,
+			// such as the /debug/pprof/profile handler.
+			err = pprof.StartCPUProfile(f)
+			if err != nil {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}
+		if err != nil {
+			profile.CPU = ""
+		} else {
+			cpu = f
+			slowRequests.cpuBusy = true
+		}
+	}
+
+	slowRequests.profiles = append(slowRequests.profiles, profile)
+	if n := len(slowRequests.profiles) - maxRequestProfiles; n > 0 {
+		for _, p := range slowRequests.profiles[:n] {
+			// Keep a CPU profile that is still being written.
+			if p.CPU != "" && p.Elapsed != 0 {
+				os.Remove(filepath.Join(slowRequests.dir, p.CPU))
+			}
+			if p.Goroutines != "" {
+				os.Remove(filepath.Join(slowRequests.dir, p.Goroutines))
+			}
+		}
+		slowRequests.profiles = append([]*RequestProfile(nil), slowRequests.profiles[n:]...)
+	}
+	return profile, cpu
+}
+
+func getProfiles(r *http.Request) interface{} {
+	slowRequests.mu.Lock()
+	defer slowRequests.mu.Unlock()
+	watchdog.mu.Lock()
+	defer watchdog.mu.Unlock()
+
+	result := struct {
+		Threshold time.Duration
+		Dir       string
+		Profiles  []RequestProfile
+		Watchdog  bool
+		Dumps     []Dump
+	}{
+		Threshold: slowRequests.threshold,
+		Dir:       slowRequests.dir,
+		Watchdog:  watchdog.requests != nil,
+	}
+	// Most recent first.
+	for i := len(slowRequests.profiles) - 1; i >= 0; i-- {
+		result.Profiles = append(result.Profiles, *slowRequests.profiles[i])
+	}
+	for i := len(watchdog.dumps) - 1; i >= 0; i-- {
+		result.Dumps = append(result.Dumps, *watchdog.dumps[i])
+	}
+	return result
+}
+
+// serveProfile serves a profile file from the profile directory.
+func serveProfile(w http.ResponseWriter, r *http.Request) {
+	slowRequests.mu.Lock()
+	dir := slowRequests.dir
+	slowRequests.mu.Unlock()
+	if dir == "" {
+		watchdog.mu.Lock()
+		dir = watchdog.dir
+		watchdog.mu.Unlock()
+	}
+	if dir == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(dir, path.Base(r.URL.Path)))
+}
+
+var profilesTmpl = template.Must(template.Must(BaseTemplate.Clone()).Parse(`
+{{define "title"}}Slow request profiles{{end}}
+{{define "body"}}
+{{if .Threshold}}
+Requests slower than <b>{{.Threshold}}</b> are profiled in <b>{{.Dir}}</b>.
+<ul>{{range .Profiles}}<li>{{.Start.Format "15:04:05"}} <b>{{.Method}}</b> {{.ID}}
+{{if .Elapsed}}took {{.Elapsed}}{{else}}in progress{{end}}
+{{with .CPU}}<a href="/profiles/file/{{.}}">CPU profile</a>{{end}}
+{{with .Goroutines}}<a href="/profiles/file/{{.}}">goroutines</a>{{end}}
+</li>{{end}}</ul>
+{{else}}
+Slow requests are not being profiled. Start gopls with <code>-profile.slow</code> to enable this.
+{{end}}
+{{if .Watchdog}}
+<h2>Watchdog dumps</h2>
+<ul>{{range .Dumps}}<li>{{.Time.Format "15:04:05"}} {{.Reason}}
+{{with .Goroutines}}<a href="/profiles/file/{{.}}">goroutines</a>{{end}}
+{{with .Heap}}<a href="/profiles/file/{{.}}">heap</a>{{end}}
+</li>{{else}}<li>none</li>{{end}}</ul>
+{{end}}
+{{end}}
+`))
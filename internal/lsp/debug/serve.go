@@ -44,6 +44,7 @@ type View interface {
 	Name() string
 	Folder() span.URI
 	Session() Session
+	Degraded() bool
 }
 
 type File struct {
@@ -61,6 +62,9 @@ var (
 		Sessions []Session
 		Views    []View
 	}{}
+
+	// address is the address of the debug server, if it is running.
+	address string
 )
 
 // AddCache adds a cache to the set being served
@@ -217,6 +221,7 @@ func Serve(ctx context.Context, addr string) error {
 		return err
 	}
 
+	address = listener.Addr().String()
 	port := listener.Addr().(*net.TCPAddr).Port
 	if strings.HasSuffix(addr, ":0") {
 		stdlog.Printf("debug server listening on port %d", port)
@@ -244,6 +249,8 @@ func Serve(ctx context.Context, addr string) error {
 		mux.HandleFunc("/file/", Render(fileTmpl, getFile))
 		mux.HandleFunc("/info", Render(infoTmpl, getInfo))
 		mux.HandleFunc("/memory", Render(memoryTmpl, getMemory))
+		mux.HandleFunc("/profiles", Render(profilesTmpl, getProfiles))
+		mux.HandleFunc("/profiles/file/", serveProfile)
 		if err := http.Serve(listener, mux); err != nil {
 			log.Error(ctx, "Debug server failed", err)
 			return
@@ -253,6 +260,14 @@ func Serve(ctx context.Context, addr string) error {
 	return nil
 }
 
+// Address returns the address on which the debug server listens, or the
+// empty string if it is not running.
+func Address() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return address
+}
+
 func Render(tmpl *template.Template, fun func(*http.Request) interface{}) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var data interface{}
@@ -307,6 +322,7 @@ ul.events {
 <a href="/metrics">Metrics</a>
 <a href="/rpc">RPC</a>
 <a href="/trace">Trace</a>
+<a href="/profiles">Profiles</a>
 <hr>
 <h1>{{template "title" .}}</h1>
 {{block "body" .}}
@@ -332,7 +348,7 @@ var mainTmpl = template.Must(template.Must(BaseTemplate.Clone()).Parse(`
 <h2>Sessions</h2>
 <ul>{{range .Sessions}}<li>{{template "sessionlink" .ID}} from {{template "cachelink" .Cache.ID}}</li>{{end}}</ul>
 <h2>Views</h2>
-<ul>{{range .Views}}<li>{{.Name}} is {{template "viewlink" .ID}} from {{template "sessionlink" .Session.ID}} in {{.Folder}}</li>{{end}}</ul>
+<ul>{{range .Views}}<li>{{.Name}} is {{template "viewlink" .ID}} from {{template "sessionlink" .Session.ID}} in {{.Folder}}{{if .Degraded}} (degraded){{end}}</li>{{end}}</ul>
 {{end}}
 `))
 
@@ -405,6 +421,7 @@ var viewTmpl = template.Must(template.Must(BaseTemplate.Clone()).Parse(`
 Name: <b>{{.Name}}</b><br>
 Folder: <b>{{.Folder}}</b><br>
 From: <b>{{template "sessionlink" .Session.ID}}</b><br>
+Degraded: <b>{{.Degraded}}</b><br>
 <h2>Environment</h2>
 <ul>{{range .Env}}<li>{{.}}</li>{{end}}</ul>
 {{end}}
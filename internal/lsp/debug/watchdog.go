@@ -0,0 +1,189 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// watchdogInterval is how often the watchdog checks the requests in
+	// progress and the heap size.
+	watchdogInterval = 5 * time.Second
+
+	// minDumpInterval is the minimum time between two dumps, so that a
+	// deadlock that blocks every request does not fill the disk.
+	minDumpInterval = time.Minute
+
+	// maxDumps is the number of watchdog dumps that are kept.
+	maxDumps = 10
+
+	// watchdogExitCode is the exit status of a server that the watchdog
+	// stopped, for editors that restart gopls when it exits.
+	watchdogExitCode = 3
+)
+
+// Dump holds the files written by the watchdog when it fired.
+type Dump struct {
+	Time   time.Time
+	Reason string
+
+	// Goroutines and Heap are the names of the dump files in the profile
+	// directory, or empty if they could not be written.
+	Goroutines string
+	Heap       string
+}
+
+// A request is a request in progress, as seen by the watchdog.
+type request struct {
+	method, id string
+	start      time.Time
+	reported   bool
+}
+
+var watchdog = struct {
+	mu       sync.Mutex
+	dir      string
+	stuck    time.Duration
+	maxHeap  uint64
+	exit     bool
+	requests map[*request]bool
+	lastDump time.Time
+	dumps    []*Dump
+}{}
+
+// StartWatchdog starts a watchdog that writes a dump of the goroutines and
+// the heap to dir when a request is in progress for longer than stuck, or
+// when the heap grows larger than maxHeap bytes, which may be a sign that
+// the server is about to run out of memory. Zero values disable each check.
+// If exit is set, the server exits after the dump, so that the editor may
+// restart it, rather than hang.
+func StartWatchdog(dir string, stuck time.Duration, maxHeap uint64, exit bool) {
+	if stuck <= 0 && maxHeap == 0 {
+		return
+	}
+	watchdog.mu.Lock()
+	watchdog.dir = dir
+	watchdog.stuck = stuck
+	watchdog.maxHeap = maxHeap
+	watchdog.exit = exit
+	watchdog.requests = make(map[*request]bool)
+	watchdog.mu.Unlock()
+	go watch()
+}
+
+// trackRequest records a request in progress for the watchdog, and returns
+// a function to call when the request has been handled.
+func trackRequest(method, id string) (done func()) {
+	watchdog.mu.Lock()
+	defer watchdog.mu.Unlock()
+	if watchdog.stuck <= 0 {
+		return func() {}
+	}
+	r := &request{method: method, id: id, start: time.Now()}
+	watchdog.requests[r] = true
+	return func() {
+		watchdog.mu.Lock()
+		delete(watchdog.requests, r)
+		watchdog.mu.Unlock()
+	}
+}
+
+func watch() {
+	heapReported := false
+	for now := range time.Tick(watchdogInterval) {
+		var reasons []string
+
+		watchdog.mu.Lock()
+		if now.Sub(watchdog.lastDump) < minDumpInterval {
+			watchdog.mu.Unlock()
+			continue
+		}
+		for r := range watchdog.requests {
+			if elapsed := now.Sub(r.start); !r.reported && elapsed > watchdog.stuck {
+				r.reported = true
+				reasons = append(reasons, fmt.Sprintf("%s request %s has been in progress for %v", r.method, r.id, elapsed.Round(time.Second)))
+			}
+		}
+		maxHeap := watchdog.maxHeap
+		watchdog.mu.Unlock()
+
+		if maxHeap > 0 {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			switch {
+			case m.HeapAlloc > maxHeap && !heapReported:
+				heapReported = true
+				reasons = append(reasons, fmt.Sprintf("heap size is %d bytes, more than the limit of %d", m.HeapAlloc, maxHeap))
+			case m.HeapAlloc < maxHeap/2:
+				// Report the heap again if it grows back.
+				heapReported = false
+			}
+		}
+		if len(reasons) > 0 {
+			fire(now, strings.Join(reasons, "; "))
+		}
+	}
+}
+
+// fire writes the dumps for reason, and exits if the watchdog is
+// configured to.
+func fire(now time.Time, reason string) {
+	watchdog.mu.Lock()
+	defer watchdog.mu.Unlock()
+	watchdog.lastDump = now
+
+	dump := &Dump{Time: now, Reason: reason}
+	prefix := "watchdog-" + now.Format("20060102-150405")
+	if err := os.MkdirAll(watchdog.dir, 0700); err != nil {
+		log.Printf("watchdog: %s; cannot write the dumps: %v", reason, err)
+	} else {
+		dump.Goroutines = writeProfile(prefix+".goroutines.txt", "goroutine", 2)
+		dump.Heap = writeProfile(prefix+".heap.pprof", "heap", 0)
+		log.Printf("watchdog: %s; dumped the goroutines and heap to %s", reason, watchdog.dir)
+	}
+	if watchdog.exit {
+		log.Printf("watchdog: exiting")
+		os.Exit(watchdogExitCode)
+	}
+
+	watchdog.dumps = append(watchdog.dumps, dump)
+	if n := len(watchdog.dumps) - maxDumps; n > 0 {
+		for _, d := range watchdog.dumps[:n] {
+			for _, name := range []string{d.Goroutines, d.Heap} {
+				if name != "" {
+					os.Remove(filepath.Join(watchdog.dir, name))
+				}
+			}
+		}
+		watchdog.dumps = append([]*Dump(nil), watchdog.dumps[n:]...)
+	}
+}
+
+// writeProfile writes the named profile to a file of the watchdog
+// directory, and returns the name of the file, or "" if it failed.
+func writeProfile(name, profile string, debug int) string {
+	f, err := os.Create(filepath.Join(watchdog.dir, name))
+	if err != nil {
+		return ""
+	}
+	err = pprof.Lookup(profile).WriteTo(f, debug)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return ""
+	}
+	return name
+}
@@ -7,10 +7,12 @@ package lsp
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/span"
 	"github.com/jackie-feng/tools/internal/telemetry/log"
 	"github.com/jackie-feng/tools/internal/telemetry/trace"
 )
@@ -18,6 +20,7 @@ import (
 func (s *Server) diagnose(snapshot source.Snapshot, fh source.FileHandle) error {
 	switch fh.Identity().Kind {
 	case source.Go:
+		s.runSnapshotHook(snapshot)
 		go s.diagnoseFile(snapshot, fh)
 	case source.Mod:
 		go s.diagnoseSnapshot(snapshot)
@@ -25,12 +28,63 @@ func (s *Server) diagnose(snapshot source.Snapshot, fh source.FileHandle) error
 	return nil
 }
 
+// changeDiagnosticsDelay is how long the server waits after a change to a
+// file before diagnosing it, so that a burst of changes is diagnosed once.
+const changeDiagnosticsDelay = 50 * time.Millisecond
+
+// diagnoseAfterChange diagnoses the file changed by a didChange notification,
+// unless it changes again within changeDiagnosticsDelay.
+func (s *Server) diagnoseAfterChange(view source.View, uri span.URI) {
+	s.changesMu.Lock()
+	if s.changes == nil {
+		s.changes = make(map[span.URI]uint64)
+	}
+	s.changes[uri]++
+	change := s.changes[uri]
+	s.changesMu.Unlock()
+
+	time.AfterFunc(changeDiagnosticsDelay, func() {
+		s.changesMu.Lock()
+		latest := s.changes[uri] == change
+		if latest {
+			delete(s.changes, uri)
+		}
+		s.changesMu.Unlock()
+		if !latest {
+			return
+		}
+		snapshot := view.Snapshot()
+		ctx := view.BackgroundContext()
+		fh, err := snapshot.GetFile(ctx, uri)
+		if err != nil {
+			log.Error(ctx, "diagnoseAfterChange: no file", err, telemetry.File.Of(uri))
+			return
+		}
+		s.diagnose(snapshot, fh)
+	})
+}
+
 func (s *Server) diagnoseSnapshot(snapshot source.Snapshot) {
 	ctx := snapshot.View().BackgroundContext()
 	ctx, done := trace.StartSpan(ctx, "lsp:background-worker")
 	defer done()
 
+	s.runSnapshotHook(snapshot)
 	for _, id := range snapshot.WorkspacePackageIDs(ctx) {
+		// In degraded mode, only report syntax errors for packages
+		// that have no open files, without building their handles.
+		// Open files are type-checked on demand.
+		if snapshot.View().Degraded() && !s.hasOpenFile(snapshot.CompiledGoFiles(ctx, id)) {
+			go func(id string) {
+				reports, err := source.SyntaxDiagnostics(ctx, snapshot, id)
+				if err != nil {
+					log.Error(ctx, "no syntax diagnostics", err, telemetry.Package.Of(id))
+					return
+				}
+				s.publishReports(ctx, reports, false)
+			}(id)
+			continue
+		}
 		ph, err := snapshot.PackageHandle(ctx, id)
 		if err != nil {
 			log.Error(ctx, "diagnoseSnapshot: no PackageHandle for workspace package", err, telemetry.Package.Of(id))
@@ -58,6 +112,26 @@ func (s *Server) diagnoseSnapshot(snapshot source.Snapshot) {
 	}
 }
 
+// runSnapshotHook passes the packages of snapshot to the SnapshotHook of its
+// view's options, if any.
+func (s *Server) runSnapshotHook(snapshot source.Snapshot) {
+	hook := snapshot.View().Options().SnapshotHook
+	if hook == nil {
+		return
+	}
+	go hook(snapshot.View().BackgroundContext(), source.ExportSnapshot(snapshot))
+}
+
+// hasOpenFile reports whether any of the files are open in the editor.
+func (s *Server) hasOpenFile(uris []span.URI) bool {
+	for _, uri := range uris {
+		if s.session.IsOpen(uri) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) diagnoseFile(snapshot source.Snapshot, fh source.FileHandle) {
 	ctx := snapshot.View().BackgroundContext()
 	ctx, done := trace.StartSpan(ctx, "lsp:background-worker")
@@ -121,6 +195,11 @@ func (s *Server) publishReports(ctx context.Context, reports map[source.FileIden
 				continue
 			}
 		}
+		// Failures from the background test runner are published alongside
+		// the file's other diagnostics, but are not cached with them.
+		if tests := s.testDiagnostics[fileID.URI]; len(tests) > 0 {
+			diagnostics = append(diagnostics[:len(diagnostics):len(diagnostics)], tests...)
+		}
 		if err := s.client.PublishDiagnostics(ctx, &protocol.PublishDiagnosticsParams{
 			Diagnostics: toProtocolDiagnostics(ctx, diagnostics),
 			URI:         protocol.NewURI(fileID.URI),
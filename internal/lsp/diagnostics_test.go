@@ -0,0 +1,111 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/jsonrpc2"
+	"github.com/jackie-feng/tools/internal/lsp/cache"
+	"github.com/jackie-feng/tools/internal/lsp/fake"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/testenv"
+)
+
+func TestDegradedDiagnostics(t *testing.T) {
+	testenv.NeedsTool(t, "go")
+
+	dir, err := ioutil.TempDir("", "gopls-degraded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const typeError = "package q\n\nvar y int = \"\"\n"
+	for name, content := range map[string]string{
+		"go.mod":  "module fake\n",
+		"p/p1.go": "package p\n\nfunc f() {\n",
+		"p/p2.go": "package p\n\nvar x int = \"\"\n",
+		"q/q.go":  typeError,
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p1 := span.FileURI(filepath.Join(dir, "p", "p1.go"))
+	p2 := span.FileURI(filepath.Join(dir, "p", "p2.go"))
+	q := span.FileURI(filepath.Join(dir, "q", "q.go"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sconn, cconn := net.Pipe()
+	defer cconn.Close()
+	srvCtx, srv := NewServer(ctx, cache.New(nil), jsonrpc2.NewHeaderStream(sconn, sconn))
+	go srv.Run(srvCtx)
+
+	// With a limit of one package, the workspace of two packages is
+	// handled in degraded mode.
+	client := fake.NewClient()
+	client.Settings = map[string]interface{}{
+		"env":                  map[string]interface{}{"GOPROXY": "off"},
+		"maxWorkspacePackages": 1,
+		"warmStart":            false,
+		"prefetch":             false,
+	}
+	ctx, conn, server := protocol.NewClient(ctx, jsonrpc2.NewHeaderStream(cconn, cconn), client)
+	go conn.Run(ctx)
+
+	params := &protocol.ParamInitialize{}
+	params.RootURI = protocol.NewURI(span.FileURI(dir))
+	params.Capabilities.Workspace.Configuration = true
+	if _, err := server.Initialize(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Initialized(ctx, &protocol.InitializedParams{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The packages without open files only get syntax diagnostics.
+	diags, err := client.AwaitDiagnostics(ctx, p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Source != "syntax" {
+		t.Errorf("got diagnostics %v for p1.go, want one syntax error", diags.Diagnostics)
+	}
+
+	// An open file is type-checked on demand.
+	if err := server.DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        protocol.NewURI(q),
+			LanguageID: "go",
+			Version:    1,
+			Text:       typeError,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	diags, err = client.AwaitDiagnostics(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Source != "compiler" {
+		t.Errorf("got diagnostics %v for the open q.go, want one type error", diags.Diagnostics)
+	}
+	if diags := client.Diagnostics(p2); diags != nil && len(diags.Diagnostics) > 0 {
+		t.Errorf("got diagnostics %v for p2.go, whose package is not open, want none", diags.Diagnostics)
+	}
+}
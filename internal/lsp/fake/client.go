@@ -0,0 +1,139 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fake provides a fake LSP client, to test gopls without an editor.
+package fake
+
+//go:generate go run mkclient.go
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+// Client is a protocol.Client that records the notifications and requests
+// it receives from the server, and answers the requests as a simple editor
+// would: configuration requests with Settings, workspace folder requests
+// with Folders, and edits by applying nothing. Other requests are answered
+// with empty results. Set Hooks to change how a method is answered.
+//
+// The methods of Client are generated by mkclient.go.
+type Client struct {
+	// Settings are the settings returned for the "gopls" section of
+	// workspace/configuration requests.
+	Settings map[string]interface{}
+
+	// Folders are the workspace folders returned by WorkspaceFolders.
+	Folders []protocol.WorkspaceFolder
+
+	// Hooks override the answers of the client.
+	// They must be set before the client is used.
+	Hooks Hooks
+
+	mu          sync.Mutex
+	messages    []Message
+	diagnostics map[span.URI]*protocol.PublishDiagnosticsParams
+	changed     chan struct{}
+}
+
+var _ protocol.Client = (*Client)(nil)
+
+// A Message is a notification or request received from the server.
+type Message struct {
+	// Method is the LSP method, such as "window/showMessage".
+	Method string
+
+	// Params are the parameters of the message, such as a
+	// *protocol.ShowMessageParams, or nil if it has none.
+	Params interface{}
+}
+
+// NewClient returns a client with no settings.
+func NewClient() *Client {
+	return &Client{
+		diagnostics: make(map[span.URI]*protocol.PublishDiagnosticsParams),
+		changed:     make(chan struct{}),
+	}
+}
+
+func (c *Client) record(method string, params interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = append(c.messages, Message{Method: method, Params: params})
+	if p, ok := params.(*protocol.PublishDiagnosticsParams); ok {
+		c.diagnostics[span.URI(p.URI)] = p
+	}
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Messages returns the messages received so far, in order.
+func (c *Client) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Message(nil), c.messages...)
+}
+
+// Diagnostics returns the last diagnostics published for uri, or nil if
+// none were.
+func (c *Client) Diagnostics(uri span.URI) *protocol.PublishDiagnosticsParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.diagnostics[uri]
+}
+
+// Await waits until the messages received so far satisfy cond, and returns
+// the error of ctx if it is done first.
+func (c *Client) Await(ctx context.Context, cond func([]Message) bool) error {
+	for {
+		c.mu.Lock()
+		ok := cond(c.messages)
+		changed := c.changed
+		c.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// AwaitDiagnostics waits until diagnostics are published for uri, and
+// returns the last ones.
+func (c *Client) AwaitDiagnostics(ctx context.Context, uri span.URI) (*protocol.PublishDiagnosticsParams, error) {
+	err := c.Await(ctx, func([]Message) bool {
+		return c.diagnostics[uri] != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Diagnostics(uri), nil
+}
+
+func (c *Client) configuration(ctx context.Context, params *protocol.ParamConfiguration) ([]interface{}, error) {
+	results := make([]interface{}, len(params.Items))
+	for i, item := range params.Items {
+		if item.Section == "gopls" && c.Settings != nil {
+			results[i] = c.Settings
+		}
+	}
+	return results, nil
+}
+
+func (c *Client) workspaceFolders(ctx context.Context) ([]protocol.WorkspaceFolder, error) {
+	return c.Folders, nil
+}
+
+func (c *Client) applyEdit(ctx context.Context, params *protocol.ApplyWorkspaceEditParams) (*protocol.ApplyWorkspaceEditResponse, error) {
+	return &protocol.ApplyWorkspaceEditResponse{Applied: false, FailureReason: "edits are not applied by the fake client"}, nil
+}
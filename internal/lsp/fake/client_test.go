@@ -0,0 +1,90 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/jsonrpc2"
+	"github.com/jackie-feng/tools/internal/lsp"
+	"github.com/jackie-feng/tools/internal/lsp/cache"
+	"github.com/jackie-feng/tools/internal/lsp/fake"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module fake\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(filename, []byte("package a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Connect the client to a server through the protocol, as an editor would.
+	sconn, cconn := net.Pipe()
+	defer cconn.Close()
+	srvCtx, srv := lsp.NewServer(ctx, cache.New(nil), jsonrpc2.NewHeaderStream(sconn, sconn))
+	go srv.Run(srvCtx)
+
+	client := fake.NewClient()
+	client.Settings = map[string]interface{}{"env": map[string]interface{}{"GOPROXY": "off"}}
+	ctx, conn, server := protocol.NewClient(ctx, jsonrpc2.NewHeaderStream(cconn, cconn), client)
+	go conn.Run(ctx)
+
+	params := &protocol.ParamInitialize{}
+	params.RootURI = protocol.NewURI(span.FileURI(dir))
+	params.Capabilities.Workspace.Configuration = true
+	if _, err := server.Initialize(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Initialized(ctx, &protocol.InitializedParams{}); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := span.FileURI(filename)
+	if err := server.DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        protocol.NewURI(uri),
+			LanguageID: "go",
+			Version:    1,
+			Text:       "package a\n\nvar x int = \"\"\n",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	diags, err := client.AwaitDiagnostics(ctx, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags.Diagnostics) != 1 {
+		t.Errorf("got %d diagnostics, want 1: %v", len(diags.Diagnostics), diags.Diagnostics)
+	}
+
+	var configured bool
+	for _, msg := range client.Messages() {
+		if msg.Method == "workspace/configuration" {
+			configured = true
+		}
+	}
+	if !configured {
+		t.Error("the server did not request the configuration")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// mkclient generates the zclient.go file, containing the methods of the fake
+// Client, from the protocol.Client interface in ../protocol/tsclient.go, so
+// that the fake keeps up with the protocol when it is regenerated.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// defaults are the methods whose default behavior is implemented by an
+// unexported method of Client with the same name, in client.go.
+// The other methods return zero values.
+var defaults = map[string]bool{
+	"ApplyEdit":        true,
+	"Configuration":    true,
+	"WorkspaceFolders": true,
+}
+
+type method struct {
+	name    string // the name of the Go method
+	wire    string // the name of the LSP method
+	params  []string
+	results []string
+}
+
+func main() {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "../protocol/tsclient.go", nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	methods := clientMethods(f)
+	if len(methods) == 0 {
+		log.Fatal("no Client interface in tsclient.go")
+	}
+	wire := wireMethods(f)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by mkclient.go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package fake\n\n")
+	fmt.Fprintf(&buf, "import (\n\"context\"\n\n\"github.com/jackie-feng/tools/internal/lsp/protocol\"\n)\n\n")
+
+	fmt.Fprintf(&buf, "// Hooks override the default behavior of a Client for some methods.\n")
+	fmt.Fprintf(&buf, "// A hook is called after the message is recorded.\n")
+	fmt.Fprintf(&buf, "type Hooks struct {\n")
+	for _, m := range methods {
+		m.wire = wire[m.name]
+		if m.wire == "" {
+			log.Fatalf("no LSP method for Client.%s", m.name)
+		}
+		fmt.Fprintf(&buf, "On%s func(%s) %s\n", m.name, strings.Join(m.params, ", "), resultList(m.results))
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	for _, m := range methods {
+		var params, args []string
+		for i, p := range m.params {
+			name := "ctx"
+			if i > 0 {
+				name = "params"
+			}
+			params = append(params, name+" "+p)
+			args = append(args, name)
+		}
+		argList := strings.Join(args, ", ")
+		recorded := "nil"
+		if len(args) > 1 {
+			recorded = "params"
+		}
+		fmt.Fprintf(&buf, "\nfunc (c *Client) %s(%s) %s {\n", m.name, strings.Join(params, ", "), resultList(m.results))
+		fmt.Fprintf(&buf, "c.record(%q, %s)\n", m.wire, recorded)
+		fmt.Fprintf(&buf, "if c.Hooks.On%s != nil {\nreturn c.Hooks.On%s(%s)\n}\n", m.name, m.name, argList)
+		switch {
+		case defaults[m.name]:
+			fmt.Fprintf(&buf, "return c.%s(%s)\n", lower(m.name), argList)
+		case len(m.results) == 1:
+			fmt.Fprintf(&buf, "return nil\n")
+		default:
+			fmt.Fprintf(&buf, "return nil, nil\n")
+		}
+		fmt.Fprintf(&buf, "}\n")
+	}
+
+	fmtbuf, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("zclient.go", fmtbuf, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// clientMethods returns the methods of the Client interface.
+func clientMethods(f *ast.File) []*method {
+	var methods []*method
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || spec.Name.Name != "Client" {
+			return true
+		}
+		iface := spec.Type.(*ast.InterfaceType)
+		for _, field := range iface.Methods.List {
+			fn := field.Type.(*ast.FuncType)
+			m := &method{name: field.Names[0].Name}
+			for _, p := range fn.Params.List {
+				m.params = append(m.params, typeString(p.Type))
+			}
+			for _, r := range fn.Results.List {
+				m.results = append(m.results, typeString(r.Type))
+			}
+			methods = append(methods, m)
+		}
+		return false
+	})
+	return methods
+}
+
+// wireMethods maps the names of the methods of the Client interface to the
+// LSP methods that clientHandler.Deliver dispatches to them.
+func wireMethods(f *ast.File) map[string]string {
+	wire := make(map[string]string)
+	ast.Inspect(f, func(n ast.Node) bool {
+		clause, ok := n.(*ast.CaseClause)
+		if !ok || len(clause.List) != 1 {
+			return true
+		}
+		lit, ok := clause.List[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		name, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		for _, stmt := range clause.Body {
+			ast.Inspect(stmt, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if x, ok := sel.X.(*ast.SelectorExpr); ok && x.Sel.Name == "client" {
+					wire[sel.Sel.Name] = name
+				}
+				return true
+			})
+		}
+		return false
+	})
+	return wire
+}
+
+// typeString returns the source of a type of the protocol package, as seen
+// from another package.
+func typeString(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if ast.IsExported(expr.Name) {
+			return "protocol." + expr.Name
+		}
+		return expr.Name
+	case *ast.SelectorExpr:
+		return typeString(expr.X.(*ast.Ident)) + "." + expr.Sel.Name
+	case *ast.StarExpr:
+		return "*" + typeString(expr.X)
+	case *ast.ArrayType:
+		return "[]" + typeString(expr.Elt)
+	case *ast.InterfaceType:
+		return "interface{}"
+	}
+	log.Fatalf("unexpected type %T", expr)
+	return ""
+}
+
+func resultList(results []string) string {
+	if len(results) == 1 {
+		return results[0]
+	}
+	return "(" + strings.Join(results, ", ") + ")"
+}
+
+func lower(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
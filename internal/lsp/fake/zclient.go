@@ -0,0 +1,104 @@
+// Code generated by mkclient.go. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+)
+
+// Hooks override the default behavior of a Client for some methods.
+// A hook is called after the message is recorded.
+type Hooks struct {
+	OnShowMessage          func(context.Context, *protocol.ShowMessageParams) error
+	OnLogMessage           func(context.Context, *protocol.LogMessageParams) error
+	OnEvent                func(context.Context, *interface{}) error
+	OnPublishDiagnostics   func(context.Context, *protocol.PublishDiagnosticsParams) error
+	OnWorkspaceFolders     func(context.Context) ([]protocol.WorkspaceFolder, error)
+	OnConfiguration        func(context.Context, *protocol.ParamConfiguration) ([]interface{}, error)
+	OnRegisterCapability   func(context.Context, *protocol.RegistrationParams) error
+	OnUnregisterCapability func(context.Context, *protocol.UnregistrationParams) error
+	OnShowMessageRequest   func(context.Context, *protocol.ShowMessageRequestParams) (*protocol.MessageActionItem, error)
+	OnApplyEdit            func(context.Context, *protocol.ApplyWorkspaceEditParams) (*protocol.ApplyWorkspaceEditResponse, error)
+}
+
+func (c *Client) ShowMessage(ctx context.Context, params *protocol.ShowMessageParams) error {
+	c.record("window/showMessage", params)
+	if c.Hooks.OnShowMessage != nil {
+		return c.Hooks.OnShowMessage(ctx, params)
+	}
+	return nil
+}
+
+func (c *Client) LogMessage(ctx context.Context, params *protocol.LogMessageParams) error {
+	c.record("window/logMessage", params)
+	if c.Hooks.OnLogMessage != nil {
+		return c.Hooks.OnLogMessage(ctx, params)
+	}
+	return nil
+}
+
+func (c *Client) Event(ctx context.Context, params *interface{}) error {
+	c.record("telemetry/event", params)
+	if c.Hooks.OnEvent != nil {
+		return c.Hooks.OnEvent(ctx, params)
+	}
+	return nil
+}
+
+func (c *Client) PublishDiagnostics(ctx context.Context, params *protocol.PublishDiagnosticsParams) error {
+	c.record("textDocument/publishDiagnostics", params)
+	if c.Hooks.OnPublishDiagnostics != nil {
+		return c.Hooks.OnPublishDiagnostics(ctx, params)
+	}
+	return nil
+}
+
+func (c *Client) WorkspaceFolders(ctx context.Context) ([]protocol.WorkspaceFolder, error) {
+	c.record("workspace/workspaceFolders", nil)
+	if c.Hooks.OnWorkspaceFolders != nil {
+		return c.Hooks.OnWorkspaceFolders(ctx)
+	}
+	return c.workspaceFolders(ctx)
+}
+
+func (c *Client) Configuration(ctx context.Context, params *protocol.ParamConfiguration) ([]interface{}, error) {
+	c.record("workspace/configuration", params)
+	if c.Hooks.OnConfiguration != nil {
+		return c.Hooks.OnConfiguration(ctx, params)
+	}
+	return c.configuration(ctx, params)
+}
+
+func (c *Client) RegisterCapability(ctx context.Context, params *protocol.RegistrationParams) error {
+	c.record("client/registerCapability", params)
+	if c.Hooks.OnRegisterCapability != nil {
+		return c.Hooks.OnRegisterCapability(ctx, params)
+	}
+	return nil
+}
+
+func (c *Client) UnregisterCapability(ctx context.Context, params *protocol.UnregistrationParams) error {
+	c.record("client/unregisterCapability", params)
+	if c.Hooks.OnUnregisterCapability != nil {
+		return c.Hooks.OnUnregisterCapability(ctx, params)
+	}
+	return nil
+}
+
+func (c *Client) ShowMessageRequest(ctx context.Context, params *protocol.ShowMessageRequestParams) (*protocol.MessageActionItem, error) {
+	c.record("window/showMessageRequest", params)
+	if c.Hooks.OnShowMessageRequest != nil {
+		return c.Hooks.OnShowMessageRequest(ctx, params)
+	}
+	return nil, nil
+}
+
+func (c *Client) ApplyEdit(ctx context.Context, params *protocol.ApplyWorkspaceEditParams) (*protocol.ApplyWorkspaceEditResponse, error) {
+	c.record("workspace/applyEdit", params)
+	if c.Hooks.OnApplyEdit != nil {
+		return c.Hooks.OnApplyEdit(ctx, params)
+	}
+	return c.applyEdit(ctx, params)
+}
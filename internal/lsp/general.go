@@ -29,6 +29,7 @@ func (s *Server) initialize(ctx context.Context, params *protocol.ParamInitializ
 	}
 	s.stateMu.Lock()
 	s.state = serverInitializing
+	s.params = params
 	s.stateMu.Unlock()
 
 	options := s.session.Options()
@@ -71,6 +72,7 @@ func (s *Server) initialize(ctx context.Context, params *protocol.ParamInitializ
 	return &protocol.InitializeResult{
 		Capabilities: protocol.ServerCapabilities{
 			CodeActionProvider: codeActionProvider,
+			CodeLensProvider:   protocol.CodeLensOptions{},
 			CompletionProvider: protocol.CompletionOptions{
 				TriggerCharacters: []string{"."},
 			},
@@ -79,6 +81,7 @@ func (s *Server) initialize(ctx context.Context, params *protocol.ParamInitializ
 			ImplementationProvider:     true,
 			DocumentFormattingProvider: true,
 			DocumentSymbolProvider:     true,
+			WorkspaceSymbolProvider:    true,
 			ExecuteCommandProvider: protocol.ExecuteCommandOptions{
 				Commands: options.SupportedCommands,
 			},
@@ -138,6 +141,11 @@ func (s *Server) initialized(ctx context.Context, params *protocol.InitializedPa
 				Watchers: []protocol.FileSystemWatcher{{
 					GlobPattern: "**/*.go",
 					Kind:        float64(protocol.WatchChange + protocol.WatchDelete + protocol.WatchCreate),
+				}, {
+					// Changes to the module files, such as by go get,
+					// reload the views.
+					GlobPattern: "**/go.{mod,sum}",
+					Kind:        float64(protocol.WatchChange + protocol.WatchDelete + protocol.WatchCreate),
 				}},
 			},
 		})
@@ -148,15 +156,18 @@ func (s *Server) initialized(ctx context.Context, params *protocol.InitializedPa
 			Registrations: registrations,
 		})
 	}
+	s.addPendingFolders(ctx)
+	return nil
+}
 
+// addPendingFolders creates the views of the folders given to initialize.
+func (s *Server) addPendingFolders(ctx context.Context) {
 	buf := &bytes.Buffer{}
 	debug.PrintVersionInfo(buf, true, debug.PlainText)
 	log.Print(ctx, buf.String())
 
 	s.addFolders(ctx, s.pendingFolders)
 	s.pendingFolders = nil
-
-	return nil
 }
 
 func (s *Server) addFolders(ctx context.Context, folders []protocol.WorkspaceFolder) {
@@ -165,11 +176,17 @@ func (s *Server) addFolders(ctx context.Context, folders []protocol.WorkspaceFol
 
 	for _, folder := range folders {
 		uri := span.NewURI(folder.URI)
-		_, snapshot, err := s.addView(ctx, folder.Name, span.NewURI(folder.URI))
+		view, snapshot, err := s.addView(ctx, folder.Name, span.NewURI(folder.URI))
 		if err != nil {
 			viewErrors[uri] = err
 			continue
 		}
+		if view.Degraded() {
+			s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
+				Type:    protocol.Warning,
+				Message: fmt.Sprintf("Workspace folder %s is too large, only syntax errors will be reported for files that are not open. See the maxWorkspacePackages and maxMemoryBytes settings.", folder.Name),
+			})
+		}
 		go s.diagnoseSnapshot(snapshot)
 	}
 	if len(viewErrors) > 0 {
@@ -188,49 +205,63 @@ func (s *Server) fetchConfig(ctx context.Context, name string, folder span.URI,
 	if !s.session.Options().ConfigurationSupported {
 		return nil
 	}
-	v := protocol.ParamConfiguration{
+	// Request the sections for this folder only, so that each workspace
+	// folder can be configured independently.
+	var items []protocol.ConfigurationItem
+	for _, section := range configSections(name) {
+		items = append(items, protocol.ConfigurationItem{
+			ScopeURI: protocol.NewURI(folder),
+			Section:  section,
+		})
+	}
+	configs, err := s.client.Configuration(ctx, &protocol.ParamConfiguration{
 		ConfigurationParams: protocol.ConfigurationParams{
-			Items: []protocol.ConfigurationItem{{
-				ScopeURI: protocol.NewURI(folder),
-				Section:  "gopls",
-			}, {
-				ScopeURI: protocol.NewURI(folder),
-				Section:  fmt.Sprintf("gopls-%s", name),
-			}},
+			Items: items,
 		},
-	}
-	configs, err := s.client.Configuration(ctx, &v)
+	})
 	if err != nil {
 		return err
 	}
 	for _, config := range configs {
-		results := source.SetOptions(o, config)
-		for _, result := range results {
-			if result.Error != nil {
-				s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
-					Type:    protocol.Error,
-					Message: result.Error.Error(),
-				})
-			}
-			switch result.State {
-			case source.OptionUnexpected:
-				s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
-					Type:    protocol.Error,
-					Message: fmt.Sprintf("unexpected config %s", result.Name),
-				})
-			case source.OptionDeprecated:
-				msg := fmt.Sprintf("config %s is deprecated", result.Name)
-				if result.Replacement != "" {
-					msg = fmt.Sprintf("%s, use %s instead", msg, result.Replacement)
-				}
-				s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
-					Type:    protocol.Warning,
-					Message: msg,
-				})
+		s.applyConfig(ctx, name, o, config)
+	}
+	return nil
+}
+
+// configSections returns the configuration sections that apply to the view
+// with the given name, in the order in which they are applied.
+func configSections(name string) []string {
+	return []string{"gopls", fmt.Sprintf("gopls-%s", name)}
+}
+
+// applyConfig sets the options in config on o, and reports any problems
+// with them to the user.
+func (s *Server) applyConfig(ctx context.Context, name string, o *source.Options, config interface{}) {
+	results := source.SetOptions(o, config)
+	for _, result := range results {
+		if result.Error != nil {
+			s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
+				Type:    protocol.Error,
+				Message: fmt.Sprintf("%s: %v", name, result.Error),
+			})
+		}
+		switch result.State {
+		case source.OptionUnexpected:
+			s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
+				Type:    protocol.Error,
+				Message: fmt.Sprintf("%s: unexpected config %s", name, result.Name),
+			})
+		case source.OptionDeprecated:
+			msg := fmt.Sprintf("%s: config %s is deprecated", name, result.Name)
+			if result.Replacement != "" {
+				msg = fmt.Sprintf("%s, use %s instead", msg, result.Replacement)
 			}
+			s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
+				Type:    protocol.Warning,
+				Message: msg,
+			})
 		}
 	}
-	return nil
 }
 
 func (s *Server) shutdown(ctx context.Context) error {
@@ -249,6 +280,8 @@ func (s *Server) exit(ctx context.Context) error {
 	s.stateMu.Lock()
 	defer s.stateMu.Unlock()
 	if s.state != serverShutDown {
+		// Close the views, as the client did not shut the server down.
+		s.session.Shutdown(ctx)
 		os.Exit(1)
 	}
 	os.Exit(0)
@@ -17,8 +17,9 @@ import (
 	"testing"
 
 	"github.com/jackie-feng/tools/go/packages/packagestest"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/cache"
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/lsp/fake"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
 	"github.com/jackie-feng/tools/internal/lsp/tests"
@@ -73,6 +74,7 @@ func testLSP(t *testing.T, exporter packagestest.Exporter) {
 	}
 	r := &runner{
 		server: &Server{
+			client:    fake.NewClient(),
 			session:   session,
 			delivered: map[span.URI]sentDiagnostics{},
 		},
@@ -267,6 +269,35 @@ func foldRanges(m *protocol.ColumnMapper, contents string, ranges []protocol.Fol
 	return res, nil
 }
 
+func (r *runner) SemanticTokens(t *testing.T, spn span.Span) {
+	uri := spn.URI()
+	result, err := r.server.executeCommand(r.ctx, &protocol.ExecuteCommandParams{
+		Command:   "semtok",
+		Arguments: []interface{}{protocol.NewURI(uri)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := result.(*source.SemanticTokens).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.data.Mapper(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tests.FormatSemanticTokens(m, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(r.data.Golden("semtok", uri.Filename(), func() ([]byte, error) {
+		return []byte(got), nil
+	}))
+	if want != got {
+		t.Errorf("semantic tokens failed for %s expected:\n%s\ngot:\n%s", uri.Filename(), want, got)
+	}
+}
+
 func (r *runner) Format(t *testing.T, spn span.Span) {
 	uri := spn.URI()
 	filename := uri.Filename()
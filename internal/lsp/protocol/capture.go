@@ -0,0 +1,94 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/jsonrpc2"
+	errors "golang.org/x/xerrors"
+)
+
+// Directions of captured messages.
+const (
+	// FromClient is the direction of the messages read by the server.
+	FromClient = "in"
+	// ToClient is the direction of the messages written by the server.
+	ToClient = "out"
+)
+
+// A CapturedMessage is a message of a captured session.
+// A capture file holds one JSON encoded CapturedMessage per line.
+type CapturedMessage struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"dir"`
+	Message   json.RawMessage `json:"msg"`
+}
+
+type captureStream struct {
+	stream jsonrpc2.Stream
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// CaptureStream returns a stream that records every message read from and
+// written to str in w, so that the session can be replayed later.
+// The messages that open and change documents hold their full contents,
+// so a capture also records the overlays of the session.
+func CaptureStream(str jsonrpc2.Stream, w io.Writer) jsonrpc2.Stream {
+	return &captureStream{stream: str, w: w}
+}
+
+func (s *captureStream) Read(ctx context.Context) ([]byte, int64, error) {
+	data, count, err := s.stream.Read(ctx)
+	if err == nil {
+		s.capture(FromClient, data)
+	}
+	return data, count, err
+}
+
+func (s *captureStream) Write(ctx context.Context, data []byte) (int64, error) {
+	s.capture(ToClient, data)
+	return s.stream.Write(ctx, data)
+}
+
+func (s *captureStream) capture(direction string, data []byte) {
+	line, err := json.Marshal(&CapturedMessage{
+		Time:      time.Now(),
+		Direction: direction,
+		Message:   json.RawMessage(data),
+	})
+	if err != nil {
+		return // not valid JSON; the connection reports the error
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(append(line, '\n'))
+}
+
+// ReadCapture reads the messages of a capture file written by a
+// CaptureStream.
+func ReadCapture(r io.Reader) ([]*CapturedMessage, error) {
+	var msgs []*CapturedMessage
+	scanner := bufio.NewScanner(r)
+	// Messages can hold whole files.
+	scanner.Buffer(nil, 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		msg := &CapturedMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), msg); err != nil {
+			return nil, errors.Errorf("line %d: %v", line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, scanner.Err()
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protocol_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/jsonrpc2"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+)
+
+func TestCaptureStream(t *testing.T) {
+	const (
+		request  = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+		response = `{"jsonrpc":"2.0","id":1,"result":{}}`
+	)
+	in := &bytes.Buffer{}
+	out := &bytes.Buffer{}
+	in.WriteString(request)
+	capture := &bytes.Buffer{}
+	stream := protocol.CaptureStream(jsonrpc2.NewStream(in, out), capture)
+
+	ctx := context.Background()
+	if _, _, err := stream.Read(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Write(ctx, []byte(response)); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := protocol.ReadCapture(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ dir, msg string }{
+		{protocol.FromClient, request},
+		{protocol.ToClient, response},
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(msgs), len(want))
+	}
+	for i, msg := range msgs {
+		if msg.Direction != want[i].dir || string(msg.Message) != want[i].msg || msg.Time.IsZero() {
+			t.Errorf("message %d: got %s %s at %v, want %s %s", i, msg.Direction, msg.Message, msg.Time, want[i].dir, want[i].msg)
+		}
+	}
+}
@@ -20,6 +20,17 @@ const (
 	RequestCancelledError = -32800
 )
 
+// SourceFixAll is the kind of source actions that fix all the problems in a
+// file that have an unambiguous fix. It was added in version 3.15 of the
+// protocol, after tsprotocol.go was generated.
+const SourceFixAll CodeActionKind = "source.fixAll"
+
+// SourceOrganizeImportsInPackage is the kind of source actions that organize
+// the imports of every file of a package. It is not part of the protocol,
+// but a sub-kind of SourceOrganizeImports, so that clients that organize the
+// imports of a file when it is saved do not run it too.
+const SourceOrganizeImportsInPackage CodeActionKind = "source.organizeImports.package"
+
 type DocumentUri = string
 
 type canceller struct{ jsonrpc2.EmptyHandler }
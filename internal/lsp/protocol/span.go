@@ -7,7 +7,11 @@
 package protocol
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/jackie-feng/tools/internal/span"
 	errors "golang.org/x/xerrors"
@@ -17,8 +21,25 @@ type ColumnMapper struct {
 	URI       span.URI
 	Converter *span.TokenConverter
 	Content   []byte
+
+	// checkpoints memoizes the UTF-16 columns of regularly spaced offsets
+	// of the long lines of Content, by line, so that the conversions on a
+	// line of several megabytes, as in minified or generated files, do not
+	// scan the line from its start.
+	mu          sync.Mutex
+	checkpoints map[int][]checkpoint
+}
+
+// A checkpoint is a rune boundary of a line, as a byte and a UTF-16 offset
+// from the start of the line.
+type checkpoint struct {
+	bytes, utf16 int
 }
 
+// checkpointInterval is the minimum number of bytes between two checkpoints
+// of a line, and the length above which a line has checkpoints.
+const checkpointInterval = 4096
+
 func NewURI(uri span.URI) string {
 	return string(uri)
 }
@@ -51,7 +72,17 @@ func (m *ColumnMapper) Range(s span.Span) (Range, error) {
 }
 
 func (m *ColumnMapper) Position(p span.Point) (Position, error) {
-	chr, err := span.ToUTF16Column(p, m.Content)
+	var chr int
+	var err error
+	if col := p.Column() - 1; col >= checkpointInterval && p.HasOffset() && p.Offset() <= len(m.Content) {
+		// Count the UTF-16 characters from the last checkpoint before p.
+		cps := m.lineCheckpoints(p.Line(), p.Offset()-col)
+		i := sort.Search(len(cps), func(i int) bool { return cps[i].bytes > col }) - 1
+		chr, err = span.ToUTF16Column(span.NewPoint(p.Line(), col-cps[i].bytes+1, p.Offset()), m.Content)
+		chr += cps[i].utf16
+	} else {
+		chr, err = span.ToUTF16Column(p, m.Content)
+	}
 	if err != nil {
 		return Position{}, err
 	}
@@ -92,7 +123,52 @@ func (m *ColumnMapper) Point(p Position) (span.Point, error) {
 		return span.Point{}, err
 	}
 	lineStart := span.NewPoint(line, 1, offset)
-	return span.FromUTF16Column(lineStart, int(p.Character)+1, m.Content)
+	chr := int(p.Character)
+	if chr >= checkpointInterval {
+		// Advance from the last checkpoint before p.
+		cps := m.lineCheckpoints(line, offset)
+		i := sort.Search(len(cps), func(i int) bool { return cps[i].utf16 > chr }) - 1
+		lineStart = span.NewPoint(line, cps[i].bytes+1, offset+cps[i].bytes)
+		chr -= cps[i].utf16
+	}
+	return span.FromUTF16Column(lineStart, chr+1, m.Content)
+}
+
+// lineCheckpoints returns the checkpoints of the line that starts at the
+// given offset, computing them on the first call. The first checkpoint is
+// the start of the line.
+func (m *ColumnMapper) lineCheckpoints(line, start int) []checkpoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cps, ok := m.checkpoints[line]; ok {
+		return cps
+	}
+	cps := []checkpoint{{0, 0}}
+	if start >= 0 && start <= len(m.Content) {
+		content := m.Content[start:]
+		if end := bytes.IndexByte(content, '\n'); end >= 0 {
+			content = content[:end]
+		}
+		next := checkpointInterval
+		for i, n := 0, 0; i < len(content); {
+			if i >= next {
+				cps = append(cps, checkpoint{i, n})
+				next = i + checkpointInterval
+			}
+			r, w := utf8.DecodeRune(content[i:])
+			if r >= 0x10000 {
+				// a two point rune
+				n++
+			}
+			n++
+			i += w
+		}
+	}
+	if m.checkpoints == nil {
+		m.checkpoints = make(map[int][]checkpoint)
+	}
+	m.checkpoints[line] = cps
+	return cps
 }
 
 func IsPoint(r Range) bool {
@@ -0,0 +1,70 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protocol_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestLongLine(t *testing.T) {
+	// A short line, then a long line of one, two and four byte runes,
+	// then a short line.
+	content := []byte("package p\n" + strings.Repeat("aé𐐀", 10000) + "\nvar x int\n")
+	uri := span.FileURI("/a.go")
+	m := &protocol.ColumnMapper{
+		URI:       uri,
+		Converter: span.NewContentConverter(uri.Filename(), content),
+		Content:   content,
+	}
+	const start = len("package p\n")
+	for offset, chr := start, 0; offset < len(content); {
+		line, col, err := m.Converter.ToPosition(offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := span.NewPoint(line, col, offset)
+		pos, err := m.Position(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == 2 && int(pos.Character) != chr {
+			t.Fatalf("Position(%v) = %v, want character %d", p, pos, chr)
+		}
+		got, err := m.Point(pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != p {
+			t.Fatalf("Point(%v) = %v, want %v", pos, got, p)
+		}
+		r, w := utf8.DecodeRune(content[offset:])
+		offset += w
+		chr++
+		if r >= 0x10000 {
+			chr++
+		}
+	}
+}
+
+func BenchmarkLongLine(b *testing.B) {
+	content := []byte(strings.Repeat("aé𐐀", 1<<18))
+	uri := span.FileURI("/a.go")
+	m := &protocol.ColumnMapper{
+		URI:       uri,
+		Converter: span.NewContentConverter(uri.Filename(), content),
+		Content:   content,
+	}
+	for i := 0; i < b.N; i++ {
+		offset := len(content) - 7*(i%1000) - 7
+		if _, err := m.Position(span.NewPoint(1, offset+1, offset)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -6,6 +6,8 @@ package lsp
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
@@ -34,6 +36,25 @@ func (s *Server) rename(ctx context.Context, params *protocol.RenameParams) (*pr
 	if err != nil {
 		return nil, err
 	}
+	if view.Options().RenameTests {
+		renames, err := ident.RenameTests(ctx, params.NewName)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, r := range renames {
+			for uri, e := range r.Edits {
+				edits[uri] = append(edits[uri], e...)
+			}
+			names = append(names, fmt.Sprintf("%s to %s", r.From, r.To))
+		}
+		if len(names) > 0 {
+			s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
+				Type:    protocol.Info,
+				Message: fmt.Sprintf("Also renamed %s. Please review these test names.", strings.Join(names, ", ")),
+			})
+		}
+	}
 	var docChanges []protocol.TextDocumentEdit
 	for uri, e := range edits {
 		fh, err := snapshot.GetFile(ctx, uri)
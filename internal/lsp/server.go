@@ -73,6 +73,20 @@ const (
 	serverShutDown
 )
 
+func (s serverState) String() string {
+	switch s {
+	case serverCreated:
+		return "created"
+	case serverInitializing:
+		return "initializing"
+	case serverInitialized:
+		return "initialized"
+	case serverShutDown:
+		return "shut down"
+	}
+	return "unknown"
+}
+
 type Server struct {
 	Conn   *jsonrpc2.Conn
 	client protocol.Client
@@ -82,6 +96,10 @@ type Server struct {
 
 	session source.Session
 
+	// params are the parameters of the initialize request.
+	// They are guarded by stateMu.
+	params *protocol.ParamInitialize
+
 	// changedFiles tracks files for which there has been a textDocument/didChange.
 	changedFiles map[span.URI]struct{}
 
@@ -92,6 +110,21 @@ type Server struct {
 	// delivered is a cache of the diagnostics that the server has sent.
 	deliveredMu sync.Mutex
 	delivered   map[span.URI]sentDiagnostics
+
+	// testDiagnostics holds the failures reported by the background
+	// test runner. It is guarded by deliveredMu.
+	testDiagnostics map[span.URI][]source.Diagnostic
+
+	// testRuns holds the test runs in progress, keyed by package directory,
+	// and testSlots limits how many of them may run at once.
+	testsMu   sync.Mutex
+	testRuns  map[string]*testRun
+	testSlots chan struct{}
+
+	// changes counts the changes to each file, so that a file is only
+	// diagnosed after the last change of a burst.
+	changesMu sync.Mutex
+	changes   map[span.URI]uint64
 }
 
 // sentDiagnostics is used to cache diagnostics that have been sent for a given file.
@@ -137,8 +170,8 @@ func (s *Server) DidChangeWatchedFiles(ctx context.Context, params *protocol.Did
 	return s.didChangeWatchedFiles(ctx, params)
 }
 
-func (s *Server) Symbol(context.Context, *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
-	return nil, notImplemented("Symbol")
+func (s *Server) Symbol(ctx context.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	return s.symbol(ctx, params)
 }
 
 func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
@@ -217,8 +250,8 @@ func (s *Server) CodeAction(ctx context.Context, params *protocol.CodeActionPara
 	return s.codeAction(ctx, params)
 }
 
-func (s *Server) CodeLens(context.Context, *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
-	return nil, nil // ignore
+func (s *Server) CodeLens(ctx context.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
+	return s.codeLens(ctx, params)
 }
 
 func (s *Server) ResolveCodeLens(context.Context, *protocol.CodeLens) (*protocol.CodeLens, error) {
@@ -0,0 +1,88 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	errors "golang.org/x/xerrors"
+)
+
+// SessionState is the state of an editor session that a server in another
+// process needs to take the session over: what the editor told the server
+// when it initialized it, and the files it has open.
+type SessionState struct {
+	// Initialize are the parameters of the initialize request, with the
+	// workspace folders of the session at the time of the handoff.
+	Initialize *protocol.ParamInitialize `json:"initialize"`
+
+	// Files are the open files, with their contents in the editor.
+	Files []protocol.TextDocumentItem `json:"files,omitempty"`
+}
+
+// SessionState returns the state of the session of s, or nil if the editor
+// has not initialized it yet.
+func (s *Server) SessionState(ctx context.Context) (*SessionState, error) {
+	s.stateMu.Lock()
+	state, params := s.state, s.params
+	s.stateMu.Unlock()
+	switch state {
+	case serverCreated:
+		return nil, nil
+	case serverInitialized:
+	default:
+		return nil, errors.Errorf("the session is %v", state)
+	}
+
+	init := *params
+	init.WorkspaceFolders = nil
+	for _, view := range s.session.Views() {
+		init.WorkspaceFolders = append(init.WorkspaceFolders, protocol.WorkspaceFolder{
+			URI:  protocol.NewURI(view.Folder()),
+			Name: view.Name(),
+		})
+	}
+	result := &SessionState{Initialize: &init}
+	for _, fh := range s.session.OpenFiles() {
+		data, _, err := fh.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		id := fh.Identity()
+		result.Files = append(result.Files, protocol.TextDocumentItem{
+			URI:        protocol.NewURI(id.URI),
+			LanguageID: id.Kind.String(),
+			Version:    id.Version,
+			Text:       string(data),
+		})
+	}
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].URI < result.Files[j].URI
+	})
+	return result, nil
+}
+
+// RestoreSession initializes s with the state of a session of another
+// server, as if the editor had initialized s and opened the files itself.
+// Unlike the initialized notification, it does not register capabilities,
+// which the editor already registered for the other server.
+func (s *Server) RestoreSession(ctx context.Context, state *SessionState) error {
+	if _, err := s.initialize(ctx, state.Initialize); err != nil {
+		return err
+	}
+	s.stateMu.Lock()
+	s.state = serverInitialized
+	s.stateMu.Unlock()
+	s.addPendingFolders(ctx)
+
+	for _, item := range state.Files {
+		if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{TextDocument: item}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
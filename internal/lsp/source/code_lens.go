@@ -0,0 +1,100 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"go/ast"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+)
+
+// CodeLens returns the code lenses of a file: a lens that runs go mod tidy
+// on a go.mod file, and a lens that runs each test and benchmark function
+// of a _test.go file. The lenses refer to the "tidy" and "test" commands.
+func CodeLens(ctx context.Context, snapshot Snapshot, fh FileHandle) ([]protocol.CodeLens, error) {
+	ctx, done := trace.StartSpan(ctx, "source.CodeLens")
+	defer done()
+
+	uri := fh.Identity().URI
+	switch fh.Identity().Kind {
+	case Mod:
+		return []protocol.CodeLens{{
+			Command: protocol.Command{
+				Title:     "run go mod tidy",
+				Command:   "tidy",
+				Arguments: []interface{}{protocol.NewURI(uri)},
+			},
+		}}, nil
+	case Go:
+		if !strings.HasSuffix(uri.Filename(), "_test.go") {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	file, m, _, err := snapshot.View().Session().Cache().ParseGoHandle(fh, ParseFull).Parse(ctx)
+	if file == nil {
+		return nil, err
+	}
+	fset := snapshot.View().Session().Cache().FileSet()
+	var lenses []protocol.CodeLens
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		var title string
+		switch {
+		case isTestFunc(fn, "Test", "T"):
+			title = "run test"
+		case isTestFunc(fn, "Benchmark", "B"):
+			title = "run benchmark"
+		default:
+			continue
+		}
+		rng, err := newMappedRange(fset, m, fn.Name.Pos(), fn.Name.End()).Range()
+		if err != nil {
+			return nil, err
+		}
+		lenses = append(lenses, protocol.CodeLens{
+			Range: rng,
+			Command: protocol.Command{
+				Title:     title,
+				Command:   "test",
+				Arguments: []interface{}{protocol.NewURI(uri), fn.Name.Name},
+			},
+		})
+	}
+	return lenses, nil
+}
+
+// isTestFunc reports whether fn is a function that go test runs, such as
+// func TestXxx(t *testing.T) for prefix "Test" and param "T". It checks the
+// syntax only, as the testing package may be imported under another name.
+func isTestFunc(fn *ast.FuncDecl, prefix, param string) bool {
+	if fn.Recv != nil || fn.Type.Results != nil || !strings.HasPrefix(fn.Name.Name, prefix) {
+		return false
+	}
+	if rest := fn.Name.Name[len(prefix):]; rest != "" {
+		if r, _ := utf8.DecodeRuneInString(rest); unicode.IsLower(r) {
+			return false
+		}
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == param
+}
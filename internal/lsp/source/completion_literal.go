@@ -11,7 +11,7 @@ import (
 	"strings"
 	"unicode"
 
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/snippet"
 	"github.com/jackie-feng/tools/internal/telemetry/log"
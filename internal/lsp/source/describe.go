@@ -0,0 +1,170 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/go/ast/astutil"
+	"github.com/jackie-feng/tools/go/types/typeutil"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+)
+
+// Description is the syntax and type information at a position, as
+// reported by the describe command.
+type Description struct {
+	// Path lists the kinds of the syntax nodes that enclose the position,
+	// innermost first, such as "Ident", "SelectorExpr", "CallExpr".
+	Path []string `json:"path"`
+
+	// Expr is the source of the innermost expression, if any.
+	Expr string `json:"expr,omitempty"`
+
+	// Object is the object denoted by the identifier at the position.
+	Object *ObjectDescription `json:"object,omitempty"`
+
+	// Type is the type of the innermost expression, or the type that it
+	// denotes, and Methods is its method set.
+	Type    string   `json:"type,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+
+	Package PackageDescription `json:"package"`
+}
+
+// ObjectDescription describes a types.Object.
+type ObjectDescription struct {
+	Name string `json:"name"`
+	// Kind is one of "var", "field", "func", "method", "const", "type",
+	// "imported package name", "label", "builtin", or "nil".
+	Kind        string `json:"kind"`
+	Package     string `json:"package,omitempty"`
+	Declaration string `json:"declaration,omitempty"`
+}
+
+// PackageDescription describes the package that a position was checked in.
+type PackageDescription struct {
+	ID       string   `json:"id"`
+	PkgPath  string   `json:"pkgPath"`
+	Name     string   `json:"name"`
+	Files    []string `json:"files"`
+	Imports  []string `json:"imports,omitempty"`
+	Errors   int      `json:"errors,omitempty"`
+	IllTyped bool     `json:"illTyped,omitempty"`
+}
+
+// Describe returns the syntax and type information at a position in a
+// file, to be consumed by tools or attached to bug reports.
+func Describe(ctx context.Context, snapshot Snapshot, fh FileHandle, pos protocol.Position) (*Description, error) {
+	ctx, done := trace.StartSpan(ctx, "source.Describe")
+	defer done()
+
+	pkg, pgh, err := getParsedFile(ctx, snapshot, fh, NarrowestCheckPackageHandle)
+	if err != nil {
+		return nil, fmt.Errorf("getting file for Describe: %v", err)
+	}
+	file, m, _, err := pgh.Cached()
+	if err != nil {
+		return nil, err
+	}
+	spn, err := m.PointSpan(pos)
+	if err != nil {
+		return nil, err
+	}
+	rng, err := spn.Range(m.Converter)
+	if err != nil {
+		return nil, err
+	}
+	path, _ := astutil.PathEnclosingInterval(file, rng.Start, rng.Start)
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no syntax at %v", spn)
+	}
+
+	fset := snapshot.View().Session().Cache().FileSet()
+	info := pkg.GetTypesInfo()
+	qf := types.RelativeTo(pkg.GetTypes())
+	result := &Description{
+		Package: describePackage(pkg),
+	}
+	for _, n := range path {
+		result.Path = append(result.Path, strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+	}
+
+	var obj types.Object
+	switch n := path[0].(type) {
+	case *ast.Ident:
+		obj = info.ObjectOf(n)
+	case *ast.ImportSpec:
+		obj = info.Implicits[n]
+	case *ast.BasicLit:
+		if len(path) > 1 {
+			if spec, ok := path[1].(*ast.ImportSpec); ok {
+				if spec.Name != nil {
+					obj = info.Defs[spec.Name]
+				} else {
+					obj = info.Implicits[spec]
+				}
+			}
+		}
+	}
+	if obj != nil {
+		result.Object = &ObjectDescription{
+			Name: obj.Name(),
+			Kind: objectKind(obj),
+		}
+		if obj.Pkg() != nil {
+			result.Object.Package = obj.Pkg().Path()
+		}
+		if obj.Pos().IsValid() {
+			result.Object.Declaration = fset.Position(obj.Pos()).String()
+		}
+	}
+
+	var typ types.Type
+	for _, n := range path {
+		if e, ok := n.(ast.Expr); ok {
+			result.Expr = types.ExprString(e)
+			typ = info.TypeOf(e)
+			break
+		}
+	}
+	if typ == nil && obj != nil {
+		typ = obj.Type()
+	}
+	if typ != nil && typ != types.Typ[types.Invalid] {
+		result.Type = types.TypeString(typ, qf)
+		if _, isPkg := obj.(*types.PkgName); !isPkg {
+			for _, sel := range typeutil.IntuitiveMethodSet(typ, nil) {
+				result.Methods = append(result.Methods, types.SelectionString(sel, qf))
+			}
+		}
+	}
+	return result, nil
+}
+
+func describePackage(pkg Package) PackageDescription {
+	desc := PackageDescription{
+		ID:       pkg.ID(),
+		PkgPath:  pkg.PkgPath(),
+		Errors:   len(pkg.GetErrors()),
+		IllTyped: pkg.IsIllTyped(),
+	}
+	if tpkg := pkg.GetTypes(); tpkg != nil {
+		desc.Name = tpkg.Name()
+	}
+	for _, pgh := range pkg.CompiledGoFiles() {
+		desc.Files = append(desc.Files, pgh.File().Identity().URI.Filename())
+	}
+	for _, imp := range pkg.Imports() {
+		desc.Imports = append(desc.Imports, imp.PkgPath())
+	}
+	sort.Strings(desc.Imports)
+	return desc
+}
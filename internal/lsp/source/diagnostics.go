@@ -7,6 +7,8 @@ package source
 import (
 	"context"
 	"fmt"
+	"go/scanner"
+	"path/filepath"
 
 	"github.com/jackie-feng/tools/go/analysis"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
@@ -43,8 +45,14 @@ func Diagnostics(ctx context.Context, snapshot Snapshot, fh FileHandle, withAnal
 	ctx, done := trace.StartSpan(ctx, "source.Diagnostics", telemetry.File.Of(fh.Identity().URI))
 	defer done()
 
+	dir := filepath.Dir(fh.Identity().URI.Filename())
 	phs, err := snapshot.PackageHandles(ctx, fh)
 	if err != nil {
+		// A module that cannot be fetched without authentication makes the
+		// whole load fail. Explain how to fix it on the go.mod file.
+		if modID, diag := privateModuleDiagnostic(ctx, snapshot, dir, err.Error()); diag != nil {
+			return map[FileIdentity][]Diagnostic{modID: {*diag}}, "", nil
+		}
 		return nil, "", err
 	}
 	ph, err := WidestCheckPackageHandle(phs)
@@ -80,6 +88,20 @@ func Diagnostics(ctx context.Context, snapshot Snapshot, fh FileHandle, withAnal
 		}
 		clearReports(snapshot, reports, e.File)
 	}
+	// Report the imports of private modules that could not be fetched on
+	// the go.mod file, or clear the report once they are fetched.
+	if modFH := modFileFor(ctx, snapshot, dir); modFH != nil {
+		clearReports(snapshot, reports, modFH.Identity())
+		for _, e := range pkg.GetErrors() {
+			if e.Kind != ListError {
+				continue
+			}
+			if modID, diag := privateModuleDiagnostic(ctx, snapshot, dir, e.Message); diag != nil {
+				reports[modID] = []Diagnostic{*diag}
+				break
+			}
+		}
+	}
 	// Run diagnostics for the package that this URI belongs to.
 	if !diagnostics(ctx, snapshot, pkg, reports) && withAnalysis {
 		// If we don't have any list, parse, or type errors, run analyses.
@@ -91,6 +113,10 @@ func Diagnostics(ctx context.Context, snapshot Snapshot, fh FileHandle, withAnal
 			log.Error(ctx, "failed to run analyses", err, telemetry.File.Of(fh.Identity().URI))
 		}
 	}
+	// In degraded mode, reverse dependencies are only type-checked on demand.
+	if snapshot.View().Degraded() {
+		return reports, warningMsg, nil
+	}
 	// Updates to the diagnostics for this package may need to be propagated.
 	for _, id := range snapshot.GetReverseDependencies(pkg.ID()) {
 		ph, err := snapshot.PackageHandle(ctx, id)
@@ -109,6 +135,50 @@ func Diagnostics(ctx context.Context, snapshot Snapshot, fh FileHandle, withAnal
 	return reports, warningMsg, nil
 }
 
+// SyntaxDiagnostics returns the parse errors for the files of the package
+// with the given ID, without type-checking the package or building a handle
+// for it. It is used for packages that are not open when the view is
+// running in degraded mode.
+func SyntaxDiagnostics(ctx context.Context, snapshot Snapshot, id string) (map[FileIdentity][]Diagnostic, error) {
+	ctx, done := trace.StartSpan(ctx, "source.SyntaxDiagnostics", telemetry.Package.Of(id))
+	defer done()
+
+	reports := make(map[FileIdentity][]Diagnostic)
+	for _, uri := range snapshot.CompiledGoFiles(ctx, id) {
+		fh, err := snapshot.GetFile(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		fileID := fh.Identity()
+		clearReports(snapshot, reports, fileID)
+
+		pgh := snapshot.View().Session().Cache().ParseGoHandle(fh, ParseFull)
+		_, m, parseErr, err := pgh.Parse(ctx)
+		if err != nil {
+			return nil, err
+		}
+		list, ok := parseErr.(scanner.ErrorList)
+		if !ok || list.Len() == 0 {
+			continue
+		}
+		// The first parser error is likely the root cause of the problem.
+		pos := list[0].Pos
+		pt := span.NewPoint(pos.Line, pos.Column, pos.Offset)
+		rng, err := m.Range(span.New(fileID.URI, pt, pt))
+		if err != nil {
+			log.Error(ctx, "no range for parse error", err, telemetry.File.Of(fileID.URI))
+			continue
+		}
+		addReports(ctx, reports, snapshot, fileID, &Diagnostic{
+			Range:    rng,
+			Message:  list[0].Msg,
+			Source:   "syntax",
+			Severity: protocol.SeverityError,
+		})
+	}
+	return reports, nil
+}
+
 type diagnosticSet struct {
 	listErrors, parseErrors, typeErrors []*Diagnostic
 }
@@ -121,9 +191,11 @@ func diagnostics(ctx context.Context, snapshot Snapshot, pkg Package, reports ma
 	diagSets := make(map[FileIdentity]*diagnosticSet)
 	for _, e := range pkg.GetErrors() {
 		diag := &Diagnostic{
-			Message:  e.Message,
-			Range:    e.Range,
-			Severity: protocol.SeverityError,
+			Message:        e.Message,
+			Range:          e.Range,
+			Severity:       protocol.SeverityError,
+			SuggestedFixes: e.SuggestedFixes,
+			Related:        e.Related,
 		}
 		set, ok := diagSets[e.File]
 		if !ok {
@@ -182,11 +254,15 @@ func analyses(ctx context.Context, snapshot Snapshot, ph PackageHandle, disabled
 		if onlyDeletions(e.SuggestedFixes) {
 			tags = append(tags, protocol.Unnecessary)
 		}
+		severity := e.Severity
+		if severity == 0 {
+			severity = protocol.SeverityWarning
+		}
 		addReports(ctx, reports, snapshot, e.File, &Diagnostic{
 			Range:          e.Range,
 			Message:        e.Message,
 			Source:         e.Category,
-			Severity:       protocol.SeverityWarning,
+			Severity:       severity,
 			Tags:           tags,
 			SuggestedFixes: e.SuggestedFixes,
 			Related:        e.Related,
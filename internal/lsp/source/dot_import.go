@@ -0,0 +1,172 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+	errors "golang.org/x/xerrors"
+)
+
+// RemoveDotImports returns the edits that turn the dot-imports of the file
+// into regular imports, qualifying the uses of the names they import.
+// A package that the file also imports under a name is qualified with that
+// name, and its dot-import is deleted.
+// It returns no edits if the file has no dot-imports.
+func RemoveDotImports(ctx context.Context, snapshot Snapshot, fh FileHandle) ([]protocol.TextEdit, error) {
+	ctx, done := trace.StartSpan(ctx, "source.RemoveDotImports")
+	defer done()
+
+	pkg, pgh, err := getParsedFile(ctx, snapshot, fh, NarrowestCheckPackageHandle)
+	if err != nil {
+		return nil, errors.Errorf("getting file for RemoveDotImports: %v", err)
+	}
+	file, m, _, err := pgh.Parse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info := pkg.GetTypesInfo()
+	view := snapshot.View()
+
+	var edits []protocol.TextEdit
+	add := func(start, end token.Pos, text string) error {
+		mrng, err := posToRange(view, m, start, end)
+		if err != nil {
+			return err
+		}
+		rng, err := mrng.Range()
+		if err != nil {
+			return err
+		}
+		edits = append(edits, protocol.TextEdit{Range: rng, NewText: text})
+		return nil
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if spec.Name == nil || spec.Name.Name != "." {
+				continue
+			}
+			imported := importedPackage(pkg.GetTypes(), spec)
+			if imported == nil {
+				return nil, errors.Errorf("no type information for the import of %s", spec.Path.Value)
+			}
+
+			// Qualify the uses with the name of an existing import of the
+			// package, or with the name of the package.
+			named := namedImport(file, info, imported)
+			name := imported.Name()
+			if named != nil {
+				name = named.Name()
+			}
+			for _, id := range unqualifiedIdents(file) {
+				obj := info.Uses[id]
+				if obj == nil || obj.Pkg() != imported || obj.Parent() != imported.Scope() {
+					continue
+				}
+				if found := lookup(pkg.GetTypes(), name, id.Pos()); found != nil && found != named {
+					return nil, errors.Errorf("cannot qualify %s with %s: %s is declared at %v", id.Name, name, name, view.Session().Cache().FileSet().Position(found.Pos()))
+				}
+				if err := add(id.Pos(), id.Pos(), name+"."); err != nil {
+					return nil, err
+				}
+			}
+
+			switch {
+			case named == nil:
+				// Remove the dot and the space that follows it.
+				err = add(spec.Name.Pos(), spec.Path.Pos(), "")
+			case len(gen.Specs) == 1:
+				err = add(gen.Pos(), gen.End(), "")
+			default:
+				err = add(spec.Pos(), spec.End(), "")
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(edits, func(i, j int) bool {
+		return protocol.ComparePosition(edits[i].Range.Start, edits[j].Range.Start) < 0
+	})
+	return edits, nil
+}
+
+// namedImport returns the name under which file imports the package
+// imported, other than a dot-import or a blank import, or nil.
+func namedImport(file *ast.File, info *types.Info, imported *types.Package) *types.PkgName {
+	for _, spec := range file.Imports {
+		if spec.Name != nil && (spec.Name.Name == "." || spec.Name.Name == "_") {
+			continue
+		}
+		if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != imported.Path() {
+			continue
+		}
+		var obj types.Object
+		if spec.Name != nil {
+			obj = info.Defs[spec.Name]
+		} else {
+			obj = info.Implicits[spec]
+		}
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			return pkgName
+		}
+	}
+	return nil
+}
+
+// unqualifiedIdents returns the identifiers of file, except the selectors
+// of selector expressions.
+func unqualifiedIdents(file *ast.File) []*ast.Ident {
+	var ids []*ast.Ident
+	var visit func(ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.Ident:
+			ids = append(ids, n)
+		}
+		return true
+	}
+	ast.Inspect(file, visit)
+	return ids
+}
+
+// importedPackage returns the package imported by spec, or nil.
+func importedPackage(pkg *types.Package, spec *ast.ImportSpec) *types.Package {
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return nil
+	}
+	for _, imp := range pkg.Imports() {
+		if imp.Path() == path {
+			return imp
+		}
+	}
+	return nil
+}
+
+// lookup returns the object that name refers to at pos, or nil.
+func lookup(pkg *types.Package, name string, pos token.Pos) types.Object {
+	scope := pkg.Scope().Innermost(pos)
+	if scope == nil {
+		return nil
+	}
+	_, obj := scope.LookupParent(name, pos)
+	return obj
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+
+	"github.com/jackie-feng/tools/internal/span"
+	errors "golang.org/x/xerrors"
+)
+
+// SnapshotPackages is a read-only view of the type-checked packages of a
+// snapshot, for tools built on gopls, such as code generators, that would
+// otherwise load and type-check the packages again with go/packages.
+//
+// The packages are shared with gopls and with the later snapshots in which
+// they are unchanged, so their syntax trees and type information must not
+// be modified. The packages outside the workspace may be type-checked
+// without their function bodies.
+type SnapshotPackages interface {
+	// Folder returns the folder of the snapshot's view.
+	Folder() span.URI
+
+	// WorkspacePackages returns the packages of the workspace, type-checking
+	// those that have not yet been type-checked in this snapshot.
+	WorkspacePackages(ctx context.Context) ([]Package, error)
+
+	// PackagesForFile returns the packages that contain the given file.
+	PackagesForFile(ctx context.Context, uri span.URI) ([]Package, error)
+
+	// Package returns the package with the given import path, which must be
+	// a workspace package or a dependency of a type-checked package.
+	Package(ctx context.Context, pkgPath string) (Package, error)
+}
+
+// ExportSnapshot returns a read-only view of the packages of snapshot.
+func ExportSnapshot(snapshot Snapshot) SnapshotPackages {
+	return exportedSnapshot{snapshot}
+}
+
+type exportedSnapshot struct {
+	snapshot Snapshot
+}
+
+func (s exportedSnapshot) Folder() span.URI {
+	return s.snapshot.View().Folder()
+}
+
+func (s exportedSnapshot) WorkspacePackages(ctx context.Context) ([]Package, error) {
+	var pkgs []Package
+	for _, id := range s.snapshot.WorkspacePackageIDs(ctx) {
+		ph, err := s.snapshot.PackageHandle(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		pkg, err := ph.Check(ctx)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+func (s exportedSnapshot) PackagesForFile(ctx context.Context, uri span.URI) ([]Package, error) {
+	fh, err := s.snapshot.GetFile(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	phs, err := s.snapshot.PackageHandles(ctx, fh)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	for _, ph := range phs {
+		pkg, err := ph.Check(ctx)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+func (s exportedSnapshot) Package(ctx context.Context, pkgPath string) (Package, error) {
+	pkgs, err := s.WorkspacePackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		if pkg.PkgPath() == pkgPath {
+			return pkg, nil
+		}
+	}
+	if pkg, ok := s.snapshot.KnownImportPaths()[pkgPath]; ok {
+		return pkg, nil
+	}
+	return nil, errors.Errorf("no package %s in %s", pkgPath, s.Folder())
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackie-feng/tools/go/analysis"
+	"github.com/jackie-feng/tools/go/analysis/passes/assign"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+)
+
+// fixAllAnalyzers are the analyzers whose suggested fixes can be applied
+// without review, because they never change the meaning of a correct program.
+var fixAllAnalyzers = map[string]bool{
+	assign.Analyzer.Name: true, // removes self-assignments
+}
+
+// FixAll returns the edits that apply every safe fix for the file: the import
+// fixes of organize imports, and the suggested fixes of fixAllAnalyzers.
+// Fixes that offer alternatives, affect other files, or overlap an earlier
+// fix are skipped.
+func FixAll(ctx context.Context, snapshot Snapshot, fh FileHandle) ([]protocol.TextEdit, error) {
+	ctx, done := trace.StartSpan(ctx, "source.FixAll")
+	defer done()
+
+	importEdits, _, err := AllImportsFixes(ctx, snapshot, fh)
+	if err != nil {
+		return nil, err
+	}
+	fixes := [][]protocol.TextEdit{importEdits}
+
+	phs, err := snapshot.PackageHandles(ctx, fh)
+	if err != nil {
+		return nil, err
+	}
+	ph, err := WidestCheckPackageHandle(phs)
+	if err != nil {
+		return nil, err
+	}
+	options := snapshot.View().Options()
+	var analyzers []*analysis.Analyzer
+	for _, a := range options.Analyzers {
+		if _, ok := options.DisabledAnalyses[a.Name]; ok {
+			continue
+		}
+		if fixAllAnalyzers[a.Name] {
+			analyzers = append(analyzers, a)
+		}
+	}
+	errs, err := snapshot.Analyze(ctx, ph.ID(), analyzers)
+	if err != nil {
+		return nil, err
+	}
+	uri := fh.Identity().URI
+	for _, e := range errs {
+		if e.File.URI != uri || len(e.SuggestedFixes) != 1 {
+			continue
+		}
+		fix := e.SuggestedFixes[0]
+		if len(fix.Edits) != 1 || fix.Edits[uri] == nil {
+			continue
+		}
+		fixes = append(fixes, fix.Edits[uri])
+	}
+	return mergeFixes(fixes), nil
+}
+
+// mergeFixes combines the edits of several fixes into a single sorted list
+// of edits. A fix whose edits overlap those of an earlier fix is dropped
+// as a whole.
+func mergeFixes(fixes [][]protocol.TextEdit) []protocol.TextEdit {
+	var result []protocol.TextEdit
+	for _, edits := range fixes {
+		ok := true
+		for _, edit := range edits {
+			for _, prev := range result {
+				if overlaps(edit.Range, prev.Range) {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			result = append(result, edits...)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return protocol.ComparePosition(result[i].Range.Start, result[j].Range.Start) < 0
+	})
+	return result
+}
+
+// overlaps reports whether two ranges share any position, or are both
+// insertions at the same position, whose order would be ambiguous.
+func overlaps(a, b protocol.Range) bool {
+	if protocol.ComparePosition(a.Start, b.Start) == 0 {
+		return true
+	}
+	return protocol.ComparePosition(a.Start, b.End) < 0 && protocol.ComparePosition(b.Start, a.End) < 0
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+)
+
+func TestMergeFixes(t *testing.T) {
+	edit := func(line, start, end float64, text string) protocol.TextEdit {
+		return protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: line, Character: start},
+				End:   protocol.Position{Line: line, Character: end},
+			},
+			NewText: text,
+		}
+	}
+	fixes := [][]protocol.TextEdit{
+		{edit(2, 0, 10, "")},
+		{edit(8, 4, 9, "x"), edit(5, 0, 3, "")},
+		{edit(2, 5, 12, "y"), edit(9, 0, 1, "")}, // overlaps the first fix
+		{edit(8, 4, 4, "z")},                     // inserts where the second fix starts
+		{edit(8, 9, 9, "w")},                     // inserts where the second fix ends
+	}
+	got := mergeFixes(fixes)
+	want := []protocol.TextEdit{
+		edit(2, 0, 10, ""),
+		edit(5, 0, 3, ""),
+		edit(8, 4, 9, "x"),
+		edit(8, 9, 9, "w"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeFixes: got %v, want %v", got, want)
+	}
+}
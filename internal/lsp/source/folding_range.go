@@ -15,7 +15,21 @@ type FoldingRangeInfo struct {
 }
 
 // FoldingRange gets all of the folding range for f.
-func FoldingRange(ctx context.Context, snapshot Snapshot, fh FileHandle, lineFoldingOnly bool) (ranges []*FoldingRangeInfo, err error) {
+func FoldingRange(ctx context.Context, snapshot Snapshot, fh FileHandle, lineFoldingOnly bool) ([]*FoldingRangeInfo, error) {
+	kind := FoldingRangesResult
+	if lineFoldingOnly {
+		kind = LineFoldingRangesResult
+	}
+	v, err := snapshot.FileResult(ctx, fh, kind, func(ctx context.Context) (interface{}, error) {
+		return foldingRanges(ctx, snapshot, fh, lineFoldingOnly)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]*FoldingRangeInfo), nil
+}
+
+func foldingRanges(ctx context.Context, snapshot Snapshot, fh FileHandle, lineFoldingOnly bool) (ranges []*FoldingRangeInfo, err error) {
 	// TODO(suzmue): consider limiting the number of folding ranges returned, and
 	// implement a way to prioritize folding ranges in that case.
 	pgh := snapshot.View().Session().Cache().ParseGoHandle(fh, ParseFull)
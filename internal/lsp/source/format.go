@@ -15,8 +15,8 @@ import (
 	"go/scanner"
 	"go/token"
 
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/imports"
-	"github.com/jackie-feng/tools/internal/lsp/diff"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/span"
 	"github.com/jackie-feng/tools/internal/telemetry/trace"
@@ -0,0 +1,109 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+// TestDiagnostics runs the tests of the package in dir and returns
+// diagnostics for the failures that they report, keyed by the file in which
+// the failures occurred.
+func TestDiagnostics(ctx context.Context, view View, dir string) (map[span.URI][]Diagnostic, error) {
+	cfg := view.Config(ctx)
+
+	args := append([]string{"test"}, cfg.BuildFlags...)
+	args = append(args, ".")
+
+	// go test exits with a non-zero status if any test fails,
+	// so only treat the error as fatal if there is no output to parse.
+	stdout, err := InvokeGo(ctx, dir, cfg.Env, args...)
+	if stdout == nil {
+		return nil, err
+	}
+	return parseTestOutput(dir, stdout.Bytes()), nil
+}
+
+// RunTest runs the test or benchmark function name of the package in dir,
+// and returns the output of go test. A failing test is not an error: its
+// output reports the failure.
+func RunTest(ctx context.Context, view View, dir, name string) (string, error) {
+	cfg := view.Config(ctx)
+
+	args := append([]string{"test"}, cfg.BuildFlags...)
+	if strings.HasPrefix(name, "Benchmark") {
+		args = append(args, "-run=^$", "-bench=^"+regexp.QuoteMeta(name)+"$")
+	} else {
+		args = append(args, "-run=^"+regexp.QuoteMeta(name)+"$")
+	}
+	args = append(args, ".")
+
+	stdout, err := InvokeGo(ctx, dir, cfg.Env, args...)
+	if stdout == nil {
+		return "", err
+	}
+	out := stdout.String()
+	if err != nil {
+		out += err.Error()
+	}
+	return out, nil
+}
+
+// testFailureRx matches the lines produced by t.Error and friends,
+// e.g. "    foo_test.go:12: got 1, want 2".
+var testFailureRx = regexp.MustCompile(`^(\s+)([^\s:]+\.go):(\d+): (.*)$`)
+
+// parseTestOutput extracts the failures reported in the output of go test,
+// run in the given directory. Lines that are indented further than
+// a failure are treated as a continuation of its message.
+func parseTestOutput(dir string, out []byte) map[span.URI][]Diagnostic {
+	reports := make(map[span.URI][]Diagnostic)
+
+	var (
+		last   *Diagnostic
+		indent int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := testFailureRx.FindStringSubmatch(line); m != nil {
+			lineNum, err := strconv.Atoi(m[3])
+			if err != nil || lineNum < 1 {
+				last = nil
+				continue
+			}
+			filename := m[2]
+			if !filepath.IsAbs(filename) {
+				filename = filepath.Join(dir, filename)
+			}
+			uri := span.FileURI(filename)
+			pos := protocol.Position{Line: float64(lineNum - 1)}
+			reports[uri] = append(reports[uri], Diagnostic{
+				Range:    protocol.Range{Start: pos, End: pos},
+				Message:  m[4],
+				Source:   "go test",
+				Severity: protocol.SeverityError,
+			})
+			last = &reports[uri][len(reports[uri])-1]
+			indent = len(m[1])
+			continue
+		}
+		if last != nil && len(line)-len(strings.TrimLeft(line, " \t")) > indent {
+			last.Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		last = nil
+	}
+	return reports
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+func TestParseTestOutput(t *testing.T) {
+	const out = `--- FAIL: TestAdd (0.00s)
+    add_test.go:12: got 3, want 4
+    add_test.go:15: unexpected result:
+        first line
+        second line
+--- FAIL: TestSub (0.00s)
+    sub_test.go:7: oops
+FAIL
+FAIL	example.com/calc	0.003s
+`
+	dir := filepath.FromSlash("/src/calc")
+	reports := parseTestOutput(dir, []byte(out))
+
+	add := span.FileURI(filepath.Join(dir, "add_test.go"))
+	sub := span.FileURI(filepath.Join(dir, "sub_test.go"))
+	if len(reports) != 2 {
+		t.Fatalf("got reports for %d files, want 2", len(reports))
+	}
+	for _, test := range []struct {
+		uri     span.URI
+		i       int
+		line    float64
+		message string
+	}{
+		{add, 0, 11, "got 3, want 4"},
+		{add, 1, 14, "unexpected result:\nfirst line\nsecond line"},
+		{sub, 0, 6, "oops"},
+	} {
+		diags := reports[test.uri]
+		if len(diags) <= test.i {
+			t.Errorf("%s: got %d diagnostics, want at least %d", test.uri, len(diags), test.i+1)
+			continue
+		}
+		d := diags[test.i]
+		if d.Range.Start.Line != test.line {
+			t.Errorf("%s: got line %v, want %v", test.uri, d.Range.Start.Line, test.line)
+		}
+		if d.Message != test.message {
+			t.Errorf("%s: got message %q, want %q", test.uri, d.Message, test.message)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"strings"
 
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
 	"github.com/jackie-feng/tools/internal/telemetry/trace"
 	errors "golang.org/x/xerrors"
 )
@@ -40,6 +41,21 @@ type HoverInformation struct {
 	// SymbolName is the types.Object.Name for the given symbol.
 	SymbolName string
 
+	// ImportPath is the import path of the package that declares the
+	// symbol, or of the package that it names if it is an imported
+	// package name. It is empty for the predeclared symbols.
+	ImportPath string `json:"importPath,omitempty"`
+
+	// Examples are the examples of the symbol, if hoverExamples is set and
+	// the full documentation or the structured hover is requested.
+	Examples []HoverExample `json:"examples,omitempty"`
+
+	// TypeDeclaration is the source of the declaration of the symbol's type,
+	// or of the symbol itself if it is a type, with its doc comment, so that
+	// clients can show it in a peek window. It is only set for the
+	// structured hover kind.
+	TypeDeclaration string `json:"typeDeclaration,omitempty"`
+
 	source  interface{}
 	comment *ast.CommentGroup
 }
@@ -65,15 +81,81 @@ func (i *IdentifierInfo) Hover(ctx context.Context) (*HoverInformation, error) {
 	}
 	if obj := i.Declaration.obj; obj != nil {
 		h.SingleLine = objectString(obj, i.qf)
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			h.ImportPath = pkgName.Imported().Path()
+		} else if obj.Pkg() != nil {
+			h.ImportPath = obj.Pkg().Path()
+		}
 	}
 	h.Link, h.SymbolName = i.linkAndSymbolName()
 	if h.comment != nil {
 		h.FullDocumentation = h.comment.Text()
 		h.Synopsis = doc.Synopsis(h.FullDocumentation)
 	}
+	options := i.Snapshot.View().Options()
+	if (options.HoverKind == FullDocumentation || options.HoverKind == Structured) && options.HoverExamples > 0 {
+		h.Examples = i.examples(ctx, options.HoverExamples)
+	}
+	if options.HoverKind == Structured {
+		h.TypeDeclaration = i.typeDeclaration()
+	}
 	return h, nil
 }
 
+// typeDeclaration returns the source of the declaration of the type of the
+// identifier, or of the identifier itself if it denotes a type, starting at
+// its doc comment. It returns "" if the type has no declaration in source,
+// like the predeclared types.
+func (i *IdentifierInfo) typeDeclaration() string {
+	obj := i.Type.Object
+	if typeName, ok := i.Declaration.obj.(*types.TypeName); ok {
+		obj = typeName
+	}
+	if obj == nil || obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return ""
+	}
+	view := i.Snapshot.View()
+	decl, err := objToNode(view, i.pkg, obj)
+	if err != nil {
+		return ""
+	}
+	gen, ok := decl.(*ast.GenDecl)
+	if !ok {
+		return ""
+	}
+	var spec *ast.TypeSpec
+	for _, s := range gen.Specs {
+		if s, ok := s.(*ast.TypeSpec); ok && s.Name.Pos() == obj.Pos() {
+			spec = s
+		}
+	}
+	if spec == nil {
+		return ""
+	}
+	fset := view.Session().Cache().FileSet()
+	tok := fset.File(spec.Pos())
+	m, err := view.FindMapperInPackage(i.pkg, span.FileURI(tok.Name()))
+	if err != nil {
+		return ""
+	}
+	text := func(n ast.Node) string {
+		return string(m.Content[tok.Offset(n.Pos()):tok.Offset(n.End())])
+	}
+	if !gen.Lparen.IsValid() {
+		// A single type declaration, not in a group.
+		if gen.Doc != nil {
+			return text(gen.Doc) + "\n" + text(gen)
+		}
+		return text(gen)
+	}
+	// A type of a group: remove the indentation of the group.
+	src := "type " + text(spec)
+	if spec.Doc != nil {
+		src = text(spec.Doc) + "\n" + src
+	}
+	return strings.Replace(src, "\n\t", "\n", -1)
+}
+
 func (i *IdentifierInfo) linkAndSymbolName() (string, string) {
 	obj := i.Declaration.obj
 	if obj == nil {
@@ -268,7 +350,7 @@ func FormatHover(h *HoverInformation, options Options) (string, error) {
 		return formatHover(options, doc, link, signature), nil
 	case FullDocumentation:
 		doc := formatDoc(h.FullDocumentation, options)
-		return formatHover(options, signature, link, doc), nil
+		return formatHover(options, signature, link, doc, formatExamples(h.Examples, options)), nil
 	}
 	return "", errors.Errorf("no hover for %v", h.source)
 }
@@ -295,6 +377,22 @@ func formatSignature(signature string, options Options) string {
 	return signature
 }
 
+func formatExamples(examples []HoverExample, options Options) string {
+	var parts []string
+	for _, ex := range examples {
+		code := ex.Code
+		if ex.Output != "" {
+			code += "\n\nOutput:\n" + strings.TrimSuffix(ex.Output, "\n")
+		}
+		if options.PreferredContentFormat == protocol.Markdown {
+			parts = append(parts, fmt.Sprintf("%s:\n```go\n%s\n```", ex.Name, code))
+		} else {
+			parts = append(parts, ex.Name+":\n"+code)
+		}
+	}
+	return formatHover(options, parts...)
+}
+
 func formatDoc(doc string, options Options) string {
 	if options.PreferredContentFormat == protocol.Markdown {
 		return CommentToMarkdown(doc)
@@ -0,0 +1,147 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/doc"
+	"go/format"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+// HoverExample is an example function of a symbol's package, named after
+// the symbol, such as ExampleFoo or ExampleFoo_second for Foo.
+type HoverExample struct {
+	// Name is the name of the example function.
+	Name string `json:"name"`
+
+	// Code is the code of the example, as a complete program if it can be
+	// run on its own, or else the body of the example function.
+	Code string `json:"code"`
+
+	// Output is the expected output of the example, if any.
+	Output string `json:"output,omitempty"`
+}
+
+// examples returns at most max of the examples of the symbol that i refers
+// to. The examples are found in the test files of the directory of the
+// symbol's declaration, which may not be loaded, as for dependencies.
+func (i *IdentifierInfo) examples(ctx context.Context, max int) []HoverExample {
+	obj := i.Declaration.obj
+	name := exampleSymbol(obj)
+	if name == "" {
+		return nil
+	}
+	fset := i.Snapshot.View().Session().Cache().FileSet()
+	dir := filepath.Dir(fset.Position(obj.Pos()).Filename)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []*ast.File
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), "_test.go") {
+			continue
+		}
+		fh := i.Snapshot.View().Session().GetFile(span.FileURI(filepath.Join(dir, info.Name())), Go)
+		file, _, _, err := i.Snapshot.View().Session().Cache().ParseGoHandle(fh, ParseFull).Parse(ctx)
+		if err != nil {
+			continue
+		}
+		if pkg := file.Name.Name; pkg == obj.Pkg().Name() || pkg == obj.Pkg().Name()+"_test" {
+			files = append(files, file)
+		}
+	}
+
+	var examples []HoverExample
+	for _, ex := range doc.Examples(files...) {
+		if len(examples) == max {
+			break
+		}
+		if !isExampleOf(ex.Name, name) {
+			continue
+		}
+		code := exampleCode(fset, ex)
+		if code == "" {
+			continue
+		}
+		examples = append(examples, HoverExample{
+			Name:   "Example" + ex.Name,
+			Code:   code,
+			Output: ex.Output,
+		})
+	}
+	return examples
+}
+
+// exampleSymbol returns the name of the examples of obj, as returned by
+// doc.Examples: the name of a package-level function or type, or T_M for
+// the method M of type T, or "" if obj may not have examples.
+func exampleSymbol(obj types.Object) string {
+	if obj == nil || obj.Pkg() == nil || !obj.Exported() {
+		return ""
+	}
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		if obj.Parent() == obj.Pkg().Scope() {
+			return obj.Name()
+		}
+	case *types.Func:
+		recv := obj.Type().(*types.Signature).Recv()
+		if recv == nil {
+			return obj.Name()
+		}
+		if named, ok := deref(recv.Type()).(*types.Named); ok {
+			return named.Obj().Name() + "_" + obj.Name()
+		}
+	}
+	return ""
+}
+
+// isExampleOf reports whether the example named example, as returned by
+// doc.Examples, is an example of the symbol named name: it is named name,
+// or name followed by a suffix that starts with a lower case letter.
+func isExampleOf(example, name string) bool {
+	if example == name {
+		return true
+	}
+	if !strings.HasPrefix(example, name+"_") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(example[len(name)+1:])
+	return unicode.IsLower(r)
+}
+
+// exampleCode formats the runnable program of ex, or else the statements
+// of its body.
+func exampleCode(fset *token.FileSet, ex *doc.Example) string {
+	var b bytes.Buffer
+	if ex.Play != nil {
+		if err := format.Node(&b, fset, ex.Play); err != nil {
+			return ""
+		}
+		return strings.TrimSpace(b.String())
+	}
+	if err := format.Node(&b, fset, ex.Code); err != nil {
+		return ""
+	}
+	code := b.String()
+	if _, ok := ex.Code.(*ast.BlockStmt); ok {
+		// Remove the braces of the body, and unindent it.
+		code = strings.TrimSuffix(strings.TrimPrefix(code, "{"), "}")
+		code = strings.Replace(code, "\n\t", "\n", -1)
+	}
+	return strings.TrimSpace(code)
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const examplesFile = `package p_test
+
+import "fmt"
+
+func ExampleFoo() {
+	fmt.Println("foo")
+	// Output: foo
+}
+
+func ExampleFoo_second() {
+	x := 1
+	_ = x
+}
+
+func ExampleFooBar() {}
+
+func ExampleFoo_Bar() {}
+
+func ExampleT_M() {}
+`
+
+func TestExamples(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p_test.go", examplesFile, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, ex := range doc.Examples(f) {
+		if isExampleOf(ex.Name, "Foo") {
+			got[ex.Name] = exampleCode(fset, ex)
+		}
+	}
+	// The programs are built by go/doc, whose formatting of the imports
+	// depends on the version of Go.
+	want := map[string]string{
+		"Foo":        "func main() {\n\tfmt.Println(\"foo\")\n}",
+		"Foo_second": "func main() {\n\tx := 1\n\t_ = x\n}",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got examples %v, want %v", got, want)
+	}
+	for name, code := range want {
+		if !strings.HasPrefix(got[name], "package main\n") || !strings.HasSuffix(got[name], code) {
+			t.Errorf("example %s: got code\n%s\nwant a program ending with\n%s", name, got[name], code)
+		}
+	}
+	if !isExampleOf("T_M", "T_M") || isExampleOf("T_M", "T") {
+		t.Errorf("wrong examples of method T.M")
+	}
+}
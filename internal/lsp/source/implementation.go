@@ -52,7 +52,7 @@ func Implementation(ctx context.Context, s Snapshot, f FileHandle, pp protocol.P
 	return locations, nil
 }
 
-var ErrNotAnInterface = errors.New("not an interface or interface method")
+var ErrNotAnInterface = errors.New("not a named type or method")
 
 func implementations(ctx context.Context, s Snapshot, f FileHandle, pp protocol.Position) ([]implementation, error) {
 
@@ -69,8 +69,9 @@ func implementations(ctx context.Context, s Snapshot, f FileHandle, pp protocol.
 
 	for _, obj := range objs {
 		var (
-			T      *types.Interface
-			method *types.Func
+			T        *types.Interface
+			concrete *types.Named
+			method   *types.Func
 		)
 
 		switch obj := obj.(type) {
@@ -78,16 +79,18 @@ func implementations(ctx context.Context, s Snapshot, f FileHandle, pp protocol.
 			method = obj
 			if recv := obj.Type().(*types.Signature).Recv(); recv != nil {
 				T, _ = recv.Type().Underlying().(*types.Interface)
+				concrete = namedType(recv.Type())
 			}
 		case *types.TypeName:
 			T, _ = obj.Type().Underlying().(*types.Interface)
+			concrete = namedType(obj.Type())
 		}
 
-		if T == nil {
+		if T == nil && concrete == nil {
 			return nil, ErrNotAnInterface
 		}
 
-		if T.NumMethods() == 0 {
+		if T != nil && T.NumMethods() == 0 {
 			return nil, nil
 		}
 
@@ -105,29 +108,24 @@ func implementations(ctx context.Context, s Snapshot, f FileHandle, pp protocol.
 				// We ignore aliases 'type M = N' to avoid duplicate reporting
 				// of the Named type N.
 				if obj, ok := obj.(*types.TypeName); ok && !obj.IsAlias() {
-					// We skip interface types since we only want concrete
-					// implementations.
-					if named, ok := obj.Type().(*types.Named); ok && !isInterface(named) {
+					// We want concrete implementations of an interface,
+					// and the interfaces implemented by a concrete type.
+					if named, ok := obj.Type().(*types.Named); ok && isInterface(named) == (T == nil) {
 						allNamed = append(allNamed, named)
 					}
 				}
 			}
 		}
 
-		// Find all the named types that implement our interface.
 		for _, U := range allNamed {
-			var concrete types.Type = U
-			if !types.AssignableTo(concrete, T) {
-				// We also accept T if *T implements our interface.
-				concrete = types.NewPointer(concrete)
-				if !types.AssignableTo(concrete, T) {
-					continue
-				}
+			var obj types.Object
+			if T != nil {
+				obj = implementing(U, T, method)
+			} else {
+				obj = implemented(concrete, U, method)
 			}
-
-			var obj types.Object = U.Obj()
-			if method != nil {
-				obj = types.NewMethodSet(concrete).Lookup(method.Pkg(), method.Name()).Obj()
+			if obj == nil {
+				continue
 			}
 
 			pos := fset.Position(obj.Pos())
@@ -147,8 +145,54 @@ func implementations(ctx context.Context, s Snapshot, f FileHandle, pp protocol.
 	return impls, nil
 }
 
+// implementing returns the concrete type U, or its method that implements
+// method, if U or *U implements the interface T, or nil.
+func implementing(U *types.Named, T *types.Interface, method *types.Func) types.Object {
+	var concrete types.Type = U
+	if !types.AssignableTo(concrete, T) {
+		// We also accept T if *T implements our interface.
+		concrete = types.NewPointer(concrete)
+		if !types.AssignableTo(concrete, T) {
+			return nil
+		}
+	}
+	if method != nil {
+		return types.NewMethodSet(concrete).Lookup(method.Pkg(), method.Name()).Obj()
+	}
+	return U.Obj()
+}
+
+// implemented returns the interface I, or its method of the same name as
+// method, if the concrete type T or *T implements I, or nil. Empty
+// interfaces are implemented by every type, and are not reported.
+func implemented(T, I *types.Named, method *types.Func) types.Object {
+	iface := I.Underlying().(*types.Interface)
+	if iface.NumMethods() == 0 || !types.Implements(types.NewPointer(T), iface) {
+		return nil
+	}
+	if method != nil {
+		obj, _, _ := types.LookupFieldOrMethod(iface, false, method.Pkg(), method.Name())
+		return obj
+	}
+	return I.Obj()
+}
+
+// namedType returns the named type of T or *T, if it is not an interface.
+func namedType(T types.Type) *types.Named {
+	if ptr, ok := T.(*types.Pointer); ok {
+		T = ptr.Elem()
+	}
+	named, ok := T.(*types.Named)
+	if !ok || isInterface(named) {
+		return nil
+	}
+	return named
+}
+
 type implementation struct {
-	// obj is the implementation, either a *types.TypeName or *types.Func.
+	// obj is the implementation, either a *types.TypeName or *types.Func,
+	// or, for a concrete type, the interface or interface method it
+	// implements.
 	obj types.Object
 
 	// pkg is the Package that contains obj's definition.
@@ -0,0 +1,153 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/cache"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/tests"
+	"github.com/jackie-feng/tools/internal/span"
+)
+
+// TestImportersAfterBodyEdit checks that the packages that import an edited
+// package agree with it on the identity of its objects, even when the edit
+// leaves its API intact.
+func TestImportersAfterBodyEdit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopls-importers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod": "module example.com\n",
+		"a/a.go": "package a\n\nfunc F() int { return 1 }\n",
+		"b/b.go": "package b\n\nimport \"example.com/a\"\n\nfunc G() int { return a.F() }\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aURI, bURI := span.FileURI(filepath.Join(dir, "a", "a.go")), span.FileURI(filepath.Join(dir, "b", "b.go"))
+
+	ctx := context.Background()
+	session := cache.New(nil).NewSession(ctx)
+	options := tests.DefaultOptions()
+	options.Env = append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod", "GOPROXY=off")
+	view, _, err := session.NewView(ctx, "importers_test", span.FileURI(dir), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The position of F in "return a.F()".
+	bUse := protocol.Position{Line: 4, Character: 24}
+	aDecl := protocol.Position{Line: 2, Character: 5}
+
+	// Type-check the importer before the edit, so that the snapshot holds
+	// the type information of both packages.
+	if got := references(ctx, t, view.Snapshot(), bURI, bUse); len(got) != 2 {
+		t.Fatalf("got %d references before the edit, want 2: %v", len(got), got)
+	}
+	if _, err := session.DidModifyFile(ctx, source.FileModification{
+		URI:        aURI,
+		Action:     source.Open,
+		Version:    1,
+		Text:       []byte("package a\n\nfunc F() int { return 2 }\n"),
+		LanguageID: "go",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := view.Snapshot()
+
+	// The importer must refer to the objects of the edited package.
+	aPkg, bPkg := checkPackage(ctx, t, snapshot, aURI), checkPackage(ctx, t, snapshot, bURI)
+	if imports := bPkg.GetTypes().Imports(); len(imports) != 1 || imports[0] != aPkg.GetTypes() {
+		t.Errorf("b imports %v, not the package a of the snapshot", imports)
+	}
+	got := references(ctx, t, snapshot, bURI, bUse)
+	want := []string{aURI.Filename() + ":3:6-7", bURI.Filename() + ":5:25-26"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got references %v after the edit, want %v", got, want)
+	}
+
+	fh, err := snapshot.GetFile(ctx, aURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ident, err := source.Identifier(ctx, snapshot, fh, aDecl, source.WidestCheckPackageHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits, err := ident.Rename(ctx, "H")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits[aURI]) != 1 || len(edits[bURI]) != 1 {
+		t.Errorf("got rename edits %v, want one edit in each of a.go and b.go", edits)
+	}
+}
+
+// checkPackage returns the type-checked package of the file uri.
+func checkPackage(ctx context.Context, t *testing.T, snapshot source.Snapshot, uri span.URI) source.Package {
+	t.Helper()
+	fh, err := snapshot.GetFile(ctx, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phs, err := snapshot.PackageHandles(ctx, fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph, err := source.WidestCheckPackageHandle(phs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := ph.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+// references returns the sorted positions of the references to the
+// identifier at pos in the file uri.
+func references(ctx context.Context, t *testing.T, snapshot source.Snapshot, uri span.URI, pos protocol.Position) []string {
+	t.Helper()
+	fh, err := snapshot.GetFile(ctx, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ident, err := source.Identifier(ctx, snapshot, fh, pos, source.WidestCheckPackageHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := ident.References(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs = append(refs, ident.DeclarationReferenceInfo())
+	var got []string
+	for _, ref := range refs {
+		spn, err := ref.Span()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprint(spn))
+	}
+	sort.Strings(got)
+	return got
+}
@@ -5,6 +5,7 @@
 package source
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -33,8 +34,8 @@ import (
 	"github.com/jackie-feng/tools/go/analysis/passes/unreachable"
 	"github.com/jackie-feng/tools/go/analysis/passes/unsafeptr"
 	"github.com/jackie-feng/tools/go/analysis/passes/unusedresult"
-	"github.com/jackie-feng/tools/internal/lsp/diff"
-	"github.com/jackie-feng/tools/internal/lsp/diff/myers"
+	"github.com/jackie-feng/tools/internal/diff"
+	"github.com/jackie-feng/tools/internal/diff/myers"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/telemetry/tag"
 	errors "golang.org/x/xerrors"
@@ -49,16 +50,26 @@ var (
 		PreferredContentFormat: protocol.Markdown,
 		SupportedCodeActions: map[FileKind]map[protocol.CodeActionKind]bool{
 			Go: {
-				protocol.SourceOrganizeImports: true,
-				protocol.QuickFix:              true,
+				protocol.SourceOrganizeImports:          true,
+				protocol.SourceOrganizeImportsInPackage: true,
+				protocol.SourceFixAll:                   true,
+				protocol.QuickFix:                       true,
+				protocol.RefactorRewrite:                true,
 			},
 			Mod: {
 				protocol.SourceOrganizeImports: true,
+				protocol.QuickFix:              true,
 			},
 			Sum: {},
 		},
 		SupportedCommands: []string{
-			"tidy", // for go.mod files
+			"tidy",      // for go.mod files
+			"goprivate", // for go.mod files
+			"stats",     // for diagnosing memory use
+			"inspect",   // for debugging stuck or bloated instances
+			"describe",  // for tools and bug reports
+			"semtok",    // for debugging semantic highlighting
+			"test",      // for the code lenses of test functions
 		},
 		Completion: CompletionOptions{
 			Documentation: true,
@@ -72,6 +83,9 @@ var (
 		GoDiff:       true,
 		LinkTarget:   "pkg.go.dev",
 		TempModfile:  false,
+
+		MaxWorkspacePackages: 1000,
+		MaxMemoryBytes:       4 << 30,
 	}
 )
 
@@ -85,6 +99,10 @@ type Options struct {
 	HoverKind        HoverKind
 	DisabledAnalyses map[string]struct{}
 
+	// HoverExamples is the maximum number of examples of a symbol shown in
+	// its hover with the full documentation.
+	HoverExamples int
+
 	StaticCheck bool
 	GoDiff      bool
 
@@ -107,6 +125,11 @@ type Options struct {
 
 	ComputeEdits diff.ComputeEdits
 
+	// SnapshotHook, if set, is called with the packages of each snapshot
+	// that is diagnosed, for tools built on gopls. It is called in its own
+	// goroutine, and must not block for long.
+	SnapshotHook func(ctx context.Context, snapshot SnapshotPackages)
+
 	Analyzers map[string]*analysis.Analyzer
 
 	// LocalPrefix is used to specify goimports's -local behavior.
@@ -120,6 +143,42 @@ type Options struct {
 	TempModfile bool
 
 	LinkTarget string
+
+	// MaxWorkspacePackages is the number of workspace packages above which a
+	// view falls back to degraded mode. Zero means no limit.
+	MaxWorkspacePackages int
+
+	// MaxMemoryBytes is the heap size above which a view falls back to
+	// degraded mode. Zero means no limit.
+	MaxMemoryBytes uint64
+
+	// MemoryGCThreshold is the heap size above which a view drops the
+	// type-checked packages that the open files do not depend on, to be
+	// checked again when needed. Zero means never.
+	MemoryGCThreshold uint64
+
+	// ExperimentalExportData loads the type information of packages outside
+	// the workspace from compiler export data rather than from source.
+	ExperimentalExportData bool
+
+	// RunTestsOnSave runs the tests of the workspace packages affected by
+	// a saved file and reports their failures as diagnostics.
+	RunTestsOnSave bool
+
+	// WarmStart remembers the files opened in each workspace folder, and
+	// type-checks their packages first when the folder is next loaded.
+	WarmStart bool
+
+	// Prefetch type-checks the packages of the open and recently opened
+	// files, and the packages that import them, while the user is idle.
+	Prefetch bool
+
+	// RenameTests also renames the test, benchmark and example functions
+	// named after a renamed function or type.
+	RenameTests bool
+
+	// SymbolMatcher is the kind of matching of workspace symbol queries.
+	SymbolMatcher SymbolMatcher
 }
 
 type CompletionOptions struct {
@@ -156,6 +215,14 @@ const (
 	Structured
 )
 
+type SymbolMatcher int
+
+const (
+	SymbolFuzzy = SymbolMatcher(iota)
+	SymbolCaseInsensitive
+	SymbolCaseSensitive
+)
+
 type OptionResults []OptionResult
 
 type OptionResult struct {
@@ -222,9 +289,13 @@ func (o *Options) set(name string, value interface{}) OptionResult {
 			result.errorf("invalid config gopls.env type %T", value)
 			break
 		}
+		// Options are copied for each view, so make sure not to append
+		// to an Env that is shared with the options of another view.
+		env := append([]string{}, o.Env...)
 		for k, v := range menv {
-			o.Env = append(o.Env, fmt.Sprintf("%s=%s", k, v))
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
 		}
+		o.Env = env
 
 	case "buildFlags":
 		iflags, ok := value.([]interface{})
@@ -287,6 +358,28 @@ func (o *Options) set(name string, value interface{}) OptionResult {
 			result.errorf("Unsupported hover kind", tag.Of("HoverKind", hoverKind))
 		}
 
+	case "hoverExamples":
+		if v, ok := result.asInt(); ok {
+			o.HoverExamples = v
+		}
+
+	case "symbolMatcher":
+		matcher, ok := value.(string)
+		if !ok {
+			result.errorf("invalid type %T for string option %q", value, name)
+			break
+		}
+		switch matcher {
+		case "fuzzy":
+			o.SymbolMatcher = SymbolFuzzy
+		case "caseInsensitive":
+			o.SymbolMatcher = SymbolCaseInsensitive
+		case "caseSensitive":
+			o.SymbolMatcher = SymbolCaseSensitive
+		default:
+			result.errorf("Unsupported symbol matcher", tag.Of("SymbolMatcher", matcher))
+		}
+
 	case "linkTarget":
 		linkTarget, ok := value.(string)
 		if !ok {
@@ -326,6 +419,36 @@ func (o *Options) set(name string, value interface{}) OptionResult {
 	case "tempModfile":
 		result.setBool(&o.TempModfile)
 
+	case "maxWorkspacePackages":
+		if v, ok := result.asInt(); ok {
+			o.MaxWorkspacePackages = v
+		}
+
+	case "maxMemoryBytes":
+		if v, ok := result.asInt(); ok {
+			o.MaxMemoryBytes = uint64(v)
+		}
+
+	case "memoryGCThreshold":
+		if v, ok := result.asInt(); ok {
+			o.MemoryGCThreshold = uint64(v)
+		}
+
+	case "experimentalExportData":
+		result.setBool(&o.ExperimentalExportData)
+
+	case "runTestsOnSave":
+		result.setBool(&o.RunTestsOnSave)
+
+	case "warmStart":
+		result.setBool(&o.WarmStart)
+
+	case "prefetch":
+		result.setBool(&o.Prefetch)
+
+	case "renameTests":
+		result.setBool(&o.RenameTests)
+
 	// Deprecated settings.
 	case "wantSuggestedFixes":
 		result.State = OptionDeprecated
@@ -374,6 +497,16 @@ func (r *OptionResult) asString() (string, bool) {
 	return b, true
 }
 
+func (r *OptionResult) asInt() (int, bool) {
+	// JSON numbers are always decoded as float64.
+	f, ok := r.Value.(float64)
+	if !ok || f < 0 || f != float64(int(f)) {
+		r.errorf("Invalid value %v for non-negative integer option %q", r.Value, r.Name)
+		return 0, false
+	}
+	return int(f), true
+}
+
 func (r *OptionResult) setBool(b *bool) {
 	if v, ok := r.asBool(); ok {
 		*b = v
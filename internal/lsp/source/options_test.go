@@ -0,0 +1,30 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetEnvPerFolder(t *testing.T) {
+	session := DefaultOptions
+	session.Env = make([]string, 1, 4)
+	session.Env[0] = "GOFLAGS=-mod=vendor"
+
+	a, b := session, session
+	SetOptions(&a, map[string]interface{}{"env": map[string]interface{}{"GOOS": "linux"}})
+	SetOptions(&b, map[string]interface{}{"env": map[string]interface{}{"GOOS": "windows"}})
+
+	if want := []string{"GOFLAGS=-mod=vendor", "GOOS=linux"}; !reflect.DeepEqual(a.Env, want) {
+		t.Errorf("first folder Env = %v, want %v", a.Env, want)
+	}
+	if want := []string{"GOFLAGS=-mod=vendor", "GOOS=windows"}; !reflect.DeepEqual(b.Env, want) {
+		t.Errorf("second folder Env = %v, want %v", b.Env, want)
+	}
+	if want := []string{"GOFLAGS=-mod=vendor"}; !reflect.DeepEqual(session.Env, want) {
+		t.Errorf("session Env = %v, want %v", session.Env, want)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/span"
+	"golang.org/x/mod/modfile"
+)
+
+// PrivateModuleSource is the source of the diagnostics reported on a go.mod
+// file when the go command cannot fetch a module that requires
+// authentication.
+const PrivateModuleSource = "private module"
+
+// authErrorRx matches the errors of the go command when a module cannot be
+// fetched without authenticating with its host, or when the module proxy or
+// the checksum database do not know the module because it is private.
+var authErrorRx = regexp.MustCompile(`terminal prompts disabled|could not read (Username|Password)|Authentication failed|Permission denied \(publickey\)|401 Unauthorized|403 Forbidden|410 Gone`)
+
+// fetchedPathRxs match the path of the module or package that the go command
+// failed to fetch in its errors, e.g. "example.com/m@v1.0.0: reading ..." or
+// "cannot find module providing package example.com/m/p: ...".
+var fetchedPathRxs = []*regexp.Regexp{
+	regexp.MustCompile(`([^\s:@'"]+)@v[^\s:@]*: `),
+	regexp.MustCompile(`module providing package ([^\s:]+)`),
+}
+
+// goprivateRx matches the GOPRIVATE setting suggested by a diagnostic.
+var goprivateRx = regexp.MustCompile("`GOPRIVATE=([^`]+)`")
+
+// privateModuleDiagnostic returns a diagnostic for the go.mod file of the
+// module containing dir if msg, an error of the go command, reports that a
+// module could not be fetched because it requires authentication.
+// It returns nil if msg is not such an error, or there is no go.mod file.
+func privateModuleDiagnostic(ctx context.Context, snapshot Snapshot, dir, msg string) (FileIdentity, *Diagnostic) {
+	if !authErrorRx.MatchString(msg) {
+		return FileIdentity{}, nil
+	}
+	fh := modFileFor(ctx, snapshot, dir)
+	if fh == nil {
+		return FileIdentity{}, nil
+	}
+	var rng protocol.Range
+	var pattern string
+	if f, err := snapshot.View().Session().Cache().ParseModHandle(fh).Parse(ctx); err == nil {
+		// Point at the requirement of the module that failed, if any.
+		// The longest path that the message mentions is the most specific.
+		for _, req := range f.Require {
+			if strings.Contains(msg, req.Mod.Path) && len(req.Mod.Path) > len(pattern) {
+				pattern = req.Mod.Path
+				rng = lineRange(req.Syntax)
+			}
+		}
+		if pattern == "" && f.Module != nil {
+			rng = lineRange(f.Module.Syntax)
+		}
+	}
+	if pattern == "" {
+		for _, rx := range fetchedPathRxs {
+			if m := rx.FindStringSubmatch(msg); m != nil {
+				pattern = privatePattern(m[1])
+				break
+			}
+		}
+	}
+	if pattern == "" {
+		return FileIdentity{}, nil
+	}
+	return fh.Identity(), &Diagnostic{
+		Range:    rng,
+		Message:  privateModuleMessage(pattern, msg),
+		Source:   PrivateModuleSource,
+		Severity: protocol.SeverityError,
+	}
+}
+
+// privateModuleMessage explains how to fetch the private modules matching
+// pattern, after the error of the go command.
+func privateModuleMessage(pattern, msg string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s could not be fetched, probably because it is private and requires authentication:\n%s\n", pattern, strings.TrimSpace(msg))
+	fmt.Fprintf(&b, "To use private modules:\n")
+	fmt.Fprintf(&b, "1. Set `GOPRIVATE=%s`, so that the go command fetches them from their host rather than from the module proxy, and does not look them up in the checksum database. ", pattern)
+	fmt.Fprintf(&b, "The \"Set GOPRIVATE\" quick fix sets it for this workspace, and \"go env -w GOPRIVATE=%s\" for all of your projects.\n", pattern)
+	fmt.Fprintf(&b, "2. Give the go command your credentials for their host: in $HOME/.netrc (\"machine <host> login <user> password <token>\") for HTTPS, or with a git credential helper or an SSH key.\n")
+	fmt.Fprintf(&b, "3. If a private module proxy serves them, set GONOSUMDB=%s instead of GOPRIVATE, so that only the checksum database is skipped.", pattern)
+	return b.String()
+}
+
+// PrivateModulePattern returns the GOPRIVATE pattern suggested by a
+// diagnostic reported for a private module.
+func PrivateModulePattern(diag protocol.Diagnostic) (string, bool) {
+	if diag.Source != PrivateModuleSource {
+		return "", false
+	}
+	m := goprivateRx.FindStringSubmatch(diag.Message)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// AddGOPRIVATE returns env with pattern added to goprivate, the value of
+// GOPRIVATE for the go command, if it does not match pattern already.
+func AddGOPRIVATE(env []string, goprivate, pattern string) []string {
+	var patterns []string
+	for _, p := range strings.Split(goprivate, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if p == pattern {
+			return env
+		}
+		patterns = append(patterns, p)
+	}
+	patterns = append(patterns, pattern)
+	return append(env[:len(env):len(env)], "GOPRIVATE="+strings.Join(patterns, ","))
+}
+
+// privatePattern returns the GOPRIVATE pattern for the package or module
+// path: the path of its host and owner, such as github.com/owner, which
+// matches all of the owner's modules.
+func privatePattern(path string) string {
+	elems := strings.Split(path, "/")
+	if len(elems) > 2 {
+		elems = elems[:2]
+	}
+	return strings.Join(elems, "/")
+}
+
+// modFileFor returns the go.mod file of the module containing dir, or nil.
+func modFileFor(ctx context.Context, snapshot Snapshot, dir string) FileHandle {
+	for {
+		filename := filepath.Join(dir, "go.mod")
+		if fi, err := os.Stat(filename); err == nil && !fi.IsDir() {
+			fh, err := snapshot.GetFile(ctx, span.FileURI(filename))
+			if err != nil {
+				return nil
+			}
+			return fh
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// lineRange returns the range of a line of a go.mod file.
+func lineRange(line *modfile.Line) protocol.Range {
+	if line == nil {
+		return protocol.Range{}
+	}
+	return protocol.Range{
+		Start: protocol.Position{Line: float64(line.Start.Line - 1), Character: float64(line.Start.LineRune - 1)},
+		End:   protocol.Position{Line: float64(line.End.Line - 1), Character: float64(line.End.LineRune - 1)},
+	}
+}
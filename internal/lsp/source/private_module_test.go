@@ -0,0 +1,56 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+)
+
+func TestPrivateModulePattern(t *testing.T) {
+	for _, test := range []struct {
+		msg, pattern string
+	}{
+		{"example.com/private/mod@v1.0.0: verifying module: example.com/private/mod@v1.0.0: reading https://sum.golang.org/lookup/example.com/private/mod@v1.0.0: 410 Gone", "example.com/private"},
+		{"cannot find module providing package github.com/owner/repo/pkg: fatal: could not read Username for 'https://github.com': terminal prompts disabled", "github.com/owner"},
+	} {
+		if !authErrorRx.MatchString(test.msg) {
+			t.Errorf("%q is not an authentication error", test.msg)
+			continue
+		}
+		var path string
+		for _, rx := range fetchedPathRxs {
+			if m := rx.FindStringSubmatch(test.msg); m != nil {
+				path = m[1]
+				break
+			}
+		}
+		if got := privatePattern(path); got != test.pattern {
+			t.Errorf("pattern for %q: got %q, want %q", test.msg, got, test.pattern)
+		}
+		diag := protocol.Diagnostic{Source: PrivateModuleSource, Message: privateModuleMessage(test.pattern, test.msg)}
+		if got, ok := PrivateModulePattern(diag); !ok || got != test.pattern {
+			t.Errorf("PrivateModulePattern: got %q, %v, want %q", got, ok, test.pattern)
+		}
+	}
+}
+
+func TestAddGOPRIVATE(t *testing.T) {
+	env := []string{"HOME=/home/gopher"}
+	for _, test := range []struct {
+		goprivate string
+		want      []string
+	}{
+		{"", []string{"HOME=/home/gopher", "GOPRIVATE=example.com/a"}},
+		{"example.com/b", []string{"HOME=/home/gopher", "GOPRIVATE=example.com/b,example.com/a"}},
+		{"example.com/b,example.com/a", env},
+	} {
+		if got := AddGOPRIVATE(env, test.goprivate, "example.com/a"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("AddGOPRIVATE(%q): got %v, want %v", test.goprivate, got, test.want)
+		}
+	}
+}
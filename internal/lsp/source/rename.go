@@ -15,7 +15,7 @@ import (
 	"regexp"
 
 	"github.com/jackie-feng/tools/go/types/typeutil"
-	"github.com/jackie-feng/tools/internal/lsp/diff"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/span"
 	"github.com/jackie-feng/tools/internal/telemetry/trace"
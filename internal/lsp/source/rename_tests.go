@@ -0,0 +1,141 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+)
+
+// testPrefixes are the prefixes of the functions that go test runs.
+var testPrefixes = []string{"Test", "Benchmark", "Example"}
+
+// TestRename is the renaming of a test, benchmark or example function
+// whose name follows the name of a renamed declaration.
+type TestRename struct {
+	From, To string
+	Edits    map[span.URI][]protocol.TextEdit
+}
+
+// RenameTests returns the renamings of the test, benchmark and example
+// functions named after the package-level function or type that i refers to,
+// such as TestOld_Empty to TestNew_Empty when renaming Old to New.
+// Since these names are only a convention, the caller should ask the user
+// to review the edits rather than apply them silently.
+func (i *IdentifierInfo) RenameTests(ctx context.Context, newName string) ([]TestRename, error) {
+	ctx, done := trace.StartSpan(ctx, "source.RenameTests")
+	defer done()
+
+	obj := i.Declaration.obj
+	if obj == nil || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return nil, nil
+	}
+	switch obj.(type) {
+	case *types.Func, *types.TypeName:
+	default:
+		return nil, nil
+	}
+	if i.pkg == nil || i.pkg.IsIllTyped() {
+		return nil, nil
+	}
+
+	// Tests are declared in the package itself, or in its external test package.
+	pkgs := []Package{i.pkg}
+	for _, id := range i.Snapshot.GetReverseDependencies(i.pkg.ID()) {
+		ph, err := i.Snapshot.PackageHandle(ctx, id)
+		if err != nil {
+			log.Error(ctx, "RenameTests: no PackageHandle", err, telemetry.Package.Of(id))
+			continue
+		}
+		pkg, err := ph.Check(ctx)
+		if err != nil {
+			log.Error(ctx, "RenameTests: no Package", err, telemetry.Package.Of(id))
+			continue
+		}
+		if pkg.PkgPath() == i.pkg.PkgPath()+"_test" {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	var result []TestRename
+	fset := i.Snapshot.View().Session().Cache().FileSet()
+	for _, pkg := range pkgs {
+		info := pkg.GetTypesInfo()
+		scope := pkg.GetTypes().Scope()
+		for ident, def := range info.Defs {
+			fn, ok := def.(*types.Func)
+			if !ok || fn.Parent() != scope {
+				continue
+			}
+			if !strings.HasSuffix(fset.Position(ident.Pos()).Filename, "_test.go") {
+				continue
+			}
+			to := renamedTestName(fn.Name(), i.Name, newName)
+			if to == "" {
+				continue
+			}
+			// Leave the test alone rather than create a conflict.
+			if scope.Lookup(to) != nil {
+				continue
+			}
+			idents := []*ast.Ident{ident}
+			for use, obj := range info.Uses {
+				if obj == fn {
+					idents = append(idents, use)
+				}
+			}
+			edits := make(map[span.URI][]protocol.TextEdit)
+			for _, id := range idents {
+				rng, err := posToMappedRange(i.Snapshot.View(), pkg, id.Pos(), id.End())
+				if err != nil {
+					return nil, err
+				}
+				prng, err := rng.Range()
+				if err != nil {
+					return nil, err
+				}
+				edits[rng.URI()] = append(edits[rng.URI()], protocol.TextEdit{
+					Range:   prng,
+					NewText: to,
+				})
+			}
+			result = append(result, TestRename{
+				From:  fn.Name(),
+				To:    to,
+				Edits: edits,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].From < result[j].From
+	})
+	return result, nil
+}
+
+// renamedTestName returns the name of the test function name after
+// renaming from to to, or "" if name is not the name of a test of from.
+// The tests of from are named with a test prefix, followed by from, and
+// optionally by an underscore and a suffix.
+func renamedTestName(name, from, to string) string {
+	for _, prefix := range testPrefixes {
+		if !strings.HasPrefix(name, prefix+from) {
+			continue
+		}
+		rest := name[len(prefix+from):]
+		if rest == "" || rest[0] == '_' {
+			return prefix + to + rest
+		}
+	}
+	return ""
+}
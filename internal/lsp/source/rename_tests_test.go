@@ -0,0 +1,27 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import "testing"
+
+func TestRenamedTestName(t *testing.T) {
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"TestOld", "TestNew"},
+		{"TestOld_empty", "TestNew_empty"},
+		{"BenchmarkOld", "BenchmarkNew"},
+		{"ExampleOld", "ExampleNew"},
+		{"ExampleOld_Method", "ExampleNew_Method"},
+		{"TestOlder", ""},
+		{"TestOtherOld", ""},
+		{"Old", ""},
+		{"helperOld", ""},
+	} {
+		if got := renamedTestName(test.name, "Old", "New"); got != test.want {
+			t.Errorf("renamedTestName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
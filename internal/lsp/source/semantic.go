@@ -0,0 +1,337 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+	errors "golang.org/x/xerrors"
+)
+
+// SemanticTokenTypes and SemanticTokenModifiers form the legend of the
+// semantic tokens: a token refers to its type and its modifiers by their
+// indexes in these lists.
+var (
+	SemanticTokenTypes = []string{
+		"namespace", "type", "interface", "struct", "parameter", "variable",
+		"property", "function", "method", "keyword", "comment", "string", "number",
+	}
+	SemanticTokenModifiers = []string{
+		"definition", "readonly", "defaultLibrary",
+	}
+)
+
+// SemanticTokens holds the semantic tokens of a file, encoded as in the
+// semantic tokens of the LSP. Each token is described by five integers in
+// Data: the line of its start, relative to the previous token; the
+// character of its start, relative to the previous token if on the same
+// line; its length in UTF-16 code units; the index of its type in
+// Legend.TokenTypes; and the bit set of its modifiers in
+// Legend.TokenModifiers. A token does not span several lines.
+type SemanticTokens struct {
+	Legend SemanticTokensLegend `json:"legend"`
+	Data   []uint32             `json:"data"`
+}
+
+type SemanticTokensLegend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+// SemanticToken is a decoded semantic token.
+type SemanticToken struct {
+	Range     protocol.Range
+	Type      string
+	Modifiers []string
+}
+
+// Semantic returns the semantic tokens of a Go file: its comments,
+// literals, keywords, and the identifiers whose objects are known,
+// classified by the kind of their object.
+func Semantic(ctx context.Context, snapshot Snapshot, fh FileHandle) (*SemanticTokens, error) {
+	ctx, done := trace.StartSpan(ctx, "source.Semantic")
+	defer done()
+
+	pkg, pgh, err := getParsedFile(ctx, snapshot, fh, NarrowestCheckPackageHandle)
+	if err != nil {
+		return nil, fmt.Errorf("getting file for Semantic: %v", err)
+	}
+	file, m, _, err := pgh.Cached()
+	if err != nil {
+		return nil, err
+	}
+	fset := snapshot.View().Session().Cache().FileSet()
+	tok := fset.File(file.Pos())
+	if tok == nil {
+		return nil, errors.Errorf("no file for %s", fh.Identity().URI)
+	}
+	info := pkg.GetTypesInfo()
+
+	// Index the identifiers by offset, and find the parameters, which
+	// are variables like any other for go/types.
+	idents := make(map[int]*ast.Ident)
+	params := make(map[types.Object]bool)
+	addParams := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				if obj := info.Defs[name]; obj != nil {
+					params[obj] = true
+				}
+			}
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			idents[tok.Offset(n.Pos())] = n
+		case *ast.FuncDecl:
+			addParams(n.Recv)
+		case *ast.FuncType:
+			addParams(n.Params)
+			addParams(n.Results)
+		}
+		return true
+	})
+
+	// Scan the file again, as the syntax tree holds neither the keywords
+	// nor the positions of all of the comments.
+	src := m.Content
+	var (
+		s      scanner.Scanner
+		tokens []semanticToken
+	)
+	scanned := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(scanned, src, nil, scanner.ScanComments)
+	for {
+		pos, t, lit := s.Scan()
+		if t == token.EOF {
+			break
+		}
+		start := scanned.Offset(pos)
+		var typ string
+		var mods []string
+		switch {
+		case t == token.COMMENT:
+			typ = "comment"
+		case t == token.STRING || t == token.CHAR:
+			typ = "string"
+		case t == token.INT || t == token.FLOAT || t == token.IMAG:
+			typ = "number"
+		case t.IsKeyword():
+			typ = "keyword"
+		case t == token.IDENT:
+			if id := idents[start]; id != nil {
+				typ, mods = identType(info, params, file, id)
+			}
+		}
+		if typ == "" {
+			continue
+		}
+		// A token that spans several lines, such as a general comment or
+		// a raw string, is split into one token per line.
+		end := tokenEnd(src, start, t, lit)
+		for start < end {
+			lineEnd := end
+			if i := bytes.IndexByte(src[start:end], '\n'); i >= 0 {
+				lineEnd = start + i
+			}
+			segEnd := lineEnd
+			if segEnd > start && src[segEnd-1] == '\r' {
+				segEnd--
+			}
+			if segEnd > start {
+				rng, err := newMappedRange(fset, m, tok.Pos(start), tok.Pos(segEnd)).Range()
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, semanticToken{rng, typ, mods})
+			}
+			start = lineEnd + 1
+		}
+	}
+	return encodeSemanticTokens(tokens), nil
+}
+
+type semanticToken struct {
+	rng  protocol.Range
+	typ  string
+	mods []string
+}
+
+// identType returns the semantic token type and modifiers of an identifier,
+// or "" if its object is not known.
+func identType(info *types.Info, params map[types.Object]bool, file *ast.File, id *ast.Ident) (string, []string) {
+	if id.Name == "_" {
+		return "", nil
+	}
+	if id == file.Name {
+		return "namespace", nil
+	}
+	obj, def := info.Defs[id]
+	if obj == nil {
+		if def {
+			// The symbolic variable of a type switch.
+			return "variable", []string{"definition"}
+		}
+		obj = info.Uses[id]
+	}
+	var (
+		typ  string
+		mods []string
+	)
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		typ = "namespace"
+	case *types.TypeName:
+		switch obj.Type().Underlying().(type) {
+		case *types.Interface:
+			typ = "interface"
+		case *types.Struct:
+			typ = "struct"
+		default:
+			typ = "type"
+		}
+	case *types.Var:
+		switch {
+		case obj.IsField():
+			typ = "property"
+		case params[obj]:
+			typ = "parameter"
+		default:
+			typ = "variable"
+		}
+	case *types.Const:
+		typ = "variable"
+		mods = append(mods, "readonly")
+	case *types.Nil:
+		typ = "variable"
+		mods = append(mods, "readonly")
+	case *types.Func:
+		typ = "function"
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+			typ = "method"
+		}
+	case *types.Builtin:
+		typ = "function"
+	default:
+		return "", nil // labels, or unknown objects
+	}
+	if def {
+		mods = append([]string{"definition"}, mods...)
+	}
+	if obj.Parent() == types.Universe {
+		mods = append(mods, "defaultLibrary")
+	}
+	return typ, mods
+}
+
+// tokenEnd returns the end offset in src of the token t that starts at
+// offset start, whose literal is lit. The literals of comments and raw
+// strings do not hold carriage returns, so their ends are found in src.
+func tokenEnd(src []byte, start int, t token.Token, lit string) int {
+	switch {
+	case t == token.COMMENT && lit[1] == '*':
+		if i := bytes.Index(src[start+2:], []byte("*/")); i >= 0 {
+			return start + 2 + i + 2
+		}
+		return len(src)
+	case t == token.COMMENT:
+		if i := bytes.IndexByte(src[start:], '\n'); i >= 0 {
+			return start + i
+		}
+		return len(src)
+	case t == token.STRING && lit[0] == '`':
+		if i := bytes.IndexByte(src[start+1:], '`'); i >= 0 {
+			return start + 1 + i + 1
+		}
+		return len(src)
+	}
+	return start + len(lit)
+}
+
+func encodeSemanticTokens(tokens []semanticToken) *SemanticTokens {
+	sort.Slice(tokens, func(i, j int) bool {
+		return protocol.ComparePosition(tokens[i].rng.Start, tokens[j].rng.Start) < 0
+	})
+	typeIndex := make(map[string]uint32)
+	for i, typ := range SemanticTokenTypes {
+		typeIndex[typ] = uint32(i)
+	}
+	modifierBit := make(map[string]uint32)
+	for i, mod := range SemanticTokenModifiers {
+		modifierBit[mod] = 1 << uint(i)
+	}
+	result := &SemanticTokens{
+		Legend: SemanticTokensLegend{
+			TokenTypes:     SemanticTokenTypes,
+			TokenModifiers: SemanticTokenModifiers,
+		},
+		Data: make([]uint32, 0, 5*len(tokens)),
+	}
+	var prev protocol.Position
+	for _, t := range tokens {
+		line, char := uint32(t.rng.Start.Line), uint32(t.rng.Start.Character)
+		deltaLine, deltaChar := line-uint32(prev.Line), char
+		if deltaLine == 0 {
+			deltaChar = char - uint32(prev.Character)
+		}
+		var mods uint32
+		for _, mod := range t.mods {
+			mods |= modifierBit[mod]
+		}
+		length := uint32(t.rng.End.Character) - char
+		result.Data = append(result.Data, deltaLine, deltaChar, length, typeIndex[t.typ], mods)
+		prev = t.rng.Start
+	}
+	return result
+}
+
+// Decode returns the tokens encoded in t.
+func (t *SemanticTokens) Decode() ([]SemanticToken, error) {
+	if len(t.Data)%5 != 0 {
+		return nil, errors.Errorf("invalid semantic tokens: got %d integers, want a multiple of 5", len(t.Data))
+	}
+	var (
+		tokens     []SemanticToken
+		line, char uint32
+	)
+	for i := 0; i < len(t.Data); i += 5 {
+		deltaLine, deltaChar, length, typ, mods := t.Data[i], t.Data[i+1], t.Data[i+2], t.Data[i+3], t.Data[i+4]
+		if deltaLine > 0 {
+			line, char = line+deltaLine, deltaChar
+		} else {
+			char += deltaChar
+		}
+		if int(typ) >= len(t.Legend.TokenTypes) {
+			return nil, errors.Errorf("invalid semantic token type %d", typ)
+		}
+		tok := SemanticToken{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: float64(line), Character: float64(char)},
+				End:   protocol.Position{Line: float64(line), Character: float64(char + length)},
+			},
+			Type: t.Legend.TokenTypes[typ],
+		}
+		for j, mod := range t.Legend.TokenModifiers {
+			if mods&(1<<uint(j)) != 0 {
+				tok.Modifiers = append(tok.Modifiers, mod)
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens, nil
+}
@@ -16,8 +16,8 @@ import (
 	"testing"
 
 	"github.com/jackie-feng/tools/go/packages/packagestest"
+	"github.com/jackie-feng/tools/internal/diff"
 	"github.com/jackie-feng/tools/internal/lsp/cache"
-	"github.com/jackie-feng/tools/internal/lsp/diff"
 	"github.com/jackie-feng/tools/internal/lsp/fuzzy"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
@@ -408,6 +408,36 @@ func foldRanges(contents string, ranges []*source.FoldingRangeInfo) (string, err
 	return res, nil
 }
 
+func (r *runner) SemanticTokens(t *testing.T, spn span.Span) {
+	uri := spn.URI()
+	fh, err := r.view.Snapshot().GetFile(r.ctx, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := source.Semantic(r.ctx, r.view.Snapshot(), fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := encoded.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.data.Mapper(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tests.FormatSemanticTokens(m, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(r.data.Golden("semtok", uri.Filename(), func() ([]byte, error) {
+		return []byte(got), nil
+	}))
+	if want != got {
+		t.Errorf("semantic tokens failed for %s expected:\n%s\ngot:\n%s", uri.Filename(), want, got)
+	}
+}
+
 func (r *runner) Format(t *testing.T, spn span.Span) {
 	gofmted := string(r.data.Golden("gofmt", spn.URI().Filename(), func() ([]byte, error) {
 		cmd := exec.Command("gofmt", spn.URI().Filename())
@@ -18,6 +18,17 @@ func DocumentSymbols(ctx context.Context, snapshot Snapshot, fh FileHandle) ([]p
 	ctx, done := trace.StartSpan(ctx, "source.DocumentSymbols")
 	defer done()
 
+	v, err := snapshot.FileResult(ctx, fh, DocumentSymbolsResult, func(ctx context.Context) (interface{}, error) {
+		return documentSymbols(ctx, snapshot, fh)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]protocol.DocumentSymbol), nil
+}
+
+func documentSymbols(ctx context.Context, snapshot Snapshot, fh FileHandle) ([]protocol.DocumentSymbol, error) {
+
 	pkg, pgh, err := getParsedFile(ctx, snapshot, fh, NarrowestCheckPackageHandle)
 	if err != nil {
 		return nil, fmt.Errorf("getting file for DocumentSymbols: %v", err)
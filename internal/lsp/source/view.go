@@ -11,12 +11,12 @@ import (
 	"go/token"
 	"go/types"
 
-	"golang.org/x/mod/modfile"
 	"github.com/jackie-feng/tools/go/analysis"
 	"github.com/jackie-feng/tools/go/packages"
 	"github.com/jackie-feng/tools/internal/imports"
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/span"
+	"golang.org/x/mod/modfile"
 )
 
 // Snapshot represents the current state for the given view.
@@ -50,6 +50,10 @@ type Snapshot interface {
 	// of the snapshot's view.
 	WorkspacePackageIDs(ctx context.Context) []string
 
+	// CompiledGoFiles returns the compiled Go files of the package with the
+	// given ID, from its metadata, without building a handle for it.
+	CompiledGoFiles(ctx context.Context, id string) []span.URI
+
 	// GetActiveReverseDeps returns the active files belonging to the reverse
 	// dependencies of this file's package.
 	GetReverseDependencies(id string) []string
@@ -60,6 +64,37 @@ type Snapshot interface {
 
 	// KnownPackages returns all the packages loaded in this snapshot.
 	KnownPackages(ctx context.Context) []Package
+
+	// Symbols returns the top-level symbols declared in the workspace
+	// packages, keyed by the file that declares them.
+	Symbols(ctx context.Context) (map[span.URI][]Symbol, error)
+
+	// FileResult returns the result of compute for the given file and kind
+	// of request. The result is computed at most once per version of the
+	// file, and later snapshots reuse it until the file changes or, for
+	// results that depend on type information, its packages are invalidated.
+	// Errors are not cached.
+	FileResult(ctx context.Context, fh FileHandle, kind FileResultKind, compute func(context.Context) (interface{}, error)) (interface{}, error)
+}
+
+// FileResultKind identifies a kind of per-file result cached by
+// Snapshot.FileResult.
+type FileResultKind int
+
+const (
+	// DocumentSymbolsResult is the result of DocumentSymbols.
+	DocumentSymbolsResult = FileResultKind(iota)
+
+	// FoldingRangesResult and LineFoldingRangesResult are the results of
+	// FoldingRange without and with lineFoldingOnly.
+	FoldingRangesResult
+	LineFoldingRangesResult
+)
+
+// DependsOnTypes reports whether results of kind k depend on the type
+// information of the file's packages, rather than only on its contents.
+func (k FileResultKind) DependsOnTypes() bool {
+	return k == DocumentSymbolsResult
 }
 
 // PackageHandle represents a handle to a specific version of a package.
@@ -123,6 +158,12 @@ type View interface {
 	// original one will be.
 	SetOptions(context.Context, Options) (View, error)
 
+	// Reload replaces the view with a new one for the same folder and
+	// options, to pick up the changes made to its go.mod and go.sum files
+	// outside of the editor. It returns the new view, and a description of
+	// each change to the requirements of the go.mod file.
+	Reload(ctx context.Context) (View, []string, error)
+
 	// FindFileInPackage returns the AST and type information for a file that may
 	// belong to or be part of a dependency of the given package.
 	FindPosInPackage(pkg Package, pos token.Pos) (*ast.File, Package, error)
@@ -133,6 +174,11 @@ type View interface {
 
 	// Snapshot returns the current snapshot for the view.
 	Snapshot() Snapshot
+
+	// Degraded reports whether the view exceeded its configured package or
+	// memory limits when it was created. A degraded view only reports syntax
+	// errors for packages that are not open, and type-checks on demand.
+	Degraded() bool
 }
 
 // Session represents a single connection from a client.
@@ -165,7 +211,15 @@ type Session interface {
 	// IsOpen returns whether the editor currently has a file open.
 	IsOpen(uri span.URI) bool
 
+	// OpenFiles returns the files that the editor currently has open,
+	// with their contents in the editor.
+	OpenFiles() []FileHandle
+
 	// DidModifyFile reports a file modification to the session.
+	// It returns the new snapshots of the views that contain the file.
+	// Changes to the contents of open files are coalesced: they are applied
+	// to a view's snapshot the next time it is requested, and no snapshot
+	// is returned for the view.
 	DidModifyFile(ctx context.Context, c FileModification) ([]Snapshot, error)
 
 	// DidChangeOutOfBand is called when a file under the root folder changes.
@@ -177,6 +231,102 @@ type Session interface {
 
 	// SetOptions sets the options of this session to new values.
 	SetOptions(Options)
+
+	// Stats reports the amount of state held by the session.
+	Stats() *SessionStats
+
+	// Inspect describes the state held by all of the sessions that share
+	// the session's cache, for debugging.
+	Inspect() *CacheInspection
+}
+
+// SessionStats describes the state held by a session and its views,
+// to help diagnose excessive memory use.
+type SessionStats struct {
+	Views []ViewStats `json:"views"`
+
+	// OverlayFiles is the number of files open in the editor,
+	// and OverlayBytes is the size of their contents.
+	OverlayFiles int `json:"overlayFiles"`
+	OverlayBytes int `json:"overlayBytes"`
+
+	// CacheEntries is the number of memoized values in the cache,
+	// such as parsed files and type-checked packages, by type of key.
+	CacheEntries map[string]int `json:"cacheEntries"`
+}
+
+// ViewStats describes the state held by the current snapshot of a view.
+type ViewStats struct {
+	Name   string `json:"name"`
+	Folder string `json:"folder"`
+
+	Files             int `json:"files"`
+	Metadata          int `json:"metadata"`
+	WorkspacePackages int `json:"workspacePackages"`
+	Packages          int `json:"packages"`
+	Actions           int `json:"actions"`
+}
+
+// CacheInspection describes the sessions of a cache, the views of each
+// session, and the packages and open files of each view, to help debug
+// a gopls that is stuck or uses too much memory.
+type CacheInspection struct {
+	Sessions []SessionInspection `json:"sessions"`
+}
+
+// SessionInspection describes a session of a cache.
+type SessionInspection struct {
+	ID string `json:"id"`
+
+	// Current is set for the session that was asked for the inspection.
+	Current bool `json:"current,omitempty"`
+
+	Views    []ViewInspection    `json:"views"`
+	Overlays []OverlayInspection `json:"overlays"`
+}
+
+// OverlayInspection describes a file open in the editor.
+type OverlayInspection struct {
+	URI     string  `json:"uri"`
+	Version float64 `json:"version"`
+	Bytes   int     `json:"bytes"`
+	// Saved is set if the contents of the file are the same on disk.
+	Saved bool `json:"saved"`
+}
+
+// ViewInspection describes the current snapshot of a view.
+type ViewInspection struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Folder   string `json:"folder"`
+	Degraded bool   `json:"degraded,omitempty"`
+
+	// Packages are the packages of the snapshot, the type-checked ones
+	// first, by decreasing estimated memory use.
+	Packages []PackageInspection `json:"packages"`
+}
+
+// PackageInspection describes a package of a snapshot.
+type PackageInspection struct {
+	ID        string `json:"id"`
+	PkgPath   string `json:"pkgPath"`
+	Workspace bool   `json:"workspace,omitempty"`
+
+	// Modes are the parse modes in which the package is type-checked,
+	// such as "full" for the packages of the open files, and "exported"
+	// for their dependencies. It is empty if the package is not checked.
+	Modes []string `json:"modes,omitempty"`
+
+	Files int `json:"files"`
+
+	// SourceBytes is the size of the files of the type-checked package,
+	// SyntaxNodes the number of nodes of their syntax trees, and
+	// TypesInfoEntries the number of entries of its type information.
+	// EstimatedBytes is a rough estimate of the memory that they use.
+	SourceBytes      int `json:"sourceBytes,omitempty"`
+	SyntaxNodes      int `json:"syntaxNodes,omitempty"`
+	TypesInfoEntries int `json:"typesInfoEntries,omitempty"`
+	EstimatedBytes   int `json:"estimatedBytes,omitempty"`
 }
 
 // FileModification represents a modification to a file.
@@ -365,7 +515,8 @@ type Error struct {
 	Range          protocol.Range
 	Kind           ErrorKind
 	Message        string
-	Category       string // only used by analysis errors so far
+	Category       string                      // only used by analysis errors so far
+	Severity       protocol.DiagnosticSeverity // only used by analysis errors so far
 	SuggestedFixes []SuggestedFix
 	Related        []RelatedInformation
 }
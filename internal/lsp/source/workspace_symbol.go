@@ -0,0 +1,108 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/fuzzy"
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+)
+
+// maxSymbols is the maximum number of symbols returned by WorkspaceSymbols.
+const maxSymbols = 100
+
+// Symbol is a top-level declaration in a workspace file.
+type Symbol struct {
+	// Name is the name of the declared object. Methods are qualified by
+	// their receiver type, as in "T.Method".
+	Name  string
+	Kind  protocol.SymbolKind
+	Range protocol.Range
+}
+
+// WorkspaceSymbols returns the top-level symbols in the given views whose
+// names match query, best matches first. The query is matched as configured
+// by the SymbolMatcher option of each view.
+func WorkspaceSymbols(ctx context.Context, views []View, query string) ([]protocol.SymbolInformation, error) {
+	ctx, done := trace.StartSpan(ctx, "source.WorkspaceSymbols")
+	defer done()
+
+	type scoredSymbol struct {
+		info  protocol.SymbolInformation
+		score float32
+	}
+	var scored []scoredSymbol
+	for _, view := range views {
+		matcher := symbolMatcher(view.Options().SymbolMatcher, query)
+		files, err := view.Snapshot().Symbols(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for uri, symbols := range files {
+			for _, sym := range symbols {
+				score := matcher(sym.Name)
+				if score <= 0 {
+					continue
+				}
+				scored = append(scored, scoredSymbol{
+					info: protocol.SymbolInformation{
+						Name: sym.Name,
+						Kind: sym.Kind,
+						Location: protocol.Location{
+							URI:   protocol.NewURI(uri),
+							Range: sym.Range,
+						},
+					},
+					score: score,
+				})
+			}
+		}
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		if scored[i].info.Name != scored[j].info.Name {
+			return scored[i].info.Name < scored[j].info.Name
+		}
+		return scored[i].info.Location.URI < scored[j].info.Location.URI
+	})
+	if len(scored) > maxSymbols {
+		scored = scored[:maxSymbols]
+	}
+	symbols := make([]protocol.SymbolInformation, 0, len(scored))
+	for _, s := range scored {
+		symbols = append(symbols, s.info)
+	}
+	return symbols, nil
+}
+
+// symbolMatcher returns a function that scores how well a symbol name
+// matches query. A score of zero or less means no match.
+func symbolMatcher(matcherType SymbolMatcher, query string) func(name string) float32 {
+	switch matcherType {
+	case SymbolCaseInsensitive:
+		query = strings.ToLower(query)
+		return func(name string) float32 {
+			if strings.Contains(strings.ToLower(name), query) {
+				return 1
+			}
+			return 0
+		}
+	case SymbolCaseSensitive:
+		return func(name string) float32 {
+			if strings.Contains(name, query) {
+				return 1
+			}
+			return 0
+		}
+	default:
+		return fuzzy.NewMatcher(query).Score
+	}
+}
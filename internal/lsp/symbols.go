@@ -43,3 +43,10 @@ func (s *Server) documentSymbol(ctx context.Context, params *protocol.DocumentSy
 	}
 	return symbols, nil
 }
+
+func (s *Server) symbol(ctx context.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	ctx, done := trace.StartSpan(ctx, "lsp.Server.symbol")
+	defer done()
+
+	return source.WorkspaceSymbols(ctx, s.session.Views(), params.Query)
+}
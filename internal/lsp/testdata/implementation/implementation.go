@@ -28,6 +28,6 @@ type U interface {
 	U() //@implementations("U", ImpU)
 }
 
-type cryer int
+type cryer int //@implementations("cryer", Cryer)
 
-func (cryer) Cry(other.CryType) {} //@mark(CryImpl, "Cry")
+func (cryer) Cry(other.CryType) {} //@mark(CryImpl, "Cry"),implementations("Cry", Cry)
@@ -24,6 +24,6 @@ type CryType int
 
 const Sob CryType = 1
 
-type Cryer interface {
-	Cry(CryType) //@implementations("Cry", CryImpl)
+type Cryer interface { //@Cryer
+	Cry(CryType) //@mark(Cry, "Cry"),implementations("Cry", CryImpl)
 }
@@ -0,0 +1,32 @@
+package semantic //@semantic("package")
+
+import "errors"
+
+type (
+	Shape interface {
+		Area() float64
+	}
+	Square struct {
+		side float64 // the length of a side
+	}
+)
+
+const max = 10
+
+/* Area returns the area
+   of the square. */
+func (s *Square) Area() float64 {
+	return s.side * s.side
+}
+
+func count(shapes []Shape, limit int) (n int, err error) {
+	for range shapes {
+		if n++; n > limit {
+			return n, errors.New(`too many
+shapes`)
+		}
+	}
+	var r rune = 'x'
+	_ = r
+	return len(shapes) + max, nil
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+)
+
+// FormatSemanticTokens formats decoded semantic tokens as the semtok
+// command prints them: one per line, as line:startColumn-endColumn, followed
+// by the type of the token and its modifiers.
+func FormatSemanticTokens(m *protocol.ColumnMapper, tokens []source.SemanticToken) (string, error) {
+	var buf bytes.Buffer
+	for _, tok := range tokens {
+		spn, err := m.RangeSpan(tok.Range)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&buf, "%d:%d-%d %s", spn.Start().Line(), spn.Start().Column(), spn.End().Column(), tok.Type)
+		if len(tok.Modifiers) > 0 {
+			fmt.Fprintf(&buf, " %s", strings.Join(tok.Modifiers, ","))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
@@ -49,6 +49,7 @@ type FuzzyCompletions map[span.Span][]Completion
 type CaseSensitiveCompletions map[span.Span][]Completion
 type RankCompletions map[span.Span][]Completion
 type FoldingRanges []span.Span
+type SemanticTokens []span.Span
 type Formats []span.Span
 type Imports []span.Span
 type SuggestedFixes []span.Span
@@ -76,6 +77,7 @@ type Data struct {
 	CaseSensitiveCompletions CaseSensitiveCompletions
 	RankCompletions          RankCompletions
 	FoldingRanges            FoldingRanges
+	SemanticTokens           SemanticTokens
 	Formats                  Formats
 	Imports                  Imports
 	SuggestedFixes           SuggestedFixes
@@ -109,6 +111,7 @@ type Tests interface {
 	CaseSensitiveCompletion(*testing.T, span.Span, Completion, CompletionItems)
 	RankCompletion(*testing.T, span.Span, Completion, CompletionItems)
 	FoldingRanges(*testing.T, span.Span)
+	SemanticTokens(*testing.T, span.Span)
 	Format(*testing.T, span.Span)
 	Import(*testing.T, span.Span)
 	SuggestedFix(*testing.T, span.Span)
@@ -305,6 +308,7 @@ func Load(t testing.TB, exporter packagestest.Exporter, dir string) *Data {
 		"rank":            data.collectCompletions(CompletionRank),
 		"snippet":         data.collectCompletionSnippets,
 		"fold":            data.collectFoldingRanges,
+		"semantic":        data.collectSemanticTokens,
 		"format":          data.collectFormats,
 		"import":          data.collectImports,
 		"godef":           data.collectDefinitions,
@@ -428,6 +432,16 @@ func Run(t *testing.T, tests Tests, data *Data) {
 		}
 	})
 
+	t.Run("SemanticTokens", func(t *testing.T) {
+		t.Helper()
+		for _, spn := range data.SemanticTokens {
+			t.Run(uriName(spn.URI()), func(t *testing.T) {
+				t.Helper()
+				tests.SemanticTokens(t, spn)
+			})
+		}
+	})
+
 	t.Run("Format", func(t *testing.T) {
 		t.Helper()
 		for _, spn := range data.Formats {
@@ -607,6 +621,7 @@ func checkData(t *testing.T, data *Data) {
 	fmt.Fprintf(buf, "CaseSensitiveCompletionsCount = %v\n", countCompletions(data.CaseSensitiveCompletions))
 	fmt.Fprintf(buf, "DiagnosticsCount = %v\n", diagnosticsCount)
 	fmt.Fprintf(buf, "FoldingRangesCount = %v\n", len(data.FoldingRanges))
+	fmt.Fprintf(buf, "SemanticTokensCount = %v\n", len(data.SemanticTokens))
 	fmt.Fprintf(buf, "FormatCount = %v\n", len(data.Formats))
 	fmt.Fprintf(buf, "ImportCount = %v\n", len(data.Imports))
 	fmt.Fprintf(buf, "SuggestedFixCount = %v\n", len(data.SuggestedFixes))
@@ -783,6 +798,10 @@ func (data *Data) collectFoldingRanges(spn span.Span) {
 	data.FoldingRanges = append(data.FoldingRanges, spn)
 }
 
+func (data *Data) collectSemanticTokens(spn span.Span) {
+	data.SemanticTokens = append(data.SemanticTokens, spn)
+}
+
 func (data *Data) collectFormats(spn span.Span) {
 	data.Formats = append(data.Formats, spn)
 }
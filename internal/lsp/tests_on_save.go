@@ -0,0 +1,167 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jackie-feng/tools/internal/lsp/protocol"
+	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
+	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
+	"github.com/jackie-feng/tools/internal/telemetry/tag"
+	"github.com/jackie-feng/tools/internal/telemetry/trace"
+	"github.com/jackie-feng/tools/internal/xcontext"
+)
+
+// maxConcurrentTestRuns is the number of go test processes
+// that may run in the background at the same time.
+const maxConcurrentTestRuns = 2
+
+// testRun is a background run of the tests in a package directory.
+type testRun struct {
+	cancel context.CancelFunc
+}
+
+// runTests runs the tests of the workspace packages affected by a change to fh,
+// and publishes their failures as diagnostics.
+func (s *Server) runTests(snapshot source.Snapshot, fh source.FileHandle) {
+	// Tests run against the files on disk, so they should not be canceled
+	// by later edits; only a later save of the same package replaces them.
+	ctx := xcontext.Detach(snapshot.View().BackgroundContext())
+	ctx, done := trace.StartSpan(ctx, "lsp:run-tests")
+	defer done()
+
+	for _, dir := range affectedPackageDirs(ctx, snapshot, fh) {
+		go s.runPackageTests(ctx, snapshot.View(), dir)
+	}
+}
+
+// affectedPackageDirs returns the directories of the workspace packages
+// that contain fh or transitively import a package that does.
+func affectedPackageDirs(ctx context.Context, snapshot source.Snapshot, fh source.FileHandle) []string {
+	phs, err := snapshot.PackageHandles(ctx, fh)
+	if err != nil {
+		log.Error(ctx, "runTests: no PackageHandles", err, telemetry.File.Of(fh.Identity().URI))
+		return nil
+	}
+	ids := make(map[string]bool)
+	for _, ph := range phs {
+		ids[ph.ID()] = true
+		for _, id := range snapshot.GetReverseDependencies(ph.ID()) {
+			ids[id] = true
+		}
+	}
+	folder := snapshot.View().Folder().Filename()
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, id := range snapshot.WorkspacePackageIDs(ctx) {
+		if !ids[id] {
+			continue
+		}
+		ph, err := snapshot.PackageHandle(ctx, id)
+		if err != nil {
+			continue
+		}
+		// Skip files generated outside of the workspace, such as cgo output.
+		for _, pgh := range ph.CompiledGoFiles() {
+			dir := filepath.Dir(pgh.File().Identity().URI.Filename())
+			if dir != folder && !strings.HasPrefix(dir, folder+string(filepath.Separator)) {
+				continue
+			}
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+			break
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// runPackageTests runs the tests in dir, replacing any run for the same
+// directory that is still in progress.
+func (s *Server) runPackageTests(ctx context.Context, view source.View, dir string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	run := &testRun{cancel: cancel}
+	s.testsMu.Lock()
+	if s.testRuns == nil {
+		s.testRuns = make(map[string]*testRun)
+		s.testSlots = make(chan struct{}, maxConcurrentTestRuns)
+	}
+	if prev, ok := s.testRuns[dir]; ok {
+		prev.cancel()
+	}
+	s.testRuns[dir] = run
+	slots := s.testSlots
+	s.testsMu.Unlock()
+
+	defer func() {
+		s.testsMu.Lock()
+		if s.testRuns[dir] == run {
+			delete(s.testRuns, dir)
+		}
+		s.testsMu.Unlock()
+	}()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-slots }()
+
+	reports, err := source.TestDiagnostics(ctx, view, dir)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error(ctx, "runTests: could not run tests", err, tag.Of("Dir", dir))
+		}
+		return
+	}
+	s.publishTestDiagnostics(ctx, dir, reports)
+}
+
+// publishTestDiagnostics replaces the test failures reported for the files
+// in dir, and republishes the diagnostics of every file whose failures changed.
+func (s *Server) publishTestDiagnostics(ctx context.Context, dir string, reports map[span.URI][]source.Diagnostic) {
+	s.deliveredMu.Lock()
+	defer s.deliveredMu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+	if s.testDiagnostics == nil {
+		s.testDiagnostics = make(map[span.URI][]source.Diagnostic)
+	}
+	changed := make(map[span.URI]bool)
+	for uri := range s.testDiagnostics {
+		if filepath.Dir(uri.Filename()) == dir {
+			delete(s.testDiagnostics, uri)
+			changed[uri] = true
+		}
+	}
+	for uri, diagnostics := range reports {
+		s.testDiagnostics[uri] = diagnostics
+		changed[uri] = true
+	}
+	for uri := range changed {
+		delivered := s.delivered[uri]
+		diagnostics := append(delivered.sorted[:len(delivered.sorted):len(delivered.sorted)], s.testDiagnostics[uri]...)
+		if err := s.client.PublishDiagnostics(ctx, &protocol.PublishDiagnosticsParams{
+			Diagnostics: toProtocolDiagnostics(ctx, diagnostics),
+			URI:         protocol.NewURI(uri),
+			Version:     delivered.version,
+		}); err != nil {
+			log.Error(ctx, "failed to deliver test diagnostics", err, telemetry.File.Of(uri))
+		}
+	}
+}
@@ -47,16 +47,17 @@ func (s *Server) didChange(ctx context.Context, params *protocol.DidChangeTextDo
 	if err != nil {
 		return err
 	}
-	snapshots, err := s.session.DidModifyFile(ctx, source.FileModification{
+	// The views apply the change to their snapshots when they are next
+	// requested, so no snapshot is returned.
+	if _, err := s.session.DidModifyFile(ctx, source.FileModification{
 		URI:     uri,
 		Action:  source.Change,
 		Version: params.TextDocument.Version,
 		Text:    text,
-	})
-	if err != nil {
+	}); err != nil {
 		return err
 	}
-	snapshot, view, err := snapshotOf(s.session, uri, snapshots)
+	view, err := s.session.ViewOf(uri)
 	if err != nil {
 		return err
 	}
@@ -68,12 +69,9 @@ func (s *Server) didChange(ctx context.Context, params *protocol.DidChangeTextDo
 			Type:    protocol.Warning,
 		})
 	}
-	fh, err := snapshot.GetFile(ctx, uri)
-	if err != nil {
-		return err
-	}
 	// Always update diagnostics after a file change.
-	return s.diagnose(snapshot, fh)
+	s.diagnoseAfterChange(view, uri)
+	return nil
 }
 
 func (s *Server) didSave(ctx context.Context, params *protocol.DidSaveTextDocumentParams) error {
@@ -85,8 +83,25 @@ func (s *Server) didSave(ctx context.Context, params *protocol.DidSaveTextDocume
 	if params.Text != nil {
 		c.Text = []byte(*params.Text)
 	}
-	_, err := s.session.DidModifyFile(ctx, c)
-	return err
+	snapshots, err := s.session.DidModifyFile(ctx, c)
+	if err != nil {
+		return err
+	}
+	snapshot, view, err := snapshotOf(s.session, c.URI, snapshots)
+	if err != nil {
+		return err
+	}
+	if !view.Options().RunTestsOnSave {
+		return nil
+	}
+	fh, err := snapshot.GetFile(ctx, c.URI)
+	if err != nil {
+		return err
+	}
+	if fh.Identity().Kind == source.Go {
+		go s.runTests(snapshot, fh)
+	}
+	return nil
 }
 
 func (s *Server) didClose(ctx context.Context, params *protocol.DidCloseTextDocumentParams) error {
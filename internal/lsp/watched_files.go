@@ -6,6 +6,9 @@ package lsp
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
@@ -15,10 +18,26 @@ import (
 )
 
 func (s *Server) didChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	// A go get changes both go.mod and go.sum: reload each view once.
+	var reload []source.View
 	for _, change := range params.Changes {
 		uri := span.NewURI(change.URI)
 		ctx := telemetry.File.With(ctx, uri)
 
+		if base := filepath.Base(uri.Filename()); base == "go.mod" || base == "go.sum" {
+			// If the client has this file open, its contents are the
+			// source of truth, and its changes arrive as didChange.
+			if s.session.IsOpen(uri) {
+				continue
+			}
+			for _, view := range s.session.Views() {
+				if view.Options().WatchFileChanges && inModule(view, uri) && !containsView(reload, view) {
+					reload = append(reload, view)
+				}
+			}
+			continue
+		}
+
 		for _, view := range s.session.Views() {
 			if !view.Options().WatchFileChanges {
 				continue
@@ -90,9 +109,49 @@ func (s *Server) didChangeWatchedFiles(ctx context.Context, params *protocol.Did
 			}
 		}
 	}
+	for _, view := range reload {
+		s.reloadView(ctx, view)
+	}
 	return nil
 }
 
+// reloadView replaces view after a change to its go.mod or go.sum file
+// made outside of the editor, tells the user how the requirements of the
+// module changed, and diagnoses the new view.
+func (s *Server) reloadView(ctx context.Context, view source.View) {
+	newView, changes, err := view.Reload(ctx)
+	if err != nil {
+		log.Error(ctx, "failed to reload view", err, telemetry.Directory.Of(view.Folder()))
+		return
+	}
+	msg := fmt.Sprintf("Reloaded %s after its go.mod or go.sum file changed", newView.Name())
+	if len(changes) > 0 {
+		msg += ": " + strings.Join(changes, ", ")
+	}
+	s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
+		Type:    protocol.Info,
+		Message: msg + ".",
+	})
+	go s.diagnoseSnapshot(newView.Snapshot())
+}
+
+// inModule reports whether the module file uri, a go.mod or go.sum file,
+// is in the folder of view or one of its parent directories.
+func inModule(view source.View, uri span.URI) bool {
+	dir := filepath.Dir(uri.Filename())
+	folder := view.Folder().Filename()
+	return folder == dir || strings.HasPrefix(folder, dir+string(filepath.Separator))
+}
+
+func containsView(views []source.View, view source.View) bool {
+	for _, v := range views {
+		if v == view {
+			return true
+		}
+	}
+	return false
+}
+
 func toFileAction(ct protocol.FileChangeType) source.FileAction {
 	switch ct {
 	case protocol.Changed:
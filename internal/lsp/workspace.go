@@ -9,7 +9,9 @@ import (
 
 	"github.com/jackie-feng/tools/internal/lsp/protocol"
 	"github.com/jackie-feng/tools/internal/lsp/source"
+	"github.com/jackie-feng/tools/internal/lsp/telemetry"
 	"github.com/jackie-feng/tools/internal/span"
+	"github.com/jackie-feng/tools/internal/telemetry/log"
 	errors "golang.org/x/xerrors"
 )
 
@@ -42,11 +44,24 @@ func (s *Server) addView(ctx context.Context, name string, uri span.URI) (source
 }
 
 func (s *Server) updateConfiguration(ctx context.Context, changed interface{}) error {
-	// go through all the views getting the config
+	// Clients that support workspace/configuration are asked for the
+	// configuration of each folder. For the others, use the sections of
+	// the settings that were sent with the notification.
+	supported := s.session.Options().ConfigurationSupported
+	settings, _ := changed.(map[string]interface{})
 	for _, view := range s.session.Views() {
 		options := s.session.Options()
-		if err := s.fetchConfig(ctx, view.Name(), view.Folder(), &options); err != nil {
-			return err
+		if supported {
+			if err := s.fetchConfig(ctx, view.Name(), view.Folder(), &options); err != nil {
+				log.Error(ctx, "failed to fetch configuration", err, telemetry.Directory.Of(view.Folder()))
+				continue
+			}
+		} else {
+			for _, section := range configSections(view.Name()) {
+				if config, ok := settings[section]; ok {
+					s.applyConfig(ctx, view.Name(), &options, config)
+				}
+			}
 		}
 		if _, err := view.SetOptions(ctx, options); err != nil {
 			return err
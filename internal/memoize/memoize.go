@@ -16,6 +16,7 @@ package memoize
 
 import (
 	"context"
+	"reflect"
 	"runtime"
 	"sync"
 	"unsafe"
@@ -140,6 +141,20 @@ func (s *Store) Cached(key interface{}) interface{} {
 	return h.Cached()
 }
 
+// Stats returns the number of entries in the store, by type of key.
+// Entries whose handles are no longer referenced may still be counted
+// until they are garbage collected.
+func (s *Store) Stats() map[reflect.Type]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[reflect.Type]int)
+	for k := range s.entries {
+		result[reflect.TypeOf(k)]++
+	}
+	return result
+}
+
 //go:nocheckptr
 // nocheckptr because: https://github.com/golang/go/issues/35125#issuecomment-545671062
 func (s *Store) get(key interface{}) *Handle {
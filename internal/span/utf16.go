@@ -6,7 +6,6 @@ package span
 
 import (
 	"fmt"
-	"unicode/utf16"
 	"unicode/utf8"
 )
 
@@ -45,8 +44,28 @@ func ToUTF16Column(p Point, content []byte) (int, error) {
 	start = start[:colZero]
 
 	// and count the number of utf16 characters
-	// in theory we could do this by hand more efficiently...
-	return len(utf16.Encode([]rune(string(start)))) + 1, nil
+	return utf16Len(start) + 1, nil
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode b,
+// without allocating, as b may be a line of several megabytes.
+func utf16Len(b []byte) int {
+	n := 0
+	for i := 0; i < len(b); {
+		if b[i] < utf8.RuneSelf {
+			n++
+			i++
+			continue
+		}
+		r, w := utf8.DecodeRune(b[i:])
+		if r >= 0x10000 {
+			// a two point rune
+			n++
+		}
+		n++
+		i += w
+	}
+	return n
 }
 
 // FromUTF16Column advances the point by the utf16 character offset given the
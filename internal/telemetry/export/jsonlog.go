@@ -0,0 +1,126 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/telemetry"
+)
+
+// JSONLogWriter returns an exporter that writes log events, and the spans
+// that have no parent, such as those of incoming requests, to w as JSON
+// objects, one per line.
+// Every record has a "time" field, log events have "msg" and "error"
+// fields, and spans have "span" and "duration" fields, with the duration
+// in milliseconds. The tags of the event or span follow, along with the
+// values that the event's context holds for keys.
+func JSONLogWriter(w io.Writer, keys ...interface{}) Exporter {
+	return &jsonLogWriter{writer: w, keys: keys}
+}
+
+type jsonLogWriter struct {
+	mu     sync.Mutex
+	writer io.Writer
+	keys   []interface{}
+}
+
+func (w *jsonLogWriter) StartSpan(context.Context, *telemetry.Span) {}
+
+func (w *jsonLogWriter) FinishSpan(ctx context.Context, span *telemetry.Span) {
+	if span.ParentID.IsValid() {
+		return
+	}
+	r := &jsonRecord{}
+	r.field("time", span.Start)
+	r.field("span", span.Name)
+	r.field("duration", float64(span.Finish.Sub(span.Start))/float64(time.Millisecond))
+	for _, event := range span.Events {
+		if event.Error != nil {
+			r.field("error", event.Error)
+		}
+	}
+	r.tags(span.Tags)
+	for _, event := range span.Events {
+		r.tags(event.Tags)
+	}
+	w.write(r)
+}
+
+func (w *jsonLogWriter) Log(ctx context.Context, event telemetry.Event) {
+	r := &jsonRecord{}
+	r.field("time", event.At)
+	if event.Message != "" {
+		r.field("msg", event.Message)
+	}
+	if event.Error != nil {
+		r.field("error", event.Error)
+	}
+	r.tags(event.Tags)
+	for _, key := range w.keys {
+		if v := ctx.Value(key); v != nil {
+			r.field(fmt.Sprint(key), v)
+		}
+	}
+	w.write(r)
+}
+
+func (w *jsonLogWriter) Metric(context.Context, telemetry.MetricData) {}
+func (w *jsonLogWriter) Flush()                                       {}
+
+func (w *jsonLogWriter) write(r *jsonRecord) {
+	r.buf.WriteString("}\n")
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writer.Write(r.buf.Bytes())
+}
+
+// jsonRecord builds a JSON object whose fields keep the order in which they
+// are added. Fields whose key was already added are dropped.
+type jsonRecord struct {
+	buf  bytes.Buffer
+	seen map[string]bool
+}
+
+func (r *jsonRecord) tags(tags telemetry.TagList) {
+	for _, tag := range tags {
+		if tag.Value != nil {
+			r.field(fmt.Sprint(tag.Key), tag.Value)
+		}
+	}
+}
+
+func (r *jsonRecord) field(key string, value interface{}) {
+	if r.seen[key] {
+		return
+	}
+	if r.seen == nil {
+		r.seen = make(map[string]bool)
+		r.buf.WriteByte('{')
+	} else {
+		r.buf.WriteByte(',')
+	}
+	r.seen[key] = true
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Time:
+		value = v.Format(time.RFC3339Nano)
+	}
+	k, _ := json.Marshal(key)
+	r.buf.Write(k)
+	r.buf.WriteByte(':')
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	r.buf.Write(data)
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/telemetry"
+	"github.com/jackie-feng/tools/internal/telemetry/export"
+	"github.com/jackie-feng/tools/internal/telemetry/tag"
+)
+
+func TestJSONLogWriter(t *testing.T) {
+	const (
+		method = tag.Key("method")
+		uri    = tag.Key("URI")
+	)
+	start := time.Date(2019, 12, 1, 10, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	w := export.JSONLogWriter(buf, method)
+
+	ctx := context.WithValue(context.Background(), method, "textDocument/hover")
+	w.Log(ctx, telemetry.Event{
+		At:      start,
+		Message: "parse failed",
+		Error:   errors.New("unexpected EOF"),
+		Tags:    telemetry.TagList{uri.Of("file:///a.go")},
+	})
+	w.FinishSpan(ctx, &telemetry.Span{
+		Name:   "textDocument/hover",
+		Start:  start,
+		Finish: start.Add(1500 * time.Microsecond),
+		Tags:   telemetry.TagList{method.Of("textDocument/hover")},
+		Events: []telemetry.Event{{Tags: telemetry.TagList{tag.Of("status.code", "OK")}}},
+	})
+	// Spans with a parent are not written.
+	w.FinishSpan(ctx, &telemetry.Span{
+		Name:     "source.Hover",
+		ParentID: telemetry.SpanID{1},
+	})
+
+	const want = `{"time":"2019-12-01T10:00:00Z","msg":"parse failed","error":"unexpected EOF","URI":"file:///a.go","method":"textDocument/hover"}
+{"time":"2019-12-01T10:00:00Z","span":"textDocument/hover","duration":1.5,"method":"textDocument/hover","status.code":"OK"}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
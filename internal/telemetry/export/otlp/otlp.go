@@ -0,0 +1,300 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otlp adds the ability to export spans to an OpenTelemetry
+// collector, or to any tracing system that accepts the OpenTelemetry
+// protocol over HTTP, such as Jaeger.
+// Like the ocagent exporter, it encodes the protocol as JSON so that it
+// has no compile time dependencies.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/telemetry"
+	"github.com/jackie-feng/tools/internal/telemetry/export"
+)
+
+// The environment variables that configure the exporter, as defined by the
+// OpenTelemetry specification.
+const (
+	endpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	tracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	headersEnv        = "OTEL_EXPORTER_OTLP_HEADERS"
+	serviceNameEnv    = "OTEL_SERVICE_NAME"
+)
+
+// tracesPath is the path of the trace export service of a collector.
+const tracesPath = "/v1/traces"
+
+type Config struct {
+	Host    string
+	Process uint32
+	Client  *http.Client
+	Service string
+	// Address is the base address of the collector, such as
+	// http://localhost:4318. Spans are sent to Address + "/v1/traces".
+	Address string
+	// URL, if set, is the full address to send spans to, and overrides
+	// Address.
+	URL string
+	// Headers are added to every request, for authentication.
+	Headers map[string]string
+	Rate    time.Duration
+}
+
+// Discover returns the configuration given by the standard OpenTelemetry
+// environment variables. Its Address is "off" if they do not name a
+// collector.
+func Discover() *Config {
+	cfg := &Config{
+		Address: os.Getenv(endpointEnv),
+		URL:     os.Getenv(tracesEndpointEnv),
+		Service: os.Getenv(serviceNameEnv),
+	}
+	if cfg.Address == "" && cfg.URL == "" {
+		cfg.Address = "off"
+	}
+	if h := os.Getenv(headersEnv); h != "" {
+		cfg.Headers = make(map[string]string)
+		for _, kv := range strings.Split(h, ",") {
+			i := strings.IndexByte(kv, '=')
+			if i < 0 {
+				continue
+			}
+			cfg.Headers[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+		}
+	}
+	return cfg
+}
+
+type exporter struct {
+	mu     sync.Mutex
+	config Config
+	spans  []*telemetry.Span
+}
+
+// Connect creates a process specific exporter that sends the finished spans
+// to the collector given by config.
+func Connect(config *Config) export.Exporter {
+	if config == nil || (config.URL == "" && (config.Address == "" || config.Address == "off")) {
+		return nil
+	}
+	exporter := &exporter{config: *config}
+	if exporter.config.URL == "" {
+		exporter.config.URL = strings.TrimSuffix(exporter.config.Address, "/") + tracesPath
+	}
+	if exporter.config.Host == "" {
+		hostname, _ := os.Hostname()
+		exporter.config.Host = hostname
+	}
+	if exporter.config.Process == 0 {
+		exporter.config.Process = uint32(os.Getpid())
+	}
+	if exporter.config.Client == nil {
+		exporter.config.Client = http.DefaultClient
+	}
+	if exporter.config.Service == "" {
+		exporter.config.Service = filepath.Base(os.Args[0])
+	}
+	if exporter.config.Rate == 0 {
+		exporter.config.Rate = 2 * time.Second
+	}
+	go func() {
+		for range time.Tick(exporter.config.Rate) {
+			exporter.Flush()
+		}
+	}()
+	return exporter
+}
+
+func (e *exporter) StartSpan(ctx context.Context, span *telemetry.Span) {}
+
+func (e *exporter) FinishSpan(ctx context.Context, span *telemetry.Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *exporter) Log(context.Context, telemetry.Event) {}
+
+func (e *exporter) Metric(context.Context, telemetry.MetricData) {}
+
+func (e *exporter) Flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.spans) == 0 {
+		return
+	}
+	spans := make([]*span, len(e.spans))
+	for i, s := range e.spans {
+		spans[i] = convertSpan(s)
+	}
+	e.spans = nil
+
+	e.send(&exportTraceServiceRequest{
+		ResourceSpans: []*resourceSpans{{
+			Resource: e.config.buildResource(),
+			ScopeSpans: []*scopeSpans{{
+				Scope: &instrumentationScope{Name: "x/tools"},
+				Spans: spans,
+			}},
+		}},
+	})
+}
+
+func (cfg *Config) buildResource() *resource {
+	return &resource{
+		Attributes: []*keyValue{
+			{Key: "service.name", Value: convertAttribute(cfg.Service)},
+			{Key: "host.name", Value: convertAttribute(cfg.Host)},
+			{Key: "process.pid", Value: convertAttribute(cfg.Process)},
+		},
+	}
+}
+
+func (e *exporter) send(message interface{}) {
+	blob, err := json.Marshal(message)
+	if err != nil {
+		errorInExport("otlp failed to marshal message: %v", err)
+		return
+	}
+	req, err := http.NewRequest("POST", e.config.URL, bytes.NewReader(blob))
+	if err != nil {
+		errorInExport("otlp failed to build request for %v: %v", e.config.URL, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		errorInExport("otlp failed to send message: %v", err)
+		return
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+}
+
+func errorInExport(message string, args ...interface{}) {
+	// This function is useful when debugging the exporter, but in general we
+	// want to just drop any export
+}
+
+func convertTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func convertSpan(s *telemetry.Span) *span {
+	result := &span{
+		TraceID:           hex.EncodeToString(s.ID.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.ID.SpanID[:]),
+		Name:              s.Name,
+		Kind:              internalSpanKind,
+		StartTimeUnixNano: convertTimestamp(s.Start),
+		EndTimeUnixNano:   convertTimestamp(s.Finish),
+		Attributes:        convertAttributes(s.Tags),
+	}
+	if s.ParentID.IsValid() {
+		result.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+	}
+	for _, ev := range s.Events {
+		result.Events = append(result.Events, convertEvent(ev))
+		if ev.Error != nil {
+			// The span failed if any of its events is an error.
+			result.Status = &status{Code: errorStatusCode, Message: ev.Error.Error()}
+		}
+	}
+	return result
+}
+
+func convertEvent(ev telemetry.Event) *event {
+	result := &event{
+		TimeUnixNano: convertTimestamp(ev.At),
+		Name:         ev.Message,
+		Attributes:   convertAttributes(ev.Tags),
+	}
+	if ev.Error != nil {
+		if result.Name == "" {
+			result.Name = ev.Error.Error()
+		} else {
+			result.Attributes = append(result.Attributes, &keyValue{
+				Key:   "error",
+				Value: convertAttribute(ev.Error.Error()),
+			})
+		}
+	}
+	return result
+}
+
+func convertAttributes(tags telemetry.TagList) []*keyValue {
+	if len(tags) == 0 {
+		return nil
+	}
+	result := make([]*keyValue, len(tags))
+	for i, tag := range tags {
+		result[i] = &keyValue{
+			Key:   fmt.Sprint(tag.Key),
+			Value: convertAttribute(tag.Value),
+		}
+	}
+	return result
+}
+
+func convertAttribute(v interface{}) *anyValue {
+	intValue := func(i int64) *anyValue {
+		s := strconv.FormatInt(i, 10)
+		return &anyValue{IntValue: &s}
+	}
+	switch v := v.(type) {
+	case int8:
+		return intValue(int64(v))
+	case int16:
+		return intValue(int64(v))
+	case int32:
+		return intValue(int64(v))
+	case int64:
+		return intValue(v)
+	case int:
+		return intValue(int64(v))
+	case uint8:
+		return intValue(int64(v))
+	case uint16:
+		return intValue(int64(v))
+	case uint32:
+		return intValue(int64(v))
+	case uint64:
+		return intValue(int64(v))
+	case uint:
+		return intValue(int64(v))
+	case float32:
+		f := float64(v)
+		return &anyValue{DoubleValue: &f}
+	case float64:
+		return &anyValue{DoubleValue: &v}
+	case bool:
+		return &anyValue{BoolValue: &v}
+	case string:
+		return &anyValue{StringValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return &anyValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackie-feng/tools/internal/telemetry"
+	"github.com/jackie-feng/tools/internal/telemetry/export/otlp"
+	"github.com/jackie-feng/tools/internal/telemetry/tag"
+)
+
+func TestSpans(t *testing.T) {
+	sent := &fakeSender{}
+	exporter := otlp.Connect(&otlp.Config{
+		Host:    "tester",
+		Process: 1,
+		Service: "otlp-tests",
+		Address: "http://collector:4318/",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Client:  &http.Client{Transport: sent},
+		Rate:    time.Hour,
+	})
+	start := time.Unix(30, 0)
+	at := time.Unix(40, 0)
+	end := time.Unix(50, 0)
+	span := &telemetry.Span{
+		Name: "request",
+		ID: telemetry.SpanContext{
+			TraceID: telemetry.TraceID{0: 1, 15: 2},
+			SpanID:  telemetry.SpanID{0: 3, 7: 4},
+		},
+		ParentID: telemetry.SpanID{7: 5},
+		Start:    start,
+		Finish:   end,
+		Tags:     telemetry.TagList{tag.Of("method", "textDocument/hover")},
+		Events: []telemetry.Event{{
+			At:      at,
+			Message: "cache miss",
+			Error:   errors.New("no network connectivity"),
+			Tags:    telemetry.TagList{tag.Of("retries", 3)},
+		}},
+	}
+	ctx := context.Background()
+	exporter.StartSpan(ctx, span)
+	exporter.FinishSpan(ctx, span)
+	exporter.Flush()
+
+	const want = `{"resourceSpans":[{
+		"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"otlp-tests"}},
+			{"key":"host.name","value":{"stringValue":"tester"}},
+			{"key":"process.pid","value":{"intValue":"1"}}
+		]},
+		"scopeSpans":[{
+			"scope":{"name":"x/tools"},
+			"spans":[{
+				"traceId":"01000000000000000000000000000002",
+				"spanId":"0300000000000004",
+				"parentSpanId":"0000000000000005",
+				"name":"request",
+				"kind":1,
+				"startTimeUnixNano":"30000000000",
+				"endTimeUnixNano":"50000000000",
+				"attributes":[{"key":"method","value":{"stringValue":"textDocument/hover"}}],
+				"events":[{
+					"timeUnixNano":"40000000000",
+					"name":"cache miss",
+					"attributes":[
+						{"key":"retries","value":{"intValue":"3"}},
+						{"key":"error","value":{"stringValue":"no network connectivity"}}
+					]
+				}],
+				"status":{"message":"no network connectivity","code":2}
+			}]
+		}]
+	}]}`
+	got := sent.get("http://collector:4318/v1/traces")
+	checkJSON(t, got, []byte(want))
+	if auth := sent.header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Authorization header = %q, want %q", auth, "Bearer token")
+	}
+
+	// Nothing is sent when there are no new spans.
+	exporter.Flush()
+	if got := sent.get("http://collector:4318/v1/traces"); got != nil {
+		t.Errorf("unexpected second export: %s", got)
+	}
+}
+
+func TestConnectOff(t *testing.T) {
+	for _, cfg := range []*otlp.Config{nil, {}, {Address: "off"}} {
+		if exporter := otlp.Connect(cfg); exporter != nil {
+			t.Errorf("Connect(%+v) = %v, want nil", cfg, exporter)
+		}
+	}
+}
+
+func checkJSON(t *testing.T, got, want []byte) {
+	// compare the compact form, to allow for formatting differences
+	g := &bytes.Buffer{}
+	if err := json.Compact(g, got); err != nil {
+		t.Fatal(err)
+	}
+	w := &bytes.Buffer{}
+	if err := json.Compact(w, want); err != nil {
+		t.Fatal(err)
+	}
+	if g.String() != w.String() {
+		t.Fatalf("Got:\n%s\nWant:\n%s", g, w)
+	}
+}
+
+type fakeSender struct {
+	mu     sync.Mutex
+	data   map[string][]byte
+	header http.Header
+}
+
+func (s *fakeSender) get(url string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, found := s.data[url]
+	if found {
+		delete(s.data, url)
+	}
+	return data
+}
+
+func (s *fakeSender) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string][]byte)
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.data[req.URL.String()] = data
+	s.header = req.Header
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		ProtoMinor: 0,
+	}, nil
+}
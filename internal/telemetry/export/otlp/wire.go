@@ -0,0 +1,83 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp
+
+// This file contains the types of the JSON encoding of the OTLP trace
+// export request. 64 bit integers are encoded as strings, and trace and
+// span identifiers as hex strings.
+
+type exportTraceServiceRequest struct {
+	ResourceSpans []*resourceSpans `json:"resourceSpans,omitempty"`
+}
+
+type resourceSpans struct {
+	Resource   *resource     `json:"resource,omitempty"`
+	ScopeSpans []*scopeSpans `json:"scopeSpans,omitempty"`
+}
+
+type resource struct {
+	Attributes []*keyValue `json:"attributes,omitempty"`
+}
+
+type scopeSpans struct {
+	Scope *instrumentationScope `json:"scope,omitempty"`
+	Spans []*span               `json:"spans,omitempty"`
+}
+
+type instrumentationScope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type span struct {
+	TraceID           string      `json:"traceId,omitempty"`
+	SpanID            string      `json:"spanId,omitempty"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name,omitempty"`
+	Kind              spanKind    `json:"kind,omitempty"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano,omitempty"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano,omitempty"`
+	Attributes        []*keyValue `json:"attributes,omitempty"`
+	Events            []*event    `json:"events,omitempty"`
+	Status            *status     `json:"status,omitempty"`
+}
+
+type spanKind int32
+
+const (
+	unspecifiedSpanKind spanKind = 0
+	internalSpanKind    spanKind = 1
+)
+
+type event struct {
+	TimeUnixNano string      `json:"timeUnixNano,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	Attributes   []*keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Message string     `json:"message,omitempty"`
+	Code    statusCode `json:"code,omitempty"`
+}
+
+type statusCode int32
+
+const (
+	unsetStatusCode statusCode = 0
+	errorStatusCode statusCode = 2
+)
+
+type keyValue struct {
+	Key   string    `json:"key"`
+	Value *anyValue `json:"value"`
+}
+
+// anyValue holds exactly one of its fields.
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
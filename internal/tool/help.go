@@ -0,0 +1,304 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// printUsage prints the help of app, run as the command path with the flags
+// in s: the short help, the usage line, the detailed help, the subcommands
+// and the flags.
+func printUsage(w io.Writer, path string, app Application, s *flag.FlagSet) {
+	out := s.Output()
+	s.SetOutput(w)
+	defer s.SetOutput(out)
+	fmt.Fprint(w, app.ShortHelp())
+	fmt.Fprintf(w, "\n\nUsage: %v [flags] %v\n", path, app.Usage())
+	app.DetailedHelp(s)
+	if sc, ok := app.(SubCommander); ok {
+		fmt.Fprintf(w, "\n%s commands are:\n", path)
+		for _, c := range sc.SubCommands() {
+			fmt.Fprintf(w, "  %s : %v\n", c.Name(), c.ShortHelp())
+		}
+	}
+	if hasFlags(s) {
+		fmt.Fprintf(w, "\n%s flags are:\n", path)
+		s.PrintDefaults()
+	}
+}
+
+func hasFlags(s *flag.FlagSet) bool {
+	has := false
+	s.VisitAll(func(*flag.Flag) { has = true })
+	return has
+}
+
+// Help prints the help of the command of app named by path, the names of
+// the subcommands leading to it, as the -h flag of the command does.
+func Help(w io.Writer, app Application, path ...string) error {
+	names, c, err := find(app, path)
+	if err != nil {
+		return err
+	}
+	printUsage(w, strings.Join(names, " "), c, FlagSet(c))
+	return nil
+}
+
+// Markdown prints the help of the command of app named by path, and of all
+// of its subcommands, as a markdown document.
+func Markdown(w io.Writer, app Application, path ...string) error {
+	d, err := newDocument(app, path)
+	if err != nil {
+		return err
+	}
+	d.walk(0, func(d *document, depth int) {
+		if depth > 5 {
+			depth = 5
+		}
+		fmt.Fprintf(w, "%s %s\n\n%s\n\n", strings.Repeat("#", depth+1), d.path, d.app.ShortHelp())
+		fmt.Fprintf(w, "```\n%s [flags] %s\n```\n\n", d.path, d.app.Usage())
+		for _, b := range d.detail {
+			if b.pre {
+				fmt.Fprintf(w, "```\n%s\n```\n\n", strings.Join(b.lines, "\n"))
+			} else {
+				fmt.Fprintf(w, "%s\n\n", strings.Join(b.lines, "\n"))
+			}
+		}
+		if len(d.commands) > 0 {
+			fmt.Fprint(w, "Commands:\n\n")
+			for _, c := range d.commands {
+				fmt.Fprintf(w, "- `%s`: %s\n", c.app.Name(), c.app.ShortHelp())
+			}
+			fmt.Fprintln(w)
+		}
+		if hasFlags(d.flags) {
+			fmt.Fprint(w, "Flags:\n\n")
+			d.flags.VisitAll(func(f *flag.Flag) {
+				name, usage, def := flagHelp(f)
+				fmt.Fprintf(w, "- `%s`: %s%s\n", name, strings.Replace(usage, "\n", " ", -1), def)
+			})
+			fmt.Fprintln(w)
+		}
+	})
+	return nil
+}
+
+// Man prints the help of the command of app named by path, and of all of its
+// subcommands, as a manual page in section 1, for man(1).
+func Man(w io.Writer, app Application, path ...string) error {
+	d, err := newDocument(app, path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, ".TH %s 1\n", strings.ToUpper(strings.Replace(d.path, " ", "-", -1)))
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", roff(d.path), roff(d.app.ShortHelp()))
+	commands := false // whether the section of the subcommands has started
+	d.walk(0, func(d *document, depth int) {
+		switch {
+		case depth == 0:
+			fmt.Fprint(w, ".SH SYNOPSIS\n")
+		case !commands:
+			fmt.Fprint(w, ".SH COMMANDS\n")
+			commands = true
+			fallthrough
+		default:
+			fmt.Fprintf(w, ".SS \"%s\"\n%s\n", roff(d.path), roff(d.app.ShortHelp()))
+		}
+		fmt.Fprintf(w, ".PP\n.B %s\n%s\n", roff(d.path), roff("[flags] "+d.app.Usage()))
+		if depth == 0 {
+			fmt.Fprint(w, ".SH DESCRIPTION\n")
+		}
+		for _, b := range d.detail {
+			if b.pre {
+				fmt.Fprint(w, ".PP\n.RS\n.nf\n")
+				for _, line := range b.lines {
+					fmt.Fprintln(w, roff(line))
+				}
+				fmt.Fprint(w, ".fi\n.RE\n")
+			} else {
+				fmt.Fprint(w, ".PP\n")
+				for _, line := range b.lines {
+					fmt.Fprintln(w, roff(line))
+				}
+			}
+		}
+		if depth == 0 && hasFlags(d.flags) {
+			fmt.Fprint(w, ".SH OPTIONS\n")
+		} else if hasFlags(d.flags) {
+			fmt.Fprint(w, ".PP\nFlags:\n")
+		}
+		d.flags.VisitAll(func(f *flag.Flag) {
+			name, usage, def := flagHelp(f)
+			fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(name), roff(strings.Replace(usage, "\n", " ", -1)+def))
+		})
+	})
+	return nil
+}
+
+// flagHelp returns the name of f, with the name of its value if it takes
+// one, its usage, and a note of its default value if it is not the zero
+// value.
+func flagHelp(f *flag.Flag) (name, usage, def string) {
+	value, usage := flag.UnquoteUsage(f)
+	name = "-" + f.Name
+	if value != "" {
+		name += " " + value
+	}
+	switch f.DefValue {
+	case "", "0", "false", "0s", "[]":
+	default:
+		def = fmt.Sprintf(" (default %v)", f.DefValue)
+	}
+	return name, usage, def
+}
+
+// roff escapes s for a line of a manual page.
+func roff(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// find returns the command of app named by path, along with the names of the
+// commands leading to it, starting with app.
+func find(app Application, path []string) ([]string, Application, error) {
+	names := []string{app.Name()}
+	for _, name := range path {
+		sc, ok := app.(SubCommander)
+		if !ok {
+			return nil, nil, CommandLineErrorf("%s has no commands", strings.Join(names, " "))
+		}
+		app = nil
+		for _, c := range sc.SubCommands() {
+			if c.Name() == name {
+				app = c
+				break
+			}
+		}
+		names = append(names, name)
+		if app == nil {
+			return nil, nil, CommandLineErrorf("unknown command %s", strings.Join(names, " "))
+		}
+	}
+	return names, app, nil
+}
+
+// A document is the help of a command and its subcommands, as exported by
+// Markdown and Man.
+type document struct {
+	path     string
+	app      Application
+	flags    *flag.FlagSet
+	detail   []block
+	commands []*document
+}
+
+// A block is a paragraph of detailed help, or a run of indented lines, such
+// as an example, whose layout is kept.
+type block struct {
+	lines []string
+	pre   bool
+}
+
+func newDocument(app Application, path []string) (*document, error) {
+	names, app, err := find(app, path)
+	if err != nil {
+		return nil, err
+	}
+	return buildDocument(strings.Join(names, " "), app), nil
+}
+
+func buildDocument(path string, app Application) *document {
+	d := &document{
+		path:  path,
+		app:   app,
+		flags: FlagSet(app),
+	}
+	var buf bytes.Buffer
+	d.flags.SetOutput(&buf)
+	app.DetailedHelp(d.flags)
+	d.detail = splitBlocks(buf.String())
+	if sc, ok := app.(SubCommander); ok {
+		for _, c := range sc.SubCommands() {
+			d.commands = append(d.commands, buildDocument(path+" "+c.Name(), c))
+		}
+	}
+	return d
+}
+
+// walk calls f for d and each document below it, in order.
+func (d *document) walk(depth int, f func(*document, int)) {
+	f(d, depth)
+	for _, c := range d.commands {
+		c.walk(depth+1, f)
+	}
+}
+
+// splitBlocks splits detailed help text into paragraphs, separated by blank
+// lines, and runs of indented lines, from which their common indentation is
+// removed.
+func splitBlocks(text string) []block {
+	var blocks []block
+	blank := 0 // blank lines seen since the last line of the last block
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			blank++
+			continue
+		}
+		pre := line[0] == ' ' || line[0] == '\t'
+		n := len(blocks)
+		switch {
+		case n == 0 || blocks[n-1].pre != pre || !pre && blank > 0:
+			blocks = append(blocks, block{pre: pre})
+			n++
+		case pre:
+			// Keep the blank lines within a run of indented lines.
+			for ; blank > 0; blank-- {
+				blocks[n-1].lines = append(blocks[n-1].lines, "")
+			}
+		}
+		blank = 0
+		blocks[n-1].lines = append(blocks[n-1].lines, line)
+	}
+	for _, b := range blocks {
+		if b.pre {
+			dedent(b.lines)
+		}
+	}
+	return blocks
+}
+
+// dedent removes the leading white space common to the non-blank lines, the
+// first of which is not blank.
+func dedent(lines []string) {
+	prefix := indentation(lines[0])
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		indent := indentation(line)
+		n := 0
+		for n < len(prefix) && n < len(indent) && prefix[n] == indent[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, prefix)
+	}
+}
+
+func indentation(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
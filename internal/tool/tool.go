@@ -9,6 +9,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"reflect"
@@ -56,7 +57,9 @@ type Application interface {
 	// DetailedHelp should print a detailed help message. It will only ever be shown
 	// when the ShortHelp is also printed, so there is no need to duplicate
 	// anything from there.
-	// It is passed the flag set so it can print the default values of the flags.
+	// The usage line, the subcommands and the flags are printed around it by
+	// the tool package, so it should only describe the command, such as with
+	// examples.
 	// It should use the flag sets configured Output to write the help to.
 	DetailedHelp(*flag.FlagSet)
 	// Run is invoked after all flag processing, and inside the profiling and
@@ -64,17 +67,32 @@ type Application interface {
 	Run(ctx context.Context, args ...string) error
 }
 
+// SubCommander is implemented by an Application that dispatches to nested
+// subcommands, each an Application with its own flags. The subcommands are
+// listed in the help of the application, and its Run method normally hands
+// its arguments to RunSubCommand.
+type SubCommander interface {
+	Application
+	// SubCommands returns the subcommands of the application, in the order
+	// in which they are listed in its help.
+	SubCommands() []Application
+}
+
 // This is the type returned by CommandLineErrorf, which causes the outer main
 // to trigger printing of the command line help.
-type commandLineError string
+type commandLineError struct {
+	message string
+	// usage prints the help of the command that reported the error.
+	usage func(io.Writer)
+}
 
-func (e commandLineError) Error() string { return string(e) }
+func (e *commandLineError) Error() string { return e.message }
 
 // CommandLineErrorf is like fmt.Errorf except that it returns a value that
 // triggers printing of the command line help.
 // In general you should use this when generating command line validation errors.
 func CommandLineErrorf(message string, args ...interface{}) error {
-	return commandLineError(fmt.Sprintf(message, args...))
+	return &commandLineError{message: fmt.Sprintf(message, args...)}
 }
 
 // Main should be invoked directly by main function.
@@ -82,34 +100,59 @@ func CommandLineErrorf(message string, args ...interface{}) error {
 // was encountered it is printed to standard error and the
 // application exits with an exit code of 2.
 func Main(ctx context.Context, app Application, args []string) {
-	s := flag.NewFlagSet(app.Name(), flag.ExitOnError)
-	s.Usage = func() {
-		fmt.Fprint(s.Output(), app.ShortHelp())
-		fmt.Fprintf(s.Output(), "\n\nUsage: %v [flags] %v\n", app.Name(), app.Usage())
-		app.DetailedHelp(s)
-	}
 	if err := Run(ctx, app, args); err != nil {
-		fmt.Fprintf(s.Output(), "%s: %v\n", app.Name(), err)
-		if _, printHelp := err.(commandLineError); printHelp {
-			s.Usage()
+		fmt.Fprintf(os.Stderr, "%s: %v\n", app.Name(), err)
+		if e, ok := err.(*commandLineError); ok && e.usage != nil {
+			e.usage(os.Stderr)
 		}
 		os.Exit(2)
 	}
 }
 
+// pathKey is the context key of the names of the commands being run, from
+// the outermost one, separated by spaces.
+type pathKey struct{}
+
 // Run is the inner loop for Main; invoked by Main, recursively by
 // Run, and by various tests.  It runs the application and returns an
 // error.
+// When Run is invoked from the Run method of another application, app is
+// treated as a subcommand of it, and named after it in the help.
 func Run(ctx context.Context, app Application, args []string) error {
-	s := flag.NewFlagSet(app.Name(), flag.ExitOnError)
-	s.Usage = func() {
-		fmt.Fprint(s.Output(), app.ShortHelp())
-		fmt.Fprintf(s.Output(), "\n\nUsage: %v [flags] %v\n", app.Name(), app.Usage())
-		app.DetailedHelp(s)
+	path := app.Name()
+	if parent, ok := ctx.Value(pathKey{}).(string); ok {
+		path = parent + " " + path
 	}
+	ctx = context.WithValue(ctx, pathKey{}, path)
+	s := flag.NewFlagSet(path, flag.ExitOnError)
+	s.Usage = func() { printUsage(s.Output(), path, app, s) }
 	p := addFlags(s, reflect.StructField{}, reflect.ValueOf(app))
 	s.Parse(args)
 
+	err := run(ctx, app, p, s.Args())
+	if e, ok := err.(*commandLineError); ok && e.usage == nil {
+		// Report the help of the innermost command.
+		e.usage = func(w io.Writer) { printUsage(w, path, app, s) }
+	}
+	return err
+}
+
+// RunSubCommand runs the subcommand of app named by the first of args with
+// the rest of them. It is meant to be called from the Run method of app.
+func RunSubCommand(ctx context.Context, app SubCommander, args []string) error {
+	if len(args) == 0 {
+		return CommandLineErrorf("%s expects a command", app.Name())
+	}
+	name, args := args[0], args[1:]
+	for _, c := range app.SubCommands() {
+		if c.Name() == name {
+			return Run(ctx, c, args)
+		}
+	}
+	return CommandLineErrorf("unknown command %v", name)
+}
+
+func run(ctx context.Context, app Application, p *Profile, args []string) error {
 	if p != nil && p.CPU != "" {
 		f, err := os.Create(p.CPU)
 		if err != nil {
@@ -149,7 +192,15 @@ func Run(ctx context.Context, app Application, args []string) error {
 		}()
 	}
 
-	return app.Run(ctx, s.Args()...)
+	return app.Run(ctx, args...)
+}
+
+// FlagSet returns the flag set that Run parses the command line of app with,
+// so that the flags of an application can be listed without running it.
+func FlagSet(app Application) *flag.FlagSet {
+	s := flag.NewFlagSet(app.Name(), flag.ContinueOnError)
+	addFlags(s, reflect.StructField{}, reflect.ValueOf(app))
+	return s
 }
 
 // addFlags scans fields of structs recursively to find things with flag tags